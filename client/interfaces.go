@@ -65,7 +65,9 @@ type InstanceServer interface {
 	// Server functions
 	GetServer() (server *api.Server, ETag string, err error)
 	GetServerResources() (resources *api.Resources, err error)
+	GetMetadataConfiguration() (metadata *api.MetadataConfiguration, err error)
 	UpdateServer(server api.ServerPut, ETag string) (err error)
+	ApplyServerPreseed(preseed api.Preseed, dryRun bool) (result *api.PreseedResult, err error)
 	HasExtension(extension string) (exists bool)
 	RequireAuthenticated(authenticated bool)
 	IsClustered() (clustered bool)
@@ -142,6 +144,7 @@ type InstanceServer interface {
 	GetInstances(instanceType api.InstanceType) (instances []api.Instance, err error)
 	GetInstancesFull(instanceType api.InstanceType) (instances []api.InstanceFull, err error)
 	GetInstance(name string) (instance *api.Instance, ETag string, err error)
+	GetInstanceExpanded(name string) (instance *api.InstanceExpanded, ETag string, err error)
 	CreateInstance(instance api.InstancesPost) (op Operation, err error)
 	CreateInstanceFromImage(source ImageServer, image api.Image, req api.InstancesPost) (op RemoteOperation, err error)
 	CopyInstance(source InstanceServer, instance api.Instance, args *InstanceCopyArgs) (op RemoteOperation, err error)
@@ -162,6 +165,8 @@ type InstanceServer interface {
 	GetInstanceSnapshotNames(instanceName string) (names []string, err error)
 	GetInstanceSnapshots(instanceName string) (snapshots []api.InstanceSnapshot, err error)
 	GetInstanceSnapshot(instanceName string, name string) (snapshot *api.InstanceSnapshot, ETag string, err error)
+	GetInstanceSnapshotFile(instanceName string, snapshotName string, path string) (content io.ReadCloser, resp *InstanceFileResponse, err error)
+	GetInstanceSnapshotDiffFile(instanceName string, snapshotName string, args InstanceSnapshotDiffArgs, req *BackupFileRequest) (resp *BackupFileResponse, err error)
 	CreateInstanceSnapshot(instanceName string, snapshot api.InstanceSnapshotsPost) (op Operation, err error)
 	CopyInstanceSnapshot(source InstanceServer, instanceName string, snapshot api.InstanceSnapshot, args *InstanceSnapshotCopyArgs) (op RemoteOperation, err error)
 	RenameInstanceSnapshot(instanceName string, name string, instance api.InstanceSnapshotPost) (op Operation, err error)
@@ -174,8 +179,11 @@ type InstanceServer interface {
 	GetInstanceBackup(instanceName string, name string) (backup *api.InstanceBackup, ETag string, err error)
 	CreateInstanceBackup(instanceName string, backup api.InstanceBackupsPost) (op Operation, err error)
 	RenameInstanceBackup(instanceName string, name string, backup api.InstanceBackupPost) (op Operation, err error)
+	GetInstanceBackupContents(instanceName string, name string, path string) (entries []api.InstanceBackupEntry, err error)
+	RestoreInstanceBackupPaths(instanceName string, name string, req api.InstanceBackupRestorePost) (op Operation, err error)
 	DeleteInstanceBackup(instanceName string, name string) (op Operation, err error)
 	GetInstanceBackupFile(instanceName string, name string, req *BackupFileRequest) (resp *BackupFileResponse, err error)
+	GetInstanceExportFile(instanceName string, args InstanceExportArgs, req *BackupFileRequest) (resp *BackupFileResponse, err error)
 	CreateInstanceFromBackup(args InstanceBackupArgs) (op Operation, err error)
 
 	GetInstanceState(name string) (state *api.InstanceState, ETag string, err error)
@@ -213,6 +221,7 @@ type InstanceServer interface {
 	GetNetworkNames() (names []string, err error)
 	GetNetworks() (networks []api.Network, err error)
 	GetNetwork(name string) (network *api.Network, ETag string, err error)
+	GetNetworkAllocations(name string) (allocations []api.NetworkAllocation, err error)
 	GetNetworkLeases(name string) (leases []api.NetworkLease, err error)
 	GetNetworkState(name string) (state *api.NetworkState, err error)
 	CreateNetwork(network api.NetworksPost) (err error)
@@ -228,6 +237,16 @@ type InstanceServer interface {
 	GetOperationWebsocket(uuid string, secret string) (conn *websocket.Conn, err error)
 	DeleteOperation(uuid string) (err error)
 
+	// Instance preset functions
+	GetInstancePresetNames() (names []string, err error)
+	GetInstancePresets() (presets []api.InstancePreset, err error)
+	GetInstancePreset(name string) (preset *api.InstancePreset, ETag string, err error)
+	CreateInstancePreset(preset api.InstancePresetsPost) (err error)
+	UpdateInstancePreset(name string, preset api.InstancePresetPut, ETag string) (err error)
+	RenameInstancePreset(name string, preset api.InstancePresetPost) (err error)
+	DeleteInstancePreset(name string) (err error)
+	CreateInstanceFromPreset(name string, instance api.InstancePresetInstancesPost) (op Operation, err error)
+
 	// Profile functions
 	GetProfileNames() (names []string, err error)
 	GetProfiles() (profiles []api.Profile, err error)
@@ -236,6 +255,8 @@ type InstanceServer interface {
 	UpdateProfile(name string, profile api.ProfilePut, ETag string) (err error)
 	RenameProfile(name string, profile api.ProfilePost) (err error)
 	DeleteProfile(name string) (err error)
+	GetProfileDiff(name string) (diffs []api.ProfileInstanceDiff, err error)
+	ApplyProfile(name string) (op Operation, err error)
 
 	// Project functions
 	GetProjectNames() (names []string, err error)
@@ -245,12 +266,15 @@ type InstanceServer interface {
 	UpdateProject(name string, project api.ProjectPut, ETag string) (err error)
 	RenameProject(name string, project api.ProjectPost) (op Operation, err error)
 	DeleteProject(name string) (err error)
+	GetProjectExportFile(name string, req *BackupFileRequest) (resp *BackupFileResponse, err error)
+	CreateProjectFromExport(args ProjectImportArgs) (op Operation, err error)
 
 	// Storage pool functions ("storage" API extension)
 	GetStoragePoolNames() (names []string, err error)
 	GetStoragePools() (pools []api.StoragePool, err error)
 	GetStoragePool(name string) (pool *api.StoragePool, ETag string, err error)
 	GetStoragePoolResources(name string) (resources *api.ResourcesStoragePool, err error)
+	GetStoragePoolUsage(name string) (usage *api.StoragePoolUsage, err error)
 	CreateStoragePool(pool api.StoragePoolsPost) (err error)
 	UpdateStoragePool(name string, pool api.StoragePoolPut, ETag string) (err error)
 	DeleteStoragePool(name string) (err error)
@@ -259,7 +283,10 @@ type InstanceServer interface {
 	GetStoragePoolVolumeNames(pool string) (names []string, err error)
 	GetStoragePoolVolumes(pool string) (volumes []api.StorageVolume, err error)
 	GetStoragePoolVolume(pool string, volType string, name string) (volume *api.StorageVolume, ETag string, err error)
+	GetStoragePoolVolumeState(pool string, volType string, name string) (state *api.StorageVolumeState, err error)
+	CheckStoragePoolVolume(pool string, volType string, name string) (check *api.StorageVolumeCheck, err error)
 	CreateStoragePoolVolume(pool string, volume api.StorageVolumesPost) (err error)
+	ImportStoragePoolVolume(pool string, name string, tarball io.Reader) (op Operation, err error)
 	UpdateStoragePoolVolume(pool string, volType string, name string, volume api.StorageVolumePut, ETag string) (err error)
 	DeleteStoragePoolVolume(pool string, volType string, name string) (err error)
 	RenameStoragePoolVolume(pool string, volType string, name string, volume api.StorageVolumePost) (err error)
@@ -267,12 +294,17 @@ type InstanceServer interface {
 	MoveStoragePoolVolume(pool string, source InstanceServer, sourcePool string, volume api.StorageVolume, args *StoragePoolVolumeMoveArgs) (op RemoteOperation, err error)
 	MigrateStoragePoolVolume(pool string, volume api.StorageVolumePost) (op Operation, err error)
 
+	// Storage volume backup functions ("custom_volume_backup" API extension)
+	GetStoragePoolVolumeBackupFile(pool string, volName string, args *StoragePoolVolumeBackupArgs, req *BackupFileRequest) (resp *BackupFileResponse, err error)
+	CreateStoragePoolVolumeFromBackup(pool string, args StoragePoolVolumeBackupImportArgs) (op Operation, err error)
+
 	// Storage volume snapshot functions ("storage_api_volume_snapshots" API extension)
 	CreateStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshot api.StorageVolumeSnapshotsPost) (op Operation, err error)
 	DeleteStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshotName string) (op Operation, err error)
 	GetStoragePoolVolumeSnapshotNames(pool string, volumeType string, volumeName string) (names []string, err error)
 	GetStoragePoolVolumeSnapshots(pool string, volumeType string, volumeName string) (snapshots []api.StorageVolumeSnapshot, err error)
 	GetStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshotName string) (snapshot *api.StorageVolumeSnapshot, ETag string, err error)
+	GetStoragePoolVolumeSnapshotFile(pool string, volumeType string, volumeName string, snapshotName string, path string) (content io.ReadCloser, resp *InstanceFileResponse, err error)
 	RenameStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshotName string, snapshot api.StorageVolumeSnapshotPost) (op Operation, err error)
 	UpdateStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshotName string, volume api.StorageVolumeSnapshotPut, ETag string) (err error)
 
@@ -284,6 +316,10 @@ type InstanceServer interface {
 	GetClusterMembers() (members []api.ClusterMember, err error)
 	GetClusterMember(name string) (member *api.ClusterMember, ETag string, err error)
 	RenameClusterMember(name string, member api.ClusterMemberPost) (err error)
+	UpdateClusterMember(name string, member api.ClusterMemberPut, ETag string) (err error)
+	UpdateClusterCertificate(certs api.ClusterCertificatePut, ETag string) (err error)
+	GetClusterRebalance(maxMoves int) (rebalance *api.ClusterRebalance, err error)
+	RebalanceCluster(rebalance api.ClusterRebalancePost) (op Operation, err error)
 
 	// Internal functions (for internal use)
 	RawQuery(method string, path string, data interface{}, queryETag string) (resp *api.Response, ETag string, err error)
@@ -301,6 +337,18 @@ type ConnectionInfo struct {
 	Project     string
 }
 
+// The ProjectImportArgs struct is used when creating a project from an export.
+type ProjectImportArgs struct {
+	// The export file
+	ExportFile io.Reader
+
+	// Name of the new project (defaults to the name of the exported one)
+	Name string
+
+	// Storage pool to use for the instances
+	PoolName string
+}
+
 // The BackupFileRequest struct is used for a backup download request.
 type BackupFileRequest struct {
 	// Writer for the backup file
@@ -387,6 +435,10 @@ type ImageCopyArgs struct {
 
 	// The image type to use for resolution
 	Type string
+
+	// Where to create the cached volume of the image once copied
+	// API extension: image_preseed
+	Preseed *api.ImagePreseed
 }
 
 // The StoragePoolVolumeCopyArgs struct is used to pass additional options
@@ -400,6 +452,14 @@ type StoragePoolVolumeCopyArgs struct {
 
 	// API extension: storage_api_volume_snapshots
 	VolumeOnly bool
+
+	// API extension: custom_volume_refresh
+	Refresh bool
+
+	// Limit of the rate the volume is sent at between servers, like rsync.bwlimit
+	//
+	// API extension: storage_transfer_bwlimit
+	BandwidthLimit string
 }
 
 // The StoragePoolVolumeMoveArgs struct is used to pass additional options
@@ -408,6 +468,29 @@ type StoragePoolVolumeMoveArgs struct {
 	StoragePoolVolumeCopyArgs
 }
 
+// The StoragePoolVolumeBackupArgs struct is used to pass additional options
+// when exporting a custom storage volume.
+type StoragePoolVolumeBackupArgs struct {
+	// Whether to use the binary format of the storage driver
+	OptimizedStorage bool
+
+	// Whether to leave the snapshots of the volume out
+	VolumeOnly bool
+
+	// Compression algorithm to use (defaults to the one of the server)
+	CompressionAlgorithm string
+}
+
+// The StoragePoolVolumeBackupImportArgs struct is used when creating a custom
+// storage volume from a backup.
+type StoragePoolVolumeBackupImportArgs struct {
+	// The backup file
+	BackupFile io.Reader
+
+	// Name of the new volume (defaults to the name of the backed up one)
+	Name string
+}
+
 // The InstanceBackupArgs struct is used when creating a instance from a backup.
 type InstanceBackupArgs struct {
 	// The backup file
@@ -434,6 +517,39 @@ type InstanceCopyArgs struct {
 	// API extension: container_incremental_copy
 	// Perform an incremental copy
 	Refresh bool
+
+	// API extension: instance_clone
+	// Create the instance as a copy-on-write clone of the source (local copies only)
+	Clone bool
+
+	// API extension: instance_clone
+	// Make the clone independent of its source in the background once created
+	Independent bool
+
+	// API extension: instance_snapshots_selection
+	// Snapshots to copy along with the instance: "all", "none" or a comma separated list of
+	// patterns matching their names
+	Snapshots string
+}
+
+// The InstanceSnapshotDiffArgs struct is used to pass additional options when
+// exporting the changes between two snapshots.
+type InstanceSnapshotDiffArgs struct {
+	// Name of the older snapshot to export the changes from
+	From string
+
+	// Compression algorithm to use (defaults to the one of the server)
+	CompressionAlgorithm string
+}
+
+// The InstanceExportArgs struct is used to pass additional options when
+// exporting the root filesystem of a container.
+type InstanceExportArgs struct {
+	// Format of the export (only "oci" for now)
+	Format string
+
+	// Whether to only export the container, without a layer per snapshot
+	InstanceOnly bool
 }
 
 // The InstanceSnapshotCopyArgs struct is used to pass additional options during instance copy.
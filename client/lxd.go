@@ -152,7 +152,7 @@ func lxdParseResponse(resp *http.Response) (*api.Response, string, error) {
 
 	// Handle errors
 	if response.Type == api.ErrorResponse {
-		return nil, "", fmt.Errorf(response.Error)
+		return nil, "", api.StatusErrorf(resp.StatusCode, "%s", response.Error)
 	}
 
 	return &response, etag, nil
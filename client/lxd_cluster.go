@@ -121,3 +121,63 @@ func (r *ProtocolLXD) RenameClusterMember(name string, member api.ClusterMemberP
 
 	return nil
 }
+
+// UpdateClusterMember updates information about the given member
+func (r *ProtocolLXD) UpdateClusterMember(name string, member api.ClusterMemberPut, ETag string) error {
+	if !r.HasExtension("clustering_maintenance") {
+		return fmt.Errorf("The server is missing the required \"clustering_maintenance\" API extension")
+	}
+
+	_, _, err := r.query("PUT", fmt.Sprintf("/cluster/members/%s", name), member, ETag)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateClusterCertificate replaces the certificate of the cluster on all its
+// members, generating a new one if none is given.
+func (r *ProtocolLXD) UpdateClusterCertificate(certs api.ClusterCertificatePut, ETag string) error {
+	if !r.HasExtension("clustering_update_cert") {
+		return fmt.Errorf("The server is missing the required \"clustering_update_cert\" API extension")
+	}
+
+	_, _, err := r.query("PUT", "/cluster/certificate", certs, ETag)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetClusterRebalance returns the load of the cluster members, along with the
+// instance moves suggested to rebalance it (at most maxMoves of them).
+func (r *ProtocolLXD) GetClusterRebalance(maxMoves int) (*api.ClusterRebalance, error) {
+	if !r.HasExtension("clustering_rebalance") {
+		return nil, fmt.Errorf("The server is missing the required \"clustering_rebalance\" API extension")
+	}
+
+	rebalance := api.ClusterRebalance{}
+	_, err := r.queryStruct("GET", fmt.Sprintf("/cluster/rebalance?max-moves=%d", maxMoves), nil, "", &rebalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rebalance, nil
+}
+
+// RebalanceCluster performs the given instance moves, or the currently
+// suggested ones if none are given.
+func (r *ProtocolLXD) RebalanceCluster(rebalance api.ClusterRebalancePost) (Operation, error) {
+	if !r.HasExtension("clustering_rebalance") {
+		return nil, fmt.Errorf("The server is missing the required \"clustering_rebalance\" API extension")
+	}
+
+	op, _, err := r.queryOperation("POST", "/cluster/rebalance", rebalance, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
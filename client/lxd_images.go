@@ -341,6 +341,12 @@ func (r *ProtocolLXD) CreateImage(image api.ImagesPost, args *ImageCreateArgs) (
 		}
 	}
 
+	if image.Preseed != nil {
+		if !r.HasExtension("image_preseed") {
+			return nil, fmt.Errorf("The server is missing the required \"image_preseed\" API extension")
+		}
+	}
+
 	// Send the JSON based request
 	if args == nil {
 		op, _, err := r.queryOperation("POST", "/images", image, "")
@@ -460,6 +466,14 @@ func (r *ProtocolLXD) CreateImage(image api.ImagesPost, args *ImageCreateArgs) (
 		req.Header.Set("X-LXD-properties", imgProps.Encode())
 	}
 
+	if image.Preseed != nil {
+		req.Header.Set("X-LXD-preseed-pool", image.Preseed.Pool)
+
+		if len(image.Preseed.Members) > 0 {
+			req.Header.Set("X-LXD-preseed-members", strings.Join(image.Preseed.Members, ","))
+		}
+	}
+
 	// Set the user agent
 	if r.httpUserAgent != "" {
 		req.Header.Set("User-Agent", r.httpUserAgent)
@@ -622,6 +636,14 @@ func (r *ProtocolLXD) CopyImage(source ImageServer, image api.Image, args *Image
 		req.AutoUpdate = args.AutoUpdate
 		req.Public = args.Public
 
+		if args.Preseed != nil {
+			if !r.HasExtension("image_preseed") {
+				return nil, fmt.Errorf("The server is missing the required \"image_preseed\" API extension")
+			}
+
+			req.Preseed = args.Preseed
+		}
+
 		if args.CopyAliases {
 			req.Aliases = image.Aliases
 			if args.Aliases != nil {
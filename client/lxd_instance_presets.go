@@ -0,0 +1,144 @@
+package lxd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// Instance preset handling functions
+
+// GetInstancePresetNames returns a list of available instance preset names
+func (r *ProtocolLXD) GetInstancePresetNames() ([]string, error) {
+	if !r.HasExtension("instance_presets") {
+		return nil, fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	urls := []string{}
+
+	// Fetch the raw value
+	_, err := r.queryStruct("GET", "/instance-presets", nil, "", &urls)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse it
+	names := []string{}
+	for _, url := range urls {
+		fields := strings.Split(url, "/instance-presets/")
+		names = append(names, strings.Split(fields[len(fields)-1], "?")[0])
+	}
+
+	return names, nil
+}
+
+// GetInstancePresets returns a list of available InstancePreset structs
+func (r *ProtocolLXD) GetInstancePresets() ([]api.InstancePreset, error) {
+	if !r.HasExtension("instance_presets") {
+		return nil, fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	presets := []api.InstancePreset{}
+
+	// Fetch the raw value
+	_, err := r.queryStruct("GET", "/instance-presets?recursion=1", nil, "", &presets)
+	if err != nil {
+		return nil, err
+	}
+
+	return presets, nil
+}
+
+// GetInstancePreset returns an InstancePreset entry for the provided name
+func (r *ProtocolLXD) GetInstancePreset(name string) (*api.InstancePreset, string, error) {
+	if !r.HasExtension("instance_presets") {
+		return nil, "", fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	preset := api.InstancePreset{}
+
+	// Fetch the raw value
+	etag, err := r.queryStruct("GET", fmt.Sprintf("/instance-presets/%s", url.PathEscape(name)), nil, "", &preset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &preset, etag, nil
+}
+
+// CreateInstancePreset defines a new instance preset
+func (r *ProtocolLXD) CreateInstancePreset(preset api.InstancePresetsPost) error {
+	if !r.HasExtension("instance_presets") {
+		return fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	// Send the request
+	_, _, err := r.query("POST", "/instance-presets", preset, "")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateInstancePreset updates the instance preset to match the provided InstancePreset struct
+func (r *ProtocolLXD) UpdateInstancePreset(name string, preset api.InstancePresetPut, ETag string) error {
+	if !r.HasExtension("instance_presets") {
+		return fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	// Send the request
+	_, _, err := r.query("PUT", fmt.Sprintf("/instance-presets/%s", url.PathEscape(name)), preset, ETag)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameInstancePreset renames an existing instance preset entry
+func (r *ProtocolLXD) RenameInstancePreset(name string, preset api.InstancePresetPost) error {
+	if !r.HasExtension("instance_presets") {
+		return fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	// Send the request
+	_, _, err := r.query("POST", fmt.Sprintf("/instance-presets/%s", url.PathEscape(name)), preset, "")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteInstancePreset deletes an instance preset
+func (r *ProtocolLXD) DeleteInstancePreset(name string) error {
+	if !r.HasExtension("instance_presets") {
+		return fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	// Send the request
+	_, _, err := r.query("DELETE", fmt.Sprintf("/instance-presets/%s", url.PathEscape(name)), nil, "")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateInstanceFromPreset creates a new instance from an instance preset
+func (r *ProtocolLXD) CreateInstanceFromPreset(name string, instance api.InstancePresetInstancesPost) (Operation, error) {
+	if !r.HasExtension("instance_presets") {
+		return nil, fmt.Errorf("The server is missing the required \"instance_presets\" API extension")
+	}
+
+	// Send the request
+	op, _, err := r.queryOperation("POST", fmt.Sprintf("/instance-presets/%s/instances", url.PathEscape(name)), instance, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
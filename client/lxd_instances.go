@@ -133,6 +133,29 @@ func (r *ProtocolLXD) GetInstance(name string) (*api.Instance, string, error) {
 	return &instance, etag, nil
 }
 
+// GetInstanceExpanded returns the instance entry for the provided name, along with the sources of
+// its expanded configuration and devices.
+func (r *ProtocolLXD) GetInstanceExpanded(name string) (*api.InstanceExpanded, string, error) {
+	if !r.HasExtension("instance_expanded_sources") {
+		return nil, "", fmt.Errorf("The server is missing the required \"instance_expanded_sources\" API extension")
+	}
+
+	instance := api.InstanceExpanded{}
+
+	path, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Fetch the raw value
+	etag, err := r.queryStruct("GET", fmt.Sprintf("%s/%s?recursion=2", path, url.PathEscape(name)), nil, "", &instance)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &instance, etag, nil
+}
+
 // CreateInstanceFromBackup is a convenience function to make it easier to
 // create a instance from a backup
 func (r *ProtocolLXD) CreateInstanceFromBackup(args InstanceBackupArgs) (Operation, error) {
@@ -352,6 +375,7 @@ func (r *ProtocolLXD) CopyInstance(source InstanceServer, instance api.Instance,
 	req := api.InstancesPost{
 		Name:        instance.Name,
 		InstancePut: instance.Writable(),
+		Type:        api.InstanceType(instance.Type),
 	}
 	req.Source.BaseImage = instance.Config["volatile.base_image"]
 
@@ -392,6 +416,22 @@ func (r *ProtocolLXD) CopyInstance(source InstanceServer, instance api.Instance,
 			}
 		}
 
+		if args.Clone || args.Independent {
+			if !r.HasExtension("instance_clone") {
+				return nil, fmt.Errorf("The target server is missing the required \"instance_clone\" API extension")
+			}
+		}
+
+		if args.Snapshots != "" {
+			if !r.HasExtension("instance_snapshots_selection") {
+				return nil, fmt.Errorf("The target server is missing the required \"instance_snapshots_selection\" API extension")
+			}
+
+			if !source.HasExtension("instance_snapshots_selection") {
+				return nil, fmt.Errorf("The source server is missing the required \"instance_snapshots_selection\" API extension")
+			}
+		}
+
 		// Allow overriding the target name
 		if args.Name != "" {
 			req.Name = args.Name
@@ -401,6 +441,9 @@ func (r *ProtocolLXD) CopyInstance(source InstanceServer, instance api.Instance,
 		req.Source.InstanceOnly = args.InstanceOnly
 		req.Source.ContainerOnly = args.InstanceOnly // For legacy servers.
 		req.Source.Refresh = args.Refresh
+		req.Source.Clone = args.Clone
+		req.Source.Independent = args.Independent
+		req.Source.Snapshots = args.Snapshots
 	}
 
 	if req.Source.Live {
@@ -452,12 +495,17 @@ func (r *ProtocolLXD) CopyInstance(source InstanceServer, instance api.Instance,
 		return &rop, nil
 	}
 
+	if req.Source.Clone {
+		return nil, fmt.Errorf("Clones can only be created on the server of their source")
+	}
+
 	// Source request
 	sourceReq := api.InstancePost{
 		Migration:     true,
 		Live:          req.Source.Live,
 		ContainerOnly: req.Source.ContainerOnly, // Deprecated, use InstanceOnly.
 		InstanceOnly:  req.Source.InstanceOnly,
+		Snapshots:     req.Source.Snapshots,
 	}
 
 	// Push mode migration
@@ -747,6 +795,12 @@ func (r *ProtocolLXD) MigrateInstance(name string, instance api.InstancePost) (O
 		}
 	}
 
+	if instance.Snapshots != "" {
+		if !r.HasExtension("instance_snapshots_selection") {
+			return nil, fmt.Errorf("The server is missing the required \"instance_snapshots_selection\" API extension")
+		}
+	}
+
 	// Sanity check
 	if !instance.Migration {
 		return nil, fmt.Errorf("Can't ask for a rename through MigrateInstance")
@@ -959,7 +1013,142 @@ func (r *ProtocolLXD) GetInstanceFile(instanceName string, filePath string) (io.
 		return nil, nil, err
 	}
 
-	requestURL, err = r.setQueryAttributes(requestURL)
+	return r.getFile(requestURL)
+}
+
+// GetInstanceSnapshotFile retrieves the provided path from a snapshot of the
+// instance.
+func (r *ProtocolLXD) GetInstanceSnapshotFile(instanceName string, snapshotName string, filePath string) (io.ReadCloser, *InstanceFileResponse, error) {
+	if !r.HasExtension("snapshot_files") {
+		return nil, nil, fmt.Errorf("The server is missing the required \"snapshot_files\" API extension")
+	}
+
+	path, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Prepare the HTTP request
+	requestURL, err := shared.URLEncode(
+		fmt.Sprintf("%s/1.0%s/%s/snapshots/%s/files", r.httpHost, path, url.PathEscape(instanceName), url.PathEscape(snapshotName)),
+		map[string]string{"path": filePath})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r.getFile(requestURL)
+}
+
+// GetInstanceSnapshotDiffFile downloads a tarball of the changes made to the
+// root filesystem of a container snapshot since an older snapshot.
+func (r *ProtocolLXD) GetInstanceSnapshotDiffFile(instanceName string, snapshotName string, args InstanceSnapshotDiffArgs, req *BackupFileRequest) (*BackupFileResponse, error) {
+	if !r.HasExtension("snapshot_diff_export") {
+		return nil, fmt.Errorf("The server is missing the required \"snapshot_diff_export\" API extension")
+	}
+
+	path, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the URL
+	values := url.Values{}
+	values.Set("from", args.From)
+	if args.CompressionAlgorithm != "" {
+		values.Set("compression", args.CompressionAlgorithm)
+	}
+
+	uri, err := r.setQueryAttributes(fmt.Sprintf("%s/1.0%s/%s/snapshots/%s/export?%s", r.httpHost, path, url.PathEscape(instanceName), url.PathEscape(snapshotName), values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getExportFile(uri, req)
+}
+
+// GetInstanceExportFile downloads the root filesystem of a container in
+// another format than the one of its backups, such as an OCI image layout.
+func (r *ProtocolLXD) GetInstanceExportFile(instanceName string, args InstanceExportArgs, req *BackupFileRequest) (*BackupFileResponse, error) {
+	if !r.HasExtension("instance_export_oci") {
+		return nil, fmt.Errorf("The server is missing the required \"instance_export_oci\" API extension")
+	}
+
+	path, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the URL
+	values := url.Values{}
+	values.Set("format", args.Format)
+	if args.InstanceOnly {
+		values.Set("instance_only", "true")
+	}
+
+	uri, err := r.setQueryAttributes(fmt.Sprintf("%s/1.0%s/%s/export?%s", r.httpHost, path, url.PathEscape(instanceName), values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getExportFile(uri, req)
+}
+
+// getExportFile downloads the tarball of an export URL to the file of the request.
+func (r *ProtocolLXD) getExportFile(uri string, req *BackupFileRequest) (*BackupFileResponse, error) {
+	// Prepare the download request
+	request, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.httpUserAgent != "" {
+		request.Header.Set("User-Agent", r.httpUserAgent)
+	}
+
+	// Start the request
+	response, doneCh, err := cancel.CancelableDownload(req.Canceler, r.http, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	defer close(doneCh)
+
+	if response.StatusCode != http.StatusOK {
+		_, _, err := lxdParseResponse(response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Handle the data
+	body := response.Body
+	if req.ProgressHandler != nil {
+		body = &ioprogress.ProgressReader{
+			ReadCloser: response.Body,
+			Tracker: &ioprogress.ProgressTracker{
+				Length: response.ContentLength,
+				Handler: func(percent int64, speed int64) {
+					req.ProgressHandler(ioprogress.ProgressData{Text: fmt.Sprintf("%d%% (%s/s)", percent, units.GetByteSizeString(speed, 2))})
+				},
+			},
+		}
+	}
+
+	size, err := io.Copy(req.BackupFile, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := BackupFileResponse{}
+	resp.Size = size
+
+	return &resp, nil
+}
+
+// getFile retrieves a file, or the entries of a directory, from the given
+// files URL.
+func (r *ProtocolLXD) getFile(requestURL string) (io.ReadCloser, *InstanceFileResponse, error) {
+	requestURL, err := r.setQueryAttributes(requestURL)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -2101,6 +2290,54 @@ func (r *ProtocolLXD) RenameInstanceBackup(instanceName string, name string, bac
 	return op, nil
 }
 
+// GetInstanceBackupContents returns the content of the instance's root
+// filesystem stored in the backup, optionally limited to the given path.
+func (r *ProtocolLXD) GetInstanceBackupContents(instanceName string, name string, path string) ([]api.InstanceBackupEntry, error) {
+	instancesPath, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.HasExtension("backup_file_restore") {
+		return nil, fmt.Errorf("The server is missing the required \"backup_file_restore\" API extension")
+	}
+
+	// Fetch the raw value
+	entries := []api.InstanceBackupEntry{}
+	requestURL := fmt.Sprintf("%s/%s/backups/%s/contents", instancesPath, url.PathEscape(instanceName), url.PathEscape(name))
+	if path != "" {
+		requestURL = fmt.Sprintf("%s?path=%s", requestURL, url.QueryEscape(path))
+	}
+
+	_, err = r.queryStruct("GET", requestURL, nil, "", &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RestoreInstanceBackupPaths requests that LXD restores specific paths from
+// the instance backup.
+func (r *ProtocolLXD) RestoreInstanceBackupPaths(instanceName string, name string, req api.InstanceBackupRestorePost) (Operation, error) {
+	path, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.HasExtension("backup_file_restore") {
+		return nil, fmt.Errorf("The server is missing the required \"backup_file_restore\" API extension")
+	}
+
+	// Send the request
+	op, _, err := r.queryOperation("POST", fmt.Sprintf("%s/%s/backups/%s/restore", path, url.PathEscape(instanceName), url.PathEscape(name)), req, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
 // DeleteInstanceBackup requests that LXD deletes the instance backup.
 func (r *ProtocolLXD) DeleteInstanceBackup(instanceName string, name string) (Operation, error) {
 	path, _, err := r.instanceTypeToPath(api.InstanceTypeAny)
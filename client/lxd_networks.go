@@ -66,6 +66,23 @@ func (r *ProtocolLXD) GetNetwork(name string) (*api.Network, string, error) {
 	return &network, etag, nil
 }
 
+// GetNetworkAllocations returns the static addresses assigned to instances on the network
+func (r *ProtocolLXD) GetNetworkAllocations(name string) ([]api.NetworkAllocation, error) {
+	if !r.HasExtension("network_allocations") {
+		return nil, fmt.Errorf("The server is missing the required \"network_allocations\" API extension")
+	}
+
+	allocations := []api.NetworkAllocation{}
+
+	// Fetch the raw value
+	_, err := r.queryStruct("GET", fmt.Sprintf("/networks/%s/allocations", url.PathEscape(name)), nil, "", &allocations)
+	if err != nil {
+		return nil, err
+	}
+
+	return allocations, nil
+}
+
 // GetNetworkLeases returns a list of Network struct
 func (r *ProtocolLXD) GetNetworkLeases(name string) ([]api.NetworkLease, error) {
 	if !r.HasExtension("network_leases") {
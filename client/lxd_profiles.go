@@ -99,3 +99,38 @@ func (r *ProtocolLXD) DeleteProfile(name string) error {
 
 	return nil
 }
+
+// GetProfileDiff returns the running instances using the profile which don't use the current
+// definition of their profiles
+func (r *ProtocolLXD) GetProfileDiff(name string) ([]api.ProfileInstanceDiff, error) {
+	if !r.HasExtension("profiles_apply") {
+		return nil, fmt.Errorf("The server is missing the required \"profiles_apply\" API extension")
+	}
+
+	diffs := []api.ProfileInstanceDiff{}
+
+	// Fetch the raw value
+	_, err := r.queryStruct("GET", fmt.Sprintf("/profiles/%s/diff", url.PathEscape(name)), nil, "", &diffs)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffs, nil
+}
+
+// ApplyProfile re-applies the current definition of their profiles to the running instances using
+// the profile which deviate from it. The result for each instance is in the "results" metadata
+// of the operation.
+func (r *ProtocolLXD) ApplyProfile(name string) (Operation, error) {
+	if !r.HasExtension("profiles_apply") {
+		return nil, fmt.Errorf("The server is missing the required \"profiles_apply\" API extension")
+	}
+
+	// Send the request
+	op, _, err := r.queryOperation("POST", fmt.Sprintf("/profiles/%s/apply", url.PathEscape(name)), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
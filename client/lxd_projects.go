@@ -2,10 +2,15 @@ package lxd
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/cancel"
+	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/units"
 )
 
 // Project handling functions
@@ -127,3 +132,118 @@ func (r *ProtocolLXD) DeleteProject(name string) error {
 
 	return nil
 }
+
+// GetProjectExportFile downloads an export of a whole project
+func (r *ProtocolLXD) GetProjectExportFile(name string, req *BackupFileRequest) (*BackupFileResponse, error) {
+	if !r.HasExtension("projects_export") {
+		return nil, fmt.Errorf("The server is missing the required \"projects_export\" API extension")
+	}
+
+	// Build the URL
+	uri := fmt.Sprintf("%s/1.0/projects/%s/export", r.httpHost, url.PathEscape(name))
+
+	// Prepare the download request
+	request, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.httpUserAgent != "" {
+		request.Header.Set("User-Agent", r.httpUserAgent)
+	}
+
+	// Start the request
+	response, doneCh, err := cancel.CancelableDownload(req.Canceler, r.http, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	defer close(doneCh)
+
+	if response.StatusCode != http.StatusOK {
+		_, _, err := lxdParseResponse(response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Handle the data
+	body := response.Body
+	if req.ProgressHandler != nil {
+		body = &ioprogress.ProgressReader{
+			ReadCloser: response.Body,
+			Tracker: &ioprogress.ProgressTracker{
+				Length: response.ContentLength,
+				Handler: func(received int64, speed int64) {
+					req.ProgressHandler(ioprogress.ProgressData{Text: fmt.Sprintf("%s (%s/s)", units.GetByteSizeString(received, 2), units.GetByteSizeString(speed, 2))})
+				},
+			},
+		}
+	}
+
+	size, err := io.Copy(req.BackupFile, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := BackupFileResponse{}
+	resp.Size = size
+
+	return &resp, nil
+}
+
+// CreateProjectFromExport creates a new project, along with its instances, from an export
+func (r *ProtocolLXD) CreateProjectFromExport(args ProjectImportArgs) (Operation, error) {
+	if !r.HasExtension("projects_export") {
+		return nil, fmt.Errorf("The server is missing the required \"projects_export\" API extension")
+	}
+
+	// Prepare the HTTP request
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/1.0/projects", r.httpHost), args.ExportFile)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if args.Name != "" {
+		req.Header.Set("X-LXD-name", args.Name)
+	}
+
+	if args.PoolName != "" {
+		req.Header.Set("X-LXD-pool", args.PoolName)
+	}
+
+	// Set the user agent
+	if r.httpUserAgent != "" {
+		req.Header.Set("User-Agent", r.httpUserAgent)
+	}
+
+	// Send the request
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Handle errors
+	response, _, err := lxdParseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get to the operation
+	respOperation, err := response.MetadataAsOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup an Operation wrapper
+	op := operation{
+		Operation: *respOperation,
+		r:         r,
+		chActive:  make(chan bool),
+	}
+
+	return &op, nil
+}
@@ -50,6 +50,28 @@ func (r *ProtocolLXD) UpdateServer(server api.ServerPut, ETag string) error {
 	return nil
 }
 
+// ApplyServerPreseed reconciles the server with the provided desired state
+func (r *ProtocolLXD) ApplyServerPreseed(preseed api.Preseed, dryRun bool) (*api.PreseedResult, error) {
+	if !r.HasExtension("preseed_apply") {
+		return nil, fmt.Errorf("The server is missing the required \"preseed_apply\" API extension")
+	}
+
+	path := "/preseed"
+	if dryRun {
+		path += "?dry-run=1"
+	}
+
+	result := api.PreseedResult{}
+
+	// Send the request
+	_, err := r.queryStruct("PUT", path, preseed, "", &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 // HasExtension returns true if the server supports a given API extension
 func (r *ProtocolLXD) HasExtension(extension string) bool {
 	// If no cached API information, just assume we're good
@@ -89,7 +111,24 @@ func (r *ProtocolLXD) GetServerResources() (*api.Resources, error) {
 	return &resources, nil
 }
 
-// UseProject returns a client that will use a specific project.
+// GetMetadataConfiguration returns the valid configuration keys of the instances, storage pools,
+// storage volumes, networks and projects
+func (r *ProtocolLXD) GetMetadataConfiguration() (*api.MetadataConfiguration, error) {
+	if !r.HasExtension("metadata_configuration") {
+		return nil, fmt.Errorf("The server is missing the required \"metadata_configuration\" API extension")
+	}
+
+	metadata := api.MetadataConfiguration{}
+
+	// Fetch the raw value
+	_, err := r.queryStruct("GET", "/metadata/configuration", nil, "", &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
 func (r *ProtocolLXD) UseProject(name string) InstanceServer {
 	return &ProtocolLXD{
 		server:               r.server,
@@ -133,3 +133,20 @@ func (r *ProtocolLXD) GetStoragePoolResources(name string) (*api.ResourcesStorag
 
 	return &res, nil
 }
+
+// GetStoragePoolUsage gets the usage of a given storage pool, aggregated over its volumes
+func (r *ProtocolLXD) GetStoragePoolUsage(name string) (*api.StoragePoolUsage, error) {
+	if !r.HasExtension("storage_pool_usage") {
+		return nil, fmt.Errorf("The server is missing the required \"storage_pool_usage\" API extension")
+	}
+
+	usage := api.StoragePoolUsage{}
+
+	// Fetch the raw value
+	_, err := r.queryStruct("GET", fmt.Sprintf("/storage-pools/%s/usage", url.PathEscape(name)), nil, "", &usage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
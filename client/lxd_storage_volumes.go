@@ -2,10 +2,16 @@ package lxd
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strings"
 
+	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/cancel"
+	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/units"
 )
 
 // Storage volumes handling function
@@ -69,6 +75,42 @@ func (r *ProtocolLXD) GetStoragePoolVolume(pool string, volType string, name str
 	return &volume, etag, nil
 }
 
+// GetStoragePoolVolumeState returns the state of a storage volume, including its disk usage
+func (r *ProtocolLXD) GetStoragePoolVolumeState(pool string, volType string, name string) (*api.StorageVolumeState, error) {
+	if !r.HasExtension("storage_volume_state") {
+		return nil, fmt.Errorf("The server is missing the required \"storage_volume_state\" API extension")
+	}
+
+	state := api.StorageVolumeState{}
+
+	// Fetch the raw value
+	path := fmt.Sprintf("/storage-pools/%s/volumes/%s/%s/state", url.PathEscape(pool), url.PathEscape(volType), url.PathEscape(name))
+	_, err := r.queryStruct("GET", path, nil, "", &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// CheckStoragePoolVolume checks the consistency of an unused storage volume, without repairing it
+func (r *ProtocolLXD) CheckStoragePoolVolume(pool string, volType string, name string) (*api.StorageVolumeCheck, error) {
+	if !r.HasExtension("storage_volume_check") {
+		return nil, fmt.Errorf("The server is missing the required \"storage_volume_check\" API extension")
+	}
+
+	check := api.StorageVolumeCheck{}
+
+	// Send the request
+	path := fmt.Sprintf("/storage-pools/%s/volumes/%s/%s/check", url.PathEscape(pool), url.PathEscape(volType), url.PathEscape(name))
+	_, err := r.queryStruct("POST", path, nil, "", &check)
+	if err != nil {
+		return nil, err
+	}
+
+	return &check, nil
+}
+
 // CreateStoragePoolVolume defines a new storage volume
 func (r *ProtocolLXD) CreateStoragePoolVolume(pool string, volume api.StorageVolumesPost) error {
 	if !r.HasExtension("storage") {
@@ -85,6 +127,199 @@ func (r *ProtocolLXD) CreateStoragePoolVolume(pool string, volume api.StorageVol
 	return nil
 }
 
+// ImportStoragePoolVolume creates a new custom storage volume from the content of a tarball
+func (r *ProtocolLXD) ImportStoragePoolVolume(pool string, name string, tarball io.Reader) (Operation, error) {
+	if !r.HasExtension("storage_volume_import") {
+		return nil, fmt.Errorf("The server is missing the required \"storage_volume_import\" API extension")
+	}
+
+	// Prepare the HTTP request
+	reqURL, err := r.setQueryAttributes(fmt.Sprintf("%s/1.0/storage-pools/%s/volumes/custom", r.httpHost, url.PathEscape(pool)))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", reqURL, tarball)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-LXD-name", name)
+
+	// Set the user agent
+	if r.httpUserAgent != "" {
+		req.Header.Set("User-Agent", r.httpUserAgent)
+	}
+
+	// Send the request
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Handle errors
+	response, _, err := lxdParseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get to the operation
+	respOperation, err := response.MetadataAsOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup an Operation wrapper
+	op := operation{
+		Operation: *respOperation,
+		r:         r,
+		chActive:  make(chan bool),
+	}
+
+	return &op, nil
+}
+
+// GetStoragePoolVolumeBackupFile exports a custom storage volume as a backup file
+func (r *ProtocolLXD) GetStoragePoolVolumeBackupFile(pool string, volName string, args *StoragePoolVolumeBackupArgs, req *BackupFileRequest) (*BackupFileResponse, error) {
+	if !r.HasExtension("custom_volume_backup") {
+		return nil, fmt.Errorf("The server is missing the required \"custom_volume_backup\" API extension")
+	}
+
+	// Build the URL
+	values := url.Values{}
+	if args != nil {
+		if args.OptimizedStorage {
+			values.Set("optimized", "true")
+		}
+
+		if args.VolumeOnly {
+			values.Set("volume-only", "true")
+		}
+
+		if args.CompressionAlgorithm != "" {
+			values.Set("compression", args.CompressionAlgorithm)
+		}
+	}
+
+	uri := fmt.Sprintf("%s/1.0/storage-pools/%s/volumes/custom/%s/export", r.httpHost, url.PathEscape(pool), url.PathEscape(volName))
+	if len(values) > 0 {
+		uri += "?" + values.Encode()
+	}
+
+	uri, err := r.setQueryAttributes(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare the download request
+	request, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.httpUserAgent != "" {
+		request.Header.Set("User-Agent", r.httpUserAgent)
+	}
+
+	// Start the request
+	response, doneCh, err := cancel.CancelableDownload(req.Canceler, r.http, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	defer close(doneCh)
+
+	if response.StatusCode != http.StatusOK {
+		_, _, err := lxdParseResponse(response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Handle the data
+	body := response.Body
+	if req.ProgressHandler != nil {
+		body = &ioprogress.ProgressReader{
+			ReadCloser: response.Body,
+			Tracker: &ioprogress.ProgressTracker{
+				Length: response.ContentLength,
+				Handler: func(received int64, speed int64) {
+					req.ProgressHandler(ioprogress.ProgressData{Text: fmt.Sprintf("%s (%s/s)", units.GetByteSizeString(received, 2), units.GetByteSizeString(speed, 2))})
+				},
+			},
+		}
+	}
+
+	size, err := io.Copy(req.BackupFile, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := BackupFileResponse{}
+	resp.Size = size
+
+	return &resp, nil
+}
+
+// CreateStoragePoolVolumeFromBackup creates a custom storage volume, along with its snapshots, from a backup file
+func (r *ProtocolLXD) CreateStoragePoolVolumeFromBackup(pool string, args StoragePoolVolumeBackupImportArgs) (Operation, error) {
+	if !r.HasExtension("custom_volume_backup") {
+		return nil, fmt.Errorf("The server is missing the required \"custom_volume_backup\" API extension")
+	}
+
+	// Prepare the HTTP request
+	reqURL, err := r.setQueryAttributes(fmt.Sprintf("%s/1.0/storage-pools/%s/volumes/custom", r.httpHost, url.PathEscape(pool)))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", reqURL, args.BackupFile)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if args.Name != "" {
+		req.Header.Set("X-LXD-name", args.Name)
+	}
+
+	// Set the user agent
+	if r.httpUserAgent != "" {
+		req.Header.Set("User-Agent", r.httpUserAgent)
+	}
+
+	// Send the request
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Handle errors
+	response, _, err := lxdParseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get to the operation
+	respOperation, err := response.MetadataAsOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup an Operation wrapper
+	op := operation{
+		Operation: *respOperation,
+		r:         r,
+		chActive:  make(chan bool),
+	}
+
+	return &op, nil
+}
+
 // CreateStoragePoolVolumeSnapshot defines a new storage volume
 func (r *ProtocolLXD) CreateStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshot api.StorageVolumeSnapshotsPost) (Operation, error) {
 	if !r.HasExtension("storage_api_volume_snapshots") {
@@ -175,6 +410,28 @@ func (r *ProtocolLXD) GetStoragePoolVolumeSnapshot(pool string, volumeType strin
 	return &snapshot, etag, nil
 }
 
+// GetStoragePoolVolumeSnapshotFile retrieves the provided path from a storage
+// volume snapshot.
+func (r *ProtocolLXD) GetStoragePoolVolumeSnapshotFile(pool string, volumeType string, volumeName string, snapshotName string, filePath string) (io.ReadCloser, *InstanceFileResponse, error) {
+	if !r.HasExtension("snapshot_files") {
+		return nil, nil, fmt.Errorf("The server is missing the required \"snapshot_files\" API extension")
+	}
+
+	requestURL, err := shared.URLEncode(
+		fmt.Sprintf("%s/1.0/storage-pools/%s/volumes/%s/%s/snapshots/%s/files",
+			r.httpHost,
+			url.PathEscape(pool),
+			url.PathEscape(volumeType),
+			url.PathEscape(volumeName),
+			url.PathEscape(snapshotName)),
+		map[string]string{"path": filePath})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r.getFile(requestURL)
+}
+
 // RenameStoragePoolVolumeSnapshot renames a storage volume snapshot
 func (r *ProtocolLXD) RenameStoragePoolVolumeSnapshot(pool string, volumeType string, volumeName string, snapshotName string, snapshot api.StorageVolumeSnapshotPost) (Operation, error) {
 	if !r.HasExtension("storage_api_volume_snapshots") {
@@ -366,6 +623,16 @@ func (r *ProtocolLXD) CopyStoragePoolVolume(pool string, source InstanceServer,
 		return nil, fmt.Errorf("The target server is missing the required \"storage_api_volume_snapshots\" API extension")
 	}
 
+	if args != nil && args.Refresh {
+		if !r.HasExtension("custom_volume_refresh") {
+			return nil, fmt.Errorf("The target server is missing the required \"custom_volume_refresh\" API extension")
+		}
+
+		if r != source {
+			return nil, fmt.Errorf("Volumes can only be refreshed from a volume of the same server")
+		}
+	}
+
 	req := api.StorageVolumesPost{
 		Name: args.Name,
 		Type: volume.Type,
@@ -374,6 +641,7 @@ func (r *ProtocolLXD) CopyStoragePoolVolume(pool string, source InstanceServer,
 			Type:       "copy",
 			Pool:       sourcePool,
 			VolumeOnly: args.VolumeOnly,
+			Refresh:    args.Refresh,
 		},
 	}
 	req.Config = volume.Config
@@ -404,11 +672,16 @@ func (r *ProtocolLXD) CopyStoragePoolVolume(pool string, source InstanceServer,
 		return nil, fmt.Errorf("The server is missing the required \"storage_api_remote_volume_handling\" API extension")
 	}
 
+	if args.BandwidthLimit != "" && !source.HasExtension("storage_transfer_bwlimit") {
+		return nil, fmt.Errorf("The source server is missing the required \"storage_transfer_bwlimit\" API extension")
+	}
+
 	sourceReq := api.StorageVolumePost{
-		Migration:  true,
-		Name:       volume.Name,
-		Pool:       sourcePool,
-		VolumeOnly: args.VolumeOnly,
+		Migration:      true,
+		Name:           volume.Name,
+		Pool:           sourcePool,
+		VolumeOnly:     args.VolumeOnly,
+		BandwidthLimit: args.BandwidthLimit,
 	}
 
 	// Push mode migration
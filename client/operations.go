@@ -96,12 +96,22 @@ func (op *operation) Refresh() error {
 	return nil
 }
 
+// failure returns the error the operation failed with, carrying its HTTP status code when the
+// server reported one
+func (op *operation) failure() error {
+	if op.ErrCode == 0 {
+		return fmt.Errorf(op.Err)
+	}
+
+	return api.StatusErrorf(op.ErrCode, "%s", op.Err)
+}
+
 // Wait lets you wait until the operation reaches a final state
 func (op *operation) Wait() error {
 	// Check if not done already
 	if op.StatusCode.IsFinal() {
 		if op.Err != "" {
-			return fmt.Errorf(op.Err)
+			return op.failure()
 		}
 
 		return nil
@@ -117,7 +127,7 @@ func (op *operation) Wait() error {
 
 	// We're done, parse the result
 	if op.Err != "" {
-		return fmt.Errorf(op.Err)
+		return op.failure()
 	}
 
 	return nil
@@ -233,7 +243,7 @@ func (op *operation) setupListener() error {
 		close(chReady)
 
 		if op.Err != "" {
-			return fmt.Errorf(op.Err)
+			return op.failure()
 		}
 
 		return nil
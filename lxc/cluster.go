@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
@@ -49,6 +50,18 @@ func (c *cmdCluster) Command() *cobra.Command {
 	clusterEnableCmd := cmdClusterEnable{global: c.global, cluster: c}
 	cmd.AddCommand(clusterEnableCmd.Command())
 
+	// Maintenance
+	clusterMaintenanceCmd := cmdClusterMaintenance{global: c.global, cluster: c}
+	cmd.AddCommand(clusterMaintenanceCmd.Command())
+
+	// Rebalance
+	clusterRebalanceCmd := cmdClusterRebalance{global: c.global, cluster: c}
+	cmd.AddCommand(clusterRebalanceCmd.Command())
+
+	// Update certificate
+	clusterUpdateCertificateCmd := cmdClusterUpdateCertificate{global: c.global, cluster: c}
+	cmd.AddCommand(clusterUpdateCertificateCmd.Command())
+
 	return cmd
 }
 
@@ -117,7 +130,11 @@ func (c *cmdClusterList) Run(cmd *cobra.Command, args []string) error {
 		if member.Database {
 			database = "YES"
 		}
-		line := []string{member.ServerName, member.URL, database, strings.ToUpper(member.Status), member.Message}
+		maintenance := "NO"
+		if member.Maintenance {
+			maintenance = "YES"
+		}
+		line := []string{member.ServerName, member.URL, database, strings.ToUpper(member.Status), member.Message, maintenance}
 		data = append(data, line)
 	}
 	sort.Sort(byName(data))
@@ -128,6 +145,7 @@ func (c *cmdClusterList) Run(cmd *cobra.Command, args []string) error {
 		i18n.G("DATABASE"),
 		i18n.G("STATE"),
 		i18n.G("MESSAGE"),
+		i18n.G("MAINTENANCE"),
 	}
 
 	return utils.RenderTable(c.flagFormat, header, data, members)
@@ -229,6 +247,193 @@ func (c *cmdClusterRename) Run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Maintenance
+type cmdClusterMaintenance struct {
+	global  *cmdGlobal
+	cluster *cmdCluster
+
+	flagDisable bool
+}
+
+func (c *cmdClusterMaintenance) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("maintenance [<remote>:]<member>")
+	cmd.Short = i18n.G("Put a cluster member in maintenance")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Put a cluster member in maintenance
+
+A member in maintenance keeps running its existing instances, but isn't
+considered for new instances or storage volumes.`))
+	cmd.Flags().BoolVar(&c.flagDisable, "disable", false, i18n.G("Take the member out of maintenance"))
+
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdClusterMaintenance) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 1, 1)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing cluster member name"))
+	}
+
+	member, etag, err := resource.server.GetClusterMember(resource.name)
+	if err != nil {
+		return err
+	}
+
+	member.Maintenance = !c.flagDisable
+	err = resource.server.UpdateClusterMember(resource.name, member.ClusterMemberPut, etag)
+	if err != nil {
+		return err
+	}
+
+	if !c.global.flagQuiet {
+		if member.Maintenance {
+			fmt.Printf(i18n.G("Member %s is now in maintenance")+"\n", resource.name)
+		} else {
+			fmt.Printf(i18n.G("Member %s is no longer in maintenance")+"\n", resource.name)
+		}
+	}
+
+	return nil
+}
+
+// Rebalance
+type cmdClusterRebalance struct {
+	global  *cmdGlobal
+	cluster *cmdCluster
+
+	flagApply    bool
+	flagMaxMoves int
+}
+
+func (c *cmdClusterRebalance) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("rebalance [<remote>:]")
+	cmd.Short = i18n.G("Suggest instance moves to rebalance the cluster")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Suggest instance moves to rebalance the cluster
+
+The load of each member is the CPU and memory allocated to its instances and
+the space used in its storage pools, as a fraction of its capacity. Only
+stopped containers are considered for moves.`))
+	cmd.Flags().BoolVar(&c.flagApply, "apply", false, i18n.G("Perform the suggested moves"))
+	cmd.Flags().IntVar(&c.flagMaxMoves, "max-moves", 10, i18n.G("Maximum number of moves to suggest")+"``")
+
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdClusterRebalance) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 0, 1)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	remote := ""
+	if len(args) == 1 {
+		remote = args[0]
+	}
+
+	resources, err := c.global.ParseServers(remote)
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	rebalance, err := resource.server.GetClusterRebalance(c.flagMaxMoves)
+	if err != nil {
+		return err
+	}
+
+	// Render the member loads
+	data := [][]string{}
+	for _, member := range rebalance.Members {
+		line := []string{
+			member.ServerName,
+			fmt.Sprintf("%.0f%%", member.CPU*100),
+			fmt.Sprintf("%.0f%%", member.Memory*100),
+			fmt.Sprintf("%.0f%%", member.Storage*100),
+		}
+		data = append(data, line)
+	}
+	sort.Sort(byName(data))
+
+	header := []string{
+		i18n.G("NAME"),
+		i18n.G("CPU"),
+		i18n.G("MEMORY"),
+		i18n.G("STORAGE"),
+	}
+
+	err = utils.RenderTable(utils.TableFormatTable, header, data, rebalance.Members)
+	if err != nil {
+		return err
+	}
+
+	if len(rebalance.Moves) == 0 {
+		fmt.Println(i18n.G("No instance moves suggested"))
+		return nil
+	}
+
+	// Render the suggested moves
+	data = [][]string{}
+	for _, move := range rebalance.Moves {
+		data = append(data, []string{move.Project, move.Instance, move.Source, move.Target})
+	}
+
+	header = []string{
+		i18n.G("PROJECT"),
+		i18n.G("INSTANCE"),
+		i18n.G("SOURCE"),
+		i18n.G("TARGET"),
+	}
+
+	err = utils.RenderTable(utils.TableFormatTable, header, data, rebalance.Moves)
+	if err != nil {
+		return err
+	}
+
+	if !c.flagApply {
+		return nil
+	}
+
+	// Perform the moves which were just shown
+	op, err := resource.server.RebalanceCluster(api.ClusterRebalancePost{Moves: rebalance.Moves})
+	if err != nil {
+		return err
+	}
+
+	err = op.Wait()
+	if err != nil {
+		return err
+	}
+
+	if !c.global.flagQuiet {
+		fmt.Printf(i18n.G("Moved %d instances")+"\n", len(rebalance.Moves))
+	}
+
+	return nil
+}
+
 // Remove
 type cmdClusterRemove struct {
 	global  *cmdGlobal
@@ -402,3 +607,78 @@ func (c *cmdClusterEnable) Run(cmd *cobra.Command, args []string) error {
 	fmt.Println(i18n.G("Clustering enabled"))
 	return nil
 }
+
+// Update certificate
+type cmdClusterUpdateCertificate struct {
+	global  *cmdGlobal
+	cluster *cmdCluster
+}
+
+func (c *cmdClusterUpdateCertificate) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("update-certificate [<remote>:] [<cert.crt> <cert.key>]")
+	cmd.Short = i18n.G("Update the certificate of the cluster")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Update the certificate of the cluster
+
+  All cluster members switch to the given certificate and key, or to a newly
+  generated certificate if none is given. Clients which pinned the old
+  certificate will have to trust the new one.`))
+
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdClusterUpdateCertificate) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 0, 3)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	remote := ""
+	if len(args) == 1 || len(args) == 3 {
+		remote = args[0]
+		args = args[1:]
+	}
+
+	if len(args) == 1 {
+		return fmt.Errorf(i18n.G("Both a certificate and a key must be given"))
+	}
+
+	resources, err := c.global.ParseServers(remote)
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	req := api.ClusterCertificatePut{}
+	if len(args) == 2 {
+		cert, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		key, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+
+		req.ClusterCertificate = string(cert)
+		req.ClusterCertificateKey = string(key)
+	}
+
+	err = resource.server.UpdateClusterCertificate(req, "")
+	if err != nil {
+		return err
+	}
+
+	if !c.global.flagQuiet {
+		fmt.Println(i18n.G("Cluster certificate updated"))
+	}
+
+	return nil
+}
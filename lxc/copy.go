@@ -31,6 +31,9 @@ type cmdCopy struct {
 	flagTarget        string
 	flagTargetProject string
 	flagRefresh       bool
+	flagClone         bool
+	flagIndependent   bool
+	flagSnapshots     string
 }
 
 func (c *cmdCopy) Command() *cobra.Command {
@@ -55,6 +58,9 @@ func (c *cmdCopy) Command() *cobra.Command {
 	cmd.Flags().StringVar(&c.flagTargetProject, "target-project", "", i18n.G("Copy to a project different from the source")+"``")
 	cmd.Flags().BoolVar(&c.flagNoProfiles, "no-profiles", false, i18n.G("Create the container with no profiles applied"))
 	cmd.Flags().BoolVar(&c.flagRefresh, "refresh", false, i18n.G("Perform an incremental copy"))
+	cmd.Flags().BoolVar(&c.flagClone, "clone", false, i18n.G("Create the container as a copy-on-write clone of the source"))
+	cmd.Flags().BoolVar(&c.flagIndependent, "independent", false, i18n.G("Make the clone independent of its source in the background"))
+	cmd.Flags().StringVar(&c.flagSnapshots, "snapshots", "", i18n.G("Snapshots to copy: all (default), none or a comma separated list of name patterns")+"``")
 
 	return cmd
 }
@@ -258,6 +264,17 @@ func (c *cmdCopy) copyContainer(conf *config.Config, sourceResource string,
 			InstanceOnly: containerOnly,
 			Mode:         mode,
 			Refresh:      c.flagRefresh,
+			Clone:        c.flagClone || c.flagIndependent,
+			Independent:  c.flagIndependent,
+		}
+
+		// Leaving out all the snapshots is understood by older servers too
+		switch c.flagSnapshots {
+		case "", "all":
+		case "none":
+			args.InstanceOnly = true
+		default:
+			args.Snapshots = c.flagSnapshots
 		}
 
 		// Copy of a container into a new container
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -24,17 +25,35 @@ type cmdExport struct {
 	flagInstanceOnly         bool
 	flagOptimizedStorage     bool
 	flagCompressionAlgorithm string
+	flagFrom                 string
+	flagFormat               string
 }
 
 func (c *cmdExport) Command() *cobra.Command {
 	cmd := &cobra.Command{}
-	cmd.Use = i18n.G("export [<remote>:]<container> [target] [--container-only] [--optimized-storage]")
+	cmd.Use = i18n.G("export [<remote>:]<container>[/<snapshot>] [target] [--container-only] [--optimized-storage] [--from <snapshot>] [--format oci]")
 	cmd.Short = i18n.G("Export container backups")
 	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
-		`Export containers as backup tarballs.`))
+		`Export containers as backup tarballs.
+
+With --from, only the changes made to the root filesystem of the snapshot
+since the given older snapshot are exported. The tarball holds the added and
+changed files under rootfs/, along with a diff.yaml file listing the removed
+paths.
+
+With --format oci, the root filesystem of the container is exported as an OCI
+image layout tarball instead, with a layer per snapshot unless --instance-only
+is set. It can be used with the oci-archive transport of skopeo or podman, and
+imported back with "lxc image import".`))
 	cmd.Example = cli.FormatSection("", i18n.G(
 		`lxc export u1 backup0.tar.gz
-    Download a backup tarball of the u1 container.`))
+    Download a backup tarball of the u1 container.
+
+lxc export u1/snap1 diff.tar.gz --from snap0
+    Download the changes made in the u1 container between its snap0 and snap1 snapshots.
+
+lxc export u1 u1.oci.tar --format oci
+    Download the u1 container as an OCI image layout.`))
 
 	cmd.RunE = c.Run
 	cmd.Flags().BoolVar(&c.flagContainerOnly, "container-only", false,
@@ -44,6 +63,8 @@ func (c *cmdExport) Command() *cobra.Command {
 	cmd.Flags().BoolVar(&c.flagOptimizedStorage, "optimized-storage", false,
 		i18n.G("Use storage driver optimized format (can only be restored on a similar pool)"))
 	cmd.Flags().StringVar(&c.flagCompressionAlgorithm, "compression", "", i18n.G("Define a compression algorithm: for backup or none")+"``")
+	cmd.Flags().StringVar(&c.flagFrom, "from", "", i18n.G("Only export the changes made since this older snapshot")+"``")
+	cmd.Flags().StringVar(&c.flagFormat, "format", "", i18n.G("Export the root filesystem in another format: oci")+"``")
 
 	return cmd
 }
@@ -68,6 +89,14 @@ func (c *cmdExport) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if c.flagFrom != "" {
+		return c.exportDiff(d, name, args)
+	}
+
+	if c.flagFormat != "" {
+		return c.exportFormat(d, name, args)
+	}
+
 	instanceOnly := c.flagContainerOnly || c.flagInstanceOnly
 
 	req := api.InstanceBackupsPost{
@@ -84,11 +113,25 @@ func (c *cmdExport) Run(cmd *cobra.Command, args []string) error {
 		return errors.Wrap(err, "Create container backup")
 	}
 
+	// Register progress handler
+	createProgress := utils.ProgressRenderer{
+		Format: i18n.G("Backing up instance: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+
+	_, err = op.AddHandler(createProgress.UpdateOp)
+	if err != nil {
+		createProgress.Done("")
+		return err
+	}
+
 	// Wait until backup is done
-	err = op.Wait()
+	err = utils.CancelableWait(op, &createProgress)
 	if err != nil {
+		createProgress.Done("")
 		return err
 	}
+	createProgress.Done("")
 
 	// Get name of backup
 	backupName := strings.TrimPrefix(op.Get().Resources["backups"][0],
@@ -136,3 +179,96 @@ func (c *cmdExport) Run(cmd *cobra.Command, args []string) error {
 	progress.Done(i18n.G("Backup exported successfully!"))
 	return nil
 }
+
+// exportDiff downloads the changes made to the root filesystem of a snapshot
+// since the older snapshot given with --from.
+func (c *cmdExport) exportDiff(d lxd.InstanceServer, name string, args []string) error {
+	fields := strings.SplitN(name, shared.SnapshotDelimiter, 2)
+	if len(fields) != 2 {
+		return fmt.Errorf(i18n.G("A snapshot must be provided to export the changes of"))
+	}
+
+	var targetName string
+	if len(args) > 1 {
+		targetName = args[1]
+	} else {
+		targetName = "diff.tar.gz"
+	}
+
+	target, err := os.Create(shared.HostPath(targetName))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	// Prepare the download request
+	progress := utils.ProgressRenderer{
+		Format: i18n.G("Exporting the snapshot changes: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+	diffArgs := lxd.InstanceSnapshotDiffArgs{
+		From:                 c.flagFrom,
+		CompressionAlgorithm: c.flagCompressionAlgorithm,
+	}
+	diffFileRequest := lxd.BackupFileRequest{
+		BackupFile:      io.WriteSeeker(target),
+		ProgressHandler: progress.UpdateProgress,
+	}
+
+	// Export tarball
+	_, err = d.GetInstanceSnapshotDiffFile(fields[0], fields[1], diffArgs, &diffFileRequest)
+	if err != nil {
+		os.Remove(targetName)
+		progress.Done("")
+		return errors.Wrap(err, "Fetch snapshot changes")
+	}
+
+	progress.Done(i18n.G("Snapshot changes exported successfully!"))
+	return nil
+}
+
+// exportFormat downloads the root filesystem of a container in the format
+// given with --format.
+func (c *cmdExport) exportFormat(d lxd.InstanceServer, name string, args []string) error {
+	if strings.Contains(name, shared.SnapshotDelimiter) {
+		return fmt.Errorf(i18n.G("Snapshots can't be exported with --format"))
+	}
+
+	var targetName string
+	if len(args) > 1 {
+		targetName = args[1]
+	} else {
+		targetName = fmt.Sprintf("%s.%s.tar", name, c.flagFormat)
+	}
+
+	target, err := os.Create(shared.HostPath(targetName))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	// Prepare the download request
+	progress := utils.ProgressRenderer{
+		Format: i18n.G("Exporting the container: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+	exportArgs := lxd.InstanceExportArgs{
+		Format:       c.flagFormat,
+		InstanceOnly: c.flagContainerOnly || c.flagInstanceOnly,
+	}
+	exportFileRequest := lxd.BackupFileRequest{
+		BackupFile:      io.WriteSeeker(target),
+		ProgressHandler: progress.UpdateProgress,
+	}
+
+	// Export tarball
+	_, err = d.GetInstanceExportFile(name, exportArgs, &exportFileRequest)
+	if err != nil {
+		os.Remove(targetName)
+		progress.Done("")
+		return errors.Wrap(err, "Fetch container export")
+	}
+
+	progress.Done(i18n.G("Container exported successfully!"))
+	return nil
+}
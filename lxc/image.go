@@ -95,6 +95,20 @@ hash or alias name (if one is set).`))
 	return cmd
 }
 
+// preseed returns where to create the cached volume of a new image, as set by
+// the --preseed and --preseed-member flags.
+func (c *cmdImage) preseed(pool string, members []string) (*api.ImagePreseed, error) {
+	if pool == "" {
+		if len(members) > 0 {
+			return nil, fmt.Errorf(i18n.G("A storage pool must be provided with --preseed to preseed on members"))
+		}
+
+		return nil, nil
+	}
+
+	return &api.ImagePreseed{Pool: pool, Members: members}, nil
+}
+
 func (c *cmdImage) dereferenceAlias(d lxd.ImageServer, imageType string, inName string) string {
 	if inName == "" {
 		inName = "default"
@@ -118,6 +132,8 @@ type cmdImageCopy struct {
 	flagCopyAliases bool
 	flagAutoUpdate  bool
 	flagVM          bool
+	flagPreseed     string
+	flagPreseedOn   []string
 }
 
 func (c *cmdImageCopy) Command() *cobra.Command {
@@ -136,6 +152,8 @@ It requires the source to be an alias and for it to be public.`))
 	cmd.Flags().BoolVar(&c.flagAutoUpdate, "auto-update", false, i18n.G("Keep the image up to date after initial copy"))
 	cmd.Flags().StringArrayVar(&c.flagAliases, "alias", nil, i18n.G("New aliases to add to the image")+"``")
 	cmd.Flags().BoolVar(&c.flagVM, "vm", false, i18n.G("Copy virtual machine images"))
+	cmd.Flags().StringVar(&c.flagPreseed, "preseed", "", i18n.G("Storage pool to create the cached volume of the image in")+"``")
+	cmd.Flags().StringArrayVar(&c.flagPreseedOn, "preseed-member", nil, i18n.G("Cluster member to create the cached volume on (defaults to all)")+"``")
 	cmd.RunE = c.Run
 
 	return cmd
@@ -206,10 +224,16 @@ func (c *cmdImageCopy) Run(cmd *cobra.Command, args []string) error {
 		imgInfo.Fingerprint = name
 	}
 
+	preseed, err := c.image.preseed(c.flagPreseed, c.flagPreseedOn)
+	if err != nil {
+		return err
+	}
+
 	copyArgs := lxd.ImageCopyArgs{
 		AutoUpdate: c.flagAutoUpdate,
 		Public:     c.flagPublic,
 		Type:       imageType,
+		Preseed:    preseed,
 	}
 
 	// Do the copy
@@ -581,8 +605,10 @@ type cmdImageImport struct {
 	global *cmdGlobal
 	image  *cmdImage
 
-	flagPublic  bool
-	flagAliases []string
+	flagPublic    bool
+	flagAliases   []string
+	flagPreseed   string
+	flagPreseedOn []string
 }
 
 func (c *cmdImageImport) Command() *cobra.Command {
@@ -596,6 +622,8 @@ Directory import is only available on Linux and must be performed as root.`))
 
 	cmd.Flags().BoolVar(&c.flagPublic, "public", false, i18n.G("Make image public"))
 	cmd.Flags().StringArrayVar(&c.flagAliases, "alias", nil, i18n.G("New aliases to add to the image")+"``")
+	cmd.Flags().StringVar(&c.flagPreseed, "preseed", "", i18n.G("Storage pool to create the cached volume of the image in")+"``")
+	cmd.Flags().StringArrayVar(&c.flagPreseedOn, "preseed-member", nil, i18n.G("Cluster member to create the cached volume on (defaults to all)")+"``")
 	cmd.RunE = c.Run
 
 	return cmd
@@ -686,6 +714,11 @@ func (c *cmdImageImport) Run(cmd *cobra.Command, args []string) error {
 	image := api.ImagesPost{}
 	image.Public = c.flagPublic
 
+	image.Preseed, err = c.image.preseed(c.flagPreseed, c.flagPreseedOn)
+	if err != nil {
+		return err
+	}
+
 	// Handle aliases
 	aliases := []api.ImageAlias{}
 	for _, entry := range c.flagAliases {
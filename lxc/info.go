@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -495,6 +496,20 @@ func (c *cmdInfo) containerInfo(d lxd.InstanceServer, remote config.Remote, name
 				if disk.Usage != 0 {
 					diskInfo += fmt.Sprintf("    %s: %s\n", entry, units.GetByteSizeString(disk.Usage, 2))
 				}
+
+				// Largest directories first
+				dirs := []string{}
+				for dir := range disk.Directories {
+					dirs = append(dirs, dir)
+				}
+
+				sort.Slice(dirs, func(i, j int) bool {
+					return disk.Directories[dirs[i]] > disk.Directories[dirs[j]]
+				})
+
+				for _, dir := range dirs {
+					diskInfo += fmt.Sprintf("      /%s: %s\n", dir, units.GetByteSizeString(disk.Directories[dir], 2))
+				}
 			}
 		}
 
@@ -355,7 +355,7 @@ func (c *cmdGlobal) PreRun(cmd *cobra.Command, args []string) error {
 	c.conf.UserAgent = version.UserAgent
 
 	// Setup the logger
-	logger.Log, err = logging.GetLogger("", "", c.flagLogVerbose, c.flagLogDebug, nil)
+	logger.Log, err = logging.GetLogger("", "", c.flagLogVerbose, c.flagLogDebug, false, nil)
 	if err != nil {
 		return err
 	}
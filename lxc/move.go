@@ -27,6 +27,7 @@ type cmdMove struct {
 	flagStorage       string
 	flagTarget        string
 	flagTargetProject string
+	flagSnapshots     string
 }
 
 func (c *cmdMove) Command() *cobra.Command {
@@ -58,6 +59,7 @@ lxc move <container>/<old snapshot name> <container>/<new snapshot name>
 	cmd.Flags().StringVarP(&c.flagStorage, "storage", "s", "", i18n.G("Storage pool name")+"``")
 	cmd.Flags().StringVar(&c.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
 	cmd.Flags().StringVar(&c.flagTargetProject, "target-project", "", i18n.G("Copy to a project different from the source")+"``")
+	cmd.Flags().StringVar(&c.flagSnapshots, "snapshots", "", i18n.G("Snapshots to move: all (default), none or a comma separated list of name patterns")+"``")
 
 	return cmd
 }
@@ -109,6 +111,10 @@ func (c *cmdMove) Run(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf(i18n.G("Can't override configuration or profiles in local rename"))
 		}
 
+		if c.flagSnapshots != "" {
+			return fmt.Errorf(i18n.G("Can't select the snapshots to keep in local rename"))
+		}
+
 		source, err := conf.GetInstanceServer(sourceRemote)
 		if err != nil {
 			return err
@@ -165,6 +171,10 @@ func (c *cmdMove) Run(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf(i18n.G("The --instance-only flag can't be used with --target"))
 		}
 
+		if c.flagSnapshots != "" {
+			return fmt.Errorf(i18n.G("The --snapshots flag can't be used with --target"))
+		}
+
 		if c.flagMode != moveDefaultMode {
 			return fmt.Errorf(i18n.G("The --mode flag can't be used with --target"))
 		}
@@ -180,6 +190,7 @@ func (c *cmdMove) Run(cmd *cobra.Command, args []string) error {
 	cpy.flagDevice = c.flagDevice
 	cpy.flagProfile = c.flagProfile
 	cpy.flagNoProfiles = c.flagNoProfiles
+	cpy.flagSnapshots = c.flagSnapshots
 
 	stateful := !c.flagStateless
 	instanceOnly := c.flagContainerOnly || c.flagInstanceOnly
@@ -72,6 +72,10 @@ func (c *cmdNetwork) Command() *cobra.Command {
 	networkListCmd := cmdNetworkList{global: c.global, network: c}
 	cmd.AddCommand(networkListCmd.Command())
 
+	// List allocations
+	networkListAllocationsCmd := cmdNetworkListAllocations{global: c.global, network: c}
+	cmd.AddCommand(networkListAllocationsCmd.Command())
+
 	// List leases
 	networkListLeasesCmd := cmdNetworkListLeases{global: c.global, network: c}
 	cmd.AddCommand(networkListLeasesCmd.Command())
@@ -877,6 +881,67 @@ func (c *cmdNetworkList) Run(cmd *cobra.Command, args []string) error {
 	return utils.RenderTable(c.flagFormat, header, data, networks)
 }
 
+// List allocations
+type cmdNetworkListAllocations struct {
+	global  *cmdGlobal
+	network *cmdNetwork
+
+	flagFormat string
+}
+
+func (c *cmdNetworkListAllocations) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("list-allocations [<remote>:]<network>")
+	cmd.Short = i18n.G("List static address allocations")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`List the static addresses assigned to instances on a managed network`))
+	cmd.Flags().StringVar(&c.flagFormat, "format", "table", i18n.G("Format (csv|json|table|yaml)")+"``")
+
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdNetworkListAllocations) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 1, 1)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing network name"))
+	}
+
+	// List static addresses
+	allocations, err := resource.server.GetNetworkAllocations(resource.name)
+	if err != nil {
+		return err
+	}
+
+	data := [][]string{}
+	for _, allocation := range allocations {
+		data = append(data, []string{allocation.Address, allocation.Project, allocation.Instance, allocation.Device})
+	}
+
+	header := []string{
+		i18n.G("IP ADDRESS"),
+		i18n.G("PROJECT"),
+		i18n.G("INSTANCE"),
+		i18n.G("DEVICE"),
+	}
+
+	return utils.RenderTable(c.flagFormat, header, data, allocations)
+}
+
 // List leases
 type cmdNetworkListLeases struct {
 	global  *cmdGlobal
@@ -33,6 +33,10 @@ func (c *cmdProfile) Command() *cobra.Command {
 	profileAddCmd := cmdProfileAdd{global: c.global, profile: c}
 	cmd.AddCommand(profileAddCmd.Command())
 
+	// Apply
+	profileApplyCmd := cmdProfileApply{global: c.global, profile: c}
+	cmd.AddCommand(profileApplyCmd.Command())
+
 	// Assign
 	profileAssignCmd := cmdProfileAssign{global: c.global, profile: c}
 	cmd.AddCommand(profileAssignCmd.Command())
@@ -53,6 +57,10 @@ func (c *cmdProfile) Command() *cobra.Command {
 	profileDeviceCmd := cmdConfigDevice{global: c.global, profile: c}
 	cmd.AddCommand(profileDeviceCmd.Command())
 
+	// Diff
+	profileDiffCmd := cmdProfileDiff{global: c.global, profile: c}
+	cmd.AddCommand(profileDiffCmd.Command())
+
 	// Edit
 	profileEditCmd := cmdProfileEdit{global: c.global, profile: c}
 	cmd.AddCommand(profileEditCmd.Command())
@@ -150,6 +158,71 @@ func (c *cmdProfileAdd) Run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Apply
+type cmdProfileApply struct {
+	global  *cmdGlobal
+	profile *cmdProfile
+}
+
+func (c *cmdProfileApply) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("apply [<remote>:]<profile>")
+	cmd.Short = i18n.G("Re-apply profiles to the running instances not using their current definition")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Re-apply profiles to the running instances not using their current definition
+
+This applies the current definition of their profiles to the instances
+listed by "lxc profile diff".`))
+
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdProfileApply) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 1, 1)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing profile name"))
+	}
+
+	// Re-apply the profile
+	op, err := resource.server.ApplyProfile(resource.name)
+	if err != nil {
+		return err
+	}
+
+	opErr := op.Wait()
+
+	if !c.global.flagQuiet {
+		results, ok := op.Get().Metadata["results"].([]interface{})
+		if ok {
+			for _, entry := range results {
+				result, ok := entry.(map[string]interface{})
+				if !ok || result["error"] != "" {
+					continue
+				}
+
+				fmt.Printf(i18n.G("Profiles re-applied to %s")+"\n", result["name"])
+			}
+		}
+	}
+
+	return opErr
+}
+
 // Assign
 type cmdProfileAssign struct {
 	global  *cmdGlobal
@@ -391,6 +464,69 @@ func (c *cmdProfileDelete) Run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Diff
+type cmdProfileDiff struct {
+	global     *cmdGlobal
+	profile    *cmdProfile
+	flagFormat string
+}
+
+func (c *cmdProfileDiff) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("diff [<remote>:]<profile>")
+	cmd.Short = i18n.G("List the running instances not using the current profile definitions")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`List the running instances not using the current profile definitions
+
+This lists the running instances using the profile which couldn't get
+a change to the profile, or to one of their other profiles, applied.`))
+
+	cmd.RunE = c.Run
+	cmd.Flags().StringVar(&c.flagFormat, "format", "table", i18n.G("Format (csv|json|table|yaml)")+"``")
+
+	return cmd
+}
+
+func (c *cmdProfileDiff) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 1, 1)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing profile name"))
+	}
+
+	// List the deviating instances
+	diffs, err := resource.server.GetProfileDiff(resource.name)
+	if err != nil {
+		return err
+	}
+
+	data := [][]string{}
+	for _, diff := range diffs {
+		data = append(data, []string{diff.Name, diff.Project, diff.Location, strings.Join(diff.Profiles, ", ")})
+	}
+	sort.Sort(byName(data))
+
+	header := []string{
+		i18n.G("NAME"),
+		i18n.G("PROJECT"),
+		i18n.G("LOCATION"),
+		i18n.G("PROFILES")}
+
+	return utils.RenderTable(c.flagFormat, header, data, diffs)
+}
+
 // Edit
 type cmdProfileEdit struct {
 	global  *cmdGlobal
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"sort"
@@ -10,12 +11,15 @@ import (
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 
+	lxd "github.com/lxc/lxd/client"
 	"github.com/lxc/lxd/lxc/utils"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	cli "github.com/lxc/lxd/shared/cmd"
 	"github.com/lxc/lxd/shared/i18n"
+	"github.com/lxc/lxd/shared/ioprogress"
 	"github.com/lxc/lxd/shared/termios"
+	"github.com/lxc/lxd/shared/units"
 )
 
 type cmdProject struct {
@@ -41,10 +45,18 @@ func (c *cmdProject) Command() *cobra.Command {
 	projectEditCmd := cmdProjectEdit{global: c.global, project: c}
 	cmd.AddCommand(projectEditCmd.Command())
 
+	// Export
+	projectExportCmd := cmdProjectExport{global: c.global, project: c}
+	cmd.AddCommand(projectExportCmd.Command())
+
 	// Get
 	projectGetCmd := cmdProjectGet{global: c.global, project: c}
 	cmd.AddCommand(projectGetCmd.Command())
 
+	// Import
+	projectImportCmd := cmdProjectImport{global: c.global, project: c}
+	cmd.AddCommand(projectImportCmd.Command())
+
 	// List
 	projectListCmd := cmdProjectList{global: c.global, project: c}
 	cmd.AddCommand(projectListCmd.Command())
@@ -321,6 +333,79 @@ func (c *cmdProjectEdit) Run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Export
+type cmdProjectExport struct {
+	global  *cmdGlobal
+	project *cmdProject
+}
+
+func (c *cmdProjectExport) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("export [<remote>:]<project> [target]")
+	cmd.Short = i18n.G("Export projects")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Export projects, including their instances, profiles and the custom volumes and networks they use`))
+	cmd.Example = cli.FormatSection("", i18n.G(
+		`lxc project export tenant1 tenant1.tar
+    Download an export of the tenant1 project.`))
+
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdProjectExport) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 1, 2)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing project name"))
+	}
+
+	targetName := resource.name + ".tar"
+	if len(args) > 1 {
+		targetName = args[1]
+	}
+
+	target, err := os.Create(shared.HostPath(targetName))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	// Prepare the download request
+	progress := utils.ProgressRenderer{
+		Format: i18n.G("Exporting the project: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+
+	req := lxd.BackupFileRequest{
+		BackupFile:      io.WriteSeeker(target),
+		ProgressHandler: progress.UpdateProgress,
+	}
+
+	_, err = resource.server.GetProjectExportFile(resource.name, &req)
+	if err != nil {
+		os.Remove(targetName)
+		progress.Done("")
+		return err
+	}
+
+	progress.Done(i18n.G("Project exported successfully!"))
+	return nil
+}
+
 // Get
 type cmdProjectGet struct {
 	global  *cmdGlobal
@@ -368,6 +453,106 @@ func (c *cmdProjectGet) Run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Import
+type cmdProjectImport struct {
+	global  *cmdGlobal
+	project *cmdProject
+
+	flagStorage string
+}
+
+func (c *cmdProjectImport) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("import [<remote>:] <export file> [<project>]")
+	cmd.Short = i18n.G("Import projects")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Import project exports, creating a new project`))
+	cmd.Example = cli.FormatSection("", i18n.G(
+		`lxc project import tenant1.tar tenant2
+    Create the tenant2 project from the export of the tenant1 project.`))
+
+	cmd.RunE = c.Run
+	cmd.Flags().StringVarP(&c.flagStorage, "storage", "s", "", i18n.G("Storage pool name")+"``")
+
+	return cmd
+}
+
+func (c *cmdProjectImport) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 1, 3)
+	if exit {
+		return err
+	}
+
+	// The remote is optional and ends with a colon.
+	remote := ""
+	if strings.HasSuffix(args[0], ":") {
+		remote = args[0]
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		cmd.Help()
+		return fmt.Errorf(i18n.G("Missing export file"))
+	}
+
+	resources, err := c.global.ParseServers(remote)
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+
+	file, err := os.Open(shared.HostPath(args[0]))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fstat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	progress := utils.ProgressRenderer{
+		Format: i18n.G("Importing project: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+
+	importArgs := lxd.ProjectImportArgs{
+		ExportFile: &ioprogress.ProgressReader{
+			ReadCloser: file,
+			Tracker: &ioprogress.ProgressTracker{
+				Length: fstat.Size(),
+				Handler: func(percent int64, speed int64) {
+					progress.UpdateProgress(ioprogress.ProgressData{Text: fmt.Sprintf("%d%% (%s/s)", percent, units.GetByteSizeString(speed, 2))})
+				},
+			},
+		},
+		PoolName: c.flagStorage,
+	}
+
+	if len(args) > 1 {
+		importArgs.Name = args[1]
+	}
+
+	op, err := resource.server.CreateProjectFromExport(importArgs)
+	if err != nil {
+		return err
+	}
+
+	// Wait for operation to finish
+	err = utils.CancelableWait(op, &progress)
+	if err != nil {
+		progress.Done("")
+		return err
+	}
+
+	progress.Done("")
+
+	return nil
+}
+
 // List
 type cmdProjectList struct {
 	global  *cmdGlobal
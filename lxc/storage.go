@@ -378,7 +378,8 @@ type cmdStorageInfo struct {
 	global  *cmdGlobal
 	storage *cmdStorage
 
-	flagBytes bool
+	flagBytes  bool
+	flagDetail bool
 }
 
 func (c *cmdStorageInfo) Command() *cobra.Command {
@@ -389,6 +390,7 @@ func (c *cmdStorageInfo) Command() *cobra.Command {
 		`Show useful information about storage pools`))
 
 	cmd.Flags().BoolVar(&c.flagBytes, "bytes", false, i18n.G("Show the used and free space in bytes"))
+	cmd.Flags().BoolVar(&c.flagDetail, "detail", false, i18n.G("Show the volume counts, biggest volumes and image cache size of the pool"))
 	cmd.Flags().StringVar(&c.storage.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
 	cmd.RunE = c.Run
 
@@ -429,9 +431,31 @@ func (c *cmdStorageInfo) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	res, err := resource.server.GetStoragePoolResources(resource.name)
-	if err != nil {
-		return err
+	// The detailed usage includes the space of the pool, so a single call is needed either way.
+	var usage *api.StoragePoolUsage
+	var space api.ResourcesStoragePoolSpace
+	if c.flagDetail {
+		usage, err = resource.server.GetStoragePoolUsage(resource.name)
+		if err != nil {
+			return err
+		}
+
+		space = usage.Space
+	} else {
+		res, err := resource.server.GetStoragePoolResources(resource.name)
+		if err != nil {
+			return err
+		}
+
+		space = res.Space
+	}
+
+	formatSize := func(size uint64) string {
+		if c.flagBytes {
+			return strconv.FormatUint(size, 10)
+		}
+
+		return units.GetByteSizeString(int64(size), 2)
 	}
 
 	// Declare the poolinfo map of maps in order to build up the yaml
@@ -468,13 +492,8 @@ func (c *cmdStorageInfo) Run(cmd *cobra.Command, args []string) error {
 	poolinfo[infostring][namestring] = pool.Name
 	poolinfo[infostring][driverstring] = pool.Driver
 	poolinfo[infostring][descriptionstring] = pool.Description
-	if c.flagBytes {
-		poolinfo[infostring][totalspacestring] = strconv.FormatUint(res.Space.Total, 10)
-		poolinfo[infostring][spaceusedstring] = strconv.FormatUint(res.Space.Used, 10)
-	} else {
-		poolinfo[infostring][totalspacestring] = units.GetByteSizeString(int64(res.Space.Total), 2)
-		poolinfo[infostring][spaceusedstring] = units.GetByteSizeString(int64(res.Space.Used), 2)
-	}
+	poolinfo[infostring][totalspacestring] = formatSize(space.Total)
+	poolinfo[infostring][spaceusedstring] = formatSize(space.Used)
 
 	poolinfodata, err := yaml.Marshal(poolinfo)
 	if err != nil {
@@ -489,6 +508,32 @@ func (c *cmdStorageInfo) Run(cmd *cobra.Command, args []string) error {
 	fmt.Printf("%s", poolinfodata)
 	fmt.Printf("%s", poolusedbydata)
 
+	if usage == nil {
+		return nil
+	}
+
+	// Build up the detailed usage, with the biggest volumes as a list to keep them sorted
+	pooldetail := map[string]interface{}{
+		i18n.G("volumes"):     usage.Volumes,
+		i18n.G("snapshots"):   usage.Snapshots,
+		i18n.G("images size"): formatSize(usage.ImagesSize),
+	}
+
+	biggest := []string{}
+	for _, vol := range usage.BiggestVolumes {
+		biggest = append(biggest, fmt.Sprintf(i18n.G("%s/%s (project %s): %s, %d snapshots"), vol.Type, vol.Name, vol.Project, formatSize(vol.Used), vol.Snapshots))
+	}
+
+	pooldetaildata, err := yaml.Marshal(map[string]interface{}{
+		i18n.G("usage"):           pooldetail,
+		i18n.G("biggest volumes"): biggest,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s", pooldetaildata)
+
 	return nil
 }
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"sort"
@@ -17,7 +18,9 @@ import (
 	"github.com/lxc/lxd/shared/api"
 	cli "github.com/lxc/lxd/shared/cmd"
 	"github.com/lxc/lxd/shared/i18n"
+	"github.com/lxc/lxd/shared/ioprogress"
 	"github.com/lxc/lxd/shared/termios"
+	"github.com/lxc/lxd/shared/units"
 )
 
 type cmdStorageVolume struct {
@@ -66,10 +69,18 @@ Unless specified through a prefix, all volume operations affect "custom" (user c
 	storageVolumeEditCmd := cmdStorageVolumeEdit{global: c.global, storage: c.storage, storageVolume: c}
 	cmd.AddCommand(storageVolumeEditCmd.Command())
 
+	// Export
+	storageVolumeExportCmd := cmdStorageVolumeExport{global: c.global, storage: c.storage, storageVolume: c}
+	cmd.AddCommand(storageVolumeExportCmd.Command())
+
 	// Get
 	storageVolumeGetCmd := cmdStorageVolumeGet{global: c.global, storage: c.storage, storageVolume: c}
 	cmd.AddCommand(storageVolumeGetCmd.Command())
 
+	// Import
+	storageVolumeImportCmd := cmdStorageVolumeImport{global: c.global, storage: c.storage, storageVolume: c}
+	cmd.AddCommand(storageVolumeImportCmd.Command())
+
 	// List
 	storageVolumeListCmd := cmdStorageVolumeList{global: c.global, storage: c.storage, storageVolume: c}
 	cmd.AddCommand(storageVolumeListCmd.Command())
@@ -289,8 +300,10 @@ type cmdStorageVolumeCopy struct {
 	storage       *cmdStorage
 	storageVolume *cmdStorageVolume
 
-	flagMode       string
-	flagVolumeOnly bool
+	flagMode           string
+	flagVolumeOnly     bool
+	flagRefresh        bool
+	flagBandwidthLimit string
 }
 
 func (c *cmdStorageVolumeCopy) Command() *cobra.Command {
@@ -304,6 +317,8 @@ func (c *cmdStorageVolumeCopy) Command() *cobra.Command {
 	cmd.Flags().StringVar(&c.flagMode, "mode", "pull", i18n.G("Transfer mode. One of pull (default), push or relay.")+"``")
 	cmd.Flags().StringVar(&c.storage.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
 	cmd.Flags().BoolVar(&c.flagVolumeOnly, "volume-only", false, i18n.G("Copy the volume without its snapshots"))
+	cmd.Flags().BoolVar(&c.flagRefresh, "refresh", false, i18n.G("Perform an incremental copy"))
+	cmd.Flags().StringVar(&c.flagBandwidthLimit, "bandwidth-limit", "", i18n.G("Limit of the rate the volume is sent at between servers, like rsync.bwlimit")+"``")
 	cmd.RunE = c.Run
 
 	return cmd
@@ -406,6 +421,8 @@ func (c *cmdStorageVolumeCopy) Run(cmd *cobra.Command, args []string) error {
 		args.Name = dstVolName
 		args.Mode = mode
 		args.VolumeOnly = c.flagVolumeOnly
+		args.Refresh = c.flagRefresh
+		args.BandwidthLimit = c.flagBandwidthLimit
 
 		if isSnapshot {
 			srcVol.Name = srcVolName
@@ -453,6 +470,8 @@ type cmdStorageVolumeCreate struct {
 	global        *cmdGlobal
 	storage       *cmdStorage
 	storageVolume *cmdStorageVolume
+
+	flagContentType string
 }
 
 func (c *cmdStorageVolumeCreate) Command() *cobra.Command {
@@ -463,6 +482,7 @@ func (c *cmdStorageVolumeCreate) Command() *cobra.Command {
 		`Create new custom storage volumes`))
 
 	cmd.Flags().StringVar(&c.storage.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
+	cmd.Flags().StringVar(&c.flagContentType, "type", "filesystem", i18n.G("Content type of the volume (filesystem or block)")+"``")
 	cmd.RunE = c.Run
 
 	return cmd
@@ -498,6 +518,14 @@ func (c *cmdStorageVolumeCreate) Run(cmd *cobra.Command, args []string) error {
 	vol.Type = volType
 	vol.Config = map[string]string{}
 
+	if c.flagContentType != "filesystem" {
+		if !client.HasExtension("custom_block_volumes") {
+			return fmt.Errorf(i18n.G("The server doesn't support custom block volumes"))
+		}
+
+		vol.ContentType = c.flagContentType
+	}
+
 	for i := 2; i < len(args); i++ {
 		entry := strings.SplitN(args[i], "=", 2)
 		if len(entry) < 2 {
@@ -1144,6 +1172,7 @@ func (c *cmdStorageVolumeMove) Command() *cobra.Command {
 
 	cmd.Flags().StringVar(&c.storageVolumeCopy.flagMode, "mode", "pull", i18n.G("Transfer mode, one of pull (default), push or relay")+"``")
 	cmd.Flags().StringVar(&c.storage.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
+	cmd.Flags().StringVar(&c.storageVolumeCopy.flagBandwidthLimit, "bandwidth-limit", "", i18n.G("Limit of the rate the volume is sent at between servers, like rsync.bwlimit")+"``")
 	cmd.RunE = c.Run
 
 	return cmd
@@ -1605,3 +1634,197 @@ func (c *cmdStorageVolumeRestore) Run(cmd *cobra.Command, args []string) error {
 
 	return client.UpdateStoragePoolVolume(resource.name, "custom", args[1], req, etag)
 }
+
+// Export
+type cmdStorageVolumeExport struct {
+	global        *cmdGlobal
+	storage       *cmdStorage
+	storageVolume *cmdStorageVolume
+
+	flagVolumeOnly           bool
+	flagOptimizedStorage     bool
+	flagCompressionAlgorithm string
+}
+
+func (c *cmdStorageVolumeExport) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("export [<remote>:]<pool> <volume> [<path>]")
+	cmd.Short = i18n.G("Export custom storage volumes")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Export custom storage volumes as backup tarballs, including their snapshots`))
+	cmd.Example = cli.FormatSection("", i18n.G(
+		`lxc storage volume export default data data.tar.gz
+    Download a backup tarball of the data volume of the default pool.`))
+
+	cmd.Flags().BoolVar(&c.flagVolumeOnly, "volume-only", false, i18n.G("Export the volume without its snapshots"))
+	cmd.Flags().BoolVar(&c.flagOptimizedStorage, "optimized-storage", false,
+		i18n.G("Use storage driver optimized format (can only be restored on a similar pool)"))
+	cmd.Flags().StringVar(&c.flagCompressionAlgorithm, "compression", "", i18n.G("Define a compression algorithm: for backup or none")+"``")
+	cmd.Flags().StringVar(&c.storage.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdStorageVolumeExport) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 2, 3)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing pool name"))
+	}
+
+	client := resource.server
+
+	// If a target was specified, export the volume on the given member.
+	if c.storage.flagTarget != "" {
+		client = client.UseTarget(c.storage.flagTarget)
+	}
+
+	targetName := "backup.tar.gz"
+	if len(args) > 2 {
+		targetName = args[2]
+	}
+
+	target, err := os.Create(shared.HostPath(targetName))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	// Prepare the download request
+	progress := utils.ProgressRenderer{
+		Format: i18n.G("Exporting the backup: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+
+	backupArgs := lxd.StoragePoolVolumeBackupArgs{
+		OptimizedStorage:     c.flagOptimizedStorage,
+		VolumeOnly:           c.flagVolumeOnly,
+		CompressionAlgorithm: c.flagCompressionAlgorithm,
+	}
+
+	req := lxd.BackupFileRequest{
+		BackupFile:      io.WriteSeeker(target),
+		ProgressHandler: progress.UpdateProgress,
+	}
+
+	_, err = client.GetStoragePoolVolumeBackupFile(resource.name, args[1], &backupArgs, &req)
+	if err != nil {
+		os.Remove(shared.HostPath(targetName))
+		progress.Done("")
+		return err
+	}
+
+	progress.Done(i18n.G("Backup exported successfully!"))
+	return nil
+}
+
+// Import
+type cmdStorageVolumeImport struct {
+	global        *cmdGlobal
+	storage       *cmdStorage
+	storageVolume *cmdStorageVolume
+}
+
+func (c *cmdStorageVolumeImport) Command() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = i18n.G("import [<remote>:]<pool> <backup file> [<volume>]")
+	cmd.Short = i18n.G("Import custom storage volumes")
+	cmd.Long = cli.FormatSection(i18n.G("Description"), i18n.G(
+		`Import backups of custom storage volumes including their snapshots`))
+	cmd.Example = cli.FormatSection("", i18n.G(
+		`lxc storage volume import default data.tar.gz data2
+    Create the data2 volume in the default pool from the data.tar.gz backup.`))
+
+	cmd.Flags().StringVar(&c.storage.flagTarget, "target", "", i18n.G("Cluster member name")+"``")
+	cmd.RunE = c.Run
+
+	return cmd
+}
+
+func (c *cmdStorageVolumeImport) Run(cmd *cobra.Command, args []string) error {
+	// Sanity checks
+	exit, err := c.global.CheckArgs(cmd, args, 2, 3)
+	if exit {
+		return err
+	}
+
+	// Parse remote
+	resources, err := c.global.ParseServers(args[0])
+	if err != nil {
+		return err
+	}
+
+	resource := resources[0]
+	if resource.name == "" {
+		return fmt.Errorf(i18n.G("Missing pool name"))
+	}
+
+	client := resource.server
+
+	// If a target was specified, create the volume on the given member.
+	if c.storage.flagTarget != "" {
+		client = client.UseTarget(c.storage.flagTarget)
+	}
+
+	file, err := os.Open(shared.HostPath(args[1]))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fstat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	volName := ""
+	if len(args) > 2 {
+		volName = args[2]
+	}
+
+	progress := utils.ProgressRenderer{
+		Format: i18n.G("Importing custom volume: %s"),
+		Quiet:  c.global.flagQuiet,
+	}
+
+	createArgs := lxd.StoragePoolVolumeBackupImportArgs{
+		BackupFile: &ioprogress.ProgressReader{
+			ReadCloser: file,
+			Tracker: &ioprogress.ProgressTracker{
+				Length: fstat.Size(),
+				Handler: func(percent int64, speed int64) {
+					progress.UpdateProgress(ioprogress.ProgressData{Text: fmt.Sprintf("%d%% (%s/s)", percent, units.GetByteSizeString(speed, 2))})
+				},
+			},
+		},
+		Name: volName,
+	}
+
+	op, err := client.CreateStoragePoolVolumeFromBackup(resource.name, createArgs)
+	if err != nil {
+		return err
+	}
+
+	// Wait for operation to finish
+	err = utils.CancelableWait(op, &progress)
+	if err != nil {
+		progress.Done("")
+		return err
+	}
+
+	progress.Done("")
+
+	return nil
+}
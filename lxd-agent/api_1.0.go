@@ -22,6 +22,7 @@ var api10 = []APIEndpoint{
 	operationCmd,
 	operationWebsocket,
 	stateCmd,
+	trimCmd,
 }
 
 func api10Get(r *http.Request) response.Response {
@@ -31,6 +31,9 @@ func (c *cmdAgent) Command() *cobra.Command {
 }
 
 func (c *cmdAgent) Run(cmd *cobra.Command, args []string) error {
+	// Mount the shares of the custom volumes of the virtual machine.
+	mountHostShares()
+
 	// Setup the listener.
 	l, err := vsock.Listen(8443)
 	if err != nil {
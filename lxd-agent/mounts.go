@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/shared"
+)
+
+// mountHostShares mounts the shares of custom filesystem volumes listed by LXD in the
+// agent-mounts.json file of the config drive. Failures are only logged, so that the agent still
+// starts when a share can't be mounted.
+func mountHostShares() {
+	content, err := ioutil.ReadFile("agent-mounts.json")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read the shares to mount: %v", err)
+		}
+
+		return
+	}
+
+	mounts := []instancetype.VMAgentMount{}
+	err = json.Unmarshal(content, &mounts)
+	if err != nil {
+		log.Printf("Failed to parse the shares to mount: %v", err)
+		return
+	}
+
+	for _, mount := range mounts {
+		err = os.MkdirAll(mount.Target, 0755)
+		if err != nil {
+			log.Printf("Failed to create mount point %q: %v", mount.Target, err)
+			continue
+		}
+
+		args := []string{"-t", mount.FSType, mount.Source, mount.Target}
+		if len(mount.Options) > 0 {
+			args = append(args, "-o", strings.Join(mount.Options, ","))
+		}
+
+		_, err = shared.RunCommand("mount", args...)
+		if err != nil {
+			log.Printf("Failed to mount %q on %q: %v", mount.Source, mount.Target, err)
+		}
+	}
+}
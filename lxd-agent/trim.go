@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/shared"
+)
+
+var trimCmd = APIEndpoint{
+	Name: "trim",
+	Path: "trim",
+
+	Post: APIEndpointAction{Handler: trimPost},
+}
+
+// trimPost discards the unused blocks of all the mounted filesystems, so that the space they use
+// can be reclaimed on the host.
+func trimPost(r *http.Request) response.Response {
+	_, err := shared.RunCommand("fstrim", "--all")
+	if err != nil {
+		return response.InternalError(fmt.Errorf("Failed to trim filesystems: %v", err))
+	}
+
+	return response.EmptySyncResponse
+}
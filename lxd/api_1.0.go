@@ -12,12 +12,14 @@ import (
 	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/config"
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/db/query"
 	"github.com/lxc/lxd/lxd/node"
 	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/logging"
 	"github.com/lxc/lxd/shared/osarch"
 	"github.com/lxc/lxd/shared/version"
 	"github.com/pkg/errors"
@@ -35,21 +37,31 @@ var api10 = []APIEndpoint{
 	certificateCmd,
 	certificatesCmd,
 	clusterCmd,
+	clusterCertificateCmd,
 	clusterNodeCmd,
 	clusterNodesCmd,
+	clusterRebalanceCmd,
 	instanceBackupCmd,
+	instanceBackupContentsCmd,
 	instanceBackupExportCmd,
+	instanceBackupRestoreCmd,
 	instanceBackupsCmd,
 	instanceCmd,
 	instanceConsoleCmd,
 	instanceExecCmd,
+	instanceExportCmd,
 	instanceFileCmd,
 	instanceLogCmd,
 	instanceLogsCmd,
 	instanceMetadataCmd,
 	instanceMetadataTemplatesCmd,
+	instancePresetCmd,
+	instancePresetInstancesCmd,
+	instancePresetsCmd,
 	instancesCmd,
 	instanceSnapshotCmd,
+	instanceSnapshotFileCmd,
+	instanceSnapshotExportCmd,
 	instanceSnapshotsCmd,
 	instanceStateCmd,
 	eventsCmd,
@@ -60,7 +72,9 @@ var api10 = []APIEndpoint{
 	imageRefreshCmd,
 	imagesCmd,
 	imageSecretCmd,
+	metadataConfigurationCmd,
 	networkCmd,
+	networkAllocationsCmd,
 	networkLeasesCmd,
 	networksCmd,
 	networkStateCmd,
@@ -68,19 +82,28 @@ var api10 = []APIEndpoint{
 	operationsCmd,
 	operationWait,
 	operationWebsocket,
+	preseedCmd,
+	profileApplyCmd,
 	profileCmd,
+	profileDiffCmd,
 	profilesCmd,
 	projectCmd,
+	projectExportCmd,
 	projectsCmd,
 	storagePoolCmd,
 	storagePoolResourcesCmd,
+	storagePoolUsageCmd,
 	storagePoolsCmd,
 	storagePoolVolumesCmd,
 	storagePoolVolumeSnapshotsTypeCmd,
 	storagePoolVolumeSnapshotTypeCmd,
+	storagePoolVolumeSnapshotTypeFileCmd,
 	storagePoolVolumesTypeCmd,
+	storagePoolVolumeTypeStateCmd,
+	storagePoolVolumeTypeCheckCmd,
 	storagePoolVolumeTypeContainerCmd,
 	storagePoolVolumeTypeCustomCmd,
+	storagePoolVolumeTypeCustomExportCmd,
 	storagePoolVolumeTypeImageCmd,
 	storagePoolVolumeTypeVMCmd,
 }
@@ -205,6 +228,10 @@ func api10Get(d *Daemon, r *http.Request) response.Response {
 		ServerName:             serverName,
 	}
 
+	if d.firewall != nil {
+		env.Firewall = d.firewall.String()
+	}
+
 	env.KernelFeatures = map[string]string{
 		"netnsid_getifaddrs":        fmt.Sprintf("%v", d.os.NetnsGetifaddrs),
 		"uevent_injection":          fmt.Sprintf("%v", d.os.UeventInjection),
@@ -373,6 +400,15 @@ func doApi10Update(d *Daemon, req api.ServerPut, patch bool) response.Response {
 			if err != nil {
 				return err
 			}
+
+			imagesPool, err := imagesSharedPool(s)
+			if err != nil {
+				return err
+			}
+
+			if imagesPool != "" && nodeValues["storage.images_volume"] != "" {
+				return fmt.Errorf("storage.images_volume can't be set while cluster.images_pool is")
+			}
 		}
 
 		if patch {
@@ -410,6 +446,27 @@ func doApi10Update(d *Daemon, req api.ServerPut, patch bool) response.Response {
 		}
 	}
 
+	// Validate the storage pool of the shared image store and create its volume, before the
+	// other nodes are told to use it.
+	imagesPool, ok := req.Config["cluster.images_pool"].(string)
+	if ok && imagesPool != "" {
+		err := imagesSharedValidate(s, imagesPool)
+		if err != nil {
+			return response.BadRequest(err)
+		}
+
+		err = imagesSharedVolumeCreate(s, imagesPool)
+		if err != nil {
+			return response.SmartError(err)
+		}
+	}
+
+	// Keep secrets out of the database if possible
+	err = daemonConfigSecretsStore(s, clustered, req.Config)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
 	// Then deal with cluster wide configuration
 	var clusterChanged map[string]string
 	var newClusterConfig *cluster.Config
@@ -472,6 +529,7 @@ func doApi10UpdateTriggers(d *Daemon, nodeChanged, clusterChanged map[string]str
 	maasChanged := false
 	candidChanged := false
 	rbacChanged := false
+	webhooksChanged := false
 
 	for key := range clusterChanged {
 		switch key {
@@ -515,6 +573,10 @@ func doApi10UpdateTriggers(d *Daemon, nodeChanged, clusterChanged map[string]str
 			fallthrough
 		case "rbac.expiry":
 			rbacChanged = true
+		case "core.webhooks_allowed":
+			fallthrough
+		case "core.webhooks_secret":
+			webhooksChanged = true
 		}
 	}
 
@@ -552,6 +614,24 @@ func doApi10UpdateTriggers(d *Daemon, nodeChanged, clusterChanged map[string]str
 		}
 	}
 
+	_, traceChanged := nodeChanged["core.debug_database_trace"]
+	_, slowChanged := nodeChanged["core.debug_database_slow_query"]
+	if traceChanged || slowChanged {
+		query.TraceConfigure(nodeConfig.DatabaseTrace())
+	}
+
+	for subsystem, level := range nodeConfig.LogLevels() {
+		_, ok := nodeChanged[fmt.Sprintf("core.log_level.%s", subsystem)]
+		if !ok {
+			continue
+		}
+
+		err := logging.SetSubsystemLevel(subsystem, level)
+		if err != nil {
+			return err
+		}
+	}
+
 	value, ok = nodeChanged["storage.backups_volume"]
 	if ok {
 		err := daemonStorageMove(s, "backups", value)
@@ -568,6 +648,14 @@ func doApi10UpdateTriggers(d *Daemon, nodeChanged, clusterChanged map[string]str
 		}
 	}
 
+	value, ok = clusterChanged["cluster.images_pool"]
+	if ok {
+		err := imagesSharedMove(s, value)
+		if err != nil {
+			return err
+		}
+	}
+
 	if maasChanged {
 		url, key := clusterConfig.MAASController()
 		machine := nodeConfig.MAASMachine()
@@ -585,6 +673,13 @@ func doApi10UpdateTriggers(d *Daemon, nodeChanged, clusterChanged map[string]str
 		}
 	}
 
+	if webhooksChanged {
+		err := daemonConfigSetWebhooks(s, clusterConfig)
+		if err != nil {
+			return err
+		}
+	}
+
 	if rbacChanged {
 		apiURL, apiKey, apiExpiry, agentURL, agentUsername, agentPrivateKey, agentPublicKey := clusterConfig.RBACServer()
 
@@ -49,6 +49,7 @@ var clusterNodeCmd = APIEndpoint{
 	Delete: APIEndpointAction{Handler: clusterNodeDelete},
 	Get:    APIEndpointAction{Handler: clusterNodeGet, AccessHandler: AllowAuthenticated},
 	Post:   APIEndpointAction{Handler: clusterNodePost},
+	Put:    APIEndpointAction{Handler: clusterNodePut},
 }
 
 var internalClusterAcceptCmd = APIEndpoint{
@@ -895,6 +896,64 @@ func clusterNodePost(d *Daemon, r *http.Request) response.Response {
 	return response.EmptySyncResponse
 }
 
+func clusterNodePut(d *Daemon, r *http.Request) response.Response {
+	name := mux.Vars(r)["name"]
+
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if !clustered {
+		return response.BadRequest(fmt.Errorf("This server is not clustered"))
+	}
+
+	nodes, err := cluster.List(d.State())
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	var member *api.ClusterMember
+	for i := range nodes {
+		if nodes[i].ServerName == name {
+			member = &nodes[i]
+			break
+		}
+	}
+
+	if member == nil {
+		return response.NotFound(fmt.Errorf("Member '%s' not found", name))
+	}
+
+	// Validate the ETag
+	err = util.EtagCheck(r, *member)
+	if err != nil {
+		return response.PreconditionFailed(err)
+	}
+
+	req := api.ClusterMemberPut{}
+
+	// Parse the request
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		node, err := tx.NodeByName(name)
+		if err != nil {
+			return err
+		}
+
+		return tx.NodeMaintenance(node.ID, req.Maintenance)
+	})
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.EmptySyncResponse
+}
+
 func clusterNodeDelete(d *Daemon, r *http.Request) response.Response {
 	force, err := strconv.Atoi(r.FormValue("force"))
 	if err != nil {
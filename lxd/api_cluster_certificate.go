@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+var clusterCertificateCmd = APIEndpoint{
+	Path: "cluster/certificate",
+
+	Put: APIEndpointAction{Handler: clusterCertificatePut},
+}
+
+var internalClusterCertificateCmd = APIEndpoint{
+	Path: "cluster/certificate",
+
+	Post: APIEndpointAction{Handler: internalClusterCertificatePost},
+}
+
+// Phases of a rotation of the cluster certificate, as requested to each node
+// by the node coordinating it.
+const (
+	// Save the new certificate and trust it, without using it yet.
+	clusterCertificateStage = "stage"
+
+	// Start using the new certificate, still trusting the old one.
+	clusterCertificateSwitch = "switch"
+
+	// Stop trusting the old certificate.
+	clusterCertificateCommit = "commit"
+
+	// Forget the new certificate, since not all nodes could stage it.
+	clusterCertificateAbort = "abort"
+)
+
+type internalClusterCertificatePostRequest struct {
+	Phase       string `json:"phase" yaml:"phase"`
+	Certificate string `json:"certificate" yaml:"certificate"`
+	Key         string `json:"key" yaml:"key"`
+}
+
+// Serializes the rotations coordinated by this node.
+var clusterCertificateLock sync.Mutex
+
+// The new certificate and key staged on this node during a rotation.
+var clusterCertificateStaged = struct {
+	mu   sync.Mutex
+	cert []byte
+	key  []byte
+}{}
+
+// Replace the certificate of the cluster on all nodes.
+func clusterCertificatePut(d *Daemon, r *http.Request) response.Response {
+	req := api.ClusterCertificatePut{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if !clustered {
+		return response.BadRequest(fmt.Errorf("This server is not clustered"))
+	}
+
+	caMode := shared.PathExists(filepath.Join(d.os.VarDir, "cluster.ca"))
+
+	if req.ClusterCertificate == "" && req.ClusterCertificateKey == "" {
+		// In CA mode only certificates signed by the CA are accepted, so
+		// we can't generate one ourselves.
+		if caMode {
+			return response.BadRequest(fmt.Errorf("A certificate signed by the cluster CA must be given"))
+		}
+
+		cert, key, err := shared.GenerateMemCert(false)
+		if err != nil {
+			return response.InternalError(err)
+		}
+
+		req.ClusterCertificate = string(cert)
+		req.ClusterCertificateKey = string(key)
+	}
+
+	_, err = tls.X509KeyPair([]byte(req.ClusterCertificate), []byte(req.ClusterCertificateKey))
+	if err != nil {
+		return response.BadRequest(errors.Wrap(err, "Invalid certificate or key"))
+	}
+
+	err = clusterCertificateRotate(d, req.ClusterCertificate, req.ClusterCertificateKey)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.EmptySyncResponse
+}
+
+// Apply one of the phases of a rotation coordinated by another node.
+func internalClusterCertificatePost(d *Daemon, r *http.Request) response.Response {
+	req := internalClusterCertificatePostRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	switch req.Phase {
+	case clusterCertificateStage:
+		err = clusterCertificateStageLocal([]byte(req.Certificate), []byte(req.Key))
+	case clusterCertificateSwitch:
+		err = clusterCertificateSwitchLocal(d)
+	case clusterCertificateCommit:
+		cluster.TLSUntrustCerts()
+	case clusterCertificateAbort:
+		clusterCertificateAbortLocal()
+	default:
+		return response.BadRequest(fmt.Errorf("Unknown phase %q", req.Phase))
+	}
+
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.EmptySyncResponse
+}
+
+// Rotate the cluster certificate, first distributing the new one to all nodes,
+// which start trusting it, then switching all of them to it, and finally
+// making them stop trusting the old one.
+//
+// All nodes must be online. If any of them fails to stage the new certificate,
+// the rotation is aborted on all nodes.
+func clusterCertificateRotate(d *Daemon, cert string, key string) error {
+	clusterCertificateLock.Lock()
+	defer clusterCertificateLock.Unlock()
+
+	notify := func(phase string) func(lxd.InstanceServer) error {
+		req := internalClusterCertificatePostRequest{Phase: phase}
+		if phase == clusterCertificateStage {
+			req.Certificate = cert
+			req.Key = key
+		}
+
+		return func(client lxd.InstanceServer) error {
+			_, _, err := client.RawQuery("POST", "/internal/cluster/certificate", req, "")
+			return err
+		}
+	}
+
+	// Distribute the new certificate.
+	err := clusterCertificateStageLocal([]byte(cert), []byte(key))
+	if err != nil {
+		return err
+	}
+
+	changes := []cluster.NotifyChange{{
+		Description: "stage the new cluster certificate",
+		Apply:       notify(clusterCertificateStage),
+		Revert:      notify(clusterCertificateAbort),
+	}}
+
+	_, err = cluster.NotifyBatch(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAll, changes)
+	if err != nil {
+		clusterCertificateAbortLocal()
+		return errors.Wrap(err, "Failed to distribute the new cluster certificate")
+	}
+
+	// Switch all nodes to the new certificate. This node switches last,
+	// since it connects to the other nodes using the old one.
+	notifier, err := cluster.NewNotifier(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAll)
+	if err != nil {
+		return err
+	}
+
+	switchErr := notifier(notify(clusterCertificateSwitch))
+
+	// Even if some nodes failed to switch, the others did and this node
+	// follows them. All nodes still trust both certificates, so they can
+	// keep talking to each other until the rotation is retried.
+	err = clusterCertificateSwitchLocal(d)
+	if err != nil {
+		return err
+	}
+
+	if switchErr != nil {
+		return errors.Wrap(switchErr, "Failed to switch all members to the new cluster certificate")
+	}
+
+	// Stop trusting the old certificate.
+	cluster.TLSUntrustCerts()
+
+	notifier, err = cluster.NewNotifier(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAlive)
+	if err != nil {
+		return err
+	}
+
+	err = notifier(notify(clusterCertificateCommit))
+	if err != nil {
+		// The old certificate stays trusted by the nodes which
+		// failed, but only until they restart.
+		logger.Warn("Failed to make all members stop trusting the old cluster certificate", log.Ctx{"err": err})
+	}
+
+	return nil
+}
+
+// Save the new certificate of a rotation and start trusting it.
+func clusterCertificateStageLocal(cert []byte, key []byte) error {
+	_, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return errors.Wrap(err, "Invalid certificate or key")
+	}
+
+	block, _ := pem.Decode(cert)
+	if block == nil {
+		return fmt.Errorf("Invalid certificate")
+	}
+
+	x509Cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "Invalid certificate")
+	}
+
+	clusterCertificateStaged.mu.Lock()
+	defer clusterCertificateStaged.mu.Unlock()
+
+	clusterCertificateStaged.cert = cert
+	clusterCertificateStaged.key = key
+	cluster.TLSTrustCert(x509Cert)
+
+	return nil
+}
+
+// Replace the cluster certificate with the staged one, and keep trusting the
+// old one until the rotation is committed.
+func clusterCertificateSwitchLocal(d *Daemon) error {
+	clusterCertificateStaged.mu.Lock()
+	defer clusterCertificateStaged.mu.Unlock()
+
+	if clusterCertificateStaged.cert == nil {
+		return fmt.Errorf("No new cluster certificate was staged")
+	}
+
+	old, err := x509.ParseCertificate(d.endpoints.NetworkCert().KeyPair().Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	// The cluster certificate and key of the bootstrap node might be
+	// symlinks to its server ones, which must be left untouched.
+	for _, suffix := range []string{"crt", "key"} {
+		path := filepath.Join(d.os.VarDir, "cluster."+suffix)
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = util.WriteCert(d.os.VarDir, "cluster", clusterCertificateStaged.cert, clusterCertificateStaged.key, nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to save the new cluster certificate")
+	}
+
+	cert, err := util.LoadCert(d.os.VarDir)
+	if err != nil {
+		return errors.Wrap(err, "Failed to load the new cluster certificate")
+	}
+
+	d.endpoints.NetworkUpdateCert(cert)
+	d.gateway.UpdateCert(cert)
+
+	cluster.TLSUntrustCerts()
+	cluster.TLSTrustCert(old)
+
+	clusterCertificateStaged.cert = nil
+	clusterCertificateStaged.key = nil
+
+	logger.Info("Switched to the new cluster certificate", log.Ctx{"fingerprint": cert.Fingerprint()})
+
+	return nil
+}
+
+// Forget the staged certificate of an aborted rotation.
+func clusterCertificateAbortLocal() {
+	clusterCertificateStaged.mu.Lock()
+	defer clusterCertificateStaged.mu.Unlock()
+
+	clusterCertificateStaged.cert = nil
+	clusterCertificateStaged.key = nil
+	cluster.TLSUntrustCerts()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/units"
+)
+
+var clusterRebalanceCmd = APIEndpoint{
+	Path: "cluster/rebalance",
+
+	Get:  APIEndpointAction{Handler: clusterRebalanceGet},
+	Post: APIEndpointAction{Handler: clusterRebalancePost},
+}
+
+// Number of moves suggested when no maximum is given.
+const clusterRebalanceMaxMoves = 10
+
+// Return the load of the cluster members and the instance moves suggested to
+// rebalance it.
+func clusterRebalanceGet(d *Daemon, r *http.Request) response.Response {
+	maxMoves := clusterRebalanceMaxMoves
+	if r.FormValue("max-moves") != "" {
+		var err error
+		maxMoves, err = strconv.Atoi(r.FormValue("max-moves"))
+		if err != nil || maxMoves < 0 {
+			return response.BadRequest(fmt.Errorf("Invalid maximum number of moves"))
+		}
+	}
+
+	members, instances, err := clusterRebalanceLoad(d)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	moves := cluster.RebalancePlan(members, instances, maxMoves)
+
+	return response.SyncResponse(true, clusterRebalanceRender(members, instances, moves))
+}
+
+// Move instances between cluster members, either as requested or as currently
+// suggested.
+func clusterRebalancePost(d *Daemon, r *http.Request) response.Response {
+	req := api.ClusterRebalancePost{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	if len(req.Moves) == 0 {
+		members, instances, err := clusterRebalanceLoad(d)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		moves := cluster.RebalancePlan(members, instances, clusterRebalanceMaxMoves)
+		req.Moves = clusterRebalanceRender(members, instances, moves).Moves
+	}
+
+	client, err := clusterRebalanceConnect(d)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	run := func(op *operations.Operation) error {
+		for _, move := range req.Moves {
+			err := clusterRebalanceMove(client, move)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to move instance %q of project %q to %q", move.Instance, move.Project, move.Target)
+			}
+		}
+
+		return nil
+	}
+
+	op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationClusterRebalance, nil, nil, run, nil, nil)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
+
+// Connect to this member, in order to use the regular instance APIs, which
+// take care of forwarding requests to the member running each instance.
+func clusterRebalanceConnect(d *Daemon) (lxd.InstanceServer, error) {
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return nil, err
+	}
+
+	if !clustered {
+		return nil, fmt.Errorf("This server is not clustered")
+	}
+
+	var address string
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		address, err = tx.NodeAddress()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get local node address")
+	}
+
+	return cluster.Connect(address, d.endpoints.NetworkCert(), false)
+}
+
+// Move the instance to the target member, making sure it's still on the
+// member it was planned to be moved from.
+func clusterRebalanceMove(client lxd.InstanceServer, move api.ClusterRebalanceMove) error {
+	client = client.UseProject(move.Project)
+
+	inst, _, err := client.GetInstance(move.Instance)
+	if err != nil {
+		return err
+	}
+
+	if inst.Location != move.Source {
+		return fmt.Errorf("Instance is now on %q", inst.Location)
+	}
+
+	op, err := client.UseTarget(move.Target).MigrateInstance(move.Instance, api.InstancePost{Name: move.Instance, Migration: true})
+	if err != nil {
+		return err
+	}
+
+	return op.Wait()
+}
+
+// Gather the capacity of the online cluster members which aren't in
+// maintenance, as well as the resources allocated to their instances.
+//
+// Instances without a CPU limit count as using one CPU thread, and instances
+// without a memory limit don't count towards memory. Only stopped containers
+// are movable, as moving instances between members requires them to be
+// stopped.
+func clusterRebalanceLoad(d *Daemon) ([]cluster.RebalanceMember, []cluster.RebalanceInstance, error) {
+	client, err := clusterRebalanceConnect(d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nodes []db.NodeInfo
+	var projects []string
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		nodes, err = tx.Nodes()
+		if err != nil {
+			return err
+		}
+
+		projects, err = tx.ProjectNames()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pools, err := d.cluster.StoragePools()
+	if err != nil && err != db.ErrNoSuchObject {
+		return nil, nil, err
+	}
+
+	status, err := cluster.List(d.State())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	online := map[string]bool{}
+	for _, member := range status {
+		online[member.ServerName] = member.Status == "Online"
+	}
+
+	cert := d.endpoints.NetworkCert()
+	members := []cluster.RebalanceMember{}
+	for _, node := range nodes {
+		if !online[node.Name] || node.Maintenance {
+			continue
+		}
+
+		nodeClient, err := cluster.Connect(node.Address, cert, false)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to connect to member %q", node.Name)
+		}
+
+		resources, err := nodeClient.GetServerResources()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to get resources of member %q", node.Name)
+		}
+
+		member := cluster.RebalanceMember{
+			Name:   node.Name,
+			CPU:    float64(resources.CPU.Total),
+			Memory: float64(resources.Memory.Total),
+		}
+
+		for _, pool := range pools {
+			poolResources, err := nodeClient.GetStoragePoolResources(pool)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "Failed to get resources of pool %q on member %q", pool, node.Name)
+			}
+
+			member.StorageUsed += float64(poolResources.Space.Used)
+			member.StorageTotal += float64(poolResources.Space.Total)
+		}
+
+		members = append(members, member)
+	}
+
+	memory := map[string]float64{}
+	for _, member := range members {
+		memory[member.Name] = member.Memory
+	}
+
+	instances := []cluster.RebalanceInstance{}
+	for _, project := range projects {
+		projectInstances, err := client.UseProject(project).GetInstances(api.InstanceTypeAny)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to get instances of project %q", project)
+		}
+
+		for _, inst := range projectInstances {
+			total, ok := memory[inst.Location]
+			if !ok {
+				continue
+			}
+
+			cpu, err := clusterRebalanceCPU(inst.ExpandedConfig["limits.cpu"])
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "Invalid CPU limit of instance %q of project %q", inst.Name, project)
+			}
+
+			mem, err := clusterRebalanceMemory(inst.ExpandedConfig["limits.memory"], total)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "Invalid memory limit of instance %q of project %q", inst.Name, project)
+			}
+
+			instances = append(instances, cluster.RebalanceInstance{
+				Project: project,
+				Name:    inst.Name,
+				Member:  inst.Location,
+				CPU:     cpu,
+				Memory:  mem,
+				Movable: inst.Type == "container" && inst.StatusCode == api.Stopped,
+			})
+		}
+	}
+
+	return members, instances, nil
+}
+
+// Return the number of CPU threads allocated by the given limits.cpu value.
+func clusterRebalanceCPU(limit string) (float64, error) {
+	if limit == "" {
+		return 1, nil
+	}
+
+	count, err := strconv.Atoi(limit)
+	if err == nil {
+		return float64(count), nil
+	}
+
+	cpus, err := parseCpuset(limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(len(cpus)), nil
+}
+
+// Return the bytes of memory allocated by the given limits.memory value, on a
+// member with the given total memory.
+func clusterRebalanceMemory(limit string, total float64) (float64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(limit, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(limit, "%"), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return total * percent / 100, nil
+	}
+
+	size, err := units.ParseByteSizeString(limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(size), nil
+}
+
+func clusterRebalanceRender(members []cluster.RebalanceMember, instances []cluster.RebalanceInstance, moves []cluster.RebalanceMove) api.ClusterRebalance {
+	rebalance := api.ClusterRebalance{
+		Members: []api.ClusterRebalanceMember{},
+		Moves:   []api.ClusterRebalanceMove{},
+	}
+
+	load := cluster.RebalanceLoad(members, instances)
+	for _, member := range members {
+		rebalance.Members = append(rebalance.Members, api.ClusterRebalanceMember{
+			ServerName: member.Name,
+			CPU:        load[member.Name][0],
+			Memory:     load[member.Name][1],
+			Storage:    load[member.Name][2],
+		})
+	}
+
+	for _, move := range moves {
+		rebalance.Moves = append(rebalance.Moves, api.ClusterRebalanceMove{
+			Project:  move.Project,
+			Instance: move.Name,
+			Source:   move.Source,
+			Target:   move.Target,
+		})
+	}
+
+	return rebalance
+}
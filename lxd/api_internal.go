@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"path/filepath"
 	"runtime"
 	runtimeDebug "runtime/debug"
+	runtimePprof "runtime/pprof"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -23,9 +26,12 @@ import (
 	"github.com/lxc/lxd/lxd/db/query"
 	deviceConfig "github.com/lxc/lxd/lxd/device/config"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/locking"
+	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/lxd/response"
 	driver "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	log "github.com/lxc/lxd/shared/log15"
@@ -41,12 +47,18 @@ var apiInternal = []APIEndpoint{
 	internalContainerOnStopCmd,
 	internalContainersCmd,
 	internalSQLCmd,
+	internalSQLTraceCmd,
 	internalClusterAcceptCmd,
+	internalClusterCertificateCmd,
 	internalClusterRebalanceCmd,
 	internalClusterPromoteCmd,
 	internalClusterContainerMovedCmd,
+	internalImagePreseedCmd,
+	internalStorageVolumeExportCmd,
 	internalGarbageCollectorCmd,
 	internalRAFTSnapshotCmd,
+	internalDebugCmd,
+	internalDebugPprofCmd,
 }
 
 var internalShutdownCmd = APIEndpoint{
@@ -86,6 +98,13 @@ var internalSQLCmd = APIEndpoint{
 	Post: APIEndpointAction{Handler: internalSQLPost},
 }
 
+var internalSQLTraceCmd = APIEndpoint{
+	Path: "sql/trace",
+
+	Get:    APIEndpointAction{Handler: internalSQLTraceGet},
+	Delete: APIEndpointAction{Handler: internalSQLTraceDelete},
+}
+
 var internalContainersCmd = APIEndpoint{
 	Path: "containers",
 
@@ -104,6 +123,18 @@ var internalRAFTSnapshotCmd = APIEndpoint{
 	Get: APIEndpointAction{Handler: internalRAFTSnapshot},
 }
 
+var internalDebugCmd = APIEndpoint{
+	Path: "debug",
+
+	Get: APIEndpointAction{Handler: internalDebugGet},
+}
+
+var internalDebugPprofCmd = APIEndpoint{
+	Path: "debug/pprof/{name}",
+
+	Get: APIEndpointAction{Handler: internalDebugPprof},
+}
+
 func internalWaitReady(d *Daemon, r *http.Request) response.Response {
 	select {
 	case <-d.readyChan:
@@ -156,6 +187,7 @@ func internalContainerOnStopNS(d *Daemon, r *http.Request) response.Response {
 		target = "unknown"
 	}
 	netns := queryParam(r, "netns")
+	userns := queryParam(r, "userns")
 
 	inst, err := instanceLoadById(d.State(), id)
 	if err != nil {
@@ -167,7 +199,7 @@ func internalContainerOnStopNS(d *Daemon, r *http.Request) response.Response {
 	}
 
 	c := inst.(container)
-	err = c.OnStopNS(target, netns)
+	err = c.OnStopNS(target, netns, userns)
 	if err != nil {
 		logger.Error("The stopns hook failed", log.Ctx{"container": c.Name(), "err": err})
 		return response.SmartError(err)
@@ -262,6 +294,18 @@ func internalSQLGet(d *Daemon, r *http.Request) response.Response {
 	return response.SyncResponse(true, internalSQLDump{Text: dump})
 }
 
+// Return the statistics gathered by the cluster database tracer.
+func internalSQLTraceGet(d *Daemon, r *http.Request) response.Response {
+	return response.SyncResponse(true, query.TraceGet())
+}
+
+// Reset the statistics gathered by the cluster database tracer.
+func internalSQLTraceDelete(d *Daemon, r *http.Request) response.Response {
+	query.TraceReset()
+
+	return response.EmptySyncResponse
+}
+
 // Execute queries.
 func internalSQLPost(d *Daemon, r *http.Request) response.Response {
 	req := &internalSQLQuery{}
@@ -488,6 +532,12 @@ func internalImport(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
+	// The additional disks of the container, which may be on other pools, must be usable here.
+	err = instanceDiskVolumesCheck(d.State(), projectName, backup.Container.Profiles, deviceConfig.NewDevices(backup.Container.Devices))
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	// Try to retrieve the storage pool the container supposedly lives on.
 	var poolErr error
 	poolID, pool, poolErr := d.cluster.StoragePoolGet(containerPoolName)
@@ -1078,3 +1128,85 @@ func internalRAFTSnapshot(d *Daemon, r *http.Request) response.Response {
 
 	return response.EmptySyncResponse
 }
+
+type internalDebugState struct {
+	Goroutines         int              `json:"goroutines" yaml:"goroutines"`
+	Profiles           []string         `json:"profiles" yaml:"profiles"`
+	Operations         []*api.Operation `json:"operations" yaml:"operations"`
+	StorageLocks       []locking.Info   `json:"storage_locks" yaml:"storage_locks"`
+	LegacyStorageLocks []string         `json:"legacy_storage_locks" yaml:"legacy_storage_locks"`
+	MountTasks         []string         `json:"mount_tasks" yaml:"mount_tasks"`
+}
+
+// Return what the daemon is busy with, to find out why it hangs: the operations that are still
+// running, the storage locks being held (such as the mount and unmount locks of volumes) and the
+// volumes mounted by running tasks.
+func internalDebugGet(d *Daemon, r *http.Request) response.Response {
+	info := internalDebugState{
+		Goroutines:   runtime.NumGoroutine(),
+		Profiles:     []string{"profile", "trace"},
+		Operations:   []*api.Operation{},
+		StorageLocks: locking.Locks(),
+		MountTasks:   storageDrivers.MountTasks(),
+	}
+
+	for _, profile := range runtimePprof.Profiles() {
+		info.Profiles = append(info.Profiles, profile.Name())
+	}
+
+	sort.Strings(info.Profiles)
+
+	operations.Lock()
+	localOps := operations.Operations()
+	operations.Unlock()
+
+	for _, op := range localOps {
+		if op.Status().IsFinal() {
+			continue
+		}
+
+		_, body, err := op.Render()
+		if err != nil {
+			return response.InternalError(err)
+		}
+
+		info.Operations = append(info.Operations, body)
+	}
+
+	lxdStorageMapLock.Lock()
+	info.LegacyStorageLocks = make([]string, 0, len(lxdStorageOngoingOperationMap))
+	for lockID := range lxdStorageOngoingOperationMap {
+		info.LegacyStorageLocks = append(info.LegacyStorageLocks, lockID)
+	}
+	lxdStorageMapLock.Unlock()
+
+	sort.Strings(info.LegacyStorageLocks)
+
+	return response.SyncResponse(true, info)
+}
+
+// Serve a pprof profile of the daemon. Besides the runtime profiles (such as goroutine, heap or
+// block), "profile" samples the CPU usage and "trace" records an execution trace, both for the
+// number of seconds passed in the "seconds" query parameter.
+func internalDebugPprof(d *Daemon, r *http.Request) response.Response {
+	name := mux.Vars(r)["name"]
+
+	var handler http.Handler
+	switch name {
+	case "profile":
+		handler = http.HandlerFunc(pprof.Profile)
+	case "trace":
+		handler = http.HandlerFunc(pprof.Trace)
+	default:
+		if runtimePprof.Lookup(name) == nil {
+			return response.NotFound(fmt.Errorf("Unknown profile %q", name))
+		}
+
+		handler = pprof.Handler(name)
+	}
+
+	return response.ManualResponse(func(w http.ResponseWriter) error {
+		handler.ServeHTTP(w, r)
+		return nil
+	})
+}
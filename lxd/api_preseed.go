@@ -0,0 +1,609 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+)
+
+var preseedCmd = APIEndpoint{
+	Path: "preseed",
+
+	Put: APIEndpointAction{Handler: preseedPut},
+}
+
+// Reconcile the server with the desired state passed in the request body.
+//
+// The body may be either YAML (as used by 'lxd init --preseed') or JSON.
+// Entities and keys which aren't mentioned are left untouched. When the
+// "dry-run" query parameter is set, the changes are computed and returned
+// without being applied.
+func preseedPut(d *Daemon, r *http.Request) response.Response {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	req := api.Preseed{}
+	err = yaml.Unmarshal(body, &req)
+	if err != nil {
+		return response.BadRequest(errors.Wrap(err, "Failed to parse preseed"))
+	}
+
+	dryRun := shared.IsTrue(queryParam(r, "dry-run"))
+
+	changes, revert, err := preseedApply(d, r, req, dryRun)
+	if err != nil {
+		if revert != nil {
+			revert()
+		}
+
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, api.PreseedResult{DryRun: dryRun, Changes: changes})
+}
+
+// Helper to reconcile the server with the given preseed.
+//
+// Existing entities get the listed keys merged into their configuration and
+// missing ones are created, through the same functions as the API handlers.
+// Profiles and networks are applied to their project. The list of changes is
+// returned, and in case of error the returned function can be used to revert
+// the changes.
+func preseedApply(d *Daemon, r *http.Request, config api.Preseed, dryRun bool) ([]api.PreseedChange, func(), error) {
+	changes := []api.PreseedChange{}
+
+	// Handle reverts
+	reverts := []func(){}
+	revert := func() {
+		// Lets undo things in reverse order
+		for i := len(reverts) - 1; i >= 0; i-- {
+			reverts[i]()
+		}
+	}
+
+	// Apply server configuration
+	if len(config.Config) > 0 {
+		currentConfig, err := daemonConfigRender(d.State())
+		if err != nil {
+			return nil, revert, errors.Wrap(err, "Failed to retrieve current server configuration")
+		}
+
+		newConfig := map[string]interface{}{}
+		current := map[string]string{}
+		for k, v := range currentConfig {
+			newConfig[k] = v
+			current[k] = fmt.Sprintf("%v", v)
+		}
+
+		desired := map[string]string{}
+		for k, v := range config.Config {
+			desired[k] = fmt.Sprintf("%v", v)
+			newConfig[k] = desired[k]
+		}
+
+		keys := preseedConfigChanges(current, desired)
+		if len(keys) > 0 {
+			changes = append(changes, api.PreseedChange{Entity: "server", Action: "update", Keys: keys})
+
+			if !dryRun {
+				err = preseedResponseError(doApi10Update(d, api.ServerPut{Config: newConfig}, false))
+				if err != nil {
+					return nil, revert, errors.Wrap(err, "Failed to update server configuration")
+				}
+
+				reverts = append(reverts, func() {
+					doApi10Update(d, api.ServerPut{Config: currentConfig}, false)
+				})
+			}
+		}
+	}
+
+	// Apply project configuration
+	var projectNames []string
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+		projectNames, err = tx.ProjectNames()
+		return err
+	})
+	if err != nil {
+		return nil, revert, errors.Wrap(err, "Failed to retrieve list of projects")
+	}
+
+	// Projects created by a dry run don't exist yet, and nor does anything in them.
+	newProjectNames := []string{}
+
+	for _, project := range config.Projects {
+		// New project
+		if !shared.StringInSlice(project.Name, projectNames) {
+			changes = append(changes, api.PreseedChange{Entity: "project", Name: project.Name, Action: "create", Keys: preseedConfigChanges(nil, project.Config)})
+			if dryRun {
+				newProjectNames = append(newProjectNames, project.Name)
+				continue
+			}
+
+			err := preseedResponseError(doProjectsPost(d, project))
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to create project '%s'", project.Name)
+			}
+
+			name := project.Name
+			reverts = append(reverts, func() {
+				doProjectDelete(d, name)
+			})
+
+			continue
+		}
+
+		// Existing project
+		var currentProject *api.Project
+		err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+			var err error
+			currentProject, err = tx.ProjectGet(project.Name)
+			return err
+		})
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to retrieve current project '%s'", project.Name)
+		}
+
+		newProject := api.ProjectPut{}
+		err = shared.DeepCopy(currentProject.Writable(), &newProject)
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to copy configuration of project '%s'", project.Name)
+		}
+
+		keys := preseedConfigChanges(currentProject.Config, project.Config)
+		if project.Description != "" && project.Description != currentProject.Description {
+			newProject.Description = project.Description
+			keys = append(keys, "description")
+		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		changes = append(changes, api.PreseedChange{Entity: "project", Name: project.Name, Action: "update", Keys: keys})
+		if dryRun {
+			continue
+		}
+
+		if newProject.Config == nil {
+			newProject.Config = map[string]string{}
+		}
+
+		for k, v := range project.Config {
+			newProject.Config[k] = v
+		}
+
+		err = preseedResponseError(projectChange(d, currentProject, newProject))
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to update project '%s'", project.Name)
+		}
+
+		reverts = append(reverts, func() {
+			var project *api.Project
+			err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+				var err error
+				project, err = tx.ProjectGet(currentProject.Name)
+				return err
+			})
+			if err != nil {
+				return
+			}
+
+			projectChange(d, project, currentProject.Writable())
+		})
+	}
+
+	// Returns whether the given project exists, or will once the preseed is applied.
+	projectExists := func(project string) bool {
+		return shared.StringInSlice(project, projectNames) || shared.StringInSlice(project, newProjectNames)
+	}
+
+	// Apply network configuration
+	if len(config.Networks) > 0 {
+		networkNames, err := d.cluster.Networks()
+		if err != nil {
+			return nil, revert, errors.Wrap(err, "Failed to retrieve list of networks")
+		}
+
+		for _, network := range config.Networks {
+			// Networks are shared by all projects.
+			if network.Project != "" && !projectExists(network.Project) {
+				return nil, revert, fmt.Errorf("Project '%s' of network '%s' not found", network.Project, network.Name)
+			}
+
+			// New network
+			if !shared.StringInSlice(network.Name, networkNames) {
+				changes = append(changes, api.PreseedChange{Entity: "network", Name: network.Name, Action: "create", Keys: preseedConfigChanges(nil, network.Config)})
+				if dryRun {
+					continue
+				}
+
+				err := preseedResponseError(doNetworksPost(d, network.NetworksPost, "", false))
+				if err != nil {
+					return nil, revert, errors.Wrapf(err, "Failed to create network '%s'", network.Name)
+				}
+
+				name := network.Name
+				reverts = append(reverts, func() {
+					doNetworkDelete(d, name, false)
+				})
+
+				continue
+			}
+
+			// Existing network
+			currentNetwork, err := preseedNetworkGet(d, network.Name)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to retrieve current network '%s'", network.Name)
+			}
+
+			newNetwork := api.NetworkPut{}
+			err = shared.DeepCopy(currentNetwork.Writable(), &newNetwork)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to copy configuration of network '%s'", network.Name)
+			}
+
+			keys := preseedConfigChanges(currentNetwork.Config, network.Config)
+			if network.Description != "" && network.Description != currentNetwork.Description {
+				newNetwork.Description = network.Description
+				keys = append(keys, "description")
+			}
+
+			if len(keys) == 0 {
+				continue
+			}
+
+			changes = append(changes, api.PreseedChange{Entity: "network", Name: network.Name, Action: "update", Keys: keys})
+			if dryRun {
+				continue
+			}
+
+			for k, v := range network.Config {
+				newNetwork.Config[k] = v
+			}
+
+			err = preseedNetworkUpdate(d, currentNetwork.Name, newNetwork)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to update network '%s'", network.Name)
+			}
+
+			reverts = append(reverts, func() {
+				preseedNetworkUpdate(d, currentNetwork.Name, currentNetwork.Writable())
+			})
+		}
+	}
+
+	// Apply storage configuration
+	if len(config.StoragePools) > 0 {
+		storagePoolNames, err := d.cluster.StoragePools()
+		if err != nil && err != db.ErrNoSuchObject {
+			return nil, revert, errors.Wrap(err, "Failed to retrieve list of storage pools")
+		}
+
+		for _, storagePool := range config.StoragePools {
+			// New storage pool
+			if !shared.StringInSlice(storagePool.Name, storagePoolNames) {
+				changes = append(changes, api.PreseedChange{Entity: "storage_pool", Name: storagePool.Name, Action: "create", Keys: preseedConfigChanges(nil, storagePool.Config)})
+				if dryRun {
+					continue
+				}
+
+				err := preseedResponseError(doStoragePoolsPost(d, storagePool, "", false))
+				if err != nil {
+					return nil, revert, errors.Wrapf(err, "Failed to create storage pool '%s'", storagePool.Name)
+				}
+
+				name := storagePool.Name
+				reverts = append(reverts, func() {
+					doStoragePoolDelete(d, name, false)
+				})
+
+				continue
+			}
+
+			// Existing storage pool
+			currentStoragePool, err := preseedStoragePoolGet(d, storagePool.Name)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to retrieve current storage pool '%s'", storagePool.Name)
+			}
+
+			// Sanity check
+			if currentStoragePool.Driver != storagePool.Driver {
+				return nil, revert, fmt.Errorf("Storage pool '%s' is of type '%s' instead of '%s'", currentStoragePool.Name, currentStoragePool.Driver, storagePool.Driver)
+			}
+
+			newStoragePool := api.StoragePoolPut{}
+			err = shared.DeepCopy(currentStoragePool.Writable(), &newStoragePool)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to copy configuration of storage pool '%s'", storagePool.Name)
+			}
+
+			keys := preseedConfigChanges(currentStoragePool.Config, storagePool.Config)
+			if storagePool.Description != "" && storagePool.Description != currentStoragePool.Description {
+				newStoragePool.Description = storagePool.Description
+				keys = append(keys, "description")
+			}
+
+			if len(keys) == 0 {
+				continue
+			}
+
+			changes = append(changes, api.PreseedChange{Entity: "storage_pool", Name: storagePool.Name, Action: "update", Keys: keys})
+			if dryRun {
+				continue
+			}
+
+			for k, v := range storagePool.Config {
+				newStoragePool.Config[k] = v
+			}
+
+			err = preseedStoragePoolUpdate(d, currentStoragePool.Name, newStoragePool)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to update storage pool '%s'", storagePool.Name)
+			}
+
+			reverts = append(reverts, func() {
+				preseedStoragePoolUpdate(d, currentStoragePool.Name, currentStoragePool.Writable())
+			})
+		}
+	}
+
+	// Apply profile configuration
+	for _, profile := range config.Profiles {
+		project := profile.Project
+		if project == "" {
+			project = "default"
+		}
+
+		if !projectExists(project) {
+			return nil, revert, fmt.Errorf("Project '%s' of profile '%s' not found", project, profile.Name)
+		}
+
+		profileNames := []string{}
+		if !shared.StringInSlice(project, newProjectNames) {
+			profileNames, err = d.cluster.Profiles(project)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to retrieve list of profiles of project '%s'", project)
+			}
+		}
+
+		// New profile
+		if !shared.StringInSlice(profile.Name, profileNames) {
+			keys := preseedConfigChanges(nil, profile.Config)
+			for name := range profile.Devices {
+				keys = append(keys, fmt.Sprintf("devices.%s", name))
+			}
+
+			changes = append(changes, api.PreseedChange{Entity: "profile", Name: profile.Name, Action: "create", Keys: keys})
+			if dryRun {
+				continue
+			}
+
+			resp := storagePoolVolumeAttachCheck(d, r, nil, profile.Devices)
+			if resp == nil {
+				resp = doProfilesPost(d, project, profile.ProfilesPost)
+			}
+
+			err := preseedResponseError(resp)
+			if err != nil {
+				return nil, revert, errors.Wrapf(err, "Failed to create profile '%s'", profile.Name)
+			}
+
+			name := profile.Name
+			reverts = append(reverts, func() {
+				doProfileDelete(d, project, name)
+			})
+
+			continue
+		}
+
+		// Existing profile, in the project holding it.
+		project, err = profileProject(d, project, profile.Name)
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to retrieve current profile '%s'", profile.Name)
+		}
+
+		id, currentProfile, err := d.cluster.ProfileGet(project, profile.Name)
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to retrieve current profile '%s'", profile.Name)
+		}
+
+		newProfile := api.ProfilePut{}
+		err = shared.DeepCopy(currentProfile.Writable(), &newProfile)
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to copy configuration of profile '%s'", profile.Name)
+		}
+
+		keys := preseedConfigChanges(currentProfile.Config, profile.Config)
+		if profile.Description != "" && profile.Description != currentProfile.Description {
+			newProfile.Description = profile.Description
+			keys = append(keys, "description")
+		}
+
+		for name, device := range profile.Devices {
+			for _, k := range preseedConfigChanges(currentProfile.Devices[name], device) {
+				keys = append(keys, fmt.Sprintf("devices.%s.%s", name, k))
+			}
+		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		changes = append(changes, api.PreseedChange{Entity: "profile", Name: profile.Name, Action: "update", Keys: keys})
+		if dryRun {
+			continue
+		}
+
+		for k, v := range profile.Config {
+			newProfile.Config[k] = v
+		}
+
+		for name, device := range profile.Devices {
+			// New device
+			_, ok := newProfile.Devices[name]
+			if !ok {
+				newProfile.Devices[name] = device
+				continue
+			}
+
+			// Existing device
+			for k, v := range device {
+				newProfile.Devices[name][k] = v
+			}
+		}
+
+		resp := storagePoolVolumeAttachCheck(d, r, currentProfile.Devices, newProfile.Devices)
+		err = preseedResponseError(resp)
+		if err == nil {
+			err = preseedProfileUpdate(d, project, currentProfile.Name, id, currentProfile, newProfile)
+		}
+
+		if err != nil {
+			return nil, revert, errors.Wrapf(err, "Failed to update profile '%s'", profile.Name)
+		}
+
+		reverts = append(reverts, func() {
+			id, profile, err := d.cluster.ProfileGet(project, currentProfile.Name)
+			if err != nil {
+				return
+			}
+
+			preseedProfileUpdate(d, project, currentProfile.Name, id, profile, currentProfile.Writable())
+		})
+	}
+
+	return changes, nil, nil
+}
+
+// Returns the error of an error response of the functions shared with the API handlers, with its
+// status code, or nil for any other response.
+func preseedResponseError(resp response.Response) error {
+	code := response.ErrorCode(resp)
+	if code == 0 {
+		return nil
+	}
+
+	return api.StatusErrorf(code, "%s", resp.String())
+}
+
+// Returns a network as reported by the API, without its node-specific keys when clustered.
+func preseedNetworkGet(d *Daemon, name string) (*api.Network, error) {
+	_, network, err := d.cluster.NetworkGet(name)
+	if err != nil {
+		return nil, err
+	}
+
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return nil, err
+	}
+
+	if clustered {
+		for _, key := range db.NetworkNodeConfigKeys {
+			delete(network.Config, key)
+		}
+	}
+
+	return network, nil
+}
+
+// Updates a network like a PUT request on it.
+func preseedNetworkUpdate(d *Daemon, name string, req api.NetworkPut) error {
+	// Serialize with other updates of the same network until done.
+	unlock := etagLock("network", "", name)
+	defer unlock()
+
+	_, network, err := d.cluster.NetworkGet(name)
+	if err != nil {
+		return err
+	}
+
+	return preseedResponseError(doNetworkUpdate(d, name, network.Config, req))
+}
+
+// Returns a storage pool as reported by the API, without its node-specific keys when clustered.
+func preseedStoragePoolGet(d *Daemon, name string) (*api.StoragePool, error) {
+	_, pool, err := d.cluster.StoragePoolGet(name)
+	if err != nil {
+		return nil, err
+	}
+
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return nil, err
+	}
+
+	if clustered {
+		pool.Config = storagePoolClusterConfigForEtag(pool.Config)
+	}
+
+	return pool, nil
+}
+
+// Updates a storage pool like a PUT request on it.
+func preseedStoragePoolUpdate(d *Daemon, name string, req api.StoragePoolPut) error {
+	// Serialize with other updates of the same pool until done.
+	unlock := etagLock("storage-pool", "", name)
+	defer unlock()
+
+	_, pool, err := d.cluster.StoragePoolGet(name)
+	if err != nil {
+		return err
+	}
+
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return err
+	}
+
+	if clustered {
+		err := storagePoolValidateClusterConfig(req.Config)
+		if err != nil {
+			return api.StatusErrorf(http.StatusBadRequest, "%v", err)
+		}
+	}
+
+	return preseedResponseError(doStoragePoolUpdate(d, name, pool, req, clustered, "", false))
+}
+
+// Updates a profile of the given project like a PUT request on it, the project being the one
+// holding the profile.
+func preseedProfileUpdate(d *Daemon, project, name string, id int64, profile *api.Profile, req api.ProfilePut) error {
+	err := doProfileUpdate(d, project, name, id, profile, req)
+	if err != nil {
+		return err
+	}
+
+	return profileUpdateNotify(d, project, name, profile.ProfilePut)
+}
+
+// Returns the sorted list of keys of desired whose value differs from current.
+func preseedConfigChanges(current map[string]string, desired map[string]string) []string {
+	keys := []string{}
+	for k, v := range desired {
+		currentValue, ok := current[k]
+		if ok && currentValue == v {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
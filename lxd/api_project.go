@@ -17,6 +17,7 @@ import (
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/units"
 	"github.com/lxc/lxd/shared/version"
 )
 
@@ -37,6 +38,12 @@ var projectCmd = APIEndpoint{
 	Put:    APIEndpointAction{Handler: projectPut, AccessHandler: AllowAuthenticated},
 }
 
+var projectExportCmd = APIEndpoint{
+	Path: "projects/{name}/export",
+
+	Get: APIEndpointAction{Handler: projectExportGet},
+}
+
 func projectsGet(d *Daemon, r *http.Request) response.Response {
 	recursion := util.IsRecursionRequest(r)
 
@@ -89,9 +96,24 @@ func projectsGet(d *Daemon, r *http.Request) response.Response {
 }
 
 func projectsPost(d *Daemon, r *http.Request) response.Response {
+	// If we're getting binary content, process separately
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		return projectImport(d, r.Body, r.Header.Get("X-LXD-name"), r.Header.Get("X-LXD-pool"))
+	}
+
 	// Parse the request
 	project := api.ProjectsPost{}
 
+	err := json.NewDecoder(r.Body).Decode(&project)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	return doProjectsPost(d, project)
+}
+
+// Validate and create a project, with the features it doesn't set enabled.
+func doProjectsPost(d *Daemon, project api.ProjectsPost) response.Response {
 	// Set default features
 	if project.Config == nil {
 		project.Config = map[string]string{}
@@ -103,36 +125,56 @@ func projectsPost(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&project)
+	// Sanity checks
+	err := projectValidateName(project.Name)
 	if err != nil {
 		return response.BadRequest(err)
 	}
 
-	// Sanity checks
-	if project.Name == "" {
-		return response.BadRequest(fmt.Errorf("No name provided"))
+	// Validate the configuration
+	err = projectValidateConfig(project.Config)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = projectValidateDefaults(d.cluster, project.Config)
+	if err != nil {
+		return response.BadRequest(err)
 	}
 
-	if strings.Contains(project.Name, "/") {
-		return response.BadRequest(fmt.Errorf("Project names may not contain slashes"))
+	err = doProjectCreate(d, project)
+	if err != nil {
+		return response.SmartError(err)
 	}
 
-	if project.Name == "*" {
-		return response.BadRequest(fmt.Errorf("Reserved project name"))
+	return response.SyncResponseLocation(true, nil, fmt.Sprintf("/%s/projects/%s", version.APIVersion, project.Name))
+}
+
+func projectValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("No name provided")
 	}
 
-	if shared.StringInSlice(project.Name, []string{".", ".."}) {
-		return response.BadRequest(fmt.Errorf("Invalid project name '%s'", project.Name))
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("Project names may not contain slashes")
 	}
 
-	// Validate the configuration
-	err = projectValidateConfig(project.Config)
-	if err != nil {
-		return response.BadRequest(err)
+	if name == "*" {
+		return fmt.Errorf("Reserved project name")
 	}
 
+	if shared.StringInSlice(name, []string{".", ".."}) {
+		return fmt.Errorf("Invalid project name '%s'", name)
+	}
+
+	return nil
+}
+
+// Add a validated project to the database, along with its default profile.
+func doProjectCreate(d *Daemon, project api.ProjectsPost) error {
 	var id int64
-	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
 		id, err = tx.ProjectCreate(project)
 		if err != nil {
 			return errors.Wrap(err, "Add project to database")
@@ -148,17 +190,17 @@ func projectsPost(d *Daemon, r *http.Request) response.Response {
 		return nil
 	})
 	if err != nil {
-		return response.SmartError(fmt.Errorf("Error inserting %s into database: %s", project.Name, err))
+		return fmt.Errorf("Error inserting %s into database: %s", project.Name, err)
 	}
 
 	if d.rbac != nil {
 		err = d.rbac.AddProject(id, project.Name)
 		if err != nil {
-			return response.SmartError(err)
+			return err
 		}
 	}
 
-	return response.SyncResponseLocation(true, nil, fmt.Sprintf("/%s/projects/%s", version.APIVersion, project.Name))
+	return nil
 }
 
 // Create the default profile of a project.
@@ -332,6 +374,11 @@ func projectChange(d *Daemon, project *api.Project, req api.ProjectPut) response
 		return response.BadRequest(err)
 	}
 
+	err = projectValidateDefaults(d.cluster, req.Config)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	// Update the database entry
 	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
 		err := tx.ProjectUpdate(project.Name, req)
@@ -435,6 +482,11 @@ func projectPost(d *Daemon, r *http.Request) response.Response {
 func projectDelete(d *Daemon, r *http.Request) response.Response {
 	name := mux.Vars(r)["name"]
 
+	return doProjectDelete(d, name)
+}
+
+// Delete an empty project.
+func doProjectDelete(d *Daemon, name string) response.Response {
 	// Sanity checks
 	if name == "default" {
 		return response.Forbidden(fmt.Errorf("The 'default' project cannot be deleted"))
@@ -486,8 +538,18 @@ func projectIsEmpty(project *api.Project) bool {
 
 // Validate the project configuration
 var projectConfigKeys = map[string]func(value string) error{
-	"features.profiles": shared.IsBool,
-	"features.images":   shared.IsBool,
+	"features.profiles":    shared.IsBool,
+	"features.images":      shared.IsBool,
+	"default.storage.pool": shared.IsAny,
+	"default.network":      shared.IsAny,
+	"limits.disk.snapshots": func(value string) error {
+		if value == "" {
+			return nil
+		}
+
+		_, err := units.ParseByteSizeString(value)
+		return err
+	},
 }
 
 func projectValidateConfig(config map[string]string) error {
@@ -513,3 +575,50 @@ func projectValidateConfig(config map[string]string) error {
 
 	return nil
 }
+
+// Check that the storage pool and network used as defaults by the project exist.
+func projectValidateDefaults(cluster *db.Cluster, config map[string]string) error {
+	if config["default.storage.pool"] != "" {
+		_, err := cluster.StoragePoolGetID(config["default.storage.pool"])
+		if err != nil {
+			if err == db.ErrNoSuchObject {
+				return fmt.Errorf("Default storage pool '%s' doesn't exist", config["default.storage.pool"])
+			}
+
+			return err
+		}
+	}
+
+	if config["default.network"] != "" {
+		_, _, err := cluster.NetworkGet(config["default.network"])
+		if err != nil {
+			if err == db.ErrNoSuchObject {
+				return fmt.Errorf("Default network '%s' doesn't exist", config["default.network"])
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// projectConfig returns the configuration of the given project.
+func projectConfig(cluster *db.Cluster, name string) (map[string]string, error) {
+	var config map[string]string
+
+	err := cluster.Transaction(func(tx *db.ClusterTx) error {
+		project, err := tx.ProjectGet(name)
+		if err != nil {
+			return err
+		}
+
+		config = project.Config
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
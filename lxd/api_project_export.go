@@ -0,0 +1,705 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/lxc/lxd/lxd/backup"
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/project"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// The manifest of a project export, describing everything the export holds. It's the first
+// entry of the export, followed by an archive per custom volume and per instance.
+type projectExportManifest struct {
+	Project   api.ProjectsPost      `yaml:"project"`
+	Profiles  []api.ProfilesPost    `yaml:"profiles"`
+	Networks  []api.NetworksPost    `yaml:"networks"`
+	Volumes   []projectExportVolume `yaml:"volumes"`
+	Instances []string              `yaml:"instances"`
+}
+
+// A custom storage volume used by the instances or profiles of an exported project.
+type projectExportVolume struct {
+	Pool        string            `yaml:"pool"`
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Config      map[string]string `yaml:"config"`
+}
+
+func (v projectExportVolume) archiveName() string {
+	return fmt.Sprintf("volumes/%s/%s.tar", v.Pool, v.Name)
+}
+
+func projectExportInstanceArchiveName(name string) string {
+	return fmt.Sprintf("instances/%s.tar", name)
+}
+
+// /1.0/projects/{name}/export
+// Stream an export of the whole project.
+func projectExportGet(d *Daemon, r *http.Request) response.Response {
+	name := mux.Vars(r)["name"]
+
+	manifest, instances, err := projectExportPrepare(d, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return &projectExportServe{req: r, d: d, manifest: manifest, instances: instances}
+}
+
+// projectExportPrepare builds the manifest of the project export and loads the instances to
+// export, which must all be on the local cluster member.
+func projectExportPrepare(d *Daemon, name string) (*projectExportManifest, []Instance, error) {
+	manifest := &projectExportManifest{
+		Profiles:  []api.ProfilesPost{},
+		Networks:  []api.NetworksPost{},
+		Volumes:   []projectExportVolume{},
+		Instances: []string{},
+	}
+
+	var serverName string
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		p, err := tx.ProjectGet(name)
+		if err != nil {
+			return err
+		}
+
+		manifest.Project = api.ProjectsPost{Name: p.Name, ProjectPut: p.Writable()}
+
+		if p.Config["features.profiles"] == "true" {
+			profiles, err := tx.ProfileList(db.ProfileFilter{Project: name})
+			if err != nil {
+				return err
+			}
+
+			for _, profile := range profiles {
+				manifest.Profiles = append(manifest.Profiles, api.ProfilesPost{
+					Name:       profile.Name,
+					ProfilePut: db.ProfileToAPI(&profile).Writable(),
+				})
+			}
+		}
+
+		serverName, err = tx.NodeName()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all, err := instanceLoadByProject(d.State(), name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	instances := []Instance{}
+	devices := []map[string]string{}
+	for _, inst := range all {
+		if inst.IsSnapshot() {
+			continue
+		}
+
+		if inst.Location() != serverName {
+			return nil, nil, fmt.Errorf("Instance '%s' is on cluster member '%s', projects can only be exported from the member holding all their instances", inst.Name(), inst.Location())
+		}
+
+		instances = append(instances, inst)
+		manifest.Instances = append(manifest.Instances, inst.Name())
+
+		for _, dev := range inst.ExpandedDevices().CloneNative() {
+			devices = append(devices, dev)
+		}
+	}
+
+	for _, profile := range manifest.Profiles {
+		for _, dev := range profile.Devices {
+			devices = append(devices, dev)
+		}
+	}
+
+	// Record the networks and custom volumes the instances and profiles use.
+	for _, dev := range devices {
+		switch dev["type"] {
+		case "nic":
+			if dev["parent"] == "" || projectExportHasNetwork(manifest, dev["parent"]) {
+				continue
+			}
+
+			_, network, err := d.cluster.NetworkGet(dev["parent"])
+			if err == db.ErrNoSuchObject {
+				// Not a managed network.
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+
+			config := map[string]string{}
+			for k, v := range network.Config {
+				if shared.StringInSlice(k, db.NetworkNodeConfigKeys) {
+					continue
+				}
+
+				config[k] = v
+			}
+
+			manifest.Networks = append(manifest.Networks, api.NetworksPost{
+				Name:       network.Name,
+				Type:       network.Type,
+				NetworkPut: api.NetworkPut{Description: network.Description, Config: config},
+			})
+		case "disk":
+			if dev["pool"] == "" || dev["source"] == "" || dev["path"] == "/" || projectExportHasVolume(manifest, dev["pool"], dev["source"]) {
+				continue
+			}
+
+			poolID, err := d.cluster.StoragePoolGetID(dev["pool"])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			_, vol, err := d.cluster.StoragePoolNodeVolumeGetType(dev["source"], storagePoolVolumeTypeCustom, poolID)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "Failed to load storage volume '%s' of pool '%s'", dev["source"], dev["pool"])
+			}
+
+			manifest.Volumes = append(manifest.Volumes, projectExportVolume{
+				Pool:        dev["pool"],
+				Name:        vol.Name,
+				Description: vol.Description,
+				Config:      vol.Config,
+			})
+		}
+	}
+
+	return manifest, instances, nil
+}
+
+func projectExportHasNetwork(manifest *projectExportManifest, name string) bool {
+	for _, network := range manifest.Networks {
+		if network.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func projectExportHasVolume(manifest *projectExportManifest, pool string, name string) bool {
+	for _, vol := range manifest.Volumes {
+		if vol.Pool == pool && vol.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// projectVolumeMount mounts a custom volume, going through the new storage layer when its pool
+// driver supports it. The returned function unmounts the volume if it was mounted here.
+func projectVolumeMount(s *state.State, poolName string, volName string) (func(), error) {
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != storageDrivers.ErrUnknownDriver {
+		if err != nil {
+			return nil, err
+		}
+
+		ourMount, err := pool.MountCustomVolume(volName, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return func() {
+			if ourMount {
+				pool.UnmountCustomVolume(volName, nil)
+			}
+		}, nil
+	}
+
+	st, err := storagePoolVolumeInit(s, "default", poolName, volName, storagePoolVolumeTypeCustom)
+	if err != nil {
+		return nil, err
+	}
+
+	ourMount, err := st.StoragePoolVolumeMount()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if ourMount {
+			st.StoragePoolVolumeUmount()
+		}
+	}, nil
+}
+
+// projectExportServe streams a project export as a tarball holding the manifest, followed by an
+// archive of each custom volume and a backup of each instance.
+type projectExportServe struct {
+	req       *http.Request
+	d         *Daemon
+	manifest  *projectExportManifest
+	instances []Instance
+}
+
+func (r *projectExportServe) String() string {
+	return "project export"
+}
+
+func (r *projectExportServe) Render(w http.ResponseWriter) error {
+	s := r.d.State()
+	name := r.manifest.Project.Name
+
+	// Create the archives, working on multiple volumes of each pool at once when configured to.
+	archives := map[string]string{}
+	backups := []string{}
+	tasks := []storageVolumeTask{}
+
+	defer func() {
+		for _, path := range archives {
+			os.Remove(path)
+		}
+
+		for _, backupName := range backups {
+			b, err := backup.LoadByName(s, name, backupName)
+			if err == nil {
+				b.Delete()
+			}
+		}
+	}()
+
+	for _, vol := range r.manifest.Volumes {
+		f, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_project_export_")
+		if err != nil {
+			return response.InternalError(err).Render(w)
+		}
+		f.Close()
+
+		vol := vol
+		path := f.Name()
+		archives[vol.archiveName()] = path
+
+		tasks = append(tasks, storageVolumeTask{pool: vol.Pool, run: func() error {
+			unmount, err := projectVolumeMount(s, vol.Pool, vol.Name)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to mount storage volume '%s'", vol.Name)
+			}
+			defer unmount()
+
+			mountPoint := storagePools.GetStoragePoolVolumeMountPoint(vol.Pool, vol.Name)
+			_, err = shared.RunCommand("tar", "-cf", path, "--numeric-owner", "--xattrs", "-C", mountPoint, ".")
+			return err
+		}})
+	}
+
+	suffix := fmt.Sprintf("export%d", time.Now().Unix())
+	for _, inst := range r.instances {
+		inst := inst
+
+		poolName, err := inst.StoragePool()
+		if err != nil {
+			return response.SmartError(err).Render(w)
+		}
+
+		// Exported backups expire, so that they get cleaned up if the export is interrupted.
+		args := db.InstanceBackupArgs{
+			Name:         inst.Name() + shared.SnapshotDelimiter + suffix,
+			InstanceID:   inst.ID(),
+			CreationDate: time.Now(),
+			ExpiryDate:   time.Now().Add(24 * time.Hour),
+		}
+
+		archives[projectExportInstanceArchiveName(inst.Name())] = shared.VarPath("backups", project.Prefix(name, args.Name))
+		backups = append(backups, args.Name)
+
+		tasks = append(tasks, storageVolumeTask{pool: poolName, run: func() error {
+			err := backupCreate(s, args, inst, nil)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to back up instance '%s'", inst.Name())
+			}
+
+			return nil
+		}})
+	}
+
+	errs := storageVolumeTasksRun(r.req.Context(), s, tasks)
+	if len(errs) > 0 {
+		return response.SmartError(errs[0]).Render(w)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar", name))
+	w.WriteHeader(http.StatusOK)
+
+	tw := tar.NewWriter(w)
+
+	data, err := yaml.Marshal(r.manifest)
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{Name: "manifest.yaml", Mode: 0600, Size: int64(len(data)), ModTime: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	if err != nil {
+		return err
+	}
+
+	// Volumes come first, as the instances may use them.
+	entries := []string{}
+	for _, vol := range r.manifest.Volumes {
+		entries = append(entries, vol.archiveName())
+	}
+
+	for _, inst := range r.manifest.Instances {
+		entries = append(entries, projectExportInstanceArchiveName(inst))
+	}
+
+	for _, entry := range entries {
+		err := projectExportWriteFile(tw, entry, archives[entry])
+		if err != nil {
+			return err
+		}
+
+		os.Remove(archives[entry])
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Exported project", log.Ctx{"project": name, "instances": len(r.manifest.Instances), "volumes": len(r.manifest.Volumes)})
+
+	return nil
+}
+
+// Add a file to the export tarball.
+func projectExportWriteFile(tw *tar.Writer, name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: fi.Size(), ModTime: fi.ModTime()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// projectImport imports a project export into a new project, optionally renaming it and
+// overriding the storage pool of its instances.
+func projectImport(d *Daemon, data io.Reader, name string, pool string) response.Response {
+	// Write the data to a temp file
+	f, err := ioutil.TempFile("", "lxd_project_import_")
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	_, err = io.Copy(f, data)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return response.InternalError(err)
+	}
+
+	// Parse the manifest
+	f.Seek(0, 0)
+	tr := tar.NewReader(f)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "manifest.yaml" {
+		f.Close()
+		os.Remove(f.Name())
+		return response.BadRequest(fmt.Errorf("Invalid project export, it must start with its manifest"))
+	}
+
+	manifest := projectExportManifest{}
+	buf, err := ioutil.ReadAll(tr)
+	if err == nil {
+		err = yaml.Unmarshal(buf, &manifest)
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return response.BadRequest(errors.Wrap(err, "Invalid project export manifest"))
+	}
+
+	if name != "" {
+		manifest.Project.Name = name
+	}
+
+	if manifest.Project.Config == nil {
+		manifest.Project.Config = map[string]string{}
+	}
+
+	if pool != "" && manifest.Project.Config["default.storage.pool"] != "" {
+		manifest.Project.Config["default.storage.pool"] = pool
+	}
+
+	err = projectValidateName(manifest.Project.Name)
+	if err == nil {
+		err = projectValidateConfig(manifest.Project.Config)
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return response.BadRequest(err)
+	}
+
+	run := func(op *operations.Operation) error {
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		return projectImportRun(d, &manifest, tr, pool)
+	}
+
+	resources := map[string][]string{}
+	resources["projects"] = []string{manifest.Project.Name}
+
+	op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationProjectImport,
+		resources, nil, run, nil, nil)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
+
+// projectImportRun creates the project described by the manifest along with its networks,
+// profiles, custom volumes and instances, reading the archives which follow the manifest.
+func projectImportRun(d *Daemon, manifest *projectExportManifest, tr *tar.Reader, pool string) error {
+	s := d.State()
+	name := manifest.Project.Name
+
+	// Networks are shared between projects, only create the missing ones.
+	for _, network := range manifest.Networks {
+		err := projectImportNetwork(d, network)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := projectValidateDefaults(d.cluster, manifest.Project.Config)
+	if err != nil {
+		return err
+	}
+
+	err = doProjectCreate(d, manifest.Project)
+	if err != nil {
+		return err
+	}
+
+	// Replace the profiles of the new project by the exported ones.
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		if len(manifest.Profiles) == 0 {
+			return nil
+		}
+
+		err := tx.ProfileDelete(name, "default")
+		if err != nil {
+			return err
+		}
+
+		for _, profile := range manifest.Profiles {
+			devices := profile.Devices
+			if pool != "" {
+				k, _, _ := shared.GetRootDiskDevice(devices)
+				if k != "" {
+					devices[k]["pool"] = pool
+				}
+			}
+
+			_, err := tx.ProfileCreate(db.Profile{
+				Project:     name,
+				Name:        profile.Name,
+				Description: profile.Description,
+				Config:      profile.Config,
+				Devices:     devices,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "Failed to create profile '%s'", profile.Name)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	volumes := map[string]projectExportVolume{}
+	for _, vol := range manifest.Volumes {
+		volumes[vol.archiveName()] = vol
+	}
+
+	instances := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		vol, ok := volumes[hdr.Name]
+		if ok {
+			err = projectImportVolume(s, vol, tr)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to import storage volume '%s'", vol.Name)
+			}
+
+			delete(volumes, hdr.Name)
+			continue
+		}
+
+		instName := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "instances/"), ".tar")
+		if hdr.Name != projectExportInstanceArchiveName(instName) || !shared.StringInSlice(instName, manifest.Instances) {
+			return fmt.Errorf("Unexpected entry '%s' in project export", hdr.Name)
+		}
+
+		err = projectImportInstance(d, name, tr, pool)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to import instance '%s'", instName)
+		}
+
+		instances++
+	}
+
+	if len(volumes) > 0 || instances != len(manifest.Instances) {
+		return fmt.Errorf("Project export is incomplete")
+	}
+
+	return nil
+}
+
+// Create a network of a project export, unless one of the same name exists already.
+func projectImportNetwork(d *Daemon, network api.NetworksPost) error {
+	networkCreateLock.Lock()
+	defer networkCreateLock.Unlock()
+
+	_, _, err := d.cluster.NetworkGet(network.Name)
+	if err == nil {
+		return nil
+	} else if err != db.ErrNoSuchObject {
+		return err
+	}
+
+	count, err := cluster.Count(d.State())
+	if err != nil {
+		return err
+	}
+
+	// Clustered networks need their member specific configuration to be defined first.
+	if count > 1 {
+		return fmt.Errorf("Network '%s' must be created before importing the project", network.Name)
+	}
+
+	err = networkValidateConfig(network.Name, network.Config)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.cluster.NetworkCreate(network.Name, network.Description, network.Config)
+	if err != nil {
+		return errors.Wrapf(err, "Error inserting %s into database", network.Name)
+	}
+
+	return doNetworksCreate(d, network, true)
+}
+
+// Create a custom volume of a project export and unpack its content. Volumes are always created
+// on the storage pool they were exported from.
+func projectImportVolume(s *state.State, vol projectExportVolume, data io.Reader) error {
+	pool, err := storagePools.GetPoolByName(s, vol.Pool)
+	if err != storageDrivers.ErrUnknownDriver {
+		if err != nil {
+			return err
+		}
+
+		err = pool.CreateCustomVolume(vol.Name, vol.Description, vol.Config, storageDrivers.ContentTypeFS, nil)
+	} else {
+		err = storagePoolVolumeCreateInternal(s, vol.Pool, &api.StorageVolumesPost{
+			Name:             vol.Name,
+			Type:             "custom",
+			StorageVolumePut: api.StorageVolumePut{Description: vol.Description, Config: vol.Config},
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	unmount, err := projectVolumeMount(s, vol.Pool, vol.Name)
+	if err != nil {
+		return err
+	}
+	defer unmount()
+
+	mountPoint := storagePools.GetStoragePoolVolumeMountPoint(vol.Pool, vol.Name)
+	return shared.RunCommandWithFds(data, nil, "tar", "-xf", "-", "--numeric-owner", "--xattrs-include=*", "-C", mountPoint)
+}
+
+// Create an instance of a project export from its backup.
+func projectImportInstance(d *Daemon, name string, data io.Reader, pool string) error {
+	f, err := ioutil.TempFile("", "lxd_backup_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = io.Copy(f, data)
+	if err != nil {
+		return err
+	}
+
+	f.Seek(0, 0)
+	bInfo, err := backup.GetInfo(f)
+	if err != nil {
+		return err
+	}
+	bInfo.Project = name
+
+	if pool != "" {
+		bInfo.Pool = pool
+	}
+
+	f.Seek(0, 0)
+	return instanceImportBackup(d, name, *bInfo, f, pool != "")
+}
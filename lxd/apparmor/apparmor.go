@@ -622,10 +622,14 @@ func runApparmor(command string, c instance) error {
 		return nil
 	}
 
+	return runApparmorProfile(command, profileShort(c))
+}
+
+func runApparmorProfile(command string, name string) error {
 	output, err := shared.RunCommand("apparmor_parser", []string{
 		fmt.Sprintf("-%sWL", command),
 		path.Join(aaPath, "cache"),
-		path.Join(aaPath, "profiles", profileShort(c)),
+		path.Join(aaPath, "profiles", name),
 	}...)
 
 	if err != nil {
@@ -0,0 +1,216 @@
+package apparmor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pborman/uuid"
+
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logger"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+const profileRsync = `#include <tunables/global>
+profile "%s" flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+
+  # Preserve ownership, permissions, devices and extended attributes
+  capability chown,
+  capability dac_override,
+  capability dac_read_search,
+  capability fowner,
+  capability fsetid,
+  capability mknod,
+  capability setfcap,
+  capability sys_admin,
+
+  # Migration channel (netcat over an abstract unix socket)
+  unix,
+  network unix,
+
+  # Helper binaries
+  /{,usr/}bin/rsync mrix,
+  /{,usr/}bin/{,ba,da}sh mrix,
+  "%s" mrix,
+  @{PROC}/** r,
+
+  # Synchronized paths
+%s}
+`
+
+const profileDnsmasq = `#include <tunables/global>
+profile "%s" flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+  #include <abstractions/nameservice>
+
+  # DHCP, DNS and router advertisements
+  capability chown,
+  capability dac_override,
+  capability net_admin,
+  capability net_bind_service,
+  capability net_raw,
+  capability setgid,
+  capability setuid,
+
+  network inet,
+  network inet6,
+  network netlink,
+  network packet,
+  network unix,
+
+  /{,usr/}sbin/dnsmasq mr,
+  @{PROC}/** r,
+  /sys/** r,
+
+  # Network files
+  "%s/" r,
+  "%s/dnsmasq.*" rw,
+  "%s/dnsmasq.hosts/{,*}" r,
+}
+`
+
+// Return whether helper processes can be confined.
+func helperSupported(state *state.State) bool {
+	if !state.OS.AppArmorAdmin {
+		return false
+	}
+
+	_, err := exec.LookPath("aa-exec")
+	return err == nil
+}
+
+// Write the profile of a helper process and load it.
+func helperLoad(name string, content string) error {
+	err := os.MkdirAll(path.Join(aaPath, "cache"), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path.Join(aaPath, "profiles"), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path.Join(aaPath, "profiles", name), []byte(content), 0600)
+	if err != nil {
+		return err
+	}
+
+	return runApparmorProfile(cmdLoad, name)
+}
+
+// Unload the profile of a helper process and remove it from disk.
+func helperUnload(name string) error {
+	if !shared.PathExists(path.Join(aaPath, "profiles", name)) {
+		return nil
+	}
+
+	err := runApparmorProfile(cmdUnload, name)
+
+	os.Remove(path.Join(getCacheDir(), name))
+	os.Remove(path.Join(aaPath, "profiles", name))
+
+	return err
+}
+
+// Return the given command, run with the given profile.
+func helperWrap(name string, cmd []string) []string {
+	return append([]string{"aa-exec", "-p", name, "--"}, cmd...)
+}
+
+// RsyncWrapper returns the given rsync command, confined to the given local
+// paths, along with a function to call once it exited. Any other path is taken
+// as a remote source, which rsync is then allowed to reach over the network.
+// The command is returned as-is if AppArmor can't be used.
+//
+// The LXD binary may be run by rsync, to connect to the migration channel.
+func RsyncWrapper(state *state.State, cmd []string, paths ...string) ([]string, func(), error) {
+	if !helperSupported(state) {
+		return cmd, func() {}, nil
+	}
+
+	rules := ""
+	remote := false
+	for _, p := range paths {
+		// Remote sources (rsync:// URLs or host:path) are fetched over the
+		// network, there's no local path to allow.
+		if !filepath.IsAbs(p) {
+			remote = true
+			continue
+		}
+
+		// AppArmor mediates resolved paths.
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			resolved = p
+		}
+
+		resolved = strings.TrimSuffix(resolved, "/")
+		rules += fmt.Sprintf("  \"%s/\" rw,\n  \"%s/**\" rwlk,\n", resolved, resolved)
+	}
+
+	if remote {
+		rules += "\n  # Remote source\n  #include <abstractions/nameservice>\n  network inet,\n  network inet6,\n"
+	}
+
+	name := fmt.Sprintf("lxd_rsync-%s", uuid.NewRandom().String())
+	err := helperLoad(name, fmt.Sprintf(profileRsync, name, state.OS.ExecPath, rules))
+	if err != nil {
+		helperUnload(name)
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		err := helperUnload(name)
+		if err != nil {
+			logger.Error("Failed to unload rsync profile", log.Ctx{"profile": name, "err": err})
+		}
+	}
+
+	return helperWrap(name, cmd), cleanup, nil
+}
+
+func dnsmasqProfileName(networkName string) string {
+	return fmt.Sprintf("lxd_dnsmasq-%s", networkName)
+}
+
+// DnsmasqWrapper returns the given dnsmasq command, confined to the files of
+// the given network. The command is returned as-is if AppArmor can't be used.
+// The profile stays loaded until DnsmasqUnload is called.
+func DnsmasqWrapper(state *state.State, cmd []string, networkName string) ([]string, error) {
+	if !helperSupported(state) {
+		return cmd, nil
+	}
+
+	name := dnsmasqProfileName(networkName)
+	networkPath := shared.VarPath("networks", networkName)
+	resolved, err := filepath.EvalSymlinks(networkPath)
+	if err == nil {
+		networkPath = resolved
+	}
+
+	err = helperLoad(name, fmt.Sprintf(profileDnsmasq, name, networkPath, networkPath, networkPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return helperWrap(name, cmd), nil
+}
+
+// DnsmasqUnload unloads the profile of the dnsmasq of the given network, if
+// any.
+func DnsmasqUnload(state *state.State, networkName string) error {
+	if !state.OS.AppArmorAdmin {
+		return nil
+	}
+
+	return helperUnload(dnsmasqProfileName(networkName))
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"context"
@@ -17,15 +19,19 @@ import (
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/lxd/task"
 	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
 	log "github.com/lxc/lxd/shared/log15"
 	"github.com/lxc/lxd/shared/logger"
 	"github.com/pkg/errors"
 )
 
-// Create a new backup
-func backupCreate(s *state.State, args db.InstanceBackupArgs, sourceContainer Instance) error {
+// Create a new backup, reporting the progress of writing it to the operation if any
+func backupCreate(s *state.State, args db.InstanceBackupArgs, sourceContainer Instance, op *operations.Operation) error {
 	// Create the database entry
 	err := s.Cluster.ContainerBackupCreate(args)
 	if err != nil {
@@ -44,6 +50,23 @@ func backupCreate(s *state.State, args db.InstanceBackupArgs, sourceContainer In
 
 	b.SetCompressionAlgorithm(args.CompressionAlgorithm)
 
+	// Check if we can load new storage layer for pool driver type.
+	pool, err := storagePools.GetPoolByInstance(s, sourceContainer)
+	if err != storageDrivers.ErrUnknownDriver && err != storageDrivers.ErrNotImplemented {
+		if err != nil {
+			s.Cluster.ContainerBackupRemove(args.Name)
+			return errors.Wrap(err, "Load instance storage pool")
+		}
+
+		err = backupCreatePool(s, pool, *b, sourceContainer, op)
+		if err != nil {
+			s.Cluster.ContainerBackupRemove(args.Name)
+			return errors.Wrap(err, "Backup storage")
+		}
+
+		return nil
+	}
+
 	ourStart, err := sourceContainer.StorageStart()
 	if err != nil {
 		return err
@@ -164,16 +187,125 @@ func backupFixStoragePool(c *db.Cluster, b backup.Info, useDefaultPool bool) err
 	return nil
 }
 
-func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instance) error {
-	// Create the index
-	pool, err := c.StoragePool()
+// backupCreatePool writes the backup tarball of an instance on a pool of the new storage layer.
+// The content of the instance's volume is written by the pool's driver, in its optimized format
+// when the backup asks for it and the driver has one, and in the generic format otherwise.
+func backupCreatePool(s *state.State, pool storagePools.Pool, b backup.Backup, c Instance, op *operations.Operation) error {
+	optimized := b.OptimizedStorage()
+	if optimized && !pool.Driver().Info().OptimizedBackups {
+		logger.Info("Optimized backups not supported by storage driver, using generic format", log.Ctx{"project": c.Project(), "instance": c.Name(), "driver": pool.Driver().Info().Name})
+		optimized = false
+	}
+
+	indexFile, err := backupCreateIndex(b, c, pool.Driver().Info().Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(indexFile)
+	if err != nil {
+		return err
+	}
+
+	backupPath, err := backupCreatePath(c, b)
+	if err != nil {
+		return err
+	}
+
+	contentsPath := backup.ContentsPath(c.Project(), b.Name())
+	success := false
+	defer func() {
+		if success {
+			return
+		}
+
+		os.RemoveAll(backupPath)
+		os.Remove(contentsPath)
+	}()
+
+	// The index is staged on disk as the tarball needs its size ahead of its content.
+	tmpIndex, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_backup_index_")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmpIndex.Name())
+
+	_, err = tmpIndex.Write(data)
+	tmpIndex.Close()
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Lstat(tmpIndex.Name())
+	if err != nil {
+		return err
+	}
+
+	tarball, err := os.Create(backupPath)
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+
+	tarWriter := containerwriter.NewContainerTarWriter(tarball, nil)
+	err = tarWriter.WriteFileAs("backup/index.yaml", tmpIndex.Name(), fi)
+	if err != nil {
+		return err
+	}
+
+	if c.IsRunning() {
+		// This is done to ensure consistency when snapshotting. But we
+		// probably shouldn't fail just because of that.
+		logger.Debugf("Freezing container '%s' for backup", c.Name())
+
+		err := c.Freeze()
+		if err != nil {
+			logger.Errorf("Failed to freeze container '%s' for backup: %v", c.Name(), err)
+		}
+		defer c.Unfreeze()
+	}
+
+	err = pool.BackupInstance(c, tarWriter, optimized, indexFile.Snapshots, op)
+	if err != nil {
+		return err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	err = tarball.Close()
+	if err != nil {
+		return err
+	}
+
+	// Optimized backups have no content listing.
+	listPath := contentsPath
+	if optimized {
+		listPath = ""
+	}
+
+	err = backupFinishTarball(s, b, backupPath, listPath)
+	if err != nil {
+		return err
+	}
+
+	success = true
+	return nil
+}
+
+// backupCreateIndex returns the index of the backup of an instance, listing its snapshots unless
+// the backup is of the instance only.
+func backupCreateIndex(b backup.Backup, c Instance, backend string) (*backup.Info, error) {
+	pool, err := c.StoragePool()
+	if err != nil {
+		return nil, err
+	}
 
 	indexFile := backup.Info{
 		Name:       c.Name(),
-		Backend:    c.Storage().GetStorageTypeName(),
+		Backend:    backend,
 		Privileged: c.IsPrivileged(),
 		Pool:       pool,
 		Snapshots:  []string{},
@@ -182,7 +314,7 @@ func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instanc
 	if !b.InstanceOnly() {
 		snaps, err := c.Snapshots()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		for _, snap := range snaps {
@@ -191,7 +323,66 @@ func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instanc
 		}
 	}
 
-	data, err := yaml.Marshal(&indexFile)
+	return &indexFile, nil
+}
+
+// backupCreatePath creates the directory holding the backups of an instance if needed, and
+// returns the path of the tarball of the given backup.
+func backupCreatePath(c Instance, b backup.Backup) (string, error) {
+	backupsPath := shared.VarPath("backups", project.Prefix(c.Project(), c.Name()))
+	if !shared.PathExists(backupsPath) {
+		err := os.MkdirAll(backupsPath, 0700)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return shared.VarPath("backups", project.Prefix(c.Project(), b.Name())), nil
+}
+
+// backupFinishTarball saves the content listing of an uncompressed backup tarball to contentsPath,
+// unless empty as for optimized backups, then compresses the tarball and restricts its
+// permissions.
+func backupFinishTarball(s *state.State, b backup.Backup, backupPath string, contentsPath string) error {
+	// List the content of the instance, to allow restoring specific paths
+	if contentsPath != "" {
+		err := backup.WriteContents(backupPath, contentsPath)
+		if err != nil {
+			return errors.Wrap(err, "Failed to list backup content")
+		}
+	}
+
+	var err error
+	var compress string
+
+	if b.CompressionAlgorithm() != "" {
+		compress = b.CompressionAlgorithm()
+	} else {
+		compress, err = cluster.ConfigGetString(s.Cluster, "backups.compression_algorithm")
+		if err != nil {
+			return err
+		}
+	}
+
+	if compress != "none" {
+		err = compressFileInPlace(backupPath, compress)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Set permissions
+	return os.Chmod(backupPath, 0600)
+}
+
+func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instance) error {
+	// Create the index
+	indexFile, err := backupCreateIndex(b, c, c.Storage().GetStorageTypeName())
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(indexFile)
 	if err != nil {
 		return err
 	}
@@ -207,17 +398,13 @@ func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instanc
 		return err
 	}
 
-	// Create the target path if needed
-	backupsPath := shared.VarPath("backups", project.Prefix(c.Project(), c.Name()))
-	if !shared.PathExists(backupsPath) {
-		err := os.MkdirAll(backupsPath, 0700)
-		if err != nil {
-			return err
-		}
+	// Create the tarball
+	backupPath, err := backupCreatePath(c, b)
+	if err != nil {
+		return err
 	}
 
-	// Create the tarball
-	backupPath := shared.VarPath("backups", project.Prefix(c.Project(), b.Name()))
+	contentsPath := backup.ContentsPath(c.Project(), b.Name())
 	success := false
 	defer func() {
 		if success {
@@ -225,6 +412,7 @@ func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instanc
 		}
 
 		os.RemoveAll(backupPath)
+		os.Remove(contentsPath)
 	}()
 
 	args := []string{"-cf", backupPath, "--numeric-owner", "--xattrs", "-C", path, "--transform", "s,^./,backup/,", "."}
@@ -238,51 +426,13 @@ func backupCreateTarball(s *state.State, path string, b backup.Backup, c Instanc
 		return err
 	}
 
-	var compress string
-
-	if b.CompressionAlgorithm() != "" {
-		compress = b.CompressionAlgorithm()
-	} else {
-		compress, err = cluster.ConfigGetString(s.Cluster, "backups.compression_algorithm")
-		if err != nil {
-			return err
-		}
+	// Optimized backups have no content listing.
+	listPath := contentsPath
+	if b.OptimizedStorage() {
+		listPath = ""
 	}
 
-	if compress != "none" {
-		infile, err := os.Open(backupPath)
-		if err != nil {
-			return err
-		}
-		defer infile.Close()
-
-		compressed, err := os.Create(backupPath + ".compressed")
-		if err != nil {
-			return err
-		}
-		compressedName := compressed.Name()
-
-		defer compressed.Close()
-		defer os.Remove(compressedName)
-
-		err = compressFile(compress, infile, compressed)
-		if err != nil {
-			return err
-		}
-
-		err = os.Remove(backupPath)
-		if err != nil {
-			return err
-		}
-
-		err = os.Rename(compressedName, backupPath)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Set permissions
-	err = os.Chmod(backupPath, 0600)
+	err = backupFinishTarball(s, b, backupPath, listPath)
 	if err != nil {
 		return err
 	}
@@ -349,3 +499,141 @@ func pruneExpiredContainerBackups(ctx context.Context, d *Daemon) error {
 
 	return nil
 }
+
+// Restore the given paths of the root filesystem stored in a backup of the
+// source container into the target instance, under the given destination
+// directory.
+//
+// Ownership is stored in the backup as seen from the host, so it's mapped back
+// into the source container before the files get pushed to the target.
+func backupRestorePaths(b *backup.Backup, source container, target Instance, paths []string, destination string) error {
+	entries, err := b.Contents()
+	if err != nil {
+		return err
+	}
+
+	// Validate the requested paths
+	known := map[string]api.InstanceBackupEntry{}
+	for _, entry := range entries {
+		known[entry.Path] = entry
+	}
+
+	for i, path := range paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("Path %q isn't absolute", path)
+		}
+
+		paths[i] = filepath.Clean(path)
+		_, ok := known[paths[i]]
+		if !ok && paths[i] != "/" {
+			return fmt.Errorf("Path %q isn't in the backup", path)
+		}
+	}
+
+	selected := func(path string) bool {
+		for _, prefix := range paths {
+			if prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Hard links can only be restored if the content of their target is
+	// at hand, so keep it even if it wasn't requested.
+	needed := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Type == "hardlink" && selected(entry.Path) {
+			needed[entry.Target] = true
+		}
+	}
+
+	idmapset, err := source.DiskIdmap()
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := ioutil.TempDir(shared.VarPath("backups"), "lxd_restore_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tarball, err := os.Open(shared.VarPath("backups", project.Prefix(source.Project(), b.Name())))
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+
+	tr, cancel, err := backup.NewTarReader(tarball)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+
+		entry, ok := backup.ContentsEntry(hdr)
+		if !ok || (!selected(entry.Path) && !needed[entry.Path]) {
+			continue
+		}
+
+		if entry.Type == "file" {
+			file, err := os.OpenFile(filepath.Join(tempDir, fmt.Sprintf("%d", len(files))), os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+
+			files[entry.Path] = file.Name()
+		}
+
+		if !selected(entry.Path) {
+			continue
+		}
+
+		uid := int64(hdr.Uid)
+		gid := int64(hdr.Gid)
+		if idmapset != nil {
+			uid, gid = idmapset.ShiftFromNs(uid, gid)
+		}
+
+		path := filepath.Join(destination, entry.Path)
+		mode := int(entry.Mode)
+
+		switch entry.Type {
+		case "file":
+			err = target.FilePush("file", files[entry.Path], path, uid, gid, mode, "overwrite")
+		case "directory":
+			err = target.FilePush("directory", "", path, uid, gid, mode, "overwrite")
+		case "symlink":
+			err = target.FilePush("symlink", entry.Target, path, uid, gid, mode, "overwrite")
+		case "hardlink":
+			file, ok := files[entry.Target]
+			if !ok {
+				return fmt.Errorf("Missing target %q of hard link %q", entry.Target, entry.Path)
+			}
+
+			err = target.FilePush("file", file, path, uid, gid, mode, "overwrite")
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to restore %q", entry.Path)
+		}
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -37,67 +38,23 @@ type Info struct {
 	Pool            string   `json:"pool" yaml:"pool"`
 	Snapshots       []string `json:"snapshots,omitempty" yaml:"snapshots,omitempty"`
 	HasBinaryFormat bool     `json:"-" yaml:"-"`
+
+	// Description and config of the volume of a custom volume backup.
+	Volume *api.StorageVolumePut `json:"volume,omitempty" yaml:"volume,omitempty"`
 }
 
 // GetInfo extracts backup information from a given ReadSeeker.
 func GetInfo(r io.ReadSeeker) (*Info, error) {
-	var tr *tar.Reader
 	result := Info{}
 	hasBinaryFormat := false
 	hasIndexFile := false
 
 	// Extract
-	r.Seek(0, 0)
-	_, algo, unpacker, err := shared.DetectCompressionFile(r)
+	tr, cancel, err := NewTarReader(r)
 	if err != nil {
 		return nil, err
 	}
-	r.Seek(0, 0)
-
-	if unpacker == nil {
-		return nil, fmt.Errorf("Unsupported backup compression")
-	}
-
-	if len(unpacker) > 0 {
-		if algo == ".squashfs" {
-			// 'sqfs2tar' tool does not support reading from stdin. So
-			// create a temporary file to write the compressed data and
-			// pass it as program argument
-			tempfile, err := ioutil.TempFile("", "lxd_decompress_")
-			if err != nil {
-				return nil, err
-			}
-			defer tempfile.Close()
-			defer os.Remove(tempfile.Name())
-
-			// Write compressed data
-			_, err = io.Copy(tempfile, r)
-			if err != nil {
-				return nil, err
-			}
-
-			// Prepare to pass the temporary file as program argument
-			unpacker = append(unpacker, tempfile.Name())
-		}
-		cmd := exec.Command(unpacker[0], unpacker[1:]...)
-		cmd.Stdin = r
-
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			return nil, err
-		}
-		defer stdout.Close()
-
-		err = cmd.Start()
-		if err != nil {
-			return nil, err
-		}
-		defer cmd.Wait()
-
-		tr = tar.NewReader(stdout)
-	} else {
-		tr = tar.NewReader(r)
-	}
+	defer cancel()
 
 	for {
 		hdr, err := tr.Next()
@@ -117,7 +74,7 @@ func GetInfo(r io.ReadSeeker) (*Info, error) {
 			hasIndexFile = true
 		}
 
-		if hdr.Name == "backup/container.bin" {
+		if hdr.Name == "backup/container.bin" || hdr.Name == "backup/volume.bin" {
 			hasBinaryFormat = true
 		}
 	}
@@ -130,6 +87,78 @@ func GetInfo(r io.ReadSeeker) (*Info, error) {
 	return &result, nil
 }
 
+// NewTarReader returns a tar reader for the given backup tarball, decompressing
+// it if needed. The returned function must be called once done reading.
+func NewTarReader(r io.ReadSeeker) (*tar.Reader, func(), error) {
+	r.Seek(0, 0)
+	_, algo, unpacker, err := shared.DetectCompressionFile(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Seek(0, 0)
+
+	if unpacker == nil {
+		return nil, nil, fmt.Errorf("Unsupported backup compression")
+	}
+
+	if len(unpacker) == 0 {
+		return tar.NewReader(r), func() {}, nil
+	}
+
+	cleanups := []func(){}
+	cancel := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	if algo == ".squashfs" {
+		// 'sqfs2tar' tool does not support reading from stdin. So
+		// create a temporary file to write the compressed data and
+		// pass it as program argument
+		tempfile, err := ioutil.TempFile("", "lxd_decompress_")
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanups = append(cleanups, func() {
+			tempfile.Close()
+			os.Remove(tempfile.Name())
+		})
+
+		// Write compressed data
+		_, err = io.Copy(tempfile, r)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+
+		// Prepare to pass the temporary file as program argument
+		unpacker = append(unpacker, tempfile.Name())
+	}
+
+	cmd := exec.Command(unpacker[0], unpacker[1:]...)
+	cmd.Stdin = r
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		stdout.Close()
+		cancel()
+		return nil, nil, err
+	}
+	cleanups = append(cleanups, func() {
+		stdout.Close()
+		cmd.Wait()
+	})
+
+	return tar.NewReader(stdout), cancel, nil
+}
+
 // Backup represents a container backup
 type Backup struct {
 	state    *state.State
@@ -191,6 +220,15 @@ func (b *Backup) Rename(newName string) error {
 		return err
 	}
 
+	// Rename the content listing
+	oldContentsPath := ContentsPath(b.instance.Project(), b.name)
+	if shared.PathExists(oldContentsPath) {
+		err := os.Rename(oldContentsPath, ContentsPath(b.instance.Project(), newName))
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check if we can remove the container directory
 	empty, _ := shared.PathIsEmpty(backupsPath)
 	if empty {
@@ -264,6 +302,23 @@ func DoBackupDelete(s *state.State, projectName, backupName, containerName strin
 		}
 	}
 
+	// Delete the content listing
+	contentsPath := ContentsPath(projectName, backupName)
+	if shared.PathExists(contentsPath) {
+		err := os.Remove(contentsPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	contentsEmpty, _ := shared.PathIsEmpty(filepath.Dir(contentsPath))
+	if contentsEmpty {
+		err := os.Remove(filepath.Dir(contentsPath))
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check if we can remove the container directory
 	backupsPath := shared.VarPath("backups", project.Prefix(projectName, containerName))
 	empty, _ := shared.PathIsEmpty(backupsPath)
@@ -0,0 +1,46 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/lxd/backup"
+)
+
+// The index of a custom volume backup holds the volume's config, and its optimized format is
+// detected.
+func TestGetInfo_CustomVolume(t *testing.T) {
+	index := []byte(`name: data
+backend: zfs
+pool: default
+snapshots:
+- snap0
+volume:
+  description: Some data
+  config:
+    size: 10GB
+`)
+
+	buf := bytes.Buffer{}
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "backup/index.yaml", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(index))}))
+	_, err := tw.Write(index)
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "backup/snapshots/snap0.bin", Typeflag: tar.TypeReg, Mode: 0644}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "backup/volume.bin", Typeflag: tar.TypeReg, Mode: 0644}))
+	require.NoError(t, tw.Close())
+
+	info, err := backup.GetInfo(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	assert.Equal(t, "data", info.Name)
+	assert.Equal(t, []string{"snap0"}, info.Snapshots)
+	assert.True(t, info.HasBinaryFormat)
+	require.NotNil(t, info.Volume)
+	assert.Equal(t, "Some data", info.Volume.Description)
+	assert.Equal(t, map[string]string{"size": "10GB"}, info.Volume.Config)
+}
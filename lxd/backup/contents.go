@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/project"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// Location of the instance's root filesystem in backup tarballs.
+const contentsRootfs = "backup/container/rootfs"
+
+// ContentsPath returns the path of the content listing of the given backup.
+//
+// Content listings are kept outside of the backups directory, so that they
+// can't clash with backup names.
+func ContentsPath(projectName string, backupName string) string {
+	return shared.VarPath("backups-contents", project.Prefix(projectName, backupName))
+}
+
+// ContentsEntry converts a backup tarball header into a content listing
+// entry. It returns false if the header isn't part of the instance's root
+// filesystem, or isn't a regular file, directory, symlink or hard link.
+func ContentsEntry(hdr *tar.Header) (api.InstanceBackupEntry, bool) {
+	path, ok := contentsPath(hdr.Name)
+	if !ok {
+		return api.InstanceBackupEntry{}, false
+	}
+
+	entry := api.InstanceBackupEntry{
+		Path:       path,
+		Mode:       hdr.Mode & 07777,
+		ModifiedAt: hdr.ModTime.UTC(),
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		entry.Type = "file"
+		entry.Size = hdr.Size
+	case tar.TypeDir:
+		entry.Type = "directory"
+	case tar.TypeSymlink:
+		entry.Type = "symlink"
+		entry.Target = hdr.Linkname
+	case tar.TypeLink:
+		target, ok := contentsPath(hdr.Linkname)
+		if !ok {
+			return api.InstanceBackupEntry{}, false
+		}
+
+		entry.Type = "hardlink"
+		entry.Target = target
+	default:
+		return api.InstanceBackupEntry{}, false
+	}
+
+	return entry, true
+}
+
+// Return the path inside the instance's root filesystem of the given tarball
+// path.
+func contentsPath(name string) (string, bool) {
+	name = strings.TrimSuffix(name, "/")
+	if !strings.HasPrefix(name, contentsRootfs+"/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(name, contentsRootfs), true
+}
+
+// WriteContents lists the content of the instance's root filesystem stored in
+// the given uncompressed backup tarball, and saves the listing to the given
+// path.
+func WriteContents(tarballPath string, path string) error {
+	tarball, err := os.Open(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+
+	entries := []api.InstanceBackupEntry{}
+	tr := tar.NewReader(tarball)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+
+		entry, ok := ContentsEntry(hdr)
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	err = json.NewEncoder(writer).Encode(entries)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// ReadContents loads the content listing saved at the given path.
+func ReadContents(path string) ([]api.InstanceBackupEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	entries := []api.InstanceBackupEntry{}
+	err = json.NewDecoder(reader).Decode(&entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Contents returns the content of the instance's root filesystem stored in the
+// backup. Optimized backups have no content listing.
+func (b *Backup) Contents() ([]api.InstanceBackupEntry, error) {
+	path := ContentsPath(b.instance.Project(), b.name)
+	if !shared.PathExists(path) {
+		return nil, fmt.Errorf("Backup has no content listing")
+	}
+
+	return ReadContents(path)
+}
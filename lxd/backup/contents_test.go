@@ -0,0 +1,66 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/lxd/backup"
+)
+
+// Only the content of the instance's root filesystem gets listed.
+func TestWriteContents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxd-backup-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tarballPath := filepath.Join(dir, "backup")
+	tarball, err := os.Create(tarballPath)
+	require.NoError(t, err)
+
+	modTime := time.Date(2019, 11, 5, 11, 32, 21, 0, time.UTC)
+	tw := tar.NewWriter(tarball)
+	headers := []*tar.Header{
+		{Name: "backup/index.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "backup/container/rootfs/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "backup/container/rootfs/etc/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime},
+		{Name: "backup/container/rootfs/etc/hosts", Typeflag: tar.TypeReg, Mode: 0644, Size: 5, ModTime: modTime},
+		{Name: "backup/container/rootfs/etc/hosts.bak", Typeflag: tar.TypeLink, Mode: 0644, Linkname: "backup/container/rootfs/etc/hosts", ModTime: modTime},
+		{Name: "backup/container/rootfs/etc/localtime", Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: "/usr/share/zoneinfo/UTC", ModTime: modTime},
+	}
+
+	for _, hdr := range headers {
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Size > 0 {
+			_, err := tw.Write([]byte("hosts"))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, tarball.Close())
+
+	contentsPath := filepath.Join(dir, "contents", "backup")
+	require.NoError(t, backup.WriteContents(tarballPath, contentsPath))
+
+	entries, err := backup.ReadContents(contentsPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, "/etc", entries[0].Path)
+	assert.Equal(t, "directory", entries[0].Type)
+	assert.Equal(t, "/etc/hosts", entries[1].Path)
+	assert.Equal(t, "file", entries[1].Type)
+	assert.Equal(t, int64(5), entries[1].Size)
+	assert.Equal(t, int64(0644), entries[1].Mode)
+	assert.Equal(t, modTime, entries[1].ModifiedAt)
+	assert.Equal(t, "hardlink", entries[2].Type)
+	assert.Equal(t, "/etc/hosts", entries[2].Target)
+	assert.Equal(t, "symlink", entries[3].Type)
+	assert.Equal(t, "/usr/share/zoneinfo/UTC", entries[3].Target)
+}
@@ -7,12 +7,14 @@ import (
 	"io"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/scrypt"
 
 	"github.com/lxc/lxd/lxd/config"
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/pkg/errors"
 )
 
@@ -130,6 +132,33 @@ func (c *Config) ImagesMinimalReplica() int64 {
 	return c.m.GetInt64("cluster.images_minimal_replica")
 }
 
+// ImagesPool returns the name of the storage pool holding the image store shared by all the nodes
+// of the cluster, if any.
+func (c *Config) ImagesPool() string {
+	return c.m.GetString("cluster.images_pool")
+}
+
+// MigrationMutualTLS returns whether the data channels of migrations between
+// cluster members must be authenticated with the cluster certificate on both
+// ends.
+func (c *Config) MigrationMutualTLS() bool {
+	return c.m.GetBool("cluster.migration_mutual_tls")
+}
+
+// Webhooks returns the URL prefixes the webhooks of instances and volumes may
+// post to, and the secret signing their payloads.
+func (c *Config) Webhooks() ([]string, string) {
+	allowed := []string{}
+	for _, prefix := range strings.Split(c.m.GetString("core.webhooks_allowed"), ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" {
+			allowed = append(allowed, prefix)
+		}
+	}
+
+	return allowed, c.m.GetString("core.webhooks_secret")
+}
+
 // Dump current configuration keys and their values. Keys with values matching
 // their defaults are omitted.
 func (c *Config) Dump() map[string]interface{} {
@@ -222,6 +251,8 @@ var ConfigSchema = config.Schema{
 	"backups.compression_algorithm":  {Default: "gzip", Validator: validateCompression},
 	"cluster.offline_threshold":      {Type: config.Int64, Default: offlineThresholdDefault(), Validator: offlineThresholdValidator},
 	"cluster.images_minimal_replica": {Type: config.Int64, Default: "3", Validator: imageMinimalReplicaValidator},
+	"cluster.images_pool":            {},
+	"cluster.migration_mutual_tls":   {Type: config.Bool},
 	"core.https_allowed_headers":     {},
 	"core.https_allowed_methods":     {},
 	"core.https_allowed_origin":      {},
@@ -229,7 +260,10 @@ var ConfigSchema = config.Schema{
 	"core.proxy_http":                {},
 	"core.proxy_https":               {},
 	"core.proxy_ignore_hosts":        {},
+	"core.shutdown_timeout":          {Type: config.Int64, Default: "5"},
 	"core.trust_password":            {Hidden: true, Setter: passwordSetter},
+	"core.webhooks_allowed":          {Validator: webhooksAllowedValidator},
+	"core.webhooks_secret":           {Hidden: true},
 	"candid.api.key":                 {},
 	"candid.api.url":                 {},
 	"candid.domains":                 {},
@@ -292,6 +326,22 @@ func imageMinimalReplicaValidator(value string) error {
 	return nil
 }
 
+func webhooksAllowedValidator(value string) error {
+	for _, prefix := range strings.Split(value, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+
+		err := webhook.ValidateURL(prefix)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid webhook URL prefix %q", prefix)
+		}
+	}
+
+	return nil
+}
+
 func passwordSetter(value string) (string, error) {
 	// Nothing to do on unset
 	if value == "" {
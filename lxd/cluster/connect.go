@@ -43,7 +43,11 @@ func ConnectIfContainerIsRemote(cluster *db.Cluster, project, name string, cert
 	err := cluster.Transaction(func(tx *db.ClusterTx) error {
 		var err error
 		address, err = tx.ContainerNodeAddress(project, name, instanceType)
-		return err
+		if err != nil {
+			return err
+		}
+
+		return checkNodeIsOnline(tx, address)
 	})
 	if err != nil {
 		return nil, err
@@ -62,12 +66,20 @@ func ConnectIfContainerIsRemote(cluster *db.Cluster, project, name string, cert
 //
 // If there is more than one node with a matching volume name, an error is
 // returned.
-func ConnectIfVolumeIsRemote(cluster *db.Cluster, poolID int64, volumeName string, volumeType int, cert *shared.CertInfo) (lxd.InstanceServer, error) {
+func ConnectIfVolumeIsRemote(cluster *db.Cluster, poolID int64, project, volumeName string, volumeType int, cert *shared.CertInfo) (lxd.InstanceServer, error) {
 	var addresses []string // Node addresses
 	err := cluster.Transaction(func(tx *db.ClusterTx) error {
 		var err error
-		addresses, err = tx.StorageVolumeNodeAddresses(poolID, "default", volumeName, volumeType)
-		return err
+		addresses, err = tx.StorageVolumeNodeAddresses(poolID, project, volumeName, volumeType)
+		if err != nil {
+			return err
+		}
+
+		if len(addresses) > 1 {
+			return nil
+		}
+
+		return checkNodeIsOnline(tx, addresses[0])
 	})
 	if err != nil {
 		return nil, err
@@ -99,6 +111,31 @@ func ConnectIfVolumeIsRemote(cluster *db.Cluster, poolID int64, volumeName strin
 	return Connect(address, cert, false)
 }
 
+// Return an error if the node with the given address, which owns an instance
+// or a volume, is offline, since forwarding the request to it would just fail
+// with a less clear connection error. The empty address is the local node.
+func checkNodeIsOnline(tx *db.ClusterTx, address string) error {
+	if address == "" {
+		return nil
+	}
+
+	node, err := tx.NodeByAddress(address)
+	if err != nil {
+		return err
+	}
+
+	threshold, err := tx.NodeOfflineThreshold()
+	if err != nil {
+		return err
+	}
+
+	if node.IsOffline(threshold) {
+		return fmt.Errorf("Cluster member %s is offline", node.Name)
+	}
+
+	return nil
+}
+
 // SetupTrust is a convenience around InstanceServer.CreateCertificate that
 // adds the given client certificate to the trusted pool of the cluster at the
 // given address, using the given password.
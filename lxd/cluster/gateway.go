@@ -23,7 +23,6 @@ import (
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/eagain"
-	"github.com/lxc/lxd/shared/logger"
 	"github.com/pkg/errors"
 )
 
@@ -464,6 +463,17 @@ func (g *Gateway) Reset(cert *shared.CertInfo) error {
 	return g.init()
 }
 
+// UpdateCert sets a new cluster certificate for the gateway, which will be
+// used for new connections to the other nodes.
+//
+// This is used when rotating the cluster certificate.
+func (g *Gateway) UpdateCert(cert *shared.CertInfo) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.cert = cert
+}
+
 // LeaderAddress returns the address of the current raft leader.
 func (g *Gateway) LeaderAddress() (string, error) {
 	g.lock.RLock()
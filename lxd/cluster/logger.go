@@ -0,0 +1,9 @@
+package cluster
+
+import (
+	"github.com/lxc/lxd/shared/logging"
+)
+
+// logger tags the messages of the cluster package, so that their log level can be set with the
+// core.log_level.cluster config key.
+var logger = logging.Subsystem("cluster")
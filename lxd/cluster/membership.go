@@ -17,7 +17,6 @@ import (
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/log15"
-	"github.com/lxc/lxd/shared/logger"
 	"github.com/lxc/lxd/shared/version"
 	"github.com/pkg/errors"
 )
@@ -801,6 +800,7 @@ func List(state *state.State) ([]api.ClusterMember, error) {
 	var err error
 	var nodes []db.NodeInfo
 	var offlineThreshold time.Duration
+	var changes []db.NodePendingChange
 
 	err = state.Cluster.Transaction(func(tx *db.ClusterTx) error {
 		nodes, err = tx.Nodes()
@@ -813,6 +813,11 @@ func List(state *state.State) ([]api.ClusterMember, error) {
 			return err
 		}
 
+		changes, err = tx.NodePendingChanges("")
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -827,6 +832,22 @@ func List(state *state.State) ([]api.ClusterMember, error) {
 		result[i].URL = fmt.Sprintf("https://%s", node.Address)
 		result[i].Database = shared.StringInSlice(string(db.ClusterRoleDatabase), node.Roles)
 		result[i].Roles = node.Roles
+		result[i].Maintenance = node.Maintenance
+		result[i].PendingChanges = []api.ClusterMemberPendingChange{}
+		for _, change := range changes {
+			if change.Node != node.Name {
+				continue
+			}
+
+			result[i].PendingChanges = append(result[i].PendingChanges, api.ClusterMemberPendingChange{
+				Entity:    change.Entity,
+				Project:   change.Project,
+				Name:      change.Name,
+				CreatedAt: change.Date,
+				Error:     change.Error,
+			})
+		}
+
 		if node.IsOffline(offlineThreshold) {
 			result[i].Status = "Offline"
 			result[i].Message = fmt.Sprintf(
@@ -864,6 +885,16 @@ func List(state *state.State) ([]api.ClusterMember, error) {
 		if n == 2 {
 			result[i].Status = "Blocked"
 			result[i].Message = "waiting for other nodes to be upgraded"
+			continue
+		}
+
+		// Report the changes made while the node was offline which it
+		// failed to apply.
+		for _, change := range result[i].PendingChanges {
+			if change.Error != "" {
+				result[i].Message = fmt.Sprintf("failed to apply the changes to %s %s", change.Entity, change.Name)
+				break
+			}
 		}
 	}
 
@@ -10,7 +10,6 @@ import (
 	"github.com/lxc/lxd/lxd/node"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/shared"
-	"github.com/lxc/lxd/shared/logger"
 	"github.com/pkg/errors"
 )
 
@@ -32,48 +31,14 @@ const (
 // NewNotifier builds a Notifier that can be used to notify other peers using
 // the given policy.
 func NewNotifier(state *state.State, cert *shared.CertInfo, policy NotifierPolicy) (Notifier, error) {
-	address, err := node.ClusterAddress(state.Node)
+	nodes, _, err := notifyPeers(state, policy)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch node address")
-	}
-
-	// Fast-track the case where we're not clustered at all.
-	if address == "" {
-		nullNotifier := func(func(lxd.InstanceServer) error) error { return nil }
-		return nullNotifier, nil
+		return nil, err
 	}
 
-	peers := []string{}
-	err = state.Cluster.Transaction(func(tx *db.ClusterTx) error {
-		offlineThreshold, err := tx.NodeOfflineThreshold()
-		if err != nil {
-			return err
-		}
-
-		nodes, err := tx.Nodes()
-		if err != nil {
-			return err
-		}
-		for _, node := range nodes {
-			if node.Address == address || node.Address == "0.0.0.0" {
-				continue // Exclude ourselves
-			}
-
-			if node.IsOffline(offlineThreshold) {
-				switch policy {
-				case NotifyAll:
-					return fmt.Errorf("peer node %s is down", node.Address)
-				case NotifyAlive:
-					continue // Just skip this node
-				case NotifyTryAll:
-				}
-			}
-			peers = append(peers, node.Address)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	peers := make([]string, len(nodes))
+	for i, node := range nodes {
+		peers[i] = node.Address
 	}
 
 	notifier := func(hook func(lxd.InstanceServer) error) error {
@@ -114,6 +79,57 @@ func NewNotifier(state *state.State, cert *shared.CertInfo, policy NotifierPolic
 	return notifier, nil
 }
 
+// Return the other members of the cluster which should be notified according
+// to the given policy, along with the offline ones which are skipped.
+func notifyPeers(state *state.State, policy NotifierPolicy) ([]db.NodeInfo, []db.NodeInfo, error) {
+	address, err := node.ClusterAddress(state.Node)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to fetch node address")
+	}
+
+	// Fast-track the case where we're not clustered at all.
+	if address == "" {
+		return nil, nil, nil
+	}
+
+	peers := []db.NodeInfo{}
+	skipped := []db.NodeInfo{}
+	err = state.Cluster.Transaction(func(tx *db.ClusterTx) error {
+		offlineThreshold, err := tx.NodeOfflineThreshold()
+		if err != nil {
+			return err
+		}
+
+		nodes, err := tx.Nodes()
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if node.Address == address || node.Address == "0.0.0.0" {
+				continue // Exclude ourselves
+			}
+
+			if node.IsOffline(offlineThreshold) {
+				switch policy {
+				case NotifyAll:
+					return fmt.Errorf("peer node %s is down", node.Address)
+				case NotifyAlive:
+					skipped = append(skipped, node)
+					continue // Just skip this node
+				case NotifyTryAll:
+				}
+			}
+			peers = append(peers, node)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return peers, skipped, nil
+}
+
 // Return true if the given error is due to the LXD Go client not being able to
 // connect to the target LXD node.
 func isClientConnectionError(err error) bool {
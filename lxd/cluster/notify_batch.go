@@ -0,0 +1,250 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared"
+)
+
+// Number of times a change is attempted on a member which can't be reached,
+// and the delay between the attempts.
+var (
+	notifyBatchAttempts = 3
+	notifyBatchDelay    = time.Second
+)
+
+// Possible statuses of a member after a batch of changes was propagated.
+const (
+	NotifyStatusApplied  = "applied"  // All the changes were applied.
+	NotifyStatusFailed   = "failed"   // A change failed, the applied ones were reverted if possible.
+	NotifyStatusReverted = "reverted" // All the changes were applied, then reverted because another member failed.
+	NotifyStatusSkipped  = "skipped"  // The member is offline and wasn't notified.
+)
+
+// NotifyChange is a change which must be propagated to the other members of
+// the cluster.
+type NotifyChange struct {
+	// What the change does (e.g. "update storage pool default"), used in
+	// errors.
+	Description string
+
+	// Apply the change on the member.
+	Apply func(lxd.InstanceServer) error
+
+	// Revert the change on the member, once applied. It can be nil if the
+	// change can't be reverted.
+	Revert func(lxd.InstanceServer) error
+}
+
+// NotifyMemberStatus reports how a batch of changes was propagated to a
+// member.
+type NotifyMemberStatus struct {
+	Name     string
+	Address  string
+	Status   string
+	Applied  int // Number of changes left applied on the member.
+	Attempts int // Number of attempts made for the last change.
+	Err      error
+}
+
+// NotifyBatchError is returned by NotifyBatch when the changes couldn't be
+// applied on some of the members.
+type NotifyBatchError struct {
+	Statuses []NotifyMemberStatus
+}
+
+func (e NotifyBatchError) Error() string {
+	failures := []string{}
+	for _, status := range e.Statuses {
+		if status.Err == nil {
+			continue
+		}
+
+		failures = append(failures, fmt.Sprintf("%s (%s): %v", status.Name, status.Status, status.Err))
+	}
+
+	return fmt.Sprintf("Failed to propagate the changes to %d cluster members: %s", len(failures), strings.Join(failures, "; "))
+}
+
+// NotifyBatch propagates the given changes to the other members of the cluster
+// selected by the policy, and returns the status of each of them.
+//
+// Each member gets all the changes in order over a single connection, and a
+// change which can't reach the member is retried a few times. If one of the
+// changes fails, the changes already applied on that member are reverted, so
+// that each member has either all the changes or none. If any member fails and
+// all the changes can be reverted, the members on which all the changes were
+// applied are reverted too, so that members aren't left inconsistent with each
+// other.
+//
+// The returned error is a NotifyBatchError if any member failed.
+func NotifyBatch(state *state.State, cert *shared.CertInfo, policy NotifierPolicy, changes []NotifyChange) ([]NotifyMemberStatus, error) {
+	peers, skipped, err := notifyPeers(state, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]NotifyMemberStatus, len(peers))
+	clients := make([]lxd.InstanceServer, len(peers))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(peers))
+	for i, peer := range peers {
+		statuses[i] = NotifyMemberStatus{Name: peer.Name, Address: peer.Address}
+
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = notifyBatchApply(&statuses[i], cert, changes)
+		}(i)
+	}
+	wg.Wait()
+
+	failed := false
+	for _, status := range statuses {
+		if status.Err != nil {
+			failed = true
+			break
+		}
+	}
+
+	reversible := true
+	for _, change := range changes {
+		if change.Revert == nil {
+			reversible = false
+			break
+		}
+	}
+
+	// Revert the members which were done, to match the failed ones.
+	if failed && reversible {
+		wg.Add(len(peers))
+		for i := range peers {
+			go func(i int) {
+				defer wg.Done()
+
+				status := &statuses[i]
+				if status.Status != NotifyStatusApplied {
+					return
+				}
+
+				err := notifyBatchRevert(clients[i], changes[:status.Applied])
+				if err != nil {
+					status.Err = fmt.Errorf("Failed to revert after other members failed: %v", err)
+					return
+				}
+
+				status.Status = NotifyStatusReverted
+				status.Applied = 0
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	for _, peer := range skipped {
+		statuses = append(statuses, NotifyMemberStatus{
+			Name:    peer.Name,
+			Address: peer.Address,
+			Status:  NotifyStatusSkipped,
+		})
+	}
+
+	for _, status := range statuses {
+		if status.Err != nil {
+			logger.Warnf("Changes to cluster member %s %s: %v", status.Name, status.Status, status.Err)
+		} else {
+			logger.Debugf("Changes to cluster member %s %s", status.Name, status.Status)
+		}
+	}
+
+	if failed {
+		return statuses, NotifyBatchError{Statuses: statuses}
+	}
+
+	return statuses, nil
+}
+
+// Apply the given changes on a member, reverting the applied ones if one of
+// them fails, and return the client used to reach it.
+func notifyBatchApply(status *NotifyMemberStatus, cert *shared.CertInfo, changes []NotifyChange) lxd.InstanceServer {
+	client, err := Connect(status.Address, cert, true)
+	if err != nil {
+		status.Status = NotifyStatusFailed
+		status.Err = fmt.Errorf("Failed to connect: %v", err)
+		return nil
+	}
+
+	for _, change := range changes {
+		status.Attempts = 0
+		err = notifyBatchRetry(func() error {
+			status.Attempts++
+			return change.Apply(client)
+		})
+		if err != nil {
+			err = fmt.Errorf("Failed to %s: %v", change.Description, err)
+			break
+		}
+
+		status.Applied++
+	}
+
+	if err == nil {
+		status.Status = NotifyStatusApplied
+		return client
+	}
+
+	status.Status = NotifyStatusFailed
+	status.Err = err
+
+	if status.Applied == 0 {
+		return client
+	}
+
+	revertErr := notifyBatchRevert(client, changes[:status.Applied])
+	if revertErr != nil {
+		status.Err = fmt.Errorf("%v (and failed to revert: %v)", err, revertErr)
+		return client
+	}
+
+	status.Applied = 0
+
+	return client
+}
+
+// Revert the given changes on a member, in reverse order.
+func notifyBatchRevert(client lxd.InstanceServer, changes []NotifyChange) error {
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if change.Revert == nil {
+			return fmt.Errorf("No way to revert %q", change.Description)
+		}
+
+		err := notifyBatchRetry(func() error { return change.Revert(client) })
+		if err != nil {
+			return fmt.Errorf("Failed to revert %q: %v", change.Description, err)
+		}
+	}
+
+	return nil
+}
+
+// Run the given function, retrying it when the member can't be reached.
+func notifyBatchRetry(f func() error) error {
+	var err error
+	for i := 0; i < notifyBatchAttempts; i++ {
+		if i > 0 {
+			time.Sleep(notifyBatchDelay * time.Duration(i))
+		}
+
+		err = f()
+		if err == nil || !isClientConnectionError(err) {
+			return err
+		}
+	}
+
+	return err
+}
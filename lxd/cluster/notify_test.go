@@ -1,6 +1,7 @@
 package cluster_test
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -96,6 +97,92 @@ func TestNewNotify_NotifyAlive(t *testing.T) {
 	assert.Equal(t, 1, i)
 }
 
+// A batch of changes is applied on all the other nodes.
+func TestNotifyBatch(t *testing.T) {
+	state, cleanup := state.NewTestState(t)
+	defer cleanup()
+
+	cert := shared.TestingKeyPair()
+
+	f := notifyFixtures{t: t, state: state}
+	defer f.Nodes(cert, 3)()
+
+	calls := make(chan string, 4)
+	change := func(name string) cluster.NotifyChange {
+		return cluster.NotifyChange{
+			Description: name,
+			Apply: func(client lxd.InstanceServer) error {
+				calls <- name
+				return nil
+			},
+		}
+	}
+
+	changes := []cluster.NotifyChange{change("first"), change("second")}
+	statuses, err := cluster.NotifyBatch(state, cert, cluster.NotifyAll, changes)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	for _, status := range statuses {
+		assert.Equal(t, cluster.NotifyStatusApplied, status.Status)
+		assert.Equal(t, 2, status.Applied)
+	}
+
+	assert.Len(t, calls, 4)
+}
+
+// If a change fails on a node, the nodes on which all the changes were
+// applied are reverted.
+func TestNotifyBatch_Revert(t *testing.T) {
+	state, cleanup := state.NewTestState(t)
+	defer cleanup()
+
+	cert := shared.TestingKeyPair()
+
+	f := notifyFixtures{t: t, state: state}
+	defer f.Nodes(cert, 3)()
+
+	failing := f.Address(1)
+	reverted := make(chan string, 2)
+	changes := []cluster.NotifyChange{{
+		Description: "change",
+		Apply: func(client lxd.InstanceServer) error {
+			server, _, err := client.GetServer()
+			require.NoError(t, err)
+
+			if server.Config["cluster.https_address"].(string) == failing {
+				return fmt.Errorf("boom")
+			}
+
+			return nil
+		},
+		Revert: func(client lxd.InstanceServer) error {
+			server, _, err := client.GetServer()
+			require.NoError(t, err)
+
+			reverted <- server.Config["cluster.https_address"].(string)
+			return nil
+		},
+	}}
+
+	statuses, err := cluster.NotifyBatch(state, cert, cluster.NotifyAll, changes)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+	require.Len(t, statuses, 2)
+
+	for _, status := range statuses {
+		if status.Address == failing {
+			assert.Equal(t, cluster.NotifyStatusFailed, status.Status)
+		} else {
+			assert.Equal(t, cluster.NotifyStatusReverted, status.Status)
+		}
+
+		assert.Equal(t, 0, status.Applied)
+	}
+
+	require.Len(t, reverted, 1)
+	assert.Equal(t, f.Address(2), <-reverted)
+}
+
 // Helper for setting fixtures for Notify tests.
 type notifyFixtures struct {
 	t     *testing.T
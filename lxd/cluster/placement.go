@@ -0,0 +1,86 @@
+package cluster
+
+// PlacementCandidate describes a cluster member which could host a new
+// instance, along with the state of the storage pool of the instance's root
+// disk on that member.
+type PlacementCandidate struct {
+	Name       string
+	Containers int    // Number of instances on the member
+	Healthy    bool   // Whether the pool is created and in sync on the member
+	Used       uint64 // Used space in the pool, in bytes
+	Total      uint64 // Total space in the pool, in bytes (0 if unknown)
+}
+
+// PlacementPick returns the name of the member which should host a new
+// instance whose root disk needs the given number of bytes, or an empty
+// string if none can.
+//
+// Members whose pool is unhealthy, lacks the requested space, or is used at
+// or above the act fraction are never picked. Among the others, the ones whose
+// pool is used below the warn fraction are preferred, picking the one with
+// the least instances and then the most free space. If all pools are above
+// the warn fraction, the member with the most free space is picked.
+func PlacementPick(candidates []PlacementCandidate, size uint64, warn float64, act float64) string {
+	usable := []PlacementCandidate{}
+	preferred := []PlacementCandidate{}
+	for _, candidate := range candidates {
+		if !candidate.Healthy {
+			continue
+		}
+
+		// Pools which can't report their capacity are assumed to have
+		// enough space.
+		if candidate.Total == 0 {
+			preferred = append(preferred, candidate)
+			usable = append(usable, candidate)
+			continue
+		}
+
+		if candidate.Used+size > candidate.Total {
+			continue
+		}
+
+		usage := float64(candidate.Used) / float64(candidate.Total)
+		if usage >= act {
+			continue
+		}
+
+		if usage < warn {
+			preferred = append(preferred, candidate)
+		}
+
+		usable = append(usable, candidate)
+	}
+
+	if len(preferred) > 0 {
+		best := preferred[0]
+		for _, candidate := range preferred[1:] {
+			if candidate.Containers < best.Containers || (candidate.Containers == best.Containers && placementFree(candidate) > placementFree(best)) {
+				best = candidate
+			}
+		}
+
+		return best.Name
+	}
+
+	if len(usable) > 0 {
+		best := usable[0]
+		for _, candidate := range usable[1:] {
+			if placementFree(candidate) > placementFree(best) {
+				best = candidate
+			}
+		}
+
+		return best.Name
+	}
+
+	return ""
+}
+
+func placementFree(candidate PlacementCandidate) uint64 {
+	if candidate.Total == 0 {
+		return 0
+	}
+
+	return candidate.Total - candidate.Used
+}
@@ -0,0 +1,36 @@
+package cluster_test
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+// Members whose pool is unhealthy or too full are skipped, and among the
+// others the one with the least instances is picked.
+func TestPlacementPick(t *testing.T) {
+	candidates := []cluster.PlacementCandidate{
+		{Name: "node1", Containers: 1, Healthy: false, Used: 10, Total: 100},
+		{Name: "node2", Containers: 2, Healthy: true, Used: 96, Total: 100},
+		{Name: "node3", Containers: 4, Healthy: true, Used: 50, Total: 100},
+		{Name: "node4", Containers: 5, Healthy: true, Used: 20, Total: 100},
+	}
+
+	assert.Equal(t, "node3", cluster.PlacementPick(candidates, 0, 0.8, 0.95))
+
+	// The requested size must fit in the pool.
+	assert.Equal(t, "node4", cluster.PlacementPick(candidates, 60, 0.8, 0.95))
+	assert.Equal(t, "", cluster.PlacementPick(candidates, 90, 0.8, 0.95))
+}
+
+// If all pools are above their warning level, the member with the most free
+// space is picked.
+func TestPlacementPick_AboveWarning(t *testing.T) {
+	candidates := []cluster.PlacementCandidate{
+		{Name: "node1", Containers: 3, Healthy: true, Used: 81, Total: 100},
+		{Name: "node2", Containers: 0, Healthy: true, Used: 82, Total: 100},
+	}
+
+	assert.Equal(t, "node1", cluster.PlacementPick(candidates, 0, 0.8, 0.95))
+}
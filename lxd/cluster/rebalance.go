@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"sort"
+)
+
+// RebalanceThreshold is the minimum load difference between the most and
+// least loaded members for instances to be moved between them.
+const RebalanceThreshold = 0.1
+
+// RebalanceMember holds the capacity of a cluster member, as considered when
+// rebalancing instances.
+type RebalanceMember struct {
+	Name         string
+	CPU          float64 // Number of CPU threads
+	Memory       float64 // Memory, in bytes
+	StorageUsed  float64 // Used space across all storage pools, in bytes
+	StorageTotal float64 // Total space across all storage pools, in bytes
+}
+
+// RebalanceInstance holds the resources allocated to an instance, as
+// considered when rebalancing instances.
+type RebalanceInstance struct {
+	Project string
+	Name    string
+	Member  string
+	CPU     float64 // Number of CPU threads
+	Memory  float64 // Memory, in bytes
+	Movable bool    // Whether the instance can be moved to another member
+}
+
+// RebalanceMove is an instance move suggested to rebalance the cluster.
+type RebalanceMove struct {
+	Project string
+	Name    string
+	Source  string
+	Target  string
+}
+
+// RebalanceLoad returns the CPU, memory and storage load of each member, as
+// fractions of its capacity.
+func RebalanceLoad(members []RebalanceMember, instances []RebalanceInstance) map[string][3]float64 {
+	cpu := map[string]float64{}
+	memory := map[string]float64{}
+	for _, inst := range instances {
+		cpu[inst.Member] += inst.CPU
+		memory[inst.Member] += inst.Memory
+	}
+
+	load := map[string][3]float64{}
+	for _, member := range members {
+		load[member.Name] = [3]float64{
+			ratio(cpu[member.Name], member.CPU),
+			ratio(memory[member.Name], member.Memory),
+			ratio(member.StorageUsed, member.StorageTotal),
+		}
+	}
+
+	return load
+}
+
+// RebalancePlan suggests a list of at most maxMoves instance moves which
+// reduce the load difference between the given members. The load of a member
+// is its most loaded resource, as returned by RebalanceLoad.
+//
+// Each step moves one of the movable instances of the most loaded member to
+// the least loaded one, picking the instance which brings both members
+// closest, until their load difference drops under RebalanceThreshold or no
+// move would help.
+func RebalancePlan(members []RebalanceMember, instances []RebalanceInstance, maxMoves int) []RebalanceMove {
+	moves := []RebalanceMove{}
+	if len(members) < 2 {
+		return moves
+	}
+
+	// Work on copies, sorted so that the plan is stable.
+	members = append([]RebalanceMember{}, members...)
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+
+	instances = append([]RebalanceInstance{}, instances...)
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Project != instances[j].Project {
+			return instances[i].Project < instances[j].Project
+		}
+
+		return instances[i].Name < instances[j].Name
+	})
+
+	moved := map[int]bool{}
+	for len(moves) < maxMoves {
+		load := RebalanceLoad(members, instances)
+
+		source := members[0]
+		target := members[0]
+		for _, member := range members[1:] {
+			if maxLoad(load[member.Name]) > maxLoad(load[source.Name]) {
+				source = member
+			}
+
+			if maxLoad(load[member.Name]) < maxLoad(load[target.Name]) {
+				target = member
+			}
+		}
+
+		current := maxLoad(load[source.Name])
+		if current-maxLoad(load[target.Name]) < RebalanceThreshold {
+			break
+		}
+
+		// Pick the instance whose move leaves the most loaded of the two
+		// members the least loaded.
+		best := -1
+		bestLoad := current
+		for i, inst := range instances {
+			if inst.Member != source.Name || !inst.Movable || moved[i] {
+				continue
+			}
+
+			sourceLoad := load[source.Name]
+			sourceLoad[0] -= ratio(inst.CPU, source.CPU)
+			sourceLoad[1] -= ratio(inst.Memory, source.Memory)
+
+			targetLoad := load[target.Name]
+			targetLoad[0] += ratio(inst.CPU, target.CPU)
+			targetLoad[1] += ratio(inst.Memory, target.Memory)
+
+			newLoad := maxLoad(sourceLoad)
+			if maxLoad(targetLoad) > newLoad {
+				newLoad = maxLoad(targetLoad)
+			}
+
+			if newLoad < bestLoad {
+				best = i
+				bestLoad = newLoad
+			}
+		}
+
+		if best == -1 {
+			break
+		}
+
+		moves = append(moves, RebalanceMove{
+			Project: instances[best].Project,
+			Name:    instances[best].Name,
+			Source:  source.Name,
+			Target:  target.Name,
+		})
+
+		instances[best].Member = target.Name
+		moved[best] = true
+	}
+
+	return moves
+}
+
+func ratio(used float64, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return used / total
+}
+
+func maxLoad(load [3]float64) float64 {
+	max := load[0]
+	for _, value := range load[1:] {
+		if value > max {
+			max = value
+		}
+	}
+
+	return max
+}
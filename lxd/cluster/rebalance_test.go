@@ -0,0 +1,48 @@
+package cluster_test
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+// Movable instances are moved from the most loaded member to the least loaded
+// one, until their load is close enough.
+func TestRebalancePlan(t *testing.T) {
+	members := []cluster.RebalanceMember{
+		{Name: "node1", CPU: 4, Memory: 4096},
+		{Name: "node2", CPU: 4, Memory: 4096},
+	}
+
+	instances := []cluster.RebalanceInstance{
+		{Project: "default", Name: "c1", Member: "node1", CPU: 1, Memory: 1024, Movable: true},
+		{Project: "default", Name: "c2", Member: "node1", CPU: 1, Memory: 1024, Movable: false},
+		{Project: "default", Name: "c3", Member: "node1", CPU: 2, Memory: 512, Movable: true},
+		{Project: "default", Name: "c4", Member: "node2", CPU: 0, Memory: 512, Movable: true},
+	}
+
+	moves := cluster.RebalancePlan(members, instances, 10)
+	assert.Equal(t, []cluster.RebalanceMove{
+		{Project: "default", Name: "c3", Source: "node1", Target: "node2"},
+	}, moves)
+
+	// The number of moves is capped.
+	moves = cluster.RebalancePlan(members, instances, 0)
+	assert.Len(t, moves, 0)
+}
+
+// Nothing is moved if it wouldn't reduce the load of the most loaded member.
+func TestRebalancePlan_NoImprovement(t *testing.T) {
+	members := []cluster.RebalanceMember{
+		{Name: "node1", CPU: 4, Memory: 4096},
+		{Name: "node2", CPU: 4, Memory: 4096},
+	}
+
+	instances := []cluster.RebalanceInstance{
+		{Project: "default", Name: "c1", Member: "node1", CPU: 4, Memory: 1024, Movable: true},
+	}
+
+	moves := cluster.RebalancePlan(members, instances, 10)
+	assert.Len(t, moves, 0)
+}
@@ -39,3 +39,34 @@ func ResolveTarget(cluster *db.Cluster, target string) (string, error) {
 
 	return address, err
 }
+
+// CheckPlacementTarget returns an error if the given cluster member is in
+// maintenance, in which case it can't be the target of new instances or
+// storage volumes. An empty target refers to the local member.
+func CheckPlacementTarget(cluster *db.Cluster, target string) error {
+	return cluster.Transaction(func(tx *db.ClusterTx) error {
+		if target == "" {
+			name, err := tx.NodeName()
+			if err != nil {
+				return err
+			}
+
+			target = name
+		}
+
+		node, err := tx.NodeByName(target)
+		if err != nil {
+			if err == db.ErrNoSuchObject {
+				return fmt.Errorf("No cluster member called '%s'", target)
+			}
+
+			return err
+		}
+
+		if node.Maintenance {
+			return fmt.Errorf("Cluster member '%s' is in maintenance", node.Name)
+		}
+
+		return nil
+	})
+}
@@ -1,15 +1,64 @@
 package cluster
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 )
 
+// Cluster certificates which are trusted in addition to the current one while
+// the cluster certificate is being rotated: the new certificate before this
+// node switches to it, and the old one afterwards, until all nodes switched.
+var tlsExtraCerts = struct {
+	mu    sync.RWMutex
+	certs []x509.Certificate
+}{}
+
+// TLSTrustCert makes the given cluster certificate trusted in addition to the
+// current one, both when nodes connect to this one and when this node connects
+// to other nodes.
+func TLSTrustCert(cert *x509.Certificate) {
+	tlsExtraCerts.mu.Lock()
+	defer tlsExtraCerts.mu.Unlock()
+
+	tlsExtraCerts.certs = append(tlsExtraCerts.certs, *cert)
+}
+
+// TLSUntrustCerts stops trusting the certificates passed to TLSTrustCert.
+func TLSUntrustCerts() {
+	tlsExtraCerts.mu.Lock()
+	defer tlsExtraCerts.mu.Unlock()
+
+	tlsExtraCerts.certs = nil
+}
+
+// TLSTrustedCerts returns the cluster certificates presented by other nodes
+// which this node trusts, that is the given current one plus any additional
+// one trusted during a rotation.
+func TLSTrustedCerts(info *shared.CertInfo) (map[string]x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(info.KeyPair().Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	trustedCerts := map[string]x509.Certificate{"0": *cert}
+
+	tlsExtraCerts.mu.RLock()
+	defer tlsExtraCerts.mu.RUnlock()
+
+	for i, extra := range tlsExtraCerts.certs {
+		trustedCerts[fmt.Sprintf("%d", i+1)] = extra
+	}
+
+	return trustedCerts, nil
+}
+
 // Return a TLS configuration suitable for establishing inter-node network
 // connections using the cluster certificate.
 func tlsClientConfig(info *shared.CertInfo) (*tls.Config, error) {
@@ -34,19 +83,45 @@ func tlsClientConfig(info *shared.CertInfo) (*tls.Config, error) {
 	if cert.DNSNames != nil {
 		config.ServerName = cert.DNSNames[0]
 	}
+
+	trustedCerts, err := TLSTrustedCerts(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// While the cluster certificate is being rotated other nodes might
+	// present either the old or the new one, possibly with different
+	// names, so just check that they present one of them.
+	if len(trustedCerts) > 1 {
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("No certificate presented by the remote node")
+			}
+
+			for _, trusted := range trustedCerts {
+				if bytes.Equal(trusted.Raw, rawCerts[0]) {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("The remote node isn't using a cluster certificate")
+		}
+	}
+
 	return config, nil
 }
 
-// Return true if the given request is presenting the given cluster certificate.
+// Return true if the given request is presenting the given cluster certificate,
+// or one of the additional ones trusted during a rotation.
 func tlsCheckCert(r *http.Request, info *shared.CertInfo) bool {
-	cert, err := x509.ParseCertificate(info.KeyPair().Certificate[0])
+	trustedCerts, err := TLSTrustedCerts(info)
 	if err != nil {
 		// Since we have already loaded this certificate, typically
 		// using LoadX509KeyPair, an error should never happen, but
 		// check for good measure.
 		panic(fmt.Sprintf("invalid keypair material: %v", err))
 	}
-	trustedCerts := map[string]x509.Certificate{"0": *cert}
 
 	trusted, _ := util.CheckTrustState(*r.TLS.PeerCertificates[0], trustedCerts)
 
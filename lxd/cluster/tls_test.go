@@ -0,0 +1,43 @@
+package cluster_test
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// While a rotation is in progress, the additional certificate is trusted too,
+// and remote nodes are checked against both.
+func TestTLSTrustCert(t *testing.T) {
+	cert := shared.TestingKeyPair()
+	alt := shared.TestingAltKeyPair()
+
+	trusted, err := cluster.TLSTrustedCerts(cert)
+	require.NoError(t, err)
+	assert.Len(t, trusted, 1)
+
+	config, err := cluster.TLSClientConfig(cert)
+	require.NoError(t, err)
+	assert.Nil(t, config.VerifyPeerCertificate)
+
+	altCert, err := x509.ParseCertificate(alt.KeyPair().Certificate[0])
+	require.NoError(t, err)
+
+	cluster.TLSTrustCert(altCert)
+	defer cluster.TLSUntrustCerts()
+
+	trusted, err = cluster.TLSTrustedCerts(cert)
+	require.NoError(t, err)
+	assert.Len(t, trusted, 2)
+
+	config, err = cluster.TLSClientConfig(cert)
+	require.NoError(t, err)
+	require.NotNil(t, config.VerifyPeerCertificate)
+	assert.NoError(t, config.VerifyPeerCertificate([][]byte{alt.KeyPair().Certificate[0]}, nil))
+	assert.NoError(t, config.VerifyPeerCertificate([][]byte{cert.KeyPair().Certificate[0]}, nil))
+	assert.Error(t, config.VerifyPeerCertificate([][]byte{[]byte("garbage")}, nil))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// Kinds of entities whose changes are queued for the nodes which were offline
+// when they were made.
+const (
+	clusterChangeStoragePool = "storage-pool"
+	clusterChangeNetwork     = "network"
+	clusterChangeProfile     = "profile"
+)
+
+// clusterChangeQueue records a change for the nodes which were skipped when it
+// was propagated, because they were offline. The previous state of the entity
+// is what the nodes compare its current state with once they're back.
+func clusterChangeQueue(d *Daemon, statuses []cluster.NotifyMemberStatus, entity, project, name string, previous interface{}) error {
+	nodes := []string{}
+	for _, status := range statuses {
+		if status.Status == cluster.NotifyStatusSkipped {
+			nodes = append(nodes, status.Name)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(previous)
+	if err != nil {
+		return err
+	}
+
+	return d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		for _, node := range nodes {
+			err := tx.NodePendingChangeAdd(node, entity, project, name, string(data))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// clusterReconcileTask applies the changes made while this node was offline.
+func clusterReconcileTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		err := clusterReconcile(d)
+		if err != nil {
+			logger.Error("Failed to apply the pending cluster changes", log.Ctx{"err": err})
+		}
+	}
+
+	return f, task.Every(time.Minute)
+}
+
+func clusterReconcile(d *Daemon) error {
+	var changes []db.NodePendingChange
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		name, err := tx.NodeName()
+		if err != nil {
+			return err
+		}
+
+		changes, err = tx.NodePendingChanges(name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		logCtx := log.Ctx{"entity": change.Entity, "project": change.Project, "name": change.Name}
+
+		applyErr := clusterReconcileChange(d, change)
+		if applyErr == db.ErrNoSuchObject {
+			// The entity was deleted in the meantime.
+			applyErr = nil
+		}
+
+		err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+			if applyErr != nil {
+				return tx.NodePendingChangeError(change.ID, applyErr.Error())
+			}
+
+			return tx.NodePendingChangeDelete(change.ID)
+		})
+		if err != nil {
+			return err
+		}
+
+		if applyErr != nil {
+			// Only log the failure the first time.
+			if applyErr.Error() != change.Error {
+				logCtx["err"] = applyErr
+				logger.Warn("Failed to apply the changes made while offline", logCtx)
+			}
+
+			continue
+		}
+
+		logger.Info("Applied the changes made while offline", logCtx)
+	}
+
+	return nil
+}
+
+// Apply the changes made to an entity since it was in the given previous state.
+func clusterReconcileChange(d *Daemon, change db.NodePendingChange) error {
+	switch change.Entity {
+	case clusterChangeStoragePool:
+		previous := api.StoragePoolPut{}
+		err := json.Unmarshal([]byte(change.Previous), &previous)
+		if err != nil {
+			return err
+		}
+
+		return storagePoolUpdateCluster(d.State(), change.Name, previous)
+	case clusterChangeNetwork:
+		previous := api.NetworkPut{}
+		err := json.Unmarshal([]byte(change.Previous), &previous)
+		if err != nil {
+			return err
+		}
+
+		return doNetworkUpdateCluster(d, change.Name, previous)
+	case clusterChangeProfile:
+		previous := api.ProfilePut{}
+		err := json.Unmarshal([]byte(change.Previous), &previous)
+		if err != nil {
+			return err
+		}
+
+		return doProfileUpdateCluster(d, change.Project, change.Name, previous)
+	}
+
+	return fmt.Errorf("Unknown kind of change %q", change.Entity)
+}
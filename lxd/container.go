@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	lxc "gopkg.in/lxc/go-lxc.v2"
 	cron "gopkg.in/robfig/cron.v2"
@@ -24,11 +25,13 @@ import (
 	deviceConfig "github.com/lxc/lxd/lxd/device/config"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/seccomp"
 	"github.com/lxc/lxd/lxd/state"
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/lxd/sys"
 	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/idmap"
@@ -106,6 +109,20 @@ func containerValidConfigKey(os *sys.OS, key string, value string) error {
 	if key == "raw.lxc" {
 		return lxcValidConfig(value)
 	}
+	if key == "webhooks.url" {
+		return webhook.ValidateURL(value)
+	}
+	if key == "security.syscalls.intercept.mount.allowed" {
+		return seccomp.ValidateMountAllowed(value)
+	}
+	if key == "security.syscalls.intercept.mount.fuse" {
+		_, err := seccomp.ParseMountFuse(value)
+		return err
+	}
+	if key == "security.syscalls.intercept.mknod.devices" {
+		_, err := seccomp.ParseMknodDevices(value)
+		return err
+	}
 	if key == "security.syscalls.blacklist_compat" {
 		for _, arch := range os.Architectures {
 			if arch == osarch.ARCH_64BIT_INTEL_X86 ||
@@ -168,6 +185,13 @@ func containerValidConfig(sysOS *sys.OS, config map[string]string, profile bool,
 		return fmt.Errorf("security.syscalls.whitelist is mutually exclusive with security.syscalls.blacklist*")
 	}
 
+	if expanded {
+		err := seccomp.ValidateIntercept(config)
+		if err != nil {
+			return err
+		}
+	}
+
 	if expanded && (config["security.privileged"] == "" || !shared.IsTrue(config["security.privileged"])) && sysOS.IdmapSet == nil {
 		return fmt.Errorf("LXD doesn't have a uid/gid allocation. In this mode, only privileged containers are supported")
 	}
@@ -239,12 +263,15 @@ type container interface {
 
 	ConsoleLog(opts lxc.ConsoleLogOptions) (string, error)
 
+	ExportDiff(w io.Writer, from Instance) error
+	ExportOCI(w io.Writer, instanceOnly bool) error
+
 	// Status
 	IsNesting() bool
 
 	// Hooks
 	OnStart() error
-	OnStopNS(target string, netns string) error
+	OnStopNS(target string, netns string, userns string) error
 	OnStop(target string) error
 
 	InsertSeccompUnixDevice(prefix string, m deviceConfig.Device, pid int) error
@@ -302,13 +329,16 @@ func instanceCreateAsEmpty(d *Daemon, args db.InstanceArgs) (Instance, error) {
 	return inst, nil
 }
 
+// containerCreateFromBackup unpacks the storage volume of a container from a backup tarball. It
+// returns a function which deletes the volume again, to be called if importing the container
+// fails.
 func containerCreateFromBackup(s *state.State, info backup.Info, data io.ReadSeeker,
-	customPool bool) (storage, error) {
-	var pool storage
+	customPool bool) (func(), error) {
 	var fixBackupFile = false
 
 	// Get storage pool from index.yaml
-	pool, storageErr := storagePoolInit(s, info.Pool)
+	poolName := info.Pool
+	_, storageErr := storagePoolInit(s, poolName)
 	if storageErr != nil && errors.Cause(storageErr) != db.ErrNoSuchObject {
 		// Unexpected error
 		return nil, storageErr
@@ -333,7 +363,8 @@ func containerCreateFromBackup(s *state.State, info backup.Info, data io.ReadSee
 		}
 
 		// Use the default-profile's root pool
-		pool, err = storagePoolInit(s, v["pool"])
+		poolName = v["pool"]
+		_, err = storagePoolInit(s, poolName)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to initialize storage pool")
 		}
@@ -384,29 +415,52 @@ func containerCreateFromBackup(s *state.State, info backup.Info, data io.ReadSee
 		}
 		tarData.Seek(0, 0)
 
-		// Unpack tarball from decompressed temporary file
-		err = pool.ContainerBackupLoad(info, tarData, tarArgs)
+		// Unpack the tarball from the decompressed temporary file
+		data = tarData
+	}
+
+	var revertFunc func()
+
+	// Check if we can load new storage layer for pool driver type.
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != storageDrivers.ErrUnknownDriver {
 		if err != nil {
 			return nil, err
 		}
 
+		// Restores onto a pool of a different driver than the one which wrote the backup
+		// fall back to the generic format, optimized backups can't be converted.
+		revertFunc, err = pool.CreateInstanceFromBackup(info, data, nil)
+		if err != nil {
+			return nil, err
+		}
 	} else {
+		legacyPool, err := storagePoolInit(s, poolName)
+		if err != nil {
+			return nil, err
+		}
+
 		// Unpack tarball
-		err = pool.ContainerBackupLoad(info, data, tarArgs)
+		err = legacyPool.ContainerBackupLoad(info, data, tarArgs)
 		if err != nil {
 			return nil, err
 		}
+
+		revertFunc = func() {
+			legacyPool.ContainerDelete(&containerLXC{name: info.Name, project: info.Project})
+		}
 	}
 
 	if fixBackupFile || customPool {
 		// Update the pool
 		err = backupFixStoragePool(s.Cluster, info, !customPool)
 		if err != nil {
+			revertFunc()
 			return nil, err
 		}
 	}
 
-	return pool, nil
+	return revertFunc, nil
 }
 
 func containerCreateEmptySnapshot(s *state.State, args db.InstanceArgs) (Instance, error) {
@@ -447,7 +501,7 @@ func instanceCreateFromImage(d *Daemon, args db.InstanceArgs, hash string, op *o
 	}
 
 	// Check if the image is available locally or it's on another node.
-	nodeAddress, err := s.Cluster.ImageLocate(hash)
+	nodeAddress, err := imageLocate(d, args.Project, hash)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Locate image %s in the cluster", hash)
 	}
@@ -543,10 +597,14 @@ func instanceCreateFromImage(d *Daemon, args db.InstanceArgs, hash string, op *o
 	return inst, nil
 }
 
-func containerCreateAsCopy(s *state.State, args db.InstanceArgs, sourceContainer Instance, containerOnly bool, refresh bool) (Instance, error) {
+func containerCreateAsCopy(s *state.State, args db.InstanceArgs, sourceContainer Instance, containerOnly bool, selection string, refresh bool) (Instance, error) {
 	var ct Instance
 	var err error
 
+	if selection == "none" {
+		containerOnly = true
+	}
+
 	if refresh {
 		// Load the target container
 		ct, err = instanceLoadByProjectAndName(s, args.Project, args.Name)
@@ -596,8 +654,13 @@ func containerCreateAsCopy(s *state.State, args db.InstanceArgs, sourceContainer
 				}
 			}
 
-			// Only care about the snapshots that need updating
-			snapshots = syncSnapshots
+			// Only care about the selected snapshots that need updating
+			for _, snap := range syncSnapshots {
+				_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snap.Name())
+				if migrationSnapshotSelected(selection, snapName) {
+					snapshots = append(snapshots, snap)
+				}
+			}
 		} else {
 			// Get snapshots of source container
 			snapshots, err = sourceContainer.Snapshots()
@@ -697,8 +760,16 @@ func containerCreateAsCopy(s *state.State, args db.InstanceArgs, sourceContainer
 
 	if !containerOnly {
 		for _, cs := range csList {
-			// Apply any post-storage configuration.
-			err = containerConfigureInternal(s, *cs)
+			// The storage drivers copy all the snapshots of the source, drop the ones left out
+			// of the selection.
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName((*cs).Name())
+			if !migrationSnapshotSelected(selection, snapName) {
+				err = (*cs).Delete()
+			} else {
+				// Apply any post-storage configuration.
+				err = containerConfigureInternal(s, *cs)
+			}
+
 			if err != nil {
 				if !refresh {
 					ct.Delete()
@@ -712,11 +783,96 @@ func containerCreateAsCopy(s *state.State, args db.InstanceArgs, sourceContainer
 	return ct, nil
 }
 
+// containerCreateAsClone creates a new container as a copy-on-write clone of the current state of
+// the source container, without its snapshots. The clone shares its data with the source until it's
+// flattened.
+func containerCreateAsClone(s *state.State, args db.InstanceArgs, sourceContainer Instance) (Instance, error) {
+	ct, err := instanceCreateInternal(s, args)
+	if err != nil {
+		return nil, err
+	}
+
+	revert := true
+	defer func() {
+		if revert {
+			ct.Delete()
+		}
+	}()
+
+	cloner, ok := ct.Storage().(storageCloner)
+	if !ok {
+		return nil, fmt.Errorf("The storage pool driver doesn't support copy-on-write clones")
+	}
+
+	sourcePool, err := sourceContainer.StoragePool()
+	if err != nil {
+		return nil, err
+	}
+
+	targetPool, err := ct.StoragePool()
+	if err != nil {
+		return nil, err
+	}
+
+	if sourcePool != targetPool {
+		return nil, fmt.Errorf("Clones must be created on the storage pool of their source")
+	}
+
+	err = cloner.ContainerClone(ct, sourceContainer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply any post-storage configuration.
+	err = containerConfigureInternal(s, ct)
+	if err != nil {
+		return nil, err
+	}
+
+	revert = false
+	return ct, nil
+}
+
+// containerFlattenBackground starts an operation making a cloned container independent of its
+// source.
+func containerFlattenBackground(s *state.State, c Instance) error {
+	cloner, ok := c.Storage().(storageCloner)
+	if !ok {
+		return fmt.Errorf("The storage pool driver doesn't support copy-on-write clones")
+	}
+
+	run := func(op *operations.Operation) error {
+		err := cloner.ContainerFlatten(c)
+		if err != nil {
+			logger.Error("Failed to flatten container", log.Ctx{"container": c.Name(), "err": err})
+			return err
+		}
+
+		return nil
+	}
+
+	resources := map[string][]string{}
+	resources["containers"] = []string{c.Name()}
+
+	op, err := operations.OperationCreate(s, c.Project(), operations.OperationClassTask, db.OperationContainerFlatten, resources, nil, run, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = op.Run()
+	return err
+}
+
 func containerCreateAsSnapshot(s *state.State, args db.InstanceArgs, sourceInstance Instance) (Instance, error) {
 	if sourceInstance.Type() != instancetype.Container {
 		return nil, fmt.Errorf("Instance not container type")
 	}
 
+	err := projectSnapshotsLimitCheck(s, args.Project)
+	if err != nil {
+		return nil, err
+	}
+
 	// Deal with state
 	if args.Stateful {
 		if !sourceInstance.IsRunning() {
@@ -796,16 +952,26 @@ func containerCreateAsSnapshot(s *state.State, args db.InstanceArgs, sourceInsta
 		os.RemoveAll(sourceInstance.StatePath())
 	}
 
+	lifecycleContext := map[string]interface{}{
+		"snapshot_name": args.Name,
+	}
+
+	webhook.SendLifecycle(sourceInstance.ExpandedConfig(), sourceInstance.Project(), "container-snapshot-created",
+		fmt.Sprintf("/1.0/containers/%s", sourceInstance.Name()), lifecycleContext)
 	s.Events.SendLifecycle(sourceInstance.Project(), "container-snapshot-created",
-		fmt.Sprintf("/1.0/containers/%s", sourceInstance.Name()),
-		map[string]interface{}{
-			"snapshot_name": args.Name,
-		})
+		fmt.Sprintf("/1.0/containers/%s", sourceInstance.Name()), lifecycleContext)
+
+	err = instanceHostHook(s, sourceInstance, instanceHookPostSnapshot, map[string]string{"LXD_SNAPSHOT_NAME": args.Name})
+	if err != nil {
+		logger.Error("Failed to run post-snapshot hook", log.Ctx{"container": sourceInstance.Name(), "err": err})
+	}
 
 	return c, nil
 }
 
-func instanceCreateInternal(s *state.State, args db.InstanceArgs) (Instance, error) {
+// instanceCreateValidate fills in the default values of the supplied instance creation arguments
+// and validates its name, config, devices, architecture and profiles.
+func instanceCreateValidate(s *state.State, args *db.InstanceArgs) error {
 	// Set default values.
 	if args.Project == "" {
 		args.Project = "default"
@@ -835,54 +1001,175 @@ func instanceCreateInternal(s *state.State, args db.InstanceArgs) (Instance, err
 	if !args.Snapshot {
 		err := containerValidName(args.Name)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// Unset expiry date since containers don't expire.
 		args.ExpiryDate = time.Time{}
 	}
 
+	// Give the instance a UUID.
+	err := instanceUUIDFill(s, args)
+	if err != nil {
+		return err
+	}
+
 	// Validate container config.
-	err := containerValidConfig(s.OS, args.Config, false, false)
+	err = containerValidConfig(s.OS, args.Config, false, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Validate container devices with the supplied container name and devices.
 	err = containerValidDevices(s, s.Cluster, args.Name, args.Devices, false)
 	if err != nil {
-		return nil, errors.Wrap(err, "Invalid devices")
+		return errors.Wrap(err, "Invalid devices")
 	}
 
 	// Validate architecture.
 	_, err = osarch.ArchitectureName(args.Architecture)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !shared.IntInSlice(args.Architecture, s.OS.Architectures) {
-		return nil, fmt.Errorf("Requested architecture isn't supported by this host")
+		return fmt.Errorf("Requested architecture isn't supported by this host")
 	}
 
 	// Validate profiles.
 	profiles, err := s.Cluster.Profiles(args.Project)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	checkedProfiles := []string{}
 	for _, profile := range args.Profiles {
 		if !shared.StringInSlice(profile, profiles) {
-			return nil, fmt.Errorf("Requested profile '%s' doesn't exist", profile)
+			return fmt.Errorf("Requested profile '%s' doesn't exist", profile)
 		}
 
 		if shared.StringInSlice(profile, checkedProfiles) {
-			return nil, fmt.Errorf("Duplicate profile found in request")
+			return fmt.Errorf("Duplicate profile found in request")
 		}
 
 		checkedProfiles = append(checkedProfiles, profile)
 	}
 
+	// Fall back to the default storage pool and network of the project.
+	if !args.Snapshot {
+		err = instanceApplyProjectDefaults(s, args)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// instanceUUIDFill sets the "volatile.uuid" of a new instance. A UUID coming with the instance,
+// e.g. when importing it from a backup, is kept as long as no other instance uses it, while
+// copies and snapshots, which come with the UUID of their source, get a new one.
+func instanceUUIDFill(s *state.State, args *db.InstanceArgs) error {
+	if args.Config["volatile.uuid"] != "" {
+		exists, err := s.Cluster.InstanceUUIDExists(args.Config["volatile.uuid"])
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return nil
+		}
+	}
+
+	// Don't modify the config of the source instance.
+	config := make(map[string]string, len(args.Config)+1)
+	for k, v := range args.Config {
+		config[k] = v
+	}
+
+	config["volatile.uuid"] = uuid.NewRandom().String()
+	args.Config = config
+
+	return nil
+}
+
+// instanceApplyProjectDefaults adds a root disk on the project's "default.storage.pool" and a NIC
+// on its "default.network" to the instance when neither its devices nor its profiles provide one.
+func instanceApplyProjectDefaults(s *state.State, args *db.InstanceArgs) error {
+	config, err := projectConfig(s.Cluster, args.Project)
+	if err != nil {
+		return errors.Wrap(err, "Failed to load project configuration")
+	}
+
+	if config["default.storage.pool"] == "" && config["default.network"] == "" {
+		return nil
+	}
+
+	profiles, err := s.Cluster.ProfilesGet(args.Project, args.Profiles)
+	if err != nil {
+		return err
+	}
+
+	hasRoot := false
+	hasNIC := false
+
+	check := func(devices map[string]map[string]string) {
+		for _, dev := range devices {
+			if shared.IsRootDiskDevice(dev) {
+				hasRoot = true
+			}
+
+			if dev["type"] == "nic" {
+				hasNIC = true
+			}
+		}
+	}
+
+	check(args.Devices.CloneNative())
+	for _, profile := range profiles {
+		check(profile.Devices)
+	}
+
+	// Pick a device name which isn't in use yet.
+	deviceName := func(name string) string {
+		devName := name
+		for i := 0; i < 100; i++ {
+			if args.Devices[devName] == nil {
+				break
+			}
+
+			devName = fmt.Sprintf("%s%d", name, i)
+		}
+
+		return devName
+	}
+
+	if !hasRoot && config["default.storage.pool"] != "" {
+		args.Devices[deviceName("root")] = deviceConfig.Device{
+			"type": "disk",
+			"path": "/",
+			"pool": config["default.storage.pool"],
+		}
+	}
+
+	if !hasNIC && config["default.network"] != "" {
+		args.Devices[deviceName("eth0")] = deviceConfig.Device{
+			"type":    "nic",
+			"nictype": "bridged",
+			"parent":  config["default.network"],
+			"name":    "eth0",
+		}
+	}
+
+	return nil
+}
+
+func instanceCreateInternal(s *state.State, args db.InstanceArgs) (Instance, error) {
+	err := instanceCreateValidate(s, &args)
+	if err != nil {
+		return nil, err
+	}
+
 	if args.CreationDate.IsZero() {
 		args.CreationDate = time.Now().UTC()
 	}
@@ -1020,6 +1307,21 @@ func instanceCreateInternal(s *state.State, args db.InstanceArgs) (Instance, err
 		return nil, errors.Wrap(err, "Create instance")
 	}
 
+	// Track the static addresses of the instance on its networks.
+	if !args.Snapshot {
+		allocations, err := networkAllocations(inst, inst.ExpandedDevices())
+		if err == nil {
+			err = s.Cluster.Transaction(func(tx *db.ClusterTx) error {
+				return tx.NetworkAllocationsSet(inst.ID(), allocations)
+			})
+		}
+
+		if err != nil {
+			inst.Delete()
+			return nil, err
+		}
+	}
+
 	revert = false
 	return inst, nil
 }
@@ -1362,6 +1664,35 @@ func containerCompareSnapshots(source Instance, target Instance) ([]Instance, []
 	return toSync, toDelete, nil
 }
 
+// snapshotIsScheduledNow returns whether a snapshot is due this minute according to the given
+// snapshots.schedule value.
+func snapshotIsScheduledNow(schedule string) bool {
+	if schedule == "" {
+		return false
+	}
+
+	// Extend our schedule to one that is accepted by the used cron parser
+	sched, err := cron.Parse(fmt.Sprintf("* %s", schedule))
+	if err != nil {
+		return false
+	}
+
+	// Truncate the time now back to the start of the minute, before passing to
+	// the cron scheduler, as it will add 1s to the scheduled time and we don't
+	// want the next scheduled time to roll over to the next minute and break
+	// the time comparison below.
+	now := time.Now().Truncate(time.Minute)
+
+	// Calculate the next scheduled time based on the snapshots.schedule
+	// pattern and the time now.
+	next := sched.Next(now)
+
+	// Ignore everything that is more precise than minutes.
+	next = next.Truncate(time.Minute)
+
+	return now.Equal(next)
+}
+
 func autoCreateContainerSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
 	f := func(ctx context.Context) {
 		// Load all local instances
@@ -1374,35 +1705,8 @@ func autoCreateContainerSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
 		// Figure out which need snapshotting (if any)
 		instances := []Instance{}
 		for _, c := range allContainers {
-			schedule := c.ExpandedConfig()["snapshots.schedule"]
-
-			if schedule == "" {
-				continue
-			}
-
-			// Extend our schedule to one that is accepted by the used cron parser
-			sched, err := cron.Parse(fmt.Sprintf("* %s", schedule))
-			if err != nil {
-				continue
-			}
-
 			// Check if it's time to snapshot
-			now := time.Now()
-
-			// Truncate the time now back to the start of the minute, before passing to
-			// the cron scheduler, as it will add 1s to the scheduled time and we don't
-			// want the next scheduled time to roll over to the next minute and break
-			// the time comparison below.
-			now = now.Truncate(time.Minute)
-
-			// Calculate the next scheduled time based on the snapshots.schedule
-			// pattern and the time now.
-			next := sched.Next(now)
-
-			// Ignore everything that is more precise than minutes.
-			next = next.Truncate(time.Minute)
-
-			if !now.Equal(next) {
+			if !snapshotIsScheduledNow(c.ExpandedConfig()["snapshots.schedule"]) {
 				continue
 			}
 
@@ -1411,6 +1715,16 @@ func autoCreateContainerSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
 				continue
 			}
 
+			// Check if snapshots are paused on the container's storage pool
+			poolName, err := c.StoragePool()
+			if err == nil {
+				err = storagePoolWatermarkCheck(d.State(), poolName, "snapshots")
+				if err != nil {
+					logger.Warn("Skipping scheduled snapshot", log.Ctx{"container": c.Name(), "err": err})
+					continue
+				}
+			}
+
 			instances = append(instances, c)
 		}
 
@@ -1454,15 +1768,19 @@ func autoCreateContainerSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
 }
 
 func autoCreateContainerSnapshots(ctx context.Context, d *Daemon, instances []Instance) error {
-	// Make the snapshots
+	// Make the snapshots, working on as many instances of each storage pool at once as it allows
+	tasks := []storageVolumeTask{}
 	for _, c := range instances {
-		ch := make(chan error)
-		go func() {
+		c := c
+
+		// Instances whose pool can't be found are snapshotted one at a time
+		poolName, _ := c.StoragePool()
+
+		tasks = append(tasks, storageVolumeTask{pool: poolName, run: func() error {
 			snapshotName, err := containerDetermineNextSnapshotName(d, c, "snap%d")
 			if err != nil {
 				logger.Error("Error retrieving next snapshot name", log.Ctx{"err": err, "container": c})
-				ch <- nil
-				return
+				return nil
 			}
 
 			snapshotName = fmt.Sprintf("%s%s%s", c.Name(), shared.SnapshotDelimiter, snapshotName)
@@ -1470,8 +1788,7 @@ func autoCreateContainerSnapshots(ctx context.Context, d *Daemon, instances []In
 			expiry, err := shared.GetSnapshotExpiry(time.Now(), c.ExpandedConfig()["snapshots.expiry"])
 			if err != nil {
 				logger.Error("Error getting expiry date", log.Ctx{"err": err, "container": c})
-				ch <- nil
-				return
+				return nil
 			}
 
 			args := db.InstanceArgs{
@@ -1493,15 +1810,87 @@ func autoCreateContainerSnapshots(ctx context.Context, d *Daemon, instances []In
 				logger.Error("Error creating snapshots", log.Ctx{"err": err, "container": c})
 			}
 
-			ch <- nil
-		}()
-		select {
-		case <-ctx.Done():
 			return nil
-		case <-ch:
+		}})
+	}
+
+	storageVolumeTasksRun(ctx, d.State(), tasks)
+
+	return nil
+}
+
+// Config keys whose change remaps or replaces the instance's root filesystem.
+var containerMajorConfigKeys = []string{
+	"raw.idmap",
+	"security.idmap.base",
+	"security.idmap.isolated",
+	"security.idmap.size",
+	"security.privileged",
+}
+
+// containerUpdateIsMajor returns whether applying the given arguments to the
+// instance changes its root filesystem, either by remapping it or by changing
+// its root disk.
+func containerUpdateIsMajor(c Instance, args db.InstanceArgs) bool {
+	oldConfig := c.LocalConfig()
+	for _, key := range containerMajorConfigKeys {
+		if oldConfig[key] != args.Config[key] {
+			return true
 		}
 	}
 
+	_, oldRoot, _ := shared.GetRootDiskDevice(c.LocalDevices().CloneNative())
+	_, newRoot, _ := shared.GetRootDiskDevice(args.Devices.CloneNative())
+	if oldRoot != nil || newRoot != nil {
+		if oldRoot == nil || newRoot == nil {
+			return true
+		}
+
+		if oldRoot["pool"] != newRoot["pool"] || oldRoot["size"] != newRoot["size"] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containerSafetySnapshot snapshots the instance before a destructive
+// operation, if enabled through snapshots.safety. The snapshot expires as set
+// in snapshots.safety.expiry.
+func containerSafetySnapshot(d *Daemon, c Instance, reason string) error {
+	if !shared.IsTrue(c.ExpandedConfig()["snapshots.safety"]) {
+		return nil
+	}
+
+	i := d.cluster.ContainerNextSnapshot(c.Project(), c.Name(), "safety%d")
+	snapshotName := fmt.Sprintf("%s%ssafety%d", c.Name(), shared.SnapshotDelimiter, i)
+
+	expiry, err := shared.GetSnapshotExpiry(time.Now(), c.ExpandedConfig()["snapshots.safety.expiry"])
+	if err != nil {
+		return err
+	}
+
+	args := db.InstanceArgs{
+		Architecture: c.Architecture(),
+		Config:       c.LocalConfig(),
+		Type:         c.Type(),
+		Snapshot:     true,
+		Devices:      c.LocalDevices(),
+		Ephemeral:    c.IsEphemeral(),
+		Name:         snapshotName,
+		Profiles:     c.Profiles(),
+		Project:      c.Project(),
+		Stateful:     false,
+		ExpiryDate:   expiry,
+	}
+
+	_, err = containerCreateAsSnapshot(d.State(), args, c)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create safety snapshot before %s", reason)
+	}
+
+	logger.Info("Created safety snapshot", log.Ctx{"project": c.Project(), "instance": c.Name(), "snapshot": snapshotName, "reason": reason})
+
 	return nil
 }
 
@@ -1575,12 +1964,42 @@ func pruneExpiredContainerSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
 }
 
 func pruneExpiredContainerSnapshots(ctx context.Context, d *Daemon, snapshots []Instance) error {
-	// Find snapshots to delete
+	// Group the snapshots by instance, the snapshots of a given instance being deleted in order
+	parents := []string{}
+	snapshotsByParent := map[string][]Instance{}
 	for _, snapshot := range snapshots {
-		err := snapshot.Delete()
-		if err != nil {
-			return errors.Wrapf(err, "Failed to delete expired snapshot '%s' in project '%s'", snapshot.Name(), snapshot.Project())
+		parentName, _, _ := shared.ContainerGetParentAndSnapshotName(snapshot.Name())
+		key := fmt.Sprintf("%s/%s", snapshot.Project(), parentName)
+
+		_, ok := snapshotsByParent[key]
+		if !ok {
+			parents = append(parents, key)
 		}
+
+		snapshotsByParent[key] = append(snapshotsByParent[key], snapshot)
+	}
+
+	// Delete them, working on as many instances of each storage pool at once as it allows
+	tasks := []storageVolumeTask{}
+	for _, key := range parents {
+		parentSnapshots := snapshotsByParent[key]
+		poolName, _ := parentSnapshots[0].StoragePool()
+
+		tasks = append(tasks, storageVolumeTask{pool: poolName, run: func() error {
+			for _, snapshot := range parentSnapshots {
+				err := snapshot.Delete()
+				if err != nil {
+					return errors.Wrapf(err, "Failed to delete expired snapshot '%s' in project '%s'", snapshot.Name(), snapshot.Project())
+				}
+			}
+
+			return nil
+		}})
+	}
+
+	errs := storageVolumeTasksRun(ctx, d.State(), tasks)
+	if len(errs) > 0 {
+		return errs[0]
 	}
 
 	return nil
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -11,11 +12,14 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/lxc/lxd/lxd/backup"
+	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/version"
@@ -170,11 +174,15 @@ func containerBackupsPost(d *Daemon, r *http.Request) response.Response {
 			CompressionAlgorithm: req.CompressionAlgorithm,
 		}
 
-		err := backupCreate(d.State(), args, c)
+		err := backupCreate(d.State(), args, c, op)
 		if err != nil {
 			return errors.Wrap(err, "Create backup")
 		}
 
+		source := fmt.Sprintf("/1.0/containers/%s/backups/%s", name, req.Name)
+		webhook.SendLifecycle(c.ExpandedConfig(), project, "container-backup-created", source, nil)
+		d.State().Events.SendLifecycle(project, "container-backup-created", source, nil)
+
 		return nil
 	}
 
@@ -355,3 +363,137 @@ func containerBackupExportGet(d *Daemon, r *http.Request) response.Response {
 
 	return response.FileResponse(r, []response.FileResponseEntry{ent}, nil, false)
 }
+
+func containerBackupContentsGet(d *Daemon, r *http.Request) response.Response {
+	instanceType, err := urlInstanceTypeDetect(r)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+	backupName := mux.Vars(r)["backupName"]
+
+	// Handle requests targeted to a container on a different node
+	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if resp != nil {
+		return resp
+	}
+
+	fullName := name + shared.SnapshotDelimiter + backupName
+	backup, err := backup.LoadByName(d.State(), project, fullName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	entries, err := backup.Contents()
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	// Only return the content of the requested directory
+	path := r.FormValue("path")
+	if path == "" || path == "/" {
+		return response.SyncResponse(true, entries)
+	}
+
+	path = filepath.Clean(path)
+	result := []api.InstanceBackupEntry{}
+	for _, entry := range entries {
+		if entry.Path == path || strings.HasPrefix(entry.Path, path+"/") {
+			result = append(result, entry)
+		}
+	}
+
+	return response.SyncResponse(true, result)
+}
+
+func containerBackupRestorePost(d *Daemon, r *http.Request) response.Response {
+	instanceType, err := urlInstanceTypeDetect(r)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+	backupName := mux.Vars(r)["backupName"]
+
+	// Handle requests targeted to a container on a different node
+	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if resp != nil {
+		return resp
+	}
+
+	req := api.InstanceBackupRestorePost{}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	if len(req.Paths) == 0 {
+		return response.BadRequest(fmt.Errorf("No paths to restore"))
+	}
+
+	if req.Destination == "" {
+		req.Destination = "/"
+	}
+
+	if !filepath.IsAbs(req.Destination) {
+		return response.BadRequest(fmt.Errorf("The destination must be an absolute path"))
+	}
+
+	fullName := name + shared.SnapshotDelimiter + backupName
+	backup, err := backup.LoadByName(d.State(), project, fullName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	source, err := instanceLoadByProjectAndName(d.State(), project, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if source.Type() != instancetype.Container {
+		return response.BadRequest(fmt.Errorf("Only container backups can be restored from"))
+	}
+
+	// The backup tarball is local, so the target must be too
+	if req.Instance == "" {
+		req.Instance = name
+	}
+
+	client, err := cluster.ConnectIfContainerIsRemote(d.cluster, project, req.Instance, d.endpoints.NetworkCert(), instancetype.Any)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if client != nil {
+		return response.BadRequest(fmt.Errorf("The target instance must be on the same cluster member as the backup"))
+	}
+
+	target, err := instanceLoadByProjectAndName(d.State(), project, req.Instance)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	restore := func(op *operations.Operation) error {
+		return backupRestorePaths(backup, source.(container), target, req.Paths, req.Destination)
+	}
+
+	resources := map[string][]string{}
+	resources["containers"] = []string{req.Instance}
+
+	op, err := operations.OperationCreate(d.State(), project, operations.OperationClassTask,
+		db.OperationBackupRestore, resources, nil, restore, nil, nil)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
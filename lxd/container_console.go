@@ -389,13 +389,27 @@ func containerConsoleLogGet(d *Daemon, r *http.Request) response.Response {
 }
 
 func containerConsoleLogDelete(d *Daemon, r *http.Request) response.Response {
-	if !util.RuntimeLiblxcVersionAtLeast(3, 0, 0) {
-		return response.BadRequest(fmt.Errorf("Clearing the console buffer requires liblxc >= 3.0"))
+	instanceType, err := urlInstanceTypeDetect(r)
+	if err != nil {
+		return response.SmartError(err)
 	}
 
 	name := mux.Vars(r)["name"]
 	project := projectParam(r)
 
+	// Forward the request if the container is remote.
+	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if resp != nil {
+		return resp
+	}
+
+	if !util.RuntimeLiblxcVersionAtLeast(3, 0, 0) {
+		return response.BadRequest(fmt.Errorf("Clearing the console buffer requires liblxc >= 3.0"))
+	}
+
 	inst, err := instanceLoadByProjectAndName(d.State(), project, name)
 	if err != nil {
 		return response.SmartError(err)
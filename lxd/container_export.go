@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/shared"
+)
+
+// Export the root filesystem of a container in another format than the one of
+// its backups, given by the "format" parameter. The only format is "oci", an
+// OCI image layout tarball with a layer per snapshot unless "instance_only" is
+// set.
+func containerExportGet(d *Daemon, r *http.Request) response.Response {
+	instanceType, err := urlInstanceTypeDetect(r)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+	format := r.FormValue("format")
+	instanceOnly := shared.IsTrue(r.FormValue("instance_only"))
+
+	if format != "oci" {
+		return response.BadRequest(fmt.Errorf("Unsupported export format %q", format))
+	}
+
+	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if resp != nil {
+		return resp
+	}
+
+	inst, err := instanceLoadByProjectAndName(d.State(), project, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if inst.Type() != instancetype.Container {
+		return response.BadRequest(fmt.Errorf("Only containers can be exported as OCI images"))
+	}
+
+	f, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_oci_export_")
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	err = inst.(container).ExportOCI(f, instanceOnly)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return response.SmartError(err)
+	}
+
+	ent := response.FileResponseEntry{
+		Path:     f.Name(),
+		Filename: fmt.Sprintf("%s.oci.tar", name),
+	}
+
+	return response.FileResponse(r, []response.FileResponseEntry{ent}, nil, true)
+}
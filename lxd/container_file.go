@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/shared"
 )
@@ -53,6 +54,43 @@ func containerFileHandler(d *Daemon, r *http.Request) response.Response {
 	}
 }
 
+// Read-only access to the files of a container snapshot, which is mounted for
+// the duration of the request.
+func containerSnapshotFileHandler(d *Daemon, r *http.Request) response.Response {
+	instanceType, err := urlInstanceTypeDetect(r)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+	snapshotName := mux.Vars(r)["snapshotName"]
+
+	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if resp != nil {
+		return resp
+	}
+
+	snapshot, err := instanceLoadByProjectAndName(d.State(), project, name+shared.SnapshotDelimiter+snapshotName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if snapshot.Type() != instancetype.Container {
+		return response.BadRequest(fmt.Errorf("Only the snapshots of containers can be browsed"))
+	}
+
+	path := r.FormValue("path")
+	if path == "" {
+		return response.BadRequest(fmt.Errorf("missing path argument"))
+	}
+
+	return containerFileGet(snapshot, path, r)
+}
+
 func containerFileGet(c Instance, path string, r *http.Request) response.Response {
 	/*
 	 * Copy out of the ns to a temporary file, and then use that to serve
@@ -74,6 +112,12 @@ func containerFileGet(c Instance, path string, r *http.Request) response.Respons
 		return response.SmartError(err)
 	}
 
+	return fileGetResponse(r, path, temp.Name(), uid, gid, mode, type_, dirEnts)
+}
+
+// fileGetResponse returns the file pulled to tempPath, or the entries of the
+// directory, along with the ownership, mode and type of the original path.
+func fileGetResponse(r *http.Request, path string, tempPath string, uid int64, gid int64, mode os.FileMode, type_ string, dirEnts []string) response.Response {
 	headers := map[string]string{
 		"X-LXD-uid":  fmt.Sprintf("%d", uid),
 		"X-LXD-gid":  fmt.Sprintf("%d", gid),
@@ -85,15 +129,15 @@ func containerFileGet(c Instance, path string, r *http.Request) response.Respons
 		// Make a file response struct
 		files := make([]response.FileResponseEntry, 1)
 		files[0].Identifier = filepath.Base(path)
-		files[0].Path = temp.Name()
+		files[0].Path = tempPath
 		files[0].Filename = filepath.Base(path)
 
 		return response.FileResponse(r, files, headers, true)
 	} else if type_ == "directory" {
-		os.Remove(temp.Name())
+		os.Remove(tempPath)
 		return response.SyncResponseHeaders(true, dirEnts, headers)
 	} else {
-		os.Remove(temp.Name())
+		os.Remove(tempPath)
 		return response.InternalError(fmt.Errorf("bad file type %s", type_))
 	}
 }
@@ -2,9 +2,14 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared/api"
 )
 
 func containerGet(d *Daemon, r *http.Request) response.Response {
@@ -16,6 +21,12 @@ func containerGet(d *Daemon, r *http.Request) response.Response {
 	project := projectParam(r)
 	name := mux.Vars(r)["name"]
 
+	// Parse the recursion field
+	recursion, err := strconv.Atoi(r.FormValue("recursion"))
+	if err != nil {
+		recursion = 0
+	}
+
 	// Handle requests targeted to a container on a different node
 	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
 	if err != nil {
@@ -35,5 +46,35 @@ func containerGet(d *Daemon, r *http.Request) response.Response {
 		return response.SmartError(err)
 	}
 
+	// With recursion, also tell where each expanded key and device comes from.
+	if recursion > 1 {
+		ct, ok := state.(*api.Instance)
+		if ok {
+			state, err = instanceRenderExpanded(d.State(), c, ct)
+			if err != nil {
+				return response.SmartError(err)
+			}
+		}
+	}
+
 	return response.SyncResponseETag(true, state, etag)
 }
+
+// instanceRenderExpanded adds the sources of the expanded config and devices to the rendered
+// instance.
+func instanceRenderExpanded(s *state.State, inst Instance, ct *api.Instance) (*api.InstanceExpanded, error) {
+	profiles := []api.Profile{}
+	if len(inst.Profiles()) > 0 {
+		var err error
+		profiles, err = s.Cluster.ProfilesGet(inst.Project(), inst.Profiles())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &api.InstanceExpanded{
+		Instance:               *ct,
+		ExpandedConfigSources:  db.ProfilesExpandConfigSources(inst.LocalConfig(), profiles),
+		ExpandedDevicesSources: db.ProfilesExpandDevicesSources(inst.LocalDevices(), profiles),
+	}, nil
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/instance/operationlock"
 	"github.com/lxc/lxd/lxd/maas"
+	"github.com/lxc/lxd/lxd/oci"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/lxd/seccomp"
@@ -45,6 +46,7 @@ import (
 	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/lxd/template"
 	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/containerwriter"
@@ -332,7 +334,7 @@ func containerLXCCreate(s *state.State, args db.InstanceArgs) (container, error)
 	}
 
 	// Create a new database entry for the container's storage volume
-	_, err = s.Cluster.StoragePoolVolumeCreate(args.Project, args.Name, "", storagePoolVolumeTypeContainer, false, poolID, volumeConfig)
+	_, err = s.Cluster.StoragePoolVolumeCreate(args.Project, args.Name, "", storagePoolVolumeTypeContainer, false, poolID, volumeConfig, db.StoragePoolVolumeContentTypeFS)
 	if err != nil {
 		c.Delete()
 		return nil, err
@@ -436,7 +438,7 @@ func containerLXCCreate(s *state.State, args db.InstanceArgs) (container, error)
 	}
 
 	logger.Info("Created container", ctxMap)
-	c.state.Events.SendLifecycle(c.project, "container-created",
+	c.lifecycle("container-created",
 		fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 
 	return c, nil
@@ -2328,6 +2330,14 @@ func (c *containerLXC) startCommon() (string, []func() error, error) {
 		return "", postStartHooks, err
 	}
 
+	// Delegate the ZFS dataset to the container once it's running (if enabled).
+	zfs, ok := c.storage.(*storageZfs)
+	if ok {
+		postStartHooks = append(postStartHooks, func() error {
+			return zfs.ContainerDelegate(c)
+		})
+	}
+
 	// Generate the LXC config
 	configPath := filepath.Join(c.LogPath(), "lxc.conf")
 	err = c.c.SaveConfigFile(configPath)
@@ -2421,6 +2431,12 @@ func (c *containerLXC) Start(stateful bool) error {
 	}
 	defer op.Done(nil)
 
+	// Run the pre-start hook of the host, which may veto the start
+	err = instanceHostHook(c.state, c, instanceHookPreStart, nil)
+	if err != nil {
+		return err
+	}
+
 	err = setupSharedMounts()
 	if err != nil {
 		return fmt.Errorf("Daemon failed to setup shared mounts base: %s.\nDoes security.nesting need to be turned on?", err)
@@ -2557,7 +2573,7 @@ func (c *containerLXC) Start(stateful bool) error {
 	}
 
 	logger.Info("Started container", ctxMap)
-	c.state.Events.SendLifecycle(c.project, "container-started",
+	c.lifecycle("container-started",
 		fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 
 	return nil
@@ -2585,18 +2601,30 @@ func (c *containerLXC) OnStart() error {
 	// Template anything that needs templating
 	key := "volatile.apply_template"
 	if c.localConfig[key] != "" {
-		// Run any template that needs running
-		err = c.templateApplyNow(c.localConfig[key])
-		if err != nil {
-			apparmor.Destroy(c)
-			if ourStart {
-				c.StorageStop()
+		// Run any template that needs running, in the order the triggers were queued
+		changes := map[string]string{key: ""}
+		for _, trigger := range strings.Split(c.localConfig[key], ",") {
+			triggerContext := map[string]string{}
+			prefix := fmt.Sprintf("%s.%s.", key, trigger)
+			for k, v := range c.localConfig {
+				if strings.HasPrefix(k, prefix) {
+					triggerContext[strings.TrimPrefix(k, prefix)] = v
+					changes[k] = ""
+				}
+			}
+
+			err = c.templateApplyNow(trigger, triggerContext)
+			if err != nil {
+				apparmor.Destroy(c)
+				if ourStart {
+					c.StorageStop()
+				}
+				return err
 			}
-			return err
 		}
 
-		// Remove the volatile key from the DB
-		err := c.state.Cluster.ContainerConfigRemove(c.id, key)
+		// Remove the volatile keys from the DB
+		err := c.VolatileSet(changes)
 		if err != nil {
 			apparmor.Destroy(c)
 			if ourStart {
@@ -2606,7 +2634,7 @@ func (c *containerLXC) OnStart() error {
 		}
 	}
 
-	err = c.templateApplyNow("start")
+	err = c.templateApplyNow("start", nil)
 	if err != nil {
 		apparmor.Destroy(c)
 		if ourStart {
@@ -2649,6 +2677,12 @@ func (c *containerLXC) OnStart() error {
 		return err
 	}
 
+	// Record the definition of the profiles the container was started with
+	err = instanceProfilesAppliedSet(c.state, c)
+	if err != nil {
+		logger.Warn("Failed to record the applied profiles", log.Ctx{"container": c.Name(), "err": err})
+	}
+
 	return nil
 }
 
@@ -2725,7 +2759,7 @@ func (c *containerLXC) Stop(stateful bool) error {
 
 		op.Done(nil)
 		logger.Info("Stopped container", ctxMap)
-		c.state.Events.SendLifecycle(c.project, "container-stopped",
+		c.lifecycle("container-stopped",
 			fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 		return nil
 	} else if shared.PathExists(c.StatePath()) {
@@ -2781,7 +2815,7 @@ func (c *containerLXC) Stop(stateful bool) error {
 	}
 
 	logger.Info("Stopped container", ctxMap)
-	c.state.Events.SendLifecycle(c.project, "container-stopped",
+	c.lifecycle("container-stopped",
 		fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 
 	return nil
@@ -2842,15 +2876,15 @@ func (c *containerLXC) Shutdown(timeout time.Duration) error {
 	}
 
 	logger.Info("Shut down container", ctxMap)
-	c.state.Events.SendLifecycle(c.project, "container-shutdown",
+	c.lifecycle("container-shutdown",
 		fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 
 	return nil
 }
 
 // OnStopNS is triggered by LXC's stop hook once a container is shutdown but before the container's
-// namespaces have been closed. The netns path of the stopped container is provided.
-func (c *containerLXC) OnStopNS(target string, netns string) error {
+// namespaces have been closed. The netns and userns paths of the stopped container are provided.
+func (c *containerLXC) OnStopNS(target string, netns string, userns string) error {
 	// Validate target
 	if !shared.StringInSlice(target, []string{"stop", "reboot"}) {
 		logger.Error("Container sent invalid target to OnStopNS", log.Ctx{"container": c.Name(), "target": target})
@@ -2860,6 +2894,22 @@ func (c *containerLXC) OnStopNS(target string, netns string) error {
 	// Clean up devices.
 	c.cleanupDevices(netns)
 
+	// Take back the ZFS dataset delegated to the container while its user namespace still
+	// exists.
+	err := c.initStorage()
+	if err != nil {
+		logger.Error("Failed to initialize storage", log.Ctx{"container": c.Name(), "err": err})
+		return nil
+	}
+
+	zfs, ok := c.storage.(*storageZfs)
+	if ok {
+		err := zfs.ContainerUndelegate(c, userns)
+		if err != nil {
+			logger.Error("Failed to take back delegated ZFS dataset", log.Ctx{"container": c.Name(), "err": err})
+		}
+	}
+
 	return nil
 }
 
@@ -2960,6 +3010,12 @@ func (c *containerLXC) OnStop(target string) error {
 			logger.Error("Unable to remove disk devices", log.Ctx{"container": c.Name(), "err": err})
 		}
 
+		// Run the post-stop hook of the host
+		hookErr := instanceHostHook(c.state, c, instanceHookPostStop, nil)
+		if hookErr != nil {
+			logger.Error("Failed to run post-stop hook", log.Ctx{"container": c.Name(), "err": hookErr})
+		}
+
 		// Reboot the container
 		if target == "reboot" {
 			// Start the container again
@@ -3035,7 +3091,7 @@ func (c *containerLXC) Freeze() error {
 	}
 
 	logger.Info("Froze container", ctxMap)
-	c.state.Events.SendLifecycle(c.project, "container-paused",
+	c.lifecycle("container-paused",
 		fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 
 	return err
@@ -3080,7 +3136,7 @@ func (c *containerLXC) Unfreeze() error {
 	}
 
 	logger.Info("Unfroze container", ctxMap)
-	c.state.Events.SendLifecycle(c.project, "container-resumed",
+	c.lifecycle("container-resumed",
 		fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 
 	return err
@@ -3189,7 +3245,7 @@ func (c *containerLXC) RenderFull() (*api.InstanceFull, interface{}, error) {
 	ct := api.InstanceFull{Instance: *base.(*api.Instance)}
 
 	// Add the ContainerState
-	ct.State, err = c.RenderState()
+	ct.State, err = instanceStateCached(c, ct.StatusCode)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -3312,6 +3368,41 @@ func (c *containerLXC) Backups() ([]backup.Backup, error) {
 	return backups, nil
 }
 
+// restoreSnapshotVolume restores the root volume of the container from the given snapshot on a
+// pool of the new storage layer. When zfs.remove_snapshots allows it, the snapshots taken after
+// the restored one are deleted first, for drivers which can't keep them.
+func (c *containerLXC) restoreSnapshotVolume(pool storagePools.Pool, source Instance) error {
+	_, poolRow, err := c.state.Cluster.StoragePoolGet(pool.Name())
+	if err != nil {
+		return err
+	}
+
+	_, vol, err := c.state.Cluster.StoragePoolNodeVolumeGetTypeByProject(c.project, c.name, storagePoolVolumeTypeContainer, pool.ID())
+	if err != nil {
+		return err
+	}
+
+	if storagePoolVolumeRestoreForced(poolRow.Config, vol.Config) {
+		snaps, err := c.Snapshots()
+		if err != nil {
+			return err
+		}
+
+		for i := len(snaps) - 1; i >= 0; i-- {
+			if snaps[i].Name() == source.Name() {
+				break
+			}
+
+			err := snaps[i].Delete()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return pool.RestoreInstanceSnapshot(c, source, nil)
+}
+
 func (c *containerLXC) Restore(sourceContainer Instance, stateful bool) error {
 	var ctxMap log.Ctx
 
@@ -3397,8 +3488,17 @@ func (c *containerLXC) Restore(sourceContainer Instance, stateful bool) error {
 
 	logger.Info("Restoring container", ctxMap)
 
-	// Restore the rootfs
-	err = c.storage.ContainerRestore(c, sourceContainer)
+	// Restore the rootfs, through the new storage layer if it supports the pool driver.
+	pool, err := storagePools.GetPoolByInstance(c.state, c)
+	if err != storageDrivers.ErrUnknownDriver && err != storageDrivers.ErrNotImplemented {
+		if err != nil {
+			return errors.Wrap(err, "Load instance storage pool")
+		}
+
+		err = c.restoreSnapshotVolume(pool, sourceContainer)
+	} else {
+		err = c.storage.ContainerRestore(c, sourceContainer)
+	}
 	if err != nil {
 		logger.Error("Failed restoring container filesystem", ctxMap)
 		return err
@@ -3423,6 +3523,13 @@ func (c *containerLXC) Restore(sourceContainer Instance, stateful bool) error {
 		return err
 	}
 
+	// Queue the templates to run on snapshot restore (applied on next start)
+	_, snapName, _ := shared.ContainerGetParentAndSnapshotName(sourceContainer.Name())
+	err = c.templateQueue("restore", map[string]string{"snapshot": snapName})
+	if err != nil {
+		return err
+	}
+
 	// The old backup file may be out of date (e.g. it doesn't have all the
 	// current snapshots of the container listed); let's write a new one to
 	// be safe.
@@ -3474,7 +3581,7 @@ func (c *containerLXC) Restore(sourceContainer Instance, stateful bool) error {
 		return nil
 	}
 
-	c.state.Events.SendLifecycle(c.project, "container-snapshot-restored",
+	c.lifecycle("container-snapshot-restored",
 		fmt.Sprintf("/1.0/containers/%s", c.name), map[string]interface{}{
 			"snapshot_name": c.name,
 		})
@@ -3712,12 +3819,12 @@ func (c *containerLXC) Delete() error {
 	logger.Info("Deleted container", ctxMap)
 
 	if c.IsSnapshot() {
-		c.state.Events.SendLifecycle(c.project, "container-snapshot-deleted",
+		c.lifecycle("container-snapshot-deleted",
 			fmt.Sprintf("/1.0/containers/%s", c.name), map[string]interface{}{
 				"snapshot_name": c.name,
 			})
 	} else {
-		c.state.Events.SendLifecycle(c.project, "container-deleted",
+		c.lifecycle("container-deleted",
 			fmt.Sprintf("/1.0/containers/%s", c.name), nil)
 	}
 
@@ -3915,13 +4022,13 @@ func (c *containerLXC) Rename(newName string) error {
 	logger.Info("Renamed container", ctxMap)
 
 	if c.IsSnapshot() {
-		c.state.Events.SendLifecycle(c.project, "container-snapshot-renamed",
+		c.lifecycle("container-snapshot-renamed",
 			fmt.Sprintf("/1.0/containers/%s", oldName), map[string]interface{}{
 				"new_name":      newName,
 				"snapshot_name": oldName,
 			})
 	} else {
-		c.state.Events.SendLifecycle(c.project, "container-renamed",
+		c.lifecycle("container-renamed",
 			fmt.Sprintf("/1.0/containers/%s", oldName), map[string]interface{}{
 				"new_name": newName,
 			})
@@ -4326,6 +4433,21 @@ func (c *containerLXC) Update(args db.InstanceArgs, userRequested bool) error {
 		return errors.Wrap(err, "Invalid expanded devices")
 	}
 
+	// Check that the static addresses of the instance aren't used by others.
+	var allocations []db.NetworkAllocation
+	if !c.IsSnapshot() {
+		allocations, err = networkAllocations(c, c.expandedDevices)
+		if err == nil {
+			err = c.state.Cluster.Transaction(func(tx *db.ClusterTx) error {
+				return tx.NetworkAllocationsCheck(c.id, allocations)
+			})
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "Invalid static addresses")
+		}
+	}
+
 	// Run through initLXC to catch anything we missed
 	if c.c != nil {
 		c.c.Release()
@@ -4723,6 +4845,12 @@ func (c *containerLXC) Update(args db.InstanceArgs, userRequested bool) error {
 				return errors.Wrap(err, "Device add")
 			}
 
+			err = db.NetworkAllocationsSet(tx, c.id, allocations)
+			if err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "Network allocations")
+			}
+
 			err = db.ContainerUpdate(tx, c.id, c.description, c.architecture, c.ephemeral, c.expiryDate)
 			if err != nil {
 				tx.Rollback()
@@ -4812,9 +4940,43 @@ func (c *containerLXC) Update(args db.InstanceArgs, userRequested bool) error {
 		}
 	}
 
+	// Run the templates for newly attached custom storage volumes.
+	if !c.IsSnapshot() {
+		for _, dev := range deviceConfig.Devices(addDevices).Sorted() {
+			if dev.Config["type"] != "disk" || dev.Config["pool"] == "" || dev.Config["path"] == "/" {
+				continue
+			}
+
+			triggerContext := map[string]string{
+				"device": dev.Name,
+				"pool":   dev.Config["pool"],
+				"volume": dev.Config["source"],
+				"path":   dev.Config["path"],
+			}
+
+			// The rootfs is only guaranteed to be mounted while running.
+			if c.IsRunning() {
+				err = c.templateApplyNow("attach", triggerContext)
+			} else {
+				err = c.templateQueue("attach", triggerContext)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "Failed to apply templates for device '%s'", dev.Name)
+			}
+		}
+	}
+
 	// Success, update the closure to mark that the changes should be kept.
 	undoChanges = false
 
+	// Record the definition of the profiles now applied to the running container.
+	if isRunning {
+		err = instanceProfilesAppliedSet(c.state, c)
+		if err != nil {
+			logger.Warn("Failed to record the applied profiles", log.Ctx{"container": c.Name(), "err": err})
+		}
+	}
+
 	var endpoint string
 
 	if c.IsSnapshot() {
@@ -4824,7 +4986,7 @@ func (c *containerLXC) Update(args db.InstanceArgs, userRequested bool) error {
 		endpoint = fmt.Sprintf("/1.0/containers/%s", c.name)
 	}
 
-	c.state.Events.SendLifecycle(c.project, "container-updated", endpoint, nil)
+	c.lifecycle("container-updated", endpoint, nil)
 
 	return nil
 }
@@ -4920,27 +5082,13 @@ func (c *containerLXC) Export(w io.Writer, properties map[string]string) error {
 			return fmt.Errorf("Container is protected against filesystem shifting")
 		}
 
-		var err error
-
-		if c.Storage().GetStorageType() == storageTypeZfs {
-			err = idmap.UnshiftRootfs(c.RootfsPath(), zfsIdmapSetSkipper)
-		} else if c.Storage().GetStorageType() == storageTypeBtrfs {
-			err = UnshiftBtrfsRootfs(c.RootfsPath(), idmap)
-		} else {
-			err = idmap.UnshiftRootfs(c.RootfsPath(), nil)
-		}
+		err = c.unshiftRootfs(idmap)
 		if err != nil {
 			logger.Error("Failed exporting container", ctxMap)
 			return err
 		}
 
-		if c.Storage().GetStorageType() == storageTypeZfs {
-			defer idmap.ShiftRootfs(c.RootfsPath(), zfsIdmapSetSkipper)
-		} else if c.Storage().GetStorageType() == storageTypeBtrfs {
-			defer ShiftBtrfsRootfs(c.RootfsPath(), idmap)
-		} else {
-			defer idmap.ShiftRootfs(c.RootfsPath(), nil)
-		}
+		defer c.shiftRootfs(idmap)
 	}
 
 	// Create the tarball
@@ -5133,6 +5281,370 @@ func (c *containerLXC) Export(w io.Writer, properties map[string]string) error {
 	return nil
 }
 
+// ExportDiff writes a tarball of the changes made to the root filesystem of the
+// snapshot since the given older snapshot of the same container. It holds the
+// added and changed files under rootfs/, along with a diff.yaml file listing
+// the removed paths, which must be deleted before unpacking the files.
+func (c *containerLXC) ExportDiff(w io.Writer, from Instance) error {
+	ctxMap := log.Ctx{
+		"project": c.project,
+		"name":    c.name,
+		"from":    from.Name()}
+
+	if !c.IsSnapshot() || !from.IsSnapshot() {
+		return fmt.Errorf("Only the changes between two snapshots can be exported")
+	}
+
+	logger.Info("Exporting snapshot changes", ctxMap)
+
+	// Start the storage
+	ourStart, err := c.StorageStart()
+	if err != nil {
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+	if ourStart {
+		defer c.StorageStop()
+	}
+
+	ourStart, err = from.StorageStart()
+	if err != nil {
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+	if ourStart {
+		defer from.StorageStop()
+	}
+
+	// Compare the snapshots while both are still shifted
+	changed, removed, err := util.DiffTrees(from.RootfsPath(), c.RootfsPath())
+	if err != nil {
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	// Unshift the snapshot
+	idmap, err := c.DiskIdmap()
+	if err != nil {
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	if idmap != nil {
+		err = c.unshiftRootfs(idmap)
+		if err != nil {
+			logger.Error("Failed exporting snapshot changes", ctxMap)
+			return err
+		}
+
+		defer c.shiftRootfs(idmap)
+	}
+
+	// Create the tarball
+	ctw := containerwriter.NewContainerTarWriter(w, nil)
+
+	_, fromName, _ := shared.ContainerGetParentAndSnapshotName(from.Name())
+	_, toName, _ := shared.ContainerGetParentAndSnapshotName(c.name)
+	diff := snapshotDiffInfo{
+		From:    fromName,
+		To:      toName,
+		Removed: removed,
+	}
+
+	data, err := yaml.Marshal(&diff)
+	if err != nil {
+		ctw.Close()
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	tempDir, err := ioutil.TempDir("", "lxd_lxd_diff_")
+	if err != nil {
+		ctw.Close()
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	fnam := filepath.Join(tempDir, "diff.yaml")
+	err = ioutil.WriteFile(fnam, data, 0644)
+	if err != nil {
+		ctw.Close()
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	fi, err := os.Lstat(fnam)
+	if err != nil {
+		ctw.Close()
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	err = ctw.WriteFileAs("diff.yaml", fnam, fi)
+	if err != nil {
+		ctw.Close()
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	for _, relPath := range changed {
+		path := filepath.Join(c.RootfsPath(), relPath)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			ctw.Close()
+			logger.Error("Failed exporting snapshot changes", ctxMap)
+			return err
+		}
+
+		err = ctw.WriteFileAs(filepath.Join("rootfs", relPath), path, fi)
+		if err != nil {
+			ctw.Close()
+			logger.Debugf("Error tarring up %s: %s", path, err)
+			logger.Error("Failed exporting snapshot changes", ctxMap)
+			return err
+		}
+	}
+
+	err = ctw.Close()
+	if err != nil {
+		logger.Error("Failed exporting snapshot changes", ctxMap)
+		return err
+	}
+
+	logger.Info("Exported snapshot changes", ctxMap)
+	return nil
+}
+
+// ExportOCI writes the root filesystem of the container as an OCI image layout
+// tarball. Unless instanceOnly is set, each of its snapshots is a layer holding
+// the changes made since the previous one, with the container itself on top.
+func (c *containerLXC) ExportOCI(w io.Writer, instanceOnly bool) error {
+	ctxMap := log.Ctx{
+		"project":      c.project,
+		"name":         c.name,
+		"instanceOnly": instanceOnly}
+
+	if c.IsSnapshot() {
+		return fmt.Errorf("Only containers, not their snapshots, can be exported as OCI images")
+	}
+
+	if c.IsRunning() {
+		return fmt.Errorf("Cannot export a running container as an OCI image")
+	}
+
+	arch, err := osarch.ArchitectureName(c.architecture)
+	if err != nil {
+		return err
+	}
+
+	ociArch, err := oci.Architecture(arch)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Exporting container as OCI image", ctxMap)
+
+	layers := []Instance{}
+	if !instanceOnly {
+		snaps, err := c.Snapshots()
+		if err != nil {
+			logger.Error("Failed exporting container as OCI image", ctxMap)
+			return err
+		}
+
+		layers = append(layers, snaps...)
+	}
+
+	layers = append(layers, c)
+
+	tmpDir, err := ioutil.TempDir(shared.VarPath("backups"), "lxd_oci_export_")
+	if err != nil {
+		logger.Error("Failed exporting container as OCI image", ctxMap)
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ociWriter, err := oci.NewWriter(w, tmpDir)
+	if err != nil {
+		logger.Error("Failed exporting container as OCI image", ctxMap)
+		return err
+	}
+
+	var from Instance
+	for _, layer := range layers {
+		err := ociWriter.AddLayer(layer.Name(), func(w io.Writer) error {
+			return layer.(*containerLXC).exportOCILayer(w, from)
+		})
+		if err != nil {
+			logger.Error("Failed exporting container as OCI image", ctxMap)
+			return err
+		}
+
+		from = layer
+	}
+
+	created := time.Now().UTC()
+	err = ociWriter.Close(oci.ImageConfig{Created: &created, Architecture: ociArch, OS: "linux"}, c.name)
+	if err != nil {
+		logger.Error("Failed exporting container as OCI image", ctxMap)
+		return err
+	}
+
+	logger.Info("Exported container as OCI image", ctxMap)
+	return nil
+}
+
+// exportOCILayer writes the tarball of an OCI image layer holding the changes
+// made to the root filesystem of the container or snapshot since the given
+// older snapshot, or all of it if there is none.
+func (c *containerLXC) exportOCILayer(w io.Writer, from Instance) error {
+	ourStart, err := c.StorageStart()
+	if err != nil {
+		return err
+	}
+	if ourStart {
+		defer c.StorageStop()
+	}
+
+	changed := []string{}
+	removed := []string{}
+
+	if from != nil {
+		ourStart, err = from.StorageStart()
+		if err != nil {
+			return err
+		}
+		if ourStart {
+			defer from.StorageStop()
+		}
+
+		// Compare the trees while both are still shifted
+		changed, removed, err = util.DiffTrees(from.RootfsPath(), c.RootfsPath())
+		if err != nil {
+			return err
+		}
+	} else {
+		err = filepath.Walk(c.RootfsPath(), func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(c.RootfsPath(), path)
+			if err != nil {
+				return err
+			}
+
+			if relPath != "." {
+				changed = append(changed, relPath)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Unshift the root filesystem
+	idmap, err := c.DiskIdmap()
+	if err != nil {
+		return err
+	}
+
+	if idmap != nil {
+		if !c.IsSnapshot() && shared.IsTrue(c.expandedConfig["security.protection.shift"]) {
+			return fmt.Errorf("Container is protected against filesystem shifting")
+		}
+
+		err = c.unshiftRootfs(idmap)
+		if err != nil {
+			return err
+		}
+
+		defer c.shiftRootfs(idmap)
+	}
+
+	// The whiteout entries marking the removed paths are empty files
+	tempDir, err := ioutil.TempDir("", "lxd_lxd_oci_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	whiteoutPath := filepath.Join(tempDir, "whiteout")
+	err = ioutil.WriteFile(whiteoutPath, []byte{}, 0644)
+	if err != nil {
+		return err
+	}
+
+	whiteoutFi, err := os.Lstat(whiteoutPath)
+	if err != nil {
+		return err
+	}
+
+	ctw := containerwriter.NewContainerTarWriter(w, nil)
+
+	// Paths whose type changed are replaced by their new entry, without a whiteout
+	replaced := map[string]bool{}
+	for _, relPath := range changed {
+		replaced[relPath] = true
+	}
+
+	for _, relPath := range removed {
+		if replaced[relPath] {
+			continue
+		}
+
+		err = ctw.WriteFileAs(oci.WhiteoutName(relPath), whiteoutPath, whiteoutFi)
+		if err != nil {
+			ctw.Close()
+			return err
+		}
+	}
+
+	for _, relPath := range changed {
+		path := filepath.Join(c.RootfsPath(), relPath)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			ctw.Close()
+			return err
+		}
+
+		err = ctw.WriteFileAs(relPath, path, fi)
+		if err != nil {
+			ctw.Close()
+			logger.Debugf("Error tarring up %s: %s", path, err)
+			return err
+		}
+	}
+
+	return ctw.Close()
+}
+
+// unshiftRootfs shifts the ownership of the files of the root filesystem back
+// to the ids they have inside of the container.
+func (c *containerLXC) unshiftRootfs(idmapSet *idmap.IdmapSet) error {
+	if c.Storage().GetStorageType() == storageTypeZfs {
+		return idmapSet.UnshiftRootfs(c.RootfsPath(), zfsIdmapSetSkipper)
+	} else if c.Storage().GetStorageType() == storageTypeBtrfs {
+		return UnshiftBtrfsRootfs(c.RootfsPath(), idmapSet)
+	}
+
+	return idmapSet.UnshiftRootfs(c.RootfsPath(), nil)
+}
+
+// shiftRootfs reverts unshiftRootfs.
+func (c *containerLXC) shiftRootfs(idmapSet *idmap.IdmapSet) error {
+	if c.Storage().GetStorageType() == storageTypeZfs {
+		return idmapSet.ShiftRootfs(c.RootfsPath(), zfsIdmapSetSkipper)
+	} else if c.Storage().GetStorageType() == storageTypeBtrfs {
+		return ShiftBtrfsRootfs(c.RootfsPath(), idmapSet)
+	}
+
+	return idmapSet.ShiftRootfs(c.RootfsPath(), nil)
+}
+
 func collectCRIULogFile(c container, imagesDir string, function string, method string) error {
 	t := time.Now().Format(time.RFC3339)
 	newPath := shared.LogPath(c.Name(), fmt.Sprintf("%s_%s_%s.log", function, method, t))
@@ -5371,6 +5883,13 @@ func (c *containerLXC) Migrate(args *CriuMigrationArgs) error {
 	return nil
 }
 
+// lifecycle sends a lifecycle event for the container, also notifying its webhook if configured.
+func (c *containerLXC) lifecycle(action string, source string, context map[string]interface{}) error {
+	webhook.SendLifecycle(c.expandedConfig, c.project, action, source, context)
+
+	return c.state.Events.SendLifecycle(c.project, action, source, context)
+}
+
 // DeferTemplateApply sets volatile key to apply template on next start. Used when instance's
 // volume isn't mounted.
 func (c *containerLXC) DeferTemplateApply(trigger string) error {
@@ -5382,7 +5901,43 @@ func (c *containerLXC) DeferTemplateApply(trigger string) error {
 	return nil
 }
 
-func (c *containerLXC) templateApplyNow(trigger string) error {
+// templateQueue adds a trigger to the ones to be applied on next start, keeping any trigger
+// already queued. The context is exposed to the templates as "trigger_context".
+func (c *containerLXC) templateQueue(trigger string, triggerContext map[string]string) error {
+	key := "volatile.apply_template"
+
+	triggers := []string{}
+	if c.localConfig[key] != "" {
+		triggers = strings.Split(c.localConfig[key], ",")
+	}
+
+	if !shared.StringInSlice(trigger, triggers) {
+		triggers = append(triggers, trigger)
+	}
+
+	changes := map[string]string{key: strings.Join(triggers, ",")}
+
+	// Replace the context of any previous occurrence of the same trigger
+	prefix := fmt.Sprintf("%s.%s.", key, trigger)
+	for k := range c.localConfig {
+		if strings.HasPrefix(k, prefix) {
+			changes[k] = ""
+		}
+	}
+
+	for k, v := range triggerContext {
+		changes[prefix+k] = v
+	}
+
+	err := c.VolatileSet(changes)
+	if err != nil {
+		return errors.Wrap(err, "Failed to set apply_template volatile key")
+	}
+
+	return nil
+}
+
+func (c *containerLXC) templateApplyNow(trigger string, triggerContext map[string]string) error {
 	// If there's no metadata, just return
 	fname := filepath.Join(c.Path(), "metadata.yaml")
 	if !shared.PathExists(fname) {
@@ -5512,12 +6067,13 @@ func (c *containerLXC) templateApplyNow(trigger string) error {
 
 		// Render the template
 		tplRender.ExecuteWriter(pongo2.Context{"trigger": trigger,
-			"path":       tplPath,
-			"container":  containerMeta,
-			"config":     c.expandedConfig,
-			"devices":    c.expandedDevices,
-			"properties": tpl.Properties,
-			"config_get": configGet}, w)
+			"trigger_context": triggerContext,
+			"path":            tplPath,
+			"container":       containerMeta,
+			"config":          c.expandedConfig,
+			"devices":         c.expandedDevices,
+			"properties":      tpl.Properties,
+			"config_get":      configGet}, w)
 	}
 
 	return nil
@@ -5583,16 +6139,7 @@ func (c *containerLXC) FilePull(srcpath string, dstpath string) (int64, int64, o
 	}
 
 	// Get the file from the container
-	_, stderr, err := shared.RunCommandSplit(
-		nil,
-		c.state.OS.ExecPath,
-		"forkfile",
-		"pull",
-		c.RootfsPath(),
-		fmt.Sprintf("%d", c.InitPID()),
-		srcpath,
-		dstpath,
-	)
+	uid, gid, mode, type_, dirEnts, err := forkfilePull(c.state.OS.ExecPath, c.RootfsPath(), c.InitPID(), srcpath, dstpath)
 
 	// Tear down container storage if needed
 	if !c.IsRunning() && ourStart {
@@ -5602,6 +6149,41 @@ func (c *containerLXC) FilePull(srcpath string, dstpath string) (int64, int64, o
 		}
 	}
 
+	if err != nil {
+		return -1, -1, 0, "", nil, err
+	}
+
+	// Unmap uid and gid if needed
+	if !c.IsRunning() {
+		idmapset, err := c.DiskIdmap()
+		if err != nil {
+			return -1, -1, 0, "", nil, err
+		}
+
+		if idmapset != nil {
+			uid, gid = idmapset.ShiftFromNs(uid, gid)
+		}
+	}
+
+	return uid, gid, mode, type_, dirEnts, nil
+}
+
+// forkfilePull copies srcpath from the given rootfs (or from the mount
+// namespace of pid, if positive) to dstpath on the host, returning the
+// ownership, mode and type of the source, along with its entries if it's a
+// directory.
+func forkfilePull(execPath string, rootfs string, pid int, srcpath string, dstpath string) (int64, int64, os.FileMode, string, []string, error) {
+	_, stderr, err := shared.RunCommandSplit(
+		nil,
+		execPath,
+		"forkfile",
+		"pull",
+		rootfs,
+		fmt.Sprintf("%d", pid),
+		srcpath,
+		dstpath,
+	)
+
 	uid := int64(-1)
 	gid := int64(-1)
 	mode := -1
@@ -5679,18 +6261,6 @@ func (c *containerLXC) FilePull(srcpath string, dstpath string) (int64, int64, o
 		return -1, -1, 0, "", nil, err
 	}
 
-	// Unmap uid and gid if needed
-	if !c.IsRunning() {
-		idmapset, err := c.DiskIdmap()
-		if err != nil {
-			return -1, -1, 0, "", nil, err
-		}
-
-		if idmapset != nil {
-			uid, gid = idmapset.ShiftFromNs(uid, gid)
-		}
-	}
-
 	return uid, gid, os.FileMode(mode), type_, dirEnts, nil
 }
 
@@ -6041,11 +6611,18 @@ func (c *containerLXC) diskState() map[string]api.InstanceStateDisk {
 			continue
 		}
 
+		// Disks from a storage pool whose mount went stale are unusable until it's remounted.
+		if dev.Config["pool"] != "" && storagePoolIsStale(dev.Config["pool"]) {
+			disk[dev.Name] = api.InstanceStateDisk{Stale: true}
+			continue
+		}
+
 		if dev.Config["path"] != "/" {
 			continue
 		}
 
 		var usage int64
+		var directories map[string]int64
 
 		// Check if we can load new storage layer for pool driver type.
 		pool, err := storagePools.GetPoolByName(c.state, dev.Config["pool"])
@@ -6060,14 +6637,35 @@ func (c *containerLXC) diskState() map[string]api.InstanceStateDisk {
 				logger.Error("Error getting disk usage", log.Ctx{"project": c.Project(), "instance": c.Name(), "err": err})
 				continue
 			}
+
+			directories, err = pool.GetInstanceDirectoryUsage(c)
+			if err != nil {
+				logger.Error("Error getting directory usage", log.Ctx{"project": c.Project(), "instance": c.Name(), "err": err})
+			}
 		} else {
 			usage, err = c.storage.ContainerGetUsage(c)
 			if err != nil {
 				continue
 			}
+
+			mount := func() (func(), error) {
+				ourStart, err := c.StorageStart()
+				if err != nil {
+					return nil, err
+				}
+
+				return func() {
+					if ourStart {
+						c.StorageStop()
+					}
+				}, nil
+			}
+
+			key := fmt.Sprintf("%s/%s", dev.Config["pool"], project.Prefix(c.Project(), c.Name()))
+			directories = storagePools.DirectoryUsage(key, c.RootfsPath(), mount)
 		}
 
-		disk[dev.Name] = api.InstanceStateDisk{Usage: usage}
+		disk[dev.Name] = api.InstanceStateDisk{Usage: usage, Directories: directories}
 	}
 
 	return disk
@@ -29,8 +29,15 @@ func containerPatch(d *Daemon, r *http.Request) response.Response {
 	// Get the container
 	name := mux.Vars(r)["name"]
 
+	// Check the storage volumes attached by the request before it may be forwarded, as the
+	// identity of the client is lost then.
+	resp := instanceUpdateAttachCheck(d, r, project, name)
+	if resp != nil {
+		return resp
+	}
+
 	// Handle requests targeted to a container on a different node
-	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	resp, err = ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
 	if err != nil {
 		return response.SmartError(err)
 	}
@@ -38,13 +45,17 @@ func containerPatch(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
+	// Serialize with other updates of the same instance until done.
+	unlock := etagLock("instance", project, name)
+	defer unlock()
+
 	c, err := instanceLoadByProjectAndName(d.State(), project, name)
 	if err != nil {
 		return response.NotFound(err)
 	}
 
 	// Validate the ETag
-	etag := []interface{}{c.Architecture(), c.LocalConfig(), c.LocalDevices(), c.IsEphemeral(), c.Profiles()}
+	etag := instanceEtag(c)
 	err = util.EtagCheck(r, etag)
 	if err != nil {
 		return response.PreconditionFailed(err)
@@ -20,6 +20,7 @@ import (
 	driver "github.com/lxc/lxd/lxd/storage"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
 	"github.com/lxc/lxd/shared/logger"
 )
 
@@ -104,6 +105,13 @@ func containerPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(fmt.Errorf("Target node is offline"))
 	}
 
+	if targetNode != "" {
+		err := cluster.CheckPlacementTarget(d.cluster, targetNode)
+		if err != nil {
+			return response.BadRequest(err)
+		}
+	}
+
 	var inst Instance
 
 	// Check whether to forward the request to the node that is running the
@@ -172,8 +180,9 @@ func containerPost(d *Daemon, r *http.Request) response.Response {
 
 	if req.Migration {
 		if targetNode != "" {
-			// Check whether the container is running.
-			if inst != nil && inst.IsRunning() {
+			// Check whether the container is running. Running virtual machines
+			// are moved with their disk sent while in use, unless backed by ceph.
+			if inst != nil && inst.IsRunning() && inst.Type() != instancetype.VM {
 				return response.BadRequest(fmt.Errorf("Container is running"))
 			}
 
@@ -189,6 +198,10 @@ func containerPost(d *Daemon, r *http.Request) response.Response {
 				return response.SmartError(err)
 			}
 			if pool.Driver == "ceph" {
+				if inst != nil && inst.IsRunning() {
+					return response.BadRequest(fmt.Errorf("Instance is running"))
+				}
+
 				return containerPostClusteringMigrateWithCeph(d, inst, project, name, req.Name, targetNode, instanceType)
 			}
 
@@ -206,16 +219,21 @@ func containerPost(d *Daemon, r *http.Request) response.Response {
 
 		instanceOnly := req.InstanceOnly || req.ContainerOnly
 
-		if inst.Type() != instancetype.Container {
-			return response.SmartError(fmt.Errorf("Instance is not container type"))
+		err = migrationSnapshotsValidate(req.Snapshots)
+		if err != nil {
+			return response.BadRequest(err)
 		}
 
-		c := inst.(container)
-		ws, err := NewMigrationSource(c, stateful, instanceOnly)
+		ws, err := NewMigrationSource(inst, stateful, instanceOnly, req.Snapshots)
 		if err != nil {
 			return response.InternalError(err)
 		}
 
+		ws.clusterCert, err = migrationSourceClusterCert(d, r)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
 		resources := map[string][]string{}
 		resources["containers"] = []string{name}
 
@@ -321,28 +339,59 @@ func containerPostClusteringMigrate(d *Daemon, c Instance, oldName, newName, new
 		}
 
 		// First make a copy on the new node of the container to be moved.
-		entry, _, err := source.GetContainer(oldName)
+		entry, _, err := source.GetInstance(oldName)
 		if err != nil {
 			return errors.Wrap(err, "Failed to get container info")
 		}
 
-		args := lxd.ContainerCopyArgs{
+		// Running virtual machines are handed over to the new node, which
+		// starts them once moved.
+		running := c.Type() == instancetype.VM && c.IsRunning()
+
+		args := lxd.InstanceCopyArgs{
 			Name: destName,
 			Mode: "pull",
+			Live: running,
+		}
+
+		// Hand the static addresses of the container over to its copy,
+		// giving them back if the copy fails.
+		var allocations []db.NetworkAllocation
+		err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+			allocations, err = tx.InstanceNetworkAllocations(c.ID())
+			if err != nil {
+				return err
+			}
+
+			return tx.NetworkAllocationsSet(c.ID(), nil)
+		})
+		if err != nil {
+			return errors.Wrap(err, "Failed to release the static addresses of the container")
+		}
+
+		restoreAllocations := func() {
+			err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+				return tx.NetworkAllocationsSet(c.ID(), allocations)
+			})
+			if err != nil {
+				logger.Warn("Failed to restore the static addresses of the container", log.Ctx{"name": oldName, "err": err})
+			}
 		}
 
-		copyOp, err := dest.CopyContainer(source, *entry, &args)
+		copyOp, err := dest.CopyInstance(source, *entry, &args)
 		if err != nil {
+			restoreAllocations()
 			return errors.Wrap(err, "Failed to issue copy container API request")
 		}
 
 		err = copyOp.Wait()
 		if err != nil {
+			restoreAllocations()
 			return errors.Wrap(err, "Copy container operation failed")
 		}
 
 		// Delete the container on the original node.
-		deleteOp, err := source.DeleteContainer(oldName)
+		deleteOp, err := source.DeleteInstance(oldName)
 		if err != nil {
 			return errors.Wrap(err, "Failed to issue delete container API request")
 		}
@@ -394,6 +443,18 @@ func containerPostClusteringMigrate(d *Daemon, c Instance, oldName, newName, new
 			}
 		}
 
+		if running {
+			startOp, err := dest.UpdateInstanceState(destName, api.InstanceStatePut{Action: "start", Timeout: -1}, "")
+			if err != nil {
+				return errors.Wrap(err, "Failed to issue start instance API request")
+			}
+
+			err = startOp.Wait()
+			if err != nil {
+				return errors.Wrap(err, "Start instance operation failed")
+			}
+		}
+
 		return nil
 	}
 
@@ -33,8 +33,15 @@ func containerPut(d *Daemon, r *http.Request) response.Response {
 	// Get the container
 	name := mux.Vars(r)["name"]
 
+	// Check the storage volumes attached by the request before it may be forwarded, as the
+	// identity of the client is lost then.
+	resp := instanceUpdateAttachCheck(d, r, project, name)
+	if resp != nil {
+		return resp
+	}
+
 	// Handle requests targeted to a container on a different node
-	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	resp, err = ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
 	if err != nil {
 		return response.SmartError(err)
 	}
@@ -42,13 +49,23 @@ func containerPut(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
+	// Serialize with other updates of the same instance until the operation
+	// is done, so that concurrent requests can't pass the ETag check at once.
+	unlock := etagLock("instance", project, name)
+	unlockOnReturn := true
+	defer func() {
+		if unlockOnReturn {
+			unlock()
+		}
+	}()
+
 	c, err := instanceLoadByProjectAndName(d.State(), project, name)
 	if err != nil {
 		return response.NotFound(err)
 	}
 
 	// Validate the ETag
-	etag := []interface{}{c.Architecture(), c.LocalConfig(), c.LocalDevices(), c.IsEphemeral(), c.Profiles()}
+	etag := instanceEtag(c)
 	err = util.EtagCheck(r, etag)
 	if err != nil {
 		return response.PreconditionFailed(err)
@@ -79,6 +96,13 @@ func containerPut(d *Daemon, r *http.Request) response.Response {
 				Project:      project,
 			}
 
+			if containerUpdateIsMajor(c, args) {
+				err = containerSafetySnapshot(d, c, "update")
+				if err != nil {
+					return err
+				}
+			}
+
 			// FIXME: should set to true when not migrating
 			err = c.Update(args, false)
 			if err != nil {
@@ -92,6 +116,11 @@ func containerPut(d *Daemon, r *http.Request) response.Response {
 	} else {
 		// Snapshot Restore
 		do = func(op *operations.Operation) error {
+			err := containerSafetySnapshot(d, c, "restore")
+			if err != nil {
+				return err
+			}
+
 			return containerSnapRestore(d.State(), project, name, configRaw.Restore, configRaw.Stateful)
 		}
 
@@ -101,11 +130,18 @@ func containerPut(d *Daemon, r *http.Request) response.Response {
 	resources := map[string][]string{}
 	resources["containers"] = []string{name}
 
-	op, err := operations.OperationCreate(d.State(), project, operations.OperationClassTask, opType, resources, nil, do, nil, nil)
+	run := func(op *operations.Operation) error {
+		defer unlock()
+		return do(op)
+	}
+
+	op, err := operations.OperationCreate(d.State(), project, operations.OperationClassTask, opType, resources, nil, run, nil, nil)
 	if err != nil {
 		return response.InternalError(err)
 	}
 
+	unlockOnReturn = false
+
 	return operations.OperationResponse(op)
 }
 
@@ -367,7 +367,12 @@ func snapshotPost(d *Daemon, r *http.Request, sc container, containerName string
 			}
 		}
 
-		ws, err := NewMigrationSource(sc, reqNew.Live, true)
+		ws, err := NewMigrationSource(sc, reqNew.Live, true, "")
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		ws.clusterCert, err = migrationSourceClusterCert(d, r)
 		if err != nil {
 			return response.SmartError(err)
 		}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/shared"
+)
+
+// Content of the diff.yaml file of the tarballs written by ExportDiff.
+type snapshotDiffInfo struct {
+	From    string   `yaml:"from"`
+	To      string   `yaml:"to"`
+	Removed []string `yaml:"removed"`
+}
+
+// Export the changes made to the root filesystem of a container snapshot since
+// an older snapshot, given by the "from" parameter, as a tarball.
+func containerSnapshotExportGet(d *Daemon, r *http.Request) response.Response {
+	instanceType, err := urlInstanceTypeDetect(r)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+	snapshotName := mux.Vars(r)["snapshotName"]
+	fromName := r.FormValue("from")
+	compress := r.FormValue("compression")
+
+	if fromName == "" {
+		return response.BadRequest(fmt.Errorf("No snapshot to export the changes from provided"))
+	}
+
+	resp, err := ForwardedResponseIfContainerIsRemote(d, r, project, name, instanceType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if resp != nil {
+		return resp
+	}
+
+	inst, err := instanceLoadByProjectAndName(d.State(), project, name+shared.SnapshotDelimiter+snapshotName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if inst.Type() != instancetype.Container {
+		return response.BadRequest(fmt.Errorf("Only the changes between container snapshots can be exported"))
+	}
+
+	from, err := instanceLoadByProjectAndName(d.State(), project, name+shared.SnapshotDelimiter+fromName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if from.CreationDate().After(inst.CreationDate()) {
+		return response.BadRequest(fmt.Errorf("Snapshot %q is newer than snapshot %q", fromName, snapshotName))
+	}
+
+	if compress == "" {
+		compress, err = cluster.ConfigGetString(d.cluster, "backups.compression_algorithm")
+		if err != nil {
+			return response.SmartError(err)
+		}
+	}
+
+	f, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_snapshot_export_")
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	err = inst.(container).ExportDiff(f, from)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return response.SmartError(err)
+	}
+
+	if compress != "none" {
+		err = compressFileInPlace(f.Name(), compress)
+		if err != nil {
+			os.Remove(f.Name())
+			return response.SmartError(err)
+		}
+	}
+
+	ent := response.FileResponseEntry{
+		Path:     f.Name(),
+		Filename: fmt.Sprintf("%s-%s-%s.diff", name, fromName, snapshotName),
+	}
+
+	return response.FileResponse(r, []response.FileResponseEntry{ent}, nil, true)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/node"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/logger"
@@ -46,6 +47,14 @@ var instanceStateCmd = APIEndpoint{
 	Put: APIEndpointAction{Handler: containerStatePut, AccessHandler: AllowProjectPermission("containers", "operate-containers")},
 }
 
+var instanceExportCmd = APIEndpoint{
+	Name:    "instanceExport",
+	Path:    "instances/{name}/export",
+	Aliases: []APIEndpointAlias{{Name: "containerExport", Path: "containers/{name}/export"}},
+
+	Get: APIEndpointAction{Handler: containerExportGet, AccessHandler: AllowProjectPermission("containers", "operate-containers")},
+}
+
 var instanceFileCmd = APIEndpoint{
 	Name:    "instanceFile",
 	Path:    "instances/{name}/files",
@@ -76,6 +85,22 @@ var instanceSnapshotCmd = APIEndpoint{
 	Put:    APIEndpointAction{Handler: containerSnapshotHandler, AccessHandler: AllowProjectPermission("containers", "operate-containers")},
 }
 
+var instanceSnapshotFileCmd = APIEndpoint{
+	Name:    "instanceSnapshotFile",
+	Path:    "instances/{name}/snapshots/{snapshotName}/files",
+	Aliases: []APIEndpointAlias{{Name: "containerSnapshotFile", Path: "containers/{name}/snapshots/{snapshotName}/files"}},
+
+	Get: APIEndpointAction{Handler: containerSnapshotFileHandler, AccessHandler: AllowProjectPermission("containers", "operate-containers")},
+}
+
+var instanceSnapshotExportCmd = APIEndpoint{
+	Name:    "instanceSnapshotExport",
+	Path:    "instances/{name}/snapshots/{snapshotName}/export",
+	Aliases: []APIEndpointAlias{{Name: "containerSnapshotExport", Path: "containers/{name}/snapshots/{snapshotName}/export"}},
+
+	Get: APIEndpointAction{Handler: containerSnapshotExportGet, AccessHandler: AllowProjectPermission("containers", "operate-containers")},
+}
+
 var instanceConsoleCmd = APIEndpoint{
 	Name:    "instanceConsole",
 	Path:    "instances/{name}/console",
@@ -141,6 +166,22 @@ var instanceBackupExportCmd = APIEndpoint{
 	Get: APIEndpointAction{Handler: containerBackupExportGet, AccessHandler: AllowProjectPermission("containers", "view")},
 }
 
+var instanceBackupContentsCmd = APIEndpoint{
+	Name:    "instanceBackupContents",
+	Path:    "instances/{name}/backups/{backupName}/contents",
+	Aliases: []APIEndpointAlias{{Name: "containerBackupContents", Path: "containers/{name}/backups/{backupName}/contents"}},
+
+	Get: APIEndpointAction{Handler: containerBackupContentsGet, AccessHandler: AllowProjectPermission("containers", "view")},
+}
+
+var instanceBackupRestoreCmd = APIEndpoint{
+	Name:    "instanceBackupRestore",
+	Path:    "instances/{name}/backups/{backupName}/restore",
+	Aliases: []APIEndpointAlias{{Name: "containerBackupRestore", Path: "containers/{name}/backups/{backupName}/restore"}},
+
+	Post: APIEndpointAction{Handler: containerBackupRestorePost, AccessHandler: AllowProjectPermission("containers", "operate-containers")},
+}
+
 type containerAutostartList []Instance
 
 func (slice containerAutostartList) Len() int {
@@ -179,34 +220,108 @@ func containersRestart(s *state.State) error {
 
 	sort.Sort(containerAutostartList(instances))
 
-	// Restart the instances
-	for _, c := range instances {
-		config := c.ExpandedConfig()
-		lastState := config["volatile.last_state.power"]
+	// Get the concurrency limits
+	var instancesLimit, volumesLimit int64
+	err = s.Node.Transaction(func(tx *db.NodeTx) error {
+		config, err := node.ConfigLoad(tx)
+		if err != nil {
+			return err
+		}
+
+		instancesLimit, volumesLimit = config.AutostartConcurrency()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	instancesSem := make(chan struct{}, instancesLimit)
+	volumesSem := make(chan struct{}, volumesLimit)
+
+	// Restart the instances, one batch of instances with the same priority
+	// at a time.
+	for _, batch := range containerAutostartBatches(instances) {
+		wg := sync.WaitGroup{}
 
-		autoStart := config["boot.autostart"]
-		autoStartDelay := config["boot.autostart.delay"]
+		for _, c := range batch {
+			config := c.ExpandedConfig()
+			lastState := config["volatile.last_state.power"]
 
-		if shared.IsTrue(autoStart) || (autoStart == "" && lastState == "RUNNING") {
-			if c.IsRunning() {
+			autoStart := config["boot.autostart"]
+			autoStartDelay := config["boot.autostart.delay"]
+
+			start := shared.IsTrue(autoStart) || (autoStart == "" && lastState == "RUNNING")
+			if !start || c.IsRunning() {
 				continue
 			}
 
-			err = c.Start(false)
-			if err != nil {
-				logger.Errorf("Failed to start container '%s': %v", c.Name(), err)
-			}
+			instancesSem <- struct{}{}
+			wg.Add(1)
+			go func(c Instance) {
+				defer wg.Done()
 
-			autoStartDelayInt, err := strconv.Atoi(autoStartDelay)
-			if err == nil {
-				time.Sleep(time.Duration(autoStartDelayInt) * time.Second)
-			}
+				containerAutostart(c, volumesSem)
+
+				// Hold the slot for the requested delay, so that the
+				// next instance doesn't start before it's over.
+				autoStartDelayInt, err := strconv.Atoi(autoStartDelay)
+				if err == nil {
+					time.Sleep(time.Duration(autoStartDelayInt) * time.Second)
+				}
+
+				<-instancesSem
+			}(c)
 		}
+
+		wg.Wait()
 	}
 
 	return nil
 }
 
+// Start the given instance, activating its storage first while holding a slot
+// of the given semaphore.
+func containerAutostart(c Instance, volumesSem chan struct{}) {
+	volumesSem <- struct{}{}
+	ourStart, err := c.StorageStart()
+	<-volumesSem
+	if err != nil {
+		logger.Errorf("Failed to mount storage of container '%s': %v", c.Name(), err)
+		return
+	}
+
+	err = c.Start(false)
+	if err != nil {
+		logger.Errorf("Failed to start container '%s': %v", c.Name(), err)
+
+		if ourStart {
+			c.StorageStop()
+		}
+	}
+}
+
+// Split the given instances, sorted by containerAutostartList, into batches
+// of instances with the same boot.autostart.priority.
+func containerAutostartBatches(instances []Instance) [][]Instance {
+	batches := [][]Instance{}
+	current := ""
+
+	for i, c := range instances {
+		priority := c.ExpandedConfig()["boot.autostart.priority"]
+		priorityInt, _ := strconv.Atoi(priority)
+		priority = strconv.Itoa(priorityInt)
+
+		if i == 0 || priority != current {
+			batches = append(batches, []Instance{})
+			current = priority
+		}
+
+		batches[len(batches)-1] = append(batches[len(batches)-1], c)
+	}
+
+	return batches
+}
+
 type containerStopList []Instance
 
 func (slice containerStopList) Len() int {
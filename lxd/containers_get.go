@@ -17,6 +17,7 @@ import (
 	"github.com/lxc/lxd/lxd/db/query"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/logger"
@@ -239,22 +240,27 @@ func doContainersGet(d *Daemon, r *http.Request) (interface{}, error) {
 						}
 
 						if recursion == 1 {
-							c, _, err := nodeCts[container].Render()
+							c, etag, err := nodeCts[container].Render()
 							if err != nil {
 								resultListAppend(container, api.Instance{}, err)
-							} else {
-								resultListAppend(container, *c.(*api.Instance), err)
+								continue
 							}
 
+							inst := c.(*api.Instance)
+							inst.ETag, err = util.EtagHash(etag)
+							resultListAppend(container, *inst, err)
+
 							continue
 						}
 
-						c, _, err := nodeCts[container].RenderFull()
+						c, etag, err := nodeCts[container].RenderFull()
 						if err != nil {
 							resultFullListAppend(container, api.InstanceFull{}, err)
-						} else {
-							resultFullListAppend(container, *c, err)
+							continue
 						}
+
+						c.ETag, err = util.EtagHash(etag)
+						resultFullListAppend(container, *c, err)
 					}
 
 					wg.Done()
@@ -30,6 +30,7 @@ import (
 	log "github.com/lxc/lxd/shared/log15"
 	"github.com/lxc/lxd/shared/logger"
 	"github.com/lxc/lxd/shared/osarch"
+	"github.com/lxc/lxd/shared/units"
 )
 
 func createFromImage(d *Daemon, project string, req *api.InstancesPost) response.Response {
@@ -288,6 +289,12 @@ func createFromMigration(d *Daemon, project string, req *api.InstancesPost) resp
 		args.Devices[localRootDiskDeviceKey]["pool"] = storagePool
 	}
 
+	// Additional disks may come from other pools, their volumes must exist on this node.
+	err = instanceDiskVolumesCheck(d.State(), project, args.Profiles, args.Devices)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	// Early check for refresh
 	if req.Source.Refresh {
 		// Check if the container exists
@@ -320,7 +327,14 @@ func createFromMigration(d *Daemon, project string, req *api.InstancesPost) resp
 		 * socket. Anyway, it'll happen later :)
 		 */
 		_, _, err = d.cluster.ImageGet(args.Project, req.Source.BaseImage, false, true)
-		if err != nil {
+		if args.Type != instancetype.Container {
+			// Only the record of the instance is created, its volume being created by the
+			// storage pool as it's received.
+			c, err = instanceCreateInternal(d.State(), args)
+			if err != nil {
+				return response.InternalError(err)
+			}
+		} else if err != nil {
 			c, err = instanceCreateAsEmpty(d, args)
 			if err != nil {
 				return response.InternalError(err)
@@ -381,7 +395,7 @@ func createFromMigration(d *Daemon, project string, req *api.InstancesPost) resp
 		}
 	}
 
-	config, err := shared.GetTLSConfig("", "", "", cert)
+	config, err := migrationSinkTLSConfig(d, cert)
 	if err != nil {
 		if !req.Source.Refresh {
 			c.Delete()
@@ -499,6 +513,10 @@ func createFromCopy(d *Daemon, project string, req *api.InstancesPost) response.
 			}
 
 			if sourcePoolName != destPoolName {
+				if req.Source.Clone {
+					return response.BadRequest(fmt.Errorf("Clones must be created on the storage pool of their source"))
+				}
+
 				// Redirect to migration
 				return clusterCopyContainerInternal(d, source, project, req)
 			}
@@ -510,6 +528,10 @@ func createFromCopy(d *Daemon, project string, req *api.InstancesPost) response.
 			}
 
 			if pool.Driver != "ceph" {
+				if req.Source.Clone {
+					return response.BadRequest(fmt.Errorf("Clones must be created on the cluster member of their source"))
+				}
+
 				// Redirect to migration
 				return clusterCopyContainerInternal(d, source, project, req)
 			}
@@ -558,6 +580,12 @@ func createFromCopy(d *Daemon, project string, req *api.InstancesPost) response.
 		req.Profiles = source.Profiles()
 	}
 
+	// Additional disks may come from other pools than the root disk of the copy.
+	err = instanceDiskVolumesCheck(d.State(), targetProject, req.Profiles, deviceConfig.NewDevices(req.Devices))
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	if req.Stateful {
 		sourceName, _, _ := shared.ContainerGetParentAndSnapshotName(source.Name())
 		if sourceName != req.Name {
@@ -602,9 +630,40 @@ func createFromCopy(d *Daemon, project string, req *api.InstancesPost) response.
 		Stateful:     req.Stateful,
 	}
 
+	if req.Source.Clone {
+		if req.Source.Refresh {
+			return response.BadRequest(fmt.Errorf("Clones can't be refreshed"))
+		}
+
+		if source.IsSnapshot() {
+			return response.BadRequest(fmt.Errorf("Clones can only be created from instances"))
+		}
+	} else if req.Source.Independent {
+		return response.BadRequest(fmt.Errorf("Only clones can be made independent"))
+	}
+
+	err = migrationSnapshotsValidate(req.Source.Snapshots)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	run := func(op *operations.Operation) error {
+		if req.Source.Clone {
+			inst, err := containerCreateAsClone(d.State(), args, source)
+			if err != nil {
+				return err
+			}
+
+			// Flatten the clone in the background, once it's been created.
+			if req.Source.Independent {
+				return containerFlattenBackground(d.State(), inst)
+			}
+
+			return nil
+		}
+
 		instanceOnly := req.Source.InstanceOnly || req.Source.ContainerOnly
-		_, err := containerCreateAsCopy(d.State(), args, source, instanceOnly, req.Source.Refresh)
+		_, err := containerCreateAsCopy(d.State(), args, source, instanceOnly, req.Source.Snapshots, req.Source.Refresh)
 		if err != nil {
 			return err
 		}
@@ -653,58 +712,207 @@ func createFromBackup(d *Daemon, project string, data io.Reader, pool string) re
 	run := func(op *operations.Operation) error {
 		defer f.Close()
 
-		// Dump tarball to storage
 		f.Seek(0, 0)
-		cPool, err := containerCreateFromBackup(d.State(), *bInfo, f, pool != "")
-		if err != nil {
-			return errors.Wrap(err, "Create container from backup")
-		}
+		return instanceImportBackup(d, project, *bInfo, f, pool != "")
+	}
 
-		body, err := json.Marshal(&internalImportPost{
-			Name:  bInfo.Name,
-			Force: true,
-		})
+	resources := map[string][]string{}
+	resources["containers"] = []string{bInfo.Name}
+
+	op, err := operations.OperationCreate(d.State(), project, operations.OperationClassTask, db.OperationBackupRestore,
+		resources, nil, run, nil, nil)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
+
+// instanceImportBackup creates an instance in the given project from the backup tarball in data.
+func instanceImportBackup(d *Daemon, project string, bInfo backup.Info, data io.ReadSeeker, customPool bool) error {
+	// Dump tarball to storage
+	revertFunc, err := containerCreateFromBackup(d.State(), bInfo, data, customPool)
+	if err != nil {
+		return errors.Wrap(err, "Create container from backup")
+	}
+
+	body, err := json.Marshal(&internalImportPost{
+		Name:  bInfo.Name,
+		Force: true,
+	})
+	if err != nil {
+		revertFunc()
+		return errors.Wrap(err, "Marshal internal import request")
+	}
+
+	req := &http.Request{
+		Body: ioutil.NopCloser(bytes.NewReader(body)),
+	}
+	req.URL = &url.URL{
+		RawQuery: fmt.Sprintf("project=%s", project),
+	}
+	resp := internalImport(d, req)
+
+	if resp.String() != "success" {
+		revertFunc()
+		return fmt.Errorf("Internal import request: %v", resp.String())
+	}
+
+	c, err := instanceLoadByProjectAndName(d.State(), project, bInfo.Name)
+	if err != nil {
+		return errors.Wrap(err, "Load container")
+	}
+
+	_, err = c.StorageStop()
+	if err != nil {
+		return errors.Wrap(err, "Stop storage pool")
+	}
+
+	return nil
+}
+
+// createDryRun validates an instance creation request the same way it would be validated when
+// creating the instance, including the config expanded from its profiles and the free space on its
+// storage pool, and returns the resulting instance without creating anything.
+func createDryRun(d *Daemon, project string, req *api.InstancesPost) response.Response {
+	dbType, err := instancetype.New(string(req.Type))
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	args := db.InstanceArgs{
+		Project:     project,
+		Config:      req.Config,
+		Type:        dbType,
+		Description: req.Description,
+		Devices:     deviceConfig.NewDevices(req.Devices),
+		Ephemeral:   req.Ephemeral,
+		Name:        req.Name,
+		Profiles:    req.Profiles,
+	}
+
+	if req.Architecture != "" {
+		args.Architecture, err = osarch.ArchitectureId(req.Architecture)
 		if err != nil {
-			cPool.ContainerDelete(&containerLXC{name: bInfo.Name, project: project})
-			return errors.Wrap(err, "Marshal internal import request")
+			return response.BadRequest(err)
 		}
+	}
 
-		req := &http.Request{
-			Body: ioutil.NopCloser(bytes.NewReader(body)),
-		}
-		req.URL = &url.URL{
-			RawQuery: fmt.Sprintf("project=%s", project),
+	// Check that a local source image exists and use its architecture.
+	if req.Source.Type == "image" && req.Source.Server == "" {
+		hash := req.Source.Fingerprint
+		if hash == "" && req.Source.Alias != "" {
+			_, alias, err := d.cluster.ImageAliasGet(project, req.Source.Alias, true)
+			if err != nil {
+				return response.SmartError(err)
+			}
+
+			hash = alias.Target
 		}
-		resp := internalImport(d, req)
 
-		if resp.String() != "success" {
-			cPool.ContainerDelete(&containerLXC{name: bInfo.Name, project: project})
-			return fmt.Errorf("Internal import request: %v", resp.String())
+		if hash != "" {
+			_, img, err := d.cluster.ImageGet(project, hash, false, false)
+			if err != nil {
+				return response.SmartError(err)
+			}
+
+			args.Architecture, err = osarch.ArchitectureId(img.Architecture)
+			if err != nil {
+				return response.SmartError(err)
+			}
 		}
+	}
 
-		c, err := instanceLoadByProjectAndName(d.State(), project, bInfo.Name)
+	err = instanceCreateValidate(d.State(), &args)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	// Check the project exists and that the name isn't already in use.
+	exists := false
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		projectExists, err := tx.ProjectExists(args.Project)
 		if err != nil {
-			return errors.Wrap(err, "Load container")
+			return err
 		}
 
-		_, err = c.StorageStop()
-		if err != nil {
-			return errors.Wrap(err, "Stop storage pool")
+		if !projectExists {
+			return fmt.Errorf("Project %q does not exist", args.Project)
 		}
 
-		return nil
+		exists, err = tx.InstanceExists(args.Project, args.Name)
+		return err
+	})
+	if err != nil {
+		return response.SmartError(err)
 	}
 
-	resources := map[string][]string{}
-	resources["containers"] = []string{bInfo.Name}
+	if exists {
+		return response.Conflict(fmt.Errorf("Instance '%s' already exists", args.Name))
+	}
 
-	op, err := operations.OperationCreate(d.State(), project, operations.OperationClassTask, db.OperationBackupRestore,
-		resources, nil, run, nil, nil)
+	// Validate the config and devices expanded from the profiles.
+	profiles, err := d.cluster.ProfilesGet(args.Project, args.Profiles)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	expandedConfig := db.ProfilesExpandConfig(args.Config, profiles)
+	expandedDevices := db.ProfilesExpandDevices(args.Devices, profiles)
+
+	err = containerValidConfig(d.os, expandedConfig, false, true)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = containerValidDevices(d.State(), d.cluster, args.Name, expandedDevices, true)
+	if err != nil {
+		return response.BadRequest(errors.Wrap(err, "Invalid devices"))
+	}
+
+	// Check the storage pool can accommodate the root disk.
+	_, rootDiskDevice, err := shared.GetRootDiskDevice(expandedDevices.CloneNative())
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	if rootDiskDevice["pool"] == "" {
+		return response.BadRequest(fmt.Errorf("The instance's root device is missing the pool property"))
+	}
+
+	err = storagePoolCheckCapacity(d.State(), rootDiskDevice["pool"], rootDiskDevice["size"])
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = storagePoolWatermarkCheck(d.State(), rootDiskDevice["pool"], "volumes")
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	architectureName, err := osarch.ArchitectureName(args.Architecture)
 	if err != nil {
 		return response.InternalError(err)
 	}
 
-	return operations.OperationResponse(op)
+	inst := api.Instance{
+		InstancePut: api.InstancePut{
+			Architecture: architectureName,
+			Config:       args.Config,
+			Devices:      args.Devices.CloneNative(),
+			Ephemeral:    args.Ephemeral,
+			Profiles:     args.Profiles,
+			Description:  args.Description,
+		},
+		ExpandedConfig:  expandedConfig,
+		ExpandedDevices: expandedDevices.CloneNative(),
+		Name:            args.Name,
+		Status:          api.Stopped.String(),
+		StatusCode:      api.Stopped,
+		Type:            dbType.String(),
+	}
+
+	return response.SyncResponse(true, inst)
 }
 
 func containersPost(d *Daemon, r *http.Request) response.Response {
@@ -722,24 +930,43 @@ func containersPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	return containersPostRequest(d, r, project, req)
+}
+
+// containersPostRequest creates an instance as requested, placing it on a cluster member first if
+// none was targeted.
+func containersPostRequest(d *Daemon, r *http.Request, project string, req api.InstancesPost) response.Response {
+	// Check the storage volumes attached by the request before it may be forwarded, as the
+	// identity of the client is lost then.
+	resp := storagePoolVolumeAttachCheck(d, r, nil, req.Devices)
+	if resp != nil {
+		return resp
+	}
+
+	// A dry run only validates the request, so it is always handled locally.
+	dryRun := shared.IsTrue(queryParam(r, "dry-run"))
+
 	targetNode := queryParam(r, "target")
 	if targetNode == "" {
 		// If no target node was specified, pick the node with the
-		// least number of containers. If there's just one node, or if
-		// the selected node is the local one, this is effectively a
-		// no-op, since NodeWithLeastContainers() will return an empty
-		// string.
-		err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
-			var err error
-			targetNode, err = tx.NodeWithLeastContainers()
-			return err
-		})
-		if err != nil {
-			return response.SmartError(err)
+		// least number of containers among the ones whose storage pool
+		// can host the new one. If the selected node is the local one,
+		// this is effectively a no-op.
+		var resp response.Response
+		targetNode, resp = containerPickTarget(d, project, &req)
+		if resp != nil {
+			return resp
 		}
 	}
 
 	if targetNode != "" {
+		err := cluster.CheckPlacementTarget(d.cluster, targetNode)
+		if err != nil {
+			return response.BadRequest(err)
+		}
+	}
+
+	if targetNode != "" && !dryRun {
 		address, err := cluster.ResolveTarget(d.cluster, targetNode)
 		if err != nil {
 			return response.SmartError(err)
@@ -822,6 +1049,10 @@ func containersPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(fmt.Errorf("Invalid container name: '%s' is reserved for snapshots", shared.SnapshotDelimiter))
 	}
 
+	if dryRun {
+		return createDryRun(d, project, &req)
+	}
+
 	switch req.Source.Type {
 	case "image":
 		return createFromImage(d, project, &req)
@@ -874,6 +1105,16 @@ func containerFindStoragePool(d *Daemon, project string, req *api.InstancesPost)
 		}
 	}
 
+	// Then use the default storage pool of the project
+	if storagePool == "" {
+		config, err := projectConfig(d.cluster, project)
+		if err != nil {
+			return "", "", "", nil, response.SmartError(err)
+		}
+
+		storagePool = config["default.storage.pool"]
+	}
+
 	// If there is just a single pool in the database, use that
 	if storagePool == "" {
 		logger.Debugf("No valid storage pool in the container's local root disk device and profiles found")
@@ -893,6 +1134,138 @@ func containerFindStoragePool(d *Daemon, project string, req *api.InstancesPost)
 	return storagePool, storagePoolProfile, localRootDiskDeviceKey, localRootDiskDevice, nil
 }
 
+// containerPickTarget returns the name of the cluster member which should host
+// the new instance, considering the health and free space of the storage pool
+// of its root disk on each member, and then their number of instances.
+func containerPickTarget(d *Daemon, project string, req *api.InstancesPost) (string, response.Response) {
+	var counts []db.NodeInstanceCount
+	var changes []db.NodePendingChange
+	var local string
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+		counts, err = tx.NodesAvailable()
+		if err != nil {
+			return err
+		}
+
+		changes, err = tx.NodePendingChanges("")
+		if err != nil {
+			return err
+		}
+
+		local, err = tx.NodeName()
+		return err
+	})
+	if err != nil {
+		return "", response.SmartError(err)
+	}
+
+	if len(counts) == 0 {
+		return "", nil
+	}
+
+	if len(counts) == 1 {
+		return counts[0].Name, nil
+	}
+
+	// Find the pool of the root disk, using the default profile like the
+	// creation itself does if none is given.
+	poolReq := *req
+	if poolReq.Profiles == nil {
+		poolReq.Profiles = []string{"default"}
+	}
+
+	poolName, _, _, rootDiskDevice, resp := containerFindStoragePool(d, project, &poolReq)
+	if resp != nil {
+		return "", resp
+	}
+
+	// Without a pool, only the number of instances matters.
+	if poolName == "" {
+		best := counts[0]
+		for _, count := range counts[1:] {
+			if count.Containers < best.Containers {
+				best = count
+			}
+		}
+
+		return best.Name, nil
+	}
+
+	_, pool, err := d.cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return "", response.SmartError(err)
+	}
+
+	size := rootDiskDevice["size"]
+	if size == "" {
+		size = pool.Config["volume.size"]
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return "", response.BadRequest(err)
+	}
+
+	// The pool is unhealthy on the members which failed to apply changes
+	// to it.
+	failed := map[string]bool{}
+	for _, change := range changes {
+		if change.Entity == clusterChangeStoragePool && change.Name == poolName && change.Error != "" {
+			failed[change.Node] = true
+		}
+	}
+
+	candidates := []cluster.PlacementCandidate{}
+	for _, count := range counts {
+		candidate := cluster.PlacementCandidate{
+			Name:       count.Name,
+			Containers: count.Containers,
+			Healthy:    pool.Status == "Created" && shared.StringInSlice(count.Name, pool.Locations) && !failed[count.Name],
+		}
+
+		if candidate.Healthy {
+			res, err := containerPickTargetPoolUsage(d, local, count.Name, poolName)
+			if err != nil {
+				logger.Warn("Failed to get storage pool usage", log.Ctx{"pool": poolName, "member": count.Name, "err": err})
+				candidate.Healthy = false
+			} else {
+				candidate.Used = res.Space.Used
+				candidate.Total = res.Space.Total
+			}
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	warn, act := storagePoolWatermarks(pool.Config)
+	name := cluster.PlacementPick(candidates, uint64(sizeBytes), float64(warn)/100, float64(act)/100)
+	if name == "" {
+		return "", response.BadRequest(fmt.Errorf("No cluster member has a healthy storage pool %q with enough free space", poolName))
+	}
+
+	return name, nil
+}
+
+// Return the usage of the given storage pool on the given cluster member.
+func containerPickTargetPoolUsage(d *Daemon, local string, member string, poolName string) (*api.ResourcesStoragePool, error) {
+	if member == local {
+		return storagePoolUsage(d.State(), poolName)
+	}
+
+	address, err := cluster.ResolveTarget(d.cluster, member)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := cluster.Connect(address, d.endpoints.NetworkCert(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GetStoragePoolResources(poolName)
+}
+
 func clusterCopyContainerInternal(d *Daemon, source Instance, project string, req *api.InstancesPost) response.Response {
 	name := req.Source.Source
 
@@ -949,6 +1322,7 @@ func clusterCopyContainerInternal(d *Daemon, source Instance, project string, re
 			Live:          req.Source.Live,
 			ContainerOnly: instanceOnly,
 			InstanceOnly:  instanceOnly,
+			Snapshots:     req.Source.Snapshots,
 			Name:          req.Name,
 		}
 
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/lxc/lxd/shared/log15"
+
+	"github.com/lxc/lxd/lxd/node"
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/logging"
+	"github.com/lxc/lxd/shared/version"
+)
+
+// Time given to the HTTP hook to reach a verdict, scanning large images can be slow.
+var contentScanTimeout = 30 * time.Minute
+
+// contentScanRequest is the body of the requests sent to the HTTP hook.
+type contentScanRequest struct {
+	Type  string   `json:"type"`
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+}
+
+// contentScan runs the scanner configured with storage.scan_command or storage.scan_url against
+// the files of an imported image or storage volume, before it is made available. The kind is
+// either "image" or "volume". Files the scanner rejects are moved to the quarantine directory
+// and an error is returned, the caller must then drop the import.
+func contentScan(d *Daemon, kind string, name string, paths []string) error {
+	command, url, err := node.ContentScanner(d.State().Node)
+	if err != nil {
+		return err
+	}
+
+	if command == "" && url == "" {
+		return nil
+	}
+
+	logger := logging.AddContext(logger.Log, log.Ctx{"type": kind, "name": name})
+	logger.Debug("Scanning imported content")
+
+	var reason string
+	if command != "" {
+		reason, err = contentScanCommand(command, kind, name, paths)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason == "" && url != "" {
+		reason, err = contentScanURL(d, url, kind, name, paths)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	dir, err := contentQuarantine(kind, name, paths)
+	if err != nil {
+		logger.Error("Failed to quarantine rejected content", log.Ctx{"err": err})
+		return fmt.Errorf("Content scan rejected the %s %q: %s", kind, name, reason)
+	}
+
+	logger.Warn("Content scan rejected imported content", log.Ctx{"reason": reason, "quarantine": dir})
+	return fmt.Errorf("Content scan rejected the %s %q and it was quarantined: %s", kind, name, reason)
+}
+
+// contentScanCommand runs the scanner command with the paths as extra arguments. A non-zero exit
+// status rejects the content, with the output of the command as the reason.
+func contentScanCommand(command string, kind string, name string, paths []string) (string, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("The content scanner command is empty")
+	}
+
+	args := append(fields[1:], paths...)
+
+	env := append(os.Environ(), fmt.Sprintf("LXD_SCAN_TYPE=%s", kind), fmt.Sprintf("LXD_SCAN_NAME=%s", name))
+	stdout, stderr, err := shared.RunCommandSplit(env, fields[0], args...)
+	if err == nil {
+		return "", nil
+	}
+
+	runErr, ok := err.(shared.RunError)
+	if !ok {
+		return "", err
+	}
+
+	_, ok = runErr.Err.(*exec.ExitError)
+	if !ok {
+		return "", fmt.Errorf("Failed to run the content scanner: %v", runErr.Err)
+	}
+
+	reason := strings.TrimSpace(stderr)
+	if reason == "" {
+		reason = strings.TrimSpace(stdout)
+	}
+
+	if reason == "" {
+		reason = runErr.Err.Error()
+	}
+
+	return reason, nil
+}
+
+// contentScanURL posts the paths to the HTTP hook. A 2xx status accepts the content and any
+// other rejects it, with the body of the response as the reason.
+func contentScanURL(d *Daemon, url string, kind string, name string, paths []string) (string, error) {
+	body, err := json.Marshal(contentScanRequest{Type: kind, Name: name, Paths: paths})
+	if err != nil {
+		return "", err
+	}
+
+	client, err := util.HTTPClient("", d.proxy)
+	if err != nil {
+		return "", err
+	}
+
+	client.Timeout = contentScanTimeout
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", version.UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Failed to reach the content scanner: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return "", nil
+	}
+
+	reason, _ := ioutil.ReadAll(resp.Body)
+	if len(bytes.TrimSpace(reason)) == 0 {
+		return resp.Status, nil
+	}
+
+	return string(bytes.TrimSpace(reason)), nil
+}
+
+// contentQuarantine moves the rejected files to their own directory under the quarantine
+// directory, only readable by root, and returns its path.
+func contentQuarantine(kind string, name string, paths []string) (string, error) {
+	dir := shared.VarPath("quarantine", fmt.Sprintf("%s_%s_%d", kind, strings.Replace(name, "/", "_", -1), time.Now().Unix()))
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	for _, path := range paths {
+		err := shared.FileMove(path, filepath.Join(dir, filepath.Base(path)))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// imageScanPaths returns the files of the image at the given path, which are the metadata or
+// unified tarball and the rootfs of split images.
+func imageScanPaths(path string) []string {
+	paths := []string{path}
+	if shared.PathExists(path + ".rootfs") {
+		paths = append(paths, path+".rootfs")
+	}
+
+	return paths
+}
@@ -28,24 +28,31 @@ import (
 	"gopkg.in/macaroon-bakery.v2/bakery/identchecker"
 	"gopkg.in/macaroon-bakery.v2/httpbakery"
 
+	"github.com/lxc/lxd/lxd/apparmor"
 	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/daemon"
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/db/query"
 	"github.com/lxc/lxd/lxd/device"
 	"github.com/lxc/lxd/lxd/endpoints"
 	"github.com/lxc/lxd/lxd/events"
+	"github.com/lxc/lxd/lxd/firewall"
 	"github.com/lxc/lxd/lxd/maas"
 	"github.com/lxc/lxd/lxd/node"
+	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/rbac"
 	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/seccomp"
 	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/lxd/sys"
 	"github.com/lxc/lxd/lxd/task"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/idmap"
 	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/logging"
 	"github.com/lxc/lxd/shared/version"
 
 	log "github.com/lxc/lxd/shared/log15"
@@ -62,6 +69,8 @@ type Daemon struct {
 	setupChan    chan struct{} // Closed when basic Daemon setup is completed
 	readyChan    chan struct{} // Closed when LXD is fully ready
 	shutdownChan chan struct{}
+	drainChan    chan struct{} // Closed when LXD stops accepting new mutating requests
+	drainOnce    sync.Once
 
 	// Event servers
 	devlxdEvents *events.Server
@@ -80,6 +89,7 @@ type Daemon struct {
 	endpoints *endpoints.Endpoints
 	gateway   *cluster.Gateway
 	seccomp   *seccomp.Server
+	firewall  firewall.Firewall
 
 	proxy func(req *http.Request) (*url.URL, error)
 
@@ -148,6 +158,7 @@ func NewDaemon(config *DaemonConfig, os *sys.OS) *Daemon {
 		setupChan:    make(chan struct{}),
 		readyChan:    make(chan struct{}),
 		shutdownChan: make(chan struct{}),
+		drainChan:    make(chan struct{}),
 	}
 }
 
@@ -238,8 +249,7 @@ func (d *Daemon) checkTrustedClient(r *http.Request) error {
 func (d *Daemon) Authenticate(r *http.Request) (bool, string, string, error) {
 	// Allow internal cluster traffic
 	if r.TLS != nil {
-		cert, _ := x509.ParseCertificate(d.endpoints.NetworkCert().KeyPair().Certificate[0])
-		clusterCerts := map[string]x509.Certificate{"0": *cert}
+		clusterCerts, _ := cluster.TLSTrustedCerts(d.endpoints.NetworkCert())
 		for i := range r.TLS.PeerCertificates {
 			trusted, _ := util.CheckTrustState(*r.TLS.PeerCertificates[i], clusterCerts)
 			if trusted {
@@ -332,7 +342,7 @@ func writeMacaroonsRequiredResponse(b *identchecker.Bakery, r *http.Request, w h
 
 // State creates a new State instance linked to our internal db and os.
 func (d *Daemon) State() *state.State {
-	return state.NewState(d.db, d.cluster, d.maas, d.os, d.endpoints, d.events, d.devlxdEvents)
+	return state.NewState(d.db, d.cluster, d.maas, d.os, d.endpoints, d.events, d.devlxdEvents, d.firewall)
 }
 
 // UnixSocket returns the full path to the unix.socket file that this daemon is
@@ -369,6 +379,18 @@ func (d *Daemon) createCmd(restAPI *mux.Router, version string, c APIEndpoint) {
 			}
 		}
 
+		// Reject new mutating requests once the daemon is draining for shutdown. Internal
+		// requests are still allowed as running operations and instances may rely on them.
+		if r.Method != "GET" && version != "internal" {
+			select {
+			case <-d.drainChan:
+				response := response.Unavailable(fmt.Errorf("LXD daemon is shutting down"))
+				response.Render(w)
+				return
+			default:
+			}
+		}
+
 		// Authentication
 		trusted, username, protocol, err := d.Authenticate(r)
 		if err != nil {
@@ -694,6 +716,25 @@ func (d *Daemon) init() error {
 		return errors.Wrap(err, "Failed to fetch debug address")
 	}
 
+	traceEnabled, traceSlow, err := node.DatabaseTrace(d.db)
+	if err != nil {
+		return errors.Wrap(err, "Failed to fetch database tracing configuration")
+	}
+
+	query.TraceConfigure(traceEnabled, traceSlow)
+
+	logLevels, err := node.LogLevels(d.db)
+	if err != nil {
+		return errors.Wrap(err, "Failed to fetch subsystem log levels")
+	}
+
+	for subsystem, level := range logLevels {
+		err = logging.SetSubsystemLevel(subsystem, level)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to set log level of subsystem %q", subsystem)
+		}
+	}
+
 	/* Setup the web server */
 	config := &endpoints.Config{
 		Dir:                  d.os.VarDir,
@@ -813,6 +854,10 @@ func (d *Daemon) init() error {
 		return err
 	}
 
+	/* Setup the firewall */
+	d.firewall = firewall.New()
+	logger.Infof("Firewall loaded driver %q", d.firewall)
+
 	/* Setup the networks */
 	logger.Infof("Initializing networks")
 	err = networkStartup(d.State())
@@ -823,6 +868,20 @@ func (d *Daemon) init() error {
 	// Cleanup leftover images
 	pruneLeftoverImages(d)
 
+	// Confine the rsync processes spawned by the storage layer
+	rsync.Wrapper = func(cmd []string, paths ...string) ([]string, func(), error) {
+		enabled, err := node.AppArmorHelper(d.db, "rsync")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !enabled {
+			return cmd, func() {}, nil
+		}
+
+		return apparmor.RsyncWrapper(d.State(), cmd, paths...)
+	}
+
 	/* Setup the proxy handler, external authentication and MAAS */
 	candidAPIURL := ""
 	candidAPIKey := ""
@@ -855,6 +914,7 @@ func (d *Daemon) init() error {
 	}
 
 	logger.Infof("Loading daemon configuration")
+	var clusterConfig *cluster.Config
 	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
 		config, err := cluster.ConfigLoad(tx)
 		if err != nil {
@@ -869,12 +929,19 @@ func (d *Daemon) init() error {
 		maasAPIURL, maasAPIKey = config.MAASController()
 		rbacAPIURL, rbacAPIKey, rbacExpiry, rbacAgentURL, rbacAgentUsername, rbacAgentPrivateKey, rbacAgentPublicKey = config.RBACServer()
 
+		clusterConfig = config
+
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	err = daemonConfigSetWebhooks(d.State(), clusterConfig)
+	if err != nil {
+		return err
+	}
+
 	if rbacAPIURL != "" {
 		err = d.setupRBACServer(rbacAPIURL, rbacAPIKey, rbacExpiry, rbacAgentURL, rbacAgentUsername, rbacAgentPrivateKey, rbacAgentPublicKey)
 		if err != nil {
@@ -958,6 +1025,9 @@ func (d *Daemon) startClusterTasks() {
 	// Auto-sync images across the cluster (daily)
 	d.clusterTasks.Add(autoSyncImagesTask(d))
 
+	// Apply the changes made while offline (minutely)
+	d.clusterTasks.Add(clusterReconcileTask(d))
+
 	// Start all background tasks
 	d.clusterTasks.Start()
 }
@@ -997,14 +1067,35 @@ func (d *Daemon) Ready() error {
 		// Auto-update instance types (daily)
 		d.tasks.Add(instanceRefreshTypesTask(d))
 
+		// Remove unused image volumes (hourly)
+		d.tasks.Add(pruneImageVolumesTask(d))
+
 		// Remove expired container backups (hourly)
 		d.tasks.Add(pruneExpiredContainerBackupsTask(d))
 
 		// Take snapshot of containers (minutely check of configurable cron expression)
 		d.tasks.Add(autoCreateContainerSnapshotsTask(d))
 
+		// Take snapshot of custom volumes (minutely check of configurable cron expression)
+		d.tasks.Add(autoCreateCustomVolumeSnapshotsTask(d))
+
 		// Remove expired container snapshots (minutely)
 		d.tasks.Add(pruneExpiredContainerSnapshotsTask(d))
+
+		// Remove expired custom volume snapshots (minutely)
+		d.tasks.Add(pruneExpiredCustomVolumeSnapshotsTask(d))
+
+		// Check storage pool usage against watermarks (minutely)
+		d.tasks.Add(storagePoolWatermarksTask(d))
+
+		// Grow or warn about full LVM thin pools (minutely)
+		d.tasks.Add(lvmThinPoolsTask(d))
+
+		// Remount stale network filesystem storage pools (minutely)
+		d.tasks.Add(storagePoolStaleMountsTask(d))
+
+		// Reclaim the space freed in virtual machines (minutely check of configurable cron expression)
+		d.tasks.Add(autoCompactInstancesTask(d))
 	}
 
 	// Start all background tasks
@@ -1050,6 +1141,34 @@ func (d *Daemon) Kill() {
 	}
 }
 
+// Drain stops the daemon from accepting new mutating API requests and waits for running
+// operations to complete, for up to core.shutdown_timeout. Operations still running after that are
+// cancelled and any volumes left mounted on their behalf are unmounted.
+func (d *Daemon) Drain() {
+	d.drainOnce.Do(func() {
+		close(d.drainChan)
+
+		timeout := 5 * time.Minute
+		if d.cluster != nil {
+			n, err := cluster.ConfigGetInt64(d.cluster, "core.shutdown_timeout")
+			if err != nil {
+				logger.Warnf("Failed to get shutdown timeout, using default: %v", err)
+			} else {
+				timeout = time.Duration(n) * time.Minute
+			}
+		}
+
+		logger.Infof("Draining operations (timeout %v)", timeout)
+		remaining := operations.Drain(timeout)
+		if remaining > 0 {
+			logger.Warnf("%d operations didn't complete before shutdown", remaining)
+		}
+
+		drivers.UnmountTaskVolumes()
+		logger.Infof("Done draining operations")
+	})
+}
+
 // Stop stops the shared daemon.
 func (d *Daemon) Stop() error {
 	logger.Info("Starting shutdown sequence")
@@ -1230,6 +1349,12 @@ func (d *Daemon) setupRBACServer(rbacURL string, rbacKey string, rbacExpiry int6
 		return nil
 	}
 
+	// The private key may be kept in the secrets backend
+	rbacAgentPrivateKey, err := daemonConfigSecret(d.State(), rbacAgentPrivateKey)
+	if err != nil {
+		return err
+	}
+
 	// Get a new server struct
 	server, err := rbac.NewServer(rbacURL, rbacKey, rbacAgentURL, rbacAgentUsername, rbacAgentPrivateKey, rbacAgentPublicKey)
 	if err != nil {
@@ -1301,6 +1426,12 @@ func (d *Daemon) setupMAASController(server string, key string, machine string)
 		return nil
 	}
 
+	// The key may be kept in the secrets backend
+	key, err = daemonConfigSecret(d.State(), key)
+	if err != nil {
+		return err
+	}
+
 	// Get a new controller struct
 	controller, err := maas.NewController(server, key, machine)
 	if err != nil {
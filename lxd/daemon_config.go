@@ -1,13 +1,23 @@
 package main
 
 import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
 	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/node"
+	"github.com/lxc/lxd/lxd/secrets"
 	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 )
 
+// Cluster configuration keys whose values are stored in the secrets backend,
+// if one is configured.
+var daemonConfigSecrets = []string{"core.webhooks_secret", "maas.api.key", "rbac.agent.private_key"}
+
 func daemonConfigRender(state *state.State) (map[string]interface{}, error) {
 	config := map[string]interface{}{}
 
@@ -51,3 +61,124 @@ func daemonConfigSetProxy(d *Daemon, config *cluster.Config) {
 		config.ProxyIgnoreHosts(),
 	)
 }
+
+// Return the secrets backend configured on this member, or nil if none is.
+func daemonSecretsBackend(state *state.State) (secrets.Backend, error) {
+	var backend, address, tokenFile, mount string
+	err := state.Node.Transaction(func(tx *db.NodeTx) error {
+		config, err := node.ConfigLoad(tx)
+		if err != nil {
+			return err
+		}
+
+		backend, address, tokenFile, mount = config.SecretsBackend()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case "file":
+		return secrets.NewFile(shared.VarPath("secrets")), nil
+	case "keyring":
+		return secrets.NewKeyring(), nil
+	case "vault":
+		if address == "" || tokenFile == "" {
+			return nil, fmt.Errorf("The vault secrets backend requires core.secrets_vault_address and core.secrets_vault_token_file")
+		}
+
+		return secrets.NewVault(address, tokenFile, mount), nil
+	}
+
+	return nil, nil
+}
+
+// Store the values of the secret keys of the given cluster configuration in
+// the secrets backend, replacing them with references to the stored secrets.
+func daemonConfigSecretsStore(state *state.State, clustered bool, config map[string]interface{}) error {
+	backend, err := daemonSecretsBackend(state)
+	if err != nil {
+		return err
+	}
+
+	if backend == nil {
+		return nil
+	}
+
+	for _, key := range daemonConfigSecrets {
+		value, ok := config[key].(string)
+		if !ok {
+			continue
+		}
+
+		_, ok = secrets.IsReference(value)
+		if ok {
+			continue
+		}
+
+		if value == "" {
+			err := backend.Delete(key)
+			if err != nil && err != secrets.ErrNotFound {
+				return errors.Wrapf(err, "Failed to delete %q from the %s secrets backend", key, backend)
+			}
+
+			continue
+		}
+
+		// The references are shared by all members, so the secrets
+		// must be too.
+		if clustered && backend.String() != "vault" {
+			return fmt.Errorf("Only the vault secrets backend can be used on clustered servers")
+		}
+
+		err := backend.Set(key, value)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to store %q in the %s secrets backend", key, backend)
+		}
+
+		config[key] = secrets.Reference(key)
+	}
+
+	return nil
+}
+
+// Return the given configuration value, fetching it from the secrets backend
+// if it's a reference to a secret.
+func daemonConfigSecret(state *state.State, value string) (string, error) {
+	name, ok := secrets.IsReference(value)
+	if !ok {
+		return value, nil
+	}
+
+	backend, err := daemonSecretsBackend(state)
+	if err != nil {
+		return "", err
+	}
+
+	if backend == nil {
+		return "", fmt.Errorf("No secrets backend configured to fetch secret %q", name)
+	}
+
+	value, err = backend.Get(name)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to fetch secret %q from the %s secrets backend", name, backend)
+	}
+
+	return value, nil
+}
+
+// Update the cached webhook settings. The secret is resolved here rather than
+// on every lifecycle event, not to hit the secrets backend each time.
+func daemonConfigSetWebhooks(state *state.State, config *cluster.Config) error {
+	allowed, secret := config.Webhooks()
+
+	secret, err := daemonConfigSecret(state, secret)
+	if err != nil {
+		return err
+	}
+
+	webhook.Configure(allowed, secret)
+
+	return nil
+}
@@ -554,6 +554,12 @@ func (d *Daemon) ImageDownload(op *operations.Operation, server string, protocol
 		info.AutoUpdate = autoUpdate
 	}
 
+	// Check the image with the content scanner before it can be used
+	err = contentScan(d, "image", info.Fingerprint, imageScanPaths(destName))
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the database entry
 	err = d.cluster.ImageInsert(project, info.Fingerprint, info.Filename, info.Size, info.Public, info.AutoUpdate, info.Architecture, info.CreatedAt, info.ExpiresAt, info.Properties, info.Type)
 	if err != nil {
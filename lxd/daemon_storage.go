@@ -13,9 +13,53 @@ import (
 	"github.com/lxc/lxd/lxd/node"
 	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/shared"
 )
 
+// daemonStorageVolumeMount mounts a custom volume holding one of the directories of the daemon
+// itself, through the storage layer handling its pool.
+func daemonStorageVolumeMount(s *state.State, poolName string, volumeName string) (bool, error) {
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != storageDrivers.ErrUnknownDriver {
+		if err != nil {
+			return false, err
+		}
+
+		return pool.MountCustomVolume(volumeName, nil)
+	}
+
+	volume, err := storageInit(s, "default", poolName, volumeName, storagePoolVolumeTypeCustom)
+	if err != nil {
+		return false, err
+	}
+
+	return volume.StoragePoolVolumeMount()
+}
+
+// daemonStorageVolumeUnmount unmounts a custom volume which held one of the directories of the
+// daemon itself, through the storage layer handling its pool.
+func daemonStorageVolumeUnmount(s *state.State, poolName string, volumeName string) (bool, error) {
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != storageDrivers.ErrUnknownDriver {
+		if err != nil {
+			return false, err
+		}
+
+		return pool.UnmountCustomVolume(volumeName, nil)
+	}
+
+	volume, err := storageInit(s, "default", poolName, volumeName, storagePoolVolumeTypeCustom)
+	if err != nil {
+		return false, err
+	}
+
+	return volume.StoragePoolVolumeUmount()
+}
+
+// daemonStorageMount mounts the volumes set in storage.backups_volume and storage.images_volume
+// (and the one of the shared image store of the cluster) at startup, before anything uses them.
 func daemonStorageMount(s *state.State) error {
 	var storageBackups string
 	var storageImages string
@@ -45,12 +89,7 @@ func daemonStorageMount(s *state.State) error {
 		volumeName := fields[1]
 
 		// Mount volume
-		volume, err := storageInit(s, "default", poolName, volumeName, storagePoolVolumeTypeCustom)
-		if err != nil {
-			return errors.Wrapf(err, "Unable to load storage volume \"%s\"", source)
-		}
-
-		_, err = volume.StoragePoolVolumeMount()
+		_, err := daemonStorageVolumeMount(s, poolName, volumeName)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to mount storage volume \"%s\"", source)
 		}
@@ -72,6 +111,18 @@ func daemonStorageMount(s *state.State) error {
 		}
 	}
 
+	imagesPool, err := imagesSharedPool(s)
+	if err != nil {
+		return err
+	}
+
+	if imagesPool != "" {
+		_, err := imagesSharedVolumeMount(s, imagesPool)
+		if err != nil {
+			return errors.Wrap(err, "Failed to mount shared images storage")
+		}
+	}
+
 	return nil
 }
 
@@ -98,6 +149,15 @@ func daemonStorageUsed(s *state.State, poolName string, volumeName string) (bool
 		return true, nil
 	}
 
+	imagesPool, err := imagesSharedPool(s)
+	if err != nil {
+		return false, err
+	}
+
+	if imagesPool == poolName && volumeName == imagesSharedVolume {
+		return true, nil
+	}
+
 	return false, nil
 }
 
@@ -127,7 +187,7 @@ func daemonStorageValidate(s *state.State, target string) error {
 	}
 
 	// Confirm volume exists
-	volume, err := storageInit(s, "default", poolName, volumeName, storagePoolVolumeTypeCustom)
+	_, _, err = s.Cluster.StoragePoolNodeVolumeGetType(volumeName, storagePoolVolumeTypeCustom, poolID)
 	if err != nil {
 		return errors.Wrapf(err, "Unable to load storage volume \"%s\"", target)
 	}
@@ -142,16 +202,16 @@ func daemonStorageValidate(s *state.State, target string) error {
 	}
 
 	// Mount volume
-	ourMount, err := volume.StoragePoolVolumeMount()
+	ourMount, err := daemonStorageVolumeMount(s, poolName, volumeName)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to mount storage volume \"%s\"", target)
 	}
 	if ourMount {
-		defer volume.StoragePoolUmount()
+		defer daemonStorageVolumeUnmount(s, poolName, volumeName)
 	}
 
 	// Validate volume is empty (ignore lost+found)
-	mountpoint := shared.VarPath("storage-pools", poolName, "custom", volumeName)
+	mountpoint := storageDrivers.GetVolumeMountPath(poolName, storageDrivers.VolumeTypeCustom, volumeName)
 
 	entries, err := ioutil.ReadDir(mountpoint)
 	if err != nil {
@@ -236,12 +296,7 @@ func daemonStorageMove(s *state.State, storageType string, target string) error
 		}
 
 		// Unmount old volume
-		volume, err := storageInit(s, "default", sourcePool, sourceVolume, storagePoolVolumeTypeCustom)
-		if err != nil {
-			return errors.Wrapf(err, "Unable to load storage volume \"%s/%s\"", sourcePool, sourceVolume)
-		}
-
-		_, err = volume.StoragePoolVolumeUmount()
+		_, err = daemonStorageVolumeUnmount(s, sourcePool, sourceVolume)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to umount storage volume \"%s/%s\"", sourcePool, sourceVolume)
 		}
@@ -259,18 +314,13 @@ func daemonStorageMove(s *state.State, storageType string, target string) error
 	volumeName := fields[1]
 
 	// Mount volume
-	volume, err := storageInit(s, "default", poolName, volumeName, storagePoolVolumeTypeCustom)
-	if err != nil {
-		return errors.Wrapf(err, "Unable to load storage volume \"%s\"", target)
-	}
-
-	_, err = volume.StoragePoolVolumeMount()
+	_, err = daemonStorageVolumeMount(s, poolName, volumeName)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to mount storage volume \"%s\"", target)
 	}
 
 	// Set ownership & mode
-	mountpoint := shared.VarPath("storage-pools", poolName, "custom", volumeName)
+	mountpoint := storageDrivers.GetVolumeMountPath(poolName, storageDrivers.VolumeTypeCustom, volumeName)
 	destPath = mountpoint
 
 	err = os.Chmod(mountpoint, 0700)
@@ -304,12 +354,7 @@ func daemonStorageMove(s *state.State, storageType string, target string) error
 		}
 
 		// Unmount old volume
-		volume, err := storageInit(s, "default", sourcePool, sourceVolume, storagePoolVolumeTypeCustom)
-		if err != nil {
-			return errors.Wrapf(err, "Unable to load storage volume \"%s/%s\"", sourcePool, sourceVolume)
-		}
-
-		_, err = volume.StoragePoolVolumeUmount()
+		_, err = daemonStorageVolumeUnmount(s, sourcePool, sourceVolume)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to umount storage volume \"%s/%s\"", sourcePool, sourceVolume)
 		}
@@ -30,7 +30,7 @@ func Open(name string, store driver.NodeStore, options ...driver.Option) (*sql.D
 	}
 
 	driverName := dqliteDriverName()
-	sql.Register(driverName, driver)
+	sql.Register(driverName, query.TraceDriver(driver))
 
 	// Create the cluster db. This won't immediately establish any network
 	// connection, that will happen only when a db transaction is started
@@ -75,6 +75,14 @@ CREATE TABLE images_source (
     alias TEXT NOT NULL,
     FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
 );
+CREATE TABLE instance_presets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    project_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    definition TEXT NOT NULL,
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    UNIQUE (project_id, name)
+);
 CREATE TABLE "instances" (
     id INTEGER primary key AUTOINCREMENT NOT NULL,
     node_id INTEGER NOT NULL,
@@ -276,6 +284,16 @@ CREATE TABLE networks (
     state INTEGER NOT NULL DEFAULT 0,
     UNIQUE (name)
 );
+CREATE TABLE networks_allocations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    network_id INTEGER NOT NULL,
+    instance_id INTEGER NOT NULL,
+    device TEXT NOT NULL,
+    address TEXT NOT NULL,
+    FOREIGN KEY (network_id) REFERENCES networks (id) ON DELETE CASCADE,
+    FOREIGN KEY (instance_id) REFERENCES instances (id) ON DELETE CASCADE,
+    UNIQUE (network_id, address)
+);
 CREATE TABLE networks_config (
     id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
     network_id INTEGER NOT NULL,
@@ -303,9 +321,22 @@ CREATE TABLE nodes (
     api_extensions INTEGER NOT NULL,
     heartbeat DATETIME DEFAULT CURRENT_TIMESTAMP,
     pending INTEGER NOT NULL DEFAULT 0,
+    maintenance INTEGER NOT NULL DEFAULT 0,
     UNIQUE (name),
     UNIQUE (address)
 );
+CREATE TABLE nodes_pending_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    node_id INTEGER NOT NULL,
+    entity TEXT NOT NULL,
+    project TEXT NOT NULL,
+    name TEXT NOT NULL,
+    previous TEXT NOT NULL,
+    date DATETIME NOT NULL,
+    error TEXT NOT NULL,
+    FOREIGN KEY (node_id) REFERENCES nodes (id) ON DELETE CASCADE,
+    UNIQUE (node_id, entity, project, name)
+);
 CREATE TABLE nodes_roles (
     node_id INTEGER NOT NULL,
     role INTEGER NOT NULL,
@@ -473,6 +504,9 @@ CREATE TABLE "storage_volumes" (
     description TEXT,
     snapshot INTEGER NOT NULL DEFAULT 0,
     project_id INTEGER NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT 0,
+    expiry_date DATETIME,
+    content_type INTEGER NOT NULL DEFAULT 0,
     UNIQUE (storage_pool_id, node_id, project_id, name, type),
     FOREIGN KEY (storage_pool_id) REFERENCES storage_pools (id) ON DELETE CASCADE,
     FOREIGN KEY (node_id) REFERENCES nodes (id) ON DELETE CASCADE,
@@ -487,5 +521,5 @@ CREATE TABLE storage_volumes_config (
     FOREIGN KEY (storage_volume_id) REFERENCES storage_volumes (id) ON DELETE CASCADE
 );
 
-INSERT INTO schema (version, updated_at) VALUES (18, strftime("%s"))
+INSERT INTO schema (version, updated_at) VALUES (24, strftime("%s"))
 `
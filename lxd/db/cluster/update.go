@@ -53,6 +53,100 @@ var updates = map[int]schema.Update{
 	16: updateFromV15,
 	17: updateFromV16,
 	18: updateFromV17,
+	19: updateFromV18,
+	20: updateFromV19,
+	21: updateFromV20,
+	22: updateFromV21,
+	23: updateFromV22,
+	24: updateFromV23,
+}
+
+// Add instance_presets table
+func updateFromV23(tx *sql.Tx) error {
+	stmts := `
+CREATE TABLE instance_presets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    project_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    definition TEXT NOT NULL,
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    UNIQUE (project_id, name)
+);
+`
+	_, err := tx.Exec(stmts)
+	return err
+}
+
+// Add content_type column to storage_volumes table
+func updateFromV22(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE storage_volumes ADD COLUMN content_type INTEGER NOT NULL DEFAULT 0;")
+	return err
+}
+
+// Add creation_date and expiry_date columns to storage_volumes table
+func updateFromV21(tx *sql.Tx) error {
+	stmts := `
+ALTER TABLE storage_volumes ADD COLUMN creation_date DATETIME NOT NULL DEFAULT 0;
+ALTER TABLE storage_volumes ADD COLUMN expiry_date DATETIME;
+`
+	_, err := tx.Exec(stmts)
+	return err
+}
+
+// Add maintenance column to nodes table
+func updateFromV20(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE nodes ADD COLUMN maintenance INTEGER NOT NULL DEFAULT 0;")
+	return err
+}
+
+// Add networks_allocations table, filled with the static addresses of the
+// bridged NICs of existing instances.
+func updateFromV19(tx *sql.Tx) error {
+	stmts := `
+CREATE TABLE networks_allocations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    network_id INTEGER NOT NULL,
+    instance_id INTEGER NOT NULL,
+    device TEXT NOT NULL,
+    address TEXT NOT NULL,
+    FOREIGN KEY (network_id) REFERENCES networks (id) ON DELETE CASCADE,
+    FOREIGN KEY (instance_id) REFERENCES instances (id) ON DELETE CASCADE,
+    UNIQUE (network_id, address)
+);
+INSERT OR IGNORE INTO networks_allocations (network_id, instance_id, device, address)
+  SELECT networks.id, instances_devices.instance_id, instances_devices.name, address.value
+    FROM instances_devices
+    JOIN instances_devices_config AS nictype
+      ON nictype.instance_device_id = instances_devices.id AND nictype.key = 'nictype'
+    JOIN instances_devices_config AS parent
+      ON parent.instance_device_id = instances_devices.id AND parent.key = 'parent'
+    JOIN instances_devices_config AS address
+      ON address.instance_device_id = instances_devices.id AND address.key IN ('ipv4.address', 'ipv6.address')
+    JOIN networks ON networks.name = parent.value
+   WHERE instances_devices.type = 1 AND nictype.value = 'bridged' AND address.value != '';
+`
+	_, err := tx.Exec(stmts)
+	return err
+}
+
+// Add nodes_pending_changes table
+func updateFromV18(tx *sql.Tx) error {
+	stmts := `
+CREATE TABLE nodes_pending_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    node_id INTEGER NOT NULL,
+    entity TEXT NOT NULL,
+    project TEXT NOT NULL,
+    name TEXT NOT NULL,
+    previous TEXT NOT NULL,
+    date DATETIME NOT NULL,
+    error TEXT NOT NULL,
+    FOREIGN KEY (node_id) REFERENCES nodes (id) ON DELETE CASCADE,
+    UNIQUE (node_id, entity, project, name)
+);
+`
+	_, err := tx.Exec(stmts)
+	return err
 }
 
 // Add nodes_roles table
@@ -15,6 +15,7 @@ import (
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/logger"
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 
 	log "github.com/lxc/lxd/shared/log15"
@@ -729,6 +730,42 @@ func (c *Cluster) ContainerConfigGet(id int, key string) (string, error) {
 	return value, err
 }
 
+// InstanceUUIDExists returns whether an instance or snapshot with the given
+// "volatile.uuid" exists.
+func (c *Cluster) InstanceUUIDExists(uuid string) (bool, error) {
+	count := 0
+	err := c.Transaction(func(tx *ClusterTx) error {
+		var err error
+		count, err = query.Count(tx.tx, "instances_config", "key='volatile.uuid' AND value=?", uuid)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// InstanceUUIDsFill gives a new "volatile.uuid" to all the instances and
+// snapshots which don't have one yet.
+func (c *ClusterTx) InstanceUUIDsFill() error {
+	ids, err := query.SelectIntegers(c.tx, `
+SELECT id FROM instances
+ WHERE id NOT IN (SELECT instance_id FROM instances_config WHERE key='volatile.uuid')`)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := c.tx.Exec("INSERT INTO instances_config (instance_id, key, value) VALUES (?, 'volatile.uuid', ?)", id, uuid.NewRandom().String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // ContainerConfigRemove removes the given key from the config of the container
 // with the given ID.
 func (c *Cluster) ContainerConfigRemove(id int, key string) error {
@@ -325,7 +325,7 @@ func ForLocalInspectionWithPreparedStmts(db *sql.DB) (*Cluster, error) {
 
 // SetDefaultTimeout sets the default go-dqlite driver timeout.
 func (c *Cluster) SetDefaultTimeout(timeout time.Duration) {
-	driver := c.db.Driver().(*driver.Driver)
+	driver := query.TraceUnwrapDriver(c.db.Driver()).(*driver.Driver)
 	driver.SetContextTimeout(timeout)
 }
 
@@ -381,12 +381,16 @@ func (c *Cluster) transaction(f func(*ClusterTx) error) error {
 		stmts:  c.stmts,
 	}
 
-	return query.Retry(func() error {
+	start := time.Now()
+	err := query.Retry(func() error {
 		return query.Transaction(c.db, func(tx *sql.Tx) error {
 			clusterTx.tx = tx
 			return f(clusterTx)
 		})
 	})
+	query.TraceTransaction(start, err)
+
+	return err
 }
 
 // NodeID sets the the node NodeID associated with this cluster instance. It's used for
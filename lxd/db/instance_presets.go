@@ -0,0 +1,131 @@
+// +build linux,cgo,!agent
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lxc/lxd/lxd/db/query"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// InstancePresetNames returns the names of the instance presets of the given
+// project.
+func (c *ClusterTx) InstancePresetNames(project string) ([]string, error) {
+	return query.SelectStrings(c.tx, `
+SELECT instance_presets.name
+  FROM instance_presets JOIN projects ON projects.id = instance_presets.project_id
+ WHERE projects.name = ?
+ ORDER BY instance_presets.name`, project)
+}
+
+// InstancePresetGet returns the instance preset with the given name in the
+// given project.
+func (c *ClusterTx) InstancePresetGet(project, name string) (*api.InstancePreset, error) {
+	definitions, err := query.SelectStrings(c.tx, `
+SELECT instance_presets.definition
+  FROM instance_presets JOIN projects ON projects.id = instance_presets.project_id
+ WHERE projects.name = ? AND instance_presets.name = ?`, project, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(definitions) == 0 {
+		return nil, ErrNoSuchObject
+	}
+
+	preset := api.InstancePreset{Name: name}
+	err = json.Unmarshal([]byte(definitions[0]), &preset.InstancePresetPut)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid definition of instance preset %q: %v", name, err)
+	}
+
+	return &preset, nil
+}
+
+// InstancePresetCreate adds a new instance preset to the given project.
+func (c *ClusterTx) InstancePresetCreate(project string, preset api.InstancePresetsPost) error {
+	_, err := c.InstancePresetGet(project, preset.Name)
+	if err == nil {
+		return ErrAlreadyDefined
+	}
+
+	if err != ErrNoSuchObject {
+		return err
+	}
+
+	definition, err := json.Marshal(preset.InstancePresetPut)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.tx.Exec(`
+INSERT INTO instance_presets (project_id, name, definition)
+  VALUES ((SELECT id FROM projects WHERE name = ?), ?, ?)`, project, preset.Name, string(definition))
+	return err
+}
+
+// InstancePresetUpdate replaces the definition of the instance preset with
+// the given name.
+func (c *ClusterTx) InstancePresetUpdate(project, name string, preset api.InstancePresetPut) error {
+	definition, err := json.Marshal(preset)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.tx.Exec(`
+UPDATE instance_presets SET definition = ?
+ WHERE project_id = (SELECT id FROM projects WHERE name = ?) AND name = ?`, string(definition), project, name)
+	if err != nil {
+		return err
+	}
+
+	return instancePresetCheckUpdated(result.RowsAffected())
+}
+
+// InstancePresetRename renames the instance preset with the given name.
+func (c *ClusterTx) InstancePresetRename(project, name, newName string) error {
+	_, err := c.InstancePresetGet(project, newName)
+	if err == nil {
+		return ErrAlreadyDefined
+	}
+
+	if err != ErrNoSuchObject {
+		return err
+	}
+
+	result, err := c.tx.Exec(`
+UPDATE instance_presets SET name = ?
+ WHERE project_id = (SELECT id FROM projects WHERE name = ?) AND name = ?`, newName, project, name)
+	if err != nil {
+		return err
+	}
+
+	return instancePresetCheckUpdated(result.RowsAffected())
+}
+
+// InstancePresetDelete removes the instance preset with the given name.
+func (c *ClusterTx) InstancePresetDelete(project, name string) error {
+	result, err := c.tx.Exec(`
+DELETE FROM instance_presets
+ WHERE project_id = (SELECT id FROM projects WHERE name = ?) AND name = ?`, project, name)
+	if err != nil {
+		return err
+	}
+
+	return instancePresetCheckUpdated(result.RowsAffected())
+}
+
+// Returns ErrNoSuchObject if no instance preset row was affected by a query.
+func instancePresetCheckUpdated(n int64, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNoSuchObject
+	}
+
+	return nil
+}
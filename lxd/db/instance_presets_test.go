@@ -0,0 +1,53 @@
+// +build linux,cgo,!agent
+
+package db_test
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create, update, rename and delete an instance preset.
+func TestInstancePreset(t *testing.T) {
+	tx, cleanup := db.NewTestClusterTx(t)
+	defer cleanup()
+
+	preset := api.InstancePresetsPost{
+		Name: "web",
+		InstancePresetPut: api.InstancePresetPut{
+			Source:   api.InstanceSource{Type: "image", Alias: "ubuntu/18.04"},
+			Profiles: []string{"default"},
+			Config:   map[string]string{"limits.cpu": "2"},
+		},
+	}
+
+	require.NoError(t, tx.InstancePresetCreate("default", preset))
+	assert.Equal(t, db.ErrAlreadyDefined, tx.InstancePresetCreate("default", preset))
+
+	got, err := tx.InstancePresetGet("default", "web")
+	require.NoError(t, err)
+	assert.Equal(t, "ubuntu/18.04", got.Source.Alias)
+	assert.Equal(t, map[string]string{"limits.cpu": "2"}, got.Config)
+
+	got.Config["limits.cpu"] = "4"
+	require.NoError(t, tx.InstancePresetUpdate("default", "web", got.Writable()))
+	require.NoError(t, tx.InstancePresetRename("default", "web", "www"))
+
+	names, err := tx.InstancePresetNames("default")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"www"}, names)
+
+	got, err = tx.InstancePresetGet("default", "www")
+	require.NoError(t, err)
+	assert.Equal(t, "4", got.Config["limits.cpu"])
+
+	require.NoError(t, tx.InstancePresetDelete("default", "www"))
+	assert.Equal(t, db.ErrNoSuchObject, tx.InstancePresetDelete("default", "www"))
+
+	_, err = tx.InstancePresetGet("default", "www")
+	assert.Equal(t, db.ErrNoSuchObject, err)
+}
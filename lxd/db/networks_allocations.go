@@ -0,0 +1,165 @@
+// +build linux,cgo,!agent
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lxc/lxd/lxd/db/query"
+)
+
+// NetworkAllocation is a static address assigned to the NIC of an instance
+// connected to a managed network.
+type NetworkAllocation struct {
+	Network  string
+	Address  string
+	Project  string
+	Instance string
+	Device   string
+}
+
+// NetworkAllocations returns the static addresses assigned to instances on the
+// network with the given name.
+func (c *ClusterTx) NetworkAllocations(network string) ([]NetworkAllocation, error) {
+	allocations := []NetworkAllocation{}
+	dest := func(i int) []interface{} {
+		allocations = append(allocations, NetworkAllocation{Network: network})
+		return []interface{}{
+			&allocations[i].Address,
+			&allocations[i].Project,
+			&allocations[i].Instance,
+			&allocations[i].Device,
+		}
+	}
+
+	stmt, err := c.tx.Prepare(`
+SELECT networks_allocations.address, projects.name, instances.name, networks_allocations.device
+  FROM networks_allocations
+  JOIN networks ON networks.id = networks_allocations.network_id
+  JOIN instances ON instances.id = networks_allocations.instance_id
+  JOIN projects ON projects.id = instances.project_id
+ WHERE networks.name = ?
+ ORDER BY networks_allocations.address`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	err = query.SelectObjects(stmt, dest, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return allocations, nil
+}
+
+// InstanceNetworkAllocations returns the static addresses assigned to the
+// instance with the given ID.
+func (c *ClusterTx) InstanceNetworkAllocations(instanceID int) ([]NetworkAllocation, error) {
+	allocations := []NetworkAllocation{}
+	dest := func(i int) []interface{} {
+		allocations = append(allocations, NetworkAllocation{})
+		return []interface{}{
+			&allocations[i].Network,
+			&allocations[i].Address,
+			&allocations[i].Project,
+			&allocations[i].Instance,
+			&allocations[i].Device,
+		}
+	}
+
+	stmt, err := c.tx.Prepare(`
+SELECT networks.name, networks_allocations.address, projects.name, instances.name, networks_allocations.device
+  FROM networks_allocations
+  JOIN networks ON networks.id = networks_allocations.network_id
+  JOIN instances ON instances.id = networks_allocations.instance_id
+  JOIN projects ON projects.id = instances.project_id
+ WHERE instances.id = ?
+ ORDER BY networks_allocations.device`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	err = query.SelectObjects(stmt, dest, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return allocations, nil
+}
+
+// NetworkAllocationsCheck returns an error if any of the given addresses is
+// already assigned to an instance other than the one with the given ID.
+func (c *ClusterTx) NetworkAllocationsCheck(instanceID int, allocations []NetworkAllocation) error {
+	return networkAllocationsCheck(c.tx, instanceID, allocations)
+}
+
+// NetworkAllocationsSet replaces the static addresses assigned to the instance
+// with the given ID. Addresses on networks which are not managed are ignored.
+func (c *ClusterTx) NetworkAllocationsSet(instanceID int, allocations []NetworkAllocation) error {
+	return NetworkAllocationsSet(c.tx, instanceID, allocations)
+}
+
+// NetworkAllocationsSet replaces the static addresses assigned to the instance
+// with the given ID. Addresses on networks which are not managed are ignored.
+//
+// An error is returned if any of the addresses is already assigned to another
+// instance.
+func NetworkAllocationsSet(tx *sql.Tx, instanceID int, allocations []NetworkAllocation) error {
+	err := networkAllocationsCheck(tx, instanceID, allocations)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM networks_allocations WHERE instance_id=?", instanceID)
+	if err != nil {
+		return err
+	}
+
+	for _, allocation := range allocations {
+		_, err := tx.Exec(`
+INSERT INTO networks_allocations (network_id, instance_id, device, address)
+  SELECT id, ?, ?, ? FROM networks WHERE name=?`,
+			instanceID, allocation.Device, allocation.Address, allocation.Network)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func networkAllocationsCheck(tx *sql.Tx, instanceID int, allocations []NetworkAllocation) error {
+	stmt, err := tx.Prepare(`
+SELECT projects.name, instances.name
+  FROM networks_allocations
+  JOIN networks ON networks.id = networks_allocations.network_id
+  JOIN instances ON instances.id = networks_allocations.instance_id
+  JOIN projects ON projects.id = instances.project_id
+ WHERE networks.name = ? AND networks_allocations.address = ? AND instances.id != ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, allocation := range allocations {
+		var project string
+		var instance string
+		dest := func(i int) []interface{} {
+			return []interface{}{&project, &instance}
+		}
+
+		err := query.SelectObjects(stmt, dest, allocation.Network, allocation.Address, instanceID)
+		if err != nil {
+			return err
+		}
+
+		if instance != "" {
+			return fmt.Errorf("Address %s on network %s is already used by instance %s in project %s", allocation.Address, allocation.Network, instance, project)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// +build linux,cgo,!agent
+
+package db_test
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An address can only be assigned to one instance on a network, and is
+// released when the instance is deleted.
+func TestNetworkAllocationsSet(t *testing.T) {
+	tx, cleanup := db.NewTestClusterTx(t)
+	defer cleanup()
+
+	_, err := tx.Tx().Exec("INSERT INTO networks(name) VALUES ('lxdbr0')")
+	require.NoError(t, err)
+
+	addContainer(t, tx, 1, "c1")
+	addContainer(t, tx, 1, "c2")
+	c1 := int(getContainerID(t, tx, "c1"))
+	c2 := int(getContainerID(t, tx, "c2"))
+
+	allocations := []db.NetworkAllocation{
+		{Network: "lxdbr0", Address: "10.0.0.2", Device: "eth0"},
+		{Network: "unmanaged", Address: "10.0.0.3", Device: "eth1"},
+	}
+	require.NoError(t, tx.NetworkAllocationsSet(c1, allocations))
+
+	// Setting the same addresses again on the same instance is fine.
+	require.NoError(t, tx.NetworkAllocationsSet(c1, allocations))
+
+	err = tx.NetworkAllocationsSet(c2, allocations[:1])
+	assert.EqualError(t, err, "Address 10.0.0.2 on network lxdbr0 is already used by instance c1 in project default")
+
+	result, err := tx.NetworkAllocations("lxdbr0")
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, "c1", result[0].Instance)
+	assert.Equal(t, "eth0", result[0].Device)
+
+	_, err = tx.Tx().Exec("DELETE FROM instances WHERE id=?", c1)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.NetworkAllocationsSet(c2, allocations[:1]))
+
+	result, err = tx.InstanceNetworkAllocations(c2)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, "10.0.0.2", result[0].Address)
+}
@@ -36,6 +36,7 @@ type NodeInfo struct {
 	APIExtensions int       // Number of API extensions of the LXD code running on the node
 	Heartbeat     time.Time // Timestamp of the last heartbeat
 	Roles         []string  // List of cluster roles
+	Maintenance   bool      // Whether the node is excluded from new placements
 }
 
 // IsOffline returns true if the last successful heartbeat time of the node is
@@ -257,6 +258,20 @@ func (c *ClusterTx) nodes(pending bool, where string, args ...interface{}) ([]No
 		return nil, err
 	}
 
+	// Get nodes in maintenance
+	nodeMaintenance := map[int64]bool{}
+	ids, err := query.SelectIntegers(c.tx, "SELECT id FROM nodes WHERE maintenance=1")
+	if err != nil {
+		// Don't fail on a missing column, we need to handle updates
+		if err.Error() != "no such column: maintenance" {
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		nodeMaintenance[int64(id)] = true
+	}
+
 	// Process node entries
 	nodes := []NodeInfo{}
 	dest := func(i int) []interface{} {
@@ -295,12 +310,14 @@ func (c *ClusterTx) nodes(pending bool, where string, args ...interface{}) ([]No
 		return nil, errors.Wrap(err, "Failed to fetch nodes")
 	}
 
-	// Add the roles
+	// Add the roles and maintenance flag
 	for i, node := range nodes {
 		roles, ok := nodeRoles[node.ID]
 		if ok {
 			nodes[i].Roles = roles
 		}
+
+		nodes[i].Maintenance = nodeMaintenance[node.ID]
 	}
 
 	return nodes, nil
@@ -335,6 +352,28 @@ func (c *ClusterTx) NodePending(id int64, pending bool) error {
 	return nil
 }
 
+// NodeMaintenance toggles the maintenance flag for the node. A node in
+// maintenance keeps running its existing instances and volumes, but isn't
+// considered for new ones.
+func (c *ClusterTx) NodeMaintenance(id int64, maintenance bool) error {
+	value := 0
+	if maintenance {
+		value = 1
+	}
+	result, err := c.tx.Exec("UPDATE nodes SET maintenance=? WHERE id=?", value, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("query updated %d rows instead of 1", n)
+	}
+	return nil
+}
+
 // NodeUpdate updates the name an address of a node.
 func (c *ClusterTx) NodeUpdate(id int64, name string, address string) error {
 	result, err := c.tx.Exec("UPDATE nodes SET name=?, address=? WHERE id=?", name, address, id)
@@ -540,45 +579,80 @@ func (c *ClusterTx) NodeOfflineThreshold() (time.Duration, error) {
 	return threshold, nil
 }
 
-// NodeWithLeastContainers returns the name of the non-offline node with with
-// the least number of containers (either already created or being created with
-// an operation).
-func (c *ClusterTx) NodeWithLeastContainers() (string, error) {
+// NodeInstanceCount holds the number of containers of a node, either already
+// created or being created with an operation.
+type NodeInstanceCount struct {
+	Name       string
+	Containers int
+}
+
+// NodesAvailable returns the non-offline nodes which aren't in maintenance,
+// along with their number of containers. It's an error if all online nodes
+// are in maintenance.
+func (c *ClusterTx) NodesAvailable() ([]NodeInstanceCount, error) {
 	threshold, err := c.NodeOfflineThreshold()
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get offline threshold")
+		return nil, errors.Wrap(err, "failed to get offline threshold")
 	}
 	nodes, err := c.Nodes()
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get current nodes")
+		return nil, errors.Wrap(err, "failed to get current nodes")
 	}
 
-	name := ""
-	containers := -1
+	counts := []NodeInstanceCount{}
+	maintenance := false
 	for _, node := range nodes {
 		if node.IsOffline(threshold) {
 			continue
 		}
 
+		if node.Maintenance {
+			maintenance = true
+			continue
+		}
+
 		// Fetch the number of containers already created on this node.
 		created, err := query.Count(c.tx, "instances", "node_id=?", node.ID)
 		if err != nil {
-			return "", errors.Wrap(err, "Failed to get instances count")
+			return nil, errors.Wrap(err, "Failed to get instances count")
 		}
 
 		// Fetch the number of containers currently being created on this node.
 		pending, err := query.Count(
 			c.tx, "operations", "node_id=? AND type=?", node.ID, OperationContainerCreate)
 		if err != nil {
-			return "", errors.Wrap(err, "Failed to get pending containers count")
+			return nil, errors.Wrap(err, "Failed to get pending containers count")
 		}
 
-		count := created + pending
-		if containers == -1 || count < containers {
-			containers = count
-			name = node.Name
+		counts = append(counts, NodeInstanceCount{Name: node.Name, Containers: created + pending})
+	}
+
+	if len(counts) == 0 && maintenance {
+		return nil, fmt.Errorf("All online cluster members are in maintenance")
+	}
+
+	return counts, nil
+}
+
+// NodeWithLeastContainers returns the name of the non-offline node with with
+// the least number of containers (either already created or being created with
+// an operation). Nodes in maintenance are skipped, and it's an error if all
+// online nodes are in maintenance.
+func (c *ClusterTx) NodeWithLeastContainers() (string, error) {
+	counts, err := c.NodesAvailable()
+	if err != nil {
+		return "", err
+	}
+
+	name := ""
+	containers := -1
+	for _, count := range counts {
+		if containers == -1 || count.Containers < containers {
+			containers = count.Containers
+			name = count.Name
 		}
 	}
+
 	return name, nil
 }
 
@@ -342,6 +342,32 @@ INSERT INTO instances (id, node_id, name, architecture, type, project_id) VALUES
 	assert.Equal(t, "buzz", name)
 }
 
+// Nodes in maintenance are skipped, even if they have fewer containers.
+func TestNodeWithLeastContainers_Maintenance(t *testing.T) {
+	tx, cleanup := db.NewTestClusterTx(t)
+	defer cleanup()
+
+	id, err := tx.NodeAdd("buzz", "1.2.3.4:666")
+	require.NoError(t, err)
+
+	// Add a container to the default node (ID 1)
+	_, err = tx.Tx().Exec(`
+INSERT INTO instances (id, node_id, name, architecture, type, project_id) VALUES (1, 1, 'foo', 1, 1, 1)
+`)
+	require.NoError(t, err)
+
+	err = tx.NodeMaintenance(id, true)
+	require.NoError(t, err)
+
+	node, err := tx.NodeByName("buzz")
+	require.NoError(t, err)
+	assert.True(t, node.Maintenance)
+
+	name, err := tx.NodeWithLeastContainers()
+	require.NoError(t, err)
+	assert.Equal(t, "none", name)
+}
+
 // If there are 2 online nodes, and a container is pending on one of them,
 // return the address of the other one number of containers.
 func TestNodeWithLeastContainers_Pending(t *testing.T) {
@@ -0,0 +1,112 @@
+// +build linux,cgo,!agent
+
+package db
+
+import (
+	"time"
+
+	"github.com/lxc/lxd/lxd/db/query"
+)
+
+// NodePendingChange is a change to a cluster-wide entity (such as a storage
+// pool, a network or a profile) which a node still has to apply, because it
+// was offline when the change was made.
+type NodePendingChange struct {
+	ID       int64
+	Node     string
+	Entity   string    // Kind of entity, e.g. "network"
+	Project  string    // Project of the entity, if any
+	Name     string    // Name of the entity
+	Previous string    // JSON state of the entity before the first pending change
+	Date     time.Time // When the latest change was queued
+	Error    string    // Why the node failed to apply the changes, if it did
+}
+
+// NodePendingChangeAdd queues a change to the given entity for the node with
+// the given name. If changes to the entity are already pending for the node,
+// they are replaced by the new one, keeping the state before the first of them,
+// since the node applies them all at once.
+func (c *ClusterTx) NodePendingChangeAdd(node, entity, project, name, previous string) error {
+	info, err := c.NodeByName(node)
+	if err != nil {
+		return err
+	}
+
+	existing, err := query.SelectStrings(c.tx, `
+SELECT previous FROM nodes_pending_changes WHERE node_id=? AND entity=? AND project=? AND name=?`,
+		info.ID, entity, project, name)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		previous = existing[0]
+
+		_, err = c.tx.Exec(`
+DELETE FROM nodes_pending_changes WHERE node_id=? AND entity=? AND project=? AND name=?`,
+			info.ID, entity, project, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.tx.Exec(`
+INSERT INTO nodes_pending_changes (node_id, entity, project, name, previous, date, error)
+  VALUES (?, ?, ?, ?, ?, ?, '')`, info.ID, entity, project, name, previous, time.Now().UTC())
+	return err
+}
+
+// NodePendingChanges returns the changes which the node with the given name
+// still has to apply, or the ones of all nodes if the name is empty.
+func (c *ClusterTx) NodePendingChanges(node string) ([]NodePendingChange, error) {
+	changes := []NodePendingChange{}
+	dest := func(i int) []interface{} {
+		changes = append(changes, NodePendingChange{})
+		return []interface{}{
+			&changes[i].ID,
+			&changes[i].Node,
+			&changes[i].Entity,
+			&changes[i].Project,
+			&changes[i].Name,
+			&changes[i].Previous,
+			&changes[i].Date,
+			&changes[i].Error,
+		}
+	}
+
+	sql := `
+SELECT nodes_pending_changes.id, nodes.name, entity, project, nodes_pending_changes.name, previous, date, error
+  FROM nodes_pending_changes JOIN nodes ON nodes.id = nodes_pending_changes.node_id`
+	args := []interface{}{}
+	if node != "" {
+		sql += " WHERE nodes.name = ?"
+		args = append(args, node)
+	}
+	sql += " ORDER BY nodes_pending_changes.id"
+
+	stmt, err := c.tx.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	err = query.SelectObjects(stmt, dest, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// NodePendingChangeDelete removes a pending change once applied. A change to
+// the same entity queued in the meantime has a different ID and is kept.
+func (c *ClusterTx) NodePendingChangeDelete(id int64) error {
+	_, err := c.tx.Exec("DELETE FROM nodes_pending_changes WHERE id=?", id)
+	return err
+}
+
+// NodePendingChangeError records why the node failed to apply a pending change.
+func (c *ClusterTx) NodePendingChangeError(id int64, message string) error {
+	_, err := c.tx.Exec("UPDATE nodes_pending_changes SET error=? WHERE id=?", message, id)
+	return err
+}
@@ -0,0 +1,63 @@
+// +build linux,cgo,!agent
+
+package db_test
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Queue changes for a node, keeping the state before the first change to an
+// entity.
+func TestNodePendingChangeAdd(t *testing.T) {
+	tx, cleanup := db.NewTestClusterTx(t)
+	defer cleanup()
+
+	_, err := tx.NodeAdd("buzz", "1.2.3.4:666")
+	require.NoError(t, err)
+
+	require.NoError(t, tx.NodePendingChangeAdd("buzz", "network", "", "lxdbr0", `{"config":{"a":"1"}}`))
+	require.NoError(t, tx.NodePendingChangeAdd("buzz", "profile", "default", "default", "{}"))
+	require.NoError(t, tx.NodePendingChangeAdd("buzz", "network", "", "lxdbr0", `{"config":{"a":"2"}}`))
+
+	changes, err := tx.NodePendingChanges("buzz")
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, "profile", changes[0].Entity)
+	assert.Equal(t, "network", changes[1].Entity)
+	assert.Equal(t, "lxdbr0", changes[1].Name)
+	assert.Equal(t, `{"config":{"a":"1"}}`, changes[1].Previous)
+
+	changes, err = tx.NodePendingChanges("none")
+	require.NoError(t, err)
+	assert.Len(t, changes, 0)
+}
+
+// Applied changes are removed, while failed ones keep their error.
+func TestNodePendingChangeDelete(t *testing.T) {
+	tx, cleanup := db.NewTestClusterTx(t)
+	defer cleanup()
+
+	_, err := tx.NodeAdd("buzz", "1.2.3.4:666")
+	require.NoError(t, err)
+
+	require.NoError(t, tx.NodePendingChangeAdd("buzz", "network", "", "lxdbr0", "{}"))
+	require.NoError(t, tx.NodePendingChangeAdd("buzz", "profile", "default", "default", "{}"))
+
+	changes, err := tx.NodePendingChanges("")
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	require.NoError(t, tx.NodePendingChangeDelete(changes[0].ID))
+	require.NoError(t, tx.NodePendingChangeError(changes[1].ID, "boom"))
+
+	changes, err = tx.NodePendingChanges("")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "buzz", changes[0].Node)
+	assert.Equal(t, "boom", changes[0].Error)
+}
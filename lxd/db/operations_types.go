@@ -55,6 +55,12 @@ const (
 	OperationInstanceTypesUpdate
 	OperationBackupsExpire
 	OperationSnapshotsExpire
+	OperationContainerFlatten
+	OperationProjectImport
+	OperationProfileApply
+	OperationClusterRebalance
+	OperationInstancesCompact
+	OperationImagesPruneVolumes
 )
 
 // Description return a human-readable description of the operation type.
@@ -150,6 +156,18 @@ func (t OperationType) Description() string {
 		return "Cleaning up expired backups"
 	case OperationSnapshotsExpire:
 		return "Cleaning up expired snapshots"
+	case OperationContainerFlatten:
+		return "Flattening container"
+	case OperationProjectImport:
+		return "Importing project"
+	case OperationProfileApply:
+		return "Applying profile"
+	case OperationClusterRebalance:
+		return "Rebalancing cluster"
+	case OperationInstancesCompact:
+		return "Compacting instances"
+	case OperationImagesPruneVolumes:
+		return "Pruning image volumes"
 	default:
 		return "Executing operation"
 	}
@@ -205,6 +223,8 @@ func (t OperationType) Permission() string {
 		return "manage-containers"
 	case OperationSnapshotRestore:
 		return "manage-containers"
+	case OperationContainerFlatten:
+		return "manage-containers"
 
 	case OperationImageDownload:
 		return "manage-images"
@@ -218,6 +238,9 @@ func (t OperationType) Permission() string {
 		return "manage-images"
 	case OperationImagesSynchronize:
 		return "manage-images"
+
+	case OperationProfileApply:
+		return "manage-profiles"
 	}
 
 	return ""
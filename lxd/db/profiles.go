@@ -401,3 +401,42 @@ func ProfilesExpandDevices(devices deviceConfig.Devices, profiles []api.Profile)
 
 	return expandedDevices
 }
+
+// ProfilesExpandConfigSources returns, for each key of the expanded config of
+// a container, where its value comes from: "local" if it's set in the given
+// container config, or "profile:<name>" for the last of the given profiles
+// setting it.
+func ProfilesExpandConfigSources(config map[string]string, profiles []api.Profile) map[string]string {
+	sources := map[string]string{}
+
+	for _, profile := range profiles {
+		for k := range profile.Config {
+			sources[k] = fmt.Sprintf("profile:%s", profile.Name)
+		}
+	}
+
+	for k := range config {
+		sources[k] = "local"
+	}
+
+	return sources
+}
+
+// ProfilesExpandDevicesSources returns, for each device of the expanded
+// devices of a container, where it comes from, in the same format as
+// ProfilesExpandConfigSources.
+func ProfilesExpandDevicesSources(devices deviceConfig.Devices, profiles []api.Profile) map[string]string {
+	sources := map[string]string{}
+
+	for _, profile := range profiles {
+		for k := range profile.Devices {
+			sources[k] = fmt.Sprintf("profile:%s", profile.Name)
+		}
+	}
+
+	for k := range devices {
+		sources[k] = "local"
+	}
+
+	return sources
+}
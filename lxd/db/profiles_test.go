@@ -0,0 +1,47 @@
+// +build linux,cgo,!agent
+
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lxc/lxd/lxd/db"
+	deviceConfig "github.com/lxc/lxd/lxd/device/config"
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestProfilesExpandSources(t *testing.T) {
+	profiles := []api.Profile{
+		{
+			Name: "default",
+			ProfilePut: api.ProfilePut{
+				Config:  map[string]string{"limits.cpu": "1", "limits.memory": "1GB"},
+				Devices: map[string]map[string]string{"root": {"type": "disk", "path": "/", "pool": "default"}, "eth0": {"type": "nic"}},
+			},
+		},
+		{
+			Name: "big",
+			ProfilePut: api.ProfilePut{
+				Config:  map[string]string{"limits.cpu": "4"},
+				Devices: map[string]map[string]string{"eth0": {"type": "nic", "parent": "br1"}},
+			},
+		},
+	}
+
+	config := map[string]string{"limits.memory": "2GB", "user.foo": "bar"}
+	devices := deviceConfig.Devices{"data": {"type": "disk", "path": "/data", "source": "/srv"}}
+
+	assert.Equal(t, map[string]string{
+		"limits.cpu":    "profile:big",
+		"limits.memory": "local",
+		"user.foo":      "local",
+	}, db.ProfilesExpandConfigSources(config, profiles))
+
+	assert.Equal(t, map[string]string{
+		"root": "profile:default",
+		"eth0": "profile:big",
+		"data": "local",
+	}, db.ProfilesExpandDevicesSources(devices, profiles))
+}
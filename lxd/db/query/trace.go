@@ -0,0 +1,411 @@
+package query
+
+import (
+	"context"
+	"database/sql/driver"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// Maximum number of slow statements kept by the tracer.
+const traceSlowMax = 100
+
+// TraceStat holds the number of times a statement was executed, or a caller
+// ran a transaction, along with the time it took.
+type TraceStat struct {
+	Name    string  `json:"name" yaml:"name"`
+	Count   int64   `json:"count" yaml:"count"`
+	Errors  int64   `json:"errors" yaml:"errors"`
+	TotalMs float64 `json:"total_ms" yaml:"total_ms"`
+	MaxMs   float64 `json:"max_ms" yaml:"max_ms"`
+}
+
+// TraceSlow is a statement which took longer than the slow query threshold.
+type TraceSlow struct {
+	Statement string    `json:"statement" yaml:"statement"`
+	StartedAt time.Time `json:"started_at" yaml:"started_at"`
+	Ms        float64   `json:"ms" yaml:"ms"`
+	Caller    string    `json:"caller" yaml:"caller"`
+}
+
+// TraceStats holds the statistics gathered by the tracer since it was
+// enabled or last reset.
+type TraceStats struct {
+	Enabled      bool        `json:"enabled" yaml:"enabled"`
+	Since        time.Time   `json:"since" yaml:"since"`
+	Statements   []TraceStat `json:"statements" yaml:"statements"`
+	Transactions []TraceStat `json:"transactions" yaml:"transactions"`
+	Slow         []TraceSlow `json:"slow" yaml:"slow"`
+}
+
+type tracer struct {
+	mu           sync.Mutex
+	enabled      bool
+	slow         time.Duration
+	since        time.Time
+	statements   map[string]*TraceStat
+	transactions map[string]*TraceStat
+	slowLog      []TraceSlow
+}
+
+var trace = &tracer{}
+
+// TraceConfigure enables or disables the tracing of the statements run
+// through the drivers wrapped with TraceDriver and of the transactions
+// reported with TraceTransaction. Statements taking longer than the given
+// threshold are logged and kept in the slow query log. Enabling the tracer
+// resets its statistics.
+func TraceConfigure(enabled bool, slow time.Duration) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if enabled && !trace.enabled {
+		trace.reset()
+	}
+
+	trace.enabled = enabled
+	trace.slow = slow
+}
+
+// TraceReset clears the statistics gathered by the tracer.
+func TraceReset() {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	trace.reset()
+}
+
+// TraceGet returns the statistics gathered by the tracer, the most expensive
+// statements and transactions first.
+func TraceGet() TraceStats {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	stats := TraceStats{
+		Enabled:      trace.enabled,
+		Since:        trace.since,
+		Statements:   traceSorted(trace.statements),
+		Transactions: traceSorted(trace.transactions),
+		Slow:         append([]TraceSlow{}, trace.slowLog...),
+	}
+
+	return stats
+}
+
+// TraceTransaction records a transaction started at the given time, on
+// behalf of the first caller outside of the database packages.
+func TraceTransaction(start time.Time, err error) {
+	if !traceEnabled() {
+		return
+	}
+
+	trace.record(true, traceCaller(), time.Since(start), err)
+}
+
+func (t *tracer) reset() {
+	t.since = time.Now().UTC()
+	t.statements = map[string]*TraceStat{}
+	t.transactions = map[string]*TraceStat{}
+	t.slowLog = []TraceSlow{}
+}
+
+func (t *tracer) record(transaction bool, name string, duration time.Duration, err error) {
+	ms := float64(duration) / float64(time.Millisecond)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.statements
+	if transaction {
+		stats = t.transactions
+	}
+
+	if stats == nil {
+		return
+	}
+
+	stat, ok := stats[name]
+	if !ok {
+		stat = &TraceStat{Name: name}
+		stats[name] = stat
+	}
+
+	stat.Count++
+	stat.TotalMs += ms
+	if ms > stat.MaxMs {
+		stat.MaxMs = ms
+	}
+
+	if err != nil && err != driver.ErrSkip {
+		stat.Errors++
+	}
+}
+
+func (t *tracer) statement(statement string, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+
+	duration := time.Since(start)
+
+	t.record(false, statement, duration, err)
+
+	t.mu.Lock()
+	slow := t.slow
+	t.mu.Unlock()
+
+	if slow <= 0 || duration < slow {
+		return
+	}
+
+	caller := traceCaller()
+	ms := float64(duration) / float64(time.Millisecond)
+	logger.Warnf("Slow database query (%.0fms, from %s): %s", ms, caller, statement)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.slowLog = append(t.slowLog, TraceSlow{
+		Statement: statement,
+		StartedAt: start.UTC(),
+		Ms:        ms,
+		Caller:    caller,
+	})
+
+	if len(t.slowLog) > traceSlowMax {
+		t.slowLog = t.slowLog[len(t.slowLog)-traceSlowMax:]
+	}
+}
+
+func traceEnabled() bool {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	return trace.enabled
+}
+
+// Returns the name of the first function on the stack which isn't part of
+// the database packages or of database/sql.
+func traceCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "database/sql") && !strings.Contains(frame.Function, "/lxd/db.") && !strings.Contains(frame.Function, "/lxd/db/") {
+			return frame.Function
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return "unknown"
+}
+
+func traceSorted(stats map[string]*TraceStat) []TraceStat {
+	sorted := make([]TraceStat, 0, len(stats))
+	for _, stat := range stats {
+		sorted = append(sorted, *stat)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].TotalMs > sorted[j].TotalMs
+	})
+
+	return sorted
+}
+
+// TraceDriver wraps a database/sql driver so that the statements run through
+// it are traced, when tracing is enabled with TraceConfigure.
+func TraceDriver(d driver.Driver) driver.Driver {
+	return &traceDriver{driver: d}
+}
+
+// TraceUnwrapDriver returns the driver wrapped with TraceDriver.
+func TraceUnwrapDriver(d driver.Driver) driver.Driver {
+	traced, ok := d.(*traceDriver)
+	if ok {
+		return traced.driver
+	}
+
+	return d
+}
+
+type traceDriver struct {
+	driver driver.Driver
+}
+
+func (d *traceDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &traceConn{conn: conn}, nil
+}
+
+type traceConn struct {
+	conn driver.Conn
+}
+
+func (c *traceConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &traceStmt{stmt: stmt, query: query}, nil
+}
+
+func (c *traceConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &traceStmt{stmt: stmt, query: query}, nil
+}
+
+func (c *traceConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *traceConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *traceConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginner, ok := c.conn.(driver.ConnBeginTx)
+	if !ok {
+		return c.conn.Begin()
+	}
+
+	return beginner.BeginTx(ctx, opts)
+}
+
+func (c *traceConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	if !traceEnabled() {
+		return execer.ExecContext(ctx, query, args)
+	}
+
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	trace.statement(query, start, err)
+
+	return result, err
+}
+
+func (c *traceConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	if !traceEnabled() {
+		return queryer.QueryContext(ctx, query, args)
+	}
+
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	trace.statement(query, start, err)
+
+	return rows, err
+}
+
+type traceStmt struct {
+	stmt  driver.Stmt
+	query string
+}
+
+func (s *traceStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *traceStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *traceStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !traceEnabled() {
+		return s.stmt.Exec(args)
+	}
+
+	start := time.Now()
+	result, err := s.stmt.Exec(args)
+	trace.statement(s.query, start, err)
+
+	return result, err
+}
+
+func (s *traceStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !traceEnabled() {
+		return s.stmt.Query(args)
+	}
+
+	start := time.Now()
+	rows, err := s.stmt.Query(args)
+	trace.statement(s.query, start, err)
+
+	return rows, err
+}
+
+func (s *traceStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.stmt.(driver.StmtExecContext)
+	if !ok {
+		return s.Exec(traceValues(args))
+	}
+
+	if !traceEnabled() {
+		return execer.ExecContext(ctx, args)
+	}
+
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	trace.statement(s.query, start, err)
+
+	return result, err
+}
+
+func (s *traceStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.stmt.(driver.StmtQueryContext)
+	if !ok {
+		return s.Query(traceValues(args))
+	}
+
+	if !traceEnabled() {
+		return queryer.QueryContext(ctx, args)
+	}
+
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	trace.statement(s.query, start, err)
+
+	return rows, err
+}
+
+func traceValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	return values
+}
@@ -0,0 +1,59 @@
+package query_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/lxd/db/query"
+)
+
+func init() {
+	sql.Register("sqlite3_trace", query.TraceDriver(&sqlite3.SQLiteDriver{}))
+}
+
+// The statements run through a traced driver are counted, and slow ones are
+// kept, only while tracing is enabled.
+func TestTrace(t *testing.T) {
+	db, err := sql.Open("sqlite3_trace", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE test (id INTEGER)")
+	require.NoError(t, err)
+
+	query.TraceConfigure(true, time.Nanosecond)
+	defer query.TraceConfigure(false, 0)
+
+	for i := 0; i < 2; i++ {
+		_, err = db.Exec("INSERT INTO test VALUES (?)", i)
+		require.NoError(t, err)
+	}
+
+	stats := query.TraceGet()
+	assert.True(t, stats.Enabled)
+	require.Len(t, stats.Statements, 1)
+	assert.Equal(t, "INSERT INTO test VALUES (?)", stats.Statements[0].Name)
+	assert.Equal(t, int64(2), stats.Statements[0].Count)
+	assert.Len(t, stats.Slow, 2)
+
+	query.TraceConfigure(false, 0)
+
+	_, err = db.Exec("DELETE FROM test")
+	require.NoError(t, err)
+	assert.Len(t, query.TraceGet().Statements, 1)
+
+	query.TraceReset()
+	assert.Len(t, query.TraceGet().Statements, 0)
+}
+
+// The driver wrapped by TraceDriver can be retrieved.
+func TestTraceUnwrapDriver(t *testing.T) {
+	driver := &sqlite3.SQLiteDriver{}
+	assert.Equal(t, driver, query.TraceUnwrapDriver(query.TraceDriver(driver)))
+	assert.Equal(t, driver, query.TraceUnwrapDriver(driver))
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -136,8 +137,8 @@ func (c *ClusterTx) StoragePoolNodeJoinCeph(poolID, nodeID int64) error {
 
 	// Create entries of all the ceph volumes for the new node.
 	_, err = c.tx.Exec(`
-INSERT INTO storage_volumes(name, storage_pool_id, node_id, type, description, project_id)
-  SELECT name, storage_pool_id, ?, type, description, 1
+INSERT INTO storage_volumes(name, storage_pool_id, node_id, type, description, project_id, creation_date, expiry_date, content_type)
+  SELECT name, storage_pool_id, ?, type, description, 1, creation_date, expiry_date, content_type
     FROM storage_volumes WHERE storage_pool_id=? AND node_id=?
 `, nodeID, poolID, otherNodeID)
 	if err != nil {
@@ -788,21 +789,39 @@ func (c *Cluster) StoragePoolVolumeSnapshotsGetType(volumeName string, volumeTyp
 	// will be returned in the order that the snapshots were created. This is specifically used
 	// during migration to ensure that the storage engines can re-create snapshots using the
 	// correct deltas.
-	query := "SELECT name, description FROM storage_volumes WHERE storage_pool_id=? AND node_id=? AND type=? AND snapshot=? AND SUBSTR(name,1,?)=? ORDER BY id"
-	inargs := []interface{}{poolID, c.nodeID, volumeType, true, length, regexp}
-	typeGuide := StorageVolumeArgs{} // StorageVolume struct used to guide the types expected.
-	outfmt := []interface{}{typeGuide.Name, typeGuide.Description}
-	dbResults, err := queryScan(c.db, query, inargs, outfmt)
-	if err != nil {
-		return result, err
-	}
+	query := `
+SELECT name, coalesce(description, ''), creation_date, expiry_date
+  FROM storage_volumes
+ WHERE storage_pool_id=? AND node_id=? AND type=? AND snapshot=? AND SUBSTR(name,1,?)=?
+ ORDER BY id
+`
+	err := c.Transaction(func(tx *ClusterTx) error {
+		rows, err := tx.tx.Query(query, poolID, c.nodeID, volumeType, true, length, regexp)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			row := StorageVolumeArgs{}
+			var expiryDate *time.Time
+
+			err := rows.Scan(&row.Name, &row.Description, &row.CreationDate, &expiryDate)
+			if err != nil {
+				return err
+			}
 
-	for _, r := range dbResults {
-		row := StorageVolumeArgs{
-			Name:        r[0].(string),
-			Description: r[1].(string),
+			if expiryDate != nil {
+				row.ExpiryDate = *expiryDate
+			}
+
+			result = append(result, row)
 		}
-		result = append(result, row)
+
+		return rows.Err()
+	})
+	if err != nil {
+		return []StorageVolumeArgs{}, err
 	}
 
 	return result, nil
@@ -848,6 +867,16 @@ func (c *Cluster) StoragePoolVolumeGetType(project string, volumeName string, vo
 		return -1, nil, err
 	}
 
+	volumeContentType, err := c.StorageVolumeContentTypeGet(volumeID)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	volumeContentTypeName, err := StoragePoolVolumeContentTypeToName(volumeContentType)
+	if err != nil {
+		return -1, nil, err
+	}
+
 	storageVolume := api.StorageVolume{
 		Type: volumeTypeName,
 	}
@@ -855,6 +884,7 @@ func (c *Cluster) StoragePoolVolumeGetType(project string, volumeName string, vo
 	storageVolume.Description = volumeDescription
 	storageVolume.Config = volumeConfig
 	storageVolume.Location = volumeNode
+	storageVolume.ContentType = volumeContentTypeName
 
 	return volumeID, &storageVolume, nil
 }
@@ -902,6 +932,23 @@ func (c *Cluster) StoragePoolVolumeUpdate(volumeName string, volumeType int, poo
 	return err
 }
 
+// StoragePoolVolumeSnapshotExpiryUpdate updates the expiry date of the storage volume snapshot
+// attached to a given storage pool. The zero time clears it.
+func (c *Cluster) StoragePoolVolumeSnapshotExpiryUpdate(snapshotName string, volumeType int, poolID int64, expiryDate time.Time) error {
+	volumeID, _, err := c.StoragePoolNodeVolumeGetType(snapshotName, volumeType, poolID)
+	if err != nil {
+		return err
+	}
+
+	err = c.Transaction(func(tx *ClusterTx) error {
+		return storagePoolVolumeReplicateIfCeph(tx.tx, volumeID, "default", snapshotName, volumeType, poolID, func(volumeID int64) error {
+			return StorageVolumeExpiryDateUpdate(tx.tx, volumeID, expiryDate)
+		})
+	})
+
+	return err
+}
+
 // StoragePoolVolumeDelete deletes the storage volume attached to a given storage
 // pool.
 func (c *Cluster) StoragePoolVolumeDelete(project, volumeName string, volumeType int, poolID int64) error {
@@ -969,7 +1016,7 @@ func storagePoolVolumeReplicateIfCeph(tx *sql.Tx, volumeID int64, project, volum
 
 // StoragePoolVolumeCreate creates a new storage volume attached to a given
 // storage pool.
-func (c *Cluster) StoragePoolVolumeCreate(project, volumeName, volumeDescription string, volumeType int, snapshot bool, poolID int64, volumeConfig map[string]string) (int64, error) {
+func (c *Cluster) StoragePoolVolumeCreate(project, volumeName, volumeDescription string, volumeType int, snapshot bool, poolID int64, volumeConfig map[string]string, contentType int) (int64, error) {
 	var thisVolumeID int64
 
 	err := c.Transaction(func(tx *ClusterTx) error {
@@ -988,9 +1035,9 @@ func (c *Cluster) StoragePoolVolumeCreate(project, volumeName, volumeDescription
 
 		for _, nodeID := range nodeIDs {
 			result, err := tx.tx.Exec(`
-INSERT INTO storage_volumes (storage_pool_id, node_id, type, snapshot, name, description, project_id) VALUES (?, ?, ?, ?, ?, ?, (SELECT id FROM projects WHERE name = ?))
+INSERT INTO storage_volumes (storage_pool_id, node_id, type, snapshot, name, description, project_id, creation_date, content_type) VALUES (?, ?, ?, ?, ?, ?, (SELECT id FROM projects WHERE name = ?), ?, ?)
 `,
-				poolID, nodeID, volumeType, snapshot, volumeName, volumeDescription, project)
+				poolID, nodeID, volumeType, snapshot, volumeName, volumeDescription, project, time.Now().UTC(), contentType)
 			if err != nil {
 				return err
 			}
@@ -1068,6 +1115,19 @@ const (
 	StoragePoolVolumeTypeNameCustom    string = "custom"
 )
 
+// Content types of storage volumes, telling whether they hold a filesystem or are raw block
+// devices.
+const (
+	StoragePoolVolumeContentTypeFS = iota
+	StoragePoolVolumeContentTypeBlock
+)
+
+// Names of the content types of storage volumes, as used by the API.
+const (
+	StoragePoolVolumeContentTypeNameFS    string = "filesystem"
+	StoragePoolVolumeContentTypeNameBlock string = "block"
+)
+
 // StoragePoolNodeConfigKeys lists all storage pool config keys which are
 // node-specific.
 var StoragePoolNodeConfigKeys = []string{
@@ -1096,6 +1156,31 @@ func StoragePoolVolumeTypeToName(volumeType int) (string, error) {
 	return "", fmt.Errorf("invalid storage volume type")
 }
 
+// StoragePoolVolumeContentTypeToName converts a volume content type code to its
+// human-readable name.
+func StoragePoolVolumeContentTypeToName(contentType int) (string, error) {
+	switch contentType {
+	case StoragePoolVolumeContentTypeFS:
+		return StoragePoolVolumeContentTypeNameFS, nil
+	case StoragePoolVolumeContentTypeBlock:
+		return StoragePoolVolumeContentTypeNameBlock, nil
+	}
+
+	return "", fmt.Errorf("Invalid storage volume content type")
+}
+
+// StoragePoolVolumeContentTypeNameToType converts a volume content type name to its code.
+func StoragePoolVolumeContentTypeNameToType(contentTypeName string) (int, error) {
+	switch contentTypeName {
+	case StoragePoolVolumeContentTypeNameFS:
+		return StoragePoolVolumeContentTypeFS, nil
+	case StoragePoolVolumeContentTypeNameBlock:
+		return StoragePoolVolumeContentTypeBlock, nil
+	}
+
+	return -1, fmt.Errorf("Invalid storage volume content type name")
+}
+
 // StoragePoolInsertZfsDriver replaces the driver of all storage pools without
 // a driver, setting it to 'zfs'.
 func (c *Cluster) StoragePoolInsertZfsDriver() error {
@@ -4,6 +4,7 @@ package db_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/stretchr/testify/assert"
@@ -167,7 +168,7 @@ func TestStoragePoolVolume_Ceph(t *testing.T) {
 	require.NoError(t, err)
 
 	config := map[string]string{"k": "v"}
-	volumeID, err := cluster.StoragePoolVolumeCreate("default", "v1", "", 1, false, poolID, config)
+	volumeID, err := cluster.StoragePoolVolumeCreate("default", "v1", "", 1, false, poolID, config, db.StoragePoolVolumeContentTypeFS)
 	require.NoError(t, err)
 
 	// The returned volume ID is the one of the volume created on the local
@@ -210,3 +211,70 @@ func TestStoragePoolVolume_Ceph(t *testing.T) {
 		assert.Nil(t, volume)
 	}
 }
+
+// Volume snapshots record when they were created, and optionally when they
+// expire.
+func TestStoragePoolVolumeSnapshotDates(t *testing.T) {
+	cluster, cleanup := db.NewTestCluster(t)
+	defer cleanup()
+
+	poolID, err := cluster.StoragePoolCreate("p1", "", "dir", nil)
+	require.NoError(t, err)
+
+	_, err = cluster.StoragePoolVolumeCreate("default", "v1", "", db.StoragePoolVolumeTypeCustom, false, poolID, nil, db.StoragePoolVolumeContentTypeFS)
+	require.NoError(t, err)
+
+	before := time.Now().UTC()
+	volumeID, err := cluster.StoragePoolVolumeCreate("default", "v1/snap0", "", db.StoragePoolVolumeTypeCustom, true, poolID, nil, db.StoragePoolVolumeContentTypeFS)
+	require.NoError(t, err)
+
+	creationDate, expiryDate, err := cluster.StorageVolumeDatesGet(volumeID)
+	require.NoError(t, err)
+	assert.False(t, creationDate.Before(before.Truncate(time.Second)))
+	assert.True(t, expiryDate.IsZero())
+
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = cluster.StoragePoolVolumeSnapshotExpiryUpdate("v1/snap0", db.StoragePoolVolumeTypeCustom, poolID, expiry)
+	require.NoError(t, err)
+
+	snapshots, err := cluster.StoragePoolVolumeSnapshotsGetType("v1", db.StoragePoolVolumeTypeCustom, poolID)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, "v1/snap0", snapshots[0].Name)
+	assert.True(t, expiry.Equal(snapshots[0].ExpiryDate))
+
+	// The zero time clears the expiry date.
+	err = cluster.StoragePoolVolumeSnapshotExpiryUpdate("v1/snap0", db.StoragePoolVolumeTypeCustom, poolID, time.Time{})
+	require.NoError(t, err)
+
+	_, expiryDate, err = cluster.StorageVolumeDatesGet(volumeID)
+	require.NoError(t, err)
+	assert.True(t, expiryDate.IsZero())
+}
+
+// Volumes record whether they hold a filesystem or are raw block devices.
+func TestStoragePoolVolumeContentType(t *testing.T) {
+	cluster, cleanup := db.NewTestCluster(t)
+	defer cleanup()
+
+	poolID, err := cluster.StoragePoolCreate("p1", "", "dir", nil)
+	require.NoError(t, err)
+
+	_, err = cluster.StoragePoolVolumeCreate("default", "v1", "", db.StoragePoolVolumeTypeCustom, false, poolID, nil, db.StoragePoolVolumeContentTypeFS)
+	require.NoError(t, err)
+
+	_, err = cluster.StoragePoolVolumeCreate("default", "v2", "", db.StoragePoolVolumeTypeCustom, false, poolID, nil, db.StoragePoolVolumeContentTypeBlock)
+	require.NoError(t, err)
+
+	_, volume, err := cluster.StoragePoolNodeVolumeGetType("v1", db.StoragePoolVolumeTypeCustom, poolID)
+	require.NoError(t, err)
+	assert.Equal(t, "filesystem", volume.ContentType)
+
+	volumeID, volume, err := cluster.StoragePoolNodeVolumeGetType("v2", db.StoragePoolVolumeTypeCustom, poolID)
+	require.NoError(t, err)
+	assert.Equal(t, "block", volume.ContentType)
+
+	contentType, err := cluster.StorageVolumeContentTypeGet(volumeID)
+	require.NoError(t, err)
+	assert.Equal(t, db.StoragePoolVolumeContentTypeBlock, contentType)
+}
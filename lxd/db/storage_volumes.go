@@ -6,10 +6,12 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/lxc/lxd/lxd/db/query"
 	"github.com/lxc/lxd/shared"
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -31,6 +33,7 @@ type StorageVolumeArgs struct {
 	Config       map[string]string
 	Description  string
 	CreationDate time.Time
+	ExpiryDate   time.Time
 }
 
 // StorageVolumeNodeAddresses returns the addresses of all nodes on which the
@@ -85,6 +88,68 @@ SELECT nodes.id, nodes.address
 	return addresses, nil
 }
 
+// StorageVolumeSummary holds the details of a storage volume needed to report
+// the usage of its pool.
+type StorageVolumeSummary struct {
+	Project  string
+	Name     string
+	Type     int
+	Snapshot bool
+}
+
+// StoragePoolNodeVolumesSummary returns all the volumes (snapshots included)
+// of the given pool on the current node, across all projects.
+func (c *ClusterTx) StoragePoolNodeVolumesSummary(poolID int64) ([]StorageVolumeSummary, error) {
+	volumes := []StorageVolumeSummary{}
+	dest := func(i int) []interface{} {
+		volumes = append(volumes, StorageVolumeSummary{})
+		return []interface{}{&volumes[i].Project, &volumes[i].Name, &volumes[i].Type, &volumes[i].Snapshot}
+	}
+
+	sql := `
+SELECT projects.name, storage_volumes.name, storage_volumes.type, storage_volumes.snapshot
+  FROM storage_volumes
+  JOIN projects ON projects.id = storage_volumes.project_id
+ WHERE storage_volumes.storage_pool_id=? AND storage_volumes.node_id=?
+ ORDER BY projects.name, storage_volumes.name
+`
+	stmt, err := c.tx.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	err = query.SelectObjects(stmt, dest, poolID, c.nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+// StoragePoolNodeImagesSize returns the total size of the images cached on the
+// given pool on the current node. Images shared by several projects are only
+// counted once.
+func (c *ClusterTx) StoragePoolNodeImagesSize(poolID int64) (int64, error) {
+	sizes, err := query.SelectIntegers(c.tx, `
+SELECT coalesce(sum(size), 0) FROM (
+  SELECT DISTINCT images.fingerprint, images.size
+    FROM images
+    JOIN storage_volumes ON storage_volumes.name = images.fingerprint
+   WHERE storage_volumes.storage_pool_id=? AND storage_volumes.node_id=? AND storage_volumes.type=?
+)
+`, poolID, c.nodeID, StoragePoolVolumeTypeImage)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(sizes) != 1 {
+		return -1, fmt.Errorf("Unexpected number of results for the images size: %d", len(sizes))
+	}
+
+	return int64(sizes[0]), nil
+}
+
 // StorageVolumeNodeGet returns the name of the node a storage volume is on.
 func (c *Cluster) StorageVolumeNodeGet(volumeID int64) (string, error) {
 	name := ""
@@ -132,6 +197,42 @@ func (c *Cluster) StorageVolumeConfigGet(volumeID int64) (map[string]string, err
 	return config, nil
 }
 
+// StorageVolumeUUIDExists returns whether a storage volume or volume snapshot
+// with the given "volatile.uuid" exists.
+func (c *Cluster) StorageVolumeUUIDExists(uuid string) (bool, error) {
+	count := 0
+	err := c.Transaction(func(tx *ClusterTx) error {
+		var err error
+		count, err = query.Count(tx.tx, "storage_volumes_config", "key='volatile.uuid' AND value=?", uuid)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// StorageVolumeUUIDsFill gives a new "volatile.uuid" to all the storage
+// volumes and volume snapshots which don't have one yet.
+func (c *ClusterTx) StorageVolumeUUIDsFill() error {
+	ids, err := query.SelectIntegers(c.tx, `
+SELECT id FROM storage_volumes
+ WHERE id NOT IN (SELECT storage_volume_id FROM storage_volumes_config WHERE key='volatile.uuid')`)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := c.tx.Exec("INSERT INTO storage_volumes_config (storage_volume_id, key, value) VALUES (?, 'volatile.uuid', ?)", id, uuid.NewRandom().String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // StorageVolumeDescriptionGet gets the description of a storage volume.
 func (c *Cluster) StorageVolumeDescriptionGet(volumeID int64) (string, error) {
 	description := sql.NullString{}
@@ -150,13 +251,55 @@ func (c *Cluster) StorageVolumeDescriptionGet(volumeID int64) (string, error) {
 	return description.String, nil
 }
 
+// StorageVolumeContentTypeGet gets the content type of the storage volume with the given ID.
+func (c *Cluster) StorageVolumeContentTypeGet(volumeID int64) (int, error) {
+	contentType := -1
+	query := "SELECT content_type FROM storage_volumes WHERE id=?"
+	inargs := []interface{}{volumeID}
+	outargs := []interface{}{&contentType}
+
+	err := dbQueryRowScan(c.db, query, inargs, outargs)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrNoSuchObject
+		}
+		return -1, err
+	}
+
+	return contentType, nil
+}
+
+// StorageVolumeDatesGet gets the creation and expiry dates of the storage volume with the given
+// ID. The expiry date is the zero time if the volume doesn't expire.
+func (c *Cluster) StorageVolumeDatesGet(volumeID int64) (time.Time, time.Time, error) {
+	var creationDate time.Time
+	var expiryDate *time.Time
+	query := "SELECT creation_date, expiry_date FROM storage_volumes WHERE id=?"
+	inargs := []interface{}{volumeID}
+	outargs := []interface{}{&creationDate, &expiryDate}
+
+	err := dbQueryRowScan(c.db, query, inargs, outargs)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, time.Time{}, ErrNoSuchObject
+		}
+		return time.Time{}, time.Time{}, err
+	}
+
+	if expiryDate == nil {
+		return creationDate, time.Time{}, nil
+	}
+
+	return creationDate, *expiryDate, nil
+}
+
 // StorageVolumeNextSnapshot returns the index the next snapshot of the storage
-// volume with the given name should have.
+// volume with the given name and pattern should have.
 //
 // Note, the code below doesn't deal with snapshots of snapshots.
 // To do that, we'll need to weed out based on # slashes in names
-func (c *Cluster) StorageVolumeNextSnapshot(name string, typ int) int {
-	base := name + shared.SnapshotDelimiter + "snap"
+func (c *Cluster) StorageVolumeNextSnapshot(name string, typ int, pattern string) int {
+	base := name + shared.SnapshotDelimiter
 	length := len(base)
 	q := fmt.Sprintf("SELECT name FROM storage_volumes WHERE type=? AND snapshot=? AND SUBSTR(name,1,?)=?")
 	var numstr string
@@ -173,9 +316,11 @@ func (c *Cluster) StorageVolumeNextSnapshot(name string, typ int) int {
 		if len(numstr) <= length {
 			continue
 		}
-		substr := numstr[length:]
+		snapOnlyName := numstr[length:]
+		fields := strings.SplitN(pattern, "%d", 2)
+
 		var num int
-		count, err := fmt.Sscanf(substr, "%d", &num)
+		count, err := fmt.Sscanf(snapOnlyName, fmt.Sprintf("%s%%d%s", fields[0], fields[1]), &num)
 		if err != nil || count != 1 {
 			continue
 		}
@@ -257,6 +402,18 @@ func StorageVolumeDescriptionUpdate(tx *sql.Tx, volumeID int64, description stri
 	return err
 }
 
+// StorageVolumeExpiryDateUpdate updates the expiry date of the storage volume with the given ID.
+// The zero time clears it.
+func StorageVolumeExpiryDateUpdate(tx *sql.Tx, volumeID int64, expiryDate time.Time) error {
+	var value interface{}
+	if !expiryDate.IsZero() {
+		value = expiryDate
+	}
+
+	_, err := tx.Exec("UPDATE storage_volumes SET expiry_date=? WHERE id=?", value, volumeID)
+	return err
+}
+
 // StorageVolumeConfigAdd adds a new storage volume config into database.
 func StorageVolumeConfigAdd(tx *sql.Tx, volumeID int64, volumeConfig map[string]string) error {
 	str := "INSERT INTO storage_volumes_config (storage_volume_id, key, value) VALUES(?, ?, ?)"
@@ -35,6 +35,48 @@ func TestStorageVolumeNodeAddresses(t *testing.T) {
 	assert.Equal(t, []string{"", "1.2.3.4:666"}, addresses)
 }
 
+// The volumes of a pool on the current node are listed across projects, along
+// with the size of the images cached on it.
+func TestStoragePoolNodeVolumesSummary(t *testing.T) {
+	tx, cleanup := db.NewTestClusterTx(t)
+	defer cleanup()
+
+	nodeID2, err := tx.NodeAdd("node2", "1.2.3.4:666")
+	require.NoError(t, err)
+
+	poolID := addPool(t, tx, "pool1")
+	addVolume(t, tx, poolID, 1, "volume1")
+	addVolume(t, tx, poolID, 1, "volume1/snap0")
+	addVolume(t, tx, poolID, nodeID2, "volume2")
+
+	_, err = tx.Tx().Exec(`
+INSERT INTO images(fingerprint, filename, size, architecture, upload_date, project_id)
+  VALUES ('abc', 'img.tar.xz', 1000, 1, '2020-01-01', 1)`)
+	require.NoError(t, err)
+
+	_, err = tx.Tx().Exec(`
+INSERT INTO storage_volumes(storage_pool_id, node_id, name, type, project_id) VALUES (?, 1, 'abc', ?, 1)
+`, poolID, db.StoragePoolVolumeTypeImage)
+	require.NoError(t, err)
+
+	_, err = tx.Tx().Exec("UPDATE storage_volumes SET snapshot=1 WHERE name='volume1/snap0'")
+	require.NoError(t, err)
+
+	volumes, err := tx.StoragePoolNodeVolumesSummary(poolID)
+	require.NoError(t, err)
+
+	assert.Equal(t, []db.StorageVolumeSummary{
+		{Project: "default", Name: "abc", Type: db.StoragePoolVolumeTypeImage},
+		{Project: "default", Name: "volume1", Type: 1},
+		{Project: "default", Name: "volume1/snap0", Type: 1, Snapshot: true},
+	}, volumes)
+
+	size, err := tx.StoragePoolNodeImagesSize(poolID)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1000), size)
+}
+
 func addPool(t *testing.T, tx *db.ClusterTx, name string) int64 {
 	stmt := `
 INSERT INTO storage_pools(name, driver) VALUES (?, 'dir')
@@ -55,3 +97,21 @@ INSERT INTO storage_volumes(storage_pool_id, node_id, name, type, project_id) VA
 	_, err := tx.Tx().Exec(stmt, poolID, nodeID, name)
 	require.NoError(t, err)
 }
+
+// The index of the next snapshot of a volume follows the given pattern.
+func TestStorageVolumeNextSnapshot(t *testing.T) {
+	cluster, cleanup := db.NewTestCluster(t)
+	defer cleanup()
+
+	poolID, err := cluster.StoragePoolCreate("p1", "", "dir", nil)
+	require.NoError(t, err)
+
+	for _, name := range []string{"v1", "v1/snap0", "v1/snap1", "v1/daily-3", "v2/daily-7"} {
+		_, err = cluster.StoragePoolVolumeCreate("default", name, "", db.StoragePoolVolumeTypeCustom, name != "v1", poolID, nil, db.StoragePoolVolumeContentTypeFS)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, cluster.StorageVolumeNextSnapshot("v1", db.StoragePoolVolumeTypeCustom, "snap%d"))
+	assert.Equal(t, 4, cluster.StorageVolumeNextSnapshot("v1", db.StoragePoolVolumeTypeCustom, "daily-%d"))
+	assert.Equal(t, 0, cluster.StorageVolumeNextSnapshot("v1", db.StoragePoolVolumeTypeCustom, "weekly-%d"))
+}
@@ -16,6 +16,13 @@ var StorageVolumeMount func(s *state.State, poolName string, volumeName string,
 // StorageVolumeUmount unmounts a storage volume.
 var StorageVolumeUmount func(s *state.State, poolName string, volumeName string, volumeType int) error
 
+// StorageVolumeRemoteMount mounts a custom volume held by another cluster member and returns the
+// path it's mounted on.
+var StorageVolumeRemoteMount func(s *state.State, location string, poolName string, volumeName string) (string, error)
+
+// StorageVolumeRemoteUmount unmounts a custom volume held by another cluster member.
+var StorageVolumeRemoteUmount func(s *state.State, location string, poolName string, volumeName string) error
+
 // StorageRootFSApplyQuota applies a new quota.
 var StorageRootFSApplyQuota func(s *state.State, instance Instance, size string) error
 
@@ -16,7 +16,84 @@ type ProxyAddress struct {
 }
 
 // ProxyParseAddr validates a proxy address and parses it into its constituent parts.
+// Multiple addresses can be supplied as a comma separated list, in which case they must all use
+// the same connection type and have the same number of ports.
 func ProxyParseAddr(addr string) (*ProxyAddress, error) {
+	addrs, err := ProxyParseAddrs(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	newProxyAddr := addrs[0]
+	ports := len(newProxyAddr.Addr)
+
+	for _, a := range addrs[1:] {
+		if a.ConnType != newProxyAddr.ConnType {
+			return nil, fmt.Errorf("All addresses must use the same connection type")
+		}
+
+		if len(a.Addr) != ports {
+			return nil, fmt.Errorf("All addresses must have the same number of ports")
+		}
+
+		for _, newAddr := range a.Addr {
+			if shared.StringInSlice(newAddr, newProxyAddr.Addr) {
+				return nil, fmt.Errorf("Duplicate address '%s'", newAddr)
+			}
+
+			newProxyAddr.Addr = append(newProxyAddr.Addr, newAddr)
+		}
+	}
+
+	return newProxyAddr, nil
+}
+
+// ProxyParseAddrs validates a comma separated list of proxy addresses and parses each of them into
+// its constituent parts. Each new address starts with its connection type, with the list items in
+// between being additional ports of the previous address. Unix addresses can't be combined.
+func ProxyParseAddrs(addrs string) ([]*ProxyAddress, error) {
+	if strings.HasPrefix(addrs, "unix:") {
+		newProxyAddr, err := proxyParseSingleAddr(addrs)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*ProxyAddress{newProxyAddr}, nil
+	}
+
+	entries := []string{}
+	for i, item := range strings.Split(addrs, ",") {
+		fields := strings.SplitN(item, ":", 2)
+		if i == 0 || (len(fields) == 2 && shared.StringInSlice(fields[0], []string{"tcp", "udp", "unix"})) {
+			entries = append(entries, item)
+			continue
+		}
+
+		entries[len(entries)-1] = fmt.Sprintf("%s,%s", entries[len(entries)-1], item)
+	}
+
+	newProxyAddrs := make([]*ProxyAddress, 0, len(entries))
+	for _, entry := range entries {
+		newProxyAddr, err := proxyParseSingleAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		newProxyAddrs = append(newProxyAddrs, newProxyAddr)
+	}
+
+	return newProxyAddrs, nil
+}
+
+// ProxyConnectAddr returns the connect address that traffic received on the listen address at the
+// given index is forwarded to. The ports of each listen address are mapped to the connect ports in
+// order, unless there is a single connect port in which case all of them are mapped to it.
+func ProxyConnectAddr(connectAddr *ProxyAddress, index int) string {
+	return connectAddr.Addr[index%len(connectAddr.Addr)]
+}
+
+// proxyParseSingleAddr parses a single proxy address into its constituent parts.
+func proxyParseSingleAddr(addr string) (*ProxyAddress, error) {
 	// Split into <protocol> and <address>.
 	fields := strings.SplitN(addr, ":", 2)
 
@@ -15,9 +15,11 @@ import (
 	"github.com/lxc/lxd/lxd/db"
 	deviceConfig "github.com/lxc/lxd/lxd/device/config"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/rsync"
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/logger"
 	"github.com/lxc/lxd/shared/units"
 )
@@ -74,8 +76,10 @@ func (d *disk) validateConfig() error {
 		"limits.max":        shared.IsAny,
 		"size":              shared.IsAny,
 		"pool":              shared.IsAny,
+		"location":          shared.IsAny,
 		"propagation":       validatePropagation,
 		"raw.mount.options": shared.IsAny,
+		"seed":              shared.IsBool,
 	}
 
 	err := d.config.Validate(rules)
@@ -103,10 +107,33 @@ func (d *disk) validateConfig() error {
 		return fmt.Errorf("Only the root disk may have a size quota")
 	}
 
+	if shared.IsTrue(d.config["seed"]) && (d.config["pool"] == "" || d.config["path"] == "/") {
+		return fmt.Errorf("The seed option is only supported for custom storage volumes")
+	}
+
 	if d.config["recursive"] != "" && (d.config["path"] == "/" || !shared.IsDir(shared.HostPath(d.config["source"]))) {
 		return fmt.Errorf("The recursive option is only supported for additional bind-mounted paths")
 	}
 
+	if d.config["location"] != "" {
+		if d.config["pool"] == "" || d.config["path"] == "/" {
+			return fmt.Errorf("The \"location\" property is only supported for custom storage volumes")
+		}
+
+		if d.instance.Type() != instancetype.Container {
+			return fmt.Errorf("Custom storage volumes of other cluster members can only be attached to containers")
+		}
+
+		if shared.IsTrue(d.config["seed"]) {
+			return fmt.Errorf("The seed option isn't supported for custom storage volumes of other cluster members")
+		}
+
+		// The volume is accessed over the network rather than through a local block device.
+		if d.config["limits.read"] != "" || d.config["limits.write"] != "" || d.config["limits.max"] != "" {
+			return fmt.Errorf("Disk limits aren't supported for custom storage volumes of other cluster members")
+		}
+	}
+
 	// Check no other devices also have the same path as us. Use LocalDevices for this check so
 	// that we can check before the config is expanded or when a profile is being checked.
 	// Don't take into account the device names, only count active devices that point to the
@@ -130,6 +157,11 @@ func (d *disk) validateConfig() error {
 		return fmt.Errorf("Missing source '%s' for disk '%s'", d.config["source"], d.name)
 	}
 
+	// Virtual machines only get custom storage volumes on top of their root disk.
+	if d.instance.Type() == instancetype.VM && d.config["path"] != "/" && d.config["pool"] == "" {
+		return fmt.Errorf("Only custom storage volumes can be attached to virtual machines")
+	}
+
 	if d.config["pool"] != "" {
 		if d.config["shift"] != "" {
 			return fmt.Errorf("The \"shift\" property cannot be used with custom storage volumes")
@@ -139,11 +171,52 @@ func (d *disk) validateConfig() error {
 			return fmt.Errorf("Storage volumes cannot be specified as absolute paths")
 		}
 
-		_, err := d.state.Cluster.StoragePoolGetID(d.config["pool"])
+		poolID, err := d.state.Cluster.StoragePoolGetID(d.config["pool"])
 		if err != nil {
 			return fmt.Errorf("The \"%s\" storage pool doesn't exist", d.config["pool"])
 		}
 
+		location, nodeID, err := d.volumeLocation()
+		if err != nil {
+			return err
+		}
+
+		// The volumes of remote pools are available on all the cluster members already.
+		if location != "" {
+			pool, err := storagePools.GetPoolByName(d.state, d.config["pool"])
+			if err != nil {
+				return err
+			}
+
+			if pool.Driver().Info().Remote {
+				return fmt.Errorf("The \"location\" property can't be used with the volumes of remote storage pools")
+			}
+		}
+
+		// Check that the storage volume may be attached to instances of this project. Missing
+		// volumes are only reported when the device is started.
+		if d.instance.Name() != "" && d.config["source"] != "" && d.config["path"] != "/" {
+			var vol *api.StorageVolume
+			if location != "" {
+				_, vol, err = d.state.Cluster.StoragePoolVolumeGetType("default", d.config["source"], db.StoragePoolVolumeTypeCustom, poolID, nodeID)
+			} else {
+				_, vol, err = d.state.Cluster.StoragePoolNodeVolumeGetType(d.config["source"], db.StoragePoolVolumeTypeCustom, poolID)
+			}
+			if err != nil && err != db.ErrNoSuchObject {
+				return fmt.Errorf("Failed to load storage volume %q: %v", d.config["source"], err)
+			}
+
+			if err == nil && !storagePools.VolumeProjectAllowed(vol.Config, d.instance.Project()) {
+				return fmt.Errorf("Storage volume %q can't be attached to instances of project %q", d.config["source"], d.instance.Project())
+			}
+
+			// Containers mount the filesystem of custom volumes, while virtual machines get
+			// the raw disk of custom block volumes or a share of custom filesystem volumes.
+			if err == nil && d.instance.Type() == instancetype.Container && vol.ContentType == db.StoragePoolVolumeContentTypeNameBlock {
+				return fmt.Errorf("Custom block volume %q can't be attached to containers", d.config["source"])
+			}
+		}
+
 		// Only check storate volume is available if we are validating an instance device
 		// and not a profile device (check for non-empty instance name), and we have least
 		// one expanded device (this is so we only do this expensive check after devices
@@ -162,6 +235,42 @@ func (d *disk) validateConfig() error {
 	return nil
 }
 
+// volumeLocation returns the name and ID of the cluster member holding the custom volume of the
+// device, when its "location" property points at another member than this one. It returns an
+// empty name when the volume is held by this member.
+func (d *disk) volumeLocation() (string, int64, error) {
+	if d.config["location"] == "" {
+		return "", -1, nil
+	}
+
+	var localName string
+	var node db.NodeInfo
+	err := d.state.Cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+
+		localName, err = tx.NodeName()
+		if err != nil {
+			return err
+		}
+
+		node, err = tx.NodeByName(d.config["location"])
+		if err == db.ErrNoSuchObject {
+			return fmt.Errorf("Cluster member %q doesn't exist", d.config["location"])
+		}
+
+		return err
+	})
+	if err != nil {
+		return "", -1, err
+	}
+
+	if node.Name == localName {
+		return "", -1, nil
+	}
+
+	return node.Name, node.ID, nil
+}
+
 // getDevicePath returns the absolute path on the host for this instance and supplied device config.
 func (d *disk) getDevicePath(devName string, devConfig deviceConfig.Device) string {
 	relativeDestPath := strings.TrimPrefix(devConfig["path"], "/")
@@ -169,6 +278,103 @@ func (d *disk) getDevicePath(devName string, devConfig deviceConfig.Device) stri
 	return filepath.Join(d.instance.DevicesPath(), devPath)
 }
 
+// startVM returns the disk of custom block volumes, which qemu opens when the virtual machine
+// starts or hotplugs it, or the share of custom filesystem volumes, mounted on the host for qemu
+// to export it over 9p. Shares are mounted by the agent inside the virtual machine.
+func (d *disk) startVM() (*RunConfig, error) {
+	pool, err := storagePools.GetPoolByName(d.state, d.config["pool"])
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := d.vmVolumeContentType()
+	if err != nil {
+		return nil, err
+	}
+
+	runConf := RunConfig{}
+
+	if contentType != db.StoragePoolVolumeContentTypeNameBlock {
+		sharePath, err := pool.MountCustomVolumeShare(d.config["source"], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := []string{}
+		if shared.IsTrue(d.config["readonly"]) {
+			opts = append(opts, "ro")
+		}
+
+		runConf.Mounts = append(runConf.Mounts, MountEntryItem{
+			DevName:    d.name,
+			DevPath:    sharePath,
+			TargetPath: d.config["path"],
+			FSType:     "9p",
+			Opts:       opts,
+		})
+
+		return &runConf, nil
+	}
+
+	diskPath, diskType, err := pool.GetCustomVolumeDisk(d.config["source"])
+	if err != nil {
+		return nil, err
+	}
+
+	runConf.Mounts = append(runConf.Mounts, MountEntryItem{
+		DevName: d.name,
+		DevPath: diskPath,
+		FSType:  diskType,
+	})
+
+	return &runConf, nil
+}
+
+// stopVM returns the disk or share to detach from the virtual machine, which qemu does when it
+// stops or unplugs it, and unmounts the share of custom filesystem volumes afterwards.
+func (d *disk) stopVM() (*RunConfig, error) {
+	contentType, err := d.vmVolumeContentType()
+	if err != nil {
+		return nil, err
+	}
+
+	runConf := RunConfig{}
+
+	if contentType == db.StoragePoolVolumeContentTypeNameBlock {
+		runConf.Mounts = append(runConf.Mounts, MountEntryItem{DevName: d.name})
+		return &runConf, nil
+	}
+
+	runConf.Mounts = append(runConf.Mounts, MountEntryItem{DevName: d.name, FSType: "9p"})
+	runConf.PostHooks = append(runConf.PostHooks, func() error {
+		pool, err := storagePools.GetPoolByName(d.state, d.config["pool"])
+		if err != nil {
+			return err
+		}
+
+		_, err = pool.UnmountCustomVolume(d.config["source"], nil)
+		return err
+	})
+
+	return &runConf, nil
+}
+
+// vmVolumeContentType returns the content type of the custom volume attached to the virtual
+// machine.
+func (d *disk) vmVolumeContentType() (string, error) {
+	poolID, err := d.state.Cluster.StoragePoolGetID(d.config["pool"])
+	if err != nil {
+		return "", err
+	}
+
+	_, vol, err := d.state.Cluster.StoragePoolNodeVolumeGetType(d.config["source"], db.StoragePoolVolumeTypeCustom, poolID)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to load storage volume %q", d.config["source"])
+	}
+
+	return vol.ContentType, nil
+}
+
 // validateEnvironment checks the runtime environment for correctness.
 func (d *disk) validateEnvironment() error {
 	if shared.IsTrue(d.config["shift"]) && !d.state.OS.Shiftfs {
@@ -198,7 +404,7 @@ func (d *disk) Start() (*RunConfig, error) {
 			return &runConf, nil
 		}
 
-		return nil, fmt.Errorf("Non-root disks not supported for VMs")
+		return d.startVM()
 	}
 
 	isReadOnly := shared.IsTrue(d.config["readonly"])
@@ -249,6 +455,13 @@ func (d *disk) Start() (*RunConfig, error) {
 		}
 
 		runConf.RootFS = rootfs
+	} else if shared.IsTrue(d.config["seed"]) {
+		// Copy the volume's content into the instance the first time it's started
+		// rather than mounting it.
+		err := d.seedVolume()
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		// Source path.
 		srcPath := shared.HostPath(d.config["source"])
@@ -274,7 +487,13 @@ func (d *disk) Start() (*RunConfig, error) {
 
 		// If ownerShift is none and pool is specified then check whether the pool itself
 		// has owner shifting enabled, and if so enable shifting on this device too.
-		if ownerShift == MountOwnerShiftNone && d.config["pool"] != "" {
+		// The volumes of other cluster members are mounted over NFS, which can't be shifted.
+		location, _, err := d.volumeLocation()
+		if err != nil {
+			return nil, err
+		}
+
+		if ownerShift == MountOwnerShiftNone && d.config["pool"] != "" && location == "" {
 			poolID, _, err := d.state.Cluster.StoragePoolGet(d.config["pool"])
 			if err != nil {
 				return nil, err
@@ -334,6 +553,63 @@ func (d *disk) Start() (*RunConfig, error) {
 	return &runConf, nil
 }
 
+// seedVolume copies the content of the custom volume into the instance at the device path,
+// unless this was already done on a previous start.
+func (d *disk) seedVolume() error {
+	v := d.volatileGet()
+	if shared.IsTrue(v["seeded"]) {
+		return nil
+	}
+
+	volumeName := filepath.Clean(d.config["source"])
+	volumeName = strings.TrimPrefix(volumeName, fmt.Sprintf("%s/", db.StoragePoolVolumeTypeNameCustom))
+	if strings.Contains(volumeName, "/") {
+		return fmt.Errorf("Only custom storage volumes can be used to seed an instance")
+	}
+
+	// Refuse to follow symlinks inside the instance's rootfs, so that the copy can't be
+	// redirected to a path on the host.
+	rootfsPath := d.instance.RootfsPath()
+	destPath := rootfsPath
+	for _, component := range strings.Split(strings.Trim(filepath.Clean(d.config["path"]), "/"), "/") {
+		destPath = filepath.Join(destPath, component)
+
+		fi, err := os.Lstat(destPath)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Seed path %q for disk %q is a symlink inside the instance", d.config["path"], d.name)
+		}
+	}
+
+	destPath = filepath.Join(rootfsPath, d.config["path"])
+
+	err := StorageVolumeMount(d.state, d.config["pool"], volumeName, db.StoragePoolVolumeTypeNameCustom, d.instance)
+	if err != nil {
+		if !d.isRequired(d.config) {
+			logger.Warnf("Skipping seeding of disk %q: %v", d.name, err)
+			return nil
+		}
+
+		return errors.Wrapf(err, "Mount storage volume %q", volumeName)
+	}
+	defer StorageVolumeUmount(d.state, d.config["pool"], volumeName, db.StoragePoolVolumeTypeCustom)
+
+	// Existing files in the instance are left alone unless the volume has them too, so they're
+	// protected from the deletions of the copy.
+	srcPath := shared.VarPath("storage-pools", d.config["pool"], db.StoragePoolVolumeTypeNameCustom, volumeName)
+	_, err = rsync.LocalCopy(srcPath, destPath, "", false, "--filter=P *")
+	if err != nil {
+		return errors.Wrapf(err, "Copy storage volume %q into the instance", volumeName)
+	}
+
+	return d.volatileSet(map[string]string{"seeded": "true"})
+}
+
 // postStart is run after the instance is started.
 func (d *disk) postStart() error {
 	devPath := d.getDevicePath(d.name, d.config)
@@ -349,14 +625,6 @@ func (d *disk) postStart() error {
 
 // Update applies configuration changes to a started device.
 func (d *disk) Update(oldDevices deviceConfig.Devices, isRunning bool) error {
-	if d.instance.Type() == instancetype.VM {
-		if shared.IsRootDiskDevice(d.config) {
-			return nil
-		}
-
-		return fmt.Errorf("Non-root disks not supported for VMs")
-	}
-
 	if shared.IsRootDiskDevice(d.config) {
 		// Make sure we have a valid root disk device (and only one).
 		expandedDevices := d.instance.ExpandedDevices()
@@ -400,8 +668,8 @@ func (d *disk) Update(oldDevices deviceConfig.Devices, isRunning bool) error {
 		}
 	}
 
-	// Only apply IO limits if instance is running.
-	if isRunning {
+	// Only apply IO limits if instance is running, virtual machines don't support them.
+	if isRunning && d.instance.Type() == instancetype.Container {
 		runConf := RunConfig{}
 		err := d.generateLimits(&runConf)
 		if err != nil {
@@ -555,7 +823,17 @@ func (d *disk) createDevice() (string, error) {
 			return "", fmt.Errorf("Unknown storage type prefix \"%s\" found", volumeTypeName)
 		}
 
-		err := StorageVolumeMount(d.state, d.config["pool"], volumeName, volumeTypeName, d.instance)
+		location, _, err := d.volumeLocation()
+		if err != nil {
+			return "", err
+		}
+
+		if location != "" {
+			// Mount the volume exported by the cluster member holding it.
+			srcPath, err = StorageVolumeRemoteMount(d.state, location, d.config["pool"], volumeName)
+		} else {
+			err = StorageVolumeMount(d.state, d.config["pool"], volumeName, volumeTypeName, d.instance)
+		}
 		if err != nil {
 			msg := fmt.Sprintf("Could not mount storage volume \"%s\" of type \"%s\" on storage pool \"%s\": %s.", volumeName, volumeTypeName, d.config["pool"], err)
 			if !isRequired {
@@ -622,7 +900,7 @@ func (d *disk) Stop() (*RunConfig, error) {
 			return &RunConfig{}, nil
 		}
 
-		return nil, fmt.Errorf("Non-root disks not supported for VMs")
+		return d.stopVM()
 	}
 
 	runConf := RunConfig{
@@ -650,7 +928,16 @@ func (d *disk) Stop() (*RunConfig, error) {
 func (d *disk) postStop() error {
 	// Check if pool-specific action should be taken.
 	if d.config["pool"] != "" {
-		err := StorageVolumeUmount(d.state, d.config["pool"], d.config["source"], db.StoragePoolVolumeTypeCustom)
+		location, _, err := d.volumeLocation()
+		if err != nil {
+			return err
+		}
+
+		if location != "" {
+			err = StorageVolumeRemoteUmount(d.state, location, d.config["pool"], d.config["source"])
+		} else {
+			err = StorageVolumeUmount(d.state, d.config["pool"], d.config["source"], db.StoragePoolVolumeTypeCustom)
+		}
 		if err != nil {
 			return err
 		}
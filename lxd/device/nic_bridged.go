@@ -23,7 +23,6 @@ import (
 	deviceConfig "github.com/lxc/lxd/lxd/device/config"
 	"github.com/lxc/lxd/lxd/dnsmasq"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
-	"github.com/lxc/lxd/lxd/iptables"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/logger"
 )
@@ -390,14 +389,9 @@ func (d *nicBridged) removeFilters(m deviceConfig.Device) error {
 		return fmt.Errorf("Failed to remove network filters for %s: host_name not defined", m["name"])
 	}
 
-	// Remove any IPv6 filters used for this instance.
-	err := iptables.ContainerClear("ipv6", fmt.Sprintf("%s - ipv6_filtering", d.instance.Name()), "filter")
-	if err != nil {
-		return fmt.Errorf("Failed to clear ip6tables ipv6_filter rules for %s: %v", m["name"], err)
-	}
-
 	// Read current static IP allocation configured from dnsmasq host config (if exists).
 	var IPv4, IPv6 dhcpAllocation
+	var err error
 	if shared.PathExists(shared.VarPath("networks", m["parent"], "dnsmasq.hosts") + "/" + d.instance.Name()) {
 		IPv4, IPv6, err = d.getDHCPStaticIPs(m["parent"], d.instance.Name())
 		if err != nil {
@@ -405,47 +399,28 @@ func (d *nicBridged) removeFilters(m deviceConfig.Device) error {
 		}
 	}
 
-	// Get a current list of rules active on the host.
-	out, err := shared.RunCommand("ebtables", "--concurrent", "-L", "--Lmac2", "--Lx")
+	IPv4Filter, IPv6Filter := d.filterIPs(m, IPv4.IP, IPv6.IP)
+
+	err = d.state.Firewall.InstanceClearBridgeFilter(d.instance.Project(), d.instance.Name(), d.name, m["parent"], m["host_name"], m["hwaddr"], IPv4Filter, IPv6Filter)
 	if err != nil {
 		return fmt.Errorf("Failed to remove network filters for %s: %v", m["name"], err)
 	}
 
-	// Get a list of rules that we would have applied on instance start.
-	rules := d.generateFilterEbtablesRules(m, IPv4.IP, IPv6.IP)
-
-	errs := []error{}
-	// Iterate through each active rule on the host and try and match it to one the LXD rules.
-	for _, line := range strings.Split(out, "\n") {
-		line = strings.TrimSpace(line)
-		fields := strings.Fields(line)
-		fieldsLen := len(fields)
-
-		for _, rule := range rules {
-			// Rule doesn't match if the field lenths aren't the same, move on.
-			if len(rule) != fieldsLen {
-				continue
-			}
-
-			// Check whether active rule matches one of our rules to delete.
-			if !d.matchEbtablesRule(fields, rule, true) {
-				continue
-			}
+	return nil
+}
 
-			// If we get this far, then the current host rule matches one of our LXD
-			// rules, so we should run the modified command to delete it.
-			_, err = shared.RunCommand(fields[0], append([]string{"--concurrent"}, fields[1:]...)...)
-			if err != nil {
-				errs = append(errs, err)
-			}
-		}
+// filterIPs returns the addresses to filter on, which are only set if the
+// matching IP filtering is enabled on the device.
+func (d *nicBridged) filterIPs(m deviceConfig.Device, IPv4 net.IP, IPv6 net.IP) (net.IP, net.IP) {
+	if !shared.IsTrue(m["security.ipv4_filtering"]) {
+		IPv4 = nil
 	}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("Failed to remove network filters rule for %s: %v", m["name"], errs)
+	if !shared.IsTrue(m["security.ipv6_filtering"]) {
+		IPv6 = nil
 	}
 
-	return nil
+	return IPv4, IPv6
 }
 
 // getDHCPStaticIPs retrieves the dnsmasq statically allocated IPs for a instance.
@@ -489,68 +464,6 @@ func (d *nicBridged) getDHCPStaticIPs(network string, instanceName string) (dhcp
 	return IPv4, IPv6, nil
 }
 
-// generateFilterEbtablesRules returns a customised set of ebtables filter rules based on the device.
-func (d *nicBridged) generateFilterEbtablesRules(m deviceConfig.Device, IPv4 net.IP, IPv6 net.IP) [][]string {
-	// MAC source filtering rules. Blocks any packet coming from instance with an incorrect Ethernet source MAC.
-	// This is required for IP filtering too.
-	rules := [][]string{
-		{"ebtables", "-t", "filter", "-A", "INPUT", "-s", "!", m["hwaddr"], "-i", m["host_name"], "-j", "DROP"},
-		{"ebtables", "-t", "filter", "-A", "FORWARD", "-s", "!", m["hwaddr"], "-i", m["host_name"], "-j", "DROP"},
-	}
-
-	if shared.IsTrue(m["security.ipv4_filtering"]) && IPv4 != nil {
-		rules = append(rules,
-			// Prevent ARP MAC spoofing (prevents the instance poisoning the ARP cache of its neighbours with a MAC address that isn't its own).
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "ARP", "-i", m["host_name"], "--arp-mac-src", "!", m["hwaddr"], "-j", "DROP"},
-			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "ARP", "-i", m["host_name"], "--arp-mac-src", "!", m["hwaddr"], "-j", "DROP"},
-			// Prevent ARP IP spoofing (prevents the instance redirecting traffic for IPs that are not its own).
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "ARP", "-i", m["host_name"], "--arp-ip-src", "!", IPv4.String(), "-j", "DROP"},
-			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "ARP", "-i", m["host_name"], "--arp-ip-src", "!", IPv4.String(), "-j", "DROP"},
-			// Allow DHCPv4 to the host only. This must come before the IP source filtering rules below.
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv4", "-s", m["hwaddr"], "-i", m["host_name"], "--ip-src", "0.0.0.0", "--ip-dst", "255.255.255.255", "--ip-proto", "udp", "--ip-dport", "67", "-j", "ACCEPT"},
-			// IP source filtering rules. Blocks any packet coming from instance with an incorrect IP source address.
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv4", "-i", m["host_name"], "--ip-src", "!", IPv4.String(), "-j", "DROP"},
-			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "IPv4", "-i", m["host_name"], "--ip-src", "!", IPv4.String(), "-j", "DROP"},
-		)
-	}
-
-	if shared.IsTrue(m["security.ipv6_filtering"]) && IPv6 != nil {
-		rules = append(rules,
-			// Allow DHCPv6 and Router Solicitation to the host only. This must come before the IP source filtering rules below.
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv6", "-s", m["hwaddr"], "-i", m["host_name"], "--ip6-src", "fe80::/ffc0::", "--ip6-dst", "ff02::1:2/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "--ip6-proto", "udp", "--ip6-dport", "547", "-j", "ACCEPT"},
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv6", "-s", m["hwaddr"], "-i", m["host_name"], "--ip6-src", "fe80::/ffc0::", "--ip6-dst", "ff02::2/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "--ip6-proto", "ipv6-icmp", "--ip6-icmp-type", "router-solicitation", "-j", "ACCEPT"},
-			// IP source filtering rules. Blocks any packet coming from instance with an incorrect IP source address.
-			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv6", "-i", m["host_name"], "--ip6-src", "!", fmt.Sprintf("%s/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", IPv6.String()), "-j", "DROP"},
-			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "IPv6", "-i", m["host_name"], "--ip6-src", "!", fmt.Sprintf("%s/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", IPv6.String()), "-j", "DROP"},
-		)
-	}
-
-	return rules
-}
-
-// matchEbtablesRule compares an active rule to a supplied match rule to see if they match.
-// If deleteMode is true then the "-A" flag in the active rule will be modified to "-D" and will
-// not be part of the equality match. This allows delete commands to be generated from dumped add commands.
-func (d *nicBridged) matchEbtablesRule(activeRule []string, matchRule []string, deleteMode bool) bool {
-	for i := range matchRule {
-		// Active rules will be dumped in "add" format, we need to detect
-		// this and switch it to "delete" mode if requested. If this has already been
-		// done then move on, as we don't want to break the comparison below.
-		if deleteMode && (activeRule[i] == "-A" || activeRule[i] == "-D") {
-			activeRule[i] = "-D"
-			continue
-		}
-
-		// Check the match rule field matches the active rule field.
-		// If they don't match, then this isn't one of our rules.
-		if strings.Replace(activeRule[i], "/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "", -1) != strings.Replace(matchRule[i], "/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "", -1) {
-			return false
-		}
-	}
-
-	return true
-}
-
 // setFilters sets up any network level filters defined for the instance.
 // These are controlled by the security.mac_filtering, security.ipv4_Filtering and security.ipv6_filtering config keys.
 func (d *nicBridged) setFilters() (err error) {
@@ -566,7 +479,9 @@ func (d *nicBridged) setFilters() (err error) {
 		return fmt.Errorf("Failed to set network filters: require parent defined")
 	}
 
-	if shared.IsTrue(d.config["security.ipv6_filtering"]) {
+	// The xtables driver filters NDP with ip6tables, which only sees bridged
+	// traffic through br_netfilter.
+	if shared.IsTrue(d.config["security.ipv6_filtering"]) && d.state.Firewall.String() == "xtables" {
 		// Check br_netfilter is loaded and enabled for IPv6.
 		sysctlPath := "bridge/bridge-nf-call-ip6tables"
 		sysctlVal, err := NetworkSysctlGet(sysctlPath)
@@ -609,26 +524,13 @@ func (d *nicBridged) setFilters() (err error) {
 		}
 	}()
 
-	rules := d.generateFilterEbtablesRules(d.config, IPv4, IPv6)
-	for _, rule := range rules {
-		_, err = shared.RunCommand(rule[0], append([]string{"--concurrent"}, rule[1:]...)...)
-		if err != nil {
-			return err
-		}
-	}
+	IPv4, IPv6 = d.filterIPs(d.config, IPv4, IPv6)
 
-	rules, err = d.generateFilterIptablesRules(d.config, IPv6)
+	err = d.state.Firewall.InstanceSetupBridgeFilter(d.instance.Project(), d.instance.Name(), d.name, d.config["parent"], d.config["host_name"], d.config["hwaddr"], IPv4, IPv6)
 	if err != nil {
 		return err
 	}
 
-	for _, rule := range rules {
-		err = iptables.ContainerPrepend(rule[0], fmt.Sprintf("%s - %s_filtering", d.instance.Name(), rule[0]), "filter", rule[1], rule[2:]...)
-		if err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -759,39 +661,6 @@ func (d *nicBridged) allocateFilterIPs(netConfig map[string]string) (net.IP, net
 	return IPv4, IPv6, nil
 }
 
-// generateFilterIptablesRules returns a customised set of iptables filter rules based on the device.
-func (d *nicBridged) generateFilterIptablesRules(m deviceConfig.Device, IPv6 net.IP) (rules [][]string, err error) {
-	mac, err := net.ParseMAC(m["hwaddr"])
-	if err != nil {
-		return
-	}
-
-	macHex := hex.EncodeToString(mac)
-
-	// These rules below are implemented using ip6tables because the functionality to inspect
-	// the contents of an ICMPv6 packet does not exist in ebtables (unlike for IPv4 ARP).
-	// Additionally, ip6tables doesn't really provide a nice way to do what we need here, so we
-	// have resorted to doing a raw hex comparison of the packet contents at fixed positions.
-	// If these rules are not added then it is possible to hijack traffic for another IP that is
-	// not assigned to the instance by sending a specially crafted gratuitous NDP packet with
-	// correct source address and MAC at the IP & ethernet layers, but a fraudulent IP or MAC
-	// inside the ICMPv6 NDP packet.
-	if shared.IsTrue(m["security.ipv6_filtering"]) && IPv6 != nil {
-		ipv6Hex := hex.EncodeToString(IPv6)
-
-		rules = append(rules,
-			// Prevent Neighbor Advertisement IP spoofing (prevents the instance redirecting traffic for IPs that are not its own).
-			[]string{"ipv6", "INPUT", "-i", m["parent"], "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", m["host_name"], "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", ipv6Hex), "--algo", "bm", "--from", "48", "--to", "64", "-j", "DROP"},
-			[]string{"ipv6", "FORWARD", "-i", m["parent"], "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", m["host_name"], "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", ipv6Hex), "--algo", "bm", "--from", "48", "--to", "64", "-j", "DROP"},
-			// Prevent Neighbor Advertisement MAC spoofing (prevents the instance poisoning the NDP cache of its neighbours with a MAC address that isn't its own).
-			[]string{"ipv6", "INPUT", "-i", m["parent"], "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", m["host_name"], "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", macHex), "--algo", "bm", "--from", "66", "--to", "72", "-j", "DROP"},
-			[]string{"ipv6", "FORWARD", "-i", m["parent"], "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", m["host_name"], "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", macHex), "--algo", "bm", "--from", "66", "--to", "72", "-j", "DROP"},
-		)
-	}
-
-	return
-}
-
 // networkDHCPv4Ranges returns a parsed set of DHCPv4 ranges for a particular network.
 func (d *nicBridged) networkDHCPv4Ranges(netConfig map[string]string) []dhcpRange {
 	dhcpRanges := make([]dhcpRange, 0)
@@ -15,10 +15,12 @@ import (
 	"golang.org/x/sys/unix"
 	"gopkg.in/lxc/go-lxc.v2"
 
+	deviceConfig "github.com/lxc/lxd/lxd/device/config"
+	"github.com/lxc/lxd/lxd/firewall"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
-	"github.com/lxc/lxd/lxd/iptables"
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logger"
 )
 
 type proxy struct {
@@ -77,23 +79,44 @@ func (d *proxy) validateConfig() error {
 		return err
 	}
 
+	listenAddrs, err := ProxyParseAddrs(d.config["listen"])
+	if err != nil {
+		return err
+	}
+
 	listenAddr, err := ProxyParseAddr(d.config["listen"])
 	if err != nil {
 		return err
 	}
 
-	connectAddr, err := ProxyParseAddr(d.config["connect"])
+	connectAddrs, err := ProxyParseAddrs(d.config["connect"])
 	if err != nil {
 		return err
 	}
 
-	if len(connectAddr.Addr) > len(listenAddr.Addr) {
+	if len(connectAddrs) > 1 {
+		return fmt.Errorf("Only a single connect address is supported")
+	}
+
+	connectAddr := connectAddrs[0]
+
+	if len(connectAddr.Addr) > len(listenAddrs[0].Addr) {
 		// Cannot support single port -> multiple port
 		return fmt.Errorf("Cannot map a single port to multiple ports")
 	}
 
-	if shared.IsTrue(d.config["proxy_protocol"]) && !strings.HasPrefix(d.config["connect"], "tcp") {
-		return fmt.Errorf("The PROXY header can only be sent to tcp servers")
+	if len(connectAddr.Addr) > 1 && len(connectAddr.Addr) != len(listenAddrs[0].Addr) {
+		return fmt.Errorf("Cannot map %d listen ports to %d connect ports", len(listenAddrs[0].Addr), len(connectAddr.Addr))
+	}
+
+	if shared.IsTrue(d.config["proxy_protocol"]) {
+		if !shared.StringInSlice(connectAddr.ConnType, []string{"tcp", "udp"}) {
+			return fmt.Errorf("The PROXY header can only be sent to tcp or udp servers")
+		}
+
+		if connectAddr.ConnType == "udp" && listenAddr.ConnType != "udp" {
+			return fmt.Errorf("The PROXY header can only be sent to udp servers when listening on udp")
+		}
 	}
 
 	if (!strings.HasPrefix(d.config["listen"], "unix:") || strings.HasPrefix(d.config["listen"], "unix:@")) &&
@@ -135,62 +158,99 @@ func (d *proxy) Start() (*RunConfig, error) {
 
 	// Proxy devices have to be setup once the container is running.
 	runConf := RunConfig{}
-	runConf.PostHooks = []func() error{
-		func() error {
-			if shared.IsTrue(d.config["nat"]) {
-				return d.setupNAT()
-			}
+	runConf.PostHooks = []func() error{d.setupProxy}
 
-			proxyValues, err := d.setupProxyProcInfo()
-			if err != nil {
-				return err
-			}
+	return &runConf, nil
+}
 
-			devFileName := fmt.Sprintf("proxy.%s", d.name)
-			pidPath := filepath.Join(d.instance.DevicesPath(), devFileName)
-			logFileName := fmt.Sprintf("proxy.%s.log", d.name)
-			logPath := filepath.Join(d.instance.LogPath(), logFileName)
-
-			_, err = shared.RunCommand(
-				d.state.OS.ExecPath,
-				"forkproxy",
-				proxyValues.listenPid,
-				proxyValues.listenAddr,
-				proxyValues.connectPid,
-				proxyValues.connectAddr,
-				logPath,
-				pidPath,
-				proxyValues.listenAddrGID,
-				proxyValues.listenAddrUID,
-				proxyValues.listenAddrMode,
-				proxyValues.securityGID,
-				proxyValues.securityUID,
-				proxyValues.proxyProtocol,
-			)
-			if err != nil {
-				return fmt.Errorf("Error occurred when starting proxy device: %s", err)
-			}
+// CanHotPlug returns whether the device can be managed whilst the instance is running, it also
+// returns a list of fields that can be updated without triggering a device remove & add.
+func (d *proxy) CanHotPlug() (bool, []string) {
+	return true, []string{"listen", "connect", "bind", "nat", "uid", "gid", "mode", "security.uid", "security.gid", "proxy_protocol"}
+}
+
+// Update applies configuration changes to a started device by replacing its proxy process or
+// NAT rules. If the new configuration can't be applied then the old one is restored.
+func (d *proxy) Update(oldDevices deviceConfig.Devices, isRunning bool) error {
+	if !isRunning {
+		return nil
+	}
+
+	_, err := d.Stop()
+	if err != nil {
+		return err
+	}
 
-			// Poll log file a few times until we see "Started" to indicate successful start.
-			for i := 0; i < 10; i++ {
-				started, err := d.checkProcStarted(logPath)
+	err = d.setupProxy()
+	if err != nil {
+		d.Stop()
+
+		newConfig := d.config
+		d.config = oldDevices[d.name]
+		errRestore := d.setupProxy()
+		d.config = newConfig
+		if errRestore != nil {
+			logger.Errorf("Failed to restore proxy device '%s': %v", d.name, errRestore)
+		}
 
-				if err != nil {
-					return fmt.Errorf("Error occurred when starting proxy device: %s", err)
-				}
+		return err
+	}
 
-				if started {
-					return nil
-				}
+	return nil
+}
 
-				time.Sleep(time.Second)
-			}
+// setupProxy forwards traffic to the instance, either using NAT rules or a forkproxy process.
+func (d *proxy) setupProxy() error {
+	if shared.IsTrue(d.config["nat"]) {
+		return d.setupNAT()
+	}
 
-			return fmt.Errorf("Error occurred when starting proxy device, please look in %s", logPath)
-		},
+	proxyValues, err := d.setupProxyProcInfo()
+	if err != nil {
+		return err
 	}
 
-	return &runConf, nil
+	devFileName := fmt.Sprintf("proxy.%s", d.name)
+	pidPath := filepath.Join(d.instance.DevicesPath(), devFileName)
+	logFileName := fmt.Sprintf("proxy.%s.log", d.name)
+	logPath := filepath.Join(d.instance.LogPath(), logFileName)
+
+	_, err = shared.RunCommand(
+		d.state.OS.ExecPath,
+		"forkproxy",
+		proxyValues.listenPid,
+		proxyValues.listenAddr,
+		proxyValues.connectPid,
+		proxyValues.connectAddr,
+		logPath,
+		pidPath,
+		proxyValues.listenAddrGID,
+		proxyValues.listenAddrUID,
+		proxyValues.listenAddrMode,
+		proxyValues.securityGID,
+		proxyValues.securityUID,
+		proxyValues.proxyProtocol,
+	)
+	if err != nil {
+		return fmt.Errorf("Error occurred when starting proxy device: %s", err)
+	}
+
+	// Poll log file a few times until we see "Started" to indicate successful start.
+	for i := 0; i < 10; i++ {
+		started, err := d.checkProcStarted(logPath)
+
+		if err != nil {
+			return fmt.Errorf("Error occurred when starting proxy device: %s", err)
+		}
+
+		if started {
+			return nil
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("Error occurred when starting proxy device, please look in %s", logPath)
 }
 
 // checkProcStarted checks for the "Started" line in the log file. Returns true if found, false
@@ -225,9 +285,8 @@ func (d *proxy) checkProcStarted(logPath string) (bool, error) {
 
 // Stop is run when the device is removed from the instance.
 func (d *proxy) Stop() (*RunConfig, error) {
-	// Remove possible iptables entries
-	iptables.ContainerClear("ipv4", fmt.Sprintf("%s (%s)", d.instance.Name(), d.name), "nat")
-	iptables.ContainerClear("ipv6", fmt.Sprintf("%s (%s)", d.instance.Name(), d.name), "nat")
+	// Remove possible firewall entries
+	d.state.Firewall.InstanceClearProxyNAT(d.instance.Project(), d.instance.Name(), d.name)
 
 	devFileName := fmt.Sprintf("proxy.%s", d.name)
 	devPath := filepath.Join(d.instance.DevicesPath(), devFileName)
@@ -287,18 +346,10 @@ func (d *proxy) setupNAT() error {
 		return fmt.Errorf("NIC IP doesn't match proxy target IP")
 	}
 
-	iptablesComment := fmt.Sprintf("%s (%s)", d.instance.Name(), d.name)
-
 	revert := true
 	defer func() {
 		if revert {
-			if IPv4Addr != "" {
-				iptables.ContainerClear("ipv4", iptablesComment, "nat")
-			}
-
-			if IPv6Addr != "" {
-				iptables.ContainerClear("ipv6", iptablesComment, "nat")
-			}
+			d.state.Firewall.InstanceClearProxyNAT(d.instance.Project(), d.instance.Name(), d.name)
 		}
 	}()
 
@@ -307,48 +358,45 @@ func (d *proxy) setupNAT() error {
 		if err != nil {
 			return err
 		}
-		var cPort string
-		if len(connectAddr.Addr) == 1 {
-			_, cPort, _ = net.SplitHostPort(connectAddr.Addr[0])
-		} else {
-			_, cPort, _ = net.SplitHostPort(connectAddr.Addr[i])
+
+		_, cPort, err := net.SplitHostPort(ProxyConnectAddr(connectAddr, i))
+		if err != nil {
+			return err
 		}
 
-		if IPv4Addr != "" {
-			// outbound <-> container
-			err := iptables.ContainerPrepend("ipv4", iptablesComment, "nat",
-				"PREROUTING", "-p", listenAddr.ConnType, "--destination",
-				address, "--dport", port, "-j", "DNAT",
-				"--to-destination", fmt.Sprintf("%s:%s", IPv4Addr, cPort))
-			if err != nil {
-				return err
-			}
+		forward := firewall.ProxyForward{
+			Protocol:      listenAddr.ConnType,
+			ListenAddress: address,
+			ListenPort:    port,
+			ConnectPort:   cPort,
+		}
 
-			// host <-> container
-			err = iptables.ContainerPrepend("ipv4", iptablesComment, "nat",
-				"OUTPUT", "-p", listenAddr.ConnType, "--destination",
-				address, "--dport", port, "-j", "DNAT",
-				"--to-destination", fmt.Sprintf("%s:%s", IPv4Addr, cPort))
-			if err != nil {
-				return err
-			}
+		// Only forward a specific listen address to the instance address of the same family.
+		listenIP := net.ParseIP(address)
+		listenIPv4 := listenIP.To4() != nil
+		if !listenIP.IsUnspecified() && listenIPv4 && IPv4Addr == "" {
+			return fmt.Errorf("Instance has no IPv4 address to forward %s to", lAddr)
 		}
 
-		if IPv6Addr != "" {
-			// outbound <-> container
-			err := iptables.ContainerPrepend("ipv6", iptablesComment, "nat",
-				"PREROUTING", "-p", listenAddr.ConnType, "--destination",
-				address, "--dport", port, "-j", "DNAT",
-				"--to-destination", fmt.Sprintf("[%s]:%s", IPv6Addr, cPort))
+		if !listenIP.IsUnspecified() && !listenIPv4 && IPv6Addr == "" {
+			return fmt.Errorf("Instance has no IPv6 address to forward %s to", lAddr)
+		}
+
+		if IPv4Addr != "" && (listenIP.IsUnspecified() || listenIPv4) {
+			forward.IPVersion = 4
+			forward.ConnectAddress = IPv4Addr
+
+			err := d.state.Firewall.InstanceSetupProxyNAT(d.instance.Project(), d.instance.Name(), d.name, forward)
 			if err != nil {
 				return err
 			}
+		}
+
+		if IPv6Addr != "" && (listenIP.IsUnspecified() || !listenIPv4) {
+			forward.IPVersion = 6
+			forward.ConnectAddress = IPv6Addr
 
-			// host <-> container
-			err = iptables.ContainerPrepend("ipv6", iptablesComment, "nat",
-				"OUTPUT", "-p", listenAddr.ConnType, "--destination",
-				address, "--dport", port, "-j", "DNAT",
-				"--to-destination", fmt.Sprintf("[%s]:%s", IPv6Addr, cPort))
+			err := d.state.Firewall.InstanceSetupProxyNAT(d.instance.Project(), d.instance.Name(), d.name, forward)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// An entry in the etagLocks map, reference counted so that it can be removed
+// once no request is holding or waiting on it.
+type etagLockEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var etagLocks = map[string]*etagLockEntry{}
+var etagLocksMu sync.Mutex
+
+// etagLock serializes the If-Match validation and the following update of a
+// single object, so that two concurrent requests carrying the same ETag can't
+// both succeed. The returned function releases the lock.
+func etagLock(kind string, project string, name string) func() {
+	key := fmt.Sprintf("%s/%s/%s", kind, project, name)
+
+	etagLocksMu.Lock()
+	entry, ok := etagLocks[key]
+	if !ok {
+		entry = &etagLockEntry{}
+		etagLocks[key] = entry
+	}
+	entry.refs++
+	etagLocksMu.Unlock()
+
+	entry.mu.Lock()
+
+	return func() {
+		entry.mu.Unlock()
+
+		etagLocksMu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(etagLocks, key)
+		}
+		etagLocksMu.Unlock()
+	}
+}
+
+// Returns the data the ETag of a storage pool is computed from. In a cluster,
+// node-specific configuration keys are excluded.
+func storagePoolEtag(pool *api.StoragePool, clustered bool) []interface{} {
+	config := pool.Config
+	if clustered {
+		config = storagePoolClusterConfigForEtag(config)
+	}
+
+	return []interface{}{pool.Name, pool.Driver, config}
+}
+
+// Returns the data the ETag of a storage volume (or volume snapshot) is
+// computed from.
+func storagePoolVolumeEtag(vol *api.StorageVolume) []interface{} {
+	_, snapName, ok := shared.ContainerGetParentAndSnapshotName(vol.Name)
+	if ok {
+		return []interface{}{snapName, vol.Description, vol.Config}
+	}
+
+	return []interface{}{vol.Name, vol.Type, vol.Config}
+}
+
+// Returns the data the ETag of a network is computed from. In a cluster,
+// node-specific configuration keys are excluded.
+func networkEtag(n *api.Network, clustered bool) []interface{} {
+	config := n.Config
+	if clustered {
+		config = util.CopyConfig(config)
+		for _, key := range db.NetworkNodeConfigKeys {
+			delete(config, key)
+		}
+	}
+
+	return []interface{}{n.Name, n.Managed, n.Type, n.Description, config}
+}
+
+// Returns the data the ETag of an instance is computed from.
+func instanceEtag(inst Instance) []interface{} {
+	return []interface{}{inst.Architecture(), inst.LocalConfig(), inst.LocalDevices(), inst.IsEphemeral(), inst.Profiles()}
+}
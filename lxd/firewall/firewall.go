@@ -0,0 +1,76 @@
+package firewall
+
+import (
+	"net"
+
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// Firewall represents a firewall driver, managing the rules needed by LXD
+// networks and instance devices.
+type Firewall interface {
+	// String returns the name of the driver.
+	String() string
+
+	// Compat returns whether the driver's backend already has rules on the
+	// host, and an error if the driver can't be used at all.
+	Compat() (bool, error)
+
+	NetworkSetupForwardingPolicy(networkName string, ipVersion uint, allow bool) error
+	NetworkSetupOutboundNAT(networkName string, subnet *net.IPNet, srcIP net.IP, appendRule bool) error
+	NetworkSetupDHCPDNSAccess(networkName string, ipVersion uint) error
+	NetworkSetupDHCPv4Checksum(networkName string) error
+	NetworkClear(networkName string, ipVersion uint) error
+
+	// The IPv4 and IPv6 addresses are only given if the matching IP
+	// filtering is enabled on the device.
+	InstanceSetupBridgeFilter(projectName string, instanceName string, deviceName string, parentName string, hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) error
+	InstanceClearBridgeFilter(projectName string, instanceName string, deviceName string, parentName string, hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) error
+
+	InstanceSetupProxyNAT(projectName string, instanceName string, deviceName string, forward ProxyForward) error
+	InstanceClearProxyNAT(projectName string, instanceName string, deviceName string) error
+}
+
+// ProxyForward is a port forwarded to an instance by a proxy device in NAT mode.
+type ProxyForward struct {
+	IPVersion      uint
+	Protocol       string
+	ListenAddress  string
+	ListenPort     string
+	ConnectAddress string
+	ConnectPort    string
+}
+
+// New returns the firewall driver to use on this host.
+//
+// The nftables driver is preferred, since it keeps its rules in its own tables,
+// out of the way of other firewall managers. If xtables rules are already in
+// use on the host, the xtables driver is used instead, so that the rules of
+// LXD coexist with them.
+func New() Firewall {
+	xtables := &xtables{}
+	nftables := &nftables{}
+
+	xtablesInUse, xtablesErr := xtables.Compat()
+	_, nftablesErr := nftables.Compat()
+
+	if nftablesErr == nil && !xtablesInUse {
+		err := nftables.reconcile()
+		if err == nil {
+			return nftables
+		}
+
+		nftablesErr = err
+	}
+
+	if nftablesErr != nil {
+		logger.Debug("Firewall nftables driver unavailable", log.Ctx{"err": nftablesErr})
+	}
+
+	if xtablesErr != nil {
+		logger.Warn("Firewall xtables driver unavailable", log.Ctx{"err": xtablesErr})
+	}
+
+	return xtables
+}
@@ -0,0 +1,357 @@
+package firewall
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/version"
+)
+
+// Name of the tables holding the rules of LXD, in each address family.
+const nftablesNamespace = "lxd"
+
+// nftables is the firewall driver using nftables.
+//
+// All rules live in tables of their own, one per address family, so that other
+// firewall managers flushing or reloading their rules leave them alone. Each
+// network and instance device gets its own chains, which are deleted as a
+// whole when the network or device is cleared.
+type nftables struct{}
+
+func (d *nftables) String() string {
+	return "nftables"
+}
+
+// Compat returns whether the tables of LXD already exist, and an error if the
+// nft command is missing or too old.
+func (d *nftables) Compat() (bool, error) {
+	_, err := exec.LookPath("nft")
+	if err != nil {
+		return false, fmt.Errorf("Backend command %q missing", "nft")
+	}
+
+	output, err := shared.RunCommand("nft", "--version")
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get nftables version")
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return false, fmt.Errorf("Failed to parse nftables version %q", strings.TrimSpace(output))
+	}
+
+	current, err := version.NewDottedVersion(strings.TrimPrefix(fields[1], "v"))
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to parse nftables version")
+	}
+
+	minimum, _ := version.NewDottedVersion("0.9.0")
+	if current.Compare(minimum) < 0 {
+		return false, fmt.Errorf("nftables version %s is too old (minimum %s)", current, minimum)
+	}
+
+	// This also checks that the kernel supports nftables.
+	output, err = shared.RunCommand("nft", "list", "tables")
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to list nftables tables")
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "table" && fields[2] == nftablesNamespace {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// reconcile creates the tables of LXD, if they were removed since it last ran.
+// The chains of the networks are then recreated when the networks are set up.
+func (d *nftables) reconcile() error {
+	script := ""
+	for _, family := range []string{"ip", "ip6", "bridge"} {
+		script += fmt.Sprintf("add table %s %s\n", family, nftablesNamespace)
+	}
+
+	return d.apply(script)
+}
+
+// apply runs an nftables script, atomically.
+func (d *nftables) apply(script string) error {
+	return shared.RunCommandWithFds(strings.NewReader(script), nil, "nft", "-f", "-")
+}
+
+func (d *nftables) family(ipVersion uint) string {
+	if ipVersion == 6 {
+		return "ip6"
+	}
+
+	return "ip"
+}
+
+// chainName returns the name of a chain for the given hook and entity.
+func (d *nftables) chainName(hook string, names ...string) string {
+	return strings.Join(append([]string{hook}, names...), ".")
+}
+
+// addChain returns the commands creating a base chain, unless it exists.
+func (d *nftables) addChain(family string, chain string, chainType string, hook string, priority int) string {
+	return fmt.Sprintf("add table %s %s\nadd chain %s %s %q { type %s hook %s priority %d; policy accept; }\n",
+		family, nftablesNamespace, family, nftablesNamespace, chain, chainType, hook, priority)
+}
+
+// addRule returns the command adding a rule to a chain.
+func (d *nftables) addRule(family string, chain string, rule string) string {
+	return fmt.Sprintf("add rule %s %s %q %s\n", family, nftablesNamespace, chain, rule)
+}
+
+// deleteChains deletes the given chains, ignoring the ones which don't exist.
+func (d *nftables) deleteChains(family string, chains ...string) error {
+	output, err := shared.RunCommand("nft", "list", "table", family, nftablesNamespace)
+	if err != nil {
+		// Nothing to delete if the table doesn't exist.
+		return nil
+	}
+
+	existing := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "chain" && fields[2] == "{" {
+			existing = append(existing, strings.Trim(fields[1], `"`))
+		}
+	}
+
+	script := ""
+	for _, chain := range chains {
+		if !shared.StringInSlice(chain, existing) {
+			continue
+		}
+
+		script += fmt.Sprintf("flush chain %s %s %q\n", family, nftablesNamespace, chain)
+		script += fmt.Sprintf("delete chain %s %s %q\n", family, nftablesNamespace, chain)
+	}
+
+	if script == "" {
+		return nil
+	}
+
+	return d.apply(script)
+}
+
+// NetworkSetupForwardingPolicy allows or rejects the traffic forwarded to and
+// from the network.
+func (d *nftables) NetworkSetupForwardingPolicy(networkName string, ipVersion uint, allow bool) error {
+	action := "reject"
+	if allow {
+		action = "accept"
+	}
+
+	family := d.family(ipVersion)
+	chain := d.chainName("fwd", networkName)
+
+	script := d.addChain(family, chain, "filter", "forward", 0)
+	script += d.addRule(family, chain, fmt.Sprintf("iifname %q %s", networkName, action))
+	script += d.addRule(family, chain, fmt.Sprintf("oifname %q %s", networkName, action))
+
+	return d.apply(script)
+}
+
+// NetworkSetupOutboundNAT masquerades the traffic leaving the subnet, or
+// source NATs it to srcIP if given.
+func (d *nftables) NetworkSetupOutboundNAT(networkName string, subnet *net.IPNet, srcIP net.IP, appendRule bool) error {
+	ipVersion := uint(4)
+	if subnet.IP.To4() == nil {
+		ipVersion = 6
+	}
+
+	family := d.family(ipVersion)
+	chain := d.chainName("pstrt", networkName)
+
+	// The first NAT rule matching a connection wins, so rules which
+	// should come after the ones of other tables use a later priority.
+	priority := 99
+	if appendRule {
+		priority = 101
+	}
+
+	action := "masquerade"
+	if srcIP != nil {
+		action = fmt.Sprintf("snat to %s", srcIP.String())
+	}
+
+	script := d.addChain(family, chain, "nat", "postrouting", priority)
+	script += d.addRule(family, chain, fmt.Sprintf("%s saddr %s %s daddr != %s %s", family, subnet.String(), family, subnet.String(), action))
+
+	return d.apply(script)
+}
+
+// NetworkSetupDHCPDNSAccess lets the instances on the network reach the DHCP
+// and DNS servers on the host.
+func (d *nftables) NetworkSetupDHCPDNSAccess(networkName string, ipVersion uint) error {
+	dhcpPort := 67
+	if ipVersion == 6 {
+		dhcpPort = 547
+	}
+
+	family := d.family(ipVersion)
+	in := d.chainName("in", networkName)
+	out := d.chainName("out", networkName)
+
+	script := d.addChain(family, in, "filter", "input", 0)
+	script += d.addRule(family, in, fmt.Sprintf("iifname %q udp dport { %d, 53 } accept", networkName, dhcpPort))
+	script += d.addRule(family, in, fmt.Sprintf("iifname %q tcp dport 53 accept", networkName))
+
+	script += d.addChain(family, out, "filter", "output", 0)
+	script += d.addRule(family, out, fmt.Sprintf("oifname %q udp sport { %d, 53 } accept", networkName, dhcpPort))
+	script += d.addRule(family, out, fmt.Sprintf("oifname %q tcp sport 53 accept", networkName))
+
+	return d.apply(script)
+}
+
+// NetworkSetupDHCPv4Checksum does nothing, since nftables can't fill in
+// checksums. Only a few old DHCP clients need them.
+func (d *nftables) NetworkSetupDHCPv4Checksum(networkName string) error {
+	return nil
+}
+
+// NetworkClear removes the chains of the network.
+func (d *nftables) NetworkClear(networkName string, ipVersion uint) error {
+	chains := []string{}
+	for _, hook := range []string{"in", "out", "fwd", "pstrt"} {
+		chains = append(chains, d.chainName(hook, networkName))
+	}
+
+	return d.deleteChains(d.family(ipVersion), chains...)
+}
+
+// InstanceSetupBridgeFilter prevents the instance from using a MAC address or
+// IP addresses other than its own on the bridge.
+func (d *nftables) InstanceSetupBridgeFilter(projectName string, instanceName string, deviceName string, parentName string, hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) error {
+	mac, err := net.ParseMAC(hwAddr)
+	if err != nil {
+		return err
+	}
+
+	in := d.chainName("in", projectName, instanceName, deviceName)
+	fwd := d.chainName("fwd", projectName, instanceName, deviceName)
+
+	script := d.addChain("bridge", in, "filter", "input", 0)
+	script += d.addChain("bridge", fwd, "filter", "forward", 0)
+
+	for _, rule := range d.bridgeFilterRules(hostName, mac, IPv4, IPv6) {
+		if rule.input {
+			script += d.addRule("bridge", in, rule.rule)
+		}
+
+		if rule.forward {
+			script += d.addRule("bridge", fwd, rule.rule)
+		}
+	}
+
+	return d.apply(script)
+}
+
+type nftablesBridgeRule struct {
+	input   bool
+	forward bool
+	rule    string
+}
+
+// bridgeFilterRules returns the rules filtering the traffic coming from the
+// host side interface of an instance NIC.
+func (d *nftables) bridgeFilterRules(hostName string, mac net.HardwareAddr, IPv4 net.IP, IPv6 net.IP) []nftablesBridgeRule {
+	iif := fmt.Sprintf("iifname %q", hostName)
+
+	// MAC source filtering, also required for IP filtering.
+	rules := []nftablesBridgeRule{
+		{true, true, fmt.Sprintf("%s ether saddr != %s drop", iif, mac)},
+	}
+
+	if IPv4 != nil {
+		rules = append(rules,
+			// Prevent ARP MAC and IP spoofing.
+			nftablesBridgeRule{true, true, fmt.Sprintf("%s arp saddr ether != %s drop", iif, mac)},
+			nftablesBridgeRule{true, true, fmt.Sprintf("%s arp saddr ip != %s drop", iif, IPv4)},
+			// Allow DHCPv4 to the host only, before IP source filtering.
+			nftablesBridgeRule{true, false, fmt.Sprintf("%s ether saddr %s ip saddr 0.0.0.0 ip daddr 255.255.255.255 udp dport 67 accept", iif, mac)},
+			// IP source filtering.
+			nftablesBridgeRule{true, true, fmt.Sprintf("%s ether type ip ip saddr != %s drop", iif, IPv4)},
+		)
+	}
+
+	if IPv6 != nil {
+		rules = append(rules,
+			// Allow DHCPv6 and Router Solicitation to the host only, before IP source filtering.
+			nftablesBridgeRule{true, false, fmt.Sprintf("%s ether saddr %s ip6 saddr fe80::/10 ip6 daddr ff02::1:2 udp dport 547 accept", iif, mac)},
+			nftablesBridgeRule{true, false, fmt.Sprintf("%s ether saddr %s ip6 saddr fe80::/10 ip6 daddr ff02::2 icmpv6 type nd-router-solicit accept", iif, mac)},
+			// Prevent Neighbor Advertisement IP and MAC spoofing, by
+			// checking the target address and the target link-layer
+			// address option of the ICMPv6 packet.
+			nftablesBridgeRule{true, true, fmt.Sprintf("%s icmpv6 type nd-neighbor-advert @nh,384,128 != 0x%s drop", iif, hex.EncodeToString(IPv6.To16()))},
+			nftablesBridgeRule{true, true, fmt.Sprintf("%s icmpv6 type nd-neighbor-advert @nh,528,48 != 0x%s drop", iif, hex.EncodeToString(mac))},
+			// IP source filtering.
+			nftablesBridgeRule{true, true, fmt.Sprintf("%s ether type ip6 ip6 saddr != %s drop", iif, IPv6)},
+		)
+	}
+
+	return rules
+}
+
+// InstanceClearBridgeFilter removes the chains of the device.
+func (d *nftables) InstanceClearBridgeFilter(projectName string, instanceName string, deviceName string, parentName string, hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) error {
+	return d.deleteChains("bridge", d.chainName("in", projectName, instanceName, deviceName), d.chainName("fwd", projectName, instanceName, deviceName))
+}
+
+// InstanceSetupProxyNAT forwards a port of the host to the instance.
+func (d *nftables) InstanceSetupProxyNAT(projectName string, instanceName string, deviceName string, forward ProxyForward) error {
+	family := d.family(forward.IPVersion)
+	prert := d.chainName("prert", projectName, instanceName, deviceName)
+	out := d.chainName("outnat", projectName, instanceName, deviceName)
+
+	script := d.addChain(family, prert, "nat", "prerouting", -100)
+	script += d.addChain(family, out, "nat", "output", -100)
+
+	// outbound <-> instance, then host <-> instance.
+	rule := d.proxyNATRule(forward)
+	script += d.addRule(family, prert, rule)
+	script += d.addRule(family, out, rule)
+
+	return d.apply(script)
+}
+
+// proxyNATRule returns the rule forwarding a port to the instance.
+func (d *nftables) proxyNATRule(forward ProxyForward) string {
+	family := d.family(forward.IPVersion)
+
+	target := fmt.Sprintf("%s:%s", forward.ConnectAddress, forward.ConnectPort)
+	if forward.IPVersion == 6 {
+		target = fmt.Sprintf("[%s]:%s", forward.ConnectAddress, forward.ConnectPort)
+	}
+
+	match := ""
+	listen := net.ParseIP(forward.ListenAddress)
+	if listen != nil && !listen.IsUnspecified() {
+		match = fmt.Sprintf("%s daddr %s ", family, listen)
+	}
+
+	return fmt.Sprintf("%s%s dport %s dnat to %s", match, forward.Protocol, forward.ListenPort, target)
+}
+
+// InstanceClearProxyNAT removes the chains of the proxy device.
+func (d *nftables) InstanceClearProxyNAT(projectName string, instanceName string, deviceName string) error {
+	for _, ipVersion := range []uint{4, 6} {
+		err := d.deleteChains(d.family(ipVersion), d.chainName("prert", projectName, instanceName, deviceName), d.chainName("outnat", projectName, instanceName, deviceName))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package firewall
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Ports are forwarded to the instance, only matching the listen address if
+// it's not a wildcard.
+func TestNftablesProxyNATRule(t *testing.T) {
+	d := &nftables{}
+
+	rule := d.proxyNATRule(ProxyForward{
+		IPVersion:      4,
+		Protocol:       "tcp",
+		ListenAddress:  "0.0.0.0",
+		ListenPort:     "80",
+		ConnectAddress: "10.0.0.2",
+		ConnectPort:    "8080",
+	})
+	assert.Equal(t, "tcp dport 80 dnat to 10.0.0.2:8080", rule)
+
+	rule = d.proxyNATRule(ProxyForward{
+		IPVersion:      6,
+		Protocol:       "udp",
+		ListenAddress:  "fd42::1",
+		ListenPort:     "53",
+		ConnectAddress: "fd42::2",
+		ConnectPort:    "53",
+	})
+	assert.Equal(t, "ip6 daddr fd42::1 udp dport 53 dnat to [fd42::2]:53", rule)
+}
+
+// MAC filtering is always applied, while IP filtering only applies to the
+// given addresses.
+func TestNftablesBridgeFilterRules(t *testing.T) {
+	d := &nftables{}
+
+	mac, err := net.ParseMAC("00:16:3e:00:00:01")
+	require.NoError(t, err)
+
+	rules := d.bridgeFilterRules("veth1234", mac, nil, nil)
+	require.Len(t, rules, 1)
+	assert.Equal(t, `iifname "veth1234" ether saddr != 00:16:3e:00:00:01 drop`, rules[0].rule)
+
+	rules = d.bridgeFilterRules("veth1234", mac, net.ParseIP("10.0.0.2"), net.ParseIP("fd42::2"))
+	require.Len(t, rules, 10)
+	assert.Equal(t, `iifname "veth1234" ether type ip ip saddr != 10.0.0.2 drop`, rules[4].rule)
+	assert.Equal(t, `iifname "veth1234" icmpv6 type nd-neighbor-advert @nh,384,128 != 0xfd420000000000000000000000000002 drop`, rules[7].rule)
+	assert.Equal(t, `iifname "veth1234" icmpv6 type nd-neighbor-advert @nh,528,48 != 0x00163e000001 drop`, rules[8].rule)
+
+	// DHCP requests are only let through to the host.
+	assert.True(t, rules[3].input)
+	assert.False(t, rules[3].forward)
+}
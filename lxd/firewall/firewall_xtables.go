@@ -0,0 +1,354 @@
+package firewall
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/iptables"
+	"github.com/lxc/lxd/shared"
+)
+
+// xtables is the firewall driver using iptables, ip6tables and ebtables.
+type xtables struct{}
+
+func (d *xtables) String() string {
+	return "xtables"
+}
+
+// Compat returns whether any iptables, ip6tables or ebtables rules are
+// present on the host.
+func (d *xtables) Compat() (bool, error) {
+	_, err := exec.LookPath("iptables")
+	if err != nil {
+		return false, fmt.Errorf("Backend command %q missing", "iptables")
+	}
+
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		for _, table := range []string{"filter", "mangle", "nat"} {
+			output, err := shared.RunCommand(cmd, "-w", "-t", table, "-S")
+			if err != nil {
+				continue
+			}
+
+			for _, line := range strings.Split(output, "\n") {
+				if strings.HasPrefix(line, "-A ") {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	output, err := shared.RunCommand("ebtables", "--concurrent", "-L", "--Lmac2", "--Lx")
+	if err == nil {
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "ebtables ") {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (d *xtables) protocol(ipVersion uint) string {
+	if ipVersion == 6 {
+		return "ipv6"
+	}
+
+	return "ipv4"
+}
+
+// NetworkSetupForwardingPolicy allows or rejects the traffic forwarded to and
+// from the network.
+func (d *xtables) NetworkSetupForwardingPolicy(networkName string, ipVersion uint, allow bool) error {
+	action := "REJECT"
+	if allow {
+		action = "ACCEPT"
+	}
+
+	err := iptables.NetworkPrepend(d.protocol(ipVersion), networkName, "", "FORWARD", "-i", networkName, "-j", action)
+	if err != nil {
+		return err
+	}
+
+	return iptables.NetworkPrepend(d.protocol(ipVersion), networkName, "", "FORWARD", "-o", networkName, "-j", action)
+}
+
+// NetworkSetupOutboundNAT masquerades the traffic leaving the subnet, or
+// source NATs it to srcIP if given.
+func (d *xtables) NetworkSetupOutboundNAT(networkName string, subnet *net.IPNet, srcIP net.IP, appendRule bool) error {
+	ipVersion := uint(4)
+	if subnet.IP.To4() == nil {
+		ipVersion = 6
+	}
+
+	args := []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "MASQUERADE"}
+	if srcIP != nil {
+		args = []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "SNAT", "--to", srcIP.String()}
+	}
+
+	if appendRule {
+		return iptables.NetworkAppend(d.protocol(ipVersion), networkName, "nat", "POSTROUTING", args...)
+	}
+
+	return iptables.NetworkPrepend(d.protocol(ipVersion), networkName, "nat", "POSTROUTING", args...)
+}
+
+// NetworkSetupDHCPDNSAccess lets the instances on the network reach the DHCP
+// and DNS servers on the host.
+func (d *xtables) NetworkSetupDHCPDNSAccess(networkName string, ipVersion uint) error {
+	dhcpPort := "67"
+	if ipVersion == 6 {
+		dhcpPort = "547"
+	}
+
+	rules := [][]string{
+		{"INPUT", "-i", networkName, "-p", "udp", "--dport", dhcpPort, "-j", "ACCEPT"},
+		{"INPUT", "-i", networkName, "-p", "udp", "--dport", "53", "-j", "ACCEPT"},
+		{"INPUT", "-i", networkName, "-p", "tcp", "--dport", "53", "-j", "ACCEPT"},
+		{"OUTPUT", "-o", networkName, "-p", "udp", "--sport", dhcpPort, "-j", "ACCEPT"},
+		{"OUTPUT", "-o", networkName, "-p", "udp", "--sport", "53", "-j", "ACCEPT"},
+		{"OUTPUT", "-o", networkName, "-p", "tcp", "--sport", "53", "-j", "ACCEPT"}}
+
+	for _, rule := range rules {
+		err := iptables.NetworkPrepend(d.protocol(ipVersion), networkName, "", rule[0], rule[1:]...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NetworkSetupDHCPv4Checksum works around DHCP clients which drop replies
+// without a checksum.
+func (d *xtables) NetworkSetupDHCPv4Checksum(networkName string) error {
+	return iptables.NetworkPrepend("ipv4", networkName, "mangle", "POSTROUTING", "-o", networkName, "-p", "udp", "--dport", "68", "-j", "CHECKSUM", "--checksum-fill")
+}
+
+// NetworkClear removes the rules of the network.
+func (d *xtables) NetworkClear(networkName string, ipVersion uint) error {
+	tables := []string{"", "nat"}
+	if ipVersion == 4 {
+		tables = append(tables, "mangle")
+	}
+
+	for _, table := range tables {
+		err := iptables.NetworkClear(d.protocol(ipVersion), networkName, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InstanceSetupBridgeFilter prevents the instance from using a MAC address or
+// IP addresses other than its own on the bridge.
+func (d *xtables) InstanceSetupBridgeFilter(projectName string, instanceName string, deviceName string, parentName string, hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) error {
+	rules := d.generateFilterEbtablesRules(hostName, hwAddr, IPv4, IPv6)
+	for _, rule := range rules {
+		_, err := shared.RunCommand(rule[0], append([]string{"--concurrent"}, rule[1:]...)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	rules, err := d.generateFilterIptablesRules(parentName, hostName, hwAddr, IPv6)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		err = iptables.ContainerPrepend(rule[0], fmt.Sprintf("%s - %s_filtering", instanceName, rule[0]), "filter", rule[1], rule[2:]...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InstanceClearBridgeFilter removes the filters set up by InstanceSetupBridgeFilter.
+func (d *xtables) InstanceClearBridgeFilter(projectName string, instanceName string, deviceName string, parentName string, hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) error {
+	// Remove any IPv6 filters used for this instance.
+	err := iptables.ContainerClear("ipv6", fmt.Sprintf("%s - ipv6_filtering", instanceName), "filter")
+	if err != nil {
+		return fmt.Errorf("Failed to clear ip6tables ipv6_filter rules for %s: %v", deviceName, err)
+	}
+
+	// Get a current list of rules active on the host.
+	out, err := shared.RunCommand("ebtables", "--concurrent", "-L", "--Lmac2", "--Lx")
+	if err != nil {
+		return fmt.Errorf("Failed to remove network filters for %s: %v", deviceName, err)
+	}
+
+	// Get a list of rules that we would have applied on instance start.
+	rules := d.generateFilterEbtablesRules(hostName, hwAddr, IPv4, IPv6)
+
+	errs := []error{}
+	// Iterate through each active rule on the host and try and match it to one the LXD rules.
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		fieldsLen := len(fields)
+
+		for _, rule := range rules {
+			// Rule doesn't match if the field lenths aren't the same, move on.
+			if len(rule) != fieldsLen {
+				continue
+			}
+
+			// Check whether active rule matches one of our rules to delete.
+			if !d.matchEbtablesRule(fields, rule, true) {
+				continue
+			}
+
+			// If we get this far, then the current host rule matches one of our LXD
+			// rules, so we should run the modified command to delete it.
+			_, err = shared.RunCommand(fields[0], append([]string{"--concurrent"}, fields[1:]...)...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Failed to remove network filters rule for %s: %v", deviceName, errs)
+	}
+
+	return nil
+}
+
+// generateFilterEbtablesRules returns a customised set of ebtables filter rules based on the device.
+func (d *xtables) generateFilterEbtablesRules(hostName string, hwAddr string, IPv4 net.IP, IPv6 net.IP) [][]string {
+	// MAC source filtering rules. Blocks any packet coming from instance with an incorrect Ethernet source MAC.
+	// This is required for IP filtering too.
+	rules := [][]string{
+		{"ebtables", "-t", "filter", "-A", "INPUT", "-s", "!", hwAddr, "-i", hostName, "-j", "DROP"},
+		{"ebtables", "-t", "filter", "-A", "FORWARD", "-s", "!", hwAddr, "-i", hostName, "-j", "DROP"},
+	}
+
+	if IPv4 != nil {
+		rules = append(rules,
+			// Prevent ARP MAC spoofing (prevents the instance poisoning the ARP cache of its neighbours with a MAC address that isn't its own).
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "ARP", "-i", hostName, "--arp-mac-src", "!", hwAddr, "-j", "DROP"},
+			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "ARP", "-i", hostName, "--arp-mac-src", "!", hwAddr, "-j", "DROP"},
+			// Prevent ARP IP spoofing (prevents the instance redirecting traffic for IPs that are not its own).
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "ARP", "-i", hostName, "--arp-ip-src", "!", IPv4.String(), "-j", "DROP"},
+			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "ARP", "-i", hostName, "--arp-ip-src", "!", IPv4.String(), "-j", "DROP"},
+			// Allow DHCPv4 to the host only. This must come before the IP source filtering rules below.
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv4", "-s", hwAddr, "-i", hostName, "--ip-src", "0.0.0.0", "--ip-dst", "255.255.255.255", "--ip-proto", "udp", "--ip-dport", "67", "-j", "ACCEPT"},
+			// IP source filtering rules. Blocks any packet coming from instance with an incorrect IP source address.
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv4", "-i", hostName, "--ip-src", "!", IPv4.String(), "-j", "DROP"},
+			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "IPv4", "-i", hostName, "--ip-src", "!", IPv4.String(), "-j", "DROP"},
+		)
+	}
+
+	if IPv6 != nil {
+		rules = append(rules,
+			// Allow DHCPv6 and Router Solicitation to the host only. This must come before the IP source filtering rules below.
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv6", "-s", hwAddr, "-i", hostName, "--ip6-src", "fe80::/ffc0::", "--ip6-dst", "ff02::1:2/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "--ip6-proto", "udp", "--ip6-dport", "547", "-j", "ACCEPT"},
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv6", "-s", hwAddr, "-i", hostName, "--ip6-src", "fe80::/ffc0::", "--ip6-dst", "ff02::2/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "--ip6-proto", "ipv6-icmp", "--ip6-icmp-type", "router-solicitation", "-j", "ACCEPT"},
+			// IP source filtering rules. Blocks any packet coming from instance with an incorrect IP source address.
+			[]string{"ebtables", "-t", "filter", "-A", "INPUT", "-p", "IPv6", "-i", hostName, "--ip6-src", "!", fmt.Sprintf("%s/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", IPv6.String()), "-j", "DROP"},
+			[]string{"ebtables", "-t", "filter", "-A", "FORWARD", "-p", "IPv6", "-i", hostName, "--ip6-src", "!", fmt.Sprintf("%s/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", IPv6.String()), "-j", "DROP"},
+		)
+	}
+
+	return rules
+}
+
+// matchEbtablesRule compares an active rule to a supplied match rule to see if they match.
+// If deleteMode is true then the "-A" flag in the active rule will be modified to "-D" and will
+// not be part of the equality match. This allows delete commands to be generated from dumped add commands.
+func (d *xtables) matchEbtablesRule(activeRule []string, matchRule []string, deleteMode bool) bool {
+	for i := range matchRule {
+		// Active rules will be dumped in "add" format, we need to detect
+		// this and switch it to "delete" mode if requested. If this has already been
+		// done then move on, as we don't want to break the comparison below.
+		if deleteMode && (activeRule[i] == "-A" || activeRule[i] == "-D") {
+			activeRule[i] = "-D"
+			continue
+		}
+
+		// Check the match rule field matches the active rule field.
+		// If they don't match, then this isn't one of our rules.
+		if strings.Replace(activeRule[i], "/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "", -1) != strings.Replace(matchRule[i], "/ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "", -1) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// generateFilterIptablesRules returns a customised set of iptables filter rules based on the device.
+func (d *xtables) generateFilterIptablesRules(parentName string, hostName string, hwAddr string, IPv6 net.IP) (rules [][]string, err error) {
+	mac, err := net.ParseMAC(hwAddr)
+	if err != nil {
+		return
+	}
+
+	macHex := hex.EncodeToString(mac)
+
+	// These rules below are implemented using ip6tables because the functionality to inspect
+	// the contents of an ICMPv6 packet does not exist in ebtables (unlike for IPv4 ARP).
+	// Additionally, ip6tables doesn't really provide a nice way to do what we need here, so we
+	// have resorted to doing a raw hex comparison of the packet contents at fixed positions.
+	// If these rules are not added then it is possible to hijack traffic for another IP that is
+	// not assigned to the instance by sending a specially crafted gratuitous NDP packet with
+	// correct source address and MAC at the IP & ethernet layers, but a fraudulent IP or MAC
+	// inside the ICMPv6 NDP packet.
+	if IPv6 != nil {
+		ipv6Hex := hex.EncodeToString(IPv6)
+
+		rules = append(rules,
+			// Prevent Neighbor Advertisement IP spoofing (prevents the instance redirecting traffic for IPs that are not its own).
+			[]string{"ipv6", "INPUT", "-i", parentName, "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", hostName, "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", ipv6Hex), "--algo", "bm", "--from", "48", "--to", "64", "-j", "DROP"},
+			[]string{"ipv6", "FORWARD", "-i", parentName, "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", hostName, "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", ipv6Hex), "--algo", "bm", "--from", "48", "--to", "64", "-j", "DROP"},
+			// Prevent Neighbor Advertisement MAC spoofing (prevents the instance poisoning the NDP cache of its neighbours with a MAC address that isn't its own).
+			[]string{"ipv6", "INPUT", "-i", parentName, "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", hostName, "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", macHex), "--algo", "bm", "--from", "66", "--to", "72", "-j", "DROP"},
+			[]string{"ipv6", "FORWARD", "-i", parentName, "-p", "ipv6-icmp", "-m", "physdev", "--physdev-in", hostName, "-m", "icmp6", "--icmpv6-type", "136", "-m", "string", "!", "--hex-string", fmt.Sprintf("|%s|", macHex), "--algo", "bm", "--from", "66", "--to", "72", "-j", "DROP"},
+		)
+	}
+
+	return
+}
+
+// InstanceSetupProxyNAT forwards a port of the host to the instance.
+func (d *xtables) InstanceSetupProxyNAT(projectName string, instanceName string, deviceName string, forward ProxyForward) error {
+	comment := fmt.Sprintf("%s (%s)", instanceName, deviceName)
+
+	target := fmt.Sprintf("%s:%s", forward.ConnectAddress, forward.ConnectPort)
+	if forward.IPVersion == 6 {
+		target = fmt.Sprintf("[%s]:%s", forward.ConnectAddress, forward.ConnectPort)
+	}
+
+	// outbound <-> instance, then host <-> instance.
+	for _, chain := range []string{"PREROUTING", "OUTPUT"} {
+		err := iptables.ContainerPrepend(d.protocol(forward.IPVersion), comment, "nat",
+			chain, "-p", forward.Protocol, "--destination",
+			forward.ListenAddress, "--dport", forward.ListenPort, "-j", "DNAT",
+			"--to-destination", target)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InstanceClearProxyNAT removes the ports forwarded by the proxy device.
+func (d *xtables) InstanceClearProxyNAT(projectName string, instanceName string, deviceName string) error {
+	comment := fmt.Sprintf("%s (%s)", instanceName, deviceName)
+
+	err := iptables.ContainerClear("ipv4", comment, "nat")
+	if err != nil {
+		return err
+	}
+
+	return iptables.ContainerClear("ipv6", comment, "nat")
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/node"
+	"github.com/lxc/lxd/lxd/oci"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/lxd/state"
@@ -153,6 +154,29 @@ func compressFile(compress string, infile io.Reader, outfile io.Writer) error {
 	return nil
 }
 
+// Compresses the file at the given path in place.
+func compressFileInPlace(path string, compress string) error {
+	infile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+
+	compressed, err := os.Create(path + ".compressed")
+	if err != nil {
+		return err
+	}
+	defer compressed.Close()
+
+	err = compressFile(compress, infile, compressed)
+	if err != nil {
+		os.Remove(compressed.Name())
+		return err
+	}
+
+	return os.Rename(compressed.Name(), path)
+}
+
 /*
  * This function takes a container or snapshot from the local image server and
  * exports it as an image.
@@ -318,6 +342,139 @@ func imgPostContInfo(d *Daemon, r *http.Request, req api.ImagesPost, op *operati
 	return &info, nil
 }
 
+/*
+ * This function takes a custom block volume and exports it as a virtual
+ * machine image, its disk becoming the root disk of the image.
+ */
+func imgPostVolumeInfo(d *Daemon, req api.ImagesPost, op *operations.Operation, builddir string, project string) (*api.Image, error) {
+	info := api.Image{}
+	info.Type = instancetype.VM.String()
+	info.Filename = req.Filename
+	info.Public = req.Public
+	info.Properties = req.Properties
+	if info.Properties == nil {
+		info.Properties = map[string]string{}
+	}
+
+	if req.Source.Name == "" || req.Source.Pool == "" {
+		return nil, fmt.Errorf("No source provided")
+	}
+
+	if shared.IsSnapshot(req.Source.Name) {
+		return nil, fmt.Errorf("This is a snapshot")
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), req.Source.Pool)
+	if err != nil {
+		if err == storageDrivers.ErrUnknownDriver {
+			return nil, fmt.Errorf("Storage pool %q doesn't support custom block volumes", req.Source.Pool)
+		}
+
+		return nil, err
+	}
+
+	// Write the volume disk as the rootfs file of the image.
+	rootfsPath := filepath.Join(builddir, "rootfs.img")
+	err = pool.ExportCustomVolumeDisk(req.Source.Name, rootfsPath, op)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Architecture, err = osarch.ArchitectureName(d.os.Architectures[0])
+	if err != nil {
+		return nil, err
+	}
+
+	info.CreatedAt = time.Now().UTC()
+
+	// Build the metadata tarball.
+	imageMeta := api.ImageMetadata{
+		Architecture: info.Architecture,
+		CreationDate: info.CreatedAt.Unix(),
+		Properties:   info.Properties,
+	}
+
+	metaData, err := yaml.Marshal(&imageMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	metaFile, err := ioutil.TempFile(builddir, "lxd_build_image_")
+	if err != nil {
+		return nil, err
+	}
+	defer metaFile.Close()
+
+	tw := tar.NewWriter(metaFile)
+	err = tw.WriteHeader(&tar.Header{
+		Name:    "metadata.yaml",
+		Mode:    0644,
+		Size:    int64(len(metaData)),
+		ModTime: info.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tw.Write(metaData)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// The fingerprint covers the metadata tarball followed by the rootfs file, as for the split
+	// images uploaded to the server.
+	sha256 := sha256.New()
+	for _, path := range []string{metaFile.Name(), rootfsPath} {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := io.Copy(sha256, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		info.Size += size
+	}
+
+	info.Fingerprint = fmt.Sprintf("%x", sha256.Sum(nil))
+
+	_, _, err = d.cluster.ImageGet(project, info.Fingerprint, false, true)
+	if err != db.ErrNoSuchObject {
+		if err != nil {
+			return nil, err
+		}
+
+		return &info, fmt.Errorf("The image already exists: %s", info.Fingerprint)
+	}
+
+	/* rename the the files to the expected names so our caller can use them */
+	err = shared.FileMove(metaFile.Name(), shared.VarPath("images", info.Fingerprint))
+	if err != nil {
+		return nil, err
+	}
+
+	err = shared.FileMove(rootfsPath, shared.VarPath("images", info.Fingerprint+".rootfs"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the database entry
+	err = d.cluster.ImageInsert(project, info.Fingerprint, info.Filename, info.Size, info.Public, info.AutoUpdate, info.Architecture, info.CreatedAt, info.ExpiresAt, info.Properties, info.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
 func imgPostRemoteInfo(d *Daemon, req api.ImagesPost, op *operations.Operation, project string) (*api.Image, error) {
 	var err error
 	var hash string
@@ -537,6 +694,24 @@ func getImgPostInfo(d *Daemon, r *http.Request, builddir string, project string,
 			return nil, err
 		}
 	} else {
+		// OCI image layouts are converted to a unified image first
+		isOCI, err := oci.IsLayout(post)
+		if err != nil {
+			return nil, err
+		}
+
+		if isOCI {
+			converted, err := imageFromOCI(d, builddir, post)
+			if err != nil {
+				logger.Error("Failed to convert the OCI image", log.Ctx{"err": err})
+				return nil, err
+			}
+			defer os.Remove(converted.Name())
+			defer converted.Close()
+
+			post = converted
+		}
+
 		post.Seek(0, 0)
 		size, err = io.Copy(sha256, post)
 		if err != nil {
@@ -590,6 +765,12 @@ func getImgPostInfo(d *Daemon, r *http.Request, builddir string, project string,
 		}
 	}
 
+	// Check the image with the content scanner before it can be used
+	err = contentScan(d, "image", info.Fingerprint, imageScanPaths(shared.VarPath("images", info.Fingerprint)))
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if the image already exists
 	exists, err := d.cluster.ImageExists(project, info.Fingerprint)
 	if err != nil {
@@ -711,7 +892,7 @@ func imagesPost(d *Daemon, r *http.Request) response.Response {
 		imageUpload = true
 	}
 
-	if !imageUpload && !shared.StringInSlice(req.Source.Type, []string{"container", "snapshot", "image", "url"}) {
+	if !imageUpload && !shared.StringInSlice(req.Source.Type, []string{"container", "snapshot", "image", "url", "volume"}) {
 		cleanup(builddir, post)
 		return response.InternalError(fmt.Errorf("Invalid images JSON"))
 	}
@@ -735,6 +916,41 @@ func imagesPost(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
+	/* Forward requests for custom volumes on other nodes */
+	if !imageUpload && req.Source.Type == "volume" && req.Source.Name != "" && req.Source.Pool != "" {
+		poolID, err := d.cluster.StoragePoolGetID(req.Source.Pool)
+		if err != nil {
+			cleanup(builddir, post)
+			return response.SmartError(err)
+		}
+
+		post.Seek(0, 0)
+		r.Body = post
+		resp := ForwardedResponseIfVolumeIsRemote(d, r, poolID, req.Source.Name, storagePoolVolumeTypeCustom)
+		if resp != nil {
+			cleanup(builddir, nil)
+			return resp
+		}
+	}
+
+	// Image uploads carry the preseed request in headers.
+	if imageUpload && r.Header.Get("X-LXD-preseed-pool") != "" {
+		req.Preseed = &api.ImagePreseed{Pool: r.Header.Get("X-LXD-preseed-pool")}
+
+		members := r.Header.Get("X-LXD-preseed-members")
+		if members != "" {
+			req.Preseed.Members = strings.Split(members, ",")
+		}
+	}
+
+	if req.Preseed != nil {
+		err = imagePreseedValidate(d, *req.Preseed)
+		if err != nil {
+			cleanup(builddir, post)
+			return response.BadRequest(err)
+		}
+	}
+
 	// Begin background operation
 	run := func(op *operations.Operation) error {
 		var err error
@@ -753,6 +969,11 @@ func imagesPost(d *Daemon, r *http.Request) response.Response {
 			} else if req.Source.Type == "url" {
 				/* Processing image copy from URL */
 				info, err = imgPostURLInfo(d, req, op, project)
+			} else if req.Source.Type == "volume" {
+				/* Processing image creation from custom block volume */
+				imagePublishLock.Lock()
+				info, err = imgPostVolumeInfo(d, req, op, builddir, project)
+				imagePublishLock.Unlock()
 			} else {
 				/* Processing image creation from container */
 				imagePublishLock.Lock()
@@ -799,6 +1020,14 @@ func imagesPost(d *Daemon, r *http.Request) response.Response {
 			return errors.Wrapf(err, "Image sync between nodes")
 		}
 
+		// Create the cached volume of the image ahead of its first use
+		if req.Preseed != nil {
+			err = imagePreseed(d, project, info.Fingerprint, *req.Preseed)
+			if err != nil {
+				return errors.Wrapf(err, "Image preseed")
+			}
+		}
+
 		return nil
 	}
 
@@ -1362,6 +1591,16 @@ func pruneExpiredImages(ctx context.Context, d *Daemon) error {
 }
 
 func doDeleteImageFromPool(state *state.State, fingerprint string, storagePool string) error {
+	// Check if we can load new storage layer for pool driver type.
+	pool, err := storagePools.GetPoolByName(state, storagePool)
+	if err != storageDrivers.ErrUnknownDriver {
+		if err != nil {
+			return err
+		}
+
+		return pool.DeleteImage(fingerprint, nil)
+	}
+
 	// Initialize a new storage interface.
 	s, err := storagePoolVolumeImageInit(state, storagePool, fingerprint)
 	if err != nil {
@@ -1915,7 +2154,7 @@ func imageExport(d *Daemon, r *http.Request) response.Response {
 	}
 
 	// Check if the image is only available on another node.
-	address, err := d.cluster.ImageLocate(imgInfo.Fingerprint)
+	address, err := imageLocate(d, project, imgInfo.Fingerprint)
 	if err != nil {
 		return response.SmartError(err)
 	}
@@ -2147,6 +2386,7 @@ func autoSyncImages(ctx context.Context, d *Daemon) error {
 
 func imageSyncBetweenNodes(d *Daemon, project string, fingerprint string) error {
 	var desiredSyncNodeCount int64
+	var imagesPool string
 
 	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
 		config, err := cluster.ConfigLoad(tx)
@@ -2154,6 +2394,7 @@ func imageSyncBetweenNodes(d *Daemon, project string, fingerprint string) error
 			return errors.Wrap(err, "Failed to load cluster configuration")
 		}
 		desiredSyncNodeCount = config.ImagesMinimalReplica()
+		imagesPool = config.ImagesPool()
 
 		// -1 means that we want to replicate the image on all nodes
 		if desiredSyncNodeCount == -1 {
@@ -2171,6 +2412,11 @@ func imageSyncBetweenNodes(d *Daemon, project string, fingerprint string) error
 		return err
 	}
 
+	// All the nodes already have the images of the shared image store.
+	if imagesPool != "" {
+		return nil
+	}
+
 	// Check how many nodes already have this image
 	syncNodeAddresses, err := d.cluster.ImageGetNodesWithImage(fingerprint)
 	if err != nil {
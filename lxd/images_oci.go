@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/lxc/lxd/lxd/oci"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/osarch"
+)
+
+// imageFromOCI converts an uploaded OCI image layout tarball into a unified image tarball, its
+// layers flattened into the rootfs. The image for the architecture of the server is picked from
+// layouts holding several. The returned file must be removed by the caller.
+func imageFromOCI(d *Daemon, builddir string, post *os.File) (*os.File, error) {
+	tmpDir, err := ioutil.TempDir(builddir, "lxd_oci_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	hostArch, err := osarch.ArchitectureName(d.os.Architectures[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rootfsPath := filepath.Join(tmpDir, "image", "rootfs")
+	err = os.MkdirAll(rootfsPath, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = post.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	config, name, err := oci.Unpack(post, filepath.Join(tmpDir, "layout"), rootfsPath, hostArch)
+	if err != nil {
+		return nil, err
+	}
+
+	arch, err := oci.ArchitectureName(config.Architecture)
+	if err != nil {
+		return nil, err
+	}
+
+	created := time.Now().UTC()
+	if config.Created != nil {
+		created = *config.Created
+	}
+
+	description := "OCI image"
+	if name != "" {
+		description = fmt.Sprintf("OCI image %s", name)
+	}
+
+	meta := api.ImageMetadata{
+		Architecture: arch,
+		CreationDate: created.Unix(),
+		Properties: map[string]string{
+			"description": description,
+		},
+	}
+
+	data, err := yaml.Marshal(&meta)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(tmpDir, "image", "metadata.yaml"), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	imageTarf, err := ioutil.TempFile(builddir, "lxd_tar_")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = shared.RunCommand("tar", "-cf", imageTarf.Name(), "--numeric-owner", "--xattrs", "-C", filepath.Join(tmpDir, "image"), "metadata.yaml", "rootfs")
+	if err != nil {
+		imageTarf.Close()
+		os.Remove(imageTarf.Name())
+		return nil, err
+	}
+
+	return imageTarf, nil
+}
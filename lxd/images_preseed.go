@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+var internalImagePreseedCmd = APIEndpoint{
+	Path: "images/preseed",
+
+	Post: APIEndpointAction{Handler: internalImagePreseedPost},
+}
+
+type internalImagePreseedPostRequest struct {
+	Project     string `json:"project" yaml:"project"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Pool        string `json:"pool" yaml:"pool"`
+}
+
+// Create the cached volume of an image on this node, as requested by the node
+// which imported it.
+func internalImagePreseedPost(d *Daemon, r *http.Request) response.Response {
+	req := internalImagePreseedPostRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = imagePreseedLocal(d, req.Project, req.Fingerprint, req.Pool)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.EmptySyncResponse
+}
+
+// Checks that the storage pool and the cluster members of a preseed request
+// exist.
+func imagePreseedValidate(d *Daemon, preseed api.ImagePreseed) error {
+	if preseed.Pool == "" {
+		return fmt.Errorf("No storage pool provided to preseed the image in")
+	}
+
+	_, err := d.cluster.StoragePoolGetID(preseed.Pool)
+	if err == db.ErrNoSuchObject {
+		return fmt.Errorf("Storage pool %q doesn't exist", preseed.Pool)
+	} else if err != nil {
+		return err
+	}
+
+	if len(preseed.Members) == 0 {
+		return nil
+	}
+
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return err
+	}
+
+	if !clustered {
+		return fmt.Errorf("Cluster members can only be provided when clustered")
+	}
+
+	return d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		for _, name := range preseed.Members {
+			_, err := tx.NodeByName(name)
+			if err == db.ErrNoSuchObject {
+				return fmt.Errorf("Cluster member %q doesn't exist", name)
+			} else if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Creates the cached volume of an image in a storage pool on the requested
+// cluster members, or on all of them if none is requested, so that the first
+// instance created from the image on each member doesn't have to wait for the
+// image to be unpacked.
+//
+// Offline members are skipped when preseeding on all members, but make the
+// preseed fail when they were requested explicitly.
+func imagePreseed(d *Daemon, project string, fingerprint string, preseed api.ImagePreseed) error {
+	_, poolInfo, err := d.cluster.StoragePoolGet(preseed.Pool)
+	if err != nil {
+		return err
+	}
+
+	// The volumes of a ceph pool are shared by all members, a single one is
+	// enough.
+	if poolInfo.Driver == "ceph" {
+		return imagePreseedLocal(d, project, fingerprint, preseed.Pool)
+	}
+
+	var localName string
+	var nodes []db.NodeInfo
+	var offlineThreshold time.Duration
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+
+		localName, err = tx.NodeName()
+		if err != nil {
+			return err
+		}
+
+		nodes, err = tx.Nodes()
+		if err != nil {
+			return err
+		}
+
+		offlineThreshold, err = tx.NodeOfflineThreshold()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	req := internalImagePreseedPostRequest{
+		Project:     project,
+		Fingerprint: fingerprint,
+		Pool:        preseed.Pool,
+	}
+
+	failed := []string{}
+	for _, node := range nodes {
+		if len(preseed.Members) > 0 && !shared.StringInSlice(node.Name, preseed.Members) {
+			continue
+		}
+
+		if node.Name == localName {
+			err = imagePreseedLocal(d, project, fingerprint, preseed.Pool)
+		} else if node.IsOffline(offlineThreshold) {
+			if len(preseed.Members) == 0 {
+				logger.Warn("Skipping image preseed on offline member", log.Ctx{"fingerprint": fingerprint, "member": node.Name})
+				continue
+			}
+
+			err = fmt.Errorf("Member is offline")
+		} else {
+			err = imagePreseedRemote(d, node.Address, req)
+		}
+
+		if err != nil {
+			logger.Error("Failed to preseed image", log.Ctx{"fingerprint": fingerprint, "member": node.Name, "err": err})
+			failed = append(failed, node.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to preseed the image on members: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// Asks another node to create the cached volume of an image.
+func imagePreseedRemote(d *Daemon, address string, req internalImagePreseedPostRequest) error {
+	client, err := cluster.Connect(address, d.endpoints.NetworkCert(), false)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = client.RawQuery("POST", "/internal/images/preseed", req, "")
+	return err
+}
+
+// Creates the cached volume of an image in a storage pool on this node,
+// fetching the image from another node first if needed.
+func imagePreseedLocal(d *Daemon, project string, fingerprint string, poolName string) error {
+	_, info, err := d.cluster.ImageGet(project, fingerprint, false, true)
+	if err != nil {
+		return errors.Wrapf(err, "Fetch image %s from database", fingerprint)
+	}
+
+	nodeAddress, err := imageLocate(d, project, fingerprint)
+	if err != nil {
+		return errors.Wrapf(err, "Locate image %s in the cluster", fingerprint)
+	}
+
+	if nodeAddress != "" {
+		client, err := cluster.Connect(nodeAddress, d.endpoints.NetworkCert(), false)
+		if err != nil {
+			return err
+		}
+
+		client = client.UseProject(project)
+
+		err = imageImportFromNode(filepath.Join(d.os.VarDir, "images"), client, fingerprint)
+		if err != nil {
+			return err
+		}
+
+		err = d.cluster.ImageAssociateNode(project, fingerprint)
+		if err != nil {
+			return err
+		}
+	}
+
+	poolID, err := d.cluster.StoragePoolGetID(poolName)
+	if err != nil {
+		return err
+	}
+
+	poolIDs, err := d.cluster.ImageGetPools(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if shared.Int64InSlice(poolID, poolIDs) {
+		return nil
+	}
+
+	return imageCreateInPool(d, info, poolName)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/node"
+	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared"
+)
+
+// Name of the custom volume holding the image store shared by the nodes of a cluster, on the
+// storage pool set in cluster.images_pool.
+const imagesSharedVolume = "lxd-images"
+
+// imagesSharedPool returns the storage pool set in cluster.images_pool, if any.
+func imagesSharedPool(s *state.State) (string, error) {
+	var poolName string
+	err := s.Cluster.Transaction(func(tx *db.ClusterTx) error {
+		config, err := cluster.ConfigLoad(tx)
+		if err != nil {
+			return err
+		}
+
+		poolName = config.ImagesPool()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return poolName, nil
+}
+
+// imagesSharedValidate checks that the given storage pool can hold the image store shared by the
+// nodes of the cluster, which takes a filesystem all of them can mount at once.
+func imagesSharedValidate(s *state.State, poolName string) error {
+	if poolName == "" {
+		return nil
+	}
+
+	_, pool, err := s.Cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to load storage pool \"%s\"", poolName)
+	}
+
+	if pool.Driver != "cephfs" {
+		return fmt.Errorf("The shared image store must be on a cephfs storage pool")
+	}
+
+	var storageImages string
+	err = s.Node.Transaction(func(tx *db.NodeTx) error {
+		nodeConfig, err := node.ConfigLoad(tx)
+		if err != nil {
+			return err
+		}
+
+		storageImages = nodeConfig.StorageImagesVolume()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if storageImages != "" {
+		return fmt.Errorf("cluster.images_pool can't be set while storage.images_volume is")
+	}
+
+	return nil
+}
+
+// imagesSharedVolumeCreate creates the volume of the shared image store on the storage pool,
+// unless it already exists.
+func imagesSharedVolumeCreate(s *state.State, poolName string) error {
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.Cluster.StoragePoolNodeVolumeGetType(imagesSharedVolume, db.StoragePoolVolumeTypeCustom, pool.ID())
+	if err != db.ErrNoSuchObject {
+		return err
+	}
+
+	return pool.CreateCustomVolume(imagesSharedVolume, "Image store shared by the cluster nodes", nil, storageDrivers.ContentTypeFS, nil)
+}
+
+// imagesSharedVolumeMount mounts the volume of the shared image store and returns its path.
+func imagesSharedVolumeMount(s *state.State, poolName string) (string, error) {
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = pool.MountCustomVolume(imagesSharedVolume, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to mount the shared image store on storage pool \"%s\"", poolName)
+	}
+
+	return storageDrivers.GetVolumeMountPath(poolName, storageDrivers.VolumeTypeCustom, imagesSharedVolume), nil
+}
+
+// imagesSharedMove switches the image store of this node to the volume on the given storage pool,
+// or back to a local directory if the pool is empty. The images are copied across but never
+// removed from the shared image store, as other nodes may still be using it.
+func imagesSharedMove(s *state.State, poolName string) error {
+	imagesPath := shared.VarPath("images")
+
+	sharedPath, err := os.Readlink(imagesPath)
+	if err != nil {
+		sharedPath = ""
+	}
+
+	if poolName == "" {
+		if sharedPath == "" {
+			return nil
+		}
+
+		err = os.Remove(imagesPath)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to delete storage symlink at \"%s\"", imagesPath)
+		}
+
+		err = os.MkdirAll(imagesPath, 0700)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create directory \"%s\"", imagesPath)
+		}
+
+		return imagesSharedCopy(sharedPath, imagesPath)
+	}
+
+	mountPath, err := imagesSharedVolumeMount(s, poolName)
+	if err != nil {
+		return err
+	}
+
+	if sharedPath == mountPath {
+		return nil
+	}
+
+	err = os.Chmod(mountPath, 0700)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to set permissions on \"%s\"", mountPath)
+	}
+
+	sourcePath := imagesPath
+	if sharedPath != "" {
+		sourcePath = sharedPath
+	}
+
+	err = imagesSharedCopy(sourcePath, mountPath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to copy the images over to \"%s\"", mountPath)
+	}
+
+	err = os.RemoveAll(imagesPath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to remove \"%s\"", imagesPath)
+	}
+
+	err = os.Symlink(mountPath, imagesPath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create the new symlink at \"%s\"", imagesPath)
+	}
+
+	return nil
+}
+
+// imagesSharedCopy copies the image files of the source directory which the target directory
+// doesn't have yet, leaving the others alone.
+func imagesSharedCopy(source string, target string) error {
+	entries, err := ioutil.ReadDir(source)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || shared.PathExists(filepath.Join(target, entry.Name())) {
+			continue
+		}
+
+		err := shared.FileCopy(filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// imageLocate returns the address of a node of the cluster holding the image, or an empty string
+// if this node does. Images of the shared image store are always available locally, they're just
+// associated with this node the first time it uses them.
+func imageLocate(d *Daemon, project string, fingerprint string) (string, error) {
+	address, err := d.cluster.ImageLocate(fingerprint)
+	if err != nil || address == "" {
+		return address, err
+	}
+
+	poolName, err := imagesSharedPool(d.State())
+	if err != nil {
+		return "", err
+	}
+
+	if poolName == "" || !shared.PathExists(shared.VarPath("images", fingerprint)) {
+		return address, nil
+	}
+
+	err = d.cluster.ImageAssociateNode(project, fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	return "", nil
+}
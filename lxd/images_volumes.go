@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/operations"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/shared/logger"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// pruneImageVolumes removes the cached image volumes of the local storage pools whose image was
+// deleted or whose size no longer matches the volume.size of their pool.
+func pruneImageVolumes(ctx context.Context, d *Daemon, op *operations.Operation) error {
+	poolNames, err := d.cluster.StoragePoolsNotPending()
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, poolName := range poolNames {
+		// The remaining pools are pruned at the next run.
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		pool, err := storagePools.GetPoolByName(d.State(), poolName)
+		if err == storageDrivers.ErrUnknownDriver {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = pool.PruneImages(op)
+		if err != nil {
+			logger.Warn("Failed to prune image volumes", log.Ctx{"pool": poolName, "err": err})
+		}
+	}
+
+	return nil
+}
+
+func pruneImageVolumesTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		opRun := func(op *operations.Operation) error {
+			return pruneImageVolumes(ctx, d, op)
+		}
+
+		op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationImagesPruneVolumes, nil, nil, opRun, nil, nil)
+		if err != nil {
+			logger.Error("Failed to start image volumes pruning operation", log.Ctx{"err": err})
+			return
+		}
+
+		logger.Info("Pruning image volumes")
+
+		_, err = op.Run()
+		if err != nil {
+			logger.Error("Failed to prune image volumes", log.Ctx{"err": err})
+		}
+
+		logger.Info("Done pruning image volumes")
+	}
+
+	return f, task.Every(time.Hour)
+}
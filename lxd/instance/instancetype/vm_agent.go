@@ -0,0 +1,10 @@
+package instancetype
+
+// VMAgentMount is a filesystem the agent mounts inside the virtual machine when it starts, as
+// listed in the agent-mounts.json file of the config drive.
+type VMAgentMount struct {
+	Source  string   `json:"source"`
+	Target  string   `json:"target"`
+	FSType  string   `json:"fstype"`
+	Options []string `json:"options"`
+}
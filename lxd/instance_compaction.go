@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/operations"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/shared/logger"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// instanceCompact releases on the host the space freed by a virtual machine. The agent of running
+// ones trims their filesystems, the disks of stopped ones are compacted by their storage pool.
+func instanceCompact(d *Daemon, inst Instance, op *operations.Operation) error {
+	if inst.IsRunning() {
+		return inst.(*vmQemu).agentTrim()
+	}
+
+	pool, err := storagePools.GetPoolByInstance(d.State(), inst)
+	if err != nil {
+		return err
+	}
+
+	return pool.CompactInstance(inst, op)
+}
+
+func autoCompactInstancesTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		// Load all local instances
+		allInstances, err := instanceLoadNodeAll(d.State())
+		if err != nil {
+			logger.Error("Failed to load instances for scheduled compaction", log.Ctx{"err": err})
+			return
+		}
+
+		// Figure out which need compacting (if any)
+		instances := []Instance{}
+		for _, inst := range allInstances {
+			if inst.Type() != instancetype.VM || inst.IsSnapshot() {
+				continue
+			}
+
+			if !snapshotIsScheduledNow(inst.ExpandedConfig()["compaction.schedule"]) {
+				continue
+			}
+
+			instances = append(instances, inst)
+		}
+
+		if len(instances) == 0 {
+			return
+		}
+
+		opRun := func(op *operations.Operation) error {
+			for _, inst := range instances {
+				err := instanceCompact(d, inst, op)
+				if err != nil {
+					logger.Warn("Failed to compact instance", log.Ctx{"project": inst.Project(), "instance": inst.Name(), "err": err})
+				}
+			}
+
+			return nil
+		}
+
+		op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationInstancesCompact, nil, nil, opRun, nil, nil)
+		if err != nil {
+			logger.Error("Failed to start compact instances operation", log.Ctx{"err": err})
+			return
+		}
+
+		logger.Info("Compacting scheduled instances")
+
+		_, err = op.Run()
+		if err != nil {
+			logger.Error("Failed to compact scheduled instances", log.Ctx{"err": err})
+		}
+
+		logger.Info("Done compacting scheduled instances")
+	}
+
+	first := true
+	schedule := func() (time.Duration, error) {
+		interval := time.Minute
+
+		if first {
+			first = false
+			return interval, task.ErrSkip
+		}
+
+		return interval, nil
+	}
+
+	return f, schedule
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/node"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/osarch"
+)
+
+// Lifecycle points at which the host hooks of instances run, with the hooks.* key setting them.
+const (
+	instanceHookPreStart     = "pre_start"
+	instanceHookPostStop     = "post_stop"
+	instanceHookPostSnapshot = "post_snapshot"
+)
+
+// instanceHostHook runs the host command set in the hooks.<hook> key of the instance, if any.
+// The binary it runs must be listed in core.hooks_allowed. The command gets the metadata of the
+// instance through LXD_* environment variables, along with the extra ones given.
+func instanceHostHook(s *state.State, inst Instance, hook string, extra map[string]string) error {
+	command := inst.ExpandedConfig()[fmt.Sprintf("hooks.%s", hook)]
+	if command == "" {
+		return nil
+	}
+
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	binary := filepath.Clean(fields[0])
+	if !filepath.IsAbs(binary) {
+		return fmt.Errorf("The %s hook must run a binary given by its absolute path", hook)
+	}
+
+	allowed, err := node.HooksAllowed(s.Node)
+	if err != nil {
+		return err
+	}
+
+	if !shared.StringInSlice(binary, allowed) {
+		return fmt.Errorf("The %s hook runs %q, which isn't listed in core.hooks_allowed", hook, binary)
+	}
+
+	architecture, _ := osarch.ArchitectureName(inst.Architecture())
+
+	env := []string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		fmt.Sprintf("LXD_HOOK=%s", hook),
+		fmt.Sprintf("LXD_INSTANCE_NAME=%s", inst.Name()),
+		fmt.Sprintf("LXD_INSTANCE_PROJECT=%s", inst.Project()),
+		fmt.Sprintf("LXD_INSTANCE_TYPE=%s", inst.Type().String()),
+		fmt.Sprintf("LXD_INSTANCE_ARCHITECTURE=%s", architecture),
+		fmt.Sprintf("LXD_INSTANCE_UUID=%s", inst.LocalConfig()["volatile.uuid"]),
+	}
+
+	for k, v := range extra {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	_, _, err = shared.RunCommandSplit(env, binary, fields[1:]...)
+	if err != nil {
+		return fmt.Errorf("The %s hook failed: %v", hook, err)
+	}
+
+	return nil
+}
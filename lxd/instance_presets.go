@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/db"
+	deviceConfig "github.com/lxc/lxd/lxd/device/config"
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/version"
+)
+
+var instancePresetsCmd = APIEndpoint{
+	Path: "instance-presets",
+
+	Get:  APIEndpointAction{Handler: instancePresetsGet, AccessHandler: AllowProjectPermission("containers", "view")},
+	Post: APIEndpointAction{Handler: instancePresetsPost, AccessHandler: AllowProjectPermission("containers", "manage-containers")},
+}
+
+var instancePresetCmd = APIEndpoint{
+	Path: "instance-presets/{name}",
+
+	Delete: APIEndpointAction{Handler: instancePresetDelete, AccessHandler: AllowProjectPermission("containers", "manage-containers")},
+	Get:    APIEndpointAction{Handler: instancePresetGet, AccessHandler: AllowProjectPermission("containers", "view")},
+	Post:   APIEndpointAction{Handler: instancePresetPost, AccessHandler: AllowProjectPermission("containers", "manage-containers")},
+	Put:    APIEndpointAction{Handler: instancePresetPut, AccessHandler: AllowProjectPermission("containers", "manage-containers")},
+}
+
+var instancePresetInstancesCmd = APIEndpoint{
+	Path: "instance-presets/{name}/instances",
+
+	Post: APIEndpointAction{Handler: instancePresetInstancesPost, AccessHandler: AllowProjectPermission("containers", "manage-containers")},
+}
+
+func instancePresetsGet(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	recursion := util.IsRecursionRequest(r)
+
+	var presets []*api.InstancePreset
+	var names []string
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+		names, err = tx.InstancePresetNames(project)
+		if err != nil {
+			return err
+		}
+
+		if !recursion {
+			return nil
+		}
+
+		presets = make([]*api.InstancePreset, len(names))
+		for i, name := range names {
+			presets[i], err = tx.InstancePresetGet(project, name)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if recursion {
+		return response.SyncResponse(true, presets)
+	}
+
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = fmt.Sprintf("/%s/instance-presets/%s", version.APIVersion, name)
+		if project != "default" {
+			urls[i] += fmt.Sprintf("?project=%s", project)
+		}
+	}
+
+	return response.SyncResponse(true, urls)
+}
+
+func instancePresetsPost(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+
+	req := api.InstancePresetsPost{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = instancePresetValidName(req.Name)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = instancePresetValidate(d, req.InstancePresetPut)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	resp := storagePoolVolumeAttachCheck(d, r, nil, req.Devices)
+	if resp != nil {
+		return resp
+	}
+
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		return tx.InstancePresetCreate(project, req)
+	})
+	if err != nil {
+		if err == db.ErrAlreadyDefined {
+			return response.Conflict(fmt.Errorf("The instance preset already exists"))
+		}
+
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponseLocation(true, nil, fmt.Sprintf("/%s/instance-presets/%s", version.APIVersion, req.Name))
+}
+
+func instancePresetGet(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+
+	preset, err := instancePresetLoad(d, project, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponseETag(true, preset, preset.Writable())
+}
+
+func instancePresetPut(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+
+	preset, err := instancePresetLoad(d, project, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	// Validate the ETag
+	err = util.EtagCheck(r, preset.Writable())
+	if err != nil {
+		return response.PreconditionFailed(err)
+	}
+
+	req := api.InstancePresetPut{}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = instancePresetValidate(d, req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	resp := storagePoolVolumeAttachCheck(d, r, preset.Devices, req.Devices)
+	if resp != nil {
+		return resp
+	}
+
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		return tx.InstancePresetUpdate(project, name, req)
+	})
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.EmptySyncResponse
+}
+
+// The handler for the rename operation.
+func instancePresetPost(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+
+	req := api.InstancePresetPost{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = instancePresetValidName(req.Name)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		return tx.InstancePresetRename(project, name, req.Name)
+	})
+	if err != nil {
+		if err == db.ErrAlreadyDefined {
+			return response.Conflict(fmt.Errorf("Name '%s' already in use", req.Name))
+		}
+
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponseLocation(true, nil, fmt.Sprintf("/%s/instance-presets/%s", version.APIVersion, req.Name))
+}
+
+func instancePresetDelete(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		return tx.InstancePresetDelete(project, name)
+	})
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.EmptySyncResponse
+}
+
+// Creates an instance from a preset, the config and devices of the request being applied on top
+// of the ones of the preset.
+func instancePresetInstancesPost(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	name := mux.Vars(r)["name"]
+
+	req := api.InstancePresetInstancesPost{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	preset, err := instancePresetLoad(d, project, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	instReq := api.InstancesPost{
+		Name:   req.Name,
+		Source: preset.Source,
+		Type:   preset.Type,
+	}
+
+	if instReq.Source.Type == "" {
+		instReq.Source.Type = "image"
+	}
+
+	instReq.Profiles = preset.Profiles
+	instReq.Config = map[string]string{}
+	for k, v := range preset.Config {
+		instReq.Config[k] = v
+	}
+
+	for k, v := range req.Config {
+		instReq.Config[k] = v
+	}
+
+	// Devices of the request replace the ones of the preset with the same name, as local devices
+	// of an instance do with profile devices.
+	instReq.Devices = map[string]map[string]string{}
+	for k, v := range preset.Devices {
+		instReq.Devices[k] = v
+	}
+
+	for k, v := range req.Devices {
+		instReq.Devices[k] = v
+	}
+
+	return containersPostRequest(d, r, project, instReq)
+}
+
+// Returns the instance preset with the given name.
+func instancePresetLoad(d *Daemon, project, name string) (*api.InstancePreset, error) {
+	var preset *api.InstancePreset
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+		preset, err = tx.InstancePresetGet(project, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return preset, nil
+}
+
+// Checks that an instance preset name is valid.
+func instancePresetValidName(name string) error {
+	if name == "" {
+		return fmt.Errorf("No name provided")
+	}
+
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("Instance preset names may not contain slashes")
+	}
+
+	if shared.StringInSlice(name, []string{".", ".."}) {
+		return fmt.Errorf("Invalid instance preset name '%s'", name)
+	}
+
+	return nil
+}
+
+// Checks that the definition of an instance preset is valid, its config and devices being
+// validated as the ones of a profile since they don't make a full instance on their own.
+func instancePresetValidate(d *Daemon, preset api.InstancePresetPut) error {
+	if !shared.StringInSlice(preset.Source.Type, []string{"", "image"}) {
+		return fmt.Errorf("Instance presets can only create instances from images")
+	}
+
+	if preset.Source.Alias == "" && preset.Source.Fingerprint == "" && len(preset.Source.Properties) == 0 {
+		return fmt.Errorf("No image provided")
+	}
+
+	_, err := instancetype.New(string(preset.Type))
+	if err != nil {
+		return err
+	}
+
+	err = containerValidConfig(d.os, preset.Config, true, false)
+	if err != nil {
+		return err
+	}
+
+	return containerValidDevices(d.State(), d.cluster, "", deviceConfig.NewDevices(preset.Devices), false)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// How long a sampled instance state is served as is.
+const instanceStateCacheTTL = 5 * time.Second
+
+// How long a sampled instance state keeps being served while a fresh one is sampled in the
+// background.
+const instanceStateCacheMaxAge = time.Minute
+
+// Cache of the runtime state of the instances, so that listing many instances along with their
+// state doesn't have to sample each of them every time.
+var instanceStates = instanceStateCache{entries: map[string]*instanceStateCacheEntry{}}
+
+type instanceStateCache struct {
+	mu      sync.Mutex
+	entries map[string]*instanceStateCacheEntry
+}
+
+type instanceStateCacheEntry struct {
+	state      *api.InstanceState
+	sampledAt  time.Time
+	refreshing bool
+}
+
+// instanceStateCached returns the state of the instance, as sampled at most a minute ago. States
+// which aren't fresh are refreshed in the background, and states coming from the cache have their
+// CachedAt field set to the time they were sampled at. The state is always sampled again if the
+// given current status of the instance doesn't match the cached one.
+func instanceStateCached(inst Instance, statusCode api.StatusCode) (*api.InstanceState, error) {
+	key := inst.Project() + "/" + inst.Name()
+
+	instanceStates.mu.Lock()
+	entry, ok := instanceStates.entries[key]
+	if ok && entry.state.StatusCode == statusCode && time.Since(entry.sampledAt) < instanceStateCacheMaxAge {
+		if time.Since(entry.sampledAt) >= instanceStateCacheTTL && !entry.refreshing {
+			entry.refreshing = true
+			go instanceStates.sample(key, inst)
+		}
+
+		state := *entry.state
+		sampledAt := entry.sampledAt
+		state.CachedAt = &sampledAt
+		instanceStates.mu.Unlock()
+
+		return &state, nil
+	}
+	instanceStates.mu.Unlock()
+
+	return instanceStates.sample(key, inst)
+}
+
+// Samples the state of the instance and caches it.
+func (c *instanceStateCache) sample(key string, inst Instance) (*api.InstanceState, error) {
+	sampledAt := time.Now()
+	state, err := inst.RenderState()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		delete(c.entries, key)
+		return nil, err
+	}
+
+	// Drop the states of the instances which aren't listed anymore (e.g. deleted ones).
+	for k, entry := range c.entries {
+		if time.Since(entry.sampledAt) >= instanceStateCacheMaxAge && !entry.refreshing {
+			delete(c.entries, k)
+		}
+	}
+
+	cached := *state
+	c.entries[key] = &instanceStateCacheEntry{state: &cached, sampledAt: sampledAt}
+
+	return state, nil
+}
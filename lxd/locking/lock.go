@@ -0,0 +1,168 @@
+package locking
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// warnTimeout is how long a lock can be waited for before warning about it, and then how often to
+// warn again while still waiting.
+const warnTimeout = time.Minute
+
+// ongoingOperation is an operation holding a lock of ongoingOperations.
+type ongoingOperation struct {
+	// done is closed when the operation releases the lock.
+	done chan struct{}
+
+	// start is when the operation took the lock, to spot the operations that never finish.
+	start time.Time
+
+	// waiters is the number of callers waiting for the lock to be released.
+	waiters int
+}
+
+// ongoingOperations holds the operations currently holding a lock, by name of the lock. Callers
+// wanting a lock that is taken wait for its done channel to be closed, then try again.
+// Note that any access to this map must be done while holding ongoingMutex.
+var ongoingOperations = map[string]*ongoingOperation{}
+
+// ongoingMutex is used to access ongoingOperations.
+var ongoingMutex sync.Mutex
+
+// Lock takes the lock with the given name, waiting for the operation holding it (if any) to
+// release it first. It returns the function releasing the lock.
+func Lock(name string) func() {
+	unlock, _ := LockContext(context.Background(), name)
+	return unlock
+}
+
+// LockContext takes the lock with the given name like Lock, but gives up waiting for it once the
+// context is done, returning the error of the context.
+func LockContext(ctx context.Context, name string) (func(), error) {
+	for {
+		ongoingMutex.Lock()
+
+		ongoing, ok := ongoingOperations[name]
+		if !ok {
+			break
+		}
+
+		ongoing.waiters++
+		ongoingMutex.Unlock()
+
+		err := wait(ctx, name, ongoing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	unlock := take(name)
+	ongoingMutex.Unlock()
+
+	return unlock, nil
+}
+
+// LockTimeout takes the lock with the given name like Lock, but gives up waiting for it after the
+// given timeout, returning an error.
+func LockTimeout(name string, timeout time.Duration) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return LockContext(ctx, name)
+}
+
+// TryLock takes the lock with the given name only if no one holds it, without waiting. It returns
+// the function releasing the lock and whether the lock was taken.
+func TryLock(name string) (func(), bool) {
+	ongoingMutex.Lock()
+	defer ongoingMutex.Unlock()
+
+	_, ok := ongoingOperations[name]
+	if ok {
+		return nil, false
+	}
+
+	return take(name), true
+}
+
+// take records the lock with the given name as held and returns the function releasing it. It
+// must be called while holding ongoingMutex.
+func take(name string) func() {
+	ongoing := &ongoingOperation{
+		done:  make(chan struct{}),
+		start: time.Now(),
+	}
+
+	ongoingOperations[name] = ongoing
+
+	return func() {
+		ongoingMutex.Lock()
+
+		if ongoingOperations[name] == ongoing {
+			close(ongoing.done)
+			delete(ongoingOperations, name)
+		}
+
+		ongoingMutex.Unlock()
+	}
+}
+
+// wait waits for an operation to release a lock or for the context to be done, warning regularly
+// if that takes long, as the operation may be stuck or waiting for a lock held by the caller.
+func wait(ctx context.Context, name string, ongoing *ongoingOperation) error {
+	waitStart := time.Now()
+	logger.Debug("Waiting for lock", log.Ctx{"lock": name, "held": time.Since(ongoing.start).Round(time.Millisecond)})
+
+	for {
+		select {
+		case <-ongoing.done:
+			logger.Debug("Lock released", log.Ctx{"lock": name, "waited": time.Since(waitStart).Round(time.Millisecond)})
+			return nil
+		case <-ctx.Done():
+			ongoingMutex.Lock()
+			ongoing.waiters--
+			ongoingMutex.Unlock()
+
+			logger.Debug("Gave up waiting for lock", log.Ctx{"lock": name, "waited": time.Since(waitStart).Round(time.Millisecond), "err": ctx.Err()})
+			return ctx.Err()
+		case <-time.After(warnTimeout):
+			ongoingMutex.Lock()
+			waiters := ongoing.waiters
+			ongoingMutex.Unlock()
+
+			logger.Warn("Still waiting for lock, its holder may be stuck or deadlocked", log.Ctx{"lock": name, "held": time.Since(ongoing.start).Round(time.Second), "waited": time.Since(waitStart).Round(time.Second), "waiters": waiters})
+		}
+	}
+}
+
+// Info describes a lock currently held, such as the mount or unmount lock of a volume.
+type Info struct {
+	ID      string    `json:"id" yaml:"id"`
+	Since   time.Time `json:"since" yaml:"since"`
+	Waiters int       `json:"waiters" yaml:"waiters"`
+}
+
+// Locks returns the locks currently held, along with when they were taken and how many callers
+// are waiting for them.
+func Locks() []Info {
+	ongoingMutex.Lock()
+	defer ongoingMutex.Unlock()
+
+	locks := make([]Info, 0, len(ongoingOperations))
+	for name, ongoing := range ongoingOperations {
+		locks = append(locks, Info{
+			ID:      name,
+			Since:   ongoing.start,
+			Waiters: ongoing.waiters,
+		})
+	}
+
+	sort.Slice(locks, func(i, j int) bool { return locks[i].ID < locks[j].ID })
+
+	return locks
+}
@@ -0,0 +1,86 @@
+package locking_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lxc/lxd/lxd/locking"
+)
+
+// Test Lock
+func TestLock(t *testing.T) {
+	unlock := locking.Lock("mount/testpool/custom/testvol")
+	locks := locking.Locks()
+	assert.Len(t, locks, 1)
+	assert.Equal(t, "mount/testpool/custom/testvol", locks[0].ID)
+	assert.Equal(t, 0, locks[0].Waiters)
+
+	// A second caller waits for the lock to be released, then takes it.
+	locked := make(chan func())
+	go func() {
+		locked <- locking.Lock("mount/testpool/custom/testvol")
+	}()
+
+	for i := 0; i < 100 && locking.Locks()[0].Waiters == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, 1, locking.Locks()[0].Waiters)
+
+	select {
+	case <-locked:
+		t.Fatal("Lock taken while held")
+	default:
+	}
+
+	unlock()
+
+	unlock = <-locked
+	locks = locking.Locks()
+	assert.Len(t, locks, 1)
+	assert.Equal(t, 0, locks[0].Waiters)
+
+	unlock()
+	assert.Len(t, locking.Locks(), 0)
+}
+
+// Test TryLock
+func TestTryLock(t *testing.T) {
+	unlock, ok := locking.TryLock("umount/testpool/custom/testvol")
+	assert.True(t, ok)
+
+	_, ok = locking.TryLock("umount/testpool/custom/testvol")
+	assert.False(t, ok)
+
+	unlock()
+
+	unlock, ok = locking.TryLock("umount/testpool/custom/testvol")
+	assert.True(t, ok)
+	unlock()
+}
+
+// Test LockContext and LockTimeout
+func TestLockContext(t *testing.T) {
+	unlock := locking.Lock("image/testpool/abcdef")
+
+	_, err := locking.LockTimeout("image/testpool/abcdef", 50*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = locking.LockContext(ctx, "image/testpool/abcdef")
+	assert.Equal(t, context.Canceled, err)
+
+	// The callers which gave up are no longer counted as waiting.
+	assert.Equal(t, 0, locking.Locks()[0].Waiters)
+
+	unlock()
+
+	unlock, err = locking.LockTimeout("image/testpool/abcdef", time.Second)
+	assert.NoError(t, err)
+	unlock()
+}
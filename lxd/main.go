@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
 	"os"
 	"time"
@@ -28,6 +29,7 @@ type cmdGlobal struct {
 	flagVersion bool
 
 	flagLogFile    string
+	flagLogFormat  string
 	flagLogDebug   bool
 	flagLogSyslog  bool
 	flagLogTrace   []string
@@ -46,12 +48,16 @@ func (c *cmdGlobal) Run(cmd *cobra.Command, args []string) error {
 	response.Init(daemon.Verbose)
 
 	// Setup logger
+	if c.flagLogFormat != "text" && c.flagLogFormat != "json" {
+		return fmt.Errorf("Invalid log format %q (must be \"text\" or \"json\")", c.flagLogFormat)
+	}
+
 	syslog := ""
 	if c.flagLogSyslog {
 		syslog = "lxd"
 	}
 
-	log, err := logging.GetLogger(syslog, c.flagLogFile, c.flagLogVerbose, c.flagLogDebug, events.NewEventHandler())
+	log, err := logging.GetLogger(syslog, c.flagLogFile, c.flagLogVerbose, c.flagLogDebug, c.flagLogFormat == "json", events.NewEventHandler())
 	if err != nil {
 		return err
 	}
@@ -76,6 +82,7 @@ func main() {
 	app.PersistentFlags().BoolVar(&globalCmd.flagVersion, "version", false, "Print version number")
 	app.PersistentFlags().BoolVarP(&globalCmd.flagHelp, "help", "h", false, "Print help")
 	app.PersistentFlags().StringVar(&globalCmd.flagLogFile, "logfile", "", "Path to the log file"+"``")
+	app.PersistentFlags().StringVar(&globalCmd.flagLogFormat, "logformat", "text", "Format of the log messages (text or json)"+"``")
 	app.PersistentFlags().BoolVar(&globalCmd.flagLogSyslog, "syslog", false, "Log to syslog")
 	app.PersistentFlags().StringArrayVar(&globalCmd.flagLogTrace, "trace", []string{}, "Log tracing targets"+"``")
 	app.PersistentFlags().BoolVarP(&globalCmd.flagLogDebug, "debug", "d", false, "Show all debug messages")
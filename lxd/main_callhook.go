@@ -72,10 +72,11 @@ func (c *cmdCallhook) Run(cmd *cobra.Command, args []string) error {
 	if state == "stopns" {
 		target = os.Getenv("LXC_TARGET")
 		netns := os.Getenv("LXC_NET_NS")
+		userns := os.Getenv("LXC_USER_NS")
 		if target == "" {
 			target = "unknown"
 		}
-		url = fmt.Sprintf("%s?target=%s&netns=%s", url, target, netns)
+		url = fmt.Sprintf("%s?target=%s&netns=%s&userns=%s", url, target, netns, userns)
 	} else if state == "stop" {
 		target = os.Getenv("LXC_TARGET")
 		if target == "" {
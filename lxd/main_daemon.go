@@ -78,14 +78,19 @@ func (c *cmdDaemon) Run(cmd *cobra.Command, args []string) error {
 	case sig := <-ch:
 		if sig == unix.SIGPWR {
 			logger.Infof("Received '%s signal', shutting down containers", sig)
+			d.Drain()
 			containersShutdown(s)
 			networkShutdown(s)
+		} else if sig == unix.SIGTERM {
+			logger.Infof("Received '%s signal', draining operations and exiting", sig)
+			d.Drain()
 		} else {
 			logger.Infof("Received '%s signal', exiting", sig)
 		}
 
 	case <-d.shutdownChan:
 		logger.Infof("Asked to shutdown by API, shutting down containers")
+		d.Drain()
 		d.Kill()
 		containersShutdown(s)
 		networkShutdown(s)
@@ -443,7 +443,7 @@ func (c *cmdForkDNS) Run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Missing required arguments")
 	}
 
-	log, err := logging.GetLogger("lxd-forkdns", "", false, false, nil)
+	log, err := logging.GetLogger("lxd-forkdns", "", false, false, false, nil)
 	if err != nil {
 		return err
 	}
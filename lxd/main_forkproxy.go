@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
@@ -13,6 +14,8 @@ import (
 	"unsafe"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 	"golang.org/x/sys/unix"
 
 	"github.com/lxc/lxd/lxd/device"
@@ -306,17 +309,6 @@ type cmdForkproxy struct {
 	global *cmdGlobal
 }
 
-// UDP session tracking (map "client tuple" to udp session)
-var udpSessions = map[string]*udpSession{}
-var udpSessionsLock sync.Mutex
-
-type udpSession struct {
-	client    net.Addr
-	target    net.Conn
-	timer     *time.Timer
-	timerLock sync.Mutex
-}
-
 func (c *cmdForkproxy) Command() *cobra.Command {
 	// Main subcommand
 	cmd := &cobra.Command{}
@@ -335,49 +327,7 @@ func (c *cmdForkproxy) Command() *cobra.Command {
 	return cmd
 }
 
-func rearmUDPFd(epFd C.int, connFd C.int) {
-	var ev C.struct_epoll_event
-	ev.events = C.EPOLLIN | C.EPOLLONESHOT
-	*(*C.int)(unsafe.Pointer(uintptr(unsafe.Pointer(&ev)) + unsafe.Sizeof(ev.events))) = connFd
-	ret := C.epoll_ctl(epFd, C.EPOLL_CTL_MOD, connFd, &ev)
-	if ret < 0 {
-		fmt.Printf("Error: Failed to add listener fd to epoll instance\n")
-	}
-}
-
-func listenerInstance(epFd C.int, lAddr *device.ProxyAddress, cAddr *device.ProxyAddress, connFd C.int, lStruct *lStruct, proxy bool) error {
-	if lAddr.ConnType == "udp" {
-		// This only handles udp <-> udp. The C constructor will have
-		// verified this before.
-		go func() {
-			// single or multiple port -> single port
-			connectAddr := cAddr.Addr[0]
-			if len(cAddr.Addr) > 1 {
-				// multiple port -> multiple port
-				connectAddr = cAddr.Addr[(*lStruct).lAddrIndex]
-			}
-
-			srcConn, err := net.FileConn((*lStruct).f)
-			if err != nil {
-				fmt.Printf("Warning: Failed to re-assemble listener: %s\n", err)
-				rearmUDPFd(epFd, connFd)
-				return
-			}
-
-			dstConn, err := net.Dial(cAddr.ConnType, connectAddr)
-			if err != nil {
-				fmt.Printf("Warning: Failed to connect to target: %v\n", err)
-				rearmUDPFd(epFd, connFd)
-				return
-			}
-
-			genericRelay(srcConn, dstConn, true)
-			rearmUDPFd(epFd, connFd)
-		}()
-
-		return nil
-	}
-
+func listenerInstance(lAddr *device.ProxyAddress, cAddr *device.ProxyAddress, lStruct *lStruct, proxy bool) error {
 	// Accept a new client
 	listener := (*lStruct).lConn
 	srcConn, err := (*listener).Accept()
@@ -386,12 +336,7 @@ func listenerInstance(epFd C.int, lAddr *device.ProxyAddress, cAddr *device.Prox
 		return err
 	}
 
-	// single or multiple port -> single port
-	connectAddr := cAddr.Addr[0]
-	if lAddr.ConnType != "unix" && cAddr.ConnType != "unix" && len(cAddr.Addr) > 1 {
-		// multiple port -> multiple port
-		connectAddr = cAddr.Addr[(*lStruct).lAddrIndex]
-	}
+	connectAddr := device.ProxyConnectAddr(cAddr, (*lStruct).lAddrIndex)
 	dstConn, err := net.Dial(cAddr.ConnType, connectAddr)
 	if err != nil {
 		srcConn.Close()
@@ -429,17 +374,14 @@ func listenerInstance(epFd C.int, lAddr *device.ProxyAddress, cAddr *device.Prox
 		// Handle OOB if both src and dst are using unix sockets
 		go unixRelay(srcConn, dstConn)
 	} else {
-
-		go genericRelay(srcConn, dstConn, false)
+		go genericRelay(srcConn, dstConn)
 	}
 
 	return nil
 }
 
 type lStruct struct {
-	f          *os.File
 	lConn      *net.Listener
-	udpConn    *net.Conn
 	lAddrIndex int
 }
 
@@ -478,11 +420,9 @@ func (c *cmdForkproxy) Run(cmd *cobra.Command, args []string) error {
 	}
 
 	if (lAddr.ConnType == "udp" || lAddr.ConnType == "tcp") && cAddr.ConnType == "udp" || cAddr.ConnType == "tcp" {
-		err := fmt.Errorf("Invalid port range")
-		if len(lAddr.Addr) > 1 && len(cAddr.Addr) > 1 && (len(cAddr.Addr) != len(lAddr.Addr)) {
-			fmt.Println(err)
-			return err
-		} else if len(lAddr.Addr) == 1 && len(cAddr.Addr) > 1 {
+		// The ports of each listen address map to the connect ports in order.
+		if len(cAddr.Addr) > len(lAddr.Addr) || len(lAddr.Addr)%len(cAddr.Addr) != 0 {
+			err := fmt.Errorf("Invalid port range")
 			fmt.Println(err)
 			return err
 		}
@@ -585,16 +525,18 @@ func (c *cmdForkproxy) Run(cmd *cobra.Command, args []string) error {
 	}
 	unix.Close(forkproxyUDSSockFDNum)
 
-	var listenerMap map[int]*lStruct
-
 	isUDPListener := lAddr.ConnType == "udp"
-	listenerMap = make(map[int]*lStruct, len(lAddr.Addr))
+	listenerMap := make(map[int]*lStruct, len(lAddr.Addr))
+	udpListeners := []*net.UDPConn{}
 	if isUDPListener {
-		for i, f := range files {
-			listenerMap[int(f.Fd())] = &lStruct{
-				f:          f,
-				lAddrIndex: i,
+		for _, f := range files {
+			conn, err := net.FilePacketConn(f)
+			if err != nil {
+				fmt.Printf("Error: Failed to re-assemble listener: %v\n", err)
+				return err
 			}
+
+			udpListeners = append(udpListeners, conn.(*net.UDPConn))
 		}
 	} else {
 		for i, f := range files {
@@ -657,26 +599,38 @@ func (c *cmdForkproxy) Run(cmd *cobra.Command, args []string) error {
 		}
 		unix.Close(int(epFd))
 
-		if !isUDPListener {
-			for _, l := range listenerMap {
-				conn := (*l).lConn
-				(*conn).Close()
-			}
+		for _, l := range listenerMap {
+			conn := (*l).lConn
+			(*conn).Close()
+		}
+
+		for _, conn := range udpListeners {
+			conn.Close()
 		}
 
 		unix.Kill(self, unix.SIGKILL)
 	}()
 	defer unix.Kill(self, unix.SIGTERM)
 
-	for _, f := range files {
+	// UDP listeners are served by their own relays rather than the epoll loop below, reading and
+	// writing datagrams in batches.
+	for i, conn := range udpListeners {
+		p := &udpProxy{
+			listener:    conn,
+			connectAddr: device.ProxyConnectAddr(cAddr, i),
+			proxy:       args[11] == "true",
+			sessions:    map[string]*udpSession{},
+		}
+
+		go p.run()
+	}
+
+	for fd := range listenerMap {
 		var ev C.struct_epoll_event
 		ev.events = C.EPOLLIN
-		if isUDPListener {
-			ev.events |= C.EPOLLONESHOT
-		}
 
-		*(*C.int)(unsafe.Pointer(&ev.data)) = C.int(f.Fd())
-		ret := C.epoll_ctl(epFd, C.EPOLL_CTL_ADD, C.int(f.Fd()), &ev)
+		*(*C.int)(unsafe.Pointer(&ev.data)) = C.int(fd)
+		ret := C.epoll_ctl(epFd, C.EPOLL_CTL_ADD, C.int(fd), &ev)
 		if ret < 0 {
 			return fmt.Errorf("Error: Failed to add listener fd to epoll instance")
 		}
@@ -701,7 +655,7 @@ func (c *cmdForkproxy) Run(cmd *cobra.Command, args []string) error {
 				continue
 			}
 
-			err := listenerInstance(epFd, lAddr, cAddr, curFd, srcConn, args[11] == "true")
+			err := listenerInstance(lAddr, cAddr, srcConn, args[11] == "true")
 			if err != nil {
 				fmt.Printf("Warning: Failed to prepare new listener instance: %s\n", err)
 			}
@@ -715,60 +669,10 @@ func (c *cmdForkproxy) Run(cmd *cobra.Command, args []string) error {
 func proxyCopy(dst net.Conn, src net.Conn) error {
 	var err error
 
-	// Attempt casting to UDP connections
-	srcUdp, srcIsUdp := src.(*net.UDPConn)
-	dstUdp, dstIsUdp := dst.(*net.UDPConn)
-
 	buf := make([]byte, 32*1024)
 	for {
 	rAgain:
-		var nr int
-		var er error
-
-		if srcIsUdp && srcUdp.RemoteAddr() == nil {
-			var addr net.Addr
-			nr, addr, er = srcUdp.ReadFrom(buf)
-			if er == nil {
-				// Look for existing UDP session
-				udpSessionsLock.Lock()
-				us, ok := udpSessions[addr.String()]
-				udpSessionsLock.Unlock()
-
-				if !ok {
-					dc, err := net.Dial(dst.RemoteAddr().Network(), dst.RemoteAddr().String())
-					if err != nil {
-						return err
-					}
-
-					us = &udpSession{
-						client: addr,
-						target: dc,
-					}
-
-					udpSessionsLock.Lock()
-					udpSessions[addr.String()] = us
-					udpSessionsLock.Unlock()
-
-					go proxyCopy(src, dc)
-					us.timer = time.AfterFunc(30*time.Minute, func() {
-						us.target.Close()
-
-						udpSessionsLock.Lock()
-						delete(udpSessions, addr.String())
-						udpSessionsLock.Unlock()
-					})
-				}
-
-				us.timerLock.Lock()
-				us.timer.Reset(30 * time.Minute)
-				us.timerLock.Unlock()
-
-				dst = us.target
-				dstUdp, dstIsUdp = dst.(*net.UDPConn)
-			}
-		} else {
-			nr, er = src.Read(buf)
-		}
+		nr, er := src.Read(buf)
 
 		// keep retrying on EAGAIN
 		errno, ok := shared.GetErrno(er)
@@ -778,33 +682,7 @@ func proxyCopy(dst net.Conn, src net.Conn) error {
 
 		if nr > 0 {
 		wAgain:
-			var nw int
-			var ew error
-
-			if dstIsUdp && dstUdp.RemoteAddr() == nil {
-				var us *udpSession
-
-				udpSessionsLock.Lock()
-				for _, v := range udpSessions {
-					if v.target.LocalAddr() == src.LocalAddr() {
-						us = v
-						break
-					}
-				}
-				udpSessionsLock.Unlock()
-
-				if us == nil {
-					return fmt.Errorf("Connection expired")
-				}
-
-				us.timerLock.Lock()
-				us.timer.Reset(30 * time.Minute)
-				us.timerLock.Unlock()
-
-				nw, ew = dstUdp.WriteTo(buf[0:nr], us.client)
-			} else {
-				nw, ew = dst.Write(buf[0:nr])
-			}
+			nw, ew := dst.Write(buf[0:nr])
 
 			// keep retrying on EAGAIN
 			errno, ok := shared.GetErrno(ew)
@@ -833,7 +711,7 @@ func proxyCopy(dst net.Conn, src net.Conn) error {
 	return err
 }
 
-func genericRelay(dst net.Conn, src net.Conn, timeout bool) {
+func genericRelay(dst net.Conn, src net.Conn) {
 	relayer := func(src net.Conn, dst net.Conn, ch chan error) {
 		ch <- proxyCopy(src, dst)
 		close(ch)
@@ -843,11 +721,7 @@ func genericRelay(dst net.Conn, src net.Conn, timeout bool) {
 	chRecv := make(chan error)
 
 	go relayer(src, dst, chRecv)
-
-	_, isUDP := dst.(*net.UDPConn)
-	if !isUDP {
-		go relayer(dst, src, chSend)
-	}
+	go relayer(dst, src, chSend)
 
 	select {
 	case errSnd := <-chSend:
@@ -865,12 +739,235 @@ func genericRelay(dst net.Conn, src net.Conn, timeout bool) {
 	dst.Close()
 
 	// Empty the channels
-	if !isUDP {
-		<-chSend
-	}
+	<-chSend
 	<-chRecv
 }
 
+// udpBatchSize is the number of datagrams read or written in a single system call.
+const udpBatchSize = 16
+
+// udpSessionTimeout is how long a UDP session is kept around without any traffic.
+const udpSessionTimeout = 30 * time.Minute
+
+// udpBatchConn is a UDP socket that reads and writes datagrams in batches (recvmmsg/sendmmsg).
+type udpBatchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+func newUDPBatchConn(conn *net.UDPConn) udpBatchConn {
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if ok && addr.IP.To4() != nil {
+		return ipv4.NewPacketConn(conn)
+	}
+
+	return ipv6.NewPacketConn(conn)
+}
+
+func newUDPMessages() []ipv4.Message {
+	ms := make([]ipv4.Message, udpBatchSize)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, 32*1024)}
+	}
+
+	return ms
+}
+
+// writeUDPBatch writes all the datagrams, using as few system calls as possible.
+func writeUDPBatch(conn udpBatchConn, ms []ipv4.Message) error {
+	for len(ms) > 0 {
+		n, err := conn.WriteBatch(ms, 0)
+		if err != nil {
+			return err
+		}
+
+		ms = ms[n:]
+	}
+
+	return nil
+}
+
+// udpSession tracks a client of a UDP listener, along with the socket used to forward its
+// datagrams so that replies can be routed back to it.
+type udpSession struct {
+	client    net.Addr
+	conn      *net.UDPConn
+	target    udpBatchConn
+	header    []byte
+	timer     *time.Timer
+	timerLock sync.Mutex
+}
+
+func (us *udpSession) touch() {
+	us.timerLock.Lock()
+	us.timer.Reset(udpSessionTimeout)
+	us.timerLock.Unlock()
+}
+
+// udpProxy relays the datagrams received on a UDP listener to the connect address.
+type udpProxy struct {
+	listener     *net.UDPConn
+	connectAddr  string
+	proxy        bool
+	sessions     map[string]*udpSession
+	sessionsLock sync.Mutex
+}
+
+func (p *udpProxy) run() {
+	listener := newUDPBatchConn(p.listener)
+	ms := newUDPMessages()
+
+	for {
+		n, err := listener.ReadBatch(ms, 0)
+		if err != nil {
+			fmt.Printf("Warning: Failed to read from listener: %v\n", err)
+			return
+		}
+
+		// Group the datagrams by client so that each session is written to in one batch.
+		batches := map[*udpSession][]ipv4.Message{}
+		for _, m := range ms[:n] {
+			us, err := p.session(listener, m.Addr)
+			if err != nil {
+				fmt.Printf("Warning: Failed to connect to target: %v\n", err)
+				continue
+			}
+
+			buffers := [][]byte{m.Buffers[0][:m.N]}
+			if us.header != nil {
+				buffers = [][]byte{us.header, m.Buffers[0][:m.N]}
+			}
+
+			batches[us] = append(batches[us], ipv4.Message{Buffers: buffers})
+		}
+
+		for us, batch := range batches {
+			err := writeUDPBatch(us.target, batch)
+			if err != nil {
+				fmt.Printf("Warning: Error while sending data: %v\n", err)
+			}
+		}
+	}
+}
+
+// session returns the session of the given client, creating it if needed.
+func (p *udpProxy) session(listener udpBatchConn, client net.Addr) (*udpSession, error) {
+	key := client.String()
+
+	p.sessionsLock.Lock()
+	us, ok := p.sessions[key]
+	p.sessionsLock.Unlock()
+	if ok {
+		us.touch()
+		return us, nil
+	}
+
+	conn, err := net.Dial("udp", p.connectAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	us = &udpSession{
+		client: client,
+		conn:   conn.(*net.UDPConn),
+	}
+	us.target = newUDPBatchConn(us.conn)
+
+	if p.proxy {
+		us.header = proxyProtocolV2Header(client.(*net.UDPAddr), p.listener.LocalAddr().(*net.UDPAddr))
+	}
+
+	us.timer = time.AfterFunc(udpSessionTimeout, func() {
+		p.expire(key, us)
+	})
+
+	p.sessionsLock.Lock()
+	p.sessions[key] = us
+	p.sessionsLock.Unlock()
+
+	go p.relayReplies(listener, key, us)
+
+	return us, nil
+}
+
+// relayReplies sends the datagrams received from the target back to the client of the session.
+func (p *udpProxy) relayReplies(listener udpBatchConn, key string, us *udpSession) {
+	defer p.expire(key, us)
+
+	ms := newUDPMessages()
+
+	for {
+		n, err := us.target.ReadBatch(ms, 0)
+		if err != nil {
+			return
+		}
+
+		us.touch()
+
+		replies := make([]ipv4.Message, n)
+		for i, m := range ms[:n] {
+			replies[i] = ipv4.Message{
+				Buffers: [][]byte{m.Buffers[0][:m.N]},
+				Addr:    us.client,
+			}
+		}
+
+		err = writeUDPBatch(listener, replies)
+		if err != nil {
+			fmt.Printf("Warning: Error while sending data: %v\n", err)
+		}
+	}
+}
+
+// expire removes the session, closing its socket.
+func (p *udpProxy) expire(key string, us *udpSession) {
+	p.sessionsLock.Lock()
+	if p.sessions[key] == us {
+		delete(p.sessions, key)
+	}
+	p.sessionsLock.Unlock()
+
+	us.timerLock.Lock()
+	us.timer.Stop()
+	us.timerLock.Unlock()
+
+	us.conn.Close()
+}
+
+// proxyProtocolV2Header returns the binary PROXY protocol header describing datagrams sent by src
+// to dst. Unlike the text based version 1 of the protocol, it supports UDP, in which case it is
+// prepended to every datagram.
+func proxyProtocolV2Header(src *net.UDPAddr, dst *net.UDPAddr) []byte {
+	header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// Version 2, PROXY command.
+	header = append(header, 0x21)
+
+	srcIP := src.IP.To4()
+	dstIP := dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		// AF_INET over SOCK_DGRAM.
+		header = append(header, 0x12)
+	} else {
+		// AF_INET6 over SOCK_DGRAM.
+		header = append(header, 0x22)
+		srcIP = src.IP.To16()
+		dstIP = dst.IP.To16()
+	}
+
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dst.Port))
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(srcIP)+len(dstIP)+len(ports)))
+
+	header = append(header, length...)
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	return append(header, ports...)
+}
+
 func unixRelayer(src *net.UnixConn, dst *net.UnixConn, ch chan error) {
 	dataBuf := make([]byte, 4096)
 	oobBuf := make([]byte, 4096)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -165,6 +166,40 @@ func TestParseAddr(t *testing.T) {
 			nil,
 			true,
 		},
+		// Multiple addresses testing
+		{
+			"Multiple addresses",
+			"tcp:127.0.0.1:2000,2002,tcp:[::1]:2000,2002",
+			&device.ProxyAddress{
+				ConnType: "tcp",
+				Addr: []string{
+					"127.0.0.1:2000",
+					"127.0.0.1:2002",
+					"[::1]:2000",
+					"[::1]:2002",
+				},
+				Abstract: false,
+			},
+			false,
+		},
+		{
+			"Multiple addresses with different connection types",
+			"tcp:127.0.0.1:2000,udp:127.0.0.1:2000",
+			nil,
+			true,
+		},
+		{
+			"Multiple addresses with different numbers of ports",
+			"tcp:127.0.0.1:2000,tcp:[::1]:2000-2001",
+			nil,
+			true,
+		},
+		{
+			"Duplicate addresses",
+			"tcp:127.0.0.1:2000,tcp:127.0.0.1:2000",
+			nil,
+			true,
+		},
 	}
 
 	for i, tt := range tests {
@@ -179,3 +214,21 @@ func TestParseAddr(t *testing.T) {
 		require.Equal(t, tt.expected, addr)
 	}
 }
+
+func TestProxyProtocolV2Header(t *testing.T) {
+	src := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5353}
+	dst := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 53}
+
+	header := proxyProtocolV2Header(src, dst)
+	require.Equal(t, []byte("\r\n\r\n\x00\r\nQUIT\n"), header[:12])
+	require.Equal(t, []byte{0x21, 0x12, 0, 12}, header[12:16])
+	require.Equal(t, []byte{10, 0, 0, 1, 10, 0, 0, 2, 0x14, 0xe9, 0, 53}, header[16:])
+
+	// IPv4 clients of an IPv6 listener are described using IPv6 addresses.
+	dst = &net.UDPAddr{IP: net.ParseIP("::"), Port: 53}
+
+	header = proxyProtocolV2Header(src, dst)
+	require.Equal(t, []byte{0x21, 0x22, 0, 36}, header[12:16])
+	require.Equal(t, net.ParseIP("10.0.0.1").To16(), net.IP(header[16:32]))
+	require.Len(t, header, 52)
+}
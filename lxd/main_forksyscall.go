@@ -23,6 +23,7 @@ import (
 #include <sys/stat.h>
 #include <sys/types.h>
 #include <sys/vfs.h>
+#include <sys/wait.h>
 #include <sys/xattr.h>
 #include <unistd.h>
 
@@ -404,6 +405,21 @@ static void mount_emulate(void)
 	if (mnt_fd < 0)
 		_exit(EXIT_FAILURE);
 
+	// overlayfs performs copy-ups with the credentials of whoever mounted
+	// it, so mount it as the container's root user rather than as the
+	// host's.
+	if (strcmp(fstype, "overlay") == 0) {
+		attach_userns(pid);
+
+		if (!acquire_basic_creds(pid))
+			_exit(EXIT_FAILURE);
+
+		if (mount(source, target, fstype, flags, data) < 0)
+			_exit(EXIT_FAILURE);
+
+		return;
+	}
+
 	if (!acquire_basic_creds(pid))
 		_exit(EXIT_FAILURE);
 
@@ -489,6 +505,53 @@ static void mount_emulate(void)
 	}
 }
 
+// Expects command line to be in the form:
+// <PID> <source> <target> <fuse binary> [<data>]
+static void fuse_emulate(void)
+{
+	char *source = NULL, *target = NULL, *binary = NULL, *data = NULL;
+	pid_t pid = -1, child;
+	int status;
+
+	pid = atoi(advance_arg(true));
+	source = advance_arg(true);
+	target = advance_arg(true);
+	binary = advance_arg(true);
+	data = advance_arg(false);
+
+	// Run the FUSE binary as the container's root user, in the
+	// container's namespaces, so that it's subject to the same
+	// restrictions as the rest of the container.
+	attach_userns(pid);
+
+	if (dosetns(pid, "ipc") < 0 || dosetns(pid, "uts") < 0 ||
+	    dosetns(pid, "net") < 0 || dosetns(pid, "pid") < 0)
+		_exit(EXIT_FAILURE);
+
+	if (!acquire_basic_creds(pid))
+		_exit(EXIT_FAILURE);
+
+	// Joining the PID namespace only applies to children.
+	child = fork();
+	if (child < 0)
+		_exit(EXIT_FAILURE);
+
+	if (child == 0) {
+		if (data && strcmp(data, "") != 0)
+			execlp(binary, binary, source, target, "-o", data, (char *)NULL);
+		else
+			execlp(binary, binary, source, target, (char *)NULL);
+
+		_exit(EXIT_FAILURE);
+	}
+
+	if (waitpid(child, &status, 0) < 0)
+		_exit(EXIT_FAILURE);
+
+	if (!WIFEXITED(status) || WEXITSTATUS(status) != 0)
+		_exit(EXIT_FAILURE);
+}
+
 void forksyscall(void)
 {
 	char *syscall = NULL;
@@ -510,6 +573,8 @@ void forksyscall(void)
 		setxattr_emulate();
 	else if (strcmp(syscall, "mount") == 0)
 		mount_emulate();
+	else if (strcmp(syscall, "fuse") == 0)
+		fuse_emulate();
 	else
 		_exit(EXIT_FAILURE);
 
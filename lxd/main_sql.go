@@ -9,8 +9,10 @@ import (
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 
 	"github.com/lxc/lxd/client"
+	dbquery "github.com/lxc/lxd/lxd/db/query"
 	"github.com/lxc/lxd/shared"
 )
 
@@ -44,6 +46,11 @@ func (c *cmdSql) Command() *cobra.Command {
   If <query> is the special value ".schema", the the command returns the SQL
   text schema of the given database.
 
+  If <query> is the special value ".trace", the command returns the
+  statistics and slow queries gathered since the tracing of the global
+  database was enabled with core.debug_database_trace, while ".trace-reset"
+  clears them.
+
   This internal command is mostly useful for debugging and disaster
   recovery. The LXD team will occasionally provide hotfixes to users as a
   set of database queries to fix some data inconsistency.
@@ -113,6 +120,40 @@ func (c *cmdSql) Run(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	if query == ".trace" || query == ".trace-reset" {
+		if database != "global" {
+			return fmt.Errorf("Only the global database can be traced")
+		}
+
+		if query == ".trace-reset" {
+			_, _, err := d.RawQuery("DELETE", "/internal/sql/trace", nil, "")
+			if err != nil {
+				return errors.Wrap(err, "failed to reset the trace")
+			}
+
+			return nil
+		}
+
+		response, _, err := d.RawQuery("GET", "/internal/sql/trace", nil, "")
+		if err != nil {
+			return errors.Wrap(err, "failed to request trace")
+		}
+
+		stats := dbquery.TraceStats{}
+		err = json.Unmarshal(response.Metadata, &stats)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse trace response")
+		}
+
+		out, err := yaml.Marshal(&stats)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s", out)
+		return nil
+	}
+
 	data := internalSQLQuery{
 		Database: database,
 		Query:    query,
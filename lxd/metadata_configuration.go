@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/response"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+)
+
+var metadataConfigurationCmd = APIEndpoint{
+	Path: "metadata/configuration",
+
+	Get: APIEndpointAction{Handler: metadataConfigurationGet, AccessHandler: AllowAuthenticated},
+}
+
+func metadataConfigurationGet(d *Daemon, r *http.Request) response.Response {
+	volumeKeys := []string{}
+	for key := range storagePools.StorageVolumeConfigKeys {
+		volumeKeys = append(volumeKeys, key)
+	}
+
+	metadata := api.MetadataConfiguration{
+		Instance:      configKeysSchema(validatorKeys(shared.KnownContainerConfigKeys), instanceConfigKeysSchema, shared.KnownContainerConfigKeys),
+		StoragePool:   configKeysSchema(validatorKeys(storagePoolConfigKeys), storagePoolConfigKeysSchema, storagePoolConfigKeys),
+		StorageVolume: configKeysSchema(volumeKeys, storageVolumeConfigKeysSchema, nil),
+		Network:       configKeysSchema(validatorKeys(networkConfigKeys), networkConfigKeysSchema, networkConfigKeys),
+		Project:       configKeysSchema(validatorKeys(projectConfigKeys), projectConfigKeysSchema, projectConfigKeys),
+	}
+
+	return response.SyncResponse(true, metadata)
+}
+
+// Returns the keys of a map of config key validators.
+func validatorKeys(validators map[string]func(value string) error) []string {
+	keys := []string{}
+	for key := range validators {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Returns the schema of the given valid keys, along with the documented keys matching a set of
+// keys (e.g. "user.*"). Internal volatile keys are left out.
+func configKeysSchema(keys []string, documented map[string]api.ConfigKeySchema, validators map[string]func(value string) error) map[string]api.ConfigKeySchema {
+	schema := map[string]api.ConfigKeySchema{}
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, "volatile.") {
+			continue
+		}
+
+		entry, ok := documented[key]
+		if !ok {
+			entry = api.ConfigKeySchema{Type: configKeyType(validators[key])}
+		}
+
+		schema[key] = entry
+	}
+
+	for key, entry := range documented {
+		if strings.Contains(key, "*") {
+			schema[key] = entry
+		}
+	}
+
+	return schema
+}
+
+// Guesses the type of an undocumented key from its validator.
+func configKeyType(validator func(value string) error) string {
+	if validator == nil {
+		return "string"
+	}
+
+	ptr := reflect.ValueOf(validator).Pointer()
+	switch ptr {
+	case reflect.ValueOf(shared.IsBool).Pointer():
+		return "boolean"
+	case reflect.ValueOf(shared.IsInt64).Pointer(), reflect.ValueOf(shared.IsUint8).Pointer(), reflect.ValueOf(shared.IsUint32).Pointer(), reflect.ValueOf(shared.IsPriority).Pointer():
+		return "integer"
+	}
+
+	return "string"
+}
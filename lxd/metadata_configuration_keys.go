@@ -0,0 +1,192 @@
+package main
+
+import (
+	"github.com/lxc/lxd/shared/api"
+)
+
+// The schemas below describe the documented configuration keys. Keys missing from them are still
+// part of the schema exposed through the API, with their type guessed from their validator.
+
+// Schema of the instance configuration keys.
+var instanceConfigKeysSchema = map[string]api.ConfigKeySchema{
+	"boot.autostart":                            {Type: "boolean", LiveUpdate: "n/a", Description: "Always start the container when LXD starts (if not set, restore last state)"},
+	"boot.autostart.delay":                      {Type: "integer", Default: "0", LiveUpdate: "n/a", Description: "Number of seconds to wait after the container started before starting the next one"},
+	"boot.autostart.priority":                   {Type: "integer", Default: "0", LiveUpdate: "n/a", Description: "What order to start the containers in (starting with highest)"},
+	"boot.host_shutdown_timeout":                {Type: "integer", Default: "30", LiveUpdate: "yes", Description: "Seconds to wait for container to shutdown before it is force stopped"},
+	"boot.stop.priority":                        {Type: "integer", Default: "0", LiveUpdate: "n/a", Description: "What order to shutdown the containers (starting with highest)"},
+	"compaction.schedule":                       {Type: "string", LiveUpdate: "no", Description: "Cron expression (`<minute> <hour> <dom> <month> <dow>`) of when to reclaim the space freed in the disks of a virtual machine"},
+	"environment.*":                             {Type: "string", LiveUpdate: "yes", Description: "key/value environment variables to export to the container and set on exec"},
+	"hooks.post_snapshot":                       {Type: "string", LiveUpdate: "yes", Description: "Host command run after a snapshot of the container is created (binary must be listed in `core.hooks_allowed`)"},
+	"hooks.post_stop":                           {Type: "string", LiveUpdate: "yes", Description: "Host command run after the container stopped (binary must be listed in `core.hooks_allowed`)"},
+	"hooks.pre_start":                           {Type: "string", LiveUpdate: "yes", Description: "Host command run before the container starts, a failure aborts the start (binary must be listed in `core.hooks_allowed`)"},
+	"limits.cpu":                                {Type: "string", LiveUpdate: "yes", Description: "Number or range of CPUs to expose to the container"},
+	"limits.cpu.allowance":                      {Type: "string", Default: "100%", LiveUpdate: "yes", Description: "How much of the CPU can be used. Can be a percentage (e.g. 50%) for a soft limit or hard a chunk of time (25ms/100ms)"},
+	"limits.cpu.priority":                       {Type: "integer", Default: "10", LiveUpdate: "yes", Description: "CPU scheduling priority compared to other containers sharing the same CPUs (overcommit) (integer between 0 and 10)"},
+	"limits.disk.priority":                      {Type: "integer", Default: "5", LiveUpdate: "yes", Description: "When under load, how much priority to give to the container's I/O requests (integer between 0 and 10)"},
+	"limits.kernel.*":                           {Type: "string", LiveUpdate: "no", Description: "This limits kernel resources per container (e.g. number of open files)"},
+	"limits.memory":                             {Type: "string", LiveUpdate: "yes", Description: "Percentage of the host's memory or fixed value in bytes (various suffixes supported, see below)"},
+	"limits.memory.enforce":                     {Type: "string", Default: "hard", LiveUpdate: "yes", Description: "If hard, container can't exceed its memory limit. If soft, the container can exceed its memory limit when extra host memory is available."},
+	"limits.memory.swap":                        {Type: "boolean", Default: "true", LiveUpdate: "yes", Description: "Whether to allow some of the container's memory to be swapped out to disk"},
+	"limits.memory.swap.priority":               {Type: "integer", Default: "10", LiveUpdate: "yes", Description: "The higher this is set, the least likely the container is to be swapped to disk (integer between 0 and 10)"},
+	"limits.network.priority":                   {Type: "integer", Default: "0", LiveUpdate: "yes", Description: "When under load, how much priority to give to the container's network requests (integer between 0 and 10)"},
+	"limits.processes":                          {Type: "integer", LiveUpdate: "yes", Description: "Maximum number of processes that can run in the container"},
+	"linux.kernel_modules":                      {Type: "string", LiveUpdate: "yes", Description: "Comma separated list of kernel modules to load before starting the container"},
+	"migration.incremental.memory":              {Type: "boolean", Default: "false", LiveUpdate: "yes", Description: "Incremental memory transfer of the container's memory to reduce downtime."},
+	"migration.incremental.memory.goal":         {Type: "integer", Default: "70", LiveUpdate: "yes", Description: "Percentage of memory to have in sync before stopping the container."},
+	"migration.incremental.memory.iterations":   {Type: "integer", Default: "10", LiveUpdate: "yes", Description: "Maximum number of transfer operations to go through before stopping the container."},
+	"nvidia.driver.capabilities":                {Type: "string", Default: "compute,utility", LiveUpdate: "no", Description: "What driver capabilities the container needs (sets libnvidia-container NVIDIA_DRIVER_CAPABILITIES)"},
+	"nvidia.runtime":                            {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Pass the host NVIDIA and CUDA runtime libraries into the container"},
+	"nvidia.require.cuda":                       {Type: "string", LiveUpdate: "no", Description: "Version expression for the required CUDA version (sets libnvidia-container NVIDIA_REQUIRE_CUDA)"},
+	"nvidia.require.driver":                     {Type: "string", LiveUpdate: "no", Description: "Version expression for the required driver version (sets libnvidia-container NVIDIA_REQUIRE_DRIVER)"},
+	"raw.apparmor":                              {Type: "blob", LiveUpdate: "yes", Description: "Apparmor profile entries to be appended to the generated profile"},
+	"raw.idmap":                                 {Type: "blob", LiveUpdate: "no", Description: "Raw idmap configuration (e.g. \"both 1000 1000\")"},
+	"raw.lxc":                                   {Type: "blob", LiveUpdate: "no", Description: "Raw LXC configuration to be appended to the generated one"},
+	"raw.seccomp":                               {Type: "blob", LiveUpdate: "no", Description: "Raw Seccomp configuration"},
+	"security.devlxd":                           {Type: "boolean", Default: "true", LiveUpdate: "no", Description: "Controls the presence of /dev/lxd in the container"},
+	"security.devlxd.images":                    {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Controls the availability of the /1.0/images API over devlxd"},
+	"security.idmap.base":                       {Type: "integer", LiveUpdate: "no", Description: "The base host ID to use for the allocation (overrides auto-detection)"},
+	"security.idmap.isolated":                   {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Use an idmap for this container that is unique among containers with isolated set."},
+	"security.idmap.size":                       {Type: "integer", LiveUpdate: "no", Description: "The size of the idmap to use"},
+	"security.nesting":                          {Type: "boolean", Default: "false", LiveUpdate: "yes", Description: "Support running lxd (nested) inside the container"},
+	"security.privileged":                       {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Runs the container in privileged mode"},
+	"security.protection.delete":                {Type: "boolean", Default: "false", LiveUpdate: "yes", Description: "Prevents the container from being deleted"},
+	"security.protection.shift":                 {Type: "boolean", Default: "false", LiveUpdate: "yes", Description: "Prevents the container's filesystem from being uid/gid shifted on startup"},
+	"security.syscalls.blacklist":               {Type: "string", LiveUpdate: "no", Description: "A '\\n' separated list of syscalls to blacklist"},
+	"security.syscalls.blacklist_compat":        {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "On x86_64 this enables blocking of compat_* syscalls, it is a no-op on other arches"},
+	"security.syscalls.blacklist_default":       {Type: "boolean", Default: "true", LiveUpdate: "no", Description: "Enables the default syscall blacklist"},
+	"security.syscalls.intercept.mknod":         {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Handles the `mknod` and `mknodat` system calls (allows creation of a limited subset of char/block devices)"},
+	"security.syscalls.intercept.mknod.devices": {Type: "string", LiveUpdate: "yes", Description: "Specify a comma-separated list of additional character devices (`<major>:<minor>`) that processes inside the container may create."},
+	"security.syscalls.intercept.mount":         {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Handles the `mount` system call"},
+	"security.syscalls.intercept.mount.allowed": {Type: "string", LiveUpdate: "yes", Description: "Specify a comma-separated list of filesystems that are safe to mount for processes inside the container."},
+	"security.syscalls.intercept.mount.fuse":    {Type: "string", LiveUpdate: "yes", Description: "Specify a comma-separated list of `<filesystem>=<fuse binary>` mappings, to handle mounts of those filesystems with FUSE inside the container."},
+	"security.syscalls.intercept.mount.shift":   {Type: "boolean", Default: "false", LiveUpdate: "yes", Description: "Whether to mount shiftfs on top of filesystems handled through mount syscall interception."},
+	"security.syscalls.intercept.setxattr":      {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Handles the `setxattr` system call (allows setting a limited subset of restricted extended attributes)"},
+	"security.syscalls.whitelist":               {Type: "string", LiveUpdate: "no", Description: "A '\\n' separated list of syscalls to whitelist (mutually exclusive with security.syscalls.blacklist*)"},
+	"snapshots.schedule":                        {Type: "string", LiveUpdate: "no", Description: "Cron expression (`<minute> <hour> <dom> <month> <dow>`)"},
+	"snapshots.schedule.stopped":                {Type: "boolean", Default: "false", LiveUpdate: "no", Description: "Controls whether or not stopped containers are to be snapshoted automatically"},
+	"snapshots.pattern":                         {Type: "string", Default: "snap%d", LiveUpdate: "no", Description: "Pongo2 template string which represents the snapshot name (used for scheduled snapshots and unnamed snapshots)"},
+	"snapshots.expiry":                          {Type: "string", LiveUpdate: "no", Description: "Controls when snapshots are to be deleted (expects expression like `1M 2H 3d 4w 5m 6y`)"},
+	"snapshots.safety":                          {Type: "boolean", Default: "false", LiveUpdate: "yes", Description: "Controls whether a snapshot is automatically created before restoring a snapshot or remapping or changing the root disk of the instance"},
+	"snapshots.safety.expiry":                   {Type: "string", LiveUpdate: "yes", Description: "Controls when automatic safety snapshots are to be deleted (expects expression like `1M 2H 3d 4w 5m 6y`)"},
+	"user.*":                                    {Type: "string", LiveUpdate: "n/a", Description: "Free form user key/value storage (can be used in search)"},
+	"webhooks.events":                           {Type: "string", LiveUpdate: "n/a", Description: "Comma separated list of lifecycle events to send to the webhook (defaults to all)"},
+	"webhooks.url":                              {Type: "string", LiveUpdate: "n/a", Description: "HTTP(S) URL to which the lifecycle events of the container are posted (must match `core.webhooks_allowed`)"},
+}
+
+// Schema of the storage pool configuration keys.
+var storagePoolConfigKeysSchema = map[string]api.ConfigKeySchema{
+	"size":                            {Type: "string", Default: "0", Condition: "appropriate driver and source", Description: "Size of the storage pool in bytes (suffixes supported). (Currently valid for loop based pools and zfs.)"},
+	"source":                          {Type: "string", Description: "Path to block device or loop file or filesystem entry"},
+	"btrfs.mount_options":             {Type: "string", Default: "user_subvol_rm_allowed", Condition: "btrfs driver", Drivers: []string{"btrfs"}, Description: "Mount options for block devices"},
+	"ceph.cluster_name":               {Type: "string", Default: "ceph", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Name of the ceph cluster in which to create new storage pools."},
+	"ceph.osd.force_reuse":            {Type: "boolean", Default: "false", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Force using an osd storage pool that is already in use by another LXD instance."},
+	"ceph.osd.pg_num":                 {Type: "string", Default: "32", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Number of placement groups for the osd storage pool."},
+	"ceph.osd.pool_name":              {Type: "string", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Name of the osd storage pool."},
+	"ceph.osd.data_pool_name":         {Type: "string", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Name of the osd data pool."},
+	"ceph.rbd.clone_copy":             {Type: "string", Default: "true", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Whether to use RBD lightweight clones rather than full dataset copies."},
+	"ceph.rbd.flatten_clones":         {Type: "boolean", Default: "false", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Flatten in the background the clones still depending on deleted volumes and images, so that those can be removed."},
+	"ceph.rbd.namespaces":             {Type: "boolean", Default: "false", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "Isolate the instances of each project in their own RBD namespace, accessible with a dedicated cephx user."},
+	"ceph.user.name":                  {Type: "string", Default: "admin", Condition: "ceph driver", Drivers: []string{"ceph"}, Description: "The ceph user to use when creating storage pools and volumes."},
+	"cephfs.cluster_name":             {Type: "string", Default: "ceph", Condition: "cephfs driver", Drivers: []string{"cephfs"}, Description: "Name of the ceph cluster in which to create new storage pools."},
+	"cephfs.path":                     {Type: "string", Default: "/", Condition: "cephfs driver", Drivers: []string{"cephfs"}, Description: "The base path for the CEPHFS mount"},
+	"cephfs.user.name":                {Type: "string", Default: "admin", Condition: "cephfs driver", Drivers: []string{"cephfs"}, Description: "The ceph user to use when creating storage pools and volumes."},
+	"concurrency.volumes":             {Type: "integer", Default: "1", Description: "Number of volumes of the pool that operations working on many volumes (e.g. scheduled snapshots) process in parallel."},
+	"lvm.thinpool_autogrow":           {Type: "boolean", Default: "false", Condition: "lvm driver", Drivers: []string{"lvm"}, Description: "Grow the thin pool's data and metadata from the free space of the volume group when they're about to be full"},
+	"lvm.thinpool_autogrow.step":      {Type: "integer", Default: "20", Condition: "lvm driver", Drivers: []string{"lvm"}, Description: "Amount (in percent of their current size) by which the thin pool's data and metadata are grown"},
+	"lvm.thinpool_autogrow.threshold": {Type: "integer", Default: "80", Condition: "lvm driver", Drivers: []string{"lvm"}, Description: "Usage (in percent) of the thin pool's data or metadata above which they're grown, or a warning is emitted"},
+	"lvm.thinpool_name":               {Type: "string", Default: "LXDThinPool", Condition: "lvm driver", Drivers: []string{"lvm"}, Description: "Thin pool where images and containers are created."},
+	"lvm.use_thinpool":                {Type: "boolean", Default: "true", Condition: "lvm driver", Drivers: []string{"lvm"}, Description: "Whether the storage pool uses a thinpool for logical volumes."},
+	"lvm.vg_name":                     {Type: "string", Condition: "lvm driver", Drivers: []string{"lvm"}, Description: "Name of the volume group to create."},
+	"rsync.bwlimit":                   {Type: "string", Default: "0", Description: "Specifies the upper limit to be placed on the socket I/O whenever rsync or a send stream of the driver has to be used to transfer storage entities."},
+	"volatile.initial_source":         {Type: "string", Description: "Records the actual source passed during creating (e.g. /dev/sdb)."},
+	"volatile.pool.pristine":          {Type: "string", Default: "true", Description: "Whether the pool has been empty on creation time."},
+	"volume.block.filesystem":         {Type: "string", Default: "ext4", Condition: "block based driver (lvm)", Drivers: []string{"lvm"}, Description: "Filesystem to use for new volumes"},
+	"volume.block.mount_options":      {Type: "string", Default: "discard", Condition: "block based driver (lvm)", Drivers: []string{"lvm"}, Description: "Mount options for block devices"},
+	"volume.size":                     {Type: "string", Condition: "appropriate driver", Description: "Default volume size"},
+	"volume.zfs.delegate":             {Type: "boolean", Default: "false", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Delegate a child dataset of new containers to their user namespace"},
+	"volume.zfs.remove_snapshots":     {Type: "boolean", Default: "false", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Remove snapshots as needed"},
+	"volume.zfs.use_refquota":         {Type: "boolean", Default: "false", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Use refquota instead of quota for space."},
+	"watermark.act":                   {Type: "integer", Default: "95", Description: "Pool usage (in percent) above which the `watermark.actions` are taken"},
+	"watermark.actions":               {Type: "string", Description: "Comma separated list of actions to take above `watermark.act` (`snapshots` to pause scheduled snapshots, `volumes` to refuse new volumes and instances)"},
+	"watermark.warn":                  {Type: "integer", Default: "80", Description: "Pool usage (in percent) above which a warning is logged and emitted as an event"},
+	"zfs.clone_copy":                  {Type: "boolean", Default: "true", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Whether to use ZFS lightweight clones rather than full dataset copies."},
+	"zfs.pool_name":                   {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Name of the zpool"},
+	"zfs.promote_clones":              {Type: "boolean", Default: "false", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Promote in the background the clones still depending on deleted volumes and images, so that those can be removed."},
+}
+
+// Schema of the storage volume configuration keys.
+var storageVolumeConfigKeysSchema = map[string]api.ConfigKeySchema{
+	"size":                  {Type: "string", Condition: "appropriate driver", Description: "Size of the storage volume"},
+	"block.filesystem":      {Type: "string", Condition: "block based driver", Drivers: []string{"ceph", "lvm"}, Description: "Filesystem of the storage volume"},
+	"block.mount_options":   {Type: "string", Condition: "block based driver", Drivers: []string{"ceph", "lvm"}, Description: "Mount options for block devices"},
+	"security.certificates": {Type: "string", Condition: "custom volume", Description: "Comma separated list of the fingerprints of the client certificates allowed to attach the volume (defaults to all)"},
+	"security.projects":     {Type: "string", Condition: "custom volume", Description: "Comma separated list of the projects whose instances may attach the volume (defaults to all)"},
+	"security.shifted":      {Type: "boolean", Default: "false", Condition: "custom volume", Description: "Enable id shifting overlay (allows attach by multiple isolated containers)"},
+	"security.unmapped":     {Type: "boolean", Default: "false", Condition: "custom volume", Description: "Disable id mapping for the volume"},
+	"snapshots.expiry":      {Type: "string", Condition: "custom volume", Description: "Controls when snapshots are to be deleted (expects expression like `1M 2H 3d 4w 5m 6y`)"},
+	"snapshots.schedule":    {Type: "string", Condition: "custom volume", Description: "Cron expression (`<minute> <hour> <dom> <month> <dow>`)"},
+	"snapshots.pattern":     {Type: "string", Default: "snap%d", Condition: "custom volume", Description: "Pongo2 template string which represents the snapshot name (used for scheduled snapshots)"},
+	"volatile.uuid":         {Type: "string", Description: "Stable unique identifier of the volume (read-only)"},
+	"webhooks.events":       {Type: "string", Condition: "custom volume", Description: "Comma separated list of lifecycle events to send to the webhook (defaults to all)"},
+	"webhooks.url":          {Type: "string", Condition: "custom volume", Description: "HTTP(S) URL to which the lifecycle events of the volume are posted (must match `core.webhooks_allowed`)"},
+	"zfs.atime":             {Type: "boolean", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Value of the ZFS \"atime\" property of the dataset"},
+	"zfs.delegate":          {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Delegate a child dataset of the container to its user namespace"},
+	"zfs.logbias":           {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Value of the ZFS \"logbias\" property of the dataset (latency or throughput)"},
+	"zfs.recordsize":        {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Value of the ZFS \"recordsize\" property of the dataset (power of two between 512B and 16MiB)"},
+	"zfs.remove_snapshots":  {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Remove snapshots as needed"},
+	"zfs.sync":              {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Value of the ZFS \"sync\" property of the dataset (standard, always or disabled)"},
+	"zfs.use_refquota":      {Type: "string", Condition: "zfs driver", Drivers: []string{"zfs"}, Description: "Use refquota instead of quota for space"},
+}
+
+// Schema of the network configuration keys.
+var networkConfigKeysSchema = map[string]api.ConfigKeySchema{
+	"bridge.driver":              {Type: "string", Default: "native", Description: "Bridge driver (\"native\" or \"openvswitch\")"},
+	"bridge.external_interfaces": {Type: "string", Description: "Comma separate list of unconfigured network interfaces to include in the bridge"},
+	"bridge.hwaddr":              {Type: "string", Description: "MAC address for the bridge"},
+	"bridge.mode":                {Type: "string", Default: "standard", Description: "Bridge operation mode (\"standard\" or \"fan\")"},
+	"bridge.mtu":                 {Type: "integer", Default: "1500", Description: "Bridge MTU (default varies if tunnel or fan setup)"},
+	"dns.domain":                 {Type: "string", Default: "lxd", Description: "Domain to advertise to DHCP clients and use for DNS resolution"},
+	"dns.mode":                   {Type: "string", Default: "managed", Description: "DNS registration mode (\"none\" for no DNS record, \"managed\" for LXD generated static records or \"dynamic\" for client generated records)"},
+	"fan.overlay_subnet":         {Type: "string", Default: "240.0.0.0/8", Condition: "fan mode", Description: "Subnet to use as the overlay for the FAN (CIDR notation)"},
+	"fan.type":                   {Type: "string", Default: "vxlan", Condition: "fan mode", Description: "The tunneling type for the FAN (\"vxlan\" or \"ipip\")"},
+	"fan.underlay_subnet":        {Type: "string", Condition: "fan mode", Description: "Subnet to use as the underlay for the FAN (CIDR notation)"},
+	"ipv4.address":               {Type: "string", Condition: "standard mode", Description: "IPv4 address for the bridge (CIDR notation). Use \"none\" to turn off IPv4 or \"auto\" to generate a new one"},
+	"ipv4.dhcp":                  {Type: "boolean", Default: "true", Condition: "ipv4 address", Description: "Whether to allocate addresses using DHCP"},
+	"ipv4.dhcp.expiry":           {Type: "string", Default: "1h", Condition: "ipv4 dhcp", Description: "When to expire DHCP leases"},
+	"ipv4.dhcp.gateway":          {Type: "string", Condition: "ipv4 dhcp", Description: "Address of the gateway for the subnet"},
+	"ipv4.dhcp.ranges":           {Type: "string", Condition: "ipv4 dhcp", Description: "Comma separated list of IP ranges to use for DHCP (FIRST-LAST format)"},
+	"ipv4.firewall":              {Type: "boolean", Default: "true", Condition: "ipv4 address", Description: "Whether to generate filtering firewall rules for this network"},
+	"ipv4.nat":                   {Type: "boolean", Default: "false", Condition: "ipv4 address", Description: "Whether to NAT (will default to true if unset and a random ipv4.address is generated)"},
+	"ipv4.nat.order":             {Type: "string", Default: "before", Condition: "ipv4 address", Description: "Whether to add the required NAT rules before or after any pre-existing rules"},
+	"ipv4.nat.address":           {Type: "string", Condition: "ipv4 address", Description: "The source address used for outbound traffic from the bridge"},
+	"ipv4.routes":                {Type: "string", Condition: "ipv4 address", Description: "Comma separated list of additional IPv4 CIDR subnets to route to the bridge"},
+	"ipv4.routing":               {Type: "boolean", Default: "true", Condition: "ipv4 address", Description: "Whether to route traffic in and out of the bridge"},
+	"ipv6.address":               {Type: "string", Condition: "standard mode", Description: "IPv6 address for the bridge (CIDR notation). Use \"none\" to turn off IPv6 or \"auto\" to generate a new one"},
+	"ipv6.dhcp":                  {Type: "boolean", Default: "true", Condition: "ipv6 address", Description: "Whether to provide additional network configuration over DHCP"},
+	"ipv6.dhcp.expiry":           {Type: "string", Default: "1h", Condition: "ipv6 dhcp", Description: "When to expire DHCP leases"},
+	"ipv6.dhcp.ranges":           {Type: "string", Condition: "ipv6 stateful dhcp", Description: "Comma separated list of IPv6 ranges to use for DHCP (FIRST-LAST format)"},
+	"ipv6.dhcp.stateful":         {Type: "boolean", Default: "false", Condition: "ipv6 dhcp", Description: "Whether to allocate addresses using DHCP"},
+	"ipv6.firewall":              {Type: "boolean", Default: "true", Condition: "ipv6 address", Description: "Whether to generate filtering firewall rules for this network"},
+	"ipv6.nat":                   {Type: "boolean", Default: "false", Condition: "ipv6 address", Description: "Whether to NAT (will default to true if unset and a random ipv6.address is generated)"},
+	"ipv6.nat.order":             {Type: "string", Default: "before", Condition: "ipv6 address", Description: "Whether to add the required NAT rules before or after any pre-existing rules"},
+	"ipv6.nat.address":           {Type: "string", Condition: "ipv6 address", Description: "The source address used for outbound traffic from the bridge"},
+	"ipv6.routes":                {Type: "string", Condition: "ipv6 address", Description: "Comma separated list of additional IPv6 CIDR subnets to route to the bridge"},
+	"ipv6.routing":               {Type: "boolean", Default: "true", Condition: "ipv6 address", Description: "Whether to route traffic in and out of the bridge"},
+	"raw.dnsmasq":                {Type: "string", Description: "Additional dnsmasq configuration to append to the configuration"},
+	"tunnel.TARGET.group":        {Type: "string", Default: "239.0.0.1", Condition: "vxlan", Description: "Multicast address for vxlan (used if local and remote aren't set)"},
+	"tunnel.TARGET.id":           {Type: "integer", Default: "0", Condition: "vxlan", Description: "Specific tunnel ID to use for the vxlan tunnel"},
+	"tunnel.TARGET.interface":    {Type: "string", Condition: "vxlan", Description: "Specific host interface to use for the tunnel"},
+	"tunnel.TARGET.local":        {Type: "string", Condition: "gre or vxlan", Description: "Local address for the tunnel (not necessary for multicast vxlan)"},
+	"tunnel.TARGET.port":         {Type: "integer", Default: "0", Condition: "vxlan", Description: "Specific port to use for the vxlan tunnel"},
+	"tunnel.TARGET.protocol":     {Type: "string", Condition: "standard mode", Description: "Tunneling protocol (\"vxlan\" or \"gre\")"},
+	"tunnel.TARGET.remote":       {Type: "string", Condition: "gre or vxlan", Description: "Remote address for the tunnel (not necessary for multicast vxlan)"},
+	"tunnel.TARGET.ttl":          {Type: "integer", Default: "1", Condition: "vxlan", Description: "Specific TTL to use for multicast routing topologies"},
+}
+
+// Schema of the project configuration keys.
+var projectConfigKeysSchema = map[string]api.ConfigKeySchema{
+	"default.network":      {Type: "string", Description: "Network the instances get a NIC on when neither their devices nor their profiles have one"},
+	"default.storage.pool": {Type: "string", Description: "Storage pool the instances get their root disk on when neither their devices nor their profiles have one"},
+	"features.images":      {Type: "boolean", Default: "true", Description: "Separate set of images and image aliases for the project"},
+	"features.profiles":    {Type: "boolean", Default: "true", Description: "Separate set of profiles for the project"},
+}
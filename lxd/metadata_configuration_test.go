@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// All the documented configuration keys must be valid ones.
+func TestMetadataConfiguration_DocumentedKeysAreValid(t *testing.T) {
+	volumeKeys := map[string]func(value string) error{}
+	for key := range storagePools.StorageVolumeConfigKeys {
+		volumeKeys[key] = nil
+	}
+
+	cases := []struct {
+		documented map[string]api.ConfigKeySchema
+		validators map[string]func(value string) error
+	}{
+		{instanceConfigKeysSchema, shared.KnownContainerConfigKeys},
+		{storagePoolConfigKeysSchema, storagePoolConfigKeys},
+		{storageVolumeConfigKeysSchema, volumeKeys},
+		{networkConfigKeysSchema, networkConfigKeys},
+		{projectConfigKeysSchema, projectConfigKeys},
+	}
+
+	for _, c := range cases {
+		for key := range c.documented {
+			if strings.Contains(key, "*") {
+				continue
+			}
+
+			_, ok := c.validators[key]
+			assert.True(t, ok, "Documented key %q isn't a valid key", key)
+		}
+	}
+}
+
+func TestMetadataConfiguration_ConfigKeyType(t *testing.T) {
+	assert.Equal(t, "boolean", configKeyType(shared.IsBool))
+	assert.Equal(t, "integer", configKeyType(shared.IsInt64))
+	assert.Equal(t, "string", configKeyType(shared.IsAny))
+	assert.Equal(t, "string", configKeyType(nil))
+}
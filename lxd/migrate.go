@@ -6,20 +6,25 @@
 package main
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/gorilla/websocket"
 
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/idmap"
 	"github.com/lxc/lxd/shared/logger"
@@ -38,12 +43,15 @@ type migrationFields struct {
 
 	// container specific fields
 	live         bool
+	handover     bool
 	instanceOnly bool
+	snapshots    string
 	instance     Instance
 
 	// storage specific fields
-	storage    storage
-	volumeOnly bool
+	storage        storage
+	volumeOnly     bool
+	bandwidthLimit string
 }
 
 func (c *migrationFields) send(m proto.Message) error {
@@ -128,10 +136,74 @@ func (c *migrationFields) controlChannel() <-chan migration.MigrationControl {
 	return ch
 }
 
+// sendChecksum sends the checksum of the data sent by a migration source to the sink, so that it
+// can verify what it received.
+func (c *migrationFields) sendChecksum(op *operations.Operation, checksum *migration.Checksum) error {
+	sum := checksum.Sum()
+
+	err := c.send(&migration.MigrationControl{
+		Success:  proto.Bool(true),
+		Checksum: proto.String(sum),
+	})
+	if err != nil {
+		return err
+	}
+
+	migrationChecksumRender(op, sum)
+	return nil
+}
+
+// migrationVerifyChecksum compares the checksum of the data received by a migration sink with the
+// one sent by the source, waiting for the source to send it if it hasn't yet.
+func migrationVerifyChecksum(op *operations.Operation, checksum *migration.Checksum, sourceChecksum *string, source <-chan migration.MigrationControl) error {
+	if sourceChecksum == nil {
+		msg, ok := <-source
+		if !ok {
+			return fmt.Errorf("Got error reading source")
+		}
+
+		if !msg.GetSuccess() {
+			return fmt.Errorf(msg.GetMessage())
+		}
+
+		sourceChecksum = msg.Checksum
+		if sourceChecksum == nil {
+			return fmt.Errorf("The source didn't send the checksum of the transferred data")
+		}
+	}
+
+	sum := checksum.Sum()
+	if sum != *sourceChecksum {
+		return fmt.Errorf("Checksum mismatch for the transferred data (sent %s, received %s)", *sourceChecksum, sum)
+	}
+
+	migrationChecksumRender(op, sum)
+	return nil
+}
+
+// Records the checksum of the transferred data in the operation metadata.
+func migrationChecksumRender(op *operations.Operation, sum string) {
+	if op == nil {
+		return
+	}
+
+	meta := op.Metadata()
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+
+	meta["checksum"] = sum
+	op.UpdateMetadata(meta)
+}
+
 type migrationSourceWs struct {
 	migrationFields
 
 	allConnected chan bool
+
+	// If set, the websockets only accept peers presenting the cluster
+	// certificate it returns, since the migration is between members.
+	clusterCert func() *shared.CertInfo
 }
 
 func (s *migrationSourceWs) Metadata() interface{} {
@@ -153,6 +225,10 @@ func (s *migrationSourceWs) Connect(op *operations.Operation, r *http.Request, w
 		return fmt.Errorf("missing secret")
 	}
 
+	if s.clusterCert != nil && !migrationPeerIsClusterMember(r, s.clusterCert()) {
+		return os.ErrPermission
+	}
+
 	var conn **websocket.Conn
 
 	switch secret {
@@ -241,6 +317,87 @@ func (s *migrationSourceWs) ConnectTarget(certificate string, operation string,
 	return nil
 }
 
+// Return true if the peer of the given request presented the given cluster
+// certificate, or another one trusted during a rotation.
+func migrationPeerIsClusterMember(r *http.Request, cert *shared.CertInfo) bool {
+	if r.TLS == nil {
+		return false
+	}
+
+	trustedCerts, err := cluster.TLSTrustedCerts(cert)
+	if err != nil {
+		return false
+	}
+
+	for _, peer := range r.TLS.PeerCertificates {
+		trusted, _ := util.CheckTrustState(*peer, trustedCerts)
+		if trusted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the cluster certificate which the peers of the websockets of a
+// migration source must present, if the migration was requested by another
+// cluster member and cluster.migration_mutual_tls is set, or nil otherwise.
+//
+// Requests forwarded by a member on behalf of a client are not migrations
+// between members, since the client might migrate to another server.
+func migrationSourceClusterCert(d *Daemon, r *http.Request) (func() *shared.CertInfo, error) {
+	if r.Header.Get("X-LXD-forwarded") != "" || !migrationPeerIsClusterMember(r, d.endpoints.NetworkCert()) {
+		return nil, nil
+	}
+
+	var required bool
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		config, err := cluster.ConfigLoad(tx)
+		if err != nil {
+			return err
+		}
+
+		required = config.MigrationMutualTLS()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !required {
+		return nil, nil
+	}
+
+	return d.endpoints.NetworkCert, nil
+}
+
+// Return the TLS configuration used by a migration sink to connect to the
+// source with the given certificate. If the source is another member of the
+// cluster, the sink authenticates with the cluster certificate too.
+func migrationSinkTLSConfig(d *Daemon, cert *x509.Certificate) (*tls.Config, error) {
+	config, err := shared.GetTLSConfig("", "", "", cert)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert == nil {
+		return config, nil
+	}
+
+	clusterCert := d.endpoints.NetworkCert()
+	trustedCerts, err := cluster.TLSTrustedCerts(clusterCert)
+	if err != nil {
+		return nil, err
+	}
+
+	trusted, _ := util.CheckTrustState(*cert, trustedCerts)
+	if trusted {
+		config.Certificates = []tls.Certificate{clusterCert.KeyPair()}
+	}
+
+	return config, nil
+}
+
 type migrationSink struct {
 	// We are pulling the entity from src in pull mode.
 	src migrationFields
@@ -277,21 +434,63 @@ type MigrationSinkArgs struct {
 
 	// Transport specific fields
 	RsyncFeatures []string
+	BtrfsFeatures []string
+	Checksum      *migration.Checksum
 }
 
 type MigrationSourceArgs struct {
 	// Instance specific fields
 	Instance     Instance
 	InstanceOnly bool
+	Snapshots    string
 
 	// Transport specific fields
 	RsyncFeatures []string
 	ZfsFeatures   []string
+	BtrfsFeatures []string
+	Checksum      *migration.Checksum
 
 	// Volume specific fields
 	VolumeOnly bool
 }
 
+// migrationSnapshotsValidate checks a selection of the snapshots to transfer along with an
+// instance: "all", "none" or a comma separated list of shell patterns matching snapshot names.
+func migrationSnapshotsValidate(selection string) error {
+	if shared.StringInSlice(selection, []string{"", "all", "none"}) {
+		return nil
+	}
+
+	for _, pattern := range strings.Split(selection, ",") {
+		_, err := filepath.Match(strings.TrimSpace(pattern), "")
+		if err != nil {
+			return fmt.Errorf("Invalid snapshot selection pattern %q: %v", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// migrationSnapshotSelected returns whether the snapshot with the given name is part of a
+// selection of snapshots to transfer. All the snapshots are selected when none is given.
+func migrationSnapshotSelected(selection string, snapName string) bool {
+	switch selection {
+	case "", "all":
+		return true
+	case "none":
+		return false
+	}
+
+	for _, pattern := range strings.Split(selection, ",") {
+		match, _ := filepath.Match(strings.TrimSpace(pattern), snapName)
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *migrationSink) connectWithSecret(secret string) (*websocket.Conn, error) {
 	query := url.Values{"secret": []string{secret}}
 
@@ -20,6 +20,8 @@ import (
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/rsync"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
@@ -27,9 +29,10 @@ import (
 	"github.com/lxc/lxd/shared/logger"
 )
 
-func NewMigrationSource(inst Instance, stateful bool, instanceOnly bool) (*migrationSourceWs, error) {
-	ret := migrationSourceWs{migrationFields{instance: inst}, make(chan bool, 1)}
+func NewMigrationSource(inst Instance, stateful bool, instanceOnly bool, snapshots string) (*migrationSourceWs, error) {
+	ret := migrationSourceWs{migrationFields: migrationFields{instance: inst}, allConnected: make(chan bool, 1)}
 	ret.instanceOnly = instanceOnly
+	ret.snapshots = snapshots
 
 	var err error
 	ret.controlSecret, err = shared.RandomCryptoString()
@@ -42,7 +45,7 @@ func NewMigrationSource(inst Instance, stateful bool, instanceOnly bool) (*migra
 		return nil, err
 	}
 
-	if stateful && inst.IsRunning() {
+	if stateful && inst.IsRunning() && inst.Type() == instancetype.Container {
 		_, err := exec.LookPath("criu")
 		if err != nil {
 			return nil, fmt.Errorf("Unable to perform container live migration. CRIU isn't installed on the source server")
@@ -55,6 +58,12 @@ func NewMigrationSource(inst Instance, stateful bool, instanceOnly bool) (*migra
 		}
 	}
 
+	// Running virtual machines are stopped once their disk was transferred rather than resumed,
+	// handing them over to the target.
+	if stateful && inst.IsRunning() && inst.Type() == instancetype.VM {
+		ret.handover = true
+	}
+
 	return &ret, nil
 }
 
@@ -333,6 +342,11 @@ func (s *migrationSourceWs) preDumpLoop(args *preDumpLoopArgs) (bool, error) {
 func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 	<-s.allConnected
 
+	// Instances other than containers are only supported by the new storage layer.
+	if s.instance.Type() != instancetype.Container {
+		return s.doPool(migrateOp)
+	}
+
 	criuType := migration.CRIUType_CRIU_RSYNC.Enum()
 	if !s.live {
 		criuType = nil
@@ -341,10 +355,6 @@ func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 		}
 	}
 
-	if s.instance.Type() != instancetype.Container {
-		return fmt.Errorf("Instance not container type")
-	}
-
 	c := s.instance.(container)
 
 	// Storage needs to start unconditionally now, since we need to
@@ -385,8 +395,12 @@ func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 		fullSnaps, err := s.instance.Snapshots()
 		if err == nil {
 			for _, snap := range fullSnaps {
-				snapshots = append(snapshots, snapshotToProtobuf(snap))
 				_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snap.Name())
+				if !migrationSnapshotSelected(s.snapshots, snapName) {
+					continue
+				}
+
+				snapshots = append(snapshots, snapshotToProtobuf(snap))
 				snapshotNames = append(snapshotNames, snapName)
 			}
 		}
@@ -423,6 +437,12 @@ func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 		}
 	}
 
+	header.BtrfsFeatures = &migration.BtrfsFeatures{
+		Subvolumes: &hasFeature,
+	}
+
+	header.Checksum = &hasFeature
+
 	err = s.send(&header)
 	if err != nil {
 		s.sendControl(err)
@@ -446,12 +466,24 @@ func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 	// Handle zfs options
 	zfsFeatures := header.GetZfsFeaturesSlice()
 
+	// Handle btrfs options
+	btrfsFeatures := header.GetBtrfsFeaturesSlice()
+
+	// Checksum the binary streams if the target asked for it.
+	var checksum *migration.Checksum
+	if header.GetChecksum() {
+		checksum = migration.NewChecksum()
+	}
+
 	// Set source args
 	sourceArgs := MigrationSourceArgs{
 		Instance:      s.instance,
 		InstanceOnly:  s.instanceOnly,
+		Snapshots:     s.snapshots,
 		RsyncFeatures: rsyncFeatures,
 		ZfsFeatures:   zfsFeatures,
+		BtrfsFeatures: btrfsFeatures,
+		Checksum:      checksum,
 	}
 
 	// Initialize storage driver
@@ -695,6 +727,13 @@ func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 		}
 	}
 
+	if checksum != nil {
+		err = s.sendChecksum(migrateOp, checksum)
+		if err != nil {
+			return abort(err)
+		}
+	}
+
 	driver.Cleanup()
 
 	msg := migration.MigrationControl{}
@@ -719,6 +758,138 @@ func (s *migrationSourceWs) Do(migrateOp *operations.Operation) error {
 	return nil
 }
 
+// doPool sends the volume of an instance stored on a pool of the new storage layer, offering the
+// migration types of the pool to the target. The instance must be stopped.
+func (s *migrationSourceWs) doPool(migrateOp *operations.Operation) error {
+	pool, err := storagePools.GetPoolByInstance(s.instance.DaemonState(), s.instance)
+	if err != nil {
+		s.sendControl(err)
+		return err
+	}
+
+	contentType := storageDrivers.ContentTypeFS
+	if s.instance.Type() == instancetype.VM {
+		contentType = storageDrivers.ContentTypeBlock
+	}
+
+	poolMigrationTypes := pool.MigrationTypes(contentType)
+	if len(poolMigrationTypes) == 0 {
+		err := fmt.Errorf("No source migration types available")
+		s.sendControl(err)
+		return err
+	}
+
+	// Convert the pool's migration type options to an offer header to target.
+	offerHeader := migration.TypesToHeader(poolMigrationTypes...)
+
+	snapshots := []*migration.Snapshot{}
+	snapshotNames := []string{}
+
+	// Only send snapshots when requested.
+	if !s.instanceOnly {
+		fullSnaps, err := s.instance.Snapshots()
+		if err != nil {
+			s.sendControl(err)
+			return err
+		}
+
+		for _, snap := range fullSnaps {
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snap.Name())
+			if !migrationSnapshotSelected(s.snapshots, snapName) {
+				continue
+			}
+
+			snapshots = append(snapshots, snapshotToProtobuf(snap))
+			snapshotNames = append(snapshotNames, snapName)
+		}
+	}
+
+	offerHeader.SnapshotNames = snapshotNames
+	offerHeader.Snapshots = snapshots
+
+	err = s.send(&offerHeader)
+	if err != nil {
+		s.sendControl(err)
+		return err
+	}
+
+	var respHeader migration.MigrationHeader
+	err = s.recv(&respHeader)
+	if err != nil {
+		s.sendControl(err)
+		return err
+	}
+
+	migrationType, err := migration.MatchTypes(respHeader, migration.MigrationFSType_RSYNC, poolMigrationTypes)
+	if err != nil {
+		s.sendControl(err)
+		return err
+	}
+
+	volSourceArgs := migration.VolumeSourceArgs{
+		Name:          s.instance.Name(),
+		MigrationType: migrationType,
+		Snapshots:     snapshotNames,
+		TrackProgress: true,
+	}
+
+	// The disk of running instances is sent while in use, then again once paused for the
+	// changes made in the meantime.
+	frozen := false
+	if s.instance.IsRunning() {
+		if !shared.StringInSlice("live_block", migrationType.Features) {
+			err := fmt.Errorf("Instance must be stopped to be migrated")
+			s.sendControl(err)
+			return err
+		}
+
+		volSourceArgs.Freeze = func() error {
+			err := s.instance.Freeze()
+			if err != nil {
+				return err
+			}
+
+			frozen = true
+			return nil
+		}
+
+		defer func() {
+			if frozen {
+				s.instance.Unfreeze()
+			}
+		}()
+	}
+
+	err = pool.MigrateInstance(s.instance, &shared.WebsocketIO{Conn: s.fsConn}, volSourceArgs, migrateOp)
+	if err != nil {
+		go s.sendControl(err)
+		return err
+	}
+
+	msg := migration.MigrationControl{}
+	err = s.recv(&msg)
+	if err != nil {
+		s.disconnect()
+		return err
+	}
+
+	if !*msg.Success {
+		return fmt.Errorf(*msg.Message)
+	}
+
+	// Hand the instance over to the target, its disk won't be written to anymore.
+	if frozen && s.handover {
+		err = s.instance.Stop(false)
+		if err != nil {
+			return err
+		}
+
+		frozen = false
+	}
+
+	return nil
+}
+
 func NewMigrationSink(args *MigrationSinkArgs) (*migrationSink, error) {
 	sink := migrationSink{
 		src:     migrationFields{instance: args.Instance, instanceOnly: args.InstanceOnly},
@@ -779,12 +950,6 @@ func NewMigrationSink(args *MigrationSinkArgs) (*migrationSink, error) {
 }
 
 func (c *migrationSink) Do(migrateOp *operations.Operation) error {
-	if c.src.instance.Type() != instancetype.Container {
-		return fmt.Errorf("Instance not container type")
-	}
-
-	ct := c.src.instance.(container)
-
 	var err error
 
 	if c.push {
@@ -841,6 +1006,13 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 		return err
 	}
 
+	// Instances other than containers are only supported by the new storage layer.
+	if c.src.instance.Type() != instancetype.Container {
+		return c.doPool(migrateOp, header)
+	}
+
+	ct := c.src.instance.(container)
+
 	// Handle rsync options
 	rsyncFeatures := header.GetRsyncFeaturesSlice()
 
@@ -901,6 +1073,15 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 		}
 	}
 
+	// Return those btrfs features we know about (with the value sent by the remote)
+	if header.BtrfsFeatures != nil && header.BtrfsFeatures.Subvolumes != nil {
+		resp.BtrfsFeatures = &migration.BtrfsFeatures{
+			Subvolumes: header.BtrfsFeatures.Subvolumes,
+		}
+	}
+
+	btrfsFeatures := resp.GetBtrfsFeaturesSlice()
+
 	if c.refresh {
 		// Get our existing snapshots
 		targetSnapshots, err := c.src.instance.Snapshots()
@@ -951,6 +1132,13 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 		resp.Predump = proto.Bool(false)
 	}
 
+	// Verify the data of binary (non-rsync) transfers if the source supports it.
+	var checksum *migration.Checksum
+	if header.GetChecksum() && *resp.Fs != migration.MigrationFSType_RSYNC {
+		checksum = migration.NewChecksum()
+		resp.Checksum = proto.Bool(true)
+	}
+
 	err = sender(&resp)
 	if err != nil {
 		controller(err)
@@ -1019,7 +1207,9 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 				Live:          sendFinalFsDelta,
 				Refresh:       c.refresh,
 				RsyncFeatures: rsyncFeatures,
+				BtrfsFeatures: btrfsFeatures,
 				Snapshots:     snapshots,
+				Checksum:      checksum,
 			}
 
 			err = mySink(fsConn, migrateOp, args)
@@ -1135,6 +1325,9 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 		source = c.src.controlChannel()
 	}
 
+	// Checksum of the transferred data, if already sent by the source.
+	var sourceChecksum *string
+
 	for {
 		select {
 		case err = <-restore:
@@ -1142,6 +1335,15 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 				disconnector()
 				return err
 			}
+
+			if checksum != nil {
+				err = migrationVerifyChecksum(migrateOp, checksum, sourceChecksum, source)
+				if err != nil {
+					controller(err)
+					return err
+				}
+			}
+
 			controller(err)
 			return err
 		case msg, ok := <-source:
@@ -1152,6 +1354,8 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 			if !*msg.Success {
 				disconnector()
 				return fmt.Errorf(*msg.Message)
+			} else if msg.Checksum != nil {
+				sourceChecksum = msg.Checksum
 			} else {
 				// The source can only tell us it failed (e.g. if
 				// checkpointing failed). We have to tell the source
@@ -1162,6 +1366,119 @@ func (c *migrationSink) Do(migrateOp *operations.Operation) error {
 	}
 }
 
+// doPool receives the volume of an instance stored on a pool of the new storage layer, answering
+// the offer of the source with the first migration type supported by the pool.
+func (c *migrationSink) doPool(migrateOp *operations.Operation, offerHeader migration.MigrationHeader) error {
+	sender := c.src.send
+	controller := c.src.sendControl
+	disconnector := c.src.disconnect
+	fsConn := c.src.fsConn
+	if c.push {
+		sender = c.dest.send
+		controller = c.dest.sendControl
+		disconnector = c.dest.disconnect
+		fsConn = c.dest.fsConn
+	}
+
+	if c.refresh {
+		err := fmt.Errorf("Only containers can be refreshed")
+		controller(err)
+		return err
+	}
+
+	state := c.src.instance.DaemonState()
+	pool, err := storagePools.GetPoolByInstance(state, c.src.instance)
+	if err != nil {
+		controller(err)
+		return err
+	}
+
+	contentType := storageDrivers.ContentTypeFS
+	if c.src.instance.Type() == instancetype.VM {
+		contentType = storageDrivers.ContentTypeBlock
+	}
+
+	// Match the offered migration type against the ones supported by our pool, the common
+	// features being sent back to the source.
+	respType, err := migration.MatchTypes(offerHeader, migration.MigrationFSType_RSYNC, pool.MigrationTypes(contentType))
+	if err != nil {
+		controller(err)
+		return err
+	}
+
+	respHeader := migration.TypesToHeader(respType)
+	respHeader.SnapshotNames = offerHeader.SnapshotNames
+	respHeader.Snapshots = offerHeader.Snapshots
+	respHeader.Refresh = &c.refresh
+
+	err = sender(&respHeader)
+	if err != nil {
+		controller(err)
+		return err
+	}
+
+	// Create the records of the snapshots, their volumes are received along with the
+	// instance's one.
+	snapshotNames := []string{}
+	if !c.src.instanceOnly {
+		for _, snap := range offerHeader.Snapshots {
+			snapArgs := snapshotProtobufToInstanceArgs(c.src.instance.Project(), c.src.instance.Name(), snap)
+			snapArgs.Type = c.src.instance.Type()
+			_, err := instanceCreateInternal(state, snapArgs)
+			if err != nil {
+				controller(err)
+				return err
+			}
+
+			snapshotNames = append(snapshotNames, snap.GetName())
+		}
+	}
+
+	volTargetArgs := migration.VolumeTargetArgs{
+		Name:          c.src.instance.Name(),
+		Snapshots:     snapshotNames,
+		MigrationType: respType,
+		TrackProgress: true,
+	}
+
+	restore := make(chan error)
+	go func() {
+		restore <- pool.CreateInstanceFromMigration(c.src.instance, &shared.WebsocketIO{Conn: fsConn}, volTargetArgs, migrateOp)
+	}()
+
+	var source <-chan migration.MigrationControl
+	if c.push {
+		source = c.dest.controlChannel()
+	} else {
+		source = c.src.controlChannel()
+	}
+
+	for {
+		select {
+		case err = <-restore:
+			if err != nil {
+				disconnector()
+				return err
+			}
+
+			controller(nil)
+			return nil
+		case msg, ok := <-source:
+			if !ok {
+				disconnector()
+				return fmt.Errorf("Got error reading source")
+			}
+
+			if !*msg.Success {
+				disconnector()
+				return fmt.Errorf(*msg.Message)
+			}
+
+			logger.Debugf("Unknown message %v from source", msg)
+		}
+	}
+}
+
 func (s *migrationSourceWs) ConnectContainerTarget(target api.InstancePostTarget) error {
 	return s.ConnectTarget(target.Certificate, target.Operation, target.Websockets)
 }
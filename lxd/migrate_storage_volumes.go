@@ -8,6 +8,7 @@ import (
 
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/state"
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
@@ -16,9 +17,10 @@ import (
 	"github.com/lxc/lxd/shared/logger"
 )
 
-func NewStorageMigrationSource(volumeOnly bool) (*migrationSourceWs, error) {
-	ret := migrationSourceWs{migrationFields{}, make(chan bool, 1)}
+func NewStorageMigrationSource(volumeOnly bool, bandwidthLimit string) (*migrationSourceWs, error) {
+	ret := migrationSourceWs{allConnected: make(chan bool, 1)}
 	ret.volumeOnly = volumeOnly
+	ret.bandwidthLimit = bandwidthLimit
 
 	var err error
 	ret.controlSecret, err = shared.RandomCryptoString()
@@ -151,10 +153,11 @@ func (s *migrationSourceWs) DoStorage(state *state.State, poolName string, volNa
 		}
 
 		volSourceArgs := migration.VolumeSourceArgs{
-			Name:          volName,
-			MigrationType: migrationType,
-			Snapshots:     snapshotNames,
-			TrackProgress: true,
+			Name:           volName,
+			MigrationType:  migrationType,
+			Snapshots:      snapshotNames,
+			TrackProgress:  true,
+			BandwidthLimit: s.bandwidthLimit,
 		}
 
 		err = pool.MigrateCustomVolume(&shared.WebsocketIO{Conn: s.fsConn}, volSourceArgs, migrateOp)
@@ -202,6 +205,13 @@ func (s *migrationSourceWs) DoStorage(state *state.State, poolName string, volNa
 			}
 		}
 
+		// Only the rsync transfers can be limited by the legacy storage drivers.
+		bwlimit, err = rsync.LowestBandwidthLimit(bwlimit, s.bandwidthLimit)
+		if err != nil {
+			s.sendControl(err)
+			return err
+		}
+
 		abort := func(err error) error {
 			driver.Cleanup()
 			go s.sendControl(err)
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Snapshots are selected by shell patterns matching their names.
+func TestMigrationSnapshotSelected(t *testing.T) {
+	assert.True(t, migrationSnapshotSelected("", "snap0"))
+	assert.True(t, migrationSnapshotSelected("all", "snap0"))
+	assert.False(t, migrationSnapshotSelected("none", "snap0"))
+
+	assert.True(t, migrationSnapshotSelected("daily-*", "daily-2020-01-01"))
+	assert.False(t, migrationSnapshotSelected("daily-*", "weekly-2020-01-01"))
+	assert.True(t, migrationSnapshotSelected("daily-*, snap?", "snap1"))
+	assert.False(t, migrationSnapshotSelected("daily-*,snap?", "snap10"))
+
+	assert.Nil(t, migrationSnapshotsValidate("daily-*,snap[0-9]"))
+	assert.NotNil(t, migrationSnapshotsValidate("snap[0-9"))
+}
@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"io"
+	"time"
+)
+
+// bandwidthLimiter throttles the writes to a connection to a given rate.
+type bandwidthLimiter struct {
+	io.ReadWriteCloser
+
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+// LimitBandwidth returns the connection with its writes throttled to the given rate, in bytes per
+// second. Throttling the writes of the sending side slows down the whole transfer, whichever tool
+// it uses. A rate of 0 means no limit.
+func LimitBandwidth(conn io.ReadWriteCloser, rate int64) io.ReadWriteCloser {
+	if rate <= 0 {
+		return conn
+	}
+
+	return &bandwidthLimiter{ReadWriteCloser: conn, rate: rate}
+}
+
+// Write writes the data in chunks of a tenth of a second worth of data at most, waiting after each
+// one until the average rate since the start of the transfer is back under the limit.
+func (l *bandwidthLimiter) Write(p []byte) (int, error) {
+	chunkSize := l.rate / 10
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	written := 0
+	for written < len(p) {
+		// Don't let an idle connection build up a burst of data to send at full speed.
+		due := l.due()
+		if l.start.IsZero() || time.Since(due) > time.Second {
+			l.start = time.Now()
+			l.written = 0
+		}
+
+		chunk := p[written:]
+		if int64(len(chunk)) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+
+		n, err := l.ReadWriteCloser.Write(chunk)
+		written += n
+		l.written += int64(n)
+		if err != nil {
+			return written, err
+		}
+
+		time.Sleep(time.Until(l.due()))
+	}
+
+	return written, nil
+}
+
+// due returns the time at which the data written so far is sent at exactly the rate.
+func (l *bandwidthLimiter) due() time.Time {
+	return l.start.Add(time.Duration(float64(l.written) / float64(l.rate) * float64(time.Second)))
+}
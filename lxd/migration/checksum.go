@@ -0,0 +1,65 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// Checksum computes a running SHA-256 digest of the binary streams (e.g. zfs or btrfs send) of a
+// migration, so that the source and target can compare them once the transfer is done. A nil
+// Checksum is valid and simply doesn't checksum anything.
+type Checksum struct {
+	mu   sync.Mutex
+	hash hash.Hash
+}
+
+// NewChecksum returns a new empty Checksum.
+func NewChecksum() *Checksum {
+	return &Checksum{hash: sha256.New()}
+}
+
+// Write adds data to the digest.
+func (c *Checksum) Write(p []byte) (int, error) {
+	if c == nil {
+		return len(p), nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hash.Write(p)
+}
+
+// Reader returns a reader adding all the data read from r to the digest.
+func (c *Checksum) Reader(r io.Reader) io.Reader {
+	if c == nil {
+		return r
+	}
+
+	return io.TeeReader(r, c)
+}
+
+// Writer returns a writer adding all the data written to w to the digest.
+func (c *Checksum) Writer(w io.Writer) io.Writer {
+	if c == nil {
+		return w
+	}
+
+	return io.MultiWriter(w, c)
+}
+
+// Sum returns the current digest, prefixed with the name of the hash function.
+func (c *Checksum) Sum() string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(c.hash.Sum(nil)))
+}
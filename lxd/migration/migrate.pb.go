@@ -14,6 +14,7 @@ It has these top-level messages:
 	Snapshot
 	RsyncFeatures
 	ZfsFeatures
+	BtrfsFeatures
 	MigrationHeader
 	MigrationControl
 	MigrationSync
@@ -300,6 +301,8 @@ type RsyncFeatures struct {
 	Delete           *bool  `protobuf:"varint,2,opt,name=delete" json:"delete,omitempty"`
 	Compress         *bool  `protobuf:"varint,3,opt,name=compress" json:"compress,omitempty"`
 	Bidirectional    *bool  `protobuf:"varint,4,opt,name=bidirectional" json:"bidirectional,omitempty"`
+	Sparse           *bool  `protobuf:"varint,5,opt,name=sparse" json:"sparse,omitempty"`
+	LiveBlock        *bool  `protobuf:"varint,6,opt,name=live_block,json=liveBlock" json:"live_block,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -336,6 +339,20 @@ func (m *RsyncFeatures) GetBidirectional() bool {
 	return false
 }
 
+func (m *RsyncFeatures) GetSparse() bool {
+	if m != nil && m.Sparse != nil {
+		return *m.Sparse
+	}
+	return false
+}
+
+func (m *RsyncFeatures) GetLiveBlock() bool {
+	if m != nil && m.LiveBlock != nil {
+		return *m.LiveBlock
+	}
+	return false
+}
+
 type ZfsFeatures struct {
 	Compress         *bool  `protobuf:"varint,1,opt,name=compress" json:"compress,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
@@ -353,6 +370,23 @@ func (m *ZfsFeatures) GetCompress() bool {
 	return false
 }
 
+type BtrfsFeatures struct {
+	Subvolumes       *bool  `protobuf:"varint,1,opt,name=subvolumes" json:"subvolumes,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *BtrfsFeatures) Reset()                    { *m = BtrfsFeatures{} }
+func (m *BtrfsFeatures) String() string            { return proto.CompactTextString(m) }
+func (*BtrfsFeatures) ProtoMessage()               {}
+func (*BtrfsFeatures) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *BtrfsFeatures) GetSubvolumes() bool {
+	if m != nil && m.Subvolumes != nil {
+		return *m.Subvolumes
+	}
+	return false
+}
+
 type MigrationHeader struct {
 	Fs               *MigrationFSType `protobuf:"varint,1,req,name=fs,enum=migration.MigrationFSType" json:"fs,omitempty"`
 	Criu             *CRIUType        `protobuf:"varint,2,opt,name=criu,enum=migration.CRIUType" json:"criu,omitempty"`
@@ -363,13 +397,15 @@ type MigrationHeader struct {
 	RsyncFeatures    *RsyncFeatures   `protobuf:"bytes,8,opt,name=rsyncFeatures" json:"rsyncFeatures,omitempty"`
 	Refresh          *bool            `protobuf:"varint,9,opt,name=refresh" json:"refresh,omitempty"`
 	ZfsFeatures      *ZfsFeatures     `protobuf:"bytes,10,opt,name=zfsFeatures" json:"zfsFeatures,omitempty"`
+	BtrfsFeatures    *BtrfsFeatures   `protobuf:"bytes,11,opt,name=btrfsFeatures" json:"btrfsFeatures,omitempty"`
+	Checksum         *bool            `protobuf:"varint,12,opt,name=checksum" json:"checksum,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
 func (m *MigrationHeader) Reset()                    { *m = MigrationHeader{} }
 func (m *MigrationHeader) String() string            { return proto.CompactTextString(m) }
 func (*MigrationHeader) ProtoMessage()               {}
-func (*MigrationHeader) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*MigrationHeader) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
 
 func (m *MigrationHeader) GetFs() MigrationFSType {
 	if m != nil && m.Fs != nil {
@@ -434,17 +470,33 @@ func (m *MigrationHeader) GetZfsFeatures() *ZfsFeatures {
 	return nil
 }
 
+func (m *MigrationHeader) GetBtrfsFeatures() *BtrfsFeatures {
+	if m != nil {
+		return m.BtrfsFeatures
+	}
+	return nil
+}
+
+func (m *MigrationHeader) GetChecksum() bool {
+	if m != nil && m.Checksum != nil {
+		return *m.Checksum
+	}
+	return false
+}
+
 type MigrationControl struct {
 	Success *bool `protobuf:"varint,1,req,name=success" json:"success,omitempty"`
 	// optional failure message if sending a failure
-	Message          *string `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+	Message *string `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+	// checksum of the transferred data, sent by the source when requested
+	Checksum         *string `protobuf:"bytes,3,opt,name=checksum" json:"checksum,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
 func (m *MigrationControl) Reset()                    { *m = MigrationControl{} }
 func (m *MigrationControl) String() string            { return proto.CompactTextString(m) }
 func (*MigrationControl) ProtoMessage()               {}
-func (*MigrationControl) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*MigrationControl) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 func (m *MigrationControl) GetSuccess() bool {
 	if m != nil && m.Success != nil {
@@ -460,6 +512,13 @@ func (m *MigrationControl) GetMessage() string {
 	return ""
 }
 
+func (m *MigrationControl) GetChecksum() string {
+	if m != nil && m.Checksum != nil {
+		return *m.Checksum
+	}
+	return ""
+}
+
 type MigrationSync struct {
 	FinalPreDump     *bool  `protobuf:"varint,1,req,name=finalPreDump" json:"finalPreDump,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
@@ -468,7 +527,7 @@ type MigrationSync struct {
 func (m *MigrationSync) Reset()                    { *m = MigrationSync{} }
 func (m *MigrationSync) String() string            { return proto.CompactTextString(m) }
 func (*MigrationSync) ProtoMessage()               {}
-func (*MigrationSync) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*MigrationSync) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *MigrationSync) GetFinalPreDump() bool {
 	if m != nil && m.FinalPreDump != nil {
@@ -496,7 +555,7 @@ type DumpStatsEntry struct {
 func (m *DumpStatsEntry) Reset()                    { *m = DumpStatsEntry{} }
 func (m *DumpStatsEntry) String() string            { return proto.CompactTextString(m) }
 func (*DumpStatsEntry) ProtoMessage()               {}
-func (*DumpStatsEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (*DumpStatsEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *DumpStatsEntry) GetFreezingTime() uint32 {
 	if m != nil && m.FreezingTime != nil {
@@ -587,7 +646,7 @@ type RestoreStatsEntry struct {
 func (m *RestoreStatsEntry) Reset()                    { *m = RestoreStatsEntry{} }
 func (m *RestoreStatsEntry) String() string            { return proto.CompactTextString(m) }
 func (*RestoreStatsEntry) ProtoMessage()               {}
-func (*RestoreStatsEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+func (*RestoreStatsEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
 
 func (m *RestoreStatsEntry) GetPagesCompared() uint64 {
 	if m != nil && m.PagesCompared != nil {
@@ -633,7 +692,7 @@ type StatsEntry struct {
 func (m *StatsEntry) Reset()                    { *m = StatsEntry{} }
 func (m *StatsEntry) String() string            { return proto.CompactTextString(m) }
 func (*StatsEntry) ProtoMessage()               {}
-func (*StatsEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+func (*StatsEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
 
 func (m *StatsEntry) GetDump() *DumpStatsEntry {
 	if m != nil {
@@ -656,6 +715,7 @@ func init() {
 	proto.RegisterType((*Snapshot)(nil), "migration.Snapshot")
 	proto.RegisterType((*RsyncFeatures)(nil), "migration.rsyncFeatures")
 	proto.RegisterType((*ZfsFeatures)(nil), "migration.zfsFeatures")
+	proto.RegisterType((*BtrfsFeatures)(nil), "migration.btrfsFeatures")
 	proto.RegisterType((*MigrationHeader)(nil), "migration.MigrationHeader")
 	proto.RegisterType((*MigrationControl)(nil), "migration.MigrationControl")
 	proto.RegisterType((*MigrationSync)(nil), "migration.MigrationSync")
@@ -669,71 +729,75 @@ func init() {
 func init() { proto.RegisterFile("lxd/migration/migrate.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 1047 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x55, 0xdb, 0x6e, 0xdb, 0x46,
-	0x10, 0xad, 0x6e, 0xb6, 0x38, 0x92, 0x1c, 0x65, 0x63, 0x04, 0x44, 0xd2, 0x8b, 0xca, 0xa4, 0xa8,
-	0xe2, 0x07, 0x3b, 0x55, 0x50, 0x20, 0x7d, 0x29, 0x50, 0xcb, 0x75, 0x13, 0x20, 0x71, 0x8d, 0x95,
-	0x8d, 0xa2, 0x7d, 0x21, 0x36, 0xe4, 0x50, 0x5e, 0x98, 0x37, 0xec, 0x52, 0xb6, 0xe5, 0x97, 0xa2,
-	0x9f, 0xd1, 0x0f, 0xe8, 0xf7, 0xf4, 0xa9, 0xff, 0x53, 0xec, 0x2c, 0x49, 0x53, 0x4e, 0x81, 0xbe,
-	0xed, 0x9c, 0x39, 0x3c, 0xb3, 0x3b, 0x37, 0xc2, 0xd3, 0xf8, 0x26, 0x3c, 0x48, 0xe4, 0x52, 0x89,
-	0x42, 0x66, 0x69, 0x79, 0xc2, 0xfd, 0x5c, 0x65, 0x45, 0xc6, 0x9c, 0xda, 0xe1, 0xfd, 0x0e, 0xce,
-	0xdb, 0xa3, 0xf7, 0x22, 0x3f, 0x5b, 0xe7, 0xc8, 0x76, 0xa1, 0x27, 0xf5, 0x4a, 0x86, 0x6e, 0x6b,
-	0xd2, 0x9e, 0xf6, 0xb9, 0x35, 0x2c, 0xba, 0x94, 0xa1, 0xdb, 0xae, 0xd0, 0xa5, 0x0c, 0xd9, 0x63,
-	0xd8, 0xba, 0xc8, 0x74, 0x21, 0x43, 0xb7, 0x33, 0x69, 0x4f, 0x7b, 0xbc, 0xb4, 0x18, 0x83, 0x6e,
-	0xaa, 0x65, 0xe8, 0x76, 0x09, 0xa5, 0x33, 0x7b, 0x02, 0xfd, 0x44, 0xe4, 0x4a, 0xa4, 0x4b, 0x74,
-	0x7b, 0x84, 0xd7, 0xb6, 0xf7, 0x12, 0xb6, 0xe6, 0x59, 0x1a, 0xc9, 0x25, 0x1b, 0x43, 0xe7, 0x12,
-	0xd7, 0x14, 0xdb, 0xe1, 0xe6, 0x68, 0x22, 0x5f, 0x89, 0x78, 0x85, 0x14, 0xd9, 0xe1, 0xd6, 0xf0,
-	0x7e, 0x82, 0xad, 0x23, 0xbc, 0x92, 0x01, 0x52, 0x2c, 0x91, 0x60, 0xf9, 0x09, 0x9d, 0xd9, 0x0b,
-	0xd8, 0x0a, 0x48, 0xcf, 0x6d, 0x4f, 0x3a, 0xd3, 0xc1, 0xec, 0xe1, 0x7e, 0xfd, 0xd8, 0x7d, 0x1b,
-	0x88, 0x97, 0x04, 0xef, 0xef, 0x36, 0xf4, 0x17, 0xa9, 0xc8, 0xf5, 0x45, 0x56, 0xfc, 0xa7, 0xd6,
-	0x2b, 0x18, 0xc4, 0x59, 0x20, 0xe2, 0xf9, 0xff, 0x08, 0x36, 0x59, 0xe6, 0xb1, 0xb9, 0xca, 0x22,
-	0x19, 0xa3, 0x76, 0x3b, 0x93, 0xce, 0xd4, 0xe1, 0xb5, 0xcd, 0x3e, 0x05, 0x07, 0xf3, 0x0b, 0x4c,
-	0x50, 0x89, 0x98, 0x32, 0xd4, 0xe7, 0x77, 0x00, 0xfb, 0x16, 0x86, 0x24, 0x64, 0x5f, 0xa7, 0xdd,
-	0xde, 0x47, 0xf1, 0xac, 0x87, 0x6f, 0xd0, 0x98, 0x07, 0x43, 0xa1, 0x82, 0x0b, 0x59, 0x60, 0x50,
-	0xac, 0x14, 0xba, 0x5b, 0x94, 0xe1, 0x0d, 0xcc, 0x5c, 0x4a, 0x17, 0xa2, 0xc0, 0x68, 0x15, 0xbb,
-	0xdb, 0x14, 0xb7, 0xb6, 0xd9, 0x33, 0x18, 0x05, 0x0a, 0x29, 0x80, 0x1f, 0x8a, 0x02, 0xdd, 0xfe,
-	0xa4, 0x35, 0xed, 0xf0, 0x61, 0x05, 0x1e, 0x89, 0x02, 0xd9, 0x73, 0xd8, 0x89, 0x85, 0x2e, 0xfc,
-	0x95, 0xc6, 0xd0, 0xb2, 0x1c, 0xcb, 0x32, 0xe8, 0xb9, 0xc6, 0xd0, 0xb0, 0xbc, 0x3f, 0x5a, 0x30,
-	0x52, 0x7a, 0x9d, 0x06, 0xc7, 0x28, 0x4c, 0x5c, 0x6d, 0xda, 0xe4, 0x46, 0x14, 0x85, 0xd2, 0x6e,
-	0x6b, 0xd2, 0x9a, 0xf6, 0x79, 0x69, 0x19, 0x3c, 0xc4, 0x18, 0x0b, 0x53, 0x5b, 0xc2, 0xad, 0x65,
-	0x2e, 0x1a, 0x64, 0x49, 0xae, 0x50, 0x9b, 0xec, 0x19, 0x4f, 0x6d, 0xb3, 0xe7, 0x30, 0xfa, 0x20,
-	0x43, 0xa9, 0x30, 0x30, 0xd7, 0xa2, 0x0c, 0x1a, 0xc2, 0x26, 0xe8, 0xbd, 0x80, 0xc1, 0x6d, 0xa4,
-	0xeb, 0x0b, 0x34, 0x05, 0x5b, 0x9b, 0x82, 0xde, 0x9f, 0x1d, 0x78, 0xf0, 0xbe, 0x4a, 0xee, 0x1b,
-	0x14, 0x21, 0x2a, 0xb6, 0x07, 0xed, 0x48, 0x53, 0x17, 0xec, 0xcc, 0x9e, 0x34, 0x52, 0x5f, 0xf3,
-	0x8e, 0x17, 0x66, 0x56, 0x78, 0x3b, 0xd2, 0xec, 0x6b, 0xe8, 0x06, 0x4a, 0xae, 0xe8, 0x09, 0x3b,
-	0xb3, 0x47, 0xcd, 0xc6, 0xe0, 0x6f, 0xcf, 0x89, 0x46, 0x04, 0xb6, 0x07, 0x3d, 0x19, 0x26, 0x22,
-	0xa7, 0x86, 0x18, 0xcc, 0x76, 0x1b, 0xcc, 0x7a, 0xfa, 0xb8, 0xa5, 0x98, 0x57, 0xea, 0xb2, 0x29,
-	0x4f, 0x44, 0x82, 0xda, 0xed, 0x52, 0x13, 0x6d, 0x82, 0xec, 0x1b, 0x70, 0x2a, 0xa0, 0x6a, 0x94,
-	0x66, 0xfc, 0xaa, 0xad, 0xf9, 0x1d, 0x8b, 0xb9, 0xb0, 0x9d, 0x2b, 0x0c, 0x57, 0x49, 0xee, 0x6e,
-	0x53, 0x22, 0x2a, 0x93, 0x7d, 0x7f, 0xaf, 0x6a, 0xd4, 0x01, 0x83, 0x99, 0xdb, 0x10, 0xdc, 0xf0,
-	0xf3, 0x7b, 0x45, 0x76, 0x61, 0x5b, 0x61, 0xa4, 0x50, 0x5f, 0x50, 0x57, 0xf4, 0x79, 0x65, 0xb2,
-	0xd7, 0x1b, 0xc5, 0x70, 0x81, 0x74, 0x1f, 0x37, 0x74, 0x1b, 0x5e, 0xde, 0xa4, 0x7a, 0xc7, 0x30,
-	0xae, 0x53, 0x3e, 0xcf, 0xd2, 0x42, 0x65, 0xb1, 0x89, 0xa3, 0x57, 0x41, 0x60, 0x4b, 0x69, 0x9a,
-	0xb8, 0x32, 0x8d, 0x27, 0x41, 0xad, 0xc5, 0xd2, 0xf6, 0x93, 0xc3, 0x2b, 0xd3, 0x7b, 0x05, 0xa3,
-	0x5a, 0x67, 0xb1, 0x4e, 0x03, 0x33, 0x2e, 0x91, 0x4c, 0x45, 0x7c, 0xaa, 0xf0, 0xc8, 0xe4, 0xc2,
-	0x2a, 0x6d, 0x60, 0xde, 0x5f, 0x1d, 0x18, 0x9b, 0xcc, 0xf8, 0x66, 0x48, 0xb4, 0x8f, 0x69, 0xa1,
-	0xd6, 0x66, 0x4e, 0x22, 0x85, 0x78, 0x2b, 0xd3, 0xa5, 0x5f, 0xc8, 0x72, 0x55, 0x8c, 0xf8, 0xb0,
-	0x02, 0xcf, 0x64, 0x82, 0xec, 0x0b, 0x18, 0x44, 0x2a, 0xbb, 0xc5, 0xd4, 0x52, 0xda, 0x44, 0x01,
-	0x0b, 0x11, 0xe1, 0x4b, 0x18, 0x26, 0x98, 0x90, 0x38, 0x31, 0x3a, 0xc4, 0x18, 0x94, 0x18, 0x51,
-	0x9e, 0xc1, 0x28, 0xc1, 0xe4, 0x5a, 0xc9, 0x02, 0x2d, 0xa7, 0x6b, 0x03, 0x55, 0x60, 0x45, 0xca,
-	0xc5, 0x12, 0xb5, 0xaf, 0x03, 0x91, 0xa6, 0x18, 0xd2, 0x62, 0xed, 0xf2, 0x21, 0x81, 0x0b, 0x8b,
-	0xb1, 0x97, 0xb0, 0x5b, 0x92, 0x2e, 0x65, 0x9e, 0x63, 0xe8, 0xe7, 0x42, 0x61, 0x5a, 0xd0, 0x8a,
-	0xe8, 0x72, 0x66, 0xb9, 0xd6, 0x75, 0x4a, 0x9e, 0x3b, 0x59, 0x13, 0xa9, 0xc0, 0x94, 0xb6, 0x45,
-	0x25, 0xfb, 0x8b, 0xc5, 0x0c, 0x49, 0xaa, 0x44, 0xe4, 0xbe, 0x42, 0x9d, 0xc5, 0x57, 0x76, 0x63,
-	0x8c, 0xf8, 0x90, 0x40, 0x6e, 0x31, 0xf6, 0x19, 0x80, 0x55, 0x8a, 0xc5, 0xed, 0xda, 0x75, 0x48,
-	0xc6, 0x21, 0xe4, 0x9d, 0xb8, 0x5d, 0x57, 0x6e, 0x3f, 0x97, 0x79, 0xd9, 0x18, 0xa5, 0xfb, 0xd4,
-	0x00, 0x66, 0xdf, 0xd4, 0x6e, 0xff, 0xc3, 0x2a, 0xd2, 0xee, 0x80, 0x28, 0xc3, 0x8a, 0x72, 0xb8,
-	0x8a, 0xb4, 0xf7, 0x4f, 0x0b, 0x1e, 0x29, 0xd4, 0x45, 0xa6, 0x70, 0xa3, 0x54, 0x5f, 0xd9, 0xaf,
-	0xb5, 0x6f, 0x46, 0x5d, 0x28, 0xb4, 0x7f, 0xb4, 0x2e, 0xb7, 0x6f, 0x9b, 0x97, 0x20, 0xdb, 0x83,
-	0x87, 0x9b, 0xe9, 0x09, 0xb2, 0x6b, 0x2a, 0x59, 0x97, 0x3f, 0x68, 0xe6, 0x66, 0x9e, 0x5d, 0x9b,
-	0xba, 0x45, 0x99, 0xba, 0xac, 0x8b, 0x5f, 0xd6, 0xad, 0xc4, 0xaa, 0xd2, 0x56, 0x97, 0x69, 0x94,
-	0x6d, 0x50, 0x62, 0x44, 0xa9, 0x2f, 0x56, 0x82, 0xa6, 0x6c, 0xad, 0xfa, 0x62, 0xbc, 0x04, 0xbd,
-	0x1b, 0x18, 0x34, 0x9f, 0x73, 0x00, 0xdd, 0xd0, 0xb6, 0xaa, 0x19, 0x9f, 0xa7, 0x8d, 0xf1, 0xb9,
-	0xdf, 0xa4, 0x9c, 0x88, 0xec, 0xb5, 0x19, 0x48, 0xd2, 0xa2, 0x71, 0x18, 0xcc, 0x3e, 0x6f, 0x8e,
-	0xf2, 0xc7, 0x09, 0xe3, 0x15, 0x7d, 0xef, 0xbb, 0xc6, 0x46, 0xb4, 0x9b, 0x8e, 0x39, 0xd0, 0xe3,
-	0x8b, 0x5f, 0x4f, 0xe6, 0xe3, 0x4f, 0xcc, 0xf1, 0xf0, 0x8c, 0x1f, 0x2f, 0xc6, 0x2d, 0xb6, 0x0d,
-	0x9d, 0xdf, 0x8e, 0x17, 0xe3, 0xb6, 0x39, 0xf0, 0xc3, 0xa3, 0x71, 0x67, 0xef, 0x00, 0xfa, 0xd5,
-	0xda, 0x63, 0x3b, 0x00, 0xe6, 0xec, 0x37, 0x3e, 0x3c, 0x7d, 0xf3, 0xc3, 0xf9, 0xbb, 0x71, 0x8b,
-	0xf5, 0xa1, 0x7b, 0xf2, 0xf3, 0xc9, 0x8f, 0xe3, 0xf6, 0xbf, 0x01, 0x00, 0x00, 0xff, 0xff, 0xcf,
-	0xd6, 0xdc, 0x0b, 0xa4, 0x08, 0x00, 0x00,
+	// 1110 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0x85, 0x55, 0xcd, 0x6e, 0xdb, 0x46,
+	0x10, 0xae, 0x44, 0xda, 0x16, 0x87, 0xb2, 0xa3, 0x6c, 0x8c, 0x40, 0x48, 0xda, 0x34, 0x65, 0x5a,
+	0xd4, 0xf1, 0xc1, 0x4e, 0x15, 0x14, 0x68, 0x2f, 0x01, 0x6a, 0xbb, 0x6e, 0x02, 0x24, 0xae, 0xb1,
+	0xb2, 0x51, 0xb4, 0x17, 0x82, 0x26, 0x57, 0x12, 0x61, 0x8a, 0x24, 0xb8, 0xa4, 0xff, 0x2e, 0x7d,
+	0x9a, 0xbe, 0x43, 0xdf, 0xa2, 0xa7, 0x3e, 0x4a, 0xef, 0x9d, 0xd9, 0x5d, 0xd2, 0xa4, 0x52, 0xa0,
+	0xb7, 0x9d, 0x6f, 0xbe, 0x9d, 0x99, 0x9d, 0xbf, 0x85, 0xa7, 0xc9, 0x4d, 0xb4, 0xbf, 0x8c, 0xe7,
+	0x45, 0x50, 0xc6, 0x59, 0x6a, 0x4e, 0x62, 0x2f, 0x2f, 0xb2, 0x32, 0x63, 0x4e, 0xa3, 0xf0, 0x7e,
+	0x07, 0xe7, 0xdd, 0xd1, 0x87, 0x20, 0x3f, 0xbb, 0xcd, 0x05, 0xdb, 0x86, 0xb5, 0x58, 0x56, 0x71,
+	0x34, 0xee, 0x3d, 0xef, 0xef, 0x0c, 0xb8, 0x16, 0x34, 0x3a, 0x47, 0xb4, 0x5f, 0xa3, 0x28, 0xb0,
+	0xc7, 0xb0, 0xbe, 0xc8, 0x64, 0x89, 0xb0, 0x85, 0xf0, 0x1a, 0x37, 0x12, 0x63, 0x60, 0xa7, 0x12,
+	0x51, 0x5b, 0xa1, 0xea, 0xcc, 0x9e, 0xc0, 0x60, 0x19, 0xe4, 0x45, 0x90, 0xce, 0xc5, 0x78, 0x4d,
+	0xe1, 0x8d, 0xec, 0xbd, 0x82, 0xf5, 0xc3, 0x2c, 0x9d, 0xc5, 0x73, 0x36, 0x02, 0xeb, 0x52, 0xdc,
+	0x2a, 0xdf, 0x0e, 0xa7, 0x23, 0x79, 0xbe, 0x0a, 0x92, 0x4a, 0x28, 0xcf, 0x0e, 0xd7, 0x82, 0xf7,
+	0x13, 0xac, 0x1f, 0x89, 0xab, 0x38, 0x14, 0xca, 0x57, 0xb0, 0x14, 0xe6, 0x8a, 0x3a, 0xb3, 0x97,
+	0xb0, 0x1e, 0x2a, 0x7b, 0x78, 0xc9, 0xda, 0x71, 0x27, 0x0f, 0xf7, 0x9a, 0xc7, 0xee, 0x69, 0x47,
+	0xdc, 0x10, 0xbc, 0xbf, 0xfa, 0x30, 0x98, 0xa6, 0x41, 0x2e, 0x17, 0x59, 0xf9, 0x9f, 0xb6, 0x5e,
+	0x83, 0x9b, 0x64, 0x61, 0x90, 0x1c, 0xfe, 0x8f, 0xc1, 0x36, 0x8b, 0x1e, 0x8b, 0x59, 0x9e, 0xc5,
+	0x89, 0x90, 0x98, 0x1a, 0x0b, 0x8d, 0x35, 0x32, 0xfb, 0x14, 0x1c, 0x91, 0x2f, 0xc4, 0x52, 0x14,
+	0x41, 0xa2, 0x32, 0x34, 0xe0, 0xf7, 0x00, 0xfb, 0x16, 0x86, 0xca, 0x90, 0x7e, 0x9d, 0xc4, 0x54,
+	0xad, 0xfa, 0xd3, 0x1a, 0xde, 0xa1, 0x31, 0x0f, 0x86, 0x41, 0x11, 0x2e, 0xe2, 0x52, 0x84, 0x65,
+	0x55, 0x88, 0xf1, 0xba, 0xca, 0x70, 0x07, 0xa3, 0xa0, 0x64, 0x89, 0x0d, 0x30, 0xab, 0x92, 0xf1,
+	0x86, 0xf2, 0xdb, 0xc8, 0xec, 0x05, 0x6c, 0x86, 0x85, 0x50, 0x0e, 0xfc, 0x08, 0xb1, 0xf1, 0xe0,
+	0x79, 0x6f, 0xc7, 0xe2, 0xc3, 0x1a, 0x3c, 0x42, 0x8c, 0x7d, 0x09, 0x5b, 0x49, 0x20, 0x4b, 0xbf,
+	0x92, 0x22, 0xd2, 0x2c, 0x47, 0xb3, 0x08, 0x3d, 0x47, 0x90, 0x58, 0xde, 0x9f, 0x3d, 0xd8, 0x2c,
+	0xe4, 0x6d, 0x1a, 0x1e, 0xe3, 0x55, 0xf4, 0x2b, 0xa9, 0x4d, 0x6e, 0x82, 0xb2, 0x2c, 0x24, 0x26,
+	0xb6, 0x87, 0x6e, 0x8d, 0x44, 0x78, 0x24, 0x12, 0x51, 0x52, 0x6d, 0x15, 0xae, 0x25, 0x0a, 0x34,
+	0xcc, 0x96, 0x39, 0x5e, 0xa5, 0xec, 0x91, 0xa6, 0x91, 0x31, 0x86, 0xcd, 0x8b, 0x38, 0x8a, 0x0b,
+	0x7c, 0x13, 0x86, 0xa5, 0x32, 0x48, 0x84, 0x2e, 0x48, 0x96, 0x65, 0x1e, 0x14, 0x92, 0x5a, 0x4d,
+	0x59, 0xd6, 0x12, 0xfb, 0x0c, 0x20, 0x89, 0xaf, 0x84, 0x7f, 0x81, 0xc9, 0xbb, 0xc4, 0x24, 0x91,
+	0xce, 0x21, 0xe4, 0x80, 0x00, 0xef, 0x25, 0xb8, 0x77, 0x33, 0xd9, 0xc4, 0xdd, 0x8e, 0xa3, 0xd7,
+	0x8d, 0xc3, 0xdb, 0xc7, 0x38, 0xca, 0xa2, 0x45, 0x7e, 0x06, 0x20, 0xab, 0x8b, 0xab, 0x2c, 0xa9,
+	0x96, 0xa2, 0xa6, 0xb7, 0x10, 0xef, 0x1f, 0x0b, 0x1e, 0x7c, 0xa8, 0x8b, 0xf8, 0x56, 0x04, 0x91,
+	0x28, 0xd8, 0x2e, 0xf4, 0x67, 0x52, 0x75, 0xdb, 0xd6, 0xe4, 0x49, 0xab, 0xc4, 0x0d, 0xef, 0x78,
+	0x4a, 0x33, 0xc9, 0x91, 0xc5, 0xbe, 0x06, 0x3b, 0x2c, 0xe2, 0x4a, 0xa5, 0x6a, 0x6b, 0xf2, 0xa8,
+	0xdd, 0x80, 0xfc, 0xdd, 0xb9, 0xa2, 0x29, 0x02, 0x1a, 0x5d, 0x8b, 0x23, 0x1c, 0x2d, 0xd5, 0x78,
+	0xee, 0x64, 0xbb, 0xc5, 0x6c, 0xa6, 0x9c, 0x6b, 0x0a, 0x65, 0x53, 0x9a, 0xe6, 0x3f, 0x09, 0x28,
+	0x6e, 0x5b, 0x35, 0x6b, 0x17, 0x64, 0xdf, 0x80, 0x53, 0x03, 0x75, 0x43, 0xb6, 0xfd, 0xd7, 0xe3,
+	0xc3, 0xef, 0x59, 0x6c, 0x0c, 0x1b, 0x98, 0xa7, 0xa8, 0x5a, 0xe6, 0xd8, 0x6a, 0x94, 0x8a, 0x5a,
+	0x64, 0x6f, 0x56, 0xba, 0x43, 0x75, 0x9a, 0x3b, 0x19, 0xb7, 0x0c, 0x76, 0xf4, 0x7c, 0xa5, 0x99,
+	0xd0, 0x72, 0x21, 0x66, 0x78, 0x5a, 0xa8, 0xee, 0x43, 0xcb, 0x46, 0x64, 0xdf, 0x75, 0xaa, 0x37,
+	0x06, 0x65, 0xf7, 0x71, 0xcb, 0x6e, 0x4b, 0xcb, 0x3b, 0x85, 0x7e, 0xb3, 0x52, 0xcc, 0xb1, 0xfb,
+	0x51, 0x4c, 0x1d, 0x3d, 0x5f, 0xa9, 0x3d, 0x35, 0xca, 0x42, 0x84, 0x97, 0xb2, 0x5a, 0x8e, 0x87,
+	0xa6, 0x51, 0x8c, 0xec, 0x5d, 0xc0, 0xa8, 0x29, 0x27, 0x6e, 0x87, 0xb2, 0xc8, 0x12, 0x7a, 0x83,
+	0xac, 0xc2, 0x50, 0xf7, 0x15, 0x0d, 0x62, 0x2d, 0x92, 0x06, 0x33, 0x2e, 0x83, 0xb9, 0x9e, 0x09,
+	0x87, 0xd7, 0x62, 0xc7, 0x87, 0xa5, 0x54, 0xf7, 0x3e, 0x5e, 0xc3, 0x66, 0xe3, 0x63, 0x8a, 0xc9,
+	0xa2, 0x75, 0x30, 0x8b, 0x71, 0x10, 0x4e, 0x0b, 0x71, 0x44, 0x35, 0xd0, 0x5e, 0x3a, 0x98, 0xf7,
+	0x87, 0x05, 0x23, 0xaa, 0x88, 0x4f, 0x4b, 0x40, 0xfa, 0x02, 0x43, 0xbb, 0xa5, 0x3d, 0x80, 0xc9,
+	0x14, 0x77, 0x71, 0x3a, 0xf7, 0xcb, 0xd8, 0xac, 0xc2, 0x4d, 0xbc, 0x69, 0xc0, 0x33, 0xc4, 0xd8,
+	0xe7, 0xe0, 0xce, 0x8a, 0xec, 0x4e, 0xa4, 0x9a, 0xd2, 0x57, 0x14, 0xd0, 0x90, 0x22, 0x7c, 0x01,
+	0xc3, 0xa5, 0x58, 0x2a, 0xe3, 0x8a, 0x61, 0x29, 0x86, 0x6b, 0x30, 0x45, 0x41, 0x47, 0x28, 0x5e,
+	0x17, 0xb8, 0x9d, 0x34, 0xc7, 0xd6, 0x8e, 0x6a, 0xb0, 0x26, 0xe5, 0xf8, 0x76, 0xe9, 0xcb, 0x30,
+	0x48, 0x53, 0x11, 0xa9, 0x8f, 0xc3, 0xe6, 0x43, 0x05, 0x4e, 0x35, 0xc6, 0x5e, 0xc1, 0xb6, 0x21,
+	0x5d, 0xc6, 0x79, 0x8e, 0x9b, 0x09, 0x47, 0x1d, 0x1f, 0xa3, 0x56, 0xa0, 0xcd, 0x99, 0xe6, 0x6a,
+	0xd5, 0xa9, 0xd2, 0xdc, 0x9b, 0x25, 0x4f, 0xa5, 0x48, 0xd5, 0x36, 0xac, 0xcd, 0xfe, 0xa2, 0x31,
+	0x22, 0xc5, 0x05, 0xce, 0x88, 0x8f, 0x05, 0xce, 0x92, 0x2b, 0xbd, 0x11, 0x31, 0x40, 0x05, 0x72,
+	0x8d, 0xd1, 0x3e, 0xd1, 0x96, 0x92, 0xe0, 0xee, 0x16, 0xfb, 0x91, 0xcc, 0x38, 0x0a, 0x79, 0x8f,
+	0x40, 0xad, 0xf6, 0xf3, 0x38, 0x37, 0x0d, 0x69, 0xd4, 0xa7, 0x04, 0xd0, 0x3e, 0x6d, 0xd4, 0xfe,
+	0x45, 0x35, 0xd3, 0x7d, 0x67, 0x02, 0x21, 0xca, 0x01, 0x62, 0xde, 0xdf, 0x3d, 0x78, 0x84, 0x31,
+	0x94, 0x59, 0x21, 0x3a, 0xa5, 0xfa, 0x4a, 0xdf, 0x96, 0x3e, 0xed, 0x24, 0x7c, 0x98, 0xfe, 0xb1,
+	0x6d, 0xae, 0xdf, 0x76, 0x68, 0x40, 0x5c, 0x07, 0x0f, 0xbb, 0xe9, 0x09, 0xb3, 0x6b, 0x55, 0x32,
+	0x9b, 0x3f, 0x68, 0xe7, 0xe6, 0x30, 0xbb, 0xa6, 0xba, 0xcd, 0xb2, 0xe2, 0xb2, 0x29, 0xbe, 0xa9,
+	0x9b, 0xc1, 0xea, 0xd2, 0xd6, 0xc1, 0xb4, 0xca, 0xe6, 0x1a, 0x4c, 0x51, 0x9a, 0xc0, 0x0c, 0x18,
+	0xa9, 0x25, 0x5c, 0x07, 0xc6, 0x0d, 0xe8, 0xdd, 0x80, 0xdb, 0x7e, 0xce, 0x3e, 0xd8, 0x91, 0x6e,
+	0x55, 0x1a, 0xbd, 0xa7, 0xad, 0xd1, 0x5b, 0x6d, 0x52, 0xae, 0x88, 0x38, 0xee, 0x1b, 0xc6, 0x81,
+	0x1a, 0x15, 0x77, 0xf2, 0xac, 0xbd, 0x42, 0x3e, 0x4e, 0x18, 0xaf, 0xe9, 0xbb, 0xdf, 0xb7, 0x36,
+	0xb1, 0xde, 0xb0, 0xcc, 0x81, 0x35, 0x3e, 0xfd, 0xf5, 0xe4, 0x70, 0xf4, 0x09, 0x1d, 0x0f, 0xce,
+	0xf8, 0xf1, 0x74, 0xd4, 0x63, 0x1b, 0x60, 0xfd, 0x86, 0x87, 0x3e, 0x1d, 0xf8, 0xc1, 0xd1, 0xc8,
+	0xda, 0xdd, 0x87, 0x41, 0xbd, 0x6e, 0xd9, 0x16, 0x00, 0x9d, 0xfd, 0xd6, 0xc5, 0xd3, 0xb7, 0x3f,
+	0x9c, 0xbf, 0xc7, 0x8b, 0x03, 0xb0, 0x4f, 0x7e, 0x3e, 0xf9, 0x71, 0xd4, 0xff, 0x17, 0x8b, 0x95,
+	0x40, 0x95, 0x84, 0x09, 0x00, 0x00,
 }
@@ -23,6 +23,14 @@ type VolumeSourceArgs struct {
 	Snapshots     []string
 	MigrationType Type
 	TrackProgress bool
+
+	// Limit of the rate the volume is sent at, in the syntax of rsync.bwlimit. The lowest of it
+	// and the rsync.bwlimit of the pool applies.
+	BandwidthLimit string
+
+	// Called once the disk of a running virtual machine was sent, to stop its writes before
+	// the changes made in the meantime are sent. Only used with the "live_block" feature.
+	Freeze func() error
 }
 
 // VolumeTargetArgs represents the arguments needed to setup a volume migration sink.
@@ -33,11 +41,15 @@ type VolumeTargetArgs struct {
 	Snapshots     []string
 	MigrationType Type
 	TrackProgress bool
+
+	// Content type of the volume, a filesystem if empty. Only set for copies between local pools.
+	ContentType string
 }
 
 // TypesToHeader converts one or more Types to a MigrationHeader. It uses the first type argument
 // supplied to indicate the preferred migration method and sets the MigrationHeader's Fs type
-// to that. If the preferred type is ZFS then it will also set the header's optional ZfsFeatures.
+// to that. If the preferred type is ZFS or BTRFS then it will also set the header's optional
+// ZfsFeatures or BtrfsFeatures.
 // If the fallback Rsync type is present in any of the types even if it is not preferred, then its
 // optional features are added to the header's RsyncFeatures, allowing for fallback negotiation to
 // take place on the farside.
@@ -61,6 +73,20 @@ func TypesToHeader(types ...Type) MigrationHeader {
 		header.ZfsFeatures = &features
 	}
 
+	// Add BTRFS features if preferred type is BTRFS.
+	if preferredType.FSType == MigrationFSType_BTRFS {
+		features := BtrfsFeatures{
+			Subvolumes: &missingFeature,
+		}
+		for _, feature := range preferredType.Features {
+			if feature == "subvolumes" {
+				features.Subvolumes = &hasFeature
+			}
+		}
+
+		header.BtrfsFeatures = &features
+	}
+
 	// Check all the types for an Rsync method, if found then add its features to the header's
 	// RsyncFeatures list.
 	for _, t := range types {
@@ -73,6 +99,8 @@ func TypesToHeader(types ...Type) MigrationHeader {
 			Delete:        &missingFeature,
 			Compress:      &missingFeature,
 			Bidirectional: &missingFeature,
+			Sparse:        &missingFeature,
+			LiveBlock:     &missingFeature,
 		}
 
 		for _, feature := range t.Features {
@@ -84,6 +112,10 @@ func TypesToHeader(types ...Type) MigrationHeader {
 				features.Compress = &hasFeature
 			} else if feature == "bidirectional" {
 				features.Bidirectional = &hasFeature
+			} else if feature == "sparse" {
+				features.Sparse = &hasFeature
+			} else if feature == "live_block" {
+				features.LiveBlock = &hasFeature
 			}
 		}
 
@@ -116,6 +148,8 @@ func MatchTypes(offer MigrationHeader, fallbackType MigrationFSType, ourTypes []
 			var offeredFeatures []string
 			if offerFSType == MigrationFSType_ZFS {
 				offeredFeatures = offer.GetZfsFeaturesSlice()
+			} else if offerFSType == MigrationFSType_BTRFS {
+				offeredFeatures = offer.GetBtrfsFeaturesSlice()
 			} else if offerFSType == MigrationFSType_RSYNC {
 				offeredFeatures = offer.GetRsyncFeaturesSlice()
 			}
@@ -167,6 +201,35 @@ func progressWrapperRender(op *operations.Operation, key string, description str
 	}
 }
 
+func progressPercentRender(op *operations.Operation, key string, description string, percent int64, speedInt int64) {
+	meta := op.Metadata()
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+
+	progress := fmt.Sprintf("%d%% (%s/s)", percent, units.GetByteSizeString(speedInt, 2))
+	if description != "" {
+		progress = fmt.Sprintf("%s: %d%% (%s/s)", description, percent, units.GetByteSizeString(speedInt, 2))
+	}
+
+	if meta[key] != progress {
+		meta[key] = progress
+		op.UpdateMetadata(meta)
+	}
+}
+
+// ProgressPercentHandler returns the handler reporting the progress of a transfer as a percentage,
+// for trackers of a known length. It returns nil if there's no operation to report to.
+func ProgressPercentHandler(op *operations.Operation, key string, description string) func(int64, int64) {
+	if op == nil {
+		return nil
+	}
+
+	return func(percent int64, speedInt int64) {
+		progressPercentRender(op, key, description, percent, speedInt)
+	}
+}
+
 // ProgressReader reports the read progress.
 func ProgressReader(op *operations.Operation, key string, description string) func(io.ReadCloser) io.ReadCloser {
 	return func(reader io.ReadCloser) io.ReadCloser {
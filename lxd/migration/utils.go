@@ -22,6 +22,14 @@ func (m *MigrationHeader) GetRsyncFeaturesSlice() []string {
 		if m.RsyncFeatures.Bidirectional != nil && *m.RsyncFeatures.Bidirectional == true {
 			features = append(features, "bidirectional")
 		}
+
+		if m.RsyncFeatures.Sparse != nil && *m.RsyncFeatures.Sparse == true {
+			features = append(features, "sparse")
+		}
+
+		if m.RsyncFeatures.LiveBlock != nil && *m.RsyncFeatures.LiveBlock == true {
+			features = append(features, "live_block")
+		}
 	}
 
 	return features
@@ -41,3 +49,18 @@ func (m *MigrationHeader) GetZfsFeaturesSlice() []string {
 
 	return features
 }
+
+func (m *MigrationHeader) GetBtrfsFeaturesSlice() []string {
+	features := []string{}
+	if m == nil {
+		return features
+	}
+
+	if m.BtrfsFeatures != nil {
+		if m.BtrfsFeatures.Subvolumes != nil && *m.BtrfsFeatures.Subvolumes == true {
+			features = append(features, "subvolumes")
+		}
+	}
+
+	return features
+}
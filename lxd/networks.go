@@ -18,26 +18,30 @@ import (
 	"github.com/pkg/errors"
 
 	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/lxd/apparmor"
 	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/daemon"
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/device"
 	"github.com/lxc/lxd/lxd/dnsmasq"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
-	"github.com/lxc/lxd/lxd/iptables"
 	"github.com/lxc/lxd/lxd/node"
 	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
-	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/logging"
 	"github.com/lxc/lxd/shared/version"
 )
 
 // Lock to prevent concurent networks creation
 var networkCreateLock sync.Mutex
 
+// networkLogger tags the messages about networks, so that their log level can be set with the
+// core.log_level.network config key.
+var networkLogger = logging.Subsystem("network")
+
 var networksCmd = APIEndpoint{
 	Path: "networks",
 
@@ -55,6 +59,12 @@ var networkCmd = APIEndpoint{
 	Put:    APIEndpointAction{Handler: networkPut},
 }
 
+var networkAllocationsCmd = APIEndpoint{
+	Path: "networks/{name}/allocations",
+
+	Get: APIEndpointAction{Handler: networkAllocationsGet, AccessHandler: AllowAuthenticated},
+}
+
 var networkLeasesCmd = APIEndpoint{
 	Path: "networks/{name}/leases",
 
@@ -71,6 +81,11 @@ var networkStateCmd = APIEndpoint{
 func networksGet(d *Daemon, r *http.Request) response.Response {
 	recursion := util.IsRecursionRequest(r)
 
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
 	ifs, err := networkGetInterfaces(d.cluster)
 	if err != nil {
 		return response.InternalError(err)
@@ -86,6 +101,12 @@ func networksGet(d *Daemon, r *http.Request) response.Response {
 			if err != nil {
 				continue
 			}
+
+			net.ETag, err = util.EtagHash(networkEtag(&net, clustered))
+			if err != nil {
+				return response.InternalError(err)
+			}
+
 			resultMap = append(resultMap, net)
 		}
 	}
@@ -98,9 +119,6 @@ func networksGet(d *Daemon, r *http.Request) response.Response {
 }
 
 func networksPost(d *Daemon, r *http.Request) response.Response {
-	networkCreateLock.Lock()
-	defer networkCreateLock.Unlock()
-
 	req := api.NetworksPost{}
 
 	// Parse the request
@@ -109,12 +127,21 @@ func networksPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	return doNetworksPost(d, req, queryParam(r, "target"), isClusterNotification(r))
+}
+
+// Create a network, or only define it on the given target node. A cluster notification triggers
+// the actual creation of a network previously defined on all nodes.
+func doNetworksPost(d *Daemon, req api.NetworksPost, targetNode string, notification bool) response.Response {
+	networkCreateLock.Lock()
+	defer networkCreateLock.Unlock()
+
 	// Sanity checks
 	if req.Name == "" {
 		return response.BadRequest(fmt.Errorf("No name provided"))
 	}
 
-	err = networkValidName(req.Name)
+	err := networkValidName(req.Name)
 	if err != nil {
 		return response.BadRequest(err)
 	}
@@ -135,7 +162,7 @@ func networksPost(d *Daemon, r *http.Request) response.Response {
 	url := fmt.Sprintf("/%s/networks/%s", version.APIVersion, req.Name)
 	resp := response.SyncResponseLocation(true, nil, url)
 
-	if isClusterNotification(r) {
+	if notification {
 		// This is an internal request which triggers the actual
 		// creation of the network across all nodes, after they have
 		// been previously defined.
@@ -146,7 +173,6 @@ func networksPost(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
-	targetNode := queryParam(r, "target")
 	if targetNode != "" {
 		// A targetNode was specified, let's just define the node's
 		// network without actually creating it. The only legal key
@@ -265,23 +291,25 @@ func networksPostCluster(d *Daemon, req api.NetworksPost) error {
 	}
 
 	// Notify all other nodes to create the network.
-	notifier, err := cluster.NewNotifier(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAll)
-	if err != nil {
-		return err
-	}
-	notifyErr := notifier(func(client lxd.InstanceServer) error {
-		server, _, err := client.GetServer()
-		if err != nil {
-			return err
-		}
+	changes := []cluster.NotifyChange{{
+		Description: fmt.Sprintf("create network %s", req.Name),
+		Apply: func(client lxd.InstanceServer) error {
+			server, _, err := client.GetServer()
+			if err != nil {
+				return err
+			}
 
-		nodeReq := req
-		for key, value := range configs[server.Environment.ServerName] {
-			nodeReq.Config[key] = value
-		}
+			nodeReq := req
+			nodeReq.Config = util.CopyConfig(req.Config)
+			for key, value := range configs[server.Environment.ServerName] {
+				nodeReq.Config[key] = value
+			}
 
-		return client.CreateNetwork(nodeReq)
-	})
+			return client.CreateNetwork(nodeReq)
+		},
+	}}
+
+	_, notifyErr := cluster.NotifyBatch(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAll, changes)
 
 	errored := notifyErr != nil
 
@@ -378,7 +406,7 @@ func networkGet(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
-	etag := []interface{}{n.Name, n.Managed, n.Type, n.Description, n.Config}
+	etag := networkEtag(&n, false)
 
 	return response.SyncResponseETag(true, &n, etag)
 }
@@ -458,6 +486,13 @@ func doNetworkGet(d *Daemon, name string) (api.Network, error) {
 
 func networkDelete(d *Daemon, r *http.Request) response.Response {
 	name := mux.Vars(r)["name"]
+
+	return doNetworkDelete(d, name, isClusterNotification(r))
+}
+
+// Delete a network, notifying the other nodes unless this is itself a notification, in which case
+// the network is only deleted from the system.
+func doNetworkDelete(d *Daemon, name string, notification bool) response.Response {
 	state := d.State()
 
 	// Check if the network is pending, if so we just need to delete it from
@@ -481,7 +516,7 @@ func networkDelete(d *Daemon, r *http.Request) response.Response {
 	}
 
 	withDatabase := true
-	if isClusterNotification(r) {
+	if notification {
 		withDatabase = false // We just want to delete the network from the system
 	} else {
 		// Sanity checks
@@ -580,6 +615,10 @@ func networkPost(d *Daemon, r *http.Request) response.Response {
 func networkPut(d *Daemon, r *http.Request) response.Response {
 	name := mux.Vars(r)["name"]
 
+	// Serialize with other updates of the same network until done.
+	unlock := etagLock("network", "", name)
+	defer unlock()
+
 	// Get the existing network
 	_, dbInfo, err := d.cluster.NetworkGet(name)
 	if err != nil {
@@ -601,7 +640,7 @@ func networkPut(d *Daemon, r *http.Request) response.Response {
 	}
 
 	// Validate the ETag
-	etag := []interface{}{dbInfo.Name, dbInfo.Managed, dbInfo.Type, dbInfo.Description, dbInfo.Config}
+	etag := networkEtag(dbInfo, false)
 
 	err = util.EtagCheck(r, etag)
 	if err != nil {
@@ -613,12 +652,27 @@ func networkPut(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	// A notification carries the previous configuration, the new one being
+	// already in the database.
+	if isClusterNotification(r) {
+		err = doNetworkUpdateCluster(d, name, req)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return response.EmptySyncResponse
+	}
+
 	return doNetworkUpdate(d, name, dbInfo.Config, req)
 }
 
 func networkPatch(d *Daemon, r *http.Request) response.Response {
 	name := mux.Vars(r)["name"]
 
+	// Serialize with other updates of the same network until done.
+	unlock := etagLock("network", "", name)
+	defer unlock()
+
 	// Get the existing network
 	_, dbInfo, err := d.cluster.NetworkGet(name)
 	if err != nil {
@@ -640,7 +694,7 @@ func networkPatch(d *Daemon, r *http.Request) response.Response {
 	}
 
 	// Validate the ETag
-	etag := []interface{}{dbInfo.Name, dbInfo.Managed, dbInfo.Type, dbInfo.Description, dbInfo.Config}
+	etag := networkEtag(dbInfo, false)
 
 	err = util.EtagCheck(r, etag)
 	if err != nil {
@@ -652,6 +706,17 @@ func networkPatch(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	// A notification carries the previous configuration, the new one being
+	// already in the database.
+	if isClusterNotification(r) {
+		err = doNetworkUpdateCluster(d, name, req)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return response.EmptySyncResponse
+	}
+
 	// Config stacking
 	if req.Config == nil {
 		req.Config = map[string]string{}
@@ -687,14 +752,110 @@ func doNetworkUpdate(d *Daemon, name string, oldConfig map[string]string, req ap
 		return response.NotFound(err)
 	}
 
-	err = n.Update(req)
+	description := n.description
+
+	err = n.Update(req, true)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	// Have the other nodes set up their own copy of the network again. Nodes
+	// which are down do it once they're back.
+	old := api.NetworkPut{
+		Description: description,
+		Config:      util.CopyConfig(oldConfig),
+	}
+
+	for _, key := range db.NetworkNodeConfigKeys {
+		delete(old.Config, key)
+	}
+
+	changes := []cluster.NotifyChange{{
+		Description: fmt.Sprintf("update network %s", name),
+		Apply: func(client lxd.InstanceServer) error {
+			return client.UpdateNetwork(name, old, "")
+		},
+	}}
+
+	statuses, err := cluster.NotifyBatch(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAlive, changes)
+	queueErr := clusterChangeQueue(d, statuses, clusterChangeNetwork, "", name, old)
 	if err != nil {
 		return response.SmartError(err)
 	}
 
+	if queueErr != nil {
+		return response.SmartError(queueErr)
+	}
+
 	return response.EmptySyncResponse
 }
 
+// Like doNetworkUpdate but does not update the database, since it was already
+// updated by the notifying node. The given request holds the previous global
+// configuration of the network.
+func doNetworkUpdateCluster(d *Daemon, name string, old api.NetworkPut) error {
+	n, err := networkLoadByName(d.State(), name)
+	if err != nil {
+		return err
+	}
+
+	// Complement the previous configuration with our node-specific values,
+	// which don't change.
+	oldConfig := util.CopyConfig(old.Config)
+	for _, key := range db.NetworkNodeConfigKeys {
+		value, ok := n.config[key]
+		if ok {
+			oldConfig[key] = value
+		}
+	}
+
+	req := api.NetworkPut{
+		Description: n.description,
+		Config:      n.config,
+	}
+
+	n.config = oldConfig
+	n.description = old.Description
+
+	return n.Update(req, false)
+}
+
+func networkAllocationsGet(d *Daemon, r *http.Request) response.Response {
+	name := mux.Vars(r)["name"]
+
+	// Try to get the network
+	n, err := doNetworkGet(d, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	// Only managed networks track their static addresses
+	if !n.Managed {
+		return response.NotFound(errors.New("Allocations not found"))
+	}
+
+	var allocations []db.NetworkAllocation
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		allocations, err = tx.NetworkAllocations(name)
+		return err
+	})
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	result := []api.NetworkAllocation{}
+	for _, allocation := range allocations {
+		result = append(result, api.NetworkAllocation{
+			Address:  allocation.Address,
+			Project:  allocation.Project,
+			Instance: allocation.Instance,
+			Device:   allocation.Device,
+		})
+	}
+
+	return response.SyncResponse(true, result)
+}
+
 func networkLeasesGet(d *Daemon, r *http.Request) response.Response {
 	name := mux.Vars(r)["name"]
 	project := projectParam(r)
@@ -887,7 +1048,7 @@ func networkStartup(s *state.State) error {
 		err = n.Start()
 		if err != nil {
 			// Don't cause LXD to fail to start entirely on network bring up failure
-			logger.Error("Failed to bring up network", log.Ctx{"err": err, "name": name})
+			networkLogger.Error("Failed to bring up network", log.Ctx{"err": err, "name": name})
 		}
 	}
 
@@ -914,7 +1075,7 @@ func networkShutdown(s *state.State) error {
 
 		err = n.Stop()
 		if err != nil {
-			logger.Error("Failed to bring down network", log.Ctx{"err": err, "name": name})
+			networkLogger.Error("Failed to bring down network", log.Ctx{"err": err, "name": name})
 		}
 	}
 
@@ -1205,21 +1366,9 @@ func (n *network) Setup(oldConfig map[string]string) error {
 		}
 	}
 
-	// Remove any existing IPv4 iptables rules
-	if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) || (oldConfig != nil && (oldConfig["ipv4.firewall"] == "" || shared.IsTrue(oldConfig["ipv4.firewall"]))) {
-		err = iptables.NetworkClear("ipv4", n.name, "")
-		if err != nil {
-			return err
-		}
-
-		err = iptables.NetworkClear("ipv4", n.name, "mangle")
-		if err != nil {
-			return err
-		}
-	}
-
-	if shared.IsTrue(n.config["ipv4.nat"]) || (oldConfig != nil && shared.IsTrue(oldConfig["ipv4.nat"])) {
-		err = iptables.NetworkClear("ipv4", n.name, "nat")
+	// Remove any existing IPv4 firewall rules
+	if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) || (oldConfig != nil && (oldConfig["ipv4.firewall"] == "" || shared.IsTrue(oldConfig["ipv4.firewall"]))) || shared.IsTrue(n.config["ipv4.nat"]) || (oldConfig != nil && shared.IsTrue(oldConfig["ipv4.nat"])) {
+		err = n.state.Firewall.NetworkClear(n.name, 4)
 		if err != nil {
 			return err
 		}
@@ -1246,26 +1395,16 @@ func (n *network) Setup(oldConfig map[string]string) error {
 	// Configure IPv4 firewall (includes fan)
 	if n.config["bridge.mode"] == "fan" || !shared.StringInSlice(n.config["ipv4.address"], []string{"", "none"}) {
 		if (n.config["ipv4.dhcp"] == "" || shared.IsTrue(n.config["ipv4.dhcp"])) && (n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"])) {
-			// Setup basic iptables overrides for DHCP/DNS
-			rules := [][]string{
-				{"ipv4", n.name, "", "INPUT", "-i", n.name, "-p", "udp", "--dport", "67", "-j", "ACCEPT"},
-				{"ipv4", n.name, "", "INPUT", "-i", n.name, "-p", "udp", "--dport", "53", "-j", "ACCEPT"},
-				{"ipv4", n.name, "", "INPUT", "-i", n.name, "-p", "tcp", "--dport", "53", "-j", "ACCEPT"},
-				{"ipv4", n.name, "", "OUTPUT", "-o", n.name, "-p", "udp", "--sport", "67", "-j", "ACCEPT"},
-				{"ipv4", n.name, "", "OUTPUT", "-o", n.name, "-p", "udp", "--sport", "53", "-j", "ACCEPT"},
-				{"ipv4", n.name, "", "OUTPUT", "-o", n.name, "-p", "tcp", "--sport", "53", "-j", "ACCEPT"}}
-
-			for _, rule := range rules {
-				err = iptables.NetworkPrepend(rule[0], rule[1], rule[2], rule[3], rule[4:]...)
-				if err != nil {
-					return err
-				}
+			// Setup basic firewall overrides for DHCP/DNS
+			err = n.state.Firewall.NetworkSetupDHCPDNSAccess(n.name, 4)
+			if err != nil {
+				return err
 			}
 		}
 
 		// Attempt a workaround for broken DHCP clients
 		if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) {
-			iptables.NetworkPrepend("ipv4", n.name, "mangle", "POSTROUTING", "-o", n.name, "-p", "udp", "--dport", "68", "-j", "CHECKSUM", "--checksum-fill")
+			n.state.Firewall.NetworkSetupDHCPv4Checksum(n.name)
 		}
 
 		// Allow forwarding
@@ -1276,24 +1415,14 @@ func (n *network) Setup(oldConfig map[string]string) error {
 			}
 
 			if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) {
-				err = iptables.NetworkPrepend("ipv4", n.name, "", "FORWARD", "-i", n.name, "-j", "ACCEPT")
-				if err != nil {
-					return err
-				}
-
-				err = iptables.NetworkPrepend("ipv4", n.name, "", "FORWARD", "-o", n.name, "-j", "ACCEPT")
+				err = n.state.Firewall.NetworkSetupForwardingPolicy(n.name, 4, true)
 				if err != nil {
 					return err
 				}
 			}
 		} else {
 			if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) {
-				err = iptables.NetworkPrepend("ipv4", n.name, "", "FORWARD", "-i", n.name, "-j", "REJECT")
-				if err != nil {
-					return err
-				}
-
-				err = iptables.NetworkPrepend("ipv4", n.name, "", "FORWARD", "-o", n.name, "-j", "REJECT")
+				err = n.state.Firewall.NetworkSetupForwardingPolicy(n.name, 4, false)
 				if err != nil {
 					return err
 				}
@@ -1371,21 +1500,14 @@ func (n *network) Setup(oldConfig map[string]string) error {
 		// Configure NAT
 		if shared.IsTrue(n.config["ipv4.nat"]) {
 			//If a SNAT source address is specified, use that, otherwise default to using MASQUERADE mode.
-			args := []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "MASQUERADE"}
+			var srcIP net.IP
 			if n.config["ipv4.nat.address"] != "" {
-				args = []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "SNAT", "--to", n.config["ipv4.nat.address"]}
+				srcIP = net.ParseIP(n.config["ipv4.nat.address"])
 			}
 
-			if n.config["ipv4.nat.order"] == "after" {
-				err = iptables.NetworkAppend("ipv4", n.name, "nat", "POSTROUTING", args...)
-				if err != nil {
-					return err
-				}
-			} else {
-				err = iptables.NetworkPrepend("ipv4", n.name, "nat", "POSTROUTING", args...)
-				if err != nil {
-					return err
-				}
+			err = n.state.Firewall.NetworkSetupOutboundNAT(n.name, subnet, srcIP, n.config["ipv4.nat.order"] == "after")
+			if err != nil {
+				return err
 			}
 		}
 
@@ -1407,16 +1529,9 @@ func (n *network) Setup(oldConfig map[string]string) error {
 		}
 	}
 
-	// Remove any existing IPv6 iptables rules
-	if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) || (oldConfig != nil && (oldConfig["ipv6.firewall"] == "" || shared.IsTrue(oldConfig["ipv6.firewall"]))) {
-		err = iptables.NetworkClear("ipv6", n.name, "")
-		if err != nil {
-			return err
-		}
-	}
-
-	if shared.IsTrue(n.config["ipv6.nat"]) || (oldConfig != nil && shared.IsTrue(oldConfig["ipv6.nat"])) {
-		err = iptables.NetworkClear("ipv6", n.name, "nat")
+	// Remove any existing IPv6 firewall rules
+	if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) || (oldConfig != nil && (oldConfig["ipv6.firewall"] == "" || shared.IsTrue(oldConfig["ipv6.firewall"]))) || shared.IsTrue(n.config["ipv6.nat"]) || (oldConfig != nil && shared.IsTrue(oldConfig["ipv6.nat"])) {
+		err = n.state.Firewall.NetworkClear(n.name, 6)
 		if err != nil {
 			return err
 		}
@@ -1458,20 +1573,10 @@ func (n *network) Setup(oldConfig map[string]string) error {
 		dnsmasqCmd = append(dnsmasqCmd, []string{fmt.Sprintf("--listen-address=%s", ip.String()), "--enable-ra"}...)
 		if n.config["ipv6.dhcp"] == "" || shared.IsTrue(n.config["ipv6.dhcp"]) {
 			if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) {
-				// Setup basic iptables overrides for DHCP/DNS
-				rules := [][]string{
-					{"ipv6", n.name, "", "INPUT", "-i", n.name, "-p", "udp", "--dport", "547", "-j", "ACCEPT"},
-					{"ipv6", n.name, "", "INPUT", "-i", n.name, "-p", "udp", "--dport", "53", "-j", "ACCEPT"},
-					{"ipv6", n.name, "", "INPUT", "-i", n.name, "-p", "tcp", "--dport", "53", "-j", "ACCEPT"},
-					{"ipv6", n.name, "", "OUTPUT", "-o", n.name, "-p", "udp", "--sport", "547", "-j", "ACCEPT"},
-					{"ipv6", n.name, "", "OUTPUT", "-o", n.name, "-p", "udp", "--sport", "53", "-j", "ACCEPT"},
-					{"ipv6", n.name, "", "OUTPUT", "-o", n.name, "-p", "tcp", "--sport", "53", "-j", "ACCEPT"}}
-
-				for _, rule := range rules {
-					err = iptables.NetworkPrepend(rule[0], rule[1], rule[2], rule[3], rule[4:]...)
-					if err != nil {
-						return err
-					}
+				// Setup basic firewall overrides for DHCP/DNS
+				err = n.state.Firewall.NetworkSetupDHCPDNSAccess(n.name, 6)
+				if err != nil {
+					return err
 				}
 			}
 
@@ -1532,24 +1637,14 @@ func (n *network) Setup(oldConfig map[string]string) error {
 			}
 
 			if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) {
-				err = iptables.NetworkPrepend("ipv6", n.name, "", "FORWARD", "-i", n.name, "-j", "ACCEPT")
-				if err != nil {
-					return err
-				}
-
-				err = iptables.NetworkPrepend("ipv6", n.name, "", "FORWARD", "-o", n.name, "-j", "ACCEPT")
+				err = n.state.Firewall.NetworkSetupForwardingPolicy(n.name, 6, true)
 				if err != nil {
 					return err
 				}
 			}
 		} else {
 			if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) {
-				err = iptables.NetworkPrepend("ipv6", n.name, "", "FORWARD", "-i", n.name, "-j", "REJECT")
-				if err != nil {
-					return err
-				}
-
-				err = iptables.NetworkPrepend("ipv6", n.name, "", "FORWARD", "-o", n.name, "-j", "REJECT")
+				err = n.state.Firewall.NetworkSetupForwardingPolicy(n.name, 6, false)
 				if err != nil {
 					return err
 				}
@@ -1564,21 +1659,14 @@ func (n *network) Setup(oldConfig map[string]string) error {
 
 		// Configure NAT
 		if shared.IsTrue(n.config["ipv6.nat"]) {
-			args := []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "MASQUERADE"}
+			var srcIP net.IP
 			if n.config["ipv6.nat.address"] != "" {
-				args = []string{"-s", subnet.String(), "!", "-d", subnet.String(), "-j", "SNAT", "--to", n.config["ipv6.nat.address"]}
+				srcIP = net.ParseIP(n.config["ipv6.nat.address"])
 			}
 
-			if n.config["ipv6.nat.order"] == "after" {
-				err = iptables.NetworkAppend("ipv6", n.name, "nat", "POSTROUTING", args...)
-				if err != nil {
-					return err
-				}
-			} else {
-				err = iptables.NetworkPrepend("ipv6", n.name, "nat", "POSTROUTING", args...)
-				if err != nil {
-					return err
-				}
+			err = n.state.Firewall.NetworkSetupOutboundNAT(n.name, subnet, srcIP, n.config["ipv6.nat.order"] == "after")
+			if err != nil {
+				return err
 			}
 		}
 
@@ -1734,16 +1822,9 @@ func (n *network) Setup(oldConfig map[string]string) error {
 
 		// Configure NAT
 		if n.config["ipv4.nat"] == "" || shared.IsTrue(n.config["ipv4.nat"]) {
-			if n.config["ipv4.nat.order"] == "after" {
-				err = iptables.NetworkAppend("ipv4", n.name, "nat", "POSTROUTING", "-s", overlaySubnet.String(), "!", "-d", overlaySubnet.String(), "-j", "MASQUERADE")
-				if err != nil {
-					return err
-				}
-			} else {
-				err = iptables.NetworkPrepend("ipv4", n.name, "nat", "POSTROUTING", "-s", overlaySubnet.String(), "!", "-d", overlaySubnet.String(), "-j", "MASQUERADE")
-				if err != nil {
-					return err
-				}
+			err = n.state.Firewall.NetworkSetupOutboundNAT(n.name, overlaySubnet, nil, n.config["ipv4.nat.order"] == "after")
+			if err != nil {
+				return err
 			}
 		}
 
@@ -1885,7 +1966,15 @@ func (n *network) Setup(oldConfig map[string]string) error {
 		}
 
 		// Create a config file to contain additional config (and to prevent dnsmasq from reading /etc/dnsmasq.conf)
-		err = ioutil.WriteFile(shared.VarPath("networks", n.name, "dnsmasq.raw"), []byte(fmt.Sprintf("%s\n", n.config["raw.dnsmasq"])), 0644)
+		dnsmasqConf := ""
+		if n.config["dns.mode"] != "none" {
+			for _, record := range networkDNSRecords(n.config, dnsDomain) {
+				dnsmasqConf += fmt.Sprintf("%s\n", record)
+			}
+		}
+		dnsmasqConf += fmt.Sprintf("%s\n", n.config["raw.dnsmasq"])
+
+		err = ioutil.WriteFile(shared.VarPath("networks", n.name, "dnsmasq.raw"), []byte(dnsmasqConf), 0644)
 		if err != nil {
 			return err
 		}
@@ -1916,6 +2005,19 @@ func (n *network) Setup(oldConfig map[string]string) error {
 			return fmt.Errorf("dnsmasq is required for LXD managed bridges")
 		}
 
+		// Confine dnsmasq to the network's files
+		confine, err := node.AppArmorHelper(n.state.Node, "dnsmasq")
+		if err != nil {
+			return err
+		}
+
+		if confine {
+			dnsmasqCmd, err = apparmor.DnsmasqWrapper(n.state, dnsmasqCmd, n.name)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Start dnsmasq (occasionally races, try a few times)
 		_, err = shared.TryRunCommand(dnsmasqCmd[0], dnsmasqCmd[1:]...)
 		if err != nil {
@@ -1982,35 +2084,16 @@ func (n *network) Stop() error {
 		}
 	}
 
-	// Cleanup iptables
-	if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) {
-		err := iptables.NetworkClear("ipv4", n.name, "")
-		if err != nil {
-			return err
-		}
-
-		err = iptables.NetworkClear("ipv4", n.name, "mangle")
-		if err != nil {
-			return err
-		}
-	}
-
-	if shared.IsTrue(n.config["ipv4.nat"]) {
-		err := iptables.NetworkClear("ipv4", n.name, "nat")
-		if err != nil {
-			return err
-		}
-	}
-
-	if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) {
-		err := iptables.NetworkClear("ipv6", n.name, "")
+	// Cleanup firewall rules
+	if n.config["ipv4.firewall"] == "" || shared.IsTrue(n.config["ipv4.firewall"]) || shared.IsTrue(n.config["ipv4.nat"]) {
+		err := n.state.Firewall.NetworkClear(n.name, 4)
 		if err != nil {
 			return err
 		}
 	}
 
-	if shared.IsTrue(n.config["ipv6.nat"]) {
-		err := iptables.NetworkClear("ipv6", n.name, "nat")
+	if n.config["ipv6.firewall"] == "" || shared.IsTrue(n.config["ipv6.firewall"]) || shared.IsTrue(n.config["ipv6.nat"]) {
+		err := n.state.Firewall.NetworkClear(n.name, 6)
 		if err != nil {
 			return err
 		}
@@ -2022,6 +2105,11 @@ func (n *network) Stop() error {
 		return err
 	}
 
+	err = apparmor.DnsmasqUnload(n.state, n.name)
+	if err != nil {
+		return err
+	}
+
 	err = networkKillForkDNS(n.name)
 	if err != nil {
 		return err
@@ -2046,7 +2134,7 @@ func (n *network) Stop() error {
 	return nil
 }
 
-func (n *network) Update(newNetwork api.NetworkPut) error {
+func (n *network) Update(newNetwork api.NetworkPut, withDatabase bool) error {
 	err := networkFillAuto(newNetwork.Config)
 	if err != nil {
 		return err
@@ -2073,7 +2161,9 @@ func (n *network) Update(newNetwork api.NetworkPut) error {
 			n.description = oldDescription
 
 			// Update the database
-			n.state.Cluster.NetworkUpdate(n.name, n.description, n.config)
+			if withDatabase {
+				n.state.Cluster.NetworkUpdate(n.name, n.description, n.config)
+			}
 
 			// Reset any change that was made to the bridge
 			n.Setup(newConfig)
@@ -2149,9 +2239,11 @@ func (n *network) Update(newNetwork api.NetworkPut) error {
 	n.description = newNetwork.Description
 
 	// Update the database
-	err = n.state.Cluster.NetworkUpdate(n.name, n.description, n.config)
-	if err != nil {
-		return err
+	if withDatabase {
+		err = n.state.Cluster.NetworkUpdate(n.name, n.description, n.config)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Restart the network
@@ -2201,7 +2293,7 @@ func (n *network) refreshForkdnsServerAddresses(heartbeatData *cluster.APIHeartb
 		return err
 	}
 
-	logger.Infof("Refreshing forkdns peers for %v", n.name)
+	networkLogger.Infof("Refreshing forkdns peers for %v", n.name)
 
 	cert := n.state.Endpoints.NetworkCert()
 	for _, node := range heartbeatData.Members {
@@ -2235,7 +2327,7 @@ func (n *network) refreshForkdnsServerAddresses(heartbeatData *cluster.APIHeartb
 	curList, err := networksGetForkdnsServersList(n.name)
 	if err != nil {
 		// Only warn here, but continue on to regenerate the servers list from cluster info.
-		logger.Warnf("Failed to load existing forkdns server list: %v", err)
+		networkLogger.Warnf("Failed to load existing forkdns server list: %v", err)
 	}
 
 	// If current list is same as cluster list, nothing to do.
@@ -2248,6 +2340,6 @@ func (n *network) refreshForkdnsServerAddresses(heartbeatData *cluster.APIHeartb
 		return err
 	}
 
-	logger.Infof("Updated forkdns server list for '%s': %v", n.name, addresses)
+	networkLogger.Infof("Updated forkdns server list for '%s': %v", n.name, addresses)
 	return nil
 }
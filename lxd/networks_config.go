@@ -100,6 +100,10 @@ var networkConfigKeys = map[string]func(value string) error{
 	"dns.mode": func(value string) error {
 		return shared.IsOneOf(value, []string{"dynamic", "managed", "none"})
 	},
+	"dns.host.NAME":  networkValidDNSHost,
+	"dns.cname.NAME": networkValidDNSName,
+	"dns.txt.NAME":   shared.IsAny,
+	"dns.srv.NAME":   networkValidDNSSRV,
 
 	"raw.dnsmasq": shared.IsAny,
 }
@@ -133,6 +137,17 @@ func networkValidateConfig(name string, config map[string]string) error {
 			key = fmt.Sprintf("tunnel.TARGET.%s", fields[2])
 		}
 
+		// DNS record keys have the record name in their name, so extract the real key
+		fields := strings.SplitN(key, ".", 3)
+		if len(fields) == 3 && fields[0] == "dns" && shared.StringInSlice(fields[1], []string{"host", "cname", "txt", "srv"}) {
+			err := networkValidDNSName(fields[2])
+			if err != nil {
+				return fmt.Errorf("Invalid network configuration key: %s", k)
+			}
+
+			key = fmt.Sprintf("dns.%s.NAME", fields[1])
+		}
+
 		// Then validate
 		validator, ok := networkConfigKeys[key]
 		if !ok {
@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,13 +25,13 @@ import (
 	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/device"
+	deviceConfig "github.com/lxc/lxd/lxd/device/config"
 	"github.com/lxc/lxd/lxd/dnsmasq"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
-	"github.com/lxc/lxd/shared/logger"
 )
 
 var forkdnsServersLock sync.Mutex
@@ -497,6 +498,114 @@ func networkValidAddressCIDRV4(value string) error {
 	return nil
 }
 
+func networkValidDNSName(value string) error {
+	if value == "" || len(value) > 253 {
+		return fmt.Errorf("Invalid DNS name: %s", value)
+	}
+
+	for _, label := range strings.Split(value, ".") {
+		match, _ := regexp.MatchString("^[-_a-zA-Z0-9]{1,63}$", label)
+		if !match {
+			return fmt.Errorf("Invalid DNS name: %s", value)
+		}
+	}
+
+	return nil
+}
+
+func networkValidDNSHost(value string) error {
+	for _, address := range strings.Split(value, ",") {
+		err := device.NetworkValidAddress(strings.TrimSpace(address))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func networkValidDNSSRV(value string) error {
+	fields := strings.Split(value, ",")
+	if len(fields) < 2 || len(fields) > 4 {
+		return fmt.Errorf("Invalid SRV record (expected <target>,<port>[,<priority>[,<weight>]]): %s", value)
+	}
+
+	err := networkValidDNSName(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return err
+	}
+
+	err = networkValidPort(strings.TrimSpace(fields[1]))
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields[2:] {
+		err := shared.IsUint32(strings.TrimSpace(field))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// networkDNSName qualifies a name with the DNS domain of the network, unless
+// it already contains a dot.
+func networkDNSName(name string, domain string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+
+	return fmt.Sprintf("%s.%s", name, domain)
+}
+
+// networkDNSRecords returns the dnsmasq configuration serving the additional
+// DNS records set with the dns.host.*, dns.cname.*, dns.txt.* and dns.srv.*
+// keys of a network. Record names are relative to the given domain.
+func networkDNSRecords(config map[string]string, domain string) []string {
+	keys := []string{}
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	records := []string{}
+	for _, key := range keys {
+		fields := strings.SplitN(key, ".", 3)
+		if len(fields) != 3 || fields[0] != "dns" || config[key] == "" {
+			continue
+		}
+
+		name := fmt.Sprintf("%s.%s", fields[2], domain)
+		value := config[key]
+
+		switch fields[1] {
+		case "host":
+			addresses := []string{}
+			for _, address := range strings.Split(value, ",") {
+				addresses = append(addresses, strings.TrimSpace(address))
+			}
+
+			records = append(records, fmt.Sprintf("host-record=%s,%s", name, strings.Join(addresses, ",")))
+		case "cname":
+			records = append(records, fmt.Sprintf("cname=%s,%s", name, networkDNSName(value, domain)))
+		case "txt":
+			records = append(records, fmt.Sprintf("txt-record=%s,%s", name, strconv.Quote(value)))
+		case "srv":
+			srv := strings.Split(value, ",")
+			for i := range srv {
+				srv[i] = strings.TrimSpace(srv[i])
+			}
+			srv[0] = networkDNSName(srv[0], domain)
+
+			records = append(records, fmt.Sprintf("srv-host=%s,%s", name, strings.Join(srv, ",")))
+		}
+	}
+
+	return records
+}
+
 func networkAddressForSubnet(subnet *net.IPNet) (net.IP, string, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
@@ -734,7 +843,7 @@ func networkUpdateStatic(s *state.State, networkName string) error {
 
 				if entry[0] == i[0] {
 					// Find broken configurations
-					logger.Errorf("Duplicate MAC detected: %s and %s", project.Prefix(entry[1], entry[2]), project.Prefix(i[1], i[2]))
+					networkLogger.Errorf("Duplicate MAC detected: %s and %s", project.Prefix(entry[1], entry[2]), project.Prefix(i[1], i[2]))
 				}
 
 				if i[3] == "" && i[4] == "" {
@@ -748,7 +857,7 @@ func networkUpdateStatic(s *state.State, networkName string) error {
 						duplicate = true
 					} else {
 						line = fmt.Sprintf("%s,%s", line, i[0])
-						logger.Debugf("Found containers with duplicate IPv4/IPv6: %s and %s", project.Prefix(entry[1], entry[2]), project.Prefix(i[1], i[2]))
+						networkLogger.Debugf("Found containers with duplicate IPv4/IPv6: %s and %s", project.Prefix(entry[1], entry[2]), project.Prefix(i[1], i[2]))
 					}
 				}
 			}
@@ -1017,3 +1126,47 @@ func networkApplyBootRoutesV6(devName string, routes []string) error {
 
 	return nil
 }
+
+// networkAllocations returns the static addresses configured on the bridged NICs
+// among the given devices, so that they can be tracked on their network.
+func networkAllocations(inst Instance, devices deviceConfig.Devices) ([]db.NetworkAllocation, error) {
+	allocations := []db.NetworkAllocation{}
+	seen := map[string]string{}
+
+	for _, entry := range devices.Sorted() {
+		d := entry.Config
+		if d["type"] != "nic" || d["nictype"] != "bridged" || d["parent"] == "" {
+			continue
+		}
+
+		for _, key := range []string{"ipv4.address", "ipv6.address"} {
+			if d[key] == "" {
+				continue
+			}
+
+			ip := net.ParseIP(d[key])
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid value for device %q key %q: %s", entry.Name, key, d[key])
+			}
+
+			address := ip.String()
+
+			other, ok := seen[d["parent"]+"/"+address]
+			if ok {
+				return nil, fmt.Errorf("Address %s on network %s is used by both devices %q and %q", address, d["parent"], other, entry.Name)
+			}
+
+			seen[d["parent"]+"/"+address] = entry.Name
+
+			allocations = append(allocations, db.NetworkAllocation{
+				Network:  d["parent"],
+				Address:  address,
+				Project:  inst.Project(),
+				Instance: inst.Name(),
+				Device:   entry.Name,
+			})
+		}
+	}
+
+	return allocations, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Additional DNS records are rendered as dnsmasq options, relative to the
+// domain of the network.
+func TestNetworkDNSRecords(t *testing.T) {
+	config := map[string]string{
+		"dns.host.db":        "10.0.0.5, fd42::5",
+		"dns.cname.www":      "c1",
+		"dns.cname.mail":     "mail.example.com",
+		"dns.txt.info":       `some "text"`,
+		"dns.srv._http._tcp": "web,80,0,10",
+		"dns.domain":         "lxd",
+		"ipv4.address":       "10.0.0.1/24",
+	}
+
+	records := networkDNSRecords(config, "lxd")
+	assert.Equal(t, []string{
+		"cname=mail.lxd,mail.example.com",
+		"cname=www.lxd,c1.lxd",
+		"host-record=db.lxd,10.0.0.5,fd42::5",
+		"srv-host=_http._tcp.lxd,web.lxd,80,0,10",
+		`txt-record=info.lxd,"some \"text\""`,
+	}, records)
+}
+
+func TestNetworkValidateConfig_DNSRecords(t *testing.T) {
+	assert.NoError(t, networkValidateConfig("lxdbr0", map[string]string{"dns.host.db": "10.0.0.5"}))
+	assert.NoError(t, networkValidateConfig("lxdbr0", map[string]string{"dns.srv._ldap._tcp": "ldap,389"}))
+	assert.Error(t, networkValidateConfig("lxdbr0", map[string]string{"dns.host.db": "nope"}))
+	assert.Error(t, networkValidateConfig("lxdbr0", map[string]string{"dns.cname.bad name": "c1"}))
+	assert.Error(t, networkValidateConfig("lxdbr0", map[string]string{"dns.srv.x": "target"}))
+}
@@ -2,9 +2,16 @@ package node
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/lxc/lxd/lxd/config"
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/webhook"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logging"
 )
 
 // Config holds node-local configuration values for a certain LXD instance.
@@ -48,12 +55,72 @@ func (c *Config) DebugAddress() string {
 	return c.m.GetString("core.debug_address")
 }
 
+// DatabaseTrace returns whether the cluster database queries should be traced,
+// along with the duration above which a query is logged as slow.
+func (c *Config) DatabaseTrace() (bool, time.Duration) {
+	return c.m.GetBool("core.debug_database_trace"), time.Duration(c.m.GetInt64("core.debug_database_slow_query")) * time.Millisecond
+}
+
+// LogLevels returns the log level of each subsystem, or an empty string for
+// the subsystems logging at the level of the daemon.
+func (c *Config) LogLevels() map[string]string {
+	levels := map[string]string{}
+	for _, subsystem := range logging.Subsystems {
+		levels[subsystem] = c.m.GetString(fmt.Sprintf("core.log_level.%s", subsystem))
+	}
+
+	return levels
+}
+
+// AutostartConcurrency returns the maximum number of instances started at
+// once at boot, along with the maximum number of storage volumes activated at
+// once for them.
+func (c *Config) AutostartConcurrency() (int64, int64) {
+	instances := c.m.GetInt64("core.autostart_concurrency")
+	volumes := c.m.GetInt64("core.autostart_storage_concurrency")
+	if volumes == 0 {
+		volumes = instances
+	}
+
+	return instances, volumes
+}
+
+// AppArmorHelper returns whether the helper processes of the given kind
+// (rsync or dnsmasq) should be confined with AppArmor.
+func (c *Config) AppArmorHelper(name string) bool {
+	return c.m.GetBool(fmt.Sprintf("core.apparmor_%s", name))
+}
+
+// HooksAllowed returns the absolute paths of the binaries which the host
+// hooks of instances may run.
+func (c *Config) HooksAllowed() []string {
+	allowed := []string{}
+	for _, path := range strings.Split(c.m.GetString("core.hooks_allowed"), ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			allowed = append(allowed, filepath.Clean(path))
+		}
+	}
+
+	return allowed
+}
+
 // MAASMachine returns the MAAS machine this instance is associated with, if
 // any.
 func (c *Config) MAASMachine() string {
 	return c.m.GetString("maas.machine")
 }
 
+// SecretsBackend returns the backend to store secrets in, if any, along with
+// the address, token file and key/value engine mount of the Vault server used
+// by the vault backend.
+func (c *Config) SecretsBackend() (string, string, string, string) {
+	return c.m.GetString("core.secrets_backend"),
+		c.m.GetString("core.secrets_vault_address"),
+		c.m.GetString("core.secrets_vault_token_file"),
+		c.m.GetString("core.secrets_vault_mount")
+}
+
 // StorageBackupsVolume returns the name of the pool/volume to use for storing backup tarballs
 func (c *Config) StorageBackupsVolume() string {
 	return c.m.GetString("storage.backups_volume")
@@ -64,6 +131,12 @@ func (c *Config) StorageImagesVolume() string {
 	return c.m.GetString("storage.images_volume")
 }
 
+// ContentScanner returns the command and the URL of the HTTP hook which imported
+// images and storage volumes are checked with before they are made available.
+func (c *Config) ContentScanner() (string, string) {
+	return c.m.GetString("storage.scan_command"), c.m.GetString("storage.scan_url")
+}
+
 // Dump current configuration keys and their values. Keys with values matching
 // their defaults are omitted.
 func (c *Config) Dump() map[string]interface{} {
@@ -133,6 +206,89 @@ func DebugAddress(node *db.Node) (string, error) {
 	return config.DebugAddress(), nil
 }
 
+// DatabaseTrace is a convenience for loading the node configuration and
+// returning the value of core.debug_database_trace and
+// core.debug_database_slow_query.
+func DatabaseTrace(node *db.Node) (bool, time.Duration, error) {
+	var config *Config
+	err := node.Transaction(func(tx *db.NodeTx) error {
+		var err error
+		config, err = ConfigLoad(tx)
+		return err
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	enabled, slow := config.DatabaseTrace()
+	return enabled, slow, nil
+}
+
+// LogLevels is a convenience for loading the node configuration and
+// returning the values of the core.log_level.* keys.
+func LogLevels(node *db.Node) (map[string]string, error) {
+	var config *Config
+	err := node.Transaction(func(tx *db.NodeTx) error {
+		var err error
+		config, err = ConfigLoad(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return config.LogLevels(), nil
+}
+
+// AppArmorHelper is a convenience for loading the node configuration and
+// returning whether the helper processes of the given kind should be confined.
+func AppArmorHelper(node *db.Node, name string) (bool, error) {
+	var config *Config
+	err := node.Transaction(func(tx *db.NodeTx) error {
+		var err error
+		config, err = ConfigLoad(tx)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return config.AppArmorHelper(name), nil
+}
+
+// ContentScanner is a convenience for loading the node configuration and
+// returning the values of the storage.scan_* keys.
+func ContentScanner(node *db.Node) (string, string, error) {
+	var config *Config
+	err := node.Transaction(func(tx *db.NodeTx) error {
+		var err error
+		config, err = ConfigLoad(tx)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	command, url := config.ContentScanner()
+	return command, url, nil
+}
+
+// HooksAllowed is a convenience for loading the node configuration and
+// returning the value of core.hooks_allowed.
+func HooksAllowed(node *db.Node) ([]string, error) {
+	var config *Config
+	err := node.Transaction(func(tx *db.NodeTx) error {
+		var err error
+		config, err = ConfigLoad(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return config.HooksAllowed(), nil
+}
+
 func (c *Config) update(values map[string]interface{}) (map[string]string, error) {
 	changed, err := c.m.Change(values)
 	if err != nil {
@@ -158,10 +314,77 @@ var ConfigSchema = config.Schema{
 	// Network address for the debug server
 	"core.debug_address": {},
 
+	// Confinement of the helper processes
+	"core.apparmor_dnsmasq": {Type: config.Bool, Default: "true"},
+	"core.apparmor_rsync":   {Type: config.Bool, Default: "true"},
+
+	// Tracing of the cluster database queries
+	"core.debug_database_trace":      {Type: config.Bool},
+	"core.debug_database_slow_query": {Type: config.Int64, Default: "1000"},
+
+	// Log levels of the subsystems, overriding the one of the daemon
+	"core.log_level.storage": {Validator: logLevelValidator},
+	"core.log_level.network": {Validator: logLevelValidator},
+	"core.log_level.cluster": {Validator: logLevelValidator},
+	"core.log_level.qemu":    {Validator: logLevelValidator},
+
+	// Concurrency of the instance starts and storage activations at boot
+	"core.autostart_concurrency":         {Type: config.Int64, Default: "1", Validator: concurrencyValidator(1)},
+	"core.autostart_storage_concurrency": {Type: config.Int64, Default: "0", Validator: concurrencyValidator(0)},
+
+	// Binaries which the host hooks of instances may run
+	"core.hooks_allowed": {Validator: hooksAllowedValidator},
+
+	// Backend to store secrets in, instead of the cluster database
+	"core.secrets_backend":          {Validator: secretsBackendValidator},
+	"core.secrets_vault_address":    {},
+	"core.secrets_vault_token_file": {},
+	"core.secrets_vault_mount":      {Default: "secret"},
+
 	// MAAS machine this LXD instance is associated with
 	"maas.machine": {},
 
 	// Storage volumes to store backups/images on
 	"storage.backups_volume": {},
 	"storage.images_volume":  {},
+
+	// Scanner which imported images and storage volumes must pass
+	"storage.scan_command": {},
+	"storage.scan_url":     {Validator: webhook.ValidateURL},
+}
+
+// Return a validator for concurrency limits, which must be at least the given
+// minimum.
+func concurrencyValidator(min int) func(string) error {
+	return func(value string) error {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Concurrency is not a number")
+		}
+
+		if count < min {
+			return fmt.Errorf("Concurrency must be at least %d", min)
+		}
+
+		return nil
+	}
+}
+
+func logLevelValidator(value string) error {
+	return shared.IsOneOf(value, []string{"debug", "info", "warn", "error", "crit"})
+}
+
+func hooksAllowedValidator(value string) error {
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("Hook binaries must be absolute paths: %q", path)
+		}
+	}
+
+	return nil
+}
+
+func secretsBackendValidator(value string) error {
+	return shared.IsOneOf(value, []string{"file", "keyring", "vault"})
 }
@@ -142,3 +142,56 @@ func TestClusterAddress(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "127.0.0.1:666", address)
 }
+
+// The storage activations at boot are limited like the instance starts, unless
+// a separate limit is set.
+func TestConfig_AutostartConcurrency(t *testing.T) {
+	tx, cleanup := db.NewTestNodeTx(t)
+	defer cleanup()
+
+	config, err := node.ConfigLoad(tx)
+	require.NoError(t, err)
+
+	instances, volumes := config.AutostartConcurrency()
+	assert.Equal(t, int64(1), instances)
+	assert.Equal(t, int64(1), volumes)
+
+	_, err = config.Patch(map[string]interface{}{"core.autostart_concurrency": "8"})
+	require.NoError(t, err)
+
+	instances, volumes = config.AutostartConcurrency()
+	assert.Equal(t, int64(8), instances)
+	assert.Equal(t, int64(8), volumes)
+
+	_, err = config.Patch(map[string]interface{}{"core.autostart_storage_concurrency": "2"})
+	require.NoError(t, err)
+
+	instances, volumes = config.AutostartConcurrency()
+	assert.Equal(t, int64(8), instances)
+	assert.Equal(t, int64(2), volumes)
+
+	_, err = config.Patch(map[string]interface{}{"core.autostart_concurrency": "0"})
+	assert.EqualError(t, err, "cannot set 'core.autostart_concurrency' to '0': Concurrency must be at least 1")
+}
+
+// Subsystems log at the level of the daemon unless a level is set for them.
+func TestConfig_LogLevels(t *testing.T) {
+	tx, cleanup := db.NewTestNodeTx(t)
+	defer cleanup()
+
+	config, err := node.ConfigLoad(tx)
+	require.NoError(t, err)
+
+	levels := config.LogLevels()
+	assert.Equal(t, map[string]string{"storage": "", "network": "", "cluster": "", "qemu": ""}, levels)
+
+	_, err = config.Patch(map[string]interface{}{"core.log_level.storage": "debug"})
+	require.NoError(t, err)
+
+	levels = config.LogLevels()
+	assert.Equal(t, "debug", levels["storage"])
+	assert.Equal(t, "", levels["network"])
+
+	_, err = config.Patch(map[string]interface{}{"core.log_level.qemu": "verbose"})
+	assert.EqualError(t, err, "cannot set 'core.log_level.qemu' to 'verbose': Invalid value: verbose (not one of [debug info warn error crit])")
+}
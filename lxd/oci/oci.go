@@ -0,0 +1,146 @@
+package oci
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/lxc/lxd/shared/osarch"
+)
+
+// Media types of the content of an OCI image layout.
+const (
+	MediaTypeIndex     = "application/vnd.oci.image.index.v1+json"
+	MediaTypeManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeConfig    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeLayer     = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeLayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// Media types of the Docker images, which some tools still put in OCI image layouts.
+	mediaTypeDockerManifest  = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerLayerGzip = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// AnnotationRefName is the annotation holding the name of an image in the index of a layout.
+const AnnotationRefName = "org.opencontainers.image.ref.name"
+
+// Prefix of the name of the whiteout entries of a layer, which remove the path of the same name
+// without the prefix from the layers below.
+const whiteoutPrefix = ".wh."
+
+// Name of the whiteout entry of a layer removing everything the layers below have in its
+// directory.
+const whiteoutOpaque = ".wh..wh..opq"
+
+// WhiteoutName returns the name of the whiteout entry removing the given path from the layers
+// below.
+func WhiteoutName(path string) string {
+	return filepath.Join(filepath.Dir(path), whiteoutPrefix+filepath.Base(path))
+}
+
+// Layout is the content of the oci-layout file at the root of an image layout.
+type Layout struct {
+	Version string `json:"imageLayoutVersion"`
+}
+
+// Descriptor points at a blob of an image layout.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// Platform is the platform an image runs on.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// Index is the content of the index.json file of an image layout, listing its images.
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Manifest describes an image, made of its configuration and its layers.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ImageConfig is the configuration of an image.
+type ImageConfig struct {
+	Created      *time.Time      `json:"created,omitempty"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Config       ContainerConfig `json:"config"`
+	RootFS       RootFS          `json:"rootfs"`
+	History      []History       `json:"history,omitempty"`
+}
+
+// ContainerConfig is the part of the configuration of an image used to run it.
+type ContainerConfig struct {
+	Env        []string          `json:"Env,omitempty"`
+	Entrypoint []string          `json:"Entrypoint,omitempty"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	WorkingDir string            `json:"WorkingDir,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+}
+
+// RootFS lists the digests of the uncompressed layers of an image.
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// History describes how a layer of an image was made.
+type History struct {
+	Created   *time.Time `json:"created,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	Comment   string     `json:"comment,omitempty"`
+}
+
+// The architectures of the images, by their names in LXD.
+var architectures = map[string]string{
+	"i686":    "386",
+	"x86_64":  "amd64",
+	"armv7l":  "arm",
+	"aarch64": "arm64",
+	"ppc":     "ppc",
+	"ppc64":   "ppc64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// Architecture returns the name used in images for the architecture of the given LXD name.
+func Architecture(name string) (string, error) {
+	arch, ok := architectures[name]
+	if !ok {
+		return "", fmt.Errorf("Architecture %q isn't supported in OCI images", name)
+	}
+
+	return arch, nil
+}
+
+// ArchitectureName returns the LXD name of the architecture an image uses.
+func ArchitectureName(arch string) (string, error) {
+	for name, ociArch := range architectures {
+		if ociArch == arch {
+			return name, nil
+		}
+	}
+
+	// Fall back to the aliases LXD knows about.
+	id, err := osarch.ArchitectureId(arch)
+	if err != nil {
+		return "", fmt.Errorf("Architecture %q of the OCI image isn't supported", arch)
+	}
+
+	return osarch.ArchitectureName(id)
+}
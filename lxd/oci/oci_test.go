@@ -0,0 +1,147 @@
+package oci_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/lxd/oci"
+)
+
+// layerEntry is an entry of a test layer, a directory if it has no content nor link.
+type layerEntry struct {
+	name    string
+	content string
+	link    string
+}
+
+// writeLayer returns the function writing a layer tarball with the given entries.
+func writeLayer(entries ...layerEntry) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+		for _, entry := range entries {
+			hdr := &tar.Header{
+				Name:    entry.name,
+				Mode:    0755,
+				Uid:     os.Getuid(),
+				Gid:     os.Getgid(),
+				ModTime: time.Now(),
+			}
+
+			if entry.link != "" {
+				hdr.Typeflag = tar.TypeSymlink
+				hdr.Linkname = entry.link
+			} else if entry.content != "" || filepath.Base(entry.name)[0] == '.' {
+				hdr.Typeflag = tar.TypeReg
+				hdr.Mode = 0644
+				hdr.Size = int64(len(entry.content))
+			} else {
+				hdr.Typeflag = tar.TypeDir
+			}
+
+			err := tw.WriteHeader(hdr)
+			if err != nil {
+				return err
+			}
+
+			_, err = tw.Write([]byte(entry.content))
+			if err != nil {
+				return err
+			}
+		}
+
+		return tw.Close()
+	}
+}
+
+// Test that an image layout written by Writer unpacks to the content of its layers, with the
+// whiteouts of the upper layers applied.
+func TestWriterUnpack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxd-oci-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	w, err := oci.NewWriter(&buf, dir)
+	require.NoError(t, err)
+
+	err = w.AddLayer("base", writeLayer(
+		layerEntry{name: "etc"},
+		layerEntry{name: "etc/hostname", content: "c1\n"},
+		layerEntry{name: "etc/old.conf", content: "old\n"},
+		layerEntry{name: "var"},
+		layerEntry{name: "var/cache"},
+		layerEntry{name: "var/cache/a", content: "a\n"},
+		layerEntry{name: "escape", link: "../../.."},
+	))
+	require.NoError(t, err)
+
+	err = w.AddLayer("changes", writeLayer(
+		layerEntry{name: "etc/.wh.old.conf"},
+		layerEntry{name: "etc/new.conf", content: "new\n"},
+		layerEntry{name: "var/cache/b", content: "b\n"},
+		layerEntry{name: "var/cache/.wh..wh..opq"},
+		layerEntry{name: "escape/etc/passwd", content: "root::0:0::/:/bin/sh\n"},
+	))
+	require.NoError(t, err)
+
+	err = w.Close(oci.ImageConfig{Architecture: "amd64", OS: "linux"}, "c1")
+	require.NoError(t, err)
+
+	ok, err := oci.IsLayout(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	rootfs := filepath.Join(dir, "rootfs")
+	config, name, err := oci.Unpack(bytes.NewReader(buf.Bytes()), filepath.Join(dir, "layout"), rootfs, "x86_64")
+	require.NoError(t, err)
+	assert.Equal(t, "c1", name)
+	assert.Equal(t, "amd64", config.Architecture)
+	assert.Len(t, config.RootFS.DiffIDs, 2)
+
+	content, err := ioutil.ReadFile(filepath.Join(rootfs, "etc/hostname"))
+	require.NoError(t, err)
+	assert.Equal(t, "c1\n", string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(rootfs, "etc/new.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(content))
+
+	_, err = os.Stat(filepath.Join(rootfs, "etc/old.conf"))
+	assert.True(t, os.IsNotExist(err))
+
+	// The opaque whiteout only removes what the lower layers have.
+	_, err = os.Stat(filepath.Join(rootfs, "var/cache/a"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(rootfs, "var/cache/b"))
+	assert.NoError(t, err)
+
+	// Symbolic links are resolved within the root filesystem.
+	content, err = ioutil.ReadFile(filepath.Join(rootfs, "etc/passwd"))
+	require.NoError(t, err)
+	assert.Equal(t, "root::0:0::/:/bin/sh\n", string(content))
+}
+
+// Test that tarballs which aren't image layouts are recognized as such.
+func TestIsLayout(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeLayer(layerEntry{name: "metadata.yaml", content: "architecture: x86_64\n"})(&buf)
+	require.NoError(t, err)
+
+	ok, err := oci.IsLayout(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = oci.IsLayout(bytes.NewReader([]byte{0x1f, 0x8b, 0x08}))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,455 @@
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Names of the blobs of an image layout, relative to its root.
+var blobPathRegexp = regexp.MustCompile(`^blobs/sha256/[0-9a-f]{64}$`)
+
+// blobPath returns the path of the blob with the given digest, relative to the root of the layout.
+func blobPath(digest string) string {
+	return fmt.Sprintf("blobs/%s", strings.Replace(digest, ":", "/", 1))
+}
+
+// IsLayout returns whether the tarball read from r holds an image layout, rewinding it afterwards.
+// Only uncompressed tarballs are recognized, as written by skopeo with the oci-archive transport.
+func IsLayout(r io.ReadSeeker) (bool, error) {
+	_, err := r.Seek(0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer r.Seek(0, 0)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			// Not a tarball (or a compressed one), so not a layout either.
+			return false, nil
+		}
+
+		if strings.TrimPrefix(hdr.Name, "./") == "oci-layout" {
+			return true, nil
+		}
+	}
+}
+
+// Unpack unpacks the image held by the image layout tarball read from r into rootfsPath, applying
+// its layers in order. The layout is first extracted to layoutPath. When the layout holds several
+// images, the one for the given architecture (using its LXD name) is picked. It returns the
+// configuration of the image and its name, if the layout has one.
+func Unpack(r io.Reader, layoutPath string, rootfsPath string, arch string) (*ImageConfig, string, error) {
+	err := extractLayout(r, layoutPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var index Index
+	err = readJSON(filepath.Join(layoutPath, "index.json"), &index)
+	if err != nil {
+		return nil, "", err
+	}
+
+	desc, err := pickManifest(index, arch)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var manifest Manifest
+	err = readJSON(filepath.Join(layoutPath, blobPath(desc.Digest)), &manifest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var config ImageConfig
+	err = readJSON(filepath.Join(layoutPath, blobPath(manifest.Config.Digest)), &config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config.OS != "" && config.OS != "linux" {
+		return nil, "", fmt.Errorf("The OCI image is for %q, not Linux", config.OS)
+	}
+
+	for _, layer := range manifest.Layers {
+		err := unpackLayer(filepath.Join(layoutPath, blobPath(layer.Digest)), layer, rootfsPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("Failed to unpack layer %q: %v", layer.Digest, err)
+		}
+	}
+
+	return &config, desc.Annotations[AnnotationRefName], nil
+}
+
+// extractLayout extracts the index and the blobs of an image layout tarball to the given path.
+func extractLayout(r io.Reader, path string) error {
+	hasLayout := false
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		if name == "oci-layout" {
+			hasLayout = true
+			continue
+		}
+
+		if name != "index.json" && !blobPathRegexp.MatchString(name) {
+			continue
+		}
+
+		target := filepath.Join(path, name)
+		err = os.MkdirAll(filepath.Dir(target), 0700)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !hasLayout {
+		return fmt.Errorf("The tarball isn't an OCI image layout, it has no oci-layout file")
+	}
+
+	return nil
+}
+
+// pickManifest returns the descriptor of the manifest of the image to unpack from the index of a
+// layout.
+func pickManifest(index Index, arch string) (*Descriptor, error) {
+	manifests := []Descriptor{}
+	for _, desc := range index.Manifests {
+		if desc.MediaType == MediaTypeManifest || desc.MediaType == mediaTypeDockerManifest {
+			manifests = append(manifests, desc)
+		}
+	}
+
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("The OCI image layout holds no image")
+	}
+
+	if len(manifests) == 1 {
+		return &manifests[0], nil
+	}
+
+	for _, desc := range manifests {
+		if desc.Platform == nil {
+			continue
+		}
+
+		name, err := ArchitectureName(desc.Platform.Architecture)
+		if err == nil && name == arch {
+			return &desc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("The OCI image layout holds no image for architecture %q", arch)
+}
+
+// readJSON decodes the JSON file at the given path.
+func readJSON(path string, value interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// unpackLayer applies the layer stored at the given path to the root filesystem, checking its
+// digest along the way.
+func unpackLayer(path string, desc Descriptor, rootfsPath string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	var r io.Reader = io.TeeReader(f, hash)
+
+	switch desc.MediaType {
+	case MediaTypeLayer:
+	case MediaTypeLayerGzip, mediaTypeDockerLayerGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		r = gz
+	default:
+		return fmt.Errorf("Unsupported layer type %q", desc.MediaType)
+	}
+
+	err = applyLayer(r, rootfsPath)
+	if err != nil {
+		return err
+	}
+
+	// Read what's left of the blob past the end of the tarball, to hash all of it.
+	_, err = io.Copy(ioutil.Discard, f)
+	if err != nil {
+		return err
+	}
+
+	if fmt.Sprintf("sha256:%x", hash.Sum(nil)) != desc.Digest {
+		return fmt.Errorf("Digest mismatch")
+	}
+
+	return nil
+}
+
+// applyLayer applies the changes of a layer tarball to the root filesystem. The whiteout entries
+// remove what the layers below have at their path, the other entries replace it.
+func applyLayer(r io.Reader, rootfsPath string) error {
+	// The paths added by this layer, which its whiteouts don't apply to.
+	added := map[string]bool{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		dir, base := filepath.Split(name)
+		if base == whiteoutOpaque {
+			dirPath, err := resolvePath(rootfsPath, dir)
+			if err != nil {
+				return err
+			}
+
+			entries, err := ioutil.ReadDir(dirPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			for _, entry := range entries {
+				path := filepath.Join(dirPath, entry.Name())
+				if added[path] {
+					continue
+				}
+
+				err := os.RemoveAll(path)
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			path, err := resolvePath(rootfsPath, filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			if err != nil {
+				return err
+			}
+
+			if added[path] {
+				continue
+			}
+
+			err = os.RemoveAll(path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		path, err := resolvePath(rootfsPath, name)
+		if err != nil {
+			return err
+		}
+
+		err = applyEntry(tr, hdr, rootfsPath, path)
+		if err != nil {
+			return fmt.Errorf("Failed to unpack %q: %v", hdr.Name, err)
+		}
+
+		added[path] = true
+	}
+
+	return nil
+}
+
+// applyEntry creates the file of a layer entry at the given path, replacing what's in its way.
+func applyEntry(tr *tar.Reader, hdr *tar.Header, rootfsPath string, path string) error {
+	fi, err := os.Lstat(path)
+	if err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		err := os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	mode := hdr.FileInfo().Mode()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		err := os.Mkdir(path, 0755)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		return unpackSymlink(hdr, path)
+	case tar.TypeLink:
+		target, err := resolvePath(rootfsPath, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+
+		return os.Link(target, path)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		devType := uint32(unix.S_IFIFO)
+		if hdr.Typeflag == tar.TypeChar {
+			devType = unix.S_IFCHR
+		} else if hdr.Typeflag == tar.TypeBlock {
+			devType = unix.S_IFBLK
+		}
+
+		err := unix.Mknod(path, devType|uint32(mode.Perm()), int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))))
+		if err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	err = os.Lchown(path, hdr.Uid, hdr.Gid)
+	if err != nil {
+		return err
+	}
+
+	// Set the mode after the ownership, as changing the owner drops the setuid and setgid bits.
+	err = os.Chmod(path, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	if err != nil {
+		return err
+	}
+
+	for key, value := range hdr.Xattrs {
+		err := unix.Lsetxattr(path, key, []byte(value), 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+}
+
+// unpackSymlink creates the symbolic link of a layer entry at the given path.
+func unpackSymlink(hdr *tar.Header, path string) error {
+	err := os.Symlink(hdr.Linkname, path)
+	if err != nil {
+		return err
+	}
+
+	return os.Lchown(path, hdr.Uid, hdr.Gid)
+}
+
+// resolvePath returns the path of name under the root filesystem, following the symbolic links of
+// its parent directories as if the root filesystem was "/", so that no entry of a layer ends up
+// outside of it. The last component of the name isn't followed.
+func resolvePath(rootfsPath string, name string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(filepath.Clean("/"+name), "/"), "/")
+	current := "/"
+	links := 0
+
+	for i := 0; i < len(parts); i++ {
+		if parts[i] == "" {
+			continue
+		}
+
+		next := filepath.Join(current, parts[i])
+		if i == len(parts)-1 {
+			current = next
+			break
+		}
+
+		fi, err := os.Lstat(filepath.Join(rootfsPath, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		links++
+		if links > 255 {
+			return "", fmt.Errorf("Too many levels of symbolic links in %q", name)
+		}
+
+		target, err := os.Readlink(filepath.Join(rootfsPath, next))
+		if err != nil {
+			return "", err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(current, target)
+		}
+
+		// Start over from the target of the link, followed by the rest of the name.
+		rest := strings.Split(strings.TrimPrefix(filepath.Clean("/"+target), "/"), "/")
+		parts = append(rest, parts[i+1:]...)
+		current = "/"
+		i = -1
+	}
+
+	return filepath.Join(rootfsPath, current), nil
+}
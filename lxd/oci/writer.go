@@ -0,0 +1,189 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Writer writes an OCI image layout holding a single image as a tarball, as read by tools like
+// skopeo (with the oci-archive transport) or podman. The layers are stored uncompressed.
+type Writer struct {
+	tarWriter *tar.Writer
+	tmpDir    string
+	layers    []Descriptor
+	diffIDs   []string
+	history   []History
+}
+
+// NewWriter starts the tarball of an image layout. The layers are staged in tmpDir, as the
+// tarball needs their size and digest ahead of their content.
+func NewWriter(w io.Writer, tmpDir string) (*Writer, error) {
+	writer := &Writer{
+		tarWriter: tar.NewWriter(w),
+		tmpDir:    tmpDir,
+	}
+
+	layout, err := json.Marshal(Layout{Version: "1.0.0"})
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.writeFile("oci-layout", layout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{"blobs", "blobs/sha256"} {
+		err := writer.tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir + "/",
+			Mode:     0755,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return writer, nil
+}
+
+// AddLayer adds a layer on top of the ones added so far, whose tarball is written by the given
+// function. The comment ends up in the history of the image.
+func (w *Writer) AddLayer(comment string, write func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(w.tmpDir, "lxd_oci_layer_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	err = write(io.MultiWriter(f, hash))
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+
+	digest := fmt.Sprintf("sha256:%x", hash.Sum(nil))
+	err = w.writeBlob(digest, fi.Size(), f)
+	if err != nil {
+		return err
+	}
+
+	created := time.Now().UTC()
+	w.layers = append(w.layers, Descriptor{MediaType: MediaTypeLayer, Digest: digest, Size: fi.Size()})
+	w.diffIDs = append(w.diffIDs, digest)
+	w.history = append(w.history, History{Created: &created, CreatedBy: "LXD", Comment: comment})
+
+	return nil
+}
+
+// Close writes the configuration of the image and its manifest, then the index of the layout
+// listing the image under the given name. It doesn't close the underlying writer.
+func (w *Writer) Close(config ImageConfig, name string) error {
+	config.RootFS = RootFS{Type: "layers", DiffIDs: w.diffIDs}
+	config.History = w.history
+
+	configDesc, err := w.writeJSONBlob(MediaTypeConfig, config)
+	if err != nil {
+		return err
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        *configDesc,
+		Layers:        w.layers,
+	}
+
+	manifestDesc, err := w.writeJSONBlob(MediaTypeManifest, manifest)
+	if err != nil {
+		return err
+	}
+
+	manifestDesc.Annotations = map[string]string{AnnotationRefName: name}
+	manifestDesc.Platform = &Platform{Architecture: config.Architecture, OS: config.OS}
+
+	index, err := json.Marshal(Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeIndex,
+		Manifests:     []Descriptor{*manifestDesc},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = w.writeFile("index.json", index)
+	if err != nil {
+		return err
+	}
+
+	return w.tarWriter.Close()
+}
+
+// writeJSONBlob adds the given value as a JSON blob and returns its descriptor.
+func (w *Writer) writeJSONBlob(mediaType string, value interface{}) (*Descriptor, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	err = w.writeBlob(digest, int64(len(data)), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}, nil
+}
+
+// writeBlob adds a blob with the given digest and size to the tarball.
+func (w *Writer) writeBlob(digest string, size int64, r io.Reader) error {
+	err := w.tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     blobPath(digest),
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w.tarWriter, r)
+	return err
+}
+
+// writeFile adds a file with the given content at the root of the layout.
+func (w *Writer) writeFile(name string, data []byte) error {
+	err := w.tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.tarWriter.Write(data)
+	return err
+}
@@ -76,6 +76,57 @@ func OperationGetInternal(id string) (*Operation, error) {
 	return op, nil
 }
 
+// Drain waits for all pending and running operations (other than tokens) to complete, for up to
+// the supplied timeout. Any operation still running once the timeout has expired is cancelled if
+// it supports it. It returns the number of operations that didn't complete in time.
+func Drain(timeout time.Duration) int {
+	operationsLock.Lock()
+	pending := []*Operation{}
+	for _, op := range operations {
+		op.lock.Lock()
+		status := op.status
+		op.lock.Unlock()
+
+		if op.class == OperationClassToken || status.IsFinal() {
+			continue
+		}
+
+		pending = append(pending, op)
+	}
+	operationsLock.Unlock()
+
+	if len(pending) > 0 {
+		logger.Infof("Waiting for %d running operations to complete", len(pending))
+	}
+
+	deadline := time.Now().Add(timeout)
+	remaining := []*Operation{}
+	for _, op := range pending {
+		if !op.waitUntil(deadline) {
+			remaining = append(remaining, op)
+		}
+	}
+
+	// Try and cancel whatever didn't complete in time, giving each a short grace period.
+	for _, op := range remaining {
+		if !op.mayCancel() {
+			logger.Warnf("Operation %s didn't complete and can't be cancelled", op.id)
+			continue
+		}
+
+		logger.Warnf("Operation %s didn't complete, cancelling it", op.id)
+		_, err := op.Cancel()
+		if err != nil {
+			logger.Warnf("Failed to cancel operation %s: %v", op.id, err)
+			continue
+		}
+
+		op.waitUntil(time.Now().Add(5 * time.Second))
+	}
+
+	return len(remaining)
+}
+
 // Operation represents an operation.
 type Operation struct {
 	project     string
@@ -88,6 +139,7 @@ type Operation struct {
 	resources   map[string][]string
 	metadata    map[string]interface{}
 	err         string
+	errCode     int
 	readonly    bool
 	canceler    *cancel.Canceler
 	description string
@@ -222,7 +274,9 @@ func (op *Operation) Run() (chan error, error) {
 			if err != nil {
 				op.lock.Lock()
 				op.status = api.Failure
-				op.err = response.SmartError(err).String()
+				resp := response.SmartError(err)
+				op.err = resp.String()
+				op.errCode = response.ErrorCode(resp)
 				op.lock.Unlock()
 				op.done()
 				chanRun <- err
@@ -412,6 +466,7 @@ func (op *Operation) Render() (string, *api.Operation, error) {
 		Metadata:    op.metadata,
 		MayCancel:   op.mayCancel(),
 		Err:         op.err,
+		ErrCode:     op.errCode,
 		Location:    serverName,
 	}, nil
 }
@@ -445,6 +500,26 @@ func (op *Operation) WaitFinal(timeout int) (bool, error) {
 	return false, nil
 }
 
+// waitUntil waits for the operation to be done or for the deadline to pass, whichever happens
+// first. It returns true if the operation is done.
+func (op *Operation) waitUntil(deadline time.Time) bool {
+	select {
+	case <-op.chanDone:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-op.chanDone:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
 // UpdateResources updates the resources of the operation. It returns an error
 // if the operation is not pending or running, or the operation is read-only.
 func (op *Operation) UpdateResources(opResources map[string][]string) error {
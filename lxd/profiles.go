@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
@@ -15,6 +16,7 @@ import (
 	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/db"
 	deviceConfig "github.com/lxc/lxd/lxd/device/config"
+	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
@@ -39,6 +41,18 @@ var profileCmd = APIEndpoint{
 	Put:    APIEndpointAction{Handler: profilePut, AccessHandler: AllowProjectPermission("profiles", "manage-profiles")},
 }
 
+var profileDiffCmd = APIEndpoint{
+	Path: "profiles/{name}/diff",
+
+	Get: APIEndpointAction{Handler: profileDiffGet, AccessHandler: AllowProjectPermission("profiles", "view")},
+}
+
+var profileApplyCmd = APIEndpoint{
+	Path: "profiles/{name}/apply",
+
+	Post: APIEndpointAction{Handler: profileApplyPost, AccessHandler: AllowProjectPermission("profiles", "manage-profiles")},
+}
+
 /* This is used for both profiles post and profile put */
 func profilesGet(d *Daemon, r *http.Request) response.Response {
 	project := projectParam(r)
@@ -89,6 +103,17 @@ func profilesPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	resp := storagePoolVolumeAttachCheck(d, r, nil, req.Devices)
+	if resp != nil {
+		return resp
+	}
+
+	return doProfilesPost(d, project, req)
+}
+
+// Create a profile in the given project, or in the default project if the given one doesn't have
+// its own profiles.
+func doProfilesPost(d *Daemon, project string, req api.ProfilesPost) response.Response {
 	// Sanity checks
 	if req.Name == "" {
 		return response.BadRequest(fmt.Errorf("No name provided"))
@@ -113,6 +138,11 @@ func profilesPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	err = profileDiskVolumesCheck(d.State(), project, nil, req.Devices)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	// Update DB entry
 	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
 		hasProfiles, err := tx.ProjectHasProfiles(project)
@@ -249,21 +279,15 @@ func profilePut(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	resp := storagePoolVolumeAttachCheck(d, r, profile.Devices, req.Devices)
+	if resp != nil {
+		return resp
+	}
+
 	err = doProfileUpdate(d, project, name, id, profile, req)
 
 	if err == nil && !isClusterNotification(r) {
-		// Notify all other nodes. If a node is down, it will be ignored.
-		notifier, err := cluster.NewNotifier(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAlive)
-		if err != nil {
-			return response.SmartError(err)
-		}
-
-		err = notifier(func(client lxd.InstanceServer) error {
-			return client.UseProject(project).UpdateProfile(name, profile.ProfilePut, "")
-		})
-		if err != nil {
-			return response.SmartError(err)
-		}
+		err = profileUpdateNotify(d, project, name, profile.ProfilePut)
 	}
 
 	return response.SmartError(err)
@@ -358,7 +382,17 @@ func profilePatch(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
-	return response.SmartError(doProfileUpdate(d, project, name, id, profile, req))
+	resp := storagePoolVolumeAttachCheck(d, r, profile.Devices, req.Devices)
+	if resp != nil {
+		return resp
+	}
+
+	err = doProfileUpdate(d, project, name, id, profile, req)
+	if err == nil && !isClusterNotification(r) {
+		err = profileUpdateNotify(d, project, name, profile.ProfilePut)
+	}
+
+	return response.SmartError(err)
 }
 
 // The handler for the post operation.
@@ -418,6 +452,12 @@ func profileDelete(d *Daemon, r *http.Request) response.Response {
 	project := projectParam(r)
 	name := mux.Vars(r)["name"]
 
+	return doProfileDelete(d, project, name)
+}
+
+// Delete an unused profile from the given project, or from the default project if the given one
+// doesn't have its own profiles.
+func doProfileDelete(d *Daemon, project, name string) response.Response {
 	if name == "default" {
 		return response.Forbidden(errors.New("The 'default' profile cannot be deleted"))
 	}
@@ -448,3 +488,134 @@ func profileDelete(d *Daemon, r *http.Request) response.Response {
 
 	return response.EmptySyncResponse
 }
+
+// Returns the project holding the given profile, which is the default project if the given one
+// doesn't have its own profiles, after checking that the profile exists.
+func profileProject(d *Daemon, project, name string) (string, error) {
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		hasProfiles, err := tx.ProjectHasProfiles(project)
+		if err != nil {
+			return errors.Wrap(err, "Check project features")
+		}
+
+		if !hasProfiles {
+			project = "default"
+		}
+
+		_, err = tx.ProfileGet(project, name)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to retrieve profile='%s'", name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return project, nil
+}
+
+func profileDiffGet(d *Daemon, r *http.Request) response.Response {
+	name := mux.Vars(r)["name"]
+
+	project, err := profileProject(d, projectParam(r), name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	diffs, err := profileInstancesDiff(d.cluster, project, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, diffs)
+}
+
+func profileApplyPost(d *Daemon, r *http.Request) response.Response {
+	name := mux.Vars(r)["name"]
+
+	project, err := profileProject(d, projectParam(r), name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	notification := isClusterNotification(r)
+
+	run := func(op *operations.Operation) error {
+		results, err := doProfileApply(d, project, name)
+		if err != nil {
+			return err
+		}
+
+		if !notification {
+			// Have the other nodes re-apply the profile to their own instances.
+			notifier, err := cluster.NewNotifier(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAlive)
+			if err != nil {
+				return err
+			}
+
+			resultsLock := sync.Mutex{}
+			err = notifier(func(client lxd.InstanceServer) error {
+				remoteOp, err := client.UseProject(project).ApplyProfile(name)
+				if err != nil {
+					return err
+				}
+
+				err = remoteOp.Wait()
+				if err != nil {
+					return err
+				}
+
+				data, err := json.Marshal(remoteOp.Get().Metadata["results"])
+				if err != nil {
+					return err
+				}
+
+				remoteResults := []api.ProfileApplyResult{}
+				err = json.Unmarshal(data, &remoteResults)
+				if err != nil {
+					return err
+				}
+
+				resultsLock.Lock()
+				results = append(results, remoteResults...)
+				resultsLock.Unlock()
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		op.UpdateMetadata(map[string]interface{}{"results": results})
+
+		failures := map[string]string{}
+		for _, result := range results {
+			if result.Error != "" {
+				failures[result.Name] = result.Error
+			}
+		}
+
+		if notification || len(failures) == 0 {
+			return nil
+		}
+
+		msg := "The following containers failed to update:\n"
+		for cname, err := range failures {
+			msg += fmt.Sprintf(" - %s: %s\n", cname, err)
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	resources := map[string][]string{}
+	resources["profiles"] = []string{name}
+
+	op, err := operations.OperationCreate(d.State(), project, operations.OperationClassTask, db.OperationProfileApply, resources, nil, run, nil, nil)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
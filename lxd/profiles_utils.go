@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/db/query"
 	deviceConfig "github.com/lxc/lxd/lxd/device/config"
+	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/pkg/errors"
@@ -25,6 +29,11 @@ func doProfileUpdate(d *Daemon, project, name string, id int64, profile *api.Pro
 		return err
 	}
 
+	err = profileDiskVolumesCheck(d.State(), project, profile.Devices, req.Devices)
+	if err != nil {
+		return err
+	}
+
 	containers, err := getProfileContainersInfo(d.cluster, project, name)
 	if err != nil {
 		return errors.Wrapf(err, "failed to query containers associated with profile '%s'", name)
@@ -149,6 +158,25 @@ func doProfileUpdate(d *Daemon, project, name string, id int64, profile *api.Pro
 	return nil
 }
 
+// Have the other nodes update their instances using the profile, after it
+// was updated in the database. Nodes which are down do it once they're back.
+func profileUpdateNotify(d *Daemon, project, name string, old api.ProfilePut) error {
+	changes := []cluster.NotifyChange{{
+		Description: fmt.Sprintf("update the instances using profile %s", name),
+		Apply: func(client lxd.InstanceServer) error {
+			return client.UseProject(project).UpdateProfile(name, old, "")
+		},
+	}}
+
+	statuses, err := cluster.NotifyBatch(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAlive, changes)
+	queueErr := clusterChangeQueue(d, statuses, clusterChangeProfile, project, name, old)
+	if err != nil {
+		return err
+	}
+
+	return queueErr
+}
+
 // Like doProfileUpdate but does not update the database, since it was already
 // updated by doProfileUpdate itself, called on the notifying node.
 func doProfileUpdateCluster(d *Daemon, project, name string, old api.ProfilePut) error {
@@ -255,3 +283,186 @@ func getProfileContainersInfo(cluster *db.Cluster, project, profile string) ([]d
 
 	return containers, nil
 }
+
+// Records the current definition of the profiles of a running instance in its
+// "volatile.last_state.profiles" key, so that the instances which failed to get a profile change
+// applied can be found and fixed later on.
+func instanceProfilesAppliedSet(s *state.State, inst Instance) error {
+	profiles := []api.Profile{}
+	if len(inst.Profiles()) > 0 {
+		var err error
+		profiles, err = s.Cluster.ProfilesGet(inst.Project(), inst.Profiles())
+		if err != nil {
+			return err
+		}
+	}
+
+	applied := make([]api.Profile, len(profiles))
+	for i, profile := range profiles {
+		applied[i].Name = profile.Name
+		applied[i].Config = profile.Config
+		applied[i].Devices = profile.Devices
+	}
+
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+
+	if inst.LocalConfig()["volatile.last_state.profiles"] == string(data) {
+		return nil
+	}
+
+	return inst.VolatileSet(map[string]string{"volatile.last_state.profiles": string(data)})
+}
+
+// Returns the names of the profiles of a running instance whose current definition isn't the one
+// applied to it, along with the definition of the applied profiles. Instances which aren't running
+// or which haven't been started since the applied profiles are tracked are ignored.
+func profileInstanceDiff(cluster *db.Cluster, args db.InstanceArgs) ([]string, []api.Profile, error) {
+	if args.Config["volatile.last_state.power"] != "RUNNING" || args.Config["volatile.last_state.profiles"] == "" {
+		return nil, nil, nil
+	}
+
+	applied := []api.Profile{}
+	err := json.Unmarshal([]byte(args.Config["volatile.last_state.profiles"]), &applied)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to parse the applied profiles of '%s'", args.Name)
+	}
+
+	profiles := []api.Profile{}
+	if len(args.Profiles) > 0 {
+		profiles, err = cluster.ProfilesGet(args.Project, args.Profiles)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	deviated := []string{}
+	for _, profile := range profiles {
+		found := false
+		for _, old := range applied {
+			if old.Name != profile.Name {
+				continue
+			}
+
+			found = profileDefinitionEqual(old, profile)
+			break
+		}
+
+		if !found {
+			deviated = append(deviated, profile.Name)
+		}
+	}
+
+	return deviated, applied, nil
+}
+
+// Whether two profiles have the same config and devices, empty and missing ones being the same.
+func profileDefinitionEqual(a api.Profile, b api.Profile) bool {
+	if (len(a.Config) > 0 || len(b.Config) > 0) && !reflect.DeepEqual(a.Config, b.Config) {
+		return false
+	}
+
+	if (len(a.Devices) > 0 || len(b.Devices) > 0) && !reflect.DeepEqual(a.Devices, b.Devices) {
+		return false
+	}
+
+	return true
+}
+
+// Returns the running instances using the given profile which don't use the current definition of
+// all of their profiles.
+func profileInstancesDiff(cluster *db.Cluster, project, name string) ([]api.ProfileInstanceDiff, error) {
+	containers, err := getProfileContainersInfo(cluster, project, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query containers associated with profile '%s'", name)
+	}
+
+	diffs := []api.ProfileInstanceDiff{}
+	for _, args := range containers {
+		deviated, _, err := profileInstanceDiff(cluster, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(deviated) == 0 {
+			continue
+		}
+
+		diffs = append(diffs, api.ProfileInstanceDiff{
+			Name:     args.Name,
+			Project:  args.Project,
+			Location: args.Node,
+			Profiles: deviated,
+		})
+	}
+
+	return diffs, nil
+}
+
+// Re-applies the current definition of their profiles to the running instances of this node which
+// use the given profile and deviate from it, returning the result for each of them.
+func doProfileApply(d *Daemon, project, name string) ([]api.ProfileApplyResult, error) {
+	nodeName := ""
+	err := d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		var err error
+		nodeName, err = tx.NodeName()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query local node name")
+	}
+
+	containers, err := getProfileContainersInfo(d.cluster, project, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query containers associated with profile '%s'", name)
+	}
+
+	results := []api.ProfileApplyResult{}
+	for _, args := range containers {
+		if args.Node != "" && args.Node != nodeName {
+			continue
+		}
+
+		deviated, applied, err := profileInstanceDiff(d.cluster, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(deviated) == 0 {
+			continue
+		}
+
+		result := api.ProfileApplyResult{
+			Name:     args.Name,
+			Project:  args.Project,
+			Location: args.Node,
+		}
+
+		// Update from the applied profiles to the current ones.
+		c := containerLXCInstantiate(d.State(), args)
+
+		c.expandConfig(applied)
+		c.expandDevices(applied)
+
+		err = c.Update(db.InstanceArgs{
+			Architecture: c.Architecture(),
+			Config:       c.LocalConfig(),
+			Description:  c.Description(),
+			Devices:      c.LocalDevices(),
+			Ephemeral:    c.IsEphemeral(),
+			Profiles:     c.Profiles(),
+			Project:      c.Project(),
+			Type:         c.Type(),
+			Snapshot:     c.IsSnapshot(),
+		}, true)
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/units"
+)
+
+// projectSnapshotsUsage returns the disk space used by the snapshots of the instances of the
+// project on this node. Snapshots on pools whose driver can't report their usage aren't counted.
+func projectSnapshotsUsage(s *state.State, project string) (int64, error) {
+	insts, err := instanceLoadNodeProjectAll(s, project, instancetype.Any)
+	if err != nil {
+		return -1, err
+	}
+
+	usage := int64(0)
+	for _, inst := range insts {
+		pool, err := storagePools.GetPoolByInstance(s, inst)
+		if err == storageDrivers.ErrUnknownDriver || err == storageDrivers.ErrNotImplemented {
+			continue
+		} else if err != nil {
+			return -1, err
+		}
+
+		snaps, err := inst.Snapshots()
+		if err != nil {
+			return -1, err
+		}
+
+		for _, snap := range snaps {
+			used, err := pool.GetInstanceUsage(snap)
+			if err != nil {
+				if api.StatusErrorCheck(err, http.StatusNotImplemented) {
+					break
+				}
+
+				return -1, err
+			}
+
+			usage += used
+		}
+	}
+
+	return usage, nil
+}
+
+// projectSnapshotsLimitCheck refuses new snapshots in the project once its snapshots use the
+// space set in limits.disk.snapshots or more.
+func projectSnapshotsLimitCheck(s *state.State, project string) error {
+	config, err := projectConfig(s.Cluster, project)
+	if err != nil {
+		return err
+	}
+
+	if config["limits.disk.snapshots"] == "" {
+		return nil
+	}
+
+	limit, err := units.ParseByteSizeString(config["limits.disk.snapshots"])
+	if err != nil {
+		return err
+	}
+
+	usage, err := projectSnapshotsUsage(s, project)
+	if err != nil {
+		return err
+	}
+
+	if usage >= limit {
+		return api.StatusErrorf(http.StatusInsufficientStorage, "The snapshots of project %q use %s, which reaches its limits.disk.snapshots of %s", project, units.GetByteSizeString(usage, 2), units.GetByteSizeString(limit, 2))
+	}
+
+	return nil
+}
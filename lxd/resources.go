@@ -48,19 +48,9 @@ func storagePoolResourcesGet(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
-	// Get the existing storage pool
+	// Get the resources of the storage pool, from its driver of the new storage layer if any
 	poolName := mux.Vars(r)["name"]
-	s, err := storagePoolInit(d.State(), poolName)
-	if err != nil {
-		return response.InternalError(err)
-	}
-
-	err = s.StoragePoolCheck()
-	if err != nil {
-		return response.InternalError(err)
-	}
-
-	res, err := s.StoragePoolResources()
+	res, err := storagePoolUsage(d.State(), poolName)
 	if err != nil {
 		return response.InternalError(err)
 	}
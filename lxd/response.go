@@ -53,7 +53,7 @@ func ForwardedResponseIfContainerIsRemote(d *Daemon, r *http.Request, project, n
 }
 
 // ForwardedResponseIfVolumeIsRemote redirects a request to the node hosting
-// the volume with the given pool ID, name and type. If the container is local,
+// the volume with the given pool ID, name and type. If the volume is local,
 // nothing gets done and nil is returned. If more than one node has a matching
 // volume, an error is returned.
 //
@@ -64,8 +64,16 @@ func ForwardedResponseIfVolumeIsRemote(d *Daemon, r *http.Request, poolID int64,
 		return nil
 	}
 
+	// Custom and image volumes are not tied to projects and always live in
+	// the default one, while container volumes belong to the project of
+	// their container.
+	project := "default"
+	if volumeType == storagePoolVolumeTypeContainer {
+		project = projectParam(r)
+	}
+
 	cert := d.endpoints.NetworkCert()
-	client, err := cluster.ConnectIfVolumeIsRemote(d.cluster, poolID, volumeName, volumeType, cert)
+	client, err := cluster.ConnectIfVolumeIsRemote(d.cluster, poolID, project, volumeName, volumeType, cert)
 	if err != nil && err != db.ErrNoSuchObject {
 		return response.SmartError(err)
 	}
@@ -189,6 +189,16 @@ func Unavailable(err error) Response {
 	return &errorResponse{http.StatusServiceUnavailable, message}
 }
 
+// ErrorCode returns the HTTP status code of an error response, or 0 for any other response.
+func ErrorCode(resp Response) int {
+	errResp, ok := resp.(*errorResponse)
+	if !ok {
+		return 0
+	}
+
+	return errResp.code
+}
+
 func (r *errorResponse) String() string {
 	return r.msg
 }
@@ -365,6 +375,10 @@ func (r *forwardedResponse) Render(w http.ResponseWriter) error {
 		forwarded.Header.Set(key, r.request.Header.Get(key))
 	}
 
+	// Let the target know that the request was made by a client, and only
+	// forwarded by this node.
+	forwarded.Header.Set("X-LXD-forwarded", "true")
+
 	httpClient, err := r.client.GetHTTPClient()
 	if err != nil {
 		return err
@@ -386,3 +400,21 @@ func (r *forwardedResponse) Render(w http.ResponseWriter) error {
 func (r *forwardedResponse) String() string {
 	return fmt.Sprintf("request to %s", r.request.URL)
 }
+
+type manualResponse struct {
+	hook func(w http.ResponseWriter) error
+}
+
+// ManualResponse creates a new manual response responder, which lets the given hook write the
+// response itself, for content that isn't JSON.
+func ManualResponse(hook func(w http.ResponseWriter) error) Response {
+	return &manualResponse{hook: hook}
+}
+
+func (r *manualResponse) Render(w http.ResponseWriter) error {
+	return r.hook(w)
+}
+
+func (r *manualResponse) String() string {
+	return "unknown"
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/shared/api"
 )
 
 // SmartError returns the right error message based on err.
@@ -17,6 +18,12 @@ func SmartError(err error) Response {
 		return EmptySyncResponse
 	}
 
+	// Errors carrying their own HTTP status code, such as the ones of the storage drivers.
+	statusErr, ok := errors.Cause(err).(api.StatusError)
+	if ok {
+		return &errorResponse{statusErr.Status(), err.Error()}
+	}
+
 	switch errors.Cause(err) {
 	case os.ErrNotExist, sql.ErrNoRows, db.ErrNoSuchObject:
 		if errors.Cause(err) != err {
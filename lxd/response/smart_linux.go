@@ -8,6 +8,7 @@ import (
 
 	"github.com/canonical/go-dqlite/driver"
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/shared/api"
 	"github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 )
@@ -18,6 +19,12 @@ func SmartError(err error) Response {
 		return EmptySyncResponse
 	}
 
+	// Errors carrying their own HTTP status code, such as the ones of the storage drivers.
+	statusErr, ok := errors.Cause(err).(api.StatusError)
+	if ok {
+		return &errorResponse{statusErr.Status(), err.Error()}
+	}
+
 	switch errors.Cause(err) {
 	case os.ErrNotExist, sql.ErrNoRows, db.ErrNoSuchObject:
 		if errors.Cause(err) != err {
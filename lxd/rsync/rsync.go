@@ -1,12 +1,17 @@
 package rsync
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,10 +21,32 @@ import (
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/ioprogress"
 	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/units"
 )
 
-// LocalCopy copies a directory using rsync (with the --devices option).
-func LocalCopy(source string, dest string, bwlimit string, xattrs bool) (string, error) {
+// Wrapper is called, if set, with each rsync command about to be run and the
+// paths it synchronizes. It returns the command to run instead, along with a
+// function to call once it exited.
+var Wrapper func(cmd []string, paths ...string) ([]string, func(), error)
+
+func wrap(cmd []string, paths ...string) ([]string, func(), error) {
+	if Wrapper == nil {
+		return cmd, func() {}, nil
+	}
+
+	return Wrapper(cmd, paths...)
+}
+
+// LocalCopy copies a directory using rsync (with the --devices option). Any extra rsyncArgs are
+// passed to rsync as-is.
+func LocalCopy(source string, dest string, bwlimit string, xattrs bool, rsyncArgs ...string) (string, error) {
+	return LocalCopyProgress(source, dest, bwlimit, xattrs, nil, rsyncArgs...)
+}
+
+// LocalCopyProgress copies a directory like LocalCopy, calling progress with the percentage of
+// the transfer done and its speed in bytes per second as rsync reports them. A nil progress
+// function disables the reporting.
+func LocalCopyProgress(source string, dest string, bwlimit string, xattrs bool, progress func(int64, int64), rsyncArgs ...string) (string, error) {
 	err := os.MkdirAll(dest, 0755)
 	if err != nil {
 		return "", err
@@ -52,21 +79,33 @@ func LocalCopy(source string, dest string, bwlimit string, xattrs bool) (string,
 		args = append(args, "--bwlimit", bwlimit)
 	}
 
+	args = append(args, rsyncArgs...)
+	args = append(args, rsyncVerbosity)
+
+	if progress != nil {
+		// Report the progress of the whole transfer, which requires the list of files upfront.
+		args = append(args, "--info=progress2", "--no-inc-recursive")
+	}
+
 	args = append(args,
-		rsyncVerbosity,
 		shared.AddSlash(source),
 		dest)
-	msg, err := shared.RunCommand("rsync", args...)
+
+	cmd, cleanup, err := wrap(append([]string{"rsync"}, args...), source, dest)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	if progress != nil {
+		return runProgress(cmd, progress)
+	}
+
+	msg, err := shared.RunCommand(cmd[0], cmd[1:]...)
 	if err != nil {
 		runError, ok := err.(shared.RunError)
-		if ok {
-			exitError, ok := runError.Err.(*exec.ExitError)
-			if ok {
-				waitStatus := exitError.Sys().(syscall.WaitStatus)
-				if waitStatus.ExitStatus() == 24 {
-					return msg, nil
-				}
-			}
+		if ok && filesVanished(runError.Err) {
+			return msg, nil
 		}
 		return msg, err
 	}
@@ -74,7 +113,154 @@ func LocalCopy(source string, dest string, bwlimit string, xattrs bool) (string,
 	return msg, nil
 }
 
-func sendSetup(name string, path string, bwlimit string, execPath string, features []string) (*exec.Cmd, net.Conn, io.ReadCloser, error) {
+// filesVanished returns whether rsync exited with an error only because some source files
+// vanished during the transfer, which isn't a failure of the copy.
+func filesVanished(err error) bool {
+	exitError, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+
+	waitStatus := exitError.Sys().(syscall.WaitStatus)
+	return waitStatus.ExitStatus() == 24
+}
+
+// Progress lines written by rsync with --info=progress2, like
+// "    123,456,789  42%   12.34MB/s    0:00:12 (xfr#12, to-chk=34/56)".
+var progressRegexp = regexp.MustCompile(`^\s*[0-9,]+\s+([0-9]+)%\s+([0-9.]+)([kMGT]?)B/s`)
+
+// Multipliers of the units of the speed in the progress lines, rsync using powers of 1024.
+var progressUnits = map[string]float64{
+	"":  1,
+	"k": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// parseProgress returns the percentage and the speed in bytes per second of an rsync progress
+// line, and false if the line isn't one.
+func parseProgress(line string) (int64, int64, bool) {
+	match := progressRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	percent, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	speed, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return percent, int64(speed * progressUnits[match[3]]), true
+}
+
+// runProgress runs an rsync command, calling progress with each progress line it outputs, and
+// returns the rest of its output.
+func runProgress(cmd []string, progress func(int64, int64)) (string, error) {
+	c := exec.Command(cmd[0], cmd[1:]...)
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+
+	err = c.Start()
+	if err != nil {
+		return "", err
+	}
+
+	// The progress lines are terminated by carriage returns, the other ones by line feeds.
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		i := bytes.IndexAny(data, "\r\n")
+		if i >= 0 {
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+
+		return 0, nil, nil
+	})
+
+	var output strings.Builder
+	lastPercent := int64(-1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		percent, speed, ok := parseProgress(line)
+		if !ok {
+			if strings.TrimSpace(line) != "" {
+				output.WriteString(line + "\n")
+			}
+
+			continue
+		}
+
+		if percent != lastPercent {
+			lastPercent = percent
+			progress(percent, speed)
+		}
+	}
+
+	err = c.Wait()
+	if err != nil && !filesVanished(err) {
+		return output.String(), fmt.Errorf("Failed to run: %s: %s", strings.Join(cmd, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return output.String(), nil
+}
+
+// ParseBandwidthLimit returns the rate in bytes per second of a limit given like to the --bwlimit
+// option of rsync, as set in rsync.bwlimit: a plain number is in KiB per second, otherwise it's a
+// size with a unit. An empty or zero limit means no limit, which is returned as 0.
+func ParseBandwidthLimit(limit string) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+
+	rate, err := strconv.ParseInt(limit, 10, 64)
+	if err == nil {
+		return rate * 1024, nil
+	}
+
+	rate, err = units.ParseByteSizeString(limit)
+	if err != nil {
+		return -1, fmt.Errorf("Invalid bandwidth limit %q: %v", limit, err)
+	}
+
+	return rate, nil
+}
+
+// LowestBandwidthLimit returns the lowest of the given limits (see ParseBandwidthLimit), the ones
+// meaning no limit being ignored. It returns an empty string if none of them limits the rate.
+func LowestBandwidthLimit(limits ...string) (string, error) {
+	lowest := ""
+	lowestRate := int64(0)
+	for _, limit := range limits {
+		rate, err := ParseBandwidthLimit(limit)
+		if err != nil {
+			return "", err
+		}
+
+		if rate > 0 && (lowestRate == 0 || rate < lowestRate) {
+			lowest = limit
+			lowestRate = rate
+		}
+	}
+
+	return lowest, nil
+}
+
+func sendSetup(name string, path string, bwlimit string, execPath string, features []string, rsyncArgs ...string) (*exec.Cmd, net.Conn, io.ReadCloser, func(), error) {
 	/*
 	 * The way rsync works, it invokes a subprocess that does the actual
 	 * talking (given to it by a -E argument). Since there isn't an easy
@@ -97,7 +283,7 @@ func sendSetup(name string, path string, bwlimit string, execPath string, featur
 	}
 	l, err := net.Listen("unix", auds)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	defer l.Close()
 
@@ -129,6 +315,7 @@ func sendSetup(name string, path string, bwlimit string, execPath string, featur
 		args = append(args, rsyncFeatureArgs(features)...)
 	}
 
+	args = append(args, rsyncArgs...)
 	args = append(args, []string{
 		path,
 		"localhost:/tmp/foo",
@@ -137,15 +324,22 @@ func sendSetup(name string, path string, bwlimit string, execPath string, featur
 		"--bwlimit",
 		bwlimit}...)
 
-	cmd := exec.Command("rsync", args...)
+	wrapped, cleanup, err := wrap(append([]string{"rsync"}, args...), path)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	cmd := exec.Command(wrapped[0], wrapped[1:]...)
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return nil, nil, nil, err
+		cleanup()
+		return nil, nil, nil, nil, err
 	}
 
 	if err := cmd.Start(); err != nil {
-		return nil, nil, nil, err
+		cleanup()
+		return nil, nil, nil, nil, err
 	}
 
 	var conn *net.Conn
@@ -166,25 +360,28 @@ func sendSetup(name string, path string, bwlimit string, execPath string, featur
 		if conn == nil {
 			cmd.Process.Kill()
 			cmd.Wait()
-			return nil, nil, nil, fmt.Errorf("Failed to connect to rsync socket")
+			cleanup()
+			return nil, nil, nil, nil, fmt.Errorf("Failed to connect to rsync socket")
 		}
 
 	case <-time.After(10 * time.Second):
 		cmd.Process.Kill()
 		cmd.Wait()
-		return nil, nil, nil, fmt.Errorf("rsync failed to spawn after 10s")
+		cleanup()
+		return nil, nil, nil, nil, fmt.Errorf("rsync failed to spawn after 10s")
 	}
 
-	return cmd, *conn, stderr, nil
+	return cmd, *conn, stderr, cleanup, nil
 }
 
 // Send sets up the sending half of an rsync, to recursively send the
-// directory pointed to by path over the websocket.
-func Send(name string, path string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string, bwlimit string, execPath string) error {
-	cmd, netcatConn, stderr, err := sendSetup(name, path, bwlimit, execPath, features)
+// directory pointed to by path over the websocket. Any extra rsyncArgs are passed to rsync as-is.
+func Send(name string, path string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string, bwlimit string, execPath string, rsyncArgs ...string) error {
+	cmd, netcatConn, stderr, cleanup, err := sendSetup(name, path, bwlimit, execPath, features, rsyncArgs...)
 	if err != nil {
 		return err
 	}
+	defer cleanup()
 
 	// Setup progress tracker.
 	readNetcatPipe := io.ReadCloser(netcatConn)
@@ -265,7 +462,13 @@ func Recv(path string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTrac
 
 	args = append(args, []string{".", path}...)
 
-	cmd := exec.Command("rsync", args...)
+	wrapped, cleanup, err := wrap(append([]string{"rsync"}, args...), path)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := exec.Command(wrapped[0], wrapped[1:]...)
 
 	// Forward from rsync to source.
 	stdout, err := cmd.StdoutPipe()
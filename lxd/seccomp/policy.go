@@ -0,0 +1,191 @@
+package seccomp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/shared"
+)
+
+// Filesystems which can't be mounted through syscall interception, as they
+// would expose host state or kernel interfaces to the container.
+var mountDenied = []string{
+	"bpf",
+	"cgroup",
+	"cgroup2",
+	"configfs",
+	"debugfs",
+	"devtmpfs",
+	"efivarfs",
+	"proc",
+	"pstore",
+	"securityfs",
+	"sysfs",
+	"tracefs",
+}
+
+var mountFilesystemName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Character devices which can't be created through syscall interception, as
+// they give direct access to the host's memory or I/O ports.
+var mknodDenied = []MknodDevice{
+	{Major: 1, Minor: 1}, // /dev/mem
+	{Major: 1, Minor: 2}, // /dev/kmem
+	{Major: 1, Minor: 4}, // /dev/port
+}
+
+// MknodDevice is a character device which may be created through mknod
+// syscall interception.
+type MknodDevice struct {
+	Major uint32
+	Minor uint32
+}
+
+// ValidateMountAllowed checks the value of
+// security.syscalls.intercept.mount.allowed.
+func ValidateMountAllowed(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	for _, fs := range strings.Split(value, ",") {
+		if !mountFilesystemName.MatchString(fs) {
+			return fmt.Errorf("Invalid filesystem name %q", fs)
+		}
+
+		if shared.StringInSlice(fs, mountDenied) {
+			return fmt.Errorf("Filesystem %q can't be mounted through syscall interception", fs)
+		}
+	}
+
+	return nil
+}
+
+// ParseMountFuse parses the value of security.syscalls.intercept.mount.fuse, a
+// comma-separated list of <filesystem>=<fuse binary> mappings.
+func ParseMountFuse(value string) (map[string]string, error) {
+	mappings := map[string]string{}
+	if value == "" {
+		return mappings, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.SplitN(entry, "=", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			return nil, fmt.Errorf("Invalid mapping %q, must be of the form <filesystem>=<fuse binary>", entry)
+		}
+
+		err := ValidateMountAllowed(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.ContainsAny(fields[1], " \t\n") {
+			return nil, fmt.Errorf("Invalid FUSE binary %q", fields[1])
+		}
+
+		_, ok := mappings[fields[0]]
+		if ok {
+			return nil, fmt.Errorf("Filesystem %q is mapped more than once", fields[0])
+		}
+
+		mappings[fields[0]] = fields[1]
+	}
+
+	return mappings, nil
+}
+
+// ParseMknodDevices parses the value of
+// security.syscalls.intercept.mknod.devices, a comma-separated list of
+// <major>:<minor> character devices.
+func ParseMknodDevices(value string) ([]MknodDevice, error) {
+	devices := []MknodDevice{}
+	if value == "" {
+		return devices, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid device %q, must be of the form <major>:<minor>", entry)
+		}
+
+		major, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid major number in device %q", entry)
+		}
+
+		minor, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid minor number in device %q", entry)
+		}
+
+		device := MknodDevice{Major: uint32(major), Minor: uint32(minor)}
+		for _, denied := range mknodDenied {
+			if device == denied {
+				return nil, fmt.Errorf("Device %q can't be created through syscall interception", entry)
+			}
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// ValidateIntercept checks that the syscall interception keys of the given
+// expanded instance config are consistent.
+func ValidateIntercept(config map[string]string) error {
+	if !shared.IsTrue(config["security.syscalls.intercept.mount"]) {
+		if config["security.syscalls.intercept.mount.allowed"] != "" {
+			return fmt.Errorf("security.syscalls.intercept.mount.allowed requires security.syscalls.intercept.mount")
+		}
+
+		if shared.IsTrue(config["security.syscalls.intercept.mount.shift"]) {
+			return fmt.Errorf("security.syscalls.intercept.mount.shift requires security.syscalls.intercept.mount")
+		}
+
+		if config["security.syscalls.intercept.mount.fuse"] != "" {
+			return fmt.Errorf("security.syscalls.intercept.mount.fuse requires security.syscalls.intercept.mount")
+		}
+	}
+
+	fuse, err := ParseMountFuse(config["security.syscalls.intercept.mount.fuse"])
+	if err != nil {
+		return err
+	}
+
+	if config["security.syscalls.intercept.mount.allowed"] != "" {
+		for _, fs := range strings.Split(config["security.syscalls.intercept.mount.allowed"], ",") {
+			_, ok := fuse[fs]
+			if ok {
+				return fmt.Errorf("Filesystem %q can't be both allowed and mapped to a FUSE binary", fs)
+			}
+		}
+	}
+
+	if !shared.IsTrue(config["security.syscalls.intercept.mknod"]) && config["security.syscalls.intercept.mknod.devices"] != "" {
+		return fmt.Errorf("security.syscalls.intercept.mknod.devices requires security.syscalls.intercept.mknod")
+	}
+
+	return nil
+}
+
+// MknodDeviceAllowed returns whether the given character device was allowed
+// in the instance's security.syscalls.intercept.mknod.devices.
+func MknodDeviceAllowed(config map[string]string, major uint32, minor uint32) bool {
+	devices, err := ParseMknodDevices(config["security.syscalls.intercept.mknod.devices"])
+	if err != nil {
+		return false
+	}
+
+	for _, device := range devices {
+		if device.Major == major && device.Minor == minor {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package seccomp_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/lxd/seccomp"
+)
+
+func TestValidateMountAllowed(t *testing.T) {
+	assert.NoError(t, seccomp.ValidateMountAllowed(""))
+	assert.NoError(t, seccomp.ValidateMountAllowed("ext4,xfs,fuse.sshfs"))
+	assert.Error(t, seccomp.ValidateMountAllowed("ext4,"))
+	assert.Error(t, seccomp.ValidateMountAllowed("ext4,sysfs"))
+}
+
+func TestParseMknodDevices(t *testing.T) {
+	devices, err := seccomp.ParseMknodDevices("10:200,4:64")
+	require.NoError(t, err)
+	assert.Equal(t, []seccomp.MknodDevice{{Major: 10, Minor: 200}, {Major: 4, Minor: 64}}, devices)
+
+	for _, value := range []string{"10", "10:", "a:1", "1:1"} {
+		_, err := seccomp.ParseMknodDevices(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseMountFuse(t *testing.T) {
+	mappings, err := seccomp.ParseMountFuse("ext4=fuse2fs,xfs=/usr/bin/fusexfs")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ext4": "fuse2fs", "xfs": "/usr/bin/fusexfs"}, mappings)
+
+	for _, value := range []string{"ext4", "ext4=", "proc=fuseproc", "ext4=a,ext4=b"} {
+		_, err := seccomp.ParseMountFuse(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestValidateIntercept(t *testing.T) {
+	assert.NoError(t, seccomp.ValidateIntercept(map[string]string{
+		"security.syscalls.intercept.mount":         "true",
+		"security.syscalls.intercept.mount.allowed": "ext4",
+		"security.syscalls.intercept.mount.shift":   "true",
+	}))
+
+	assert.Error(t, seccomp.ValidateIntercept(map[string]string{
+		"security.syscalls.intercept.mount.allowed": "ext4",
+	}))
+
+	assert.Error(t, seccomp.ValidateIntercept(map[string]string{
+		"security.syscalls.intercept.mknod.devices": "10:200",
+	}))
+
+	assert.Error(t, seccomp.ValidateIntercept(map[string]string{
+		"security.syscalls.intercept.mount":         "true",
+		"security.syscalls.intercept.mount.allowed": "ext4",
+		"security.syscalls.intercept.mount.fuse":    "ext4=fuse2fs",
+	}))
+}
@@ -918,6 +918,16 @@ func (s *Server) doDeviceSyscall(c Instance, args *MknodArgs, siov *Iovec) int {
 	return 0
 }
 
+// Return whether the instance's config allows creating the given device, on
+// top of the devices which are always allowed.
+func mknodConfigAllowed(c Instance, dev uint64, mode uint64) bool {
+	if uint32(mode)&unix.S_IFMT != unix.S_IFCHR {
+		return false
+	}
+
+	return MknodDeviceAllowed(c.ExpandedConfig(), unix.Major(dev), unix.Minor(dev))
+}
+
 // HandleMknodSyscall handles a mknod syscall.
 func (s *Server) HandleMknodSyscall(c Instance, siov *Iovec) int {
 	ctx := log.Ctx{"container": c.Name(),
@@ -930,7 +940,7 @@ func (s *Server) HandleMknodSyscall(c Instance, siov *Iovec) int {
 
 	defer logger.Debug("Handling mknod syscall", ctx)
 
-	if C.device_allowed(C.dev_t(siov.req.data.args[2]), C.mode_t(siov.req.data.args[1])) < 0 {
+	if C.device_allowed(C.dev_t(siov.req.data.args[2]), C.mode_t(siov.req.data.args[1])) < 0 && !mknodConfigAllowed(c, siov.req.data.args[2], siov.req.data.args[1]) {
 		ctx["err"] = "Device not allowed"
 		if s.s.OS.SeccompListenerContinue {
 			ctx["syscall_continue"] = "true"
@@ -992,6 +1002,10 @@ func (s *Server) HandleMknodatSyscall(c Instance, siov *Iovec) int {
 	}
 
 	siov.resp.error = C.device_allowed(C.dev_t(siov.req.data.args[3]), C.mode_t(siov.req.data.args[2]))
+	if siov.resp.error != 0 && mknodConfigAllowed(c, siov.req.data.args[3], siov.req.data.args[2]) {
+		siov.resp.error = 0
+	}
+
 	if siov.resp.error != 0 {
 		ctx["err"] = "Device not allowed"
 		if s.s.OS.SeccompListenerContinue {
@@ -1258,6 +1272,25 @@ func (s *Server) HandleMountSyscall(c Instance, siov *Iovec) int {
 		return 0
 	}
 
+	fuseBinary := s.MountSyscallFuse(c, args.fstype)
+	if fuseBinary != "" {
+		ctx["fuse"] = fuseBinary
+		_, _, err := shared.RunCommandSplit(nil, util.GetExecPath(),
+			"forksyscall",
+			"fuse",
+			fmt.Sprintf("%d", args.pid),
+			args.source,
+			args.target,
+			fuseBinary,
+			args.data)
+		if err != nil {
+			ctx["err"] = fmt.Sprintf("Failed to run FUSE binary: %s", err)
+			return int(-C.EPERM)
+		}
+
+		return 0
+	}
+
 	nsuid, nsgid, nsfsuid, nsfsgid, err := TaskIDs(args.pid)
 	if err != nil {
 		ctx["syscall_continue"] = "true"
@@ -1387,9 +1420,27 @@ func MountSyscallFilter(config map[string]string) []string {
 		}
 	}
 
+	fuse, err := ParseMountFuse(config["security.syscalls.intercept.mount.fuse"])
+	if err == nil {
+		for fusefs := range fuse {
+			fs = append(fs, fusefs)
+		}
+	}
+
 	return fs
 }
 
+// MountSyscallFuse returns the FUSE binary handling mounts of the given
+// filesystem, if any.
+func (s *Server) MountSyscallFuse(c Instance, fstype string) string {
+	fuse, err := ParseMountFuse(c.ExpandedConfig()["security.syscalls.intercept.mount.fuse"])
+	if err != nil {
+		return ""
+	}
+
+	return fuse[fstype]
+}
+
 // MountSyscallValid checks whether this is a mount syscall we intercept.
 func (s *Server) MountSyscallValid(c Instance, args *MountArgs) bool {
 	fsList := MountSyscallFilter(c.ExpandedConfig())
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned when a secret doesn't exist in a backend.
+var ErrNotFound = fmt.Errorf("Secret not found")
+
+// Backend stores secrets by name, keeping them out of the database.
+type Backend interface {
+	// String returns the name of the backend.
+	String() string
+
+	Get(name string) (string, error)
+	Set(name string, value string) error
+	Delete(name string) error
+}
+
+// Prefix of the references to secrets, as stored in place of their values.
+const referencePrefix = "secret:"
+
+// Reference returns the value to store in place of the secret with the given
+// name.
+func Reference(name string) string {
+	return referencePrefix + name
+}
+
+// IsReference returns the name of the secret referenced by the given value,
+// or false if the value isn't a reference.
+func IsReference(value string) (string, bool) {
+	if !strings.HasPrefix(value, referencePrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(value, referencePrefix), true
+}
+
+// ValidName checks that the given secret name can be used with all backends.
+func ValidName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("Invalid secret name %q", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// File stores each secret in its own file, readable by root only.
+type File struct {
+	path string
+}
+
+// NewFile returns a backend storing secrets in the given directory.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// String returns the name of the backend.
+func (f *File) String() string {
+	return "file"
+}
+
+// Get returns the value of the secret with the given name.
+func (f *File) Get(name string) (string, error) {
+	err := ValidName(name)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := ioutil.ReadFile(filepath.Join(f.path, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNotFound
+		}
+
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+// Set stores the value of the secret with the given name.
+func (f *File) Set(name string, value string) error {
+	err := ValidName(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(f.path, 0700)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that the secret is replaced
+	// atomically.
+	temp, err := ioutil.TempFile(f.path, ".secret_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.WriteString(value)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), filepath.Join(f.path, name))
+}
+
+// Delete removes the secret with the given name.
+func (f *File) Delete(name string) error {
+	err := ValidName(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(f.path, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
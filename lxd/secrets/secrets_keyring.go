@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Keyring stores secrets in the kernel keyring of the user running LXD. They
+// don't survive a reboot, so they need to be provisioned again at boot.
+type Keyring struct{}
+
+// NewKeyring returns a backend storing secrets in the kernel keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{}
+}
+
+// String returns the name of the backend.
+func (k *Keyring) String() string {
+	return "keyring"
+}
+
+// Prefix of the descriptions of the keys holding LXD secrets.
+const keyringPrefix = "lxd:"
+
+// Get returns the value of the secret with the given name.
+func (k *Keyring) Get(name string) (string, error) {
+	id, err := k.search(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Query the size of the payload first.
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf[:size]), nil
+}
+
+// Set stores the value of the secret with the given name.
+func (k *Keyring) Set(name string, value string) error {
+	err := ValidName(name)
+	if err != nil {
+		return err
+	}
+
+	// Adding a key with the same description updates it.
+	_, err = unix.AddKey("user", keyringPrefix+name, []byte(value), unix.KEY_SPEC_USER_KEYRING)
+	return err
+}
+
+// Delete removes the secret with the given name.
+func (k *Keyring) Delete(name string) error {
+	id, err := k.search(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+	return err
+}
+
+func (k *Keyring) search(name string) (int, error) {
+	err := ValidName(name)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyringPrefix+name, 0)
+	if err != nil {
+		if err == unix.ENOKEY {
+			return 0, ErrNotFound
+		}
+
+		return 0, err
+	}
+
+	return id, nil
+}
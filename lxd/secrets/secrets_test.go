@@ -0,0 +1,97 @@
+package secrets_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/lxd/secrets"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxd-secrets-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend := secrets.NewFile(filepath.Join(dir, "secrets"))
+
+	_, err = backend.Get("maas.api.key")
+	assert.Equal(t, secrets.ErrNotFound, err)
+
+	require.NoError(t, backend.Set("maas.api.key", "abc"))
+	require.NoError(t, backend.Set("maas.api.key", "def"))
+
+	value, err := backend.Get("maas.api.key")
+	require.NoError(t, err)
+	assert.Equal(t, "def", value)
+
+	info, err := os.Stat(filepath.Join(dir, "secrets", "maas.api.key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode())
+
+	require.NoError(t, backend.Delete("maas.api.key"))
+	assert.Equal(t, secrets.ErrNotFound, backend.Delete("maas.api.key"))
+
+	assert.Error(t, backend.Set("../escape", "abc"))
+}
+
+func TestVault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxd-secrets-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("s.token\n"), 0600))
+
+	stored := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/secret/data/lxd/maas.api.key":
+			req := map[string]map[string]string{}
+			json.NewDecoder(r.Body).Decode(&req)
+			stored["maas.api.key"] = req["data"]["value"]
+		case "GET /v1/secret/data/lxd/maas.api.key":
+			value, ok := stored["maas.api.key"]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": map[string]string{"value": value}},
+			})
+		case "DELETE /v1/secret/metadata/lxd/maas.api.key":
+			delete(stored, "maas.api.key")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	backend := secrets.NewVault(server.URL, tokenFile, "secret")
+
+	_, err = backend.Get("maas.api.key")
+	assert.Equal(t, secrets.ErrNotFound, err)
+
+	require.NoError(t, backend.Set("maas.api.key", "abc"))
+
+	value, err := backend.Get("maas.api.key")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", value)
+
+	require.NoError(t, backend.Delete("maas.api.key"))
+	assert.Empty(t, stored)
+}
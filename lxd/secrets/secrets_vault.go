@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Vault stores secrets in the key/value (version 2) secrets engine of a
+// HashiCorp Vault server, under the "lxd/" path of the engine.
+type Vault struct {
+	address   string
+	tokenFile string
+	mount     string
+	client    *http.Client
+}
+
+// NewVault returns a backend storing secrets in the Vault server at the given
+// address, in the key/value engine mounted at the given path. The token used
+// to authenticate is read from the given file on each request, so that it can
+// be renewed by an external agent.
+func NewVault(address string, tokenFile string, mount string) *Vault {
+	return &Vault{
+		address:   strings.TrimSuffix(address, "/"),
+		tokenFile: tokenFile,
+		mount:     strings.Trim(mount, "/"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// String returns the name of the backend.
+func (v *Vault) String() string {
+	return "vault"
+}
+
+// Get returns the value of the secret with the given name.
+func (v *Vault) Get(name string) (string, error) {
+	resp := struct {
+		Data struct {
+			Data struct {
+				Value string `json:"value"`
+			} `json:"data"`
+		} `json:"data"`
+	}{}
+
+	err := v.query("GET", "data", name, nil, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Data.Data.Value, nil
+}
+
+// Set stores the value of the secret with the given name.
+func (v *Vault) Set(name string, value string) error {
+	req := map[string]interface{}{
+		"data": map[string]string{"value": value},
+	}
+
+	return v.query("POST", "data", name, req, nil)
+}
+
+// Delete removes the secret with the given name, along with all its versions.
+func (v *Vault) Delete(name string) error {
+	return v.query("DELETE", "metadata", name, nil, nil)
+}
+
+func (v *Vault) query(method string, kind string, name string, req interface{}, resp interface{}) error {
+	err := ValidName(name)
+	if err != nil {
+		return err
+	}
+
+	token, err := ioutil.ReadFile(v.tokenFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read Vault token: %v", err)
+	}
+
+	var body bytes.Buffer
+	if req != nil {
+		err := json.NewEncoder(&body).Encode(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	requestURL := fmt.Sprintf("%s/v1/%s/%s/lxd/%s", v.address, v.mount, kind, url.PathEscape(name))
+	request, err := http.NewRequest(method, requestURL, &body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := v.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Vault request failed: %s", response.Status)
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(resp)
+}
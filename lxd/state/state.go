@@ -6,6 +6,7 @@ import (
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/endpoints"
 	"github.com/lxc/lxd/lxd/events"
+	"github.com/lxc/lxd/lxd/firewall"
 	"github.com/lxc/lxd/lxd/maas"
 	"github.com/lxc/lxd/lxd/sys"
 )
@@ -30,11 +31,14 @@ type State struct {
 	// Event server
 	DevlxdEvents *events.Server
 	Events       *events.Server
+
+	// Firewall instance
+	Firewall firewall.Firewall
 }
 
 // NewState returns a new State object with the given database and operating
 // system components.
-func NewState(node *db.Node, cluster *db.Cluster, maas *maas.Controller, os *sys.OS, endpoints *endpoints.Endpoints, events *events.Server, devlxdEvents *events.Server) *State {
+func NewState(node *db.Node, cluster *db.Cluster, maas *maas.Controller, os *sys.OS, endpoints *endpoints.Endpoints, events *events.Server, devlxdEvents *events.Server, firewall firewall.Firewall) *State {
 	return &State{
 		Node:         node,
 		Cluster:      cluster,
@@ -43,5 +47,6 @@ func NewState(node *db.Node, cluster *db.Cluster, maas *maas.Controller, os *sys
 		Endpoints:    endpoints,
 		DevlxdEvents: devlxdEvents,
 		Events:       events,
+		Firewall:     firewall,
 	}
 }
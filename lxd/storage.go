@@ -34,6 +34,10 @@ func init() {
 	device.StorageVolumeMount = storageVolumeMount
 	// Expose storageVolumeUmount to the device package as StorageVolumeUmount.
 	device.StorageVolumeUmount = storageVolumeUmount
+	// Expose storageVolumeRemoteMount to the device package as StorageVolumeRemoteMount.
+	device.StorageVolumeRemoteMount = storageVolumeRemoteMount
+	// Expose storageVolumeRemoteUmount to the device package as StorageVolumeRemoteUmount.
+	device.StorageVolumeRemoteUmount = storageVolumeRemoteUmount
 	// Expose storageRootFSApplyQuota to the device package as StorageRootFSApplyQuota.
 	device.StorageRootFSApplyQuota = storageRootFSApplyQuota
 
@@ -257,6 +261,14 @@ type storage interface {
 	StorageMigrationSink(conn *websocket.Conn, op *operations.Operation, args MigrationSinkArgs) error
 }
 
+// The storageCloner interface is implemented by the storage backends able to
+// create containers as copy-on-write clones of another container, and to later
+// make such clones independent of their source.
+type storageCloner interface {
+	ContainerClone(target Instance, source Instance) error
+	ContainerFlatten(c Instance) error
+}
+
 func storageCoreInit(driver string) (storage, error) {
 	sType, err := storageStringToType(driver)
 	if err != nil {
@@ -888,6 +900,11 @@ func storageVolumeUmount(state *state.State, poolName string, volumeName string,
 // storageRootFSApplyQuota applies a quota to an instance if it can, if it cannot then it will
 // return false indicating that the quota needs to be stored in volatile to be applied on next boot.
 func storageRootFSApplyQuota(state *state.State, inst device.Instance, size string) error {
+	vm, ok := inst.(*vmQemu)
+	if ok {
+		return vmRootDiskApplyQuota(state, vm, size)
+	}
+
 	c, ok := inst.(*containerLXC)
 	if !ok {
 		return fmt.Errorf("Received non-LXC container instance")
@@ -926,3 +943,28 @@ func storageRootFSApplyQuota(state *state.State, inst device.Instance, size stri
 
 	return nil
 }
+
+// vmRootDiskApplyQuota grows the root disk of a virtual machine, letting it see the new size of the
+// disk straight away when it's running.
+func vmRootDiskApplyQuota(state *state.State, vm *vmQemu, size string) error {
+	pool, err := storagePools.GetPoolByInstance(state, vm)
+	if err != nil {
+		return err
+	}
+
+	err = pool.SetInstanceQuota(vm, size, nil)
+	if err != nil {
+		return err
+	}
+
+	if !vm.IsRunning() {
+		return nil
+	}
+
+	diskPath, _, err := pool.GetInstanceDisk(vm)
+	if err != nil {
+		return err
+	}
+
+	return vm.growDisk(diskPath, size)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/lxc/lxd/shared"
+)
+
+// splitList returns the entries of a comma separated configuration value.
+func splitList(value string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// validateVolumeProjects checks the value of security.projects, a comma separated list of project
+// names.
+func validateVolumeProjects(value string) error {
+	for _, project := range splitList(value) {
+		if strings.Contains(project, "/") || shared.StringInSlice(project, []string{".", "..", "*"}) {
+			return fmt.Errorf("Invalid project name %q", project)
+		}
+	}
+
+	return nil
+}
+
+// validateVolumeCertificates checks the value of security.certificates, a comma separated list
+// of client certificate fingerprints.
+func validateVolumeCertificates(value string) error {
+	for _, fingerprint := range splitList(value) {
+		_, err := hex.DecodeString(fingerprint)
+		if err != nil || len(fingerprint) != 64 {
+			return fmt.Errorf("Invalid certificate fingerprint %q, must be the full SHA256 fingerprint", fingerprint)
+		}
+	}
+
+	return nil
+}
+
+// VolumeProjectAllowed returns whether a custom volume with the given config may be attached to
+// the instances of a project. Volumes without security.projects may be attached in any project.
+func VolumeProjectAllowed(config map[string]string, project string) bool {
+	projects := splitList(config["security.projects"])
+
+	return len(projects) == 0 || shared.StringInSlice(project, projects)
+}
+
+// VolumeCertificateAllowed returns whether a custom volume with the given config may be attached
+// by the client using the certificate with the given fingerprint (empty for clients which didn't
+// authenticate with a certificate). Volumes without security.certificates may be attached by any
+// client.
+func VolumeCertificateAllowed(config map[string]string, fingerprint string) bool {
+	fingerprints := splitList(config["security.certificates"])
+	if len(fingerprints) == 0 {
+		return true
+	}
+
+	for _, allowed := range fingerprints {
+		if fingerprint != "" && strings.EqualFold(allowed, fingerprint) {
+			return true
+		}
+	}
+
+	return false
+}
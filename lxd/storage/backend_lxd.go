@@ -3,21 +3,29 @@ package storage
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
+	"gopkg.in/yaml.v2"
+
+	"github.com/lxc/lxd/lxd/backup"
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/locking"
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/project"
+	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/lxd/storage/memorypipe"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
 	"github.com/lxc/lxd/shared/ioprogress"
 	log "github.com/lxc/lxd/shared/log15"
 	"github.com/lxc/lxd/shared/logger"
@@ -120,11 +128,18 @@ func (b *lxdBackend) newVolume(volType drivers.VolumeType, contentType drivers.C
 	return drivers.NewVolume(b.driver, b.name, volType, contentType, volName, volConfig)
 }
 
+// GetResources returns the space and inodes used and available in the pool.
 func (b *lxdBackend) GetResources() (*api.ResourcesStoragePool, error) {
 	logger := logging.AddContext(b.logger, nil)
 	logger.Debug("GetResources started")
 	defer logger.Debug("GetResources finished")
 
+	// The pool is left mounted, as it is whenever LXD uses it.
+	_, err := b.driver.Mount()
+	if err != nil {
+		return nil, err
+	}
+
 	return b.driver.GetResources()
 }
 
@@ -322,8 +337,68 @@ func (b *lxdBackend) CreateInstance(inst Instance, op *operations.Operation) err
 	return nil
 }
 
-func (b *lxdBackend) CreateInstanceFromBackup(inst Instance, sourcePath string, op *operations.Operation) error {
-	return ErrNotImplemented
+// CreateInstanceFromBackup creates the volume of a container and of its snapshots from a backup
+// tarball, and leaves the volume mounted so that the container can then be imported from its
+// backup.yaml. Optimized backups can only be restored on a pool of the driver which wrote them,
+// generic ones on a pool of any driver. The returned function undoes the restore and is meant to
+// be called if importing the container fails.
+func (b *lxdBackend) CreateInstanceFromBackup(srcBackup backup.Info, srcData io.ReadSeeker, op *operations.Operation) (func(), error) {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": srcBackup.Project, "instance": srcBackup.Name, "snapshots": srcBackup.Snapshots, "optimized": srcBackup.HasBinaryFormat})
+	logger.Debug("CreateInstanceFromBackup started")
+	defer logger.Debug("CreateInstanceFromBackup finished")
+
+	if srcBackup.HasBinaryFormat && srcBackup.Backend != b.driver.Info().Name {
+		return nil, fmt.Errorf("Optimized backups made on a %s pool can't be restored on a %s pool", srcBackup.Backend, b.driver.Info().Name)
+	}
+
+	volStorageName := project.Prefix(srcBackup.Project, srcBackup.Name)
+	vol := b.newVolume(drivers.VolumeTypeContainer, drivers.ContentTypeFS, volStorageName, nil)
+
+	err := b.driver.CreateVolumeFromBackup(vol, srcBackup.Snapshots, srcData, srcBackup.HasBinaryFormat, op)
+	if err != nil {
+		return nil, err
+	}
+
+	revertFunc := func() {
+		b.driver.UnmountVolume(vol.Type(), vol.Name(), op)
+
+		for _, snapName := range srcBackup.Snapshots {
+			b.driver.DeleteVolumeSnapshot(vol.Type(), vol.Name(), snapName, op)
+		}
+
+		b.driver.DeleteVolume(vol.Type(), vol.Name(), op)
+		b.removeInstanceSymlink(instancetype.Container, srcBackup.Project, srcBackup.Name)
+		b.removeInstanceSnapshotSymlinkIfUnused(instancetype.Container, srcBackup.Project, srcBackup.Name)
+	}
+
+	revert := true
+	defer func() {
+		if !revert {
+			return
+		}
+
+		revertFunc()
+	}()
+
+	err = b.ensureInstanceSymlink(instancetype.Container, srcBackup.Project, srcBackup.Name, vol.MountPath())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(srcBackup.Snapshots) > 0 {
+		err = b.ensureInstanceSnapshotSymlink(instancetype.Container, srcBackup.Project, srcBackup.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = b.driver.MountVolume(vol.Type(), vol.Name(), op)
+	if err != nil {
+		return nil, err
+	}
+
+	revert = false
+	return revertFunc, nil
 }
 
 func (b *lxdBackend) CreateInstanceFromCopy(inst Instance, src Instance, snapshots bool, op *operations.Operation) error {
@@ -412,8 +487,62 @@ func (b *lxdBackend) CreateInstanceFromImage(inst Instance, fingerprint string,
 	return nil
 }
 
-func (b *lxdBackend) CreateInstanceFromMigration(inst Instance, conn io.ReadWriteCloser, args migration.SinkArgs, op *operations.Operation) error {
-	return ErrNotImplemented
+// CreateInstanceFromMigration receives the volume of an instance and of its snapshots being
+// migrated. The records of the instance and of its snapshots must already exist.
+func (b *lxdBackend) CreateInstanceFromMigration(inst Instance, conn io.ReadWriteCloser, args migration.VolumeTargetArgs, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name(), "args": args})
+	logger.Debug("CreateInstanceFromMigration started")
+	defer logger.Debug("CreateInstanceFromMigration finished")
+
+	if inst.IsSnapshot() {
+		return fmt.Errorf("Instance cannot be a snapshot")
+	}
+
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return err
+	}
+
+	contentType := drivers.ContentTypeFS
+	if inst.Type() == instancetype.VM {
+		contentType = drivers.ContentTypeBlock
+	}
+
+	vol := b.newVolume(volType, contentType, project.Prefix(inst.Project(), inst.Name()), nil)
+	err = b.driver.CreateVolumeFromMigration(vol, conn, args, op)
+	if err != nil {
+		return err
+	}
+
+	revert := true
+	defer func() {
+		if !revert {
+			return
+		}
+
+		for _, snapName := range args.Snapshots {
+			b.driver.DeleteVolumeSnapshot(vol.Type(), vol.Name(), snapName, op)
+		}
+
+		b.driver.DeleteVolume(vol.Type(), vol.Name(), op)
+		b.removeInstanceSymlink(inst.Type(), inst.Project(), inst.Name())
+		b.removeInstanceSnapshotSymlinkIfUnused(inst.Type(), inst.Project(), inst.Name())
+	}()
+
+	err = b.ensureInstanceSymlink(inst.Type(), inst.Project(), inst.Name(), vol.MountPath())
+	if err != nil {
+		return err
+	}
+
+	if len(args.Snapshots) > 0 {
+		err = b.ensureInstanceSnapshotSymlink(inst.Type(), inst.Project(), inst.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	revert = false
+	return nil
 }
 
 // RenameInstance renames the instance's root volume and any snapshot volumes.
@@ -552,7 +681,7 @@ func (b *lxdBackend) DeleteInstance(inst Instance, op *operations.Operation) err
 
 	// Check all snapshots are already removed.
 	if len(snapshots) > 0 {
-		return fmt.Errorf("Cannot remove an instance volume that has snapshots")
+		return drivers.Errorf(drivers.ErrInUse, "Cannot remove an instance volume that has snapshots")
 	}
 
 	// Get the volume name on storage.
@@ -586,16 +715,84 @@ func (b *lxdBackend) DeleteInstance(inst Instance, op *operations.Operation) err
 	return nil
 }
 
-func (b *lxdBackend) MigrateInstance(inst Instance, snapshots bool, args migration.SourceArgs) (migration.StorageSourceDriver, error) {
-	return nil, ErrNotImplemented
+// MigrateInstance sends the volume of an instance and of the snapshots listed in the arguments,
+// using the migration type negotiated with the target.
+func (b *lxdBackend) MigrateInstance(inst Instance, conn io.ReadWriteCloser, args migration.VolumeSourceArgs, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name(), "args": args})
+	logger.Debug("MigrateInstance started")
+	defer logger.Debug("MigrateInstance finished")
+
+	if inst.IsSnapshot() {
+		return fmt.Errorf("Instance cannot be a snapshot")
+	}
+
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return err
+	}
+
+	contentType := drivers.ContentTypeFS
+	if inst.Type() == instancetype.VM {
+		contentType = drivers.ContentTypeBlock
+	}
+
+	conn, err = b.limitBandwidth(conn, args.BandwidthLimit)
+	if err != nil {
+		return err
+	}
+
+	vol := b.newVolume(volType, contentType, project.Prefix(inst.Project(), inst.Name()), nil)
+	return b.driver.MigrateVolume(vol, conn, args, op)
+}
+
+// limitBandwidth returns the connection to send a volume over, throttled to the lowest of the
+// given limit and the rsync.bwlimit of the pool. Rsync applies the latter itself, the throttling
+// of the connection extends it to the send streams of the drivers.
+func (b *lxdBackend) limitBandwidth(conn io.ReadWriteCloser, limit string) (io.ReadWriteCloser, error) {
+	limit, err := rsync.LowestBandwidthLimit(b.driver.Config()["rsync.bwlimit"], limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := rsync.ParseBandwidthLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return migration.LimitBandwidth(conn, rate), nil
 }
 
 func (b *lxdBackend) RefreshInstance(inst Instance, src Instance, snapshots bool, op *operations.Operation) error {
 	return ErrNotImplemented
 }
 
-func (b *lxdBackend) BackupInstance(inst Instance, targetPath string, optimized bool, snapshots bool, op *operations.Operation) error {
-	return ErrNotImplemented
+// BackupInstance writes the content of an instance's volume and of the given snapshots to the
+// tarball, in the driver's optimized format if requested.
+func (b *lxdBackend) BackupInstance(inst Instance, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name(), "optimized": optimized, "snapshots": snapshots})
+	logger.Debug("BackupInstance started")
+	defer logger.Debug("BackupInstance finished")
+
+	if inst.IsSnapshot() {
+		return fmt.Errorf("Instance must not be a snapshot")
+	}
+
+	if optimized && !b.driver.Info().OptimizedBackups {
+		return drivers.Errorf(drivers.ErrNotSupported, "Optimized backups not supported by the %s driver", b.driver.Info().Name)
+	}
+
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return err
+	}
+
+	contentType := drivers.ContentTypeFS
+	if inst.Type() == instancetype.VM {
+		contentType = drivers.ContentTypeBlock
+	}
+
+	vol := b.newVolume(volType, contentType, project.Prefix(inst.Project(), inst.Name()), nil)
+	return b.driver.BackupVolume(vol, tarWriter, optimized, snapshots, op)
 }
 
 // GetInstanceUsage returns the disk usage of the instance's root volume.
@@ -604,22 +801,58 @@ func (b *lxdBackend) GetInstanceUsage(inst Instance) (int64, error) {
 	logger.Debug("GetInstanceUsage started")
 	defer logger.Debug("GetInstanceUsage finished")
 
-	if inst.Type() == instancetype.Container {
-		return b.driver.GetVolumeUsage(drivers.VolumeTypeContainer, inst.Name())
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return -1, err
+	}
+
+	contentType := drivers.ContentTypeFS
+	if inst.Type() == instancetype.VM {
+		contentType = drivers.ContentTypeBlock
+	}
+
+	// Get the volume name on storage.
+	volStorageName := project.Prefix(inst.Project(), inst.Name())
+
+	return b.driver.GetVolumeUsage(b.newVolume(volType, contentType, volStorageName, nil))
+}
+
+// GetInstanceDirectoryUsage returns the disk usage of each top-level directory of the instance's
+// root filesystem, as last computed in the background.
+func (b *lxdBackend) GetInstanceDirectoryUsage(inst Instance) (map[string]int64, error) {
+	if inst.Type() != instancetype.Container {
+		return nil, ErrNotImplemented
+	}
+
+	volStorageName := project.Prefix(inst.Project(), inst.Name())
+	path := filepath.Join(drivers.GetVolumeMountPath(b.name, drivers.VolumeTypeContainer, volStorageName), "rootfs")
+
+	mount := func() (func(), error) {
+		ourMount, err := b.MountInstance(inst, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return func() {
+			if ourMount {
+				b.UnmountInstance(inst, nil)
+			}
+		}, nil
 	}
 
-	return -1, ErrNotImplemented
+	return DirectoryUsage(fmt.Sprintf("%s/%s", b.name, volStorageName), path, mount), nil
 }
 
 // SetInstanceQuota sets the quota on the instance's root volume.
 // Returns ErrRunningQuotaResizeNotSupported if the instance is running and the storage driver
-// doesn't support resizing whilst the instance is running.
+// doesn't support resizing whilst the instance is running. The disks of virtual machines can only
+// grow, which all drivers support whilst they're in use.
 func (b *lxdBackend) SetInstanceQuota(inst Instance, size string, op *operations.Operation) error {
 	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name()})
 	logger.Debug("SetInstanceQuota started")
 	defer logger.Debug("SetInstanceQuota finished")
 
-	if inst.IsRunning() && !b.driver.Info().RunningQuotaResize {
+	if inst.IsRunning() && !b.driver.Info().RunningQuotaResize && inst.Type() != instancetype.VM {
 		return ErrRunningQuotaResizeNotSupported
 	}
 
@@ -635,6 +868,61 @@ func (b *lxdBackend) SetInstanceQuota(inst Instance, size string, op *operations
 	return b.driver.SetVolumeQuota(volType, volStorageName, size, op)
 }
 
+// CompactInstance releases the space freed in the disk of a stopped virtual machine.
+func (b *lxdBackend) CompactInstance(inst Instance, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name()})
+	logger.Debug("CompactInstance started")
+	defer logger.Debug("CompactInstance finished")
+
+	if inst.Type() != instancetype.VM {
+		return ErrNotImplemented
+	}
+
+	if inst.IsRunning() {
+		return fmt.Errorf("Instance must be stopped to be compacted")
+	}
+
+	// Check we can convert the instance to the volume type needed.
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return err
+	}
+
+	// Get the volume name on storage.
+	volStorageName := project.Prefix(inst.Project(), inst.Name())
+
+	vol := b.newVolume(volType, drivers.ContentTypeBlock, volStorageName, nil)
+	return b.driver.CompactVolume(vol, op)
+}
+
+// CheckInstance checks the consistency of the root volume of a stopped instance.
+func (b *lxdBackend) CheckInstance(inst Instance, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name()})
+	logger.Debug("CheckInstance started")
+	defer logger.Debug("CheckInstance finished")
+
+	if inst.IsRunning() {
+		return nil, drivers.Errorf(drivers.ErrInUse, "Instance must be stopped to be checked")
+	}
+
+	// Check we can convert the instance to the volume type needed.
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := drivers.ContentTypeFS
+	if inst.Type() == instancetype.VM {
+		contentType = drivers.ContentTypeBlock
+	}
+
+	// Get the volume name on storage.
+	volStorageName := project.Prefix(inst.Project(), inst.Name())
+
+	vol := b.newVolume(volType, contentType, volStorageName, nil)
+	return b.driver.CheckVolume(vol, op)
+}
+
 // MountInstance mounts the instance's root volume.
 func (b *lxdBackend) MountInstance(inst Instance, op *operations.Operation) (bool, error) {
 	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name()})
@@ -687,7 +975,7 @@ func (b *lxdBackend) GetInstanceDisk(inst Instance) (string, string, error) {
 	volStorageName := project.Prefix(inst.Project(), inst.Name())
 
 	// Get the location of the disk block device.
-	diskPath, diskType, err := b.driver.GetVolumeDiskPath(volType, volStorageName)
+	diskPath, diskType, err := b.newVolume(volType, drivers.ContentTypeBlock, volStorageName, nil).GetDiskPath()
 	if err != nil {
 		return "", "", err
 	}
@@ -795,8 +1083,43 @@ func (b *lxdBackend) DeleteInstanceSnapshot(inst Instance, op *operations.Operat
 	return nil
 }
 
-func (b *lxdBackend) RestoreInstanceSnapshot(inst Instance, op *operations.Operation) error {
-	return ErrNotImplemented
+// RestoreInstanceSnapshot restores the root volume of an instance from one of its snapshots. The
+// snapshots taken after it must have been deleted beforehand by drivers which can't keep them.
+func (b *lxdBackend) RestoreInstanceSnapshot(inst Instance, src Instance, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"project": inst.Project(), "instance": inst.Name(), "src": src.Name()})
+	logger.Debug("RestoreInstanceSnapshot started")
+	defer logger.Debug("RestoreInstanceSnapshot finished")
+
+	if inst.IsSnapshot() {
+		return fmt.Errorf("Instance must not be a snapshot")
+	}
+
+	parentName, snapName, isSnap := shared.ContainerGetParentAndSnapshotName(src.Name())
+	if !src.IsSnapshot() || !isSnap {
+		return fmt.Errorf("Source instance must be a snapshot")
+	}
+
+	if parentName != inst.Name() || src.Project() != inst.Project() {
+		return fmt.Errorf("Snapshot %q doesn't belong to the instance", src.Name())
+	}
+
+	if inst.IsRunning() {
+		return drivers.Errorf(drivers.ErrInUse, "Cannot restore a running instance")
+	}
+
+	// Check we can convert the instance to the volume type needed.
+	volType, err := InstanceTypeToVolumeType(inst.Type())
+	if err != nil {
+		return err
+	}
+
+	contentType := drivers.ContentTypeFS
+	if inst.Type() == instancetype.VM {
+		contentType = drivers.ContentTypeBlock
+	}
+
+	vol := b.newVolume(volType, contentType, project.Prefix(inst.Project(), inst.Name()), nil)
+	return b.driver.RestoreVolume(vol, snapName, false, op)
 }
 
 // MountInstanceSnapshot mounts an instance snapshot. It is mounted as read only so that the
@@ -850,8 +1173,26 @@ func (b *lxdBackend) UnmountInstanceSnapshot(inst Instance, op *operations.Opera
 	return b.driver.UnmountVolumeSnapshot(volType, volStorageName, snapName, op)
 }
 
+// imageVolumeSize returns the size new image volumes of the pool get, which is either the
+// volume.size of the pool or the default size of its driver.
+func (b *lxdBackend) imageVolumeSize() (string, error) {
+	_, pool, err := b.state.Cluster.StoragePoolGet(b.name)
+	if err != nil {
+		return "", err
+	}
+
+	config := map[string]string{"size": pool.Config["volume.size"]}
+	err = VolumeFillDefault(b.name, config, pool)
+	if err != nil {
+		return "", err
+	}
+
+	return config["size"], nil
+}
+
 // EnsureImage creates an optimized volume of the image if supported by the storage pool driver and
-// the volume doesn't already exist.
+// the volume doesn't already exist. The volume is recorded in the database with the size it was
+// created with, and is replaced if the volume.size of the pool changed since.
 func (b *lxdBackend) EnsureImage(fingerprint string, op *operations.Operation) error {
 	logger := logging.AddContext(b.logger, log.Ctx{"fingerprint": fingerprint})
 	logger.Debug("EnsureImage started")
@@ -861,10 +1202,8 @@ func (b *lxdBackend) EnsureImage(fingerprint string, op *operations.Operation) e
 		return nil // Nothing to do for drivers that don't support optimized images volumes.
 	}
 
-	// Check if we already have a suitable volume.
-	if b.driver.HasVolume(drivers.VolumeTypeImage, fingerprint) {
-		return nil
-	}
+	unlock := locking.Lock(fmt.Sprintf("image/%s/%s", b.name, fingerprint))
+	defer unlock()
 
 	// Load image info from database.
 	_, image, err := b.state.Cluster.ImageGetFromAnyProject(fingerprint)
@@ -877,58 +1216,197 @@ func (b *lxdBackend) EnsureImage(fingerprint string, op *operations.Operation) e
 		contentType = drivers.ContentTypeBlock
 	}
 
-	// Create the new image volume.
-	vol := b.newVolume(drivers.VolumeTypeImage, contentType, fingerprint, nil)
-	err = b.driver.CreateVolume(vol, b.imageFiller(fingerprint, op), op)
+	size, err := b.imageVolumeSize()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	config := map[string]string{}
+	if size != "" {
+		config["size"] = size
+	}
 
-// DeleteImage removes an image from the database and underlying storage device if needed.
-func (b *lxdBackend) DeleteImage(fingerprint string, op *operations.Operation) error {
-	logger := logging.AddContext(b.logger, log.Ctx{"fingerprint": fingerprint})
-	logger.Debug("DeleteImage started")
-	defer logger.Debug("DeleteImage finished")
+	// Check if we already have a suitable volume.
+	if b.driver.HasVolume(drivers.VolumeTypeImage, fingerprint) {
+		_, imgVol, err := b.state.Cluster.StoragePoolNodeVolumeGetType(fingerprint, db.StoragePoolVolumeTypeImage, b.ID())
+		if err == db.ErrNoSuchObject {
+			// Adopt the volumes created before image volumes were recorded in the database.
+			return VolumeDBCreate(b.state, b.name, fingerprint, "", db.StoragePoolVolumeTypeNameImage, false, config, contentType)
+		} else if err != nil {
+			return err
+		}
 
-	regexSHA256, err := regexp.Compile("^[0-9a-f]{64}$")
-	if err != nil {
-		return err
+		if imgVol.Config["size"] == size {
+			return nil
+		}
+
+		logger.Debug("Replacing image volume created with another size", log.Ctx{"size": imgVol.Config["size"], "newSize": size})
 	}
 
-	if !regexSHA256.MatchString(fingerprint) {
-		return fmt.Errorf("Invalid fingerprint")
+	// Remove the outdated volume and any leftover database record.
+	err = b.deleteImageVolume(fingerprint, op)
+	if err != nil {
+		return err
 	}
 
-	err = b.driver.DeleteVolume(drivers.VolumeTypeImage, fingerprint, op)
+	// Create the new image volume.
+	vol := b.newVolume(drivers.VolumeTypeImage, contentType, fingerprint, config)
+	err = b.driver.CreateVolume(vol, b.imageFiller(fingerprint, op), op)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	err = b.state.Cluster.StoragePoolVolumeDelete("default", fingerprint, db.StoragePoolVolumeTypeImage, b.ID())
+	err = VolumeDBCreate(b.state, b.name, fingerprint, "", db.StoragePoolVolumeTypeNameImage, false, config, contentType)
 	if err != nil {
+		b.driver.DeleteVolume(drivers.VolumeTypeImage, fingerprint, op)
 		return err
 	}
 
-	return ErrNotImplemented
+	return nil
 }
 
-// CreateCustomVolume creates an empty custom volume.
-func (b *lxdBackend) CreateCustomVolume(volName, desc string, config map[string]string, op *operations.Operation) error {
-	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "desc": desc, "config": config})
-	logger.Debug("CreateCustomVolume started")
-	defer logger.Debug("CreateCustomVolume finished")
+// deleteImageVolume removes the image volume and its database record, whichever of them exist.
+// The caller must hold the lock of the image volume.
+func (b *lxdBackend) deleteImageVolume(fingerprint string, op *operations.Operation) error {
+	if b.driver.HasVolume(drivers.VolumeTypeImage, fingerprint) {
+		err := b.driver.DeleteVolume(drivers.VolumeTypeImage, fingerprint, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := b.state.Cluster.StoragePoolVolumeDelete("default", fingerprint, db.StoragePoolVolumeTypeImage, b.ID())
+	if err != nil && err != db.ErrNoSuchObject {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteImage removes an image from the database and underlying storage device if needed.
+func (b *lxdBackend) DeleteImage(fingerprint string, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"fingerprint": fingerprint})
+	logger.Debug("DeleteImage started")
+	defer logger.Debug("DeleteImage finished")
+
+	regexSHA256, err := regexp.Compile("^[0-9a-f]{64}$")
+	if err != nil {
+		return err
+	}
+
+	if !regexSHA256.MatchString(fingerprint) {
+		return fmt.Errorf("Invalid fingerprint")
+	}
+
+	unlock := locking.Lock(fmt.Sprintf("image/%s/%s", b.name, fingerprint))
+	defer unlock()
+
+	return b.deleteImageVolume(fingerprint, op)
+}
+
+// PruneImages removes the image volumes of the pool on this node which are no longer of use,
+// either because their image was deleted or because they were created with another size than
+// the current volume.size of the pool. The volumes still used by instances are kept by the
+// drivers until these are gone.
+func (b *lxdBackend) PruneImages(op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, nil)
+	logger.Debug("PruneImages started")
+	defer logger.Debug("PruneImages finished")
+
+	if !b.driver.Info().OptimizedImages {
+		return nil
+	}
+
+	fingerprints, err := b.state.Cluster.StoragePoolNodeVolumesGetType(db.StoragePoolVolumeTypeImage, b.ID())
+	if err != nil {
+		return err
+	}
+
+	size, err := b.imageVolumeSize()
+	if err != nil {
+		return err
+	}
+
+	for _, fingerprint := range fingerprints {
+		_, _, err := b.state.Cluster.ImageGetFromAnyProject(fingerprint)
+		if err != nil && err != db.ErrNoSuchObject {
+			return err
+		}
+
+		if err == nil {
+			_, imgVol, err := b.state.Cluster.StoragePoolNodeVolumeGetType(fingerprint, db.StoragePoolVolumeTypeImage, b.ID())
+			if err != nil {
+				return err
+			}
+
+			if imgVol.Config["size"] == size {
+				continue
+			}
+		}
+
+		logger.Debug("Pruning image volume", log.Ctx{"fingerprint": fingerprint})
+		err = b.DeleteImage(fingerprint, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CustomVolumeWarnings returns a warning for each key of the config of a new custom volume which the
+// driver of the pool accepts but won't apply, either because it drops the key when translating a
+// config coming from a pool of another driver or because it ignores the key.
+func (b *lxdBackend) CustomVolumeWarnings(volName string, config map[string]string, contentType drivers.ContentType) []api.StorageVolumeWarning {
+	warnings := []api.StorageVolumeWarning{}
+
+	// Validate a copy of the config, as the driver removes the keys it doesn't know about from it.
+	volConfig := make(map[string]string, len(config))
+	for k, v := range config {
+		volConfig[k] = v
+	}
+
+	vol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, volConfig)
+	err := b.driver.ValidateVolume(vol, true)
+	if err != nil {
+		// Invalid configs are refused when creating the volume.
+		return warnings
+	}
+
+	for k := range config {
+		_, ok := volConfig[k]
+		if !ok {
+			warnings = append(warnings, api.StorageVolumeWarning{
+				Key:     k,
+				Message: fmt.Sprintf("Not supported by the %q storage driver", b.driver.Info().Name),
+			})
+		}
+	}
+
+	for k, reason := range b.driver.IgnoredVolumeKeys(vol) {
+		warnings = append(warnings, api.StorageVolumeWarning{Key: k, Message: reason})
+	}
+
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Key < warnings[j].Key })
+
+	return warnings
+}
+
+// CreateCustomVolume creates an empty custom volume, holding either a filesystem or a raw block
+// device.
+func (b *lxdBackend) CreateCustomVolume(volName, desc string, config map[string]string, contentType drivers.ContentType, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "desc": desc, "config": config, "contentType": contentType})
+	logger.Debug("CreateCustomVolume started")
+	defer logger.Debug("CreateCustomVolume finished")
 
 	// Validate config.
-	err := b.driver.ValidateVolume(b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, volName, config), false)
+	err := b.driver.ValidateVolume(b.newVolume(drivers.VolumeTypeCustom, contentType, volName, config), false)
 	if err != nil {
 		return err
 	}
 
 	// Create database entry for new storage volume.
-	err = VolumeDBCreate(b.state, b.name, volName, desc, db.StoragePoolVolumeTypeNameCustom, false, config)
+	err = VolumeDBCreate(b.state, b.name, volName, desc, db.StoragePoolVolumeTypeNameCustom, false, config, contentType)
 	if err != nil {
 		return err
 	}
@@ -941,7 +1419,7 @@ func (b *lxdBackend) CreateCustomVolume(volName, desc string, config map[string]
 	}()
 
 	// Create the empty custom volume on the storage device.
-	newVol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, volName, config)
+	newVol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, config)
 	err = b.driver.CreateVolume(newVol, nil, op)
 	if err != nil {
 		return err
@@ -951,6 +1429,80 @@ func (b *lxdBackend) CreateCustomVolume(volName, desc string, config map[string]
 	return nil
 }
 
+// CreateCustomVolumeFromTarball creates a custom volume and unpacks the given tarball into it.
+func (b *lxdBackend) CreateCustomVolumeFromTarball(volName, desc string, config map[string]string, tarballPath string, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "desc": desc, "config": config, "tarballPath": tarballPath})
+	logger.Debug("CreateCustomVolumeFromTarball started")
+	defer logger.Debug("CreateCustomVolumeFromTarball finished")
+
+	return b.createCustomVolumeWithData(volName, desc, config, func(mountPath string, op *operations.Operation) error {
+		return shared.Unpack(tarballPath, mountPath, false, b.state.OS.RunningInUserNS, nil)
+	}, op)
+}
+
+// CreateCustomVolumeFromRsync creates a custom volume and populates it from a remote rsync source.
+func (b *lxdBackend) CreateCustomVolumeFromRsync(volName, desc string, config map[string]string, source string, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "desc": desc, "config": config, "source": source})
+	logger.Debug("CreateCustomVolumeFromRsync started")
+	defer logger.Debug("CreateCustomVolumeFromRsync finished")
+
+	return b.createCustomVolumeWithData(volName, desc, config, func(mountPath string, op *operations.Operation) error {
+		msg, err := rsync.LocalCopy(source, mountPath, "", false)
+		if err != nil {
+			return fmt.Errorf("Failed to rsync from %s: %s: %s", source, strings.TrimSpace(msg), err)
+		}
+
+		return nil
+	}, op)
+}
+
+// createCustomVolumeWithData creates an empty custom volume and then runs the filler against its
+// mount path, removing the volume again if anything fails.
+func (b *lxdBackend) createCustomVolumeWithData(volName, desc string, config map[string]string, filler func(mountPath string, op *operations.Operation) error, op *operations.Operation) error {
+	err := b.CreateCustomVolume(volName, desc, config, drivers.ContentTypeFS, op)
+	if err != nil {
+		return err
+	}
+
+	revert := true
+	defer func() {
+		if revert {
+			b.DeleteCustomVolume(volName, op)
+		}
+	}()
+
+	vol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, volName, config)
+	err = vol.MountTask(filler, op)
+	if err != nil {
+		return err
+	}
+
+	revert = false
+	return nil
+}
+
+// sourcePool returns the backend of the pool holding the source volume of a copy, which is the
+// target pool itself when they are the same.
+func (b *lxdBackend) sourcePool(srcPoolName string) (*lxdBackend, error) {
+	if b.name == srcPoolName {
+		return b, nil // Source and target are in the same pool so share pool var.
+	}
+
+	// Source is in a different pool to target, so load the pool.
+	srcPool, err := GetPoolByName(b.state, srcPoolName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to lxdBackend so we can access driver.
+	srcBackend, ok := srcPool.(*lxdBackend)
+	if !ok {
+		return nil, fmt.Errorf("Pool is not an lxdBackend")
+	}
+
+	return srcBackend, nil
+}
+
 // CreateCustomVolumeFromCopy creates a custom volume from an existing custom volume.
 // It copies the snapshots from the source volume by default, but can be disabled if requested.
 func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map[string]string, srcPoolName, srcVolName string, srcVolOnly bool, op *operations.Operation) error {
@@ -958,31 +1510,16 @@ func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map
 	logger.Debug("CreateCustomVolumeFromCopy started")
 	defer logger.Debug("CreateCustomVolumeFromCopy finished")
 
-	// Setup the source pool backend instance.
-	var srcPool *lxdBackend
-	if b.name == srcPoolName {
-		srcPool = b // Source and target are in the same pool so share pool var.
-	} else {
-		// Source is in a different pool to target, so load the pool.
-		tmpPool, err := GetPoolByName(b.state, srcPoolName)
-		if err != nil {
-			return err
-		}
-
-		// Convert to lxdBackend so we can access driver.
-		tmpBackend, ok := tmpPool.(*lxdBackend)
-		if !ok {
-			return fmt.Errorf("Pool is not an lxdBackend")
-		}
-
-		srcPool = tmpBackend
+	srcPool, err := b.sourcePool(srcPoolName)
+	if err != nil {
+		return err
 	}
 
 	// Check source volume exists and is custom type.
 	_, srcVolRow, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", srcVolName, db.StoragePoolVolumeTypeCustom, srcPool.ID())
 	if err != nil {
 		if err == db.ErrNoSuchObject {
-			return fmt.Errorf("Source volume doesn't exist")
+			return drivers.Errorf(drivers.ErrNotFound, "Source volume doesn't exist")
 		}
 
 		return err
@@ -998,6 +1535,12 @@ func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map
 		desc = srcVolRow.Description
 	}
 
+	// The copy gets the content type of the source volume.
+	contentType, err := VolumeContentTypeNameToContentType(srcVolRow.ContentType)
+	if err != nil {
+		return err
+	}
+
 	// If we are copying snapshots, retrieve a list of snapshots from source volume.
 	snapshotNames := []string{}
 	if !srcVolOnly {
@@ -1012,13 +1555,20 @@ func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map
 		}
 	}
 
+	// Within a pool, let the driver copy the volume with its own cloning rather than streaming its
+	// content.
+	if srcPool == b {
+		return b.createCustomVolumeFromClone(volName, desc, config, contentType, srcVolName, srcVolRow.Config, snapshotNames, op)
+	}
+
 	// Create in-memory pipe pair to simulate a connection between the sender and receiver.
 	aEnd, bEnd := memorypipe.NewPipePair()
 
-	// Negotiate the migration type to use.
-	offeredTypes := srcPool.MigrationTypes(drivers.ContentTypeFS)
+	// Negotiate the migration type to use. Pools of the same driver use its send/receive streams
+	// if it has any, other pools fall back to an rsync of the mounted volumes.
+	offeredTypes := srcPool.MigrationTypes(contentType)
 	offerHeader := migration.TypesToHeader(offeredTypes...)
-	migrationType, err := migration.MatchTypes(offerHeader, migration.MigrationFSType_RSYNC, b.MigrationTypes(drivers.ContentTypeFS))
+	migrationType, err := migration.MatchTypes(offerHeader, migration.MigrationFSType_RSYNC, b.MigrationTypes(contentType))
 	if err != nil {
 		return fmt.Errorf("Failed to neogotiate copy migration type: %v", err)
 	}
@@ -1027,7 +1577,10 @@ func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map
 	aEndErrCh := make(chan error, 1)
 	bEndErrCh := make(chan error, 1)
 	go func() {
-		err := srcPool.MigrateCustomVolume(aEnd, migration.VolumeSourceArgs{
+		// The volume is sent through the driver directly, as MigrateCustomVolume only sends
+		// filesystem volumes to other servers.
+		vol := srcPool.newVolume(drivers.VolumeTypeCustom, contentType, srcVolName, srcVolRow.Config)
+		err := srcPool.driver.MigrateVolume(vol, aEnd, migration.VolumeSourceArgs{
 			Name:          srcVolName,
 			Snapshots:     snapshotNames,
 			MigrationType: migrationType,
@@ -1045,7 +1598,7 @@ func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map
 			Snapshots:     snapshotNames,
 			MigrationType: migrationType,
 			TrackProgress: false, // Do not a progress tracker on receiver.
-
+			ContentType:   string(contentType),
 		}, op)
 
 		bEndErrCh <- err
@@ -1070,14 +1623,198 @@ func (b *lxdBackend) CreateCustomVolumeFromCopy(volName, desc string, config map
 	return nil
 }
 
+// createCustomVolumeFromClone copies a custom volume (and the given snapshots) within the pool,
+// using the driver's own copy of volumes.
+func (b *lxdBackend) createCustomVolumeFromClone(volName, desc string, config map[string]string, contentType drivers.ContentType, srcVolName string, srcConfig map[string]string, snapshotNames []string, op *operations.Operation) error {
+	// Create slice to record DB volumes created if revert needed later.
+	revertDBVolumes := []string{}
+	defer func() {
+		// Remove any DB volume rows created if we are reverting.
+		for _, volName := range revertDBVolumes {
+			b.state.Cluster.StoragePoolVolumeDelete("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
+		}
+	}()
+
+	vol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, config)
+
+	// Check the supplied config and remove any fields not relevant for the pool type.
+	err := b.driver.ValidateVolume(vol, true)
+	if err != nil {
+		return err
+	}
+
+	// Create database entry for new storage volume.
+	err = VolumeDBCreate(b.state, b.name, volName, desc, db.StoragePoolVolumeTypeNameCustom, false, config, contentType)
+	if err != nil {
+		return err
+	}
+
+	revertDBVolumes = append(revertDBVolumes, volName)
+
+	for _, snapName := range snapshotNames {
+		newSnapshotName := drivers.GetSnapshotVolumeName(volName, snapName)
+
+		// Create database entry for new storage volume snapshot.
+		err = VolumeDBCreate(b.state, b.name, newSnapshotName, desc, db.StoragePoolVolumeTypeNameCustom, true, config, contentType)
+		if err != nil {
+			return err
+		}
+
+		revertDBVolumes = append(revertDBVolumes, newSnapshotName)
+	}
+
+	srcVol := b.newVolume(drivers.VolumeTypeCustom, contentType, srcVolName, srcConfig)
+	err = b.driver.CreateVolumeFromCopy(vol, srcVol, len(snapshotNames) > 0, op)
+	if err != nil {
+		return err
+	}
+
+	revertDBVolumes = nil
+	return nil
+}
+
+// RefreshCustomVolume brings an existing custom volume up to date with another custom volume,
+// possibly of another pool. Unless only the volume is refreshed, its snapshots which the source
+// doesn't have are deleted and the ones it's missing are copied over. Snapshots are matched by name.
+func (b *lxdBackend) RefreshCustomVolume(volName, srcPoolName, srcVolName string, srcVolOnly bool, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "srcPoolName": srcPoolName, "srcVolName": srcVolName, "srcVolOnly": srcVolOnly})
+	logger.Debug("RefreshCustomVolume started")
+	defer logger.Debug("RefreshCustomVolume finished")
+
+	srcPool, err := b.sourcePool(srcPoolName)
+	if err != nil {
+		return err
+	}
+
+	if srcPool == b && volName == srcVolName {
+		return fmt.Errorf("Cannot refresh a volume from itself")
+	}
+
+	_, volRow, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return drivers.Errorf(drivers.ErrNotFound, "Volume doesn't exist")
+		}
+
+		return err
+	}
+
+	_, srcVolRow, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", srcVolName, db.StoragePoolVolumeTypeCustom, srcPool.ID())
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return drivers.Errorf(drivers.ErrNotFound, "Source volume doesn't exist")
+		}
+
+		return err
+	}
+
+	if volRow.ContentType != srcVolRow.ContentType {
+		return fmt.Errorf("Cannot refresh a %s volume from a %s volume", volRow.ContentType, srcVolRow.ContentType)
+	}
+
+	contentType, err := VolumeContentTypeNameToContentType(volRow.ContentType)
+	if err != nil {
+		return err
+	}
+
+	// Work out which snapshots to delete and which to copy over, keeping the order of the source.
+	syncSnapshots := []db.StorageVolumeArgs{}
+	if !srcVolOnly {
+		snapshots, err := VolumeSnapshotsGet(b.state, b.name, volName, db.StoragePoolVolumeTypeCustom)
+		if err != nil {
+			return err
+		}
+
+		srcSnapshots, err := VolumeSnapshotsGet(b.state, srcPoolName, srcVolName, db.StoragePoolVolumeTypeCustom)
+		if err != nil {
+			return err
+		}
+
+		snapNames := []string{}
+		for _, snapshot := range snapshots {
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snapshot.Name)
+			snapNames = append(snapNames, snapName)
+		}
+
+		srcSnapNames := []string{}
+		for _, srcSnapshot := range srcSnapshots {
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName(srcSnapshot.Name)
+			srcSnapNames = append(srcSnapNames, snapName)
+
+			if !shared.StringInSlice(snapName, snapNames) {
+				syncSnapshots = append(syncSnapshots, srcSnapshot)
+			}
+		}
+
+		for _, snapName := range snapNames {
+			if shared.StringInSlice(snapName, srcSnapNames) {
+				continue
+			}
+
+			err = b.DeleteCustomVolumeSnapshot(drivers.GetSnapshotVolumeName(volName, snapName), op)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Create slice to record DB volumes created if revert needed later.
+	revertDBVolumes := []string{}
+	defer func() {
+		// Remove any DB volume rows created if we are reverting.
+		for _, volName := range revertDBVolumes {
+			b.state.Cluster.StoragePoolVolumeDelete("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
+		}
+	}()
+
+	syncSnapNames := []string{}
+	for _, srcSnapshot := range syncSnapshots {
+		_, snapName, _ := shared.ContainerGetParentAndSnapshotName(srcSnapshot.Name)
+		newSnapshotName := drivers.GetSnapshotVolumeName(volName, snapName)
+
+		// Create database entry for new storage volume snapshot.
+		err = VolumeDBCreate(b.state, b.name, newSnapshotName, srcSnapshot.Description, db.StoragePoolVolumeTypeNameCustom, true, volRow.Config, contentType)
+		if err != nil {
+			return err
+		}
+
+		revertDBVolumes = append(revertDBVolumes, newSnapshotName)
+		syncSnapNames = append(syncSnapNames, snapName)
+	}
+
+	vol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, volRow.Config)
+	srcVol := srcPool.newVolume(drivers.VolumeTypeCustom, contentType, srcVolName, srcVolRow.Config)
+	err = b.driver.RefreshVolume(vol, srcVol, syncSnapNames, op)
+	if err != nil {
+		return err
+	}
+
+	revertDBVolumes = nil
+	return nil
+}
+
 // MigrateCustomVolume sends a volume for migration.
 func (b *lxdBackend) MigrateCustomVolume(conn io.ReadWriteCloser, args migration.VolumeSourceArgs, op *operations.Operation) error {
 	logger := logging.AddContext(b.logger, log.Ctx{"volName": args.Name, "args": args})
 	logger.Debug("MigrateCustomVolume started")
 	defer logger.Debug("MigrateCustomVolume finished")
 
-	vol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, args.Name, nil)
-	err := b.driver.MigrateVolume(vol, conn, args, op)
+	contentType, err := b.customVolumeContentType(args.Name)
+	if err != nil {
+		return err
+	}
+
+	if contentType != drivers.ContentTypeFS {
+		return drivers.Errorf(drivers.ErrNotSupported, "Custom block volumes can't be migrated")
+	}
+
+	conn, err = b.limitBandwidth(conn, args.BandwidthLimit)
+	if err != nil {
+		return err
+	}
+
+	vol := b.newVolume(drivers.VolumeTypeCustom, contentType, args.Name, nil)
+	err = b.driver.MigrateVolume(vol, conn, args, op)
 	if err != nil {
 		return err
 	}
@@ -1100,14 +1837,19 @@ func (b *lxdBackend) CreateCustomVolumeFromMigration(conn io.ReadWriteCloser, ar
 		}
 	}()
 
+	contentType := drivers.ContentTypeFS
+	if args.ContentType != "" {
+		contentType = drivers.ContentType(args.ContentType)
+	}
+
 	// Check the supplied config and remove any fields not relevant for destination pool type.
-	err := b.driver.ValidateVolume(b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, args.Name, args.Config), true)
+	err := b.driver.ValidateVolume(b.newVolume(drivers.VolumeTypeCustom, contentType, args.Name, args.Config), true)
 	if err != nil {
 		return err
 	}
 
 	// Create database entry for new storage volume.
-	err = VolumeDBCreate(b.state, b.name, args.Name, args.Description, db.StoragePoolVolumeTypeNameCustom, false, args.Config)
+	err = VolumeDBCreate(b.state, b.name, args.Name, args.Description, db.StoragePoolVolumeTypeNameCustom, false, args.Config, contentType)
 	if err != nil {
 		return err
 	}
@@ -1119,7 +1861,7 @@ func (b *lxdBackend) CreateCustomVolumeFromMigration(conn io.ReadWriteCloser, ar
 			newSnapshotName := drivers.GetSnapshotVolumeName(args.Name, snapName)
 
 			// Create database entry for new storage volume snapshot.
-			err = VolumeDBCreate(b.state, b.name, newSnapshotName, args.Description, db.StoragePoolVolumeTypeNameCustom, true, args.Config)
+			err = VolumeDBCreate(b.state, b.name, newSnapshotName, args.Description, db.StoragePoolVolumeTypeNameCustom, true, args.Config, contentType)
 			if err != nil {
 				return err
 			}
@@ -1128,10 +1870,10 @@ func (b *lxdBackend) CreateCustomVolumeFromMigration(conn io.ReadWriteCloser, ar
 		}
 	}
 
-	vol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, args.Name, args.Config)
+	vol := b.newVolume(drivers.VolumeTypeCustom, contentType, args.Name, args.Config)
 	err = b.driver.CreateVolumeFromMigration(vol, conn, args, op)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	revertDBVolumes = nil
@@ -1215,29 +1957,34 @@ func (b *lxdBackend) UpdateCustomVolume(volName, newDesc string, newConfig map[s
 		return fmt.Errorf("Volume name cannot be a snapshot")
 	}
 
-	// Validate config.
-	newVol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, volName, newConfig)
-	err := b.driver.ValidateVolume(newVol, false)
-	if err != nil {
-		return err
-	}
-
 	// Get current config to compare what has changed.
 	_, curVol, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
 	if err != nil {
 		if err == db.ErrNoSuchObject {
-			return fmt.Errorf("Volume doesn't exist")
+			return drivers.Errorf(drivers.ErrNotFound, "Volume doesn't exist")
 		}
 
 		return err
 	}
 
-	// Diff the configurations.
+	contentType, err := VolumeContentTypeNameToContentType(curVol.ContentType)
+	if err != nil {
+		return err
+	}
+
+	// Validate config.
+	newVol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, newConfig)
+	err = b.driver.ValidateVolume(newVol, false)
+	if err != nil {
+		return err
+	}
+
+	// Diff the configurations (user and webhook keys are of no concern to the storage driver).
 	changedConfig := make(map[string]string)
 	userOnly := true
 	for key := range curVol.Config {
 		if curVol.Config[key] != newConfig[key] {
-			if !strings.HasPrefix(key, "user.") {
+			if !strings.HasPrefix(key, "user.") && !strings.HasPrefix(key, "webhooks.") {
 				userOnly = false
 			}
 
@@ -1247,7 +1994,7 @@ func (b *lxdBackend) UpdateCustomVolume(volName, newDesc string, newConfig map[s
 
 	for key := range newConfig {
 		if curVol.Config[key] != newConfig[key] {
-			if !strings.HasPrefix(key, "user.") {
+			if !strings.HasPrefix(key, "user.") && !strings.HasPrefix(key, "webhooks.") {
 				userOnly = false
 			}
 
@@ -1257,7 +2004,7 @@ func (b *lxdBackend) UpdateCustomVolume(volName, newDesc string, newConfig map[s
 
 	// Apply config changes if there are any.
 	if len(changedConfig) != 0 {
-		curVol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, volName, curVol.Config)
+		curVol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, curVol.Config)
 		if !userOnly {
 			err = b.driver.UpdateVolume(curVol, changedConfig)
 			if err != nil {
@@ -1342,7 +2089,39 @@ func (b *lxdBackend) DeleteCustomVolume(volName string, op *operations.Operation
 
 // GetCustomVolumeUsage returns the disk space used by the custom volume.
 func (b *lxdBackend) GetCustomVolumeUsage(volName string) (int64, error) {
-	return b.driver.GetVolumeUsage(drivers.VolumeTypeCustom, volName)
+	contentType, err := b.customVolumeContentType(volName)
+	if err != nil {
+		return -1, err
+	}
+
+	return b.driver.GetVolumeUsage(b.newVolume(drivers.VolumeTypeCustom, contentType, volName, nil))
+}
+
+// CheckCustomVolume checks the consistency of a custom volume which no running instance uses.
+func (b *lxdBackend) CheckCustomVolume(volName string, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName})
+	logger.Debug("CheckCustomVolume started")
+	defer logger.Debug("CheckCustomVolume finished")
+
+	if shared.IsSnapshot(volName) {
+		return nil, fmt.Errorf("Volume cannot be snapshot")
+	}
+
+	usingVolume, err := VolumeUsedByInstancesWithProfiles(b.state, b.Name(), volName, db.StoragePoolVolumeTypeNameCustom, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(usingVolume) != 0 {
+		return nil, drivers.Errorf(drivers.ErrInUse, "Cannot check custom volume used by running instances")
+	}
+
+	contentType, err := b.customVolumeContentType(volName)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.driver.CheckVolume(b.newVolume(drivers.VolumeTypeCustom, contentType, volName, nil), op)
 }
 
 // MountCustomVolume mounts a custom volume.
@@ -1363,6 +2142,242 @@ func (b *lxdBackend) UnmountCustomVolume(volName string, op *operations.Operatio
 	return b.driver.UnmountVolume(drivers.VolumeTypeCustom, volName, op)
 }
 
+// GetCustomVolumeDisk returns the location and format of the disk of a custom block volume, to
+// attach it to virtual machines.
+func (b *lxdBackend) GetCustomVolumeDisk(volName string) (string, string, error) {
+	contentType, err := b.customVolumeContentType(volName)
+	if err != nil {
+		return "", "", err
+	}
+
+	return b.newVolume(drivers.VolumeTypeCustom, contentType, volName, nil).GetDiskPath()
+}
+
+// MountCustomVolumeShare mounts the filesystem of a custom filesystem volume and returns its mount
+// path, for qemu to share it with virtual machines. It's unmounted with UnmountCustomVolume.
+func (b *lxdBackend) MountCustomVolumeShare(volName string, op *operations.Operation) (string, error) {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName})
+	logger.Debug("MountCustomVolumeShare started")
+	defer logger.Debug("MountCustomVolumeShare finished")
+
+	contentType, err := b.customVolumeContentType(volName)
+	if err != nil {
+		return "", err
+	}
+
+	if contentType != drivers.ContentTypeFS {
+		return "", drivers.Errorf(drivers.ErrNotSupported, "Only custom filesystem volumes can be shared")
+	}
+
+	_, err = b.driver.MountVolume(drivers.VolumeTypeCustom, volName, op)
+	if err != nil {
+		return "", err
+	}
+
+	return b.newVolume(drivers.VolumeTypeCustom, contentType, volName, nil).MountPath(), nil
+}
+
+// ExportCustomVolumeDisk writes the disk of a custom block volume to targetPath as a qcow2 file,
+// as used for the root disk of virtual machine images. The unallocated and zeroed areas of the
+// disk are skipped, so the file only takes the space of the data actually written to the volume.
+func (b *lxdBackend) ExportCustomVolumeDisk(volName string, targetPath string, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "targetPath": targetPath})
+	logger.Debug("ExportCustomVolumeDisk started")
+	defer logger.Debug("ExportCustomVolumeDisk finished")
+
+	if shared.IsSnapshot(volName) {
+		return fmt.Errorf("Volume cannot be a snapshot")
+	}
+
+	ourMount, err := b.MountCustomVolume(volName, op)
+	if err != nil {
+		return err
+	}
+
+	if ourMount {
+		defer b.UnmountCustomVolume(volName, op)
+	}
+
+	diskPath, diskFormat, err := b.GetCustomVolumeDisk(volName)
+	if err != nil {
+		return err
+	}
+
+	_, err = shared.RunCommand("qemu-img", "convert", "-f", diskFormat, "-O", "qcow2", diskPath, targetPath)
+	if err != nil {
+		return fmt.Errorf("Failed converting volume disk to qcow2: %v", err)
+	}
+
+	return nil
+}
+
+// BackupCustomVolume writes a backup tarball of a custom volume, made of its index.yaml followed
+// by the content of its snapshots (unless volumeOnly is set) and of the volume itself. Optimized
+// backups hold the content in the binary format of the driver.
+func (b *lxdBackend) BackupCustomVolume(volName string, writer io.Writer, optimized bool, volumeOnly bool, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "optimized": optimized, "volumeOnly": volumeOnly})
+	logger.Debug("BackupCustomVolume started")
+	defer logger.Debug("BackupCustomVolume finished")
+
+	if shared.IsSnapshot(volName) {
+		return fmt.Errorf("Volume cannot be a snapshot")
+	}
+
+	if optimized && !b.driver.Info().OptimizedBackups {
+		return drivers.Errorf(drivers.ErrNotSupported, "Optimized backups not supported by the %s driver", b.driver.Info().Name)
+	}
+
+	_, volume, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return drivers.Errorf(drivers.ErrNotFound, "Volume doesn't exist")
+		}
+
+		return err
+	}
+
+	contentType, err := VolumeContentTypeNameToContentType(volume.ContentType)
+	if err != nil {
+		return err
+	}
+
+	index := backup.Info{
+		Project:   "default",
+		Name:      volName,
+		Backend:   b.driver.Info().Name,
+		Pool:      b.name,
+		Snapshots: []string{},
+		Volume:    &api.StorageVolumePut{Description: volume.Description, Config: volume.Config},
+	}
+
+	if !volumeOnly {
+		snapshots, err := VolumeSnapshotsGet(b.state, b.name, volName, db.StoragePoolVolumeTypeCustom)
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range snapshots {
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snapshot.Name)
+			index.Snapshots = append(index.Snapshots, snapName)
+		}
+	}
+
+	data, err := yaml.Marshal(&index)
+	if err != nil {
+		return err
+	}
+
+	indexFile, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_backup_index_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(indexFile.Name())
+
+	_, err = indexFile.Write(data)
+	indexFile.Close()
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Lstat(indexFile.Name())
+	if err != nil {
+		return err
+	}
+
+	tarWriter := containerwriter.NewContainerTarWriter(writer, nil)
+
+	err = tarWriter.WriteFileAs("backup/index.yaml", indexFile.Name(), fi)
+	if err != nil {
+		return err
+	}
+
+	vol := b.newVolume(drivers.VolumeTypeCustom, contentType, volName, volume.Config)
+	err = b.driver.BackupVolume(vol, tarWriter, optimized, index.Snapshots, op)
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+// CreateCustomVolumeFromBackup creates a custom volume and its snapshots from a backup tarball
+// written by BackupCustomVolume, the name of the volume being the one of the backup info.
+func (b *lxdBackend) CreateCustomVolumeFromBackup(srcBackup backup.Info, srcData io.ReadSeeker, op *operations.Operation) error {
+	logger := logging.AddContext(b.logger, log.Ctx{"volName": srcBackup.Name, "snapshots": srcBackup.Snapshots, "optimized": srcBackup.HasBinaryFormat})
+	logger.Debug("CreateCustomVolumeFromBackup started")
+	defer logger.Debug("CreateCustomVolumeFromBackup finished")
+
+	if srcBackup.Volume == nil {
+		return fmt.Errorf("Backup isn't a custom volume backup")
+	}
+
+	if srcBackup.HasBinaryFormat && srcBackup.Backend != b.driver.Info().Name {
+		return fmt.Errorf("Optimized backups made on a %s pool can't be restored on a %s pool", srcBackup.Backend, b.driver.Info().Name)
+	}
+
+	// Create slice to record DB volumes created if revert needed later.
+	revertDBVolumes := []string{}
+	defer func() {
+		// Remove any DB volume rows created if we are reverting.
+		for _, volName := range revertDBVolumes {
+			b.state.Cluster.StoragePoolVolumeDelete("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
+		}
+	}()
+
+	config := map[string]string{}
+	for k, v := range srcBackup.Volume.Config {
+		config[k] = v
+	}
+
+	// Check the config of the backup and remove any fields not relevant for the pool type.
+	vol := b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, srcBackup.Name, config)
+	err := b.driver.ValidateVolume(vol, true)
+	if err != nil {
+		return err
+	}
+
+	// Create database entries for the new storage volume and its snapshots.
+	err = VolumeDBCreate(b.state, b.name, srcBackup.Name, srcBackup.Volume.Description, db.StoragePoolVolumeTypeNameCustom, false, config, drivers.ContentTypeFS)
+	if err != nil {
+		return err
+	}
+
+	revertDBVolumes = append(revertDBVolumes, srcBackup.Name)
+
+	for _, snapName := range srcBackup.Snapshots {
+		newSnapshotName := drivers.GetSnapshotVolumeName(srcBackup.Name, snapName)
+
+		err = VolumeDBCreate(b.state, b.name, newSnapshotName, srcBackup.Volume.Description, db.StoragePoolVolumeTypeNameCustom, true, config, drivers.ContentTypeFS)
+		if err != nil {
+			return err
+		}
+
+		revertDBVolumes = append(revertDBVolumes, newSnapshotName)
+	}
+
+	err = b.driver.CreateVolumeFromBackup(vol, srcBackup.Snapshots, srcData, srcBackup.HasBinaryFormat, op)
+	if err != nil {
+		return err
+	}
+
+	revertDBVolumes = nil
+	return nil
+}
+
+// customVolumeContentType returns the content type of a custom volume, as recorded in the database.
+func (b *lxdBackend) customVolumeContentType(volName string) (drivers.ContentType, error) {
+	_, vol, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return "", drivers.Errorf(drivers.ErrNotFound, "Volume doesn't exist")
+		}
+
+		return "", err
+	}
+
+	return VolumeContentTypeNameToContentType(vol.ContentType)
+}
+
 // CreateCustomVolumeSnapshot creates a snapshot of a custom volume.
 func (b *lxdBackend) CreateCustomVolumeSnapshot(volName string, newSnapshotName string, op *operations.Operation) error {
 	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "newSnapshotName": newSnapshotName})
@@ -1393,14 +2408,19 @@ func (b *lxdBackend) CreateCustomVolumeSnapshot(volName string, newSnapshotName
 	_, parentVol, err := b.state.Cluster.StoragePoolNodeVolumeGetTypeByProject("default", volName, db.StoragePoolVolumeTypeCustom, b.ID())
 	if err != nil {
 		if err == db.ErrNoSuchObject {
-			return fmt.Errorf("Parent volume doesn't exist")
+			return drivers.Errorf(drivers.ErrNotFound, "Parent volume doesn't exist")
 		}
 
 		return err
 	}
 
+	contentType, err := VolumeContentTypeNameToContentType(parentVol.ContentType)
+	if err != nil {
+		return err
+	}
+
 	// Create database entry for new storage volume snapshot.
-	err = VolumeDBCreate(b.state, b.name, fullSnapshotName, parentVol.Description, db.StoragePoolVolumeTypeNameCustom, true, parentVol.Config)
+	err = VolumeDBCreate(b.state, b.name, fullSnapshotName, parentVol.Description, db.StoragePoolVolumeTypeNameCustom, true, parentVol.Config, contentType)
 	if err != nil {
 		return err
 	}
@@ -1480,8 +2500,9 @@ func (b *lxdBackend) DeleteCustomVolumeSnapshot(volName string, op *operations.O
 	return nil
 }
 
-// RestoreCustomVolume restores a custom volume from a snapshot.
-func (b *lxdBackend) RestoreCustomVolume(volName string, snapshotName string, op *operations.Operation) error {
+// RestoreCustomVolume restores a custom volume from a snapshot. With force, drivers which can't
+// restore otherwise destroy the snapshots taken after it, and their records are removed.
+func (b *lxdBackend) RestoreCustomVolume(volName string, snapshotName string, force bool, op *operations.Operation) error {
 	logger := logging.AddContext(b.logger, log.Ctx{"volName": volName, "snapshotName": snapshotName})
 	logger.Debug("RestoreCustomVolume started")
 	defer logger.Debug("RestoreCustomVolume finished")
@@ -1500,14 +2521,47 @@ func (b *lxdBackend) RestoreCustomVolume(volName string, snapshotName string, op
 	}
 
 	if len(usingVolume) != 0 {
-		return fmt.Errorf("Cannot restore custom volume used by running instances")
+		return drivers.Errorf(drivers.ErrInUse, "Cannot restore custom volume used by running instances")
+	}
+
+	contentType, err := b.customVolumeContentType(volName)
+	if err != nil {
+		return err
+	}
+
+	err = b.driver.RestoreVolume(b.newVolume(drivers.VolumeTypeCustom, contentType, volName, nil), snapshotName, force, op)
+	if err != nil {
+		return err
 	}
 
-	err = b.driver.RestoreVolume(b.newVolume(drivers.VolumeTypeCustom, drivers.ContentTypeFS, volName, nil), snapshotName, op)
+	if !force {
+		return nil
+	}
+
+	// Remove the records of the snapshots the driver destroyed.
+	snapshots, err := b.driver.VolumeSnapshots(drivers.VolumeTypeCustom, volName, op)
+	if err != nil {
+		return err
+	}
+
+	dbSnapshots, err := b.state.Cluster.StoragePoolVolumeSnapshotsGetType(volName, db.StoragePoolVolumeTypeCustom, b.ID())
 	if err != nil {
 		return err
 	}
 
+	for _, dbSnapshot := range dbSnapshots {
+		_, snapName, _ := shared.ContainerGetParentAndSnapshotName(dbSnapshot.Name)
+		if shared.StringInSlice(snapName, snapshots) {
+			continue
+		}
+
+		logger.Debug("Removing record of destroyed snapshot", log.Ctx{"snapshot": dbSnapshot.Name})
+		err = b.state.Cluster.StoragePoolVolumeDelete("default", dbSnapshot.Name, db.StoragePoolVolumeTypeCustom, b.ID())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
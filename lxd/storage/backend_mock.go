@@ -3,11 +3,13 @@ package storage
 import (
 	"io"
 
+	"github.com/lxc/lxd/lxd/backup"
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
 	"github.com/lxc/lxd/shared/logger"
 )
 
@@ -62,8 +64,8 @@ func (b *mockBackend) CreateInstance(i Instance, op *operations.Operation) error
 	return nil
 }
 
-func (b *mockBackend) CreateInstanceFromBackup(i Instance, sourcePath string, op *operations.Operation) error {
-	return nil
+func (b *mockBackend) CreateInstanceFromBackup(srcBackup backup.Info, srcData io.ReadSeeker, op *operations.Operation) (func(), error) {
+	return nil, nil
 }
 
 func (b *mockBackend) CreateInstanceFromCopy(i Instance, src Instance, snapshots bool, op *operations.Operation) error {
@@ -74,7 +76,7 @@ func (b *mockBackend) CreateInstanceFromImage(i Instance, fingerprint string, op
 	return nil
 }
 
-func (b *mockBackend) CreateInstanceFromMigration(i Instance, conn io.ReadWriteCloser, args migration.SinkArgs, op *operations.Operation) error {
+func (b *mockBackend) CreateInstanceFromMigration(i Instance, conn io.ReadWriteCloser, args migration.VolumeTargetArgs, op *operations.Operation) error {
 	return nil
 }
 
@@ -86,15 +88,15 @@ func (b *mockBackend) DeleteInstance(i Instance, op *operations.Operation) error
 	return nil
 }
 
-func (b *mockBackend) MigrateInstance(i Instance, snapshots bool, args migration.SourceArgs) (migration.StorageSourceDriver, error) {
-	return nil, nil
+func (b *mockBackend) MigrateInstance(i Instance, conn io.ReadWriteCloser, args migration.VolumeSourceArgs, op *operations.Operation) error {
+	return nil
 }
 
 func (b *mockBackend) RefreshInstance(i Instance, src Instance, snapshots bool, op *operations.Operation) error {
 	return nil
 }
 
-func (b *mockBackend) BackupInstance(i Instance, targetPath string, optimized bool, snapshots bool, op *operations.Operation) error {
+func (b *mockBackend) BackupInstance(i Instance, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error {
 	return nil
 }
 
@@ -102,6 +104,10 @@ func (b *mockBackend) GetInstanceUsage(i Instance) (int64, error) {
 	return 0, nil
 }
 
+func (b *mockBackend) GetInstanceDirectoryUsage(i Instance) (map[string]int64, error) {
+	return nil, nil
+}
+
 func (b *mockBackend) SetInstanceQuota(i Instance, size string, op *operations.Operation) error {
 	return nil
 }
@@ -114,6 +120,14 @@ func (b *mockBackend) UnmountInstance(i Instance, op *operations.Operation) (boo
 	return true, nil
 }
 
+func (b *mockBackend) CompactInstance(i Instance, op *operations.Operation) error {
+	return nil
+}
+
+func (b *mockBackend) CheckInstance(i Instance, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	return nil, nil
+}
+
 func (b *mockBackend) GetInstanceDisk(i Instance) (string, string, error) {
 	return "", "", nil
 }
@@ -130,7 +144,7 @@ func (b *mockBackend) DeleteInstanceSnapshot(i Instance, op *operations.Operatio
 	return nil
 }
 
-func (b *mockBackend) RestoreInstanceSnapshot(i Instance, op *operations.Operation) error {
+func (b *mockBackend) RestoreInstanceSnapshot(inst Instance, src Instance, op *operations.Operation) error {
 	return nil
 }
 
@@ -150,7 +164,23 @@ func (b *mockBackend) DeleteImage(fingerprint string, op *operations.Operation)
 	return nil
 }
 
-func (b *mockBackend) CreateCustomVolume(volName, desc string, config map[string]string, op *operations.Operation) error {
+func (b *mockBackend) PruneImages(op *operations.Operation) error {
+	return nil
+}
+
+func (b *mockBackend) CustomVolumeWarnings(volName string, config map[string]string, contentType drivers.ContentType) []api.StorageVolumeWarning {
+	return nil
+}
+
+func (b *mockBackend) CreateCustomVolume(volName, desc string, config map[string]string, contentType drivers.ContentType, op *operations.Operation) error {
+	return nil
+}
+
+func (b *mockBackend) CreateCustomVolumeFromTarball(volName, desc string, config map[string]string, tarballPath string, op *operations.Operation) error {
+	return nil
+}
+
+func (b *mockBackend) CreateCustomVolumeFromRsync(volName, desc string, config map[string]string, source string, op *operations.Operation) error {
 	return nil
 }
 
@@ -158,6 +188,10 @@ func (b *mockBackend) CreateCustomVolumeFromCopy(volName, desc string, config ma
 	return nil
 }
 
+func (b *mockBackend) RefreshCustomVolume(volName, srcPoolName, srcVolName string, srcVolOnly bool, op *operations.Operation) error {
+	return nil
+}
+
 func (b *mockBackend) RenameCustomVolume(volName string, newName string, op *operations.Operation) error {
 	return nil
 }
@@ -178,10 +212,22 @@ func (b *mockBackend) CreateCustomVolumeFromMigration(conn io.ReadWriteCloser, a
 	return nil
 }
 
+func (b *mockBackend) BackupCustomVolume(volName string, writer io.Writer, optimized bool, volumeOnly bool, op *operations.Operation) error {
+	return nil
+}
+
+func (b *mockBackend) CreateCustomVolumeFromBackup(srcBackup backup.Info, srcData io.ReadSeeker, op *operations.Operation) error {
+	return nil
+}
+
 func (b *mockBackend) GetCustomVolumeUsage(volName string) (int64, error) {
 	return 0, nil
 }
 
+func (b *mockBackend) CheckCustomVolume(volName string, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	return nil, nil
+}
+
 func (b *mockBackend) MountCustomVolume(volName string, op *operations.Operation) (bool, error) {
 	return true, nil
 }
@@ -190,6 +236,18 @@ func (b *mockBackend) UnmountCustomVolume(volName string, op *operations.Operati
 	return true, nil
 }
 
+func (b *mockBackend) GetCustomVolumeDisk(volName string) (string, string, error) {
+	return "", "", nil
+}
+
+func (b *mockBackend) MountCustomVolumeShare(volName string, op *operations.Operation) (string, error) {
+	return "", nil
+}
+
+func (b *mockBackend) ExportCustomVolumeDisk(volName string, targetPath string, op *operations.Operation) error {
+	return nil
+}
+
 func (b *mockBackend) CreateCustomVolumeSnapshot(volName string, newSnapshotName string, op *operations.Operation) error {
 	return nil
 }
@@ -202,6 +260,6 @@ func (b *mockBackend) DeleteCustomVolumeSnapshot(volName string, op *operations.
 	return nil
 }
 
-func (b *mockBackend) RestoreCustomVolume(volName string, snapshotName string, op *operations.Operation) error {
+func (b *mockBackend) RestoreCustomVolume(volName string, snapshotName string, force bool, op *operations.Operation) error {
 	return nil
 }
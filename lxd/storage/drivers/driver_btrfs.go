@@ -0,0 +1,378 @@
+package drivers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/units"
+)
+
+var btrfsVersion string
+var btrfsLoaded bool
+
+// btrfsDefaultMountOptions are the mount options used when btrfs.mount_options isn't set.
+const btrfsDefaultMountOptions = "user_subvol_rm_allowed"
+
+type btrfs struct {
+	common
+}
+
+// init sets up the driver, then loads it. The load() call in common.init() doesn't reach the
+// load() function of the Btrfs driver.
+func (d *btrfs) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error {
+	err := d.common.init(state, name, config, logger, volIDFunc, commonRulesFunc)
+	if err != nil {
+		return err
+	}
+
+	return d.load()
+}
+
+func (d *btrfs) load() error {
+	if btrfsLoaded {
+		return nil
+	}
+
+	// Validate the required binaries.
+	_, err := exec.LookPath("btrfs")
+	if err != nil {
+		return fmt.Errorf("Required tool 'btrfs' is missing")
+	}
+
+	// Detect and record the version.
+	if btrfsVersion == "" {
+		version, err := d.version()
+		if err != nil {
+			return err
+		}
+
+		btrfsVersion = version
+	}
+
+	btrfsLoaded = true
+	return nil
+}
+
+// version returns the version of the btrfs tools.
+func (d *btrfs) version() (string, error) {
+	out, err := shared.RunCommand("btrfs", "version")
+	if err != nil {
+		return "", fmt.Errorf("The 'btrfs' tool isn't working properly")
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "v") {
+		return "", fmt.Errorf("Could not determine btrfs version")
+	}
+
+	return strings.TrimPrefix(fields[1], "v"), nil
+}
+
+// Info returns info about the driver and its environment.
+func (d *btrfs) Info() Info {
+	return Info{
+		Name:               "btrfs",
+		Version:            btrfsVersion,
+		OptimizedImages:    true,
+		PreservesInodes:    false,
+		Remote:             false,
+		VolumeTypes:        []VolumeType{VolumeTypeCustom, VolumeTypeImage, VolumeTypeContainer, VolumeTypeVM},
+		BlockBacking:       false,
+		RunningQuotaResize: true,
+		InstantClones:      true,
+		RunningCopyFreeze:  false,
+		OptimizedBackups:   true,
+	}
+}
+
+// MigrationTypes returns the type of transfer methods to be used when doing migrations between
+// pools in preference order. Btrfs send streams are preferred for filesystem volumes, falling back
+// to rsync. The subvolumes nested in the volumes are sent along when both sides support it.
+func (d *btrfs) MigrationTypes(contentType ContentType) []migration.Type {
+	if contentType != ContentTypeFS {
+		return d.common.MigrationTypes(contentType)
+	}
+
+	types := []migration.Type{
+		{
+			FSType:   migration.MigrationFSType_BTRFS,
+			Features: []string{"subvolumes"},
+		},
+	}
+
+	return append(types, d.common.MigrationTypes(contentType)...)
+}
+
+// Create creates the Btrfs filesystem (on a loop file or a block device), or the subvolume used by
+// the storage pool.
+func (d *btrfs) Create() error {
+	// WARNING: The Create() function cannot rely on any of the struct attributes being set.
+
+	// Store the provided source as we are likely to be mangling it.
+	d.config["volatile.initial_source"] = d.config["source"]
+
+	poolPath := GetPoolMountPath(d.name)
+	loopPath := filepath.Join(shared.VarPath("disks"), fmt.Sprintf("%s.img", d.name))
+	if d.config["source"] == "" || d.config["source"] == loopPath {
+		// Create a loop based pool.
+		d.config["source"] = loopPath
+
+		size, err := units.ParseByteSizeString(d.config["size"])
+		if err != nil {
+			return err
+		}
+
+		err = createSparseFile(loopPath, size)
+		if err != nil {
+			return err
+		}
+
+		_, err = shared.RunCommand("mkfs.btrfs", "-L", d.name, loopPath)
+		if err != nil {
+			os.Remove(loopPath)
+			return fmt.Errorf("Failed to create the Btrfs pool: %v", err)
+		}
+
+		return nil
+	}
+
+	// Unset size property since it doesn't make sense.
+	d.config["size"] = ""
+
+	source := filepath.Clean(d.config["source"])
+	if !filepath.IsAbs(source) {
+		return fmt.Errorf("Invalid \"source\" property")
+	}
+
+	if shared.IsBlockdevPath(source) {
+		_, err := shared.RunCommand("mkfs.btrfs", "-f", "-L", d.name, source)
+		if err != nil {
+			return fmt.Errorf("Failed to create the Btrfs pool: %v", err)
+		}
+
+		// The path of the block device may change, so record the UUID of the filesystem.
+		uuid, err := d.lookupFsUUID(source)
+		if err != nil {
+			return err
+		}
+
+		d.config["source"] = uuid
+		return nil
+	}
+
+	if d.isSubvolume(source) {
+		// Use an existing subvolume, provided it's empty.
+		subvols, err := d.getSubvolumes(source)
+		if err != nil {
+			return err
+		}
+
+		if len(subvols) > 0 {
+			return fmt.Errorf("Requested Btrfs subvolume exists but is not empty")
+		}
+
+		return nil
+	}
+
+	// Create the subvolume, only allowing it in the LXD directory at the pool's mount path.
+	if strings.HasPrefix(source, shared.VarPath()) && source != poolPath {
+		return fmt.Errorf("Btrfs subvolumes within the LXD directory are only allowed at \"%s\"", poolPath)
+	}
+
+	parentPath := source
+	if !shared.PathExists(source) {
+		parentPath = filepath.Dir(source)
+	}
+
+	fsType, err := util.FilesystemDetect(parentPath)
+	if err != nil {
+		return err
+	}
+
+	if fsType != "btrfs" {
+		return fmt.Errorf("Path \"%s\" doesn't reside on a Btrfs filesystem", source)
+	}
+
+	if shared.PathExists(source) {
+		// An existing empty directory (such as the pool's mount path) is replaced by the subvolume.
+		isEmpty, err := shared.PathIsEmpty(source)
+		if err != nil {
+			return err
+		}
+
+		if !isEmpty {
+			return fmt.Errorf("Source path '%s' isn't empty", source)
+		}
+
+		err = os.Remove(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.createSubvolume(source)
+	if err != nil {
+		return err
+	}
+
+	d.config["source"] = source
+	return nil
+}
+
+// Delete removes the storage pool from the storage device.
+func (d *btrfs) Delete(op *operations.Operation) error {
+	poolPath := GetPoolMountPath(d.name)
+
+	// Delete the subvolumes of the volumes, then everything else in the directory.
+	subvols, err := d.getSubvolumes(poolPath)
+	if err != nil {
+		return err
+	}
+
+	for i := len(subvols) - 1; i >= 0; i-- {
+		err := d.deleteSubvolume(filepath.Join(poolPath, subvols[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = wipeDirectory(poolPath)
+	if err != nil {
+		return err
+	}
+
+	// Unmount the path.
+	_, err = d.Unmount()
+	if err != nil {
+		return err
+	}
+
+	// Delete the loop file if any.
+	loopPath := filepath.Join(shared.VarPath("disks"), fmt.Sprintf("%s.img", d.name))
+	if d.config["source"] == loopPath {
+		err := os.Remove(loopPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	// Delete the subvolume used by the pool, leaving an empty directory at the pool's mount path.
+	source := d.config["source"]
+	if filepath.IsAbs(source) && !shared.IsBlockdevPath(source) && d.isSubvolume(source) {
+		err := d.deleteSubvolume(source)
+		if err != nil {
+			return err
+		}
+
+		if source == poolPath {
+			err := os.Mkdir(poolPath, 0711)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Mount mounts the storage pool.
+func (d *btrfs) Mount() (bool, error) {
+	path := GetPoolMountPath(d.name)
+	source := d.config["source"]
+
+	// Check if we're dealing with a subvolume at the pool's mount path.
+	if source == path {
+		return false, nil
+	}
+
+	// Check if already mounted.
+	if shared.IsMountPoint(path) {
+		return false, nil
+	}
+
+	mountOptions := btrfsDefaultMountOptions
+	if d.config["btrfs.mount_options"] != "" {
+		mountOptions = d.config["btrfs.mount_options"]
+	}
+
+	mountFlags, mountData := resolveMountOptions(mountOptions)
+
+	loopPath := filepath.Join(shared.VarPath("disks"), fmt.Sprintf("%s.img", d.name))
+	if source == loopPath {
+		// Attach the loop file and mount it. The loop device gets detached once unmounted.
+		loopDev, err := shared.RunCommand("losetup", "--find", "--show", loopPath)
+		if err != nil {
+			return false, fmt.Errorf("Failed to set up loop device for \"%s\": %v", loopPath, err)
+		}
+
+		loopDev = strings.TrimSpace(loopDev)
+		defer shared.RunCommand("losetup", "-d", loopDev)
+
+		err = tryMount(loopDev, path, "btrfs", mountFlags, mountData)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	if filepath.IsAbs(source) && !shared.IsBlockdevPath(source) {
+		// Bind-mount the subvolume.
+		err := tryMount(source, path, "none", unix.MS_BIND, "")
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	mountSource := source
+	if !filepath.IsAbs(source) {
+		// The source is the UUID of the filesystem. Without a matching device, it is the UUID of
+		// a subvolume which the user is expected to have mounted.
+		mountSource = filepath.Join("/dev/disk/by-uuid", source)
+		if !shared.PathExists(mountSource) {
+			return false, nil
+		}
+	}
+
+	err := tryMount(mountSource, path, "btrfs", mountFlags, mountData)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Unmount unmounts the storage pool.
+func (d *btrfs) Unmount() (bool, error) {
+	path := GetPoolMountPath(d.name)
+
+	// Check if we're dealing with a subvolume at the pool's mount path.
+	if d.config["source"] == path {
+		return false, nil
+	}
+
+	// Unmount until nothing is left mounted.
+	return forceUnmount(path)
+}
+
+// GetResources returns the pool resource usage information.
+func (d *btrfs) GetResources() (*api.ResourcesStoragePool, error) {
+	// Use the generic VFS resources.
+	return vfsResources(GetPoolMountPath(d.name))
+}
@@ -0,0 +1,49 @@
+package drivers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lxc/lxd/lxd/migration"
+)
+
+// Test that Btrfs volumes only accept the keys common to all drivers.
+func TestBtrfsValidateVolume(t *testing.T) {
+	d := &btrfs{common{name: "default", config: map[string]string{}, getCommonRules: testCommonRules}}
+
+	config := map[string]string{"size": "10GB", "user.foo": "bar"}
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+
+	config = map[string]string{"block.filesystem": "ext4"}
+	assert.Error(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), true))
+	assert.Empty(t, config)
+}
+
+// Test that the disk images of block volumes are stored in their subvolume.
+func TestBtrfsGetVolumeDiskPath(t *testing.T) {
+	d := &btrfs{common{name: "default", config: map[string]string{}}}
+
+	path, format, err := d.GetVolumeDiskPath(VolumeTypeVM, "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(GetVolumeMountPath("default", VolumeTypeVM, "v1"), "root.img"), path)
+	assert.Equal(t, "qcow2", format)
+}
+
+// Test that Btrfs send streams, along with nested subvolumes, are preferred for filesystem volumes
+// only.
+func TestBtrfsMigrationTypes(t *testing.T) {
+	d := &btrfs{common{name: "default", config: map[string]string{}}}
+
+	types := d.MigrationTypes(ContentTypeFS)
+	assert.Len(t, types, 2)
+	assert.Equal(t, migration.MigrationFSType_BTRFS, types[0].FSType)
+	assert.Equal(t, []string{"subvolumes"}, types[0].Features)
+	assert.Equal(t, migration.MigrationFSType_RSYNC, types[1].FSType)
+
+	types = d.MigrationTypes(ContentTypeBlock)
+	assert.Len(t, types, 1)
+	assert.Equal(t, migration.MigrationFSType_RSYNC, types[0].FSType)
+}
@@ -0,0 +1,621 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/ioprogress"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/units"
+)
+
+// Errors returned when looking up the qgroup of a subvolume.
+var errBtrfsNoQuota = fmt.Errorf("Quotas disabled on filesystem")
+var errBtrfsNoQGroup = fmt.Errorf("Unable to find quota group")
+
+// isSubvolume returns whether the given path is the root of a Btrfs subvolume.
+func (d *btrfs) isSubvolume(path string) bool {
+	fs := unix.Stat_t{}
+	err := unix.Lstat(path, &fs)
+	if err != nil {
+		return false
+	}
+
+	// Check for BTRFS_FIRST_FREE_OBJECTID.
+	return fs.Ino == 256
+}
+
+// getSubvolumes returns the subvolumes nested in the given path, relative to it and sorted so that
+// parents come before their children.
+func (d *btrfs) getSubvolumes(path string) ([]string, error) {
+	result := []string{}
+
+	path = shared.AddSlash(path)
+
+	err := filepath.Walk(path, func(fpath string, fi os.FileInfo, err error) error {
+		// Skip walk errors, unprivileged users can't get to the filesystem internals.
+		if err != nil {
+			return nil
+		}
+
+		// Ignore the base path and anything which isn't a directory.
+		if strings.TrimRight(fpath, "/") == strings.TrimRight(path, "/") || !fi.IsDir() {
+			return nil
+		}
+
+		if d.isSubvolume(fpath) {
+			result = append(result, strings.TrimPrefix(fpath, path))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// createSubvolume creates a subvolume at the given path, creating its parent directories if
+// needed.
+func (d *btrfs) createSubvolume(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0711)
+	if err != nil {
+		return err
+	}
+
+	_, err = shared.RunCommand("btrfs", "subvolume", "create", path)
+	if err != nil {
+		return fmt.Errorf("Failed to create Btrfs subvolume \"%s\": %v", path, err)
+	}
+
+	return nil
+}
+
+// deleteSubvolume deletes the subvolume at the given path, along with its qgroup.
+func (d *btrfs) deleteSubvolume(path string) error {
+	// Attempt (but don't fail) to delete the qgroup of the subvolume.
+	qgroup, _, err := d.getQGroup(path)
+	if err == nil {
+		shared.RunCommand("btrfs", "qgroup", "destroy", qgroup, path)
+	}
+
+	// Read-only subvolumes can't be deleted by unprivileged users.
+	shared.RunCommand("btrfs", "property", "set", path, "ro", "false")
+
+	_, err = shared.RunCommand("btrfs", "subvolume", "delete", path)
+	if err != nil {
+		return fmt.Errorf("Failed to delete Btrfs subvolume \"%s\": %v", path, err)
+	}
+
+	return nil
+}
+
+// deleteSubvolumes deletes the subvolume at the given path along with the subvolumes nested in it.
+func (d *btrfs) deleteSubvolumes(path string) error {
+	subvols, err := d.getSubvolumes(path)
+	if err != nil {
+		return err
+	}
+
+	// Delete the children before their parents.
+	for i := len(subvols) - 1; i >= 0; i-- {
+		err := d.deleteSubvolume(filepath.Join(path, subvols[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.deleteSubvolume(path)
+}
+
+// snapshotSubvolume snapshots the subvolume at srcPath to dstPath. Snapshots of nested subvolumes
+// are taken too when recursive is set, in which case the snapshots can't be read-only.
+func (d *btrfs) snapshotSubvolume(srcPath string, dstPath string, readonly bool, recursive bool) error {
+	snapshot := func(srcPath string, dstPath string) error {
+		args := []string{"subvolume", "snapshot"}
+		if readonly && (d.state == nil || !d.state.OS.RunningInUserNS) {
+			args = append(args, "-r")
+		}
+
+		_, err := shared.RunCommand("btrfs", append(args, srcPath, dstPath)...)
+		if err != nil {
+			return fmt.Errorf("Failed to snapshot Btrfs subvolume \"%s\": %v", srcPath, err)
+		}
+
+		return nil
+	}
+
+	subvols := []string{}
+	if recursive {
+		var err error
+		subvols, err = d.getSubvolumes(srcPath)
+		if err != nil {
+			return err
+		}
+
+		if len(subvols) > 0 && readonly {
+			d.logger.Warn("Subvolumes detected, ignoring ro flag", log.Ctx{"path": srcPath})
+			readonly = false
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(dstPath), 0711)
+	if err != nil {
+		return err
+	}
+
+	err = snapshot(srcPath, dstPath)
+	if err != nil {
+		return err
+	}
+
+	for _, subvol := range subvols {
+		// Clear the empty directory left in place of the nested subvolume.
+		os.Remove(filepath.Join(dstPath, subvol))
+
+		err := snapshot(filepath.Join(srcPath, subvol), filepath.Join(dstPath, subvol))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isSubvolumeReadOnly returns whether the subvolume at the given path is read-only.
+func (d *btrfs) isSubvolumeReadOnly(path string) bool {
+	out, err := shared.RunCommand("btrfs", "property", "get", "-ts", path)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(out, "ro=true")
+}
+
+// setSubvolumeReadOnly sets whether the subvolume at the given path is read-only.
+func (d *btrfs) setSubvolumeReadOnly(path string, readonly bool) error {
+	_, err := shared.RunCommand("btrfs", "property", "set", "-ts", path, "ro", strconv.FormatBool(readonly))
+	return err
+}
+
+// receiveSubvolume receives the send stream held in the source file as a new subvolume of the
+// target directory, named after the subvolume the stream was sent from.
+func (d *btrfs) receiveSubvolume(source string, targetDir string) error {
+	_, err := shared.RunCommand("btrfs", "receive", "-e", "-f", source, targetDir)
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to receive Btrfs subvolume into \"%s\": %v", targetDir, err))
+	}
+
+	return nil
+}
+
+// sendSubvolumeStream sends the read-only subvolume at the given path over the connection, as an
+// incremental stream from the parent subvolume if any.
+func (d *btrfs) sendSubvolumeStream(path string, parent string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker) error {
+	args := []string{"send"}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+
+	args = append(args, path)
+
+	cmd := exec.Command("btrfs", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// Setup progress tracker.
+	reader := io.ReadCloser(stdout)
+	if tracker != nil {
+		reader = &ioprogress.ProgressReader{
+			ReadCloser: stdout,
+			Tracker:    tracker,
+		}
+	}
+
+	_, err = io.Copy(conn, reader)
+	conn.Close() // Sends barrier message.
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("Failed to send Btrfs subvolume %q: %s: %v", path, strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// receiveSubvolumeStream receives a send stream from the connection as a new read-only subvolume
+// of the target directory, named after the subvolume the stream was sent from.
+func (d *btrfs) receiveSubvolumeStream(targetDir string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker) error {
+	cmd := exec.Command("btrfs", "receive", "-e", targetDir)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// Setup progress tracker.
+	reader := io.ReadCloser(conn)
+	if tracker != nil {
+		reader = &ioprogress.ProgressReader{
+			ReadCloser: conn,
+			Tracker:    tracker,
+		}
+	}
+
+	_, err = io.Copy(stdin, reader)
+	stdin.Close()
+	waitErr := cmd.Wait()
+
+	if waitErr != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to receive Btrfs subvolume into %q: %s: %v", targetDir, strings.TrimSpace(stderr.String()), waitErr))
+	}
+
+	return err
+}
+
+// sendSubvolumeStreams sends the subvolume at the given path as sendSubvolumeStream does. When
+// nested is set, the list of the subvolumes nested in it is sent first and, if not empty, followed
+// by the stream of a read-only copy of the subvolume and then by one stream per nested subvolume.
+func (d *btrfs) sendSubvolumeStreams(path string, parent string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, nested bool) error {
+	if !nested {
+		return d.sendSubvolumeStream(path, parent, conn, tracker)
+	}
+
+	subvols, err := d.getSubvolumes(path)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(conn).Encode(subvols)
+	conn.Close() // Sends barrier message.
+	if err != nil {
+		return err
+	}
+
+	// Incremental sends need a read-only parent, which subvolumes holding nested ones aren't.
+	if parent != "" && !d.isSubvolumeReadOnly(parent) {
+		parent = ""
+	}
+
+	if len(subvols) == 0 {
+		return d.sendSubvolumeStream(path, parent, conn, tracker)
+	}
+
+	tmpDir, err := ioutil.TempDir(GetPoolMountPath(d.name), ".migration-subvolumes")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A subvolume holding nested ones can't be read-only, so read-only copies of each of them are
+	// sent instead. The copy of the subvolume itself keeps its name as the receiver relies on it.
+	rootPath := filepath.Join(tmpDir, filepath.Base(path))
+	err = d.snapshotSubvolume(path, rootPath, true, false)
+	if err != nil {
+		return err
+	}
+	defer d.deleteSubvolume(rootPath)
+
+	// The parent won't match the copy, so it's sent in full.
+	err = d.sendSubvolumeStream(rootPath, "", conn, tracker)
+	if err != nil {
+		return err
+	}
+
+	for i, subvol := range subvols {
+		subvolPath := filepath.Join(tmpDir, strconv.Itoa(i))
+		err = d.snapshotSubvolume(filepath.Join(path, subvol), subvolPath, true, false)
+		if err != nil {
+			return err
+		}
+		defer d.deleteSubvolume(subvolPath)
+
+		err = d.sendSubvolumeStream(subvolPath, "", conn, tracker)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// receiveSubvolumeStreams receives the streams sent by sendSubvolumeStreams as a new subvolume of
+// the target directory, named after the subvolume the streams were sent from. The subvolume is
+// read-only unless it holds nested subvolumes, which are put back in place.
+func (d *btrfs) receiveSubvolumeStreams(targetDir string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, nested bool) error {
+	if !nested {
+		return d.receiveSubvolumeStream(targetDir, conn, tracker)
+	}
+
+	buf, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return err
+	}
+
+	subvols := []string{}
+	err = json.Unmarshal(buf, &subvols)
+	if err != nil {
+		return fmt.Errorf("Failed to parse the nested subvolumes: %v", err)
+	}
+
+	for _, subvol := range subvols {
+		if filepath.IsAbs(subvol) || strings.HasPrefix(filepath.Clean(subvol), "..") {
+			return fmt.Errorf("Invalid nested subvolume path %q", subvol)
+		}
+	}
+
+	if len(subvols) == 0 {
+		return d.receiveSubvolumeStream(targetDir, conn, tracker)
+	}
+
+	tmpDir, err := ioutil.TempDir(GetPoolMountPath(d.name), ".migration-subvolumes")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	recvDir := filepath.Join(tmpDir, ".received")
+	err = os.Mkdir(recvDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	err = d.receiveSubvolumeStream(recvDir, conn, tracker)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(recvDir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) != 1 {
+		return fmt.Errorf("Expected a single subvolume to be received, got %d", len(entries))
+	}
+
+	name := entries[0].Name()
+	recvPath := filepath.Join(recvDir, name)
+	defer d.deleteSubvolume(recvPath)
+
+	// Received subvolumes are read-only, so nested subvolumes are put in place in a writable
+	// snapshot of the received one.
+	path := filepath.Join(tmpDir, name)
+	err = d.snapshotSubvolume(recvPath, path, false, false)
+	if err != nil {
+		return err
+	}
+
+	revert := true
+	defer func() {
+		if revert {
+			d.deleteSubvolumes(path)
+		}
+	}()
+
+	// The parents are sent before their children, so each nested subvolume lands in a writable
+	// one.
+	for i, subvol := range subvols {
+		subvolDir := filepath.Join(tmpDir, fmt.Sprintf(".subvolume-%d", i))
+		err := os.Mkdir(subvolDir, 0700)
+		if err != nil {
+			return err
+		}
+
+		err = d.receiveSubvolumeStream(subvolDir, conn, tracker)
+		if err != nil {
+			return err
+		}
+
+		recvSubvolPath := filepath.Join(subvolDir, strconv.Itoa(i))
+		defer d.deleteSubvolume(recvSubvolPath)
+
+		// Replace the empty directory left in place of the nested subvolume.
+		subvolPath := filepath.Join(path, subvol)
+		err = os.Remove(subvolPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		err = d.snapshotSubvolume(recvSubvolPath, subvolPath, false, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(path, filepath.Join(targetDir, name))
+	if err != nil {
+		return err
+	}
+
+	revert = false
+	return nil
+}
+
+// getQGroup returns the qgroup of the subvolume at the given path, along with its usage in bytes.
+func (d *btrfs) getQGroup(path string) (string, int64, error) {
+	out, err := shared.RunCommand("btrfs", "qgroup", "show", "-e", "-f", path)
+	if err != nil {
+		return "", -1, errBtrfsNoQuota
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" || strings.HasPrefix(line, "qgroupid") || strings.HasPrefix(line, "---") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+
+		usage, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			usage = -1
+		}
+
+		return fields[0], usage, nil
+	}
+
+	return "", -1, errBtrfsNoQGroup
+}
+
+// createQGroup creates the qgroup of the subvolume at the given path.
+func (d *btrfs) createQGroup(path string) error {
+	out, err := shared.RunCommand("btrfs", "subvolume", "show", path)
+	if err != nil {
+		return fmt.Errorf("Failed to get subvolume information: %v", err)
+	}
+
+	id := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Subvolume ID:") {
+			id = strings.TrimSpace(strings.TrimPrefix(line, "Subvolume ID:"))
+		}
+	}
+
+	if id == "" {
+		return fmt.Errorf("Failed to find subvolume id")
+	}
+
+	_, err = shared.RunCommand("btrfs", "qgroup", "create", fmt.Sprintf("0/%s", id), path)
+	if err != nil {
+		return fmt.Errorf("Failed to create missing qgroup: %v", err)
+	}
+
+	return nil
+}
+
+// setQuota limits the size of the subvolume at the given path through its qgroup, enabling quotas
+// on the pool if needed. An empty or zero size falls back to the pool's volume.size and removes
+// the limit when that's unset too.
+func (d *btrfs) setQuota(path string, size string) error {
+	if size == "" || size == "0" {
+		size = d.config["volume.size"]
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	// Quotas can't be managed from within a user namespace.
+	if d.state != nil && d.state.OS.RunningInUserNS {
+		return nil
+	}
+
+	_, _, err = d.getQGroup(path)
+	if sizeBytes <= 0 {
+		// Nothing to remove when the subvolume has no qgroup.
+		if err != nil {
+			return nil
+		}
+
+		_, err = shared.RunCommand("btrfs", "qgroup", "limit", "none", path)
+		if err != nil {
+			return fmt.Errorf("Failed to remove Btrfs quota: %v", err)
+		}
+
+		return nil
+	}
+
+	if err == errBtrfsNoQuota {
+		_, err = shared.RunCommand("btrfs", "quota", "enable", GetPoolMountPath(d.name))
+		if err != nil {
+			return fmt.Errorf("Failed to enable quotas on Btrfs pool: %v", err)
+		}
+
+		_, _, err = d.getQGroup(path)
+	}
+
+	if err == errBtrfsNoQGroup {
+		err = d.createQGroup(path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, usedBytes, err := d.getQGroup(path)
+	if err != nil {
+		return err
+	}
+
+	err = checkQuotaAboveUsage(sizeBytes, usedBytes)
+	if err != nil {
+		return err
+	}
+
+	_, err = shared.RunCommand("btrfs", "qgroup", "limit", "-e", fmt.Sprintf("%d", sizeBytes), path)
+	if err != nil {
+		return fmt.Errorf("Failed to set Btrfs quota: %v", err)
+	}
+
+	return nil
+}
+
+// lookupFsUUID returns the UUID of the Btrfs filesystem on the given block device.
+func (d *btrfs) lookupFsUUID(devPath string) (string, error) {
+	uuid, err := shared.LookupUUIDByBlockDevPath(devPath)
+	if err == nil && uuid != "" {
+		return uuid, nil
+	}
+
+	// The symlink in /dev/disk/by-uuid may not have been created yet, ask btrfs instead.
+	out, err := shared.RunCommand("btrfs", "filesystem", "show", "--raw", devPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to detect UUID of \"%s\": %v", devPath, err)
+	}
+
+	idx := strings.Index(out, "uuid: ")
+	if idx < 0 {
+		return "", fmt.Errorf("Failed to detect UUID of \"%s\"", devPath)
+	}
+
+	fields := strings.Fields(out[idx+len("uuid: "):])
+	if len(fields) == 0 {
+		return "", fmt.Errorf("Failed to detect UUID of \"%s\"", devPath)
+	}
+
+	return fields[0], nil
+}
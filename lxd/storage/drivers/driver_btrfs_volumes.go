@@ -0,0 +1,1102 @@
+package drivers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
+	"github.com/lxc/lxd/shared/ioprogress"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/units"
+)
+
+// ValidateVolume validates the supplied volume config.
+func (d *btrfs) ValidateVolume(vol Volume, removeUnknownKeys bool) error {
+	return d.validateVolume(vol, nil, removeUnknownKeys)
+}
+
+// HasVolume indicates whether a specific volume exists on the storage pool.
+func (d *btrfs) HasVolume(volType VolumeType, volName string) bool {
+	return shared.PathExists(GetVolumeMountPath(d.name, volType, volName))
+}
+
+// GetVolumeDiskPath returns the location and file format of a disk volume.
+func (d *btrfs) GetVolumeDiskPath(volType VolumeType, volName string) (string, string, error) {
+	return filepath.Join(GetVolumeMountPath(d.name, volType, volName), "root.img"), "qcow2", nil
+}
+
+// CreateVolume creates an empty volume and can optionally fill it by executing the supplied
+// filler function.
+func (d *btrfs) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath string) error, op *operations.Operation) error {
+	volPath := vol.MountPath()
+
+	err := d.createSubvolume(volPath)
+	if err != nil {
+		return err
+	}
+
+	revert := true
+	defer func() {
+		if revert {
+			d.deleteSubvolumes(volPath)
+		}
+	}()
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	// Extract specified size from pool or volume config.
+	size := d.config["volume.size"]
+	if vol.config["size"] != "" {
+		size = vol.config["size"]
+	}
+
+	rootBlockPath := ""
+	if vol.contentType == ContentTypeBlock {
+		// We expect the filler to copy the VM image into this path.
+		rootBlockPath, _, err = d.GetVolumeDiskPath(vol.volType, vol.name)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = d.setQuota(volPath, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Run the volume filler function if supplied.
+	if filler != nil {
+		err = filler(volPath, rootBlockPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we are creating a block volume, resize it to the requested size or 10GB.
+	if vol.contentType == ContentTypeBlock {
+		blockSize := size
+		if blockSize == "" {
+			blockSize = "10GB"
+		}
+
+		blockSizeBytes, err := units.ParseByteSizeString(blockSize)
+		if err != nil {
+			return err
+		}
+
+		if shared.PathExists(rootBlockPath) {
+			_, err = shared.RunCommand("qemu-img", "resize", rootBlockPath, fmt.Sprintf("%d", blockSizeBytes))
+			if err != nil {
+				return fmt.Errorf("Failed resizing disk image %s to size %s: %v", rootBlockPath, blockSize, err)
+			}
+		} else {
+			// Without a filler to create the disk image, create an empty one (used for PXE
+			// booting a VM).
+			_, err = shared.RunCommand("qemu-img", "create", "-f", "qcow2", rootBlockPath, fmt.Sprintf("%d", blockSizeBytes))
+			if err != nil {
+				return fmt.Errorf("Failed creating disk image %s as size %s: %v", rootBlockPath, blockSize, err)
+			}
+		}
+	}
+
+	// Images are only ever snapshotted, so protect them against accidental modifications.
+	if vol.volType == VolumeTypeImage && (d.state == nil || !d.state.OS.RunningInUserNS) {
+		err = d.setSubvolumeReadOnly(volPath, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	revert = false
+	return nil
+}
+
+// MigrateVolume sends a volume for migration.
+func (d *btrfs) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volSrcArgs.MigrationType.FSType == migration.MigrationFSType_BTRFS && vol.contentType == ContentTypeFS {
+		return d.migrateVolumeOptimized(vol, conn, volSrcArgs, op)
+	}
+
+	if volSrcArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	for _, snapName := range volSrcArgs.Snapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		// Send snapshot to recipient (ensure local snapshot volume is mounted if needed).
+		err = snapshot.MountTask(func(mountPath string, op *operations.Operation) error {
+			var wrapper *ioprogress.ProgressTracker
+			if volSrcArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapshot.name)
+			}
+
+			return d.sendVolume(snapshot, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, nil)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send volume to recipient (ensure local volume is mounted if needed).
+	return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.sendVolume(vol, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, volSrcArgs.Freeze)
+	}, op)
+}
+
+// CreateVolumeFromMigration creates a volume being sent via a migration.
+func (d *btrfs) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volTargetArgs.MigrationType.FSType == migration.MigrationFSType_BTRFS && vol.contentType == ContentTypeFS {
+		return d.createVolumeFromMigrationOptimized(vol, conn, volTargetArgs, op)
+	}
+
+	if volTargetArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	// Create the main volume subvolume.
+	volPath := vol.MountPath()
+	err := d.createSubvolume(volPath)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		// Remove any subvolumes created if we are reverting.
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		d.deleteSubvolumes(volPath)
+	}()
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	// Block volumes don't use qgroup quotas as their disk image has a fixed size.
+	if vol.contentType == ContentTypeFS {
+		// Set the quota if specified in volConfig or pool config.
+		err = d.setQuota(volPath, vol.config["size"])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ensure the volume is mounted.
+	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		// Snapshots are sent first by the sender, so create these first.
+		for _, snapName := range volTargetArgs.Snapshots {
+			// Receive the snapshot
+			var wrapper *ioprogress.ProgressTracker
+			if volTargetArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+			}
+
+			err = d.recvVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
+			if err != nil {
+				return err
+			}
+
+			// Create the snapshot itself.
+			err = d.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+			if err != nil {
+				return err
+			}
+
+			// Setup the revert.
+			revertSnaps = append(revertSnaps, snapName)
+		}
+
+		// Receive the main volume from sender.
+		var wrapper *ioprogress.ProgressTracker
+		if volTargetArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.recvVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// migrateVolumeOptimized sends a filesystem volume and its snapshots as Btrfs send streams, each
+// snapshot incremental from the previous one, followed by the current state of the volume.
+func (d *btrfs) migrateVolumeOptimized(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
+	volPath := vol.MountPath()
+
+	// Send streams don't include nested subvolumes, which are sent on their own when the target
+	// supports it.
+	nested := shared.StringInSlice("subvolumes", volSrcArgs.MigrationType.Features)
+
+	// Send a snapshot on its own.
+	if vol.IsSnapshot() {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.sendSubvolumeStreams(volPath, "", conn, wrapper, nested)
+	}
+
+	if !nested {
+		subvols, err := d.getSubvolumes(volPath)
+		if err != nil {
+			return err
+		}
+
+		if len(subvols) > 0 {
+			return Errorf(ErrNotSupported, "Optimized transfer of volumes holding subvolumes not supported by the target")
+		}
+	}
+
+	parent := ""
+	for _, snapName := range volSrcArgs.Snapshots {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+		}
+
+		snapPath := GetVolumeMountPath(d.name, vol.volType, GetSnapshotVolumeName(vol.name, snapName))
+		err := d.sendSubvolumeStreams(snapPath, parent, conn, wrapper, nested)
+		if err != nil {
+			return err
+		}
+
+		parent = snapPath
+	}
+
+	// Send the current state of the volume from a temporary snapshot, read-only unless it holds
+	// nested subvolumes.
+	snapDir, err := ioutil.TempDir(GetPoolMountPath(d.name), ".migration")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(snapDir)
+
+	sendPath := filepath.Join(snapDir, "volume")
+	err = d.snapshotSubvolume(volPath, sendPath, true, nested)
+	if err != nil {
+		return err
+	}
+	defer d.deleteSubvolumes(sendPath)
+
+	var wrapper *ioprogress.ProgressTracker
+	if volSrcArgs.TrackProgress {
+		wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+	}
+
+	return d.sendSubvolumeStreams(sendPath, parent, conn, wrapper, nested)
+}
+
+// createVolumeFromMigrationOptimized creates a filesystem volume and its snapshots from the Btrfs
+// send streams sent by migrateVolumeOptimized.
+func (d *btrfs) createVolumeFromMigrationOptimized(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
+	volPath := vol.MountPath()
+	nested := shared.StringInSlice("subvolumes", volTargetArgs.MigrationType.Features)
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		if shared.PathExists(volPath) {
+			d.deleteSubvolumes(volPath)
+		}
+	}()
+
+	// The snapshots are received under the names they were sent from, which are their own.
+	snapDir, err := GetVolumeSnapshotDir(d.name, vol.volType, vol.name)
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range volTargetArgs.Snapshots {
+		err := os.MkdirAll(snapDir, 0711)
+		if err != nil {
+			return err
+		}
+
+		var wrapper *ioprogress.ProgressTracker
+		if volTargetArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+		}
+
+		err = d.receiveSubvolumeStreams(snapDir, conn, wrapper, nested)
+		if err != nil {
+			return err
+		}
+
+		revertSnaps = append(revertSnaps, snapName)
+	}
+
+	// Receive the volume itself into a temporary directory of the pool, as a read-only subvolume
+	// of which a writable snapshot is then taken.
+	recvDir, err := ioutil.TempDir(GetPoolMountPath(d.name), ".migration")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(recvDir)
+
+	var wrapper *ioprogress.ProgressTracker
+	if volTargetArgs.TrackProgress {
+		wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+	}
+
+	err = d.receiveSubvolumeStreams(recvDir, conn, wrapper, nested)
+	if err != nil {
+		return err
+	}
+
+	// The received subvolume is named after the one it was sent from, which may be a snapshot.
+	entries, err := ioutil.ReadDir(recvDir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) != 1 {
+		return fmt.Errorf("Expected a single subvolume to be received, got %d", len(entries))
+	}
+
+	recvPath := filepath.Join(recvDir, entries[0].Name())
+	defer d.deleteSubvolumes(recvPath)
+
+	err = d.snapshotSubvolume(recvPath, volPath, false, true)
+	if err != nil {
+		return err
+	}
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	err = d.setQuota(volPath, vol.config["size"])
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// BackupVolume writes a backup of a volume and of the given snapshots to the tarball. Optimized
+// backups hold the Btrfs send streams of the snapshots, each incremental from the previous one,
+// followed by the stream of the current state of the volume.
+func (d *btrfs) BackupVolume(vol Volume, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error {
+	if !optimized {
+		return genericBackupVolume(vol, tarWriter, snapshots, op)
+	}
+
+	if vol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be backed up")
+	}
+
+	volPath := vol.MountPath()
+
+	// Send streams don't include nested subvolumes, so such volumes are backed up in the generic
+	// format, which restoring detects.
+	subvols, err := d.getSubvolumes(volPath)
+	if err != nil {
+		return err
+	}
+
+	if len(subvols) > 0 {
+		d.logger.Warn("Volume holds subvolumes, using generic backup format", log.Ctx{"path": volPath})
+		return genericBackupVolume(vol, tarWriter, snapshots, op)
+	}
+
+	// The streams are staged on disk as the tarball needs their size ahead of their content.
+	tmpDir, err := ioutil.TempDir(shared.VarPath("backups"), "lxd_backup_btrfs_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sendToTarball := func(path string, parent string, name string, description string) error {
+		tmpPath := filepath.Join(tmpDir, filepath.Base(name))
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+
+		// The file is closed once the stream is sent.
+		err = d.sendSubvolumeStream(path, parent, f, backupProgress(op, description))
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Lstat(tmpPath)
+		if err != nil {
+			return err
+		}
+
+		err = tarWriter.WriteFileAs(name, tmpPath, fi)
+		if err != nil {
+			return err
+		}
+
+		return os.Remove(tmpPath)
+	}
+
+	parent := ""
+	for _, snapName := range snapshots {
+		snapPath := GetVolumeMountPath(d.name, vol.volType, GetSnapshotVolumeName(vol.name, snapName))
+
+		err := sendToTarball(snapPath, parent, fmt.Sprintf("backup/snapshots/%s.bin", snapName), snapName)
+		if err != nil {
+			return err
+		}
+
+		parent = snapPath
+	}
+
+	// Send the current state of the volume from a temporary read-only snapshot, which must be
+	// named "volume" as restoring relies on it.
+	snapDir, err := ioutil.TempDir(GetPoolMountPath(d.name), ".backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(snapDir)
+
+	backupPath := filepath.Join(snapDir, "volume")
+	err = d.snapshotSubvolume(volPath, backupPath, true, false)
+	if err != nil {
+		return err
+	}
+	defer d.deleteSubvolume(backupPath)
+
+	return sendToTarball(backupPath, parent, fmt.Sprintf("backup/%s.bin", backupVolumeName(vol)), vol.name)
+}
+
+// CreateVolumeFromBackup creates a volume and the given snapshots from a backup written by
+// BackupVolume.
+func (d *btrfs) CreateVolumeFromBackup(vol Volume, snapshots []string, srcData io.ReadSeeker, optimized bool, op *operations.Operation) error {
+	if !optimized {
+		return genericCreateVolumeFromBackup(vol, snapshots, srcData, op)
+	}
+
+	if vol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be restored from a backup")
+	}
+
+	tmpDir, err := ioutil.TempDir(shared.VarPath("backups"), "lxd_restore_btrfs_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = unpackBackup(srcData, "backup", 1, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	volPath := vol.MountPath()
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		if shared.PathExists(volPath) {
+			d.deleteSubvolumes(volPath)
+		}
+	}()
+
+	// The snapshots are received under the names they were sent from, which are their own.
+	snapDir, err := GetVolumeSnapshotDir(d.name, vol.volType, vol.name)
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range snapshots {
+		err := os.MkdirAll(snapDir, 0711)
+		if err != nil {
+			return err
+		}
+
+		err = d.receiveSubvolume(filepath.Join(tmpDir, "snapshots", fmt.Sprintf("%s.bin", snapName)), snapDir)
+		if err != nil {
+			return err
+		}
+
+		revertSnaps = append(revertSnaps, snapName)
+	}
+
+	// Receive the volume itself into a temporary directory of the pool, as a read-only subvolume
+	// of which a writable snapshot is then taken.
+	recvDir, err := ioutil.TempDir(GetPoolMountPath(d.name), ".backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(recvDir)
+
+	err = d.receiveSubvolume(filepath.Join(tmpDir, fmt.Sprintf("%s.bin", backupVolumeName(vol))), recvDir)
+	if err != nil {
+		return err
+	}
+
+	recvPath := filepath.Join(recvDir, "volume")
+	defer d.deleteSubvolume(recvPath)
+
+	err = d.snapshotSubvolume(recvPath, volPath, false, false)
+	if err != nil {
+		return err
+	}
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	err = d.setQuota(volPath, vol.config["size"])
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// CreateVolumeFromCopy provides same-pool volume copying functionality, using writable snapshots
+// of the source subvolumes.
+func (d *btrfs) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
+	if vol.contentType != srcVol.contentType || (vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock) {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	volPath := vol.MountPath()
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	revertVol := false
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		// Remove any subvolumes created if we are reverting.
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		if revertVol {
+			d.deleteSubvolumes(volPath)
+		}
+	}()
+
+	// If copying snapshots is indicated, check the source isn't itself a snapshot.
+	if copySnapshots && !srcVol.IsSnapshot() {
+		// Get the list of snapshots from the source.
+		srcSnapshots, err := srcVol.Snapshots(op)
+		if err != nil {
+			return err
+		}
+
+		for _, srcSnapshot := range srcSnapshots {
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName(srcSnapshot.name)
+			snapPath := GetVolumeMountPath(d.name, vol.volType, GetSnapshotVolumeName(vol.name, snapName))
+
+			err = d.snapshotSubvolume(srcSnapshot.MountPath(), snapPath, true, true)
+			if err != nil {
+				return err
+			}
+
+			// Setup the revert.
+			revertSnaps = append(revertSnaps, snapName)
+		}
+	}
+
+	// Snapshot the source, which leaves the destination writable.
+	err := d.snapshotSubvolume(srcVol.MountPath(), volPath, false, true)
+	if err != nil {
+		return err
+	}
+
+	revertVol = true
+
+	// Apply the mode of the mount path for the type of the new volume.
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	// Block volumes don't use qgroup quotas as their disk image has a fixed size.
+	if vol.contentType == ContentTypeFS {
+		// Set the quota if specified in volConfig or pool config.
+		err = d.setQuota(volPath, vol.config["size"])
+		if err != nil {
+			return err
+		}
+	}
+
+	revertSnaps = nil // Don't revert.
+	return nil
+}
+
+// RefreshVolume brings an existing volume up to date with another volume. Within the pool, the
+// missing snapshots are snapshotted from the ones of the source, before the content of the volume
+// itself is synced. The disk image of block volumes is synced with its holes skipped.
+func (d *btrfs) RefreshVolume(vol Volume, srcVol Volume, srcSnapshots []string, op *operations.Operation) error {
+	if vol.pool != srcVol.pool || vol.contentType != srcVol.contentType {
+		return d.common.RefreshVolume(vol, srcVol, srcSnapshots, op)
+	}
+
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+	}()
+
+	for _, snapName := range srcSnapshots {
+		srcSnapshot, err := srcVol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		err = d.snapshotSubvolume(srcSnapshot.MountPath(), snapshot.MountPath(), true, true)
+		if err != nil {
+			return err
+		}
+
+		revertSnaps = append(revertSnaps, snapName)
+	}
+
+	_, err := d.copyVolume(srcVol.MountPath(), vol.MountPath(), vol.contentType, copyProgress(op, srcVol.name))
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// VolumeSnapshots returns a list of snapshots for the volume.
+func (d *btrfs) VolumeSnapshots(volType VolumeType, volName string, op *operations.Operation) ([]string, error) {
+	snapshotDir, err := GetVolumeSnapshotDir(d.name, volType, volName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []string{}
+
+	ents, err := ioutil.ReadDir(snapshotDir)
+	if err != nil {
+		// If the snapshots directory doesn't exist, there are no snapshots.
+		if os.IsNotExist(err) {
+			return snapshots, nil
+		}
+
+		return nil, err
+	}
+
+	for _, ent := range ents {
+		if !ent.IsDir() {
+			continue
+		}
+
+		snapshots = append(snapshots, ent.Name())
+	}
+
+	return snapshots, nil
+}
+
+// UpdateVolume applies config changes to the volume.
+func (d *btrfs) UpdateVolume(vol Volume, changedConfig map[string]string) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if _, changed := changedConfig["size"]; changed {
+		// Set the quota if specified in volConfig or pool config.
+		err := d.SetVolumeQuota(vol.volType, vol.name, changedConfig["size"], nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetVolumeUsage returns the disk space used by the volume, as accounted by its qgroup.
+func (d *btrfs) GetVolumeUsage(vol Volume) (int64, error) {
+	_, usage, err := d.getQGroup(vol.MountPath())
+	if err != nil {
+		if err == errBtrfsNoQuota {
+			return -1, Errorf(ErrNotSupported, "BTRFS quotas not supported. Try enabling them with \"btrfs quota enable\"")
+		}
+
+		return -1, err
+	}
+
+	if usage < 0 {
+		return -1, fmt.Errorf("Unable to find current qgroup usage")
+	}
+
+	return usage, nil
+}
+
+// SetVolumeQuota sets the quota on the volume, growing the disk image of block volumes first.
+func (d *btrfs) SetVolumeQuota(volType VolumeType, volName, size string, op *operations.Operation) error {
+	blockVol := NewVolume(d, d.name, volType, ContentTypeBlock, volName, nil)
+	diskPath, _, err := blockVol.GetDiskPath()
+	if err == nil && shared.PathExists(diskPath) {
+		err = d.growBlockFile(blockVol, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.setQuota(GetVolumeMountPath(d.name, volType, volName), size)
+}
+
+// RenameVolume renames a volume and its snapshots.
+func (d *btrfs) RenameVolume(volType VolumeType, volName string, newVolName string, op *operations.Operation) error {
+	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
+
+	// Create new snapshots directory.
+	snapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newVolName)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(snapshotDir, 0711)
+	if err != nil {
+		return err
+	}
+
+	type volRevert struct {
+		oldPath string
+		newPath string
+	}
+
+	// Create slice to record paths renamed if revert needed later.
+	revertPaths := []volRevert{}
+	defer func() {
+		// Remove any paths rename if we are reverting.
+		for _, vol := range revertPaths {
+			os.Rename(vol.newPath, vol.oldPath)
+		}
+
+		// Remove the new snapshot directory if we are reverting.
+		if len(revertPaths) > 0 {
+			os.Remove(snapshotDir)
+		}
+	}()
+
+	// Rename any snapshots of the volume too.
+	snapshots, err := vol.Snapshots(op)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		oldPath := snapshot.MountPath()
+		_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snapshot.name)
+		newPath := GetVolumeMountPath(d.name, vol.volType, GetSnapshotVolumeName(newVolName, snapName))
+
+		err := os.Rename(oldPath, newPath)
+		if err != nil {
+			return err
+		}
+
+		revertPaths = append(revertPaths, volRevert{
+			oldPath: oldPath,
+			newPath: newPath,
+		})
+	}
+
+	oldPath := GetVolumeMountPath(d.name, volType, volName)
+	newPath := GetVolumeMountPath(d.name, volType, newVolName)
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	revertPaths = append(revertPaths, volRevert{
+		oldPath: oldPath,
+		newPath: newPath,
+	})
+
+	// Remove old snapshots directory, which only holds empty directories at this point.
+	oldSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(oldSnapshotDir)
+	if err != nil {
+		return err
+	}
+
+	revertPaths = nil
+	return nil
+}
+
+// RestoreVolume restores a volume from a snapshot, replacing its subvolume with a writable
+// snapshot of the snapshot.
+func (d *btrfs) RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error {
+	srcPath := GetVolumeMountPath(d.name, vol.volType, GetSnapshotVolumeName(vol.name, snapshotName))
+	if !shared.PathExists(srcPath) {
+		return Errorf(ErrNotFound, "Snapshot not found")
+	}
+
+	volPath := vol.MountPath()
+
+	// Prepare the restored subvolume next to the volume, on the same filesystem.
+	tmpDir, err := ioutil.TempDir(filepath.Dir(volPath), "restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	restoredPath := filepath.Join(tmpDir, "restored")
+	backupPath := filepath.Join(tmpDir, "backup")
+
+	err = d.snapshotSubvolume(srcPath, restoredPath, false, true)
+	if err != nil {
+		return err
+	}
+
+	// Swap the subvolumes.
+	err = os.Rename(volPath, backupPath)
+	if err != nil {
+		d.deleteSubvolumes(restoredPath)
+		return err
+	}
+
+	err = os.Rename(restoredPath, volPath)
+	if err != nil {
+		os.Rename(backupPath, volPath)
+		d.deleteSubvolumes(restoredPath)
+		return err
+	}
+
+	// Delete the subvolume of the volume as it was before the restore.
+	err = d.deleteSubvolumes(backupPath)
+	if err != nil {
+		return err
+	}
+
+	// The quota applies to the qgroup of the replaced subvolume, so set it again.
+	if vol.contentType == ContentTypeFS {
+		err = d.setQuota(volPath, vol.config["size"])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteVolume deletes a volume of the storage device. If any snapshots of the volume remain then
+// this function will return an error.
+func (d *btrfs) DeleteVolume(volType VolumeType, volName string, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) > 0 {
+		return Errorf(ErrInUse, "Cannot remove a volume that has snapshots")
+	}
+
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	// If the volume doesn't exist, then nothing more to do.
+	if !shared.PathExists(volPath) {
+		return nil
+	}
+
+	// Remove the volume from the storage device.
+	err = d.deleteSubvolumes(volPath)
+	if err != nil {
+		return err
+	}
+
+	// Although the volume snapshot directory should already be removed, lets remove it here
+	// to just in case the top-level directory is left.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MountVolume simulates mounting a volume. As the subvolumes are always reachable through the
+// pool's mount path it returns false indicating that there is no need to issue an unmount.
+func (d *btrfs) MountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	return false, nil
+}
+
+// MountVolumeSnapshot sets up a read-only mount on top of the snapshot to avoid accidental
+// modifications, unless the snapshot subvolume is read-only already.
+func (d *btrfs) MountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+	if d.isSubvolumeReadOnly(snapPath) {
+		return false, nil
+	}
+
+	return mountReadOnly(snapPath, snapPath)
+}
+
+// UnmountVolume simulates unmounting a volume. As the subvolumes are always reachable through the
+// pool's mount path it returns false indicating the volume was already unmounted.
+func (d *btrfs) UnmountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	return false, nil
+}
+
+// UnmountVolumeSnapshot removes the read-only mount placed on top of a snapshot.
+func (d *btrfs) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+	return forceUnmount(snapPath)
+}
+
+// CheckVolume reads all the files of the subvolume of a volume, which makes btrfs verify the
+// checksums of their data, and reports the files it failed to read.
+func (d *btrfs) CheckVolume(vol Volume, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	result := &api.StorageVolumeCheck{
+		Tool:   "read",
+		Clean:  true,
+		Errors: []string{},
+	}
+
+	err := filepath.Walk(vol.MountPath(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		defer f.Close()
+
+		_, err = io.Copy(ioutil.Discard, f)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path, err))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Errors) > 0 {
+		result.Clean = false
+		result.Output = strings.Join(result.Errors, "\n")
+	}
+
+	return result, nil
+}
+
+// CreateVolumeSnapshot creates a read-only snapshot of a volume.
+func (d *btrfs) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapshotName string, op *operations.Operation) error {
+	srcPath := GetVolumeMountPath(d.name, volType, volName)
+	snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, newSnapshotName))
+
+	return d.snapshotSubvolume(srcPath, snapPath, true, true)
+}
+
+// DeleteVolumeSnapshot removes a snapshot from the storage device. The volName and snapshotName
+// must be bare names and should not be in the format "volume/snapshot".
+func (d *btrfs) DeleteVolumeSnapshot(volType VolumeType, volName string, snapshotName string, op *operations.Operation) error {
+	snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+
+	// Remove the snapshot from the storage device.
+	if shared.PathExists(snapPath) {
+		err := d.deleteSubvolumes(snapPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the parent snapshot directory if this is the last snapshot being removed.
+	err := deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameVolumeSnapshot renames a volume snapshot.
+func (d *btrfs) RenameVolumeSnapshot(volType VolumeType, volName string, snapshotName string, newSnapshotName string, op *operations.Operation) error {
+	oldPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+	newPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, newSnapshotName))
+	err := os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+var cephVersion string
+var cephLoaded bool
+
+// cephDefaultVolumeSize is the size of volumes when none is configured.
+const cephDefaultVolumeSize = "10GB"
+
+// cephBlockVolSuffix is appended to the name of the RBD image holding the filesystem of a block
+// volume to get the name of the RBD image holding its disk image.
+const cephBlockVolSuffix = ".block"
+
+// cephBlockFSSize is the size of the filesystem holding the files of a block volume next to its
+// disk image.
+const cephBlockFSSize = "100MB"
+
+// cephImageSnapshotName is the name of the protected snapshot of image volumes, which instances
+// created from the image are cloned from.
+const cephImageSnapshotName = "readonly"
+
+type ceph struct {
+	common
+}
+
+// init sets up the driver, then loads it. The load() call in common.init() doesn't reach the
+// load() function of the Ceph driver.
+func (d *ceph) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error {
+	err := d.common.init(state, name, config, logger, volIDFunc, commonRulesFunc)
+	if err != nil {
+		return err
+	}
+
+	return d.load()
+}
+
+func (d *ceph) load() error {
+	if cephLoaded {
+		return nil
+	}
+
+	// Validate the required binaries.
+	for _, tool := range []string{"ceph", "rbd"} {
+		_, err := exec.LookPath(tool)
+		if err != nil {
+			return fmt.Errorf("Required tool '%s' is missing", tool)
+		}
+	}
+
+	// Detect and record the version.
+	if cephVersion == "" {
+		out, err := shared.RunCommand("rbd", "--version")
+		if err != nil {
+			return err
+		}
+
+		cephVersion = strings.TrimSpace(out)
+	}
+
+	cephLoaded = true
+	return nil
+}
+
+// Info returns info about the driver and its environment. The volumes live in the Ceph cluster,
+// so all the nodes of a LXD cluster share them.
+func (d *ceph) Info() Info {
+	return Info{
+		Name:               "ceph",
+		Version:            cephVersion,
+		OptimizedImages:    true,
+		PreservesInodes:    false,
+		Remote:             true,
+		VolumeTypes:        []VolumeType{VolumeTypeCustom, VolumeTypeImage, VolumeTypeContainer, VolumeTypeVM},
+		BlockBacking:       true,
+		RunningQuotaResize: false,
+		InstantClones:      true,
+		RunningCopyFreeze:  true,
+		OptimizedBackups:   false,
+	}
+}
+
+// Create creates the OSD pool, unless an existing one is used. A placeholder RBD image marks the
+// pool as used by LXD, so that other LXD instances don't use it too by mistake.
+func (d *ceph) Create() error {
+	// WARNING: The Create() function cannot rely on any of the struct attributes being set.
+
+	// Store the provided source as we are likely to be mangling it.
+	d.config["volatile.initial_source"] = d.config["source"]
+
+	if d.config["source"] != "" && d.config["ceph.osd.pool_name"] != "" && d.config["source"] != d.config["ceph.osd.pool_name"] {
+		return fmt.Errorf("The \"source\" and \"ceph.osd.pool_name\" property must not differ for Ceph OSD storage pools")
+	}
+
+	if d.config["source"] == "" {
+		d.config["source"] = d.config["ceph.osd.pool_name"]
+	}
+
+	if d.config["source"] == "" {
+		d.config["source"] = d.name
+	}
+
+	d.config["ceph.osd.pool_name"] = d.config["source"]
+
+	if d.config["ceph.cluster_name"] == "" {
+		d.config["ceph.cluster_name"] = "ceph"
+	}
+
+	if d.config["ceph.user.name"] == "" {
+		d.config["ceph.user.name"] = "admin"
+	}
+
+	if d.config["ceph.osd.pg_num"] == "" {
+		d.config["ceph.osd.pg_num"] = "32"
+	}
+
+	if !d.osdPoolExists() {
+		_, err := d.cephCommand("osd", "pool", "create", d.osdPoolName(), d.config["ceph.osd.pg_num"])
+		if err != nil {
+			return fmt.Errorf("Failed to create Ceph OSD pool %q: %v", d.osdPoolName(), err)
+		}
+
+		revertPool := true
+		defer func() {
+			if revertPool {
+				d.osdPoolDestroy()
+			}
+		}()
+
+		err = d.rbdCreateVolume(d.placeholderRBDName(), 0)
+		if err != nil {
+			return err
+		}
+
+		err = d.checkNamespaces()
+		if err != nil {
+			return err
+		}
+
+		d.config["volatile.pool.pristine"] = "true"
+		revertPool = false
+		return nil
+	}
+
+	if d.rbdVolumeExists(d.placeholderRBDName()) && !shared.IsTrue(d.config["ceph.osd.force_reuse"]) {
+		return fmt.Errorf("Ceph OSD pool %q in cluster %q seems to be in use by another LXD instance. Use \"ceph.osd.force_reuse=true\" to force", d.osdPoolName(), d.config["ceph.cluster_name"])
+	}
+
+	err := d.checkNamespaces()
+	if err != nil {
+		return err
+	}
+
+	d.config["volatile.pool.pristine"] = "false"
+
+	// Record the number of placement groups of the existing pool.
+	out, err := d.cephCommand("osd", "pool", "get", d.osdPoolName(), "pg_num")
+	if err != nil {
+		return fmt.Errorf("Failed to get placement groups of Ceph OSD pool %q: %v", d.osdPoolName(), err)
+	}
+
+	fields := strings.SplitN(out, "pg_num:", 2)
+	if len(fields) != 2 {
+		return fmt.Errorf("Unexpected output from ceph command")
+	}
+
+	d.config["ceph.osd.pg_num"] = strings.TrimSpace(fields[1])
+	return nil
+}
+
+// checkNamespaces checks that the Ceph cluster supports RBD namespaces, when enabled on the pool.
+func (d *ceph) checkNamespaces() error {
+	if !shared.IsTrue(d.config["ceph.rbd.namespaces"]) {
+		return nil
+	}
+
+	_, err := d.rbdCommand("namespace", "list")
+	if err != nil {
+		return fmt.Errorf("RBD namespaces aren't supported by Ceph cluster %q: %v", d.clusterName(), err)
+	}
+
+	return nil
+}
+
+// Delete removes the OSD pool, if it was created by LXD. Otherwise only the RBD namespaces of the
+// projects and their cephx users are removed.
+func (d *ceph) Delete(op *operations.Operation) error {
+	if shared.IsTrue(d.config["volatile.pool.pristine"]) && d.osdPoolExists() {
+		err := d.osdPoolDestroy()
+		if err != nil {
+			return err
+		}
+	} else if shared.IsTrue(d.config["ceph.rbd.namespaces"]) && d.osdPoolExists() {
+		err := d.rbdDeleteNamespaces()
+		if err != nil {
+			return err
+		}
+	}
+
+	// On delete, wipe everything in the directory.
+	err := wipeDirectory(GetPoolMountPath(d.name))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Mount does nothing, as OSD pools aren't mounted.
+func (d *ceph) Mount() (bool, error) {
+	return true, nil
+}
+
+// Unmount does nothing, as OSD pools aren't mounted.
+func (d *ceph) Unmount() (bool, error) {
+	return true, nil
+}
+
+// GetResources returns the space used and available in the OSD pool.
+func (d *ceph) GetResources() (*api.ResourcesStoragePool, error) {
+	var stdout bytes.Buffer
+	err := shared.RunCommandWithFds(nil, &stdout, "ceph", "--name", fmt.Sprintf("client.%s", d.config["ceph.user.name"]), "--cluster", d.config["ceph.cluster_name"], "df", "-f", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	// Temporary structs for parsing.
+	type cephDfPoolStats struct {
+		BytesUsed      int64 `json:"bytes_used"`
+		BytesAvailable int64 `json:"max_avail"`
+	}
+
+	type cephDfPool struct {
+		Name  string          `json:"name"`
+		Stats cephDfPoolStats `json:"stats"`
+	}
+
+	type cephDf struct {
+		Pools []cephDfPool `json:"pools"`
+	}
+
+	// Parse the JSON output.
+	df := cephDf{}
+	err = json.Unmarshal(stdout.Bytes(), &df)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pool := range df.Pools {
+		if pool.Name != d.osdPoolName() {
+			continue
+		}
+
+		res := api.ResourcesStoragePool{}
+		res.Space.Total = uint64(pool.Stats.BytesAvailable + pool.Stats.BytesUsed)
+		res.Space.Used = uint64(pool.Stats.BytesUsed)
+
+		return &res, nil
+	}
+
+	return nil, fmt.Errorf("OSD pool missing in df output")
+}
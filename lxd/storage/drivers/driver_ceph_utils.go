@@ -0,0 +1,902 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/units"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// osdPoolName returns the name of the OSD pool used by the pool.
+func (d *ceph) osdPoolName() string {
+	if d.config["ceph.osd.pool_name"] != "" {
+		return d.config["ceph.osd.pool_name"]
+	}
+
+	return d.name
+}
+
+// clusterName returns the name of the Ceph cluster the pool is in.
+func (d *ceph) clusterName() string {
+	if d.config["ceph.cluster_name"] != "" {
+		return d.config["ceph.cluster_name"]
+	}
+
+	return "ceph"
+}
+
+// userName returns the name of the Ceph user the pool is accessed as.
+func (d *ceph) userName() string {
+	if d.config["ceph.user.name"] != "" {
+		return d.config["ceph.user.name"]
+	}
+
+	return "admin"
+}
+
+// cephCommand runs a ceph command against the pool's cluster as the pool's user.
+func (d *ceph) cephCommand(args ...string) (string, error) {
+	return shared.RunCommand("ceph", append([]string{"--name", fmt.Sprintf("client.%s", d.userName()), "--cluster", d.clusterName()}, args...)...)
+}
+
+// rbdCommand runs an rbd command against the pool's OSD pool as the pool's user.
+func (d *ceph) rbdCommand(args ...string) (string, error) {
+	return shared.RunCommand("rbd", append([]string{"--id", d.userName(), "--cluster", d.clusterName(), "--pool", d.osdPoolName()}, args...)...)
+}
+
+// rbdExitStatus returns the exit status of a failed rbd command, or -1 if it didn't run.
+func rbdExitStatus(err error) int {
+	runErr, ok := err.(shared.RunError)
+	if !ok {
+		return -1
+	}
+
+	exitErr, ok := runErr.Err.(*exec.ExitError)
+	if !ok {
+		return -1
+	}
+
+	waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return -1
+	}
+
+	return waitStatus.ExitStatus()
+}
+
+// osdPoolExists returns whether the pool's OSD pool exists.
+func (d *ceph) osdPoolExists() bool {
+	_, err := d.cephCommand("osd", "pool", "get", d.osdPoolName(), "size")
+	return err == nil
+}
+
+// osdPoolDestroy destroys the pool's OSD pool, including any RBD images left in it.
+func (d *ceph) osdPoolDestroy() error {
+	_, err := d.cephCommand("osd", "pool", "delete", d.osdPoolName(), d.osdPoolName(), "--yes-i-really-really-mean-it")
+	if err != nil {
+		return fmt.Errorf("Failed to delete Ceph OSD pool %q: %v", d.osdPoolName(), err)
+	}
+
+	return nil
+}
+
+// placeholderRBDName returns the name of the empty RBD image marking the OSD pool as used by LXD.
+func (d *ceph) placeholderRBDName() string {
+	return fmt.Sprintf("lxd_%s", d.osdPoolName())
+}
+
+// rbdNamespace returns the RBD namespace holding the images of a volume and the name of the volume
+// within it. With "ceph.rbd.namespaces" enabled, the instances of each project other than the
+// default one live in a namespace named after the project. The default namespace is returned as an
+// empty string.
+func (d *ceph) rbdNamespace(volType VolumeType, volName string) (string, string) {
+	if !shared.IsTrue(d.config["ceph.rbd.namespaces"]) || (volType != VolumeTypeContainer && volType != VolumeTypeVM) {
+		return "", volName
+	}
+
+	// Instance names can't contain underscores, the project is what comes before the last one.
+	parentName := strings.SplitN(volName, "/", 2)[0]
+	idx := strings.LastIndex(parentName, "_")
+	if idx < 0 {
+		return "", volName
+	}
+
+	return volName[:idx], volName[idx+1:]
+}
+
+// rbdSplitName returns the RBD namespace and the image of an RBD name as used by the driver,
+// "[<namespace>/]<image>".
+func rbdSplitName(rbdName string) (string, string) {
+	fields := strings.SplitN(rbdName, "/", 2)
+	if len(fields) < 2 {
+		return "", rbdName
+	}
+
+	return fields[0], fields[1]
+}
+
+// rbdJoinName returns the RBD name of an image in an RBD namespace.
+func rbdJoinName(namespace string, image string) string {
+	if namespace == "" {
+		return image
+	}
+
+	return fmt.Sprintf("%s/%s", namespace, image)
+}
+
+// rbdNameFromSpec returns the RBD name of an image (or snapshot) from its full spec, as reported
+// by rbd, "<pool>/[<namespace>/]<image>".
+func rbdNameFromSpec(spec string) string {
+	return spec[strings.Index(spec, "/")+1:]
+}
+
+// rbdSpec returns the full spec of an RBD image (or snapshot), "<pool>/[<namespace>/]<image>".
+func (d *ceph) rbdSpec(rbdName string) string {
+	return fmt.Sprintf("%s/%s", d.osdPoolName(), rbdName)
+}
+
+// cephxUserName returns the name of the cephx user restricted to an RBD namespace of the pool.
+func (d *ceph) cephxUserName(namespace string) string {
+	return fmt.Sprintf("client.lxd-%s-%s", d.osdPoolName(), namespace)
+}
+
+// rbdCreateNamespace creates the RBD namespace of an RBD image about to be created, if it's not in
+// the default one, along with a cephx user only allowed to access the images of the namespace
+// and to read the ones of the pool they are cloned from.
+func (d *ceph) rbdCreateNamespace(rbdName string) error {
+	namespace, _ := rbdSplitName(rbdName)
+	if namespace == "" {
+		return nil
+	}
+
+	_, err := d.rbdCommand("namespace", "create", "--namespace", namespace)
+	if err != nil && rbdExitStatus(err) != 17 {
+		// EEXIST means the namespace already exists.
+		return fmt.Errorf("Failed to create RBD namespace %q: %v", namespace, err)
+	}
+
+	osdCaps := fmt.Sprintf("profile rbd pool=%s namespace=%s, profile rbd-read-only pool=%s", d.osdPoolName(), namespace, d.osdPoolName())
+	if d.config["ceph.osd.data_pool_name"] != "" {
+		osdCaps = fmt.Sprintf("%s, profile rbd pool=%s namespace=%s", osdCaps, d.config["ceph.osd.data_pool_name"], namespace)
+	}
+
+	_, err = d.cephCommand("auth", "get-or-create", d.cephxUserName(namespace), "mon", "profile rbd", "osd", osdCaps)
+	if err != nil {
+		return fmt.Errorf("Failed to create cephx user for RBD namespace %q: %v", namespace, err)
+	}
+
+	return nil
+}
+
+// rbdDeleteNamespaces deletes the RBD namespaces of the pool, which must be empty, along with their
+// cephx users.
+func (d *ceph) rbdDeleteNamespaces() error {
+	out, err := d.rbdCommand("namespace", "list", "--format", "json")
+	if err != nil {
+		return fmt.Errorf("Failed to list RBD namespaces: %v", err)
+	}
+
+	namespaces := []struct {
+		Name string `json:"name"`
+	}{}
+
+	err = json.Unmarshal([]byte(out), &namespaces)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		_, err = d.cephCommand("auth", "del", d.cephxUserName(namespace.Name))
+		if err != nil {
+			return fmt.Errorf("Failed to delete cephx user for RBD namespace %q: %v", namespace.Name, err)
+		}
+
+		_, err = d.rbdCommand("namespace", "remove", "--namespace", namespace.Name)
+		if err != nil {
+			return fmt.Errorf("Failed to delete RBD namespace %q: %v", namespace.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// rbdName returns the name of the RBD image holding the filesystem (or disk image if block is
+// true) of a volume, "[<namespace>/]<type>_<name>" (see rbdNamespace).
+func (d *ceph) rbdName(volType VolumeType, volName string, block bool) string {
+	namespace, volName := d.rbdNamespace(volType, volName)
+
+	prefix := "custom"
+	switch volType {
+	case VolumeTypeContainer:
+		prefix = "container"
+	case VolumeTypeVM:
+		prefix = "virtual-machine"
+	case VolumeTypeImage:
+		prefix = "image"
+	}
+
+	rbdName := fmt.Sprintf("%s_%s", prefix, volName)
+	if block {
+		rbdName = fmt.Sprintf("%s%s", rbdName, cephBlockVolSuffix)
+	}
+
+	return rbdJoinName(namespace, rbdName)
+}
+
+// rbdSnapshotName returns the name of the RBD snapshot of a volume snapshot.
+func (d *ceph) rbdSnapshotName(snapName string) string {
+	return fmt.Sprintf("snapshot_%s", snapName)
+}
+
+// rbdSnapshotCloneName returns the name of the temporary clone of a volume snapshot's RBD
+// snapshot which is mounted in its place.
+func (d *ceph) rbdSnapshotCloneName(volType VolumeType, volName string, snapName string) string {
+	namespace, image := rbdSplitName(d.rbdName(volType, volName, false))
+	return rbdJoinName(namespace, fmt.Sprintf("snapshots_%s_%s_start_clone", image, snapName))
+}
+
+// rbdVolumeNames returns the names of the RBD images of a volume.
+func (d *ceph) rbdVolumeNames(vol Volume) []string {
+	rbdNames := []string{d.rbdName(vol.volType, vol.name, false)}
+	if vol.contentType == ContentTypeBlock {
+		rbdNames = append(rbdNames, d.rbdName(vol.volType, vol.name, true))
+	}
+
+	return rbdNames
+}
+
+// existingRBDNames returns the names of the existing RBD images of a volume, which only has a
+// disk image if it's a block volume.
+func (d *ceph) existingRBDNames(volType VolumeType, volName string) []string {
+	rbdNames := []string{}
+
+	for _, block := range []bool{false, true} {
+		rbdName := d.rbdName(volType, volName, block)
+		if d.rbdVolumeExists(rbdName) {
+			rbdNames = append(rbdNames, rbdName)
+		}
+	}
+
+	return rbdNames
+}
+
+// volumeSize returns the size in bytes of the volume's RBD image holding its filesystem or disk
+// image, from the volume or pool config.
+func (d *ceph) volumeSize(vol Volume, block bool) (int64, error) {
+	size := cephDefaultVolumeSize
+	if vol.contentType == ContentTypeBlock && !block {
+		size = cephBlockFSSize
+	} else if vol.config["size"] != "" && vol.config["size"] != "0" {
+		size = vol.config["size"]
+	} else if d.config["volume.size"] != "" && d.config["volume.size"] != "0" {
+		size = d.config["volume.size"]
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return -1, err
+	}
+
+	return sizeBytes, nil
+}
+
+// volumeFilesystem returns the filesystem to format the volume's RBD image with.
+func (d *ceph) volumeFilesystem(vol Volume) string {
+	if vol.config["block.filesystem"] != "" {
+		return vol.config["block.filesystem"]
+	}
+
+	if d.config["volume.block.filesystem"] != "" {
+		return d.config["volume.block.filesystem"]
+	}
+
+	return "ext4"
+}
+
+// mountOptions returns the options to mount a filesystem of the given type with. Snapshots of
+// XFS filesystems are mounted next to the filesystem itself, so they ignore their duplicate UUID.
+func (d *ceph) mountOptions(fsType string, snapshot bool) string {
+	options := d.config["volume.block.mount_options"]
+	if options == "" {
+		options = "discard"
+		if fsType == "btrfs" {
+			options = "user_subvol_rm_allowed,discard"
+		}
+	}
+
+	if snapshot && fsType == "xfs" {
+		options = fmt.Sprintf("%s,nouuid", options)
+	}
+
+	return options
+}
+
+// rbdCreateVolume creates an RBD image. Its features are limited to layering, which the kernel
+// module supports, so that it can always be mapped.
+func (d *ceph) rbdCreateVolume(rbdName string, sizeBytes int64) error {
+	err := d.rbdCreateNamespace(rbdName)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"--image-feature", "layering"}
+	if d.config["ceph.osd.data_pool_name"] != "" {
+		args = append(args, "--data-pool", d.config["ceph.osd.data_pool_name"])
+	}
+
+	args = append(args, "--size", fmt.Sprintf("%dB", sizeBytes), "create", d.rbdSpec(rbdName))
+
+	_, err = d.rbdCommand(args...)
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to create RBD image %q: %v", rbdName, err))
+	}
+
+	return nil
+}
+
+// rbdVolumeExists returns whether an RBD image exists.
+func (d *ceph) rbdVolumeExists(rbdName string) bool {
+	_, err := d.rbdCommand("image-meta", "list", d.rbdSpec(rbdName))
+	return err == nil
+}
+
+// rbdDeleteVolume deletes an RBD image, which must be unmapped and have no snapshots left.
+func (d *ceph) rbdDeleteVolume(rbdName string) error {
+	_, err := d.rbdCommand("rm", d.rbdSpec(rbdName))
+	if err != nil {
+		return fmt.Errorf("Failed to delete RBD image %q: %v", rbdName, err)
+	}
+
+	return nil
+}
+
+// rbdRenameVolume renames an RBD image, which must be unmapped.
+func (d *ceph) rbdRenameVolume(rbdName string, newRBDName string) error {
+	_, err := d.rbdCommand("mv", d.rbdSpec(rbdName), d.rbdSpec(newRBDName))
+	if err != nil {
+		return fmt.Errorf("Failed to rename RBD image %q to %q: %v", rbdName, newRBDName, err)
+	}
+
+	return nil
+}
+
+// rbdResizeVolume resizes an RBD image.
+func (d *ceph) rbdResizeVolume(rbdName string, sizeBytes int64) error {
+	_, err := d.rbdCommand("resize", "--allow-shrink", "--size", fmt.Sprintf("%dB", sizeBytes), d.rbdSpec(rbdName))
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to resize RBD image %q: %v", rbdName, err))
+	}
+
+	return nil
+}
+
+// rbdVolumeSize returns the size in bytes of an RBD image.
+func (d *ceph) rbdVolumeSize(rbdName string) (int64, error) {
+	out, err := d.rbdCommand("info", "--format", "json", d.rbdSpec(rbdName))
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get size of RBD image %q: %v", rbdName, err)
+	}
+
+	info := struct {
+		Size int64 `json:"size"`
+	}{}
+
+	err = json.Unmarshal([]byte(out), &info)
+	if err != nil {
+		return -1, err
+	}
+
+	return info.Size, nil
+}
+
+// rbdVolumeParent returns the RBD snapshot an RBD image was cloned from, as
+// "[<namespace>/]<image>@<snapshot>", or an empty string if the image isn't a clone.
+func (d *ceph) rbdVolumeParent(rbdName string) (string, error) {
+	out, err := d.rbdCommand("info", d.rbdSpec(rbdName))
+	if err != nil {
+		return "", fmt.Errorf("Failed to get parent of RBD image %q: %v", rbdName, err)
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "parent: ") {
+			continue
+		}
+
+		return rbdNameFromSpec(strings.TrimSpace(strings.TrimPrefix(line, "parent: "))), nil
+	}
+
+	return "", nil
+}
+
+// rbdMapVolume maps an RBD image (or snapshot, given as "<image>@<snapshot>") to a block device
+// and returns its path.
+func (d *ceph) rbdMapVolume(rbdName string) (string, error) {
+	out, err := d.rbdCommand("map", d.rbdSpec(rbdName))
+	if err != nil {
+		return "", fmt.Errorf("Failed to map RBD image %q: %v", rbdName, err)
+	}
+
+	idx := strings.Index(out, "/dev/rbd")
+	if idx < 0 {
+		return "", fmt.Errorf("Failed to detect mapped device path")
+	}
+
+	return strings.TrimSpace(out[idx:]), nil
+}
+
+// rbdUnmapVolume unmaps all the block devices an RBD image (or snapshot) is mapped to. Devices
+// which are still being released are retried for a few seconds.
+func (d *ceph) rbdUnmapVolume(rbdName string) error {
+	busyCount := 0
+
+	for {
+		_, err := d.rbdCommand("unmap", d.rbdSpec(rbdName))
+		if err == nil {
+			continue
+		}
+
+		switch rbdExitStatus(err) {
+		case 22:
+			// EINVAL (no longer mapped).
+			return nil
+		case 16:
+			// EBUSY (currently in use).
+			busyCount++
+			if busyCount < 10 {
+				time.Sleep(time.Second)
+				continue
+			}
+		}
+
+		return fmt.Errorf("Failed to unmap RBD image %q: %v", rbdName, err)
+	}
+}
+
+// rbdDevPath returns the path of the block device an RBD image is mapped to, mapping it first if
+// it isn't mapped yet.
+func (d *ceph) rbdDevPath(rbdName string) (string, error) {
+	files, err := ioutil.ReadDir("/sys/devices/rbd")
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	for _, f := range files {
+		readFile := func(name string) string {
+			content, _ := ioutil.ReadFile(filepath.Join("/sys/devices/rbd", f.Name(), name))
+			return strings.TrimSpace(string(content))
+		}
+
+		namespace, image := rbdSplitName(rbdName)
+		if readFile("pool") != d.osdPoolName() || readFile("pool_ns") != namespace || readFile("name") != image {
+			continue
+		}
+
+		// Skip the mapped snapshots of the image.
+		snap := readFile("snap")
+		if snap != "" && snap != "-" {
+			continue
+		}
+
+		return fmt.Sprintf("/dev/rbd%s", f.Name()), nil
+	}
+
+	return d.rbdMapVolume(rbdName)
+}
+
+// rbdCreateSnapshot creates a snapshot of an RBD image.
+func (d *ceph) rbdCreateSnapshot(rbdName string, snapName string) error {
+	_, err := d.rbdCommand("snap", "create", "--snap", snapName, d.rbdSpec(rbdName))
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to create RBD snapshot %q of %q: %v", snapName, rbdName, err))
+	}
+
+	return nil
+}
+
+// rbdDeleteSnapshot deletes an RBD snapshot, which must be unprotected.
+func (d *ceph) rbdDeleteSnapshot(rbdName string, snapName string) error {
+	_, err := d.rbdCommand("snap", "rm", d.rbdSpec(fmt.Sprintf("%s@%s", rbdName, snapName)))
+	if err != nil {
+		return fmt.Errorf("Failed to delete RBD snapshot %q of %q: %v", snapName, rbdName, err)
+	}
+
+	return nil
+}
+
+// rbdRenameSnapshot renames an RBD snapshot.
+func (d *ceph) rbdRenameSnapshot(rbdName string, snapName string, newSnapName string) error {
+	_, err := d.rbdCommand("snap", "rename", d.rbdSpec(fmt.Sprintf("%s@%s", rbdName, snapName)), d.rbdSpec(fmt.Sprintf("%s@%s", rbdName, newSnapName)))
+	if err != nil {
+		return fmt.Errorf("Failed to rename RBD snapshot %q of %q to %q: %v", snapName, rbdName, newSnapName, err)
+	}
+
+	return nil
+}
+
+// rbdProtectSnapshot protects an RBD snapshot from deletion, which is required to clone it.
+func (d *ceph) rbdProtectSnapshot(rbdName string, snapName string) error {
+	_, err := d.rbdCommand("snap", "protect", "--snap", snapName, d.rbdSpec(rbdName))
+	if err != nil && rbdExitStatus(err) != 16 {
+		// EBUSY means the snapshot is already protected.
+		return fmt.Errorf("Failed to protect RBD snapshot %q of %q: %v", snapName, rbdName, err)
+	}
+
+	return nil
+}
+
+// rbdUnprotectSnapshot unprotects an RBD snapshot, which must have no clones left.
+func (d *ceph) rbdUnprotectSnapshot(rbdName string, snapName string) error {
+	_, err := d.rbdCommand("snap", "unprotect", "--snap", snapName, d.rbdSpec(rbdName))
+	if err != nil && rbdExitStatus(err) != 22 {
+		// EINVAL means the snapshot is already unprotected.
+		return fmt.Errorf("Failed to unprotect RBD snapshot %q of %q: %v", snapName, rbdName, err)
+	}
+
+	return nil
+}
+
+// rbdRollbackSnapshot restores an RBD image to the state of one of its snapshots.
+func (d *ceph) rbdRollbackSnapshot(rbdName string, snapName string) error {
+	_, err := d.rbdCommand("snap", "rollback", "--snap", snapName, d.rbdSpec(rbdName))
+	if err != nil {
+		return fmt.Errorf("Failed to restore RBD image %q from snapshot %q: %v", rbdName, snapName, err)
+	}
+
+	return nil
+}
+
+// rbdListSnapshots returns the names of the snapshots of an RBD image, oldest first.
+func (d *ceph) rbdListSnapshots(rbdName string) ([]string, error) {
+	out, err := d.rbdCommand("--format", "json", "snap", "ls", d.rbdSpec(rbdName))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list RBD snapshots of %q: %v", rbdName, err)
+	}
+
+	snaps := []struct {
+		Name string `json:"name"`
+	}{}
+
+	err = json.Unmarshal([]byte(out), &snaps)
+	if err != nil {
+		return nil, err
+	}
+
+	snapNames := []string{}
+	for _, snap := range snaps {
+		snapNames = append(snapNames, strings.TrimSpace(snap.Name))
+	}
+
+	return snapNames, nil
+}
+
+// rbdListClones returns the names of the RBD images cloned from an RBD snapshot.
+func (d *ceph) rbdListClones(rbdName string, snapName string) ([]string, error) {
+	out, err := d.rbdCommand("children", d.rbdSpec(fmt.Sprintf("%s@%s", rbdName, snapName)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list clones of RBD snapshot %q of %q: %v", snapName, rbdName, err)
+	}
+
+	clones := []string{}
+	for _, spec := range strings.Fields(out) {
+		clones = append(clones, rbdNameFromSpec(spec))
+	}
+
+	return clones, nil
+}
+
+// rbdHasClones returns whether any RBD image was cloned from one of the snapshots of an RBD image.
+func (d *ceph) rbdHasClones(rbdName string) (bool, error) {
+	snapNames, err := d.rbdListSnapshots(rbdName)
+	if err != nil {
+		return false, err
+	}
+
+	for _, snapName := range snapNames {
+		clones, err := d.rbdListClones(rbdName, snapName)
+		if err != nil {
+			return false, err
+		}
+
+		if len(clones) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// rbdFlattenVolume copies into an RBD image the data it shares with the snapshot it was cloned
+// from, so that it doesn't depend on it anymore.
+func (d *ceph) rbdFlattenVolume(rbdName string) error {
+	_, err := d.rbdCommand("flatten", d.rbdSpec(rbdName))
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to flatten RBD image %q: %v", rbdName, err))
+	}
+
+	return nil
+}
+
+// rbdCloneVolume creates an RBD image as a clone of an RBD snapshot, protecting it first.
+func (d *ceph) rbdCloneVolume(srcRBDName string, srcSnapName string, rbdName string) error {
+	err := d.rbdProtectSnapshot(srcRBDName, srcSnapName)
+	if err != nil {
+		return err
+	}
+
+	err = d.rbdCreateNamespace(rbdName)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"--image-feature", "layering"}
+	if d.config["ceph.osd.data_pool_name"] != "" {
+		args = append(args, "--data-pool", d.config["ceph.osd.data_pool_name"])
+	}
+
+	args = append(args, "clone", d.rbdSpec(fmt.Sprintf("%s@%s", srcRBDName, srcSnapName)), d.rbdSpec(rbdName))
+
+	_, err = d.rbdCommand(args...)
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to clone RBD snapshot %q of %q: %v", srcSnapName, srcRBDName, err))
+	}
+
+	return nil
+}
+
+// rbdCopyVolume creates an RBD image as a full copy of another RBD image (or snapshot, given as
+// "<image>@<snapshot>"), without its snapshots.
+func (d *ceph) rbdCopyVolume(srcRBDName string, rbdName string) error {
+	err := d.rbdCreateNamespace(rbdName)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.rbdCommand("cp", d.rbdSpec(srcRBDName), d.rbdSpec(rbdName))
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to copy RBD image %q to %q: %v", srcRBDName, rbdName, err))
+	}
+
+	return nil
+}
+
+// rbdCopyDiff applies the changes between two snapshots of an RBD image (or between the start
+// of the image and a snapshot, if fromSnapName is empty) to another RBD image. The end snapshot
+// is created on the target image too, unless the source is the image itself.
+func (d *ceph) rbdCopyDiff(srcRBDName string, fromSnapName string, rbdName string) error {
+	args := []string{"--id", d.userName(), "--cluster", d.clusterName(), "--pool", d.osdPoolName(), "export-diff", d.rbdSpec(srcRBDName)}
+	if fromSnapName != "" {
+		args = append(args, "--from-snap", fromSnapName)
+	}
+
+	sendCmd := exec.Command("rbd", append(args, "-")...)
+	recvCmd := exec.Command("rbd", "--id", d.userName(), "--cluster", d.clusterName(), "--pool", d.osdPoolName(), "import-diff", "-", d.rbdSpec(rbdName))
+
+	stdout, err := sendCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	recvCmd.Stdin = stdout
+
+	err = recvCmd.Start()
+	if err != nil {
+		return err
+	}
+
+	err = sendCmd.Run()
+	if err != nil {
+		recvCmd.Wait()
+		return fmt.Errorf("Failed to export changes of RBD image %q: %v", srcRBDName, err)
+	}
+
+	err = recvCmd.Wait()
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to import changes into RBD image %q: %v", rbdName, err))
+	}
+
+	return nil
+}
+
+// rbdZombieName returns a new name for an RBD image kept around as a zombie.
+func rbdZombieName(rbdName string) string {
+	namespace, image := rbdSplitName(rbdName)
+	return rbdJoinName(namespace, fmt.Sprintf("zombie_%s_%s", image, uuid.NewRandom().String()))
+}
+
+// isZombie returns whether an RBD image or snapshot was deleted by LXD, but kept around because
+// clones still depend on it.
+func isZombie(name string) bool {
+	_, name = rbdSplitName(name)
+	return strings.HasPrefix(name, "zombie_")
+}
+
+// deleteRBDVolume deletes an RBD image along with its snapshots. Snapshots which still have clones
+// are kept as zombies, in which case the image itself is renamed into a zombie too, to be deleted
+// with its last clone. Zombies the image was cloned from are deleted once unused.
+func (d *ceph) deleteRBDVolume(rbdName string) error {
+	snapNames, err := d.rbdListSnapshots(rbdName)
+	if err != nil {
+		return err
+	}
+
+	zombieSnaps := false
+	for _, snapName := range snapNames {
+		zombie, err := d.deleteRBDSnapshot(rbdName, snapName)
+		if err != nil {
+			return err
+		}
+
+		zombieSnaps = zombieSnaps || zombie
+	}
+
+	err = d.rbdUnmapVolume(rbdName)
+	if err != nil {
+		return err
+	}
+
+	if zombieSnaps {
+		if isZombie(rbdName) {
+			return nil
+		}
+
+		return d.rbdRenameVolume(rbdName, rbdZombieName(rbdName))
+	}
+
+	parent, err := d.rbdVolumeParent(rbdName)
+	if err != nil {
+		return err
+	}
+
+	err = d.rbdDeleteVolume(rbdName)
+	if err != nil {
+		return err
+	}
+
+	if parent == "" {
+		return nil
+	}
+
+	fields := strings.SplitN(parent, "@", 2)
+	if len(fields) != 2 || (!isZombie(fields[0]) && !isZombie(fields[1])) {
+		return nil
+	}
+
+	_, err = d.deleteRBDSnapshot(fields[0], fields[1])
+	return err
+}
+
+// deleteRBDSnapshot deletes an RBD snapshot, or renames it into a zombie if clones still depend on
+// it, returning true in that case. A zombie image is deleted once its last snapshot is.
+func (d *ceph) deleteRBDSnapshot(rbdName string, snapName string) (bool, error) {
+	clones, err := d.rbdListClones(rbdName, snapName)
+	if err != nil {
+		return false, err
+	}
+
+	if len(clones) > 0 {
+		if isZombie(snapName) {
+			return true, nil
+		}
+
+		err = d.rbdRenameSnapshot(rbdName, snapName, fmt.Sprintf("zombie_snapshot_%s", uuid.NewRandom().String()))
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	err = d.rbdUnprotectSnapshot(rbdName, snapName)
+	if err != nil {
+		return false, err
+	}
+
+	err = d.rbdUnmapVolume(fmt.Sprintf("%s@%s", rbdName, snapName))
+	if err != nil {
+		return false, err
+	}
+
+	err = d.rbdDeleteSnapshot(rbdName, snapName)
+	if err != nil {
+		return false, err
+	}
+
+	if !isZombie(rbdName) {
+		return false, nil
+	}
+
+	snapNames, err := d.rbdListSnapshots(rbdName)
+	if err != nil {
+		return false, err
+	}
+
+	if len(snapNames) == 0 {
+		err = d.deleteRBDVolume(rbdName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// flattenClones flattens the RBD images cloned from the snapshots of a zombie RBD image and
+// deletes those snapshots, which deletes the zombie along with the last one.
+func (d *ceph) flattenClones(rbdName string) error {
+	snapNames, err := d.rbdListSnapshots(rbdName)
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range snapNames {
+		clones, err := d.rbdListClones(rbdName, snapName)
+		if err != nil {
+			return err
+		}
+
+		for _, clone := range clones {
+			err = d.rbdFlattenVolume(clone)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = d.deleteRBDSnapshot(rbdName, snapName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var cephFlattenLock sync.Mutex
+
+// flattenClonesBackground flattens in the background the clones of a zombie RBD image, then
+// deletes it. As flattening copies all the data the clones share with their parent, this doesn't
+// hold up the deletion of the volume.
+func (d *ceph) flattenClonesBackground(rbdName string) {
+	go func() {
+		cephFlattenLock.Lock()
+		defer cephFlattenLock.Unlock()
+
+		err := d.flattenClones(rbdName)
+		if err != nil {
+			d.logger.Error("Failed to flatten the clones of RBD image", log.Ctx{"image": rbdName, "err": err})
+			return
+		}
+
+		d.logger.Debug("Flattened the clones of RBD image", log.Ctx{"image": rbdName})
+	}()
+}
+
+// generateUUID gives the filesystem on a new copy of an RBD image a new UUID, so that both can be
+// mounted at once.
+func (d *ceph) generateUUID(rbdName string) error {
+	devPath, err := d.rbdMapVolume(rbdName)
+	if err != nil {
+		return err
+	}
+	defer d.rbdUnmapVolume(rbdName)
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return err
+	}
+
+	return regenerateFSUUID(devPath, fsType)
+}
@@ -0,0 +1,129 @@
+package drivers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the names of the OSD pool, cluster and user, from the pool config.
+func TestCephPoolNames(t *testing.T) {
+	d := &ceph{common{name: "default", config: map[string]string{}}}
+	assert.Equal(t, "default", d.osdPoolName())
+	assert.Equal(t, "ceph", d.clusterName())
+	assert.Equal(t, "admin", d.userName())
+	assert.Equal(t, "lxd_default", d.placeholderRBDName())
+
+	d.config["ceph.osd.pool_name"] = "lxd"
+	d.config["ceph.cluster_name"] = "backup"
+	d.config["ceph.user.name"] = "lxd"
+	assert.Equal(t, "lxd", d.osdPoolName())
+	assert.Equal(t, "backup", d.clusterName())
+	assert.Equal(t, "lxd", d.userName())
+	assert.Equal(t, "lxd/custom_vol1", d.rbdSpec(d.rbdName(VolumeTypeCustom, "vol1", false)))
+}
+
+// Test the RBD names of volumes and their snapshots.
+func TestCephRBDName(t *testing.T) {
+	d := &ceph{common{name: "default", config: map[string]string{}}}
+
+	assert.Equal(t, "container_c1", d.rbdName(VolumeTypeContainer, "c1", false))
+	assert.Equal(t, "virtual-machine_v1.block", d.rbdName(VolumeTypeVM, "v1", true))
+	assert.Equal(t, "image_abc", d.rbdName(VolumeTypeImage, "abc", false))
+	assert.Equal(t, "custom_vol1", d.rbdName(VolumeTypeCustom, "vol1", false))
+	assert.Equal(t, "snapshot_snap0", d.rbdSnapshotName("snap0"))
+	assert.Equal(t, "snapshots_container_c1_snap0_start_clone", d.rbdSnapshotCloneName(VolumeTypeContainer, "c1", "snap0"))
+
+	// Without RBD namespaces, the instances of all projects share the default one.
+	assert.Equal(t, "container_proj_c1", d.rbdName(VolumeTypeContainer, "proj_c1", false))
+
+	// Block volumes have an RBD image for their disk image along with their filesystem.
+	vol := NewVolume(d, "default", VolumeTypeVM, ContentTypeFS, "v1", nil)
+	assert.Equal(t, []string{"virtual-machine_v1"}, d.rbdVolumeNames(vol))
+
+	vol = NewVolume(d, "default", VolumeTypeVM, ContentTypeBlock, "v1", nil)
+	assert.Equal(t, []string{"virtual-machine_v1", "virtual-machine_v1.block"}, d.rbdVolumeNames(vol))
+
+	namespace, image := rbdSplitName("proj/container_c1")
+	assert.Equal(t, "proj", namespace)
+	assert.Equal(t, "container_c1", image)
+	assert.Equal(t, "proj/container_c1", rbdJoinName(namespace, image))
+
+	namespace, image = rbdSplitName("container_c1")
+	assert.Equal(t, "", namespace)
+	assert.Equal(t, "container_c1", rbdJoinName(namespace, image))
+
+	assert.True(t, isZombie("zombie_image_abc"))
+	assert.False(t, isZombie("image_abc"))
+
+	// Zombies stay in the namespace of the image.
+	zombie := rbdZombieName("proj/container_c1")
+	assert.True(t, strings.HasPrefix(zombie, "proj/zombie_container_c1_"))
+	assert.True(t, isZombie(zombie))
+
+	// Clones and parents are reported with the OSD pool.
+	assert.Equal(t, "container_c1", rbdNameFromSpec("lxd/container_c1"))
+	assert.Equal(t, "proj/container_c1", rbdNameFromSpec("lxd/proj/container_c1"))
+	assert.Equal(t, "image_abc@readonly", rbdNameFromSpec("lxd/image_abc@readonly"))
+}
+
+// Test the RBD names of volumes with RBD namespaces enabled.
+func TestCephRBDNameNamespaces(t *testing.T) {
+	d := &ceph{common{config: map[string]string{"ceph.osd.pool_name": "lxd", "ceph.rbd.namespaces": "true"}}}
+
+	// Instances of the default project stay in the default namespace.
+	assert.Equal(t, "container_c1", d.rbdName(VolumeTypeContainer, "c1", false))
+
+	// Instances of other projects go in a namespace named after the project.
+	assert.Equal(t, "my_proj/container_c1", d.rbdName(VolumeTypeContainer, "my_proj_c1", false))
+	assert.Equal(t, "proj/virtual-machine_v1.block", d.rbdName(VolumeTypeVM, "proj_v1", true))
+	assert.Equal(t, "lxd/proj/container_c1", d.rbdSpec(d.rbdName(VolumeTypeContainer, "proj_c1", false)))
+	assert.Equal(t, "proj/snapshots_container_c1_snap_0_start_clone", d.rbdSnapshotCloneName(VolumeTypeContainer, "proj_c1", "snap_0"))
+
+	// Images and custom volumes are shared by all projects.
+	assert.Equal(t, "image_abc", d.rbdName(VolumeTypeImage, "abc", false))
+	assert.Equal(t, "custom_my_vol", d.rbdName(VolumeTypeCustom, "my_vol", false))
+
+	assert.True(t, isZombie("proj/zombie_container_c1_1234"))
+}
+
+// Test the size, filesystem and mount options of volumes, from the volume or pool config.
+func TestCephVolumeDefaults(t *testing.T) {
+	d := &ceph{common{name: "default", config: map[string]string{}}}
+
+	vol := NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", map[string]string{})
+	size, err := d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10000000000), size)
+	assert.Equal(t, "ext4", d.volumeFilesystem(vol))
+
+	d.config["volume.size"] = "5GB"
+	d.config["volume.block.filesystem"] = "xfs"
+	size, err = d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000000000), size)
+	assert.Equal(t, "xfs", d.volumeFilesystem(vol))
+
+	vol.config["size"] = "1GB"
+	vol.config["block.filesystem"] = "btrfs"
+	size, err = d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000000000), size)
+	assert.Equal(t, "btrfs", d.volumeFilesystem(vol))
+
+	// The filesystem of block volumes only holds their config, the disk image gets the size.
+	vol = NewVolume(d, "default", VolumeTypeVM, ContentTypeBlock, "v1", map[string]string{"size": "20GB"})
+	size, err = d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100000000), size)
+
+	size, err = d.volumeSize(vol, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20000000000), size)
+
+	// Snapshots of xfs filesystems share the UUID of their volume.
+	assert.Equal(t, "discard", d.mountOptions("ext4", true))
+	assert.Equal(t, "user_subvol_rm_allowed,discard", d.mountOptions("btrfs", false))
+	assert.Equal(t, "discard,nouuid", d.mountOptions("xfs", true))
+}
@@ -0,0 +1,1024 @@
+package drivers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/rsync"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/units"
+)
+
+// ValidateVolume validates the supplied volume config.
+func (d *ceph) ValidateVolume(vol Volume, removeUnknownKeys bool) error {
+	rules := map[string]func(value string) error{
+		"block.filesystem": func(value string) error {
+			return shared.IsOneOf(value, []string{"", "btrfs", "ext4", "xfs"})
+		},
+		"block.mount_options": shared.IsAny,
+	}
+
+	return d.validateVolume(vol, rules, removeUnknownKeys)
+}
+
+// HasVolume indicates whether a specific volume exists on the storage pool.
+func (d *ceph) HasVolume(volType VolumeType, volName string) bool {
+	return d.rbdVolumeExists(d.rbdName(volType, volName, false))
+}
+
+// GetVolumeDiskPath returns the location and format of the disk image of a block volume, mapping
+// it if needed.
+func (d *ceph) GetVolumeDiskPath(volType VolumeType, volName string) (string, string, error) {
+	devPath, err := d.rbdDevPath(d.rbdName(volType, volName, true))
+	if err != nil {
+		return "", "", err
+	}
+
+	return devPath, "raw", nil
+}
+
+// GetVolumeUsage isn't supported, as RBD images don't track their usage without extra features
+// the kernel module lacks.
+func (d *ceph) GetVolumeUsage(vol Volume) (int64, error) {
+	return -1, Errorf(ErrNotSupported, "Volume usage isn't reported for RBD images")
+}
+
+// CreateVolume creates an empty volume and can optionally fill it by executing the supplied
+// filler function. Block volumes get a small filesystem for their files next to the RBD image
+// holding their disk image. Image volumes then get a protected snapshot to clone instances from.
+func (d *ceph) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath string) error, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Create slice of RBD images created if revert needed later.
+	revertRBDs := []string{}
+	defer func() {
+		if revertRBDs == nil {
+			return
+		}
+
+		forceUnmount(vol.MountPath())
+
+		for _, rbdName := range revertRBDs {
+			d.deleteRBDVolume(rbdName)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	for _, rbdName := range d.rbdVolumeNames(vol) {
+		block := strings.HasSuffix(rbdName, cephBlockVolSuffix)
+
+		sizeBytes, err := d.volumeSize(vol, block)
+		if err != nil {
+			return err
+		}
+
+		err = d.rbdCreateVolume(rbdName, sizeBytes)
+		if err != nil {
+			return err
+		}
+
+		revertRBDs = append(revertRBDs, rbdName)
+
+		if !block {
+			devPath, err := d.rbdDevPath(rbdName)
+			if err != nil {
+				return err
+			}
+
+			err = makeFSType(devPath, d.volumeFilesystem(vol))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	// We expect the filler to copy the VM image into the RBD image's device.
+	rootBlockPath := ""
+	if vol.contentType == ContentTypeBlock {
+		rootBlockPath, _, err = d.GetVolumeDiskPath(vol.volType, vol.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Run the volume filler function if supplied.
+	if filler != nil {
+		err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return filler(mountPath, rootBlockPath)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	if vol.volType == VolumeTypeImage {
+		// The content of the image must be complete before being snapshotted.
+		_, err = d.UnmountVolume(vol.volType, vol.name, op)
+		if err != nil {
+			return err
+		}
+
+		for _, rbdName := range d.rbdVolumeNames(vol) {
+			err = d.rbdUnmapVolume(rbdName)
+			if err != nil {
+				return err
+			}
+
+			err = d.rbdCreateSnapshot(rbdName, cephImageSnapshotName)
+			if err != nil {
+				return err
+			}
+
+			err = d.rbdProtectSnapshot(rbdName, cephImageSnapshotName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	revertRBDs = nil
+	return nil
+}
+
+// CreateVolumeFromCopy provides same-pool volume copying functionality. Volumes created from an
+// image volume are clones of its protected snapshot, as are copies of other volumes (without
+// their snapshots) unless "ceph.rbd.clone_copy" is disabled. Other copies are full copies.
+func (d *ceph) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
+	if vol.contentType != srcVol.contentType || (vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock) {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Snapshots can't be copied from a snapshot.
+	copySnapshots = copySnapshots && !srcVol.IsSnapshot()
+
+	srcSnapshots := []string{}
+	if copySnapshots {
+		var err error
+		srcSnapshots, err = d.VolumeSnapshots(srcVol.volType, srcVol.name, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create slice of RBD images created if revert needed later.
+	revertRBDs := []string{}
+	defer func() {
+		if revertRBDs == nil {
+			return
+		}
+
+		for _, rbdName := range revertRBDs {
+			d.deleteRBDVolume(rbdName)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	srcRBDNames := d.rbdVolumeNames(srcVol)
+	if srcVol.IsSnapshot() {
+		parentName, snapName, _ := shared.ContainerGetParentAndSnapshotName(srcVol.name)
+		srcRBDNames = []string{}
+		for _, srcRBDName := range d.rbdVolumeNames(NewVolume(d, d.name, srcVol.volType, srcVol.contentType, parentName, nil)) {
+			srcRBDNames = append(srcRBDNames, fmt.Sprintf("%s@%s", srcRBDName, d.rbdSnapshotName(snapName)))
+		}
+	}
+
+	cloneCopy := d.config["ceph.rbd.clone_copy"] == "" || shared.IsTrue(d.config["ceph.rbd.clone_copy"])
+
+	for i, rbdName := range d.rbdVolumeNames(vol) {
+		srcRBDName := srcRBDNames[i]
+
+		var err error
+		if srcVol.volType == VolumeTypeImage {
+			err = d.rbdCloneVolume(srcRBDName, cephImageSnapshotName, rbdName)
+		} else if len(srcSnapshots) > 0 {
+			err = d.copyRBDVolumeWithSnapshots(srcRBDName, srcSnapshots, rbdName)
+		} else if cloneCopy && !srcVol.IsSnapshot() {
+			// The snapshot the clone depends on is deleted along with the clone.
+			snapName := fmt.Sprintf("zombie_snapshot_%s", uuid.NewRandom().String())
+
+			err = d.rbdCreateSnapshot(srcRBDName, snapName)
+			if err == nil {
+				err = d.rbdCloneVolume(srcRBDName, snapName, rbdName)
+				if err != nil {
+					d.deleteRBDSnapshot(srcRBDName, snapName)
+				}
+			}
+		} else {
+			err = d.rbdCopyVolume(srcRBDName, rbdName)
+		}
+		if err != nil {
+			return err
+		}
+
+		revertRBDs = append(revertRBDs, rbdName)
+
+		if !strings.HasSuffix(rbdName, cephBlockVolSuffix) {
+			err = d.generateUUID(rbdName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range srcSnapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		err = snapshot.CreateMountPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	if vol.config["size"] != "" {
+		err = d.SetVolumeQuota(vol.volType, vol.name, vol.config["size"], op)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertRBDs = nil
+	return nil
+}
+
+// copyRBDVolumeWithSnapshots creates a full copy of an RBD image along with the RBD snapshots of
+// the given volume snapshots, by applying the changes between each of them in turn.
+func (d *ceph) copyRBDVolumeWithSnapshots(srcRBDName string, snapNames []string, rbdName string) error {
+	sizeBytes, err := d.rbdVolumeSize(srcRBDName)
+	if err != nil {
+		return err
+	}
+
+	err = d.rbdCreateVolume(rbdName, sizeBytes)
+	if err != nil {
+		return err
+	}
+
+	fromSnapName := ""
+	for _, snapName := range snapNames {
+		err = d.rbdCopyDiff(fmt.Sprintf("%s@%s", srcRBDName, d.rbdSnapshotName(snapName)), fromSnapName, rbdName)
+		if err != nil {
+			d.deleteRBDVolume(rbdName)
+			return err
+		}
+
+		fromSnapName = d.rbdSnapshotName(snapName)
+	}
+
+	err = d.rbdCopyDiff(srcRBDName, fromSnapName, rbdName)
+	if err != nil {
+		d.deleteRBDVolume(rbdName)
+		return err
+	}
+
+	return nil
+}
+
+// MigrateVolume sends a volume for migration. The disk image of block volumes is sent after the
+// files next to it, with its holes skipped.
+func (d *ceph) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volSrcArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	if vol.contentType == ContentTypeBlock && !shared.StringInSlice("sparse", volSrcArgs.MigrationType.Features) {
+		return Errorf(ErrNotSupported, "Migration of block volumes requires the \"sparse\" feature")
+	}
+
+	for _, snapName := range volSrcArgs.Snapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		// Send snapshot to recipient (ensure local snapshot volume is mounted if needed).
+		err = snapshot.MountTask(func(mountPath string, op *operations.Operation) error {
+			var wrapper *ioprogress.ProgressTracker
+			if volSrcArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapshot.name)
+			}
+
+			return d.sendRBDVolume(snapshot, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, nil)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send volume to recipient (ensure local volume is mounted if needed).
+	return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.sendRBDVolume(vol, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, volSrcArgs.Freeze)
+	}, op)
+}
+
+// sendRBDVolume sends the files of a mounted volume (or volume snapshot) using rsync, followed by
+// the disk image of block volumes.
+func (d *ceph) sendRBDVolume(vol Volume, mountPath string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string, freeze func() error) error {
+	bwlimit := d.config["rsync.bwlimit"]
+
+	err := rsync.Send(vol.name, shared.AddSlash(mountPath), conn, tracker, features, bwlimit, d.state.OS.ExecPath)
+	if err != nil {
+		return err
+	}
+
+	if vol.contentType != ContentTypeBlock {
+		return nil
+	}
+
+	if !vol.IsSnapshot() {
+		devPath, err := d.rbdDevPath(d.rbdName(vol.volType, vol.name, true))
+		if err != nil {
+			return err
+		}
+
+		return sendDiskImage(conn, devPath, tracker, features, freeze)
+	}
+
+	// Snapshots are mapped read-only for the time of the transfer.
+	parentName, snapName, _ := shared.ContainerGetParentAndSnapshotName(vol.name)
+	rbdName := fmt.Sprintf("%s@%s", d.rbdName(vol.volType, parentName, true), d.rbdSnapshotName(snapName))
+
+	devPath, err := d.rbdMapVolume(rbdName)
+	if err != nil {
+		return err
+	}
+	defer d.rbdUnmapVolume(rbdName)
+
+	return sendSparseFile(conn, devPath, tracker)
+}
+
+// recvRBDVolume receives the files and disk image sent by sendRBDVolume into a mounted volume.
+func (d *ceph) recvRBDVolume(vol Volume, mountPath string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string) error {
+	err := rsync.Recv(shared.AddSlash(mountPath), conn, tracker, features)
+	if err != nil {
+		return wrapInsufficientSpace(err)
+	}
+
+	if vol.contentType != ContentTypeBlock {
+		return nil
+	}
+
+	devPath, err := d.rbdDevPath(d.rbdName(vol.volType, vol.name, true))
+	if err != nil {
+		return err
+	}
+
+	return wrapInsufficientSpace(recvSparseFile(conn, devPath, tracker))
+}
+
+// CreateVolumeFromMigration creates a volume being sent via a migration.
+func (d *ceph) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volTargetArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	if vol.contentType == ContentTypeBlock && !shared.StringInSlice("sparse", volTargetArgs.MigrationType.Features) {
+		return Errorf(ErrNotSupported, "Migration of block volumes requires the \"sparse\" feature")
+	}
+
+	err := d.CreateVolume(vol, nil, op)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		d.DeleteVolume(vol.volType, vol.name, op)
+	}()
+
+	// Ensure the volume is mounted.
+	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		// Snapshots are sent first by the sender, so create these first.
+		for _, snapName := range volTargetArgs.Snapshots {
+			// Receive the snapshot
+			var wrapper *ioprogress.ProgressTracker
+			if volTargetArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+			}
+
+			err := d.recvRBDVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
+			if err != nil {
+				return err
+			}
+
+			// Create the snapshot itself.
+			err = d.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+			if err != nil {
+				return err
+			}
+
+			// Setup the revert.
+			revertSnaps = append(revertSnaps, snapName)
+		}
+
+		// Receive the main volume from sender.
+		var wrapper *ioprogress.ProgressTracker
+		if volTargetArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.recvRBDVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// VolumeSnapshots returns a list of snapshots for the volume, oldest first. RBD snapshots which
+// don't belong to a volume snapshot (like those clones depend on) are left out.
+func (d *ceph) VolumeSnapshots(volType VolumeType, volName string, op *operations.Operation) ([]string, error) {
+	snapNames, err := d.rbdListSnapshots(d.rbdName(volType, volName, false))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []string{}
+	for _, snapName := range snapNames {
+		if !strings.HasPrefix(snapName, "snapshot_") {
+			continue
+		}
+
+		snapshots = append(snapshots, strings.TrimPrefix(snapName, "snapshot_"))
+	}
+
+	return snapshots, nil
+}
+
+// UpdateVolume applies config changes to the volume.
+func (d *ceph) UpdateVolume(vol Volume, changedConfig map[string]string) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if _, changed := changedConfig["block.filesystem"]; changed {
+		return fmt.Errorf("The filesystem of a volume can't be changed")
+	}
+
+	if size, changed := changedConfig["size"]; changed {
+		return d.SetVolumeQuota(vol.volType, vol.name, size, nil)
+	}
+
+	return nil
+}
+
+// RenameVolume renames a volume, whose snapshots follow its RBD images.
+func (d *ceph) RenameVolume(volType VolumeType, volName string, newVolName string, op *operations.Operation) error {
+	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
+	newVol := NewVolume(d, d.name, volType, ContentTypeFS, newVolName, nil)
+
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the volume and its snapshots aren't mounted, as their mount paths change.
+	_, err = d.UnmountVolume(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range snapshots {
+		_, err = d.UnmountVolumeSnapshot(volType, volName, snapName, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	type rbdRevert struct {
+		oldName string
+		newName string
+	}
+
+	// Create slice to record RBD images renamed if revert needed later.
+	revertRBDs := []rbdRevert{}
+	defer func() {
+		// Rename back any RBD images if we are reverting.
+		for _, rbd := range revertRBDs {
+			d.rbdRenameVolume(rbd.newName, rbd.oldName)
+		}
+	}()
+
+	for _, rbdName := range d.existingRBDNames(volType, volName) {
+		newRBDName := d.rbdName(volType, newVolName, strings.HasSuffix(rbdName, cephBlockVolSuffix))
+
+		err = d.rbdUnmapVolume(rbdName)
+		if err != nil {
+			return err
+		}
+
+		err = d.rbdRenameVolume(rbdName, newRBDName)
+		if err != nil {
+			return err
+		}
+
+		revertRBDs = append(revertRBDs, rbdRevert{
+			oldName: rbdName,
+			newName: newRBDName,
+		})
+	}
+
+	// Move the mount paths of the volume and of its snapshots.
+	err = newVol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(vol.MountPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	oldSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	newSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newVolName)
+	if err != nil {
+		return err
+	}
+
+	if shared.PathExists(oldSnapshotDir) {
+		err = os.Rename(oldSnapshotDir, newSnapshotDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertRBDs = nil
+	return nil
+}
+
+// RestoreVolume restores a volume from a snapshot.
+func (d *ceph) RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(vol.volType, vol.name, op)
+	if err != nil {
+		return err
+	}
+
+	if !shared.StringInSlice(snapshotName, snapshots) {
+		return Errorf(ErrNotFound, "Snapshot not found")
+	}
+
+	_, err = d.UnmountVolume(vol.volType, vol.name, op)
+	if err != nil {
+		return err
+	}
+
+	for _, rbdName := range d.rbdVolumeNames(vol) {
+		err = d.rbdUnmapVolume(rbdName)
+		if err != nil {
+			return err
+		}
+
+		err = d.rbdRollbackSnapshot(rbdName, d.rbdSnapshotName(snapshotName))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The restored filesystem may be mounted next to the snapshot's.
+	return d.generateUUID(d.rbdName(vol.volType, vol.name, false))
+}
+
+// DeleteVolume deletes a volume of the storage device. If any snapshots of the volume remain then
+// this function will return an error. RBD images which other volumes were cloned from are kept as
+// zombies until those are gone, or until their clones are flattened in the background if
+// "ceph.rbd.flatten_clones" is enabled.
+func (d *ceph) DeleteVolume(volType VolumeType, volName string, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) > 0 {
+		return Errorf(ErrInUse, "Cannot remove a volume that has snapshots")
+	}
+
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	_, err = forceUnmount(volPath)
+	if err != nil {
+		return err
+	}
+
+	for _, rbdName := range d.existingRBDNames(volType, volName) {
+		if shared.IsTrue(d.config["ceph.rbd.flatten_clones"]) {
+			used, err := d.rbdHasClones(rbdName)
+			if err != nil {
+				return err
+			}
+
+			if used {
+				err = d.rbdUnmapVolume(rbdName)
+				if err != nil {
+					return err
+				}
+
+				zombieName := rbdZombieName(rbdName)
+				err = d.rbdRenameVolume(rbdName, zombieName)
+				if err != nil {
+					return err
+				}
+
+				d.flattenClonesBackground(zombieName)
+				continue
+			}
+		}
+
+		err = d.deleteRBDVolume(rbdName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the volume's mount path.
+	err = os.RemoveAll(volPath)
+	if err != nil {
+		return err
+	}
+
+	// Although the volume snapshot directory should already be removed, lets remove it here
+	// to just in case the top-level directory is left.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MountVolume maps and mounts the filesystem of a volume, returns true if we caused a new mount.
+func (d *ceph) MountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	// Check if already mounted.
+	if shared.IsMountPoint(volPath) {
+		return false, nil
+	}
+
+	devPath, err := d.rbdDevPath(d.rbdName(volType, volName, false))
+	if err != nil {
+		return false, err
+	}
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return false, err
+	}
+
+	mountFlags, mountData := resolveMountOptions(d.mountOptions(fsType, false))
+	err = tryMount(devPath, volPath, fsType, mountFlags, mountData)
+	if err != nil {
+		return false, fmt.Errorf("Failed to mount RBD device %q onto %q: %v", devPath, volPath, err)
+	}
+
+	return true, nil
+}
+
+// MountVolumeSnapshot mounts the filesystem of a volume snapshot as read-only. A clone of the
+// snapshot is mounted in its place, so that the filesystem's journal can be replayed.
+func (d *ceph) MountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, GetSnapshotVolumeName(volName, snapshotName), nil)
+	snapPath := snapVol.MountPath()
+
+	// Check if already mounted.
+	if shared.IsMountPoint(snapPath) {
+		return false, nil
+	}
+
+	err := snapVol.CreateMountPath()
+	if err != nil {
+		return false, err
+	}
+
+	cloneName := d.rbdSnapshotCloneName(volType, volName, snapshotName)
+
+	err = d.rbdCloneVolume(d.rbdName(volType, volName, false), d.rbdSnapshotName(snapshotName), cloneName)
+	if err != nil {
+		return false, err
+	}
+
+	revertClone := true
+	defer func() {
+		if revertClone {
+			d.deleteRBDVolume(cloneName)
+		}
+	}()
+
+	err = d.generateUUID(cloneName)
+	if err != nil {
+		return false, err
+	}
+
+	devPath, err := d.rbdDevPath(cloneName)
+	if err != nil {
+		return false, err
+	}
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return false, err
+	}
+
+	mountFlags, mountData := resolveMountOptions(d.mountOptions(fsType, true))
+	err = tryMount(devPath, snapPath, fsType, mountFlags|unix.MS_RDONLY, mountData)
+	if err != nil {
+		return false, fmt.Errorf("Failed to mount RBD device %q onto %q: %v", devPath, snapPath, err)
+	}
+
+	revertClone = false
+	return true, nil
+}
+
+// UnmountVolume unmounts the filesystem of a volume and unmaps it, returns true if unmounted,
+// false if was not mounted.
+func (d *ceph) UnmountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	ourUnmount, err := forceUnmount(GetVolumeMountPath(d.name, volType, volName))
+	if err != nil {
+		return false, err
+	}
+
+	if ourUnmount {
+		err = d.rbdUnmapVolume(d.rbdName(volType, volName, false))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return ourUnmount, nil
+}
+
+// UnmountVolumeSnapshot unmounts the filesystem of a volume snapshot and deletes the clone which
+// was mounted in its place.
+func (d *ceph) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	ourUnmount, err := forceUnmount(GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName)))
+	if err != nil {
+		return false, err
+	}
+
+	cloneName := d.rbdSnapshotCloneName(volType, volName, snapshotName)
+	if d.rbdVolumeExists(cloneName) {
+		err = d.deleteRBDVolume(cloneName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return ourUnmount, nil
+}
+
+// SetVolumeQuota resizes the RBD image holding the filesystem of a volume (along with the
+// filesystem) or the disk image of a block volume, which can only grow.
+func (d *ceph) SetVolumeQuota(volType VolumeType, volName, size string, op *operations.Operation) error {
+	if size == "" || size == "0" {
+		size = d.config["volume.size"]
+	}
+
+	if size == "" || size == "0" {
+		size = cephDefaultVolumeSize
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	rbdName := d.rbdName(volType, volName, false)
+	block := d.rbdVolumeExists(d.rbdName(volType, volName, true))
+	if block {
+		rbdName = d.rbdName(volType, volName, true)
+	}
+
+	currentBytes, err := d.rbdVolumeSize(rbdName)
+	if err != nil {
+		return err
+	}
+
+	if sizeBytes == currentBytes {
+		return nil
+	}
+
+	if block {
+		if sizeBytes < currentBytes {
+			return Errorf(ErrNotSupported, "Block volumes can't be shrunk")
+		}
+
+		return d.rbdResizeVolume(rbdName, sizeBytes)
+	}
+
+	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
+
+	devPath, err := d.rbdDevPath(rbdName)
+	if err != nil {
+		return err
+	}
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return err
+	}
+
+	// Grow the RBD image before its filesystem, or shrink it after.
+	if sizeBytes > currentBytes {
+		err = d.rbdResizeVolume(rbdName, sizeBytes)
+		if err != nil {
+			return err
+		}
+
+		return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return growFileSystem(fsType, devPath, mountPath)
+		}, op)
+	}
+
+	if fsType == "ext4" {
+		err = unmountForShrink(vol.MountPath())
+		if err != nil {
+			return err
+		}
+
+		err = shrinkFileSystem(fsType, devPath, "", sizeBytes)
+	} else {
+		err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return shrinkFileSystem(fsType, devPath, mountPath, sizeBytes)
+		}, op)
+	}
+	if err != nil {
+		return err
+	}
+
+	return d.rbdResizeVolume(rbdName, sizeBytes)
+}
+
+// CompactVolume deallocates the zeroed objects of the RBD image holding the disk of a block volume.
+func (d *ceph) CompactVolume(vol Volume, op *operations.Operation) error {
+	if vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Only block volumes can be compacted")
+	}
+
+	_, err := d.rbdCommand("sparsify", d.rbdSpec(d.rbdName(vol.volType, vol.name, true)))
+	return err
+}
+
+// CheckVolume checks the filesystem of an unmounted filesystem volume without repairing it.
+func (d *ceph) CheckVolume(vol Volume, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	if vol.contentType != ContentTypeFS {
+		return nil, Errorf(ErrNotSupported, "Only filesystem volumes can be checked")
+	}
+
+	if shared.IsMountPoint(vol.MountPath()) {
+		return nil, Errorf(ErrInUse, "The volume must be unmounted to be checked")
+	}
+
+	devPath, err := d.rbdDevPath(d.rbdName(vol.volType, vol.name, false))
+	if err != nil {
+		return nil, err
+	}
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkFileSystem(fsType, devPath)
+}
+
+// CreateVolumeSnapshot creates a snapshot of a volume.
+func (d *ceph) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapshotName string, op *operations.Operation) error {
+	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, GetSnapshotVolumeName(volName, newSnapshotName), nil)
+	rbdSnapName := d.rbdSnapshotName(newSnapshotName)
+
+	// Create slice of RBD images snapshotted if revert needed later.
+	revertRBDs := []string{}
+	defer func() {
+		for _, rbdName := range revertRBDs {
+			d.rbdDeleteSnapshot(rbdName, rbdSnapName)
+		}
+	}()
+
+	for _, rbdName := range d.existingRBDNames(volType, volName) {
+		err := d.rbdCreateSnapshot(rbdName, rbdSnapName)
+		if err != nil {
+			return err
+		}
+
+		revertRBDs = append(revertRBDs, rbdName)
+	}
+
+	// Create snapshot mount path.
+	err := snapVol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	revertRBDs = nil
+	return nil
+}
+
+// DeleteVolumeSnapshot removes a snapshot from the storage device. The volName and snapshotName
+// must be bare names and should not be in the format "volume/snapshot". Snapshots which volumes
+// were cloned from are kept as zombies until those are deleted.
+func (d *ceph) DeleteVolumeSnapshot(volType VolumeType, volName string, snapshotName string, op *operations.Operation) error {
+	snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+
+	_, err := d.UnmountVolumeSnapshot(volType, volName, snapshotName, op)
+	if err != nil {
+		return err
+	}
+
+	for _, rbdName := range d.existingRBDNames(volType, volName) {
+		_, err = d.deleteRBDSnapshot(rbdName, d.rbdSnapshotName(snapshotName))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the snapshot mount path.
+	err = os.RemoveAll(snapPath)
+	if err != nil {
+		return err
+	}
+
+	// Remove the parent snapshot directory if this is the last snapshot being removed.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameVolumeSnapshot renames a volume snapshot.
+func (d *ceph) RenameVolumeSnapshot(volType VolumeType, volName string, snapshotName string, newSnapshotName string, op *operations.Operation) error {
+	oldPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+	newPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, newSnapshotName))
+
+	_, err := d.UnmountVolumeSnapshot(volType, volName, snapshotName, op)
+	if err != nil {
+		return err
+	}
+
+	for _, rbdName := range d.existingRBDNames(volType, volName) {
+		err = d.rbdRenameSnapshot(rbdName, d.rbdSnapshotName(snapshotName), d.rbdSnapshotName(newSnapshotName))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the validation of the Ceph specific volume keys.
+func TestCephValidateVolume(t *testing.T) {
+	d := &ceph{common{name: "default", config: map[string]string{}, getCommonRules: testCommonRules}}
+
+	config := map[string]string{"block.filesystem": "btrfs", "block.mount_options": "noatime", "size": "10GB"}
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+
+	config = map[string]string{"block.filesystem": "ntfs"}
+	assert.Error(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+
+	config = map[string]string{"zfs.atime": "off"}
+	assert.Error(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), true))
+	assert.Empty(t, config)
+}
@@ -14,9 +14,11 @@ import (
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/rsync"
+	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/logger"
 	"github.com/lxc/lxd/shared/units"
 )
 
@@ -27,13 +29,24 @@ type cephfs struct {
 	common
 }
 
+// init sets up the driver, then loads it. The load() call in common.init() doesn't reach the
+// load() function of the CephFS driver.
+func (d *cephfs) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error {
+	err := d.common.init(state, name, config, logger, volIDFunc, commonRulesFunc)
+	if err != nil {
+		return err
+	}
+
+	return d.load()
+}
+
 func (d *cephfs) load() error {
 	if cephfsLoaded {
 		return nil
 	}
 
 	// Validate the required binaries.
-	for _, tool := range []string{"ceph", "rdb"} {
+	for _, tool := range []string{"ceph", "rbd"} {
 		_, err := exec.LookPath(tool)
 		if err != nil {
 			return fmt.Errorf("Required tool '%s' is missing", tool)
@@ -64,6 +77,9 @@ func (d *cephfs) Info() Info {
 		VolumeTypes:        []VolumeType{VolumeTypeCustom},
 		BlockBacking:       false,
 		RunningQuotaResize: true,
+		InstantClones:      false,
+		RunningCopyFreeze:  false,
+		OptimizedBackups:   false,
 	}
 }
 
@@ -315,11 +331,11 @@ func (d *cephfs) GetVolumeDiskPath(volType VolumeType, volName string) (string,
 
 func (d *cephfs) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath string) error, op *operations.Operation) error {
 	if vol.volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	if vol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	volPath := vol.MountPath()
@@ -349,11 +365,11 @@ func (d *cephfs) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath s
 
 func (d *cephfs) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
 	if vol.volType != VolumeTypeCustom || srcVol.volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	if vol.contentType != ContentTypeFS || srcVol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	bwlimit := d.config["rsync.bwlimit"]
@@ -399,6 +415,9 @@ func (d *cephfs) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots b
 					_, err = rsync.LocalCopy(srcMountPath, mountPath, bwlimit, false)
 					return err
 				}, op)
+				if err != nil {
+					return err
+				}
 
 				// Create the snapshot itself.
 				err = d.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
@@ -433,7 +452,7 @@ func (d *cephfs) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots b
 
 func (d *cephfs) DeleteVolume(volType VolumeType, volName string, op *operations.Operation) error {
 	if volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	snapshots, err := d.VolumeSnapshots(volType, volName, op)
@@ -442,7 +461,7 @@ func (d *cephfs) DeleteVolume(volType VolumeType, volName string, op *operations
 	}
 
 	if len(snapshots) > 0 {
-		return fmt.Errorf("Cannot remove a volume that has snapshots")
+		return Errorf(ErrInUse, "Cannot remove a volume that has snapshots")
 	}
 
 	volPath := GetVolumeMountPath(d.name, volType, volName)
@@ -473,20 +492,15 @@ func (d *cephfs) DeleteVolume(volType VolumeType, volName string, op *operations
 	return nil
 }
 
+// RenameVolume renames a volume and its snapshots. The snapshots live in the ".snap" directory of
+// the volume, so only the symlinks pointing at them need to be updated.
 func (d *cephfs) RenameVolume(volType VolumeType, volName string, newName string, op *operations.Operation) error {
 	if volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
-	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
-
-	// Create new snapshots directory.
-	snapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newName)
-	if err != nil {
-		return err
-	}
-
-	err = os.MkdirAll(snapshotDir, 0711)
+	// Get the list of snapshots before their directory gets renamed.
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
 	if err != nil {
 		return err
 	}
@@ -500,19 +514,16 @@ func (d *cephfs) RenameVolume(volType VolumeType, volName string, newName string
 	// Create slice to record paths renamed if revert needed later.
 	revertPaths := []volRevert{}
 	defer func() {
-		// Remove any paths rename if we are reverting.
-		for _, vol := range revertPaths {
+		// Undo the changes in reverse order if we are reverting.
+		for i := len(revertPaths) - 1; i >= 0; i-- {
+			vol := revertPaths[i]
 			if vol.isSymlink {
+				os.Remove(vol.newPath)
 				os.Symlink(vol.oldPath, vol.newPath)
 			} else {
 				os.Rename(vol.newPath, vol.oldPath)
 			}
 		}
-
-		// Remove the new snapshot directory if we are reverting.
-		if len(revertPaths) > 0 {
-			err = os.RemoveAll(snapshotDir)
-		}
 	}()
 
 	// Rename the snapshot directory first.
@@ -521,12 +532,12 @@ func (d *cephfs) RenameVolume(volType VolumeType, volName string, newName string
 		return err
 	}
 
-	if shared.PathExists(srcSnapshotDir) {
-		targetSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newName)
-		if err != nil {
-			return err
-		}
+	targetSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newName)
+	if err != nil {
+		return err
+	}
 
+	if shared.PathExists(srcSnapshotDir) {
 		err = os.Rename(srcSnapshotDir, targetSnapshotDir)
 		if err != nil {
 			return err
@@ -538,48 +549,38 @@ func (d *cephfs) RenameVolume(volType VolumeType, volName string, newName string
 		})
 	}
 
-	// Rename any snapshots of the volume too.
-	snapshots, err := vol.Snapshots(op)
-	if err != nil {
-		return err
-	}
-
-	sourcePath := GetVolumeMountPath(d.name, volType, newName)
+	// Point the snapshot symlinks at the ".snap" directory of the renamed volume.
+	sourcePath := GetVolumeMountPath(d.name, volType, volName)
 	targetPath := GetVolumeMountPath(d.name, volType, newName)
 
-	for _, snapshot := range snapshots {
-		// Figure out the snapshot paths.
-		_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snapshot.name)
+	for _, snapName := range snapshots {
 		oldCephSnapPath := filepath.Join(sourcePath, ".snap", snapName)
 		newCephSnapPath := filepath.Join(targetPath, ".snap", snapName)
-		oldPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapName))
-		newPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(newName, snapName))
+		snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(newName, snapName))
 
-		// Update the symlink.
-		err = os.Symlink(newCephSnapPath, newPath)
+		err = os.Remove(snapPath)
 		if err != nil {
 			return err
 		}
 
 		revertPaths = append(revertPaths, volRevert{
-			oldPath:   oldPath,
-			newPath:   oldCephSnapPath,
+			oldPath:   oldCephSnapPath,
+			newPath:   snapPath,
 			isSymlink: true,
 		})
+
+		err = os.Symlink(newCephSnapPath, snapPath)
+		if err != nil {
+			return err
+		}
 	}
 
-	oldPath := GetVolumeMountPath(d.name, volType, volName)
-	newPath := GetVolumeMountPath(d.name, volType, newName)
-	err = os.Rename(oldPath, newPath)
+	// Rename the volume itself.
+	err = os.Rename(sourcePath, targetPath)
 	if err != nil {
 		return err
 	}
 
-	revertPaths = append(revertPaths, volRevert{
-		oldPath: oldPath,
-		newPath: newPath,
-	})
-
 	revertPaths = nil
 	return nil
 }
@@ -593,13 +594,15 @@ func (d *cephfs) UpdateVolume(vol Volume, changedConfig map[string]string) error
 	return d.SetVolumeQuota(vol.volType, vol.name, value, nil)
 }
 
-func (d *cephfs) GetVolumeUsage(volType VolumeType, volName string) (int64, error) {
-	out, err := shared.RunCommand("getfattr", "-n", "ceph.quota.max_bytes", "--only-values", GetVolumeMountPath(d.name, volType, volName))
+// GetVolumeUsage returns the disk space used by the volume, which CephFS keeps track of for each
+// directory.
+func (d *cephfs) GetVolumeUsage(vol Volume) (int64, error) {
+	out, err := shared.RunCommand("getfattr", "-n", "ceph.dir.rbytes", "--only-values", vol.MountPath())
 	if err != nil {
 		return -1, err
 	}
 
-	size, err := strconv.ParseInt(out, 10, 64)
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
 	if err != nil {
 		return -1, err
 	}
@@ -617,13 +620,23 @@ func (d *cephfs) SetVolumeQuota(volType VolumeType, volName, size string, op *op
 		return err
 	}
 
+	usedBytes, err := d.GetVolumeUsage(NewVolume(d, d.name, volType, ContentTypeFS, volName, nil))
+	if err != nil {
+		return err
+	}
+
+	err = checkQuotaAboveUsage(sizeBytes, usedBytes)
+	if err != nil {
+		return err
+	}
+
 	_, err = shared.RunCommand("setfattr", "-n", "ceph.quota.max_bytes", "-v", fmt.Sprintf("%d", sizeBytes), GetVolumeMountPath(d.name, volType, volName))
 	return err
 }
 
 func (d *cephfs) MountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
 	if volType != VolumeTypeCustom {
-		return false, fmt.Errorf("Volume type not supported")
+		return false, Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	return false, nil
@@ -631,7 +644,7 @@ func (d *cephfs) MountVolume(volType VolumeType, volName string, op *operations.
 
 func (d *cephfs) MountVolumeSnapshot(volType VolumeType, VolName, snapshotName string, op *operations.Operation) (bool, error) {
 	if volType != VolumeTypeCustom {
-		return false, fmt.Errorf("Volume type not supported")
+		return false, Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	return false, nil
@@ -639,7 +652,7 @@ func (d *cephfs) MountVolumeSnapshot(volType VolumeType, VolName, snapshotName s
 
 func (d *cephfs) UnmountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
 	if volType != VolumeTypeCustom {
-		return false, fmt.Errorf("Volume type not supported")
+		return false, Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	return false, nil
@@ -647,7 +660,7 @@ func (d *cephfs) UnmountVolume(volType VolumeType, volName string, op *operation
 
 func (d *cephfs) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
 	if volType != VolumeTypeCustom {
-		return false, fmt.Errorf("Volume type not supported")
+		return false, Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	return false, nil
@@ -655,7 +668,7 @@ func (d *cephfs) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName
 
 func (d *cephfs) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapshotName string, op *operations.Operation) error {
 	if volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	// Create the snapshot.
@@ -684,7 +697,7 @@ func (d *cephfs) CreateVolumeSnapshot(volType VolumeType, volName string, newSna
 
 func (d *cephfs) DeleteVolumeSnapshot(volType VolumeType, volName string, snapshotName string, op *operations.Operation) error {
 	if volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	// Delete the snapshot itself.
@@ -708,7 +721,7 @@ func (d *cephfs) DeleteVolumeSnapshot(volType VolumeType, volName string, snapsh
 
 func (d *cephfs) RenameVolumeSnapshot(volType VolumeType, volName string, snapshotName string, newSnapshotName string, op *operations.Operation) error {
 	if volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	sourcePath := GetVolumeMountPath(d.name, volType, volName)
@@ -738,7 +751,7 @@ func (d *cephfs) RenameVolumeSnapshot(volType VolumeType, volName string, snapsh
 
 func (d *cephfs) VolumeSnapshots(volType VolumeType, volName string, op *operations.Operation) ([]string, error) {
 	if volType != VolumeTypeCustom {
-		return nil, fmt.Errorf("Volume type not supported")
+		return nil, Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	snapshotDir, err := GetVolumeSnapshotDir(d.name, volType, volName)
@@ -774,7 +787,11 @@ func (d *cephfs) VolumeSnapshots(volType VolumeType, volName string, op *operati
 	return snapshots, nil
 }
 
-func (d *cephfs) RestoreVolume(vol Volume, snapshotName string, op *operations.Operation) error {
+func (d *cephfs) RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error {
+	if vol.volType != VolumeTypeCustom {
+		return Errorf(ErrNotSupported, "Volume type not supported")
+	}
+
 	sourcePath := GetVolumeMountPath(d.name, vol.volType, vol.name)
 	cephSnapPath := filepath.Join(sourcePath, ".snap", snapshotName)
 
@@ -790,15 +807,15 @@ func (d *cephfs) RestoreVolume(vol Volume, snapshotName string, op *operations.O
 
 func (d *cephfs) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
 	if vol.volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	if vol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	if volSrcArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
-		return fmt.Errorf("Migration type not supported")
+		return Errorf(ErrNotSupported, "Migration type not supported")
 	}
 
 	bwlimit := d.config["rsync.bwlimit"]
@@ -838,15 +855,15 @@ func (d *cephfs) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs m
 
 func (d *cephfs) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
 	if vol.volType != VolumeTypeCustom {
-		return fmt.Errorf("Volume type not supported")
+		return Errorf(ErrNotSupported, "Volume type not supported")
 	}
 
 	if vol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	if volTargetArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
-		return fmt.Errorf("Migration type not supported")
+		return Errorf(ErrNotSupported, "Migration type not supported")
 	}
 
 	// Create the main volume path.
@@ -935,6 +952,7 @@ func (d *cephfs) getConfig(clusterName string, userName string) ([]string, strin
 	if err != nil {
 		return nil, "", err
 	}
+	defer cephConf.Close()
 
 	cephMon := []string{}
 
@@ -970,6 +988,7 @@ func (d *cephfs) getConfig(clusterName string, userName string) ([]string, strin
 	if err != nil {
 		return nil, "", err
 	}
+	defer cephKeyring.Close()
 
 	var cephSecret string
 
@@ -2,23 +2,32 @@ package drivers
 
 import (
 	"fmt"
+	"io"
+	"path/filepath"
 	"strings"
 
 	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
+	"github.com/lxc/lxd/shared/ioprogress"
 	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/units"
 )
 
 type common struct {
 	name           string
 	config         map[string]string
 	getVolID       func(volType VolumeType, volName string) (int64, error)
-	getCommonRules func() map[string]func(string) error
+	getCommonRules func(vol Volume) map[string]func(string) error
 	state          *state.State
 	logger         logger.Logger
 }
 
-func (d *common) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func() map[string]func(string) error) error {
+func (d *common) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error {
 	d.name = name
 	d.config = config
 	d.getVolID = volIDFunc
@@ -33,6 +42,11 @@ func (d *common) load() error {
 	return nil
 }
 
+// Config returns the configuration of the storage pool.
+func (d *common) Config() map[string]string {
+	return d.config
+}
+
 // validateVolume validates a volume config against common rules and optional driver specific rules.
 // This functions has a removeUnknownKeys option that if set to true will remove any unknown fields
 // (excluding those starting with "user.") which can be used when translating a volume config to a
@@ -41,7 +55,7 @@ func (d *common) validateVolume(vol Volume, driverRules map[string]func(value st
 	checkedFields := map[string]struct{}{}
 
 	// Get rules common for all drivers.
-	rules := d.getCommonRules()
+	rules := d.getCommonRules(vol)
 
 	// Merge driver specific rules into common rules.
 	for field, validator := range driverRules {
@@ -79,17 +93,222 @@ func (d *common) validateVolume(vol Volume, driverRules map[string]func(value st
 	return nil
 }
 
+// IgnoredVolumeKeys returns no keys, drivers apply all the keys of a valid volume config unless they
+// say otherwise.
+func (d *common) IgnoredVolumeKeys(vol Volume) map[string]string {
+	return nil
+}
+
 // MigrationType returns the type of transfer methods to be used when doing migrations between pools
 // in preference order.
 func (d *common) MigrationTypes(contentType ContentType) []migration.Type {
-	if contentType != ContentTypeFS {
+	features := []string{"xattrs", "delete", "compress", "bidirectional"}
+
+	switch contentType {
+	case ContentTypeFS:
+	case ContentTypeBlock:
+		// Block volumes have their disk image sent separately, skipping any holes in it, and
+		// can be sent while in use.
+		features = append(features, "sparse", "live_block")
+	default:
 		return nil
 	}
 
 	return []migration.Type{
 		{
 			FSType:   migration.MigrationFSType_RSYNC,
-			Features: []string{"xattrs", "delete", "compress", "bidirectional"},
+			Features: features,
 		},
 	}
 }
+
+// sendVolume sends the content of a mounted volume. When the "sparse" feature was negotiated,
+// the disk image of a block volume is left out of the rsync transfer and sent separately with
+// its holes skipped. When the "live_block" feature was negotiated and a freeze function given,
+// the disk image is sent while in use and its changes are sent again once frozen.
+func (d *common) sendVolume(vol Volume, mountPath string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string, freeze func() error) error {
+	bwlimit := d.config["rsync.bwlimit"]
+	path := shared.AddSlash(mountPath)
+
+	if vol.contentType != ContentTypeBlock || !shared.StringInSlice("sparse", features) {
+		return rsync.Send(vol.name, path, conn, tracker, features, bwlimit, d.state.OS.ExecPath)
+	}
+
+	err := rsync.Send(vol.name, path, conn, tracker, features, bwlimit, d.state.OS.ExecPath, "--exclude", "/root.img")
+	if err != nil {
+		return err
+	}
+
+	return sendDiskImage(conn, filepath.Join(mountPath, "root.img"), tracker, features, freeze)
+}
+
+// recvVolume receives the content of a volume sent by sendVolume into its mount path.
+func (d *common) recvVolume(vol Volume, mountPath string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string) error {
+	path := shared.AddSlash(mountPath)
+
+	err := rsync.Recv(path, conn, tracker, features)
+	if err != nil {
+		return wrapInsufficientSpace(err)
+	}
+
+	if vol.contentType != ContentTypeBlock || !shared.StringInSlice("sparse", features) {
+		return nil
+	}
+
+	return wrapInsufficientSpace(recvSparseFile(conn, filepath.Join(mountPath, "root.img"), tracker))
+}
+
+// copyVolume copies the content of a volume directory using rsync. The disk image of block volumes
+// is left out of the rsync transfer and copied separately with its holes skipped. The progress of
+// each of the transfers is reported as a percentage to the progress function, if any.
+func (d *common) copyVolume(srcPath string, dstPath string, contentType ContentType, progress func(int64, int64)) (string, error) {
+	bwlimit := d.config["rsync.bwlimit"]
+
+	if contentType != ContentTypeBlock {
+		output, err := rsync.LocalCopyProgress(srcPath, dstPath, bwlimit, true, progress)
+		return output, wrapInsufficientSpace(err)
+	}
+
+	output, err := rsync.LocalCopy(srcPath, dstPath, bwlimit, true, "--exclude", "/root.img")
+	if err != nil {
+		return output, wrapInsufficientSpace(err)
+	}
+
+	srcImg := filepath.Join(srcPath, "root.img")
+	if !shared.PathExists(srcImg) {
+		return output, nil
+	}
+
+	return output, wrapInsufficientSpace(copySparseFile(srcImg, filepath.Join(dstPath, "root.img"), progress))
+}
+
+// copyProgress returns the function reporting the progress of a local copy of the volume with the
+// given name to the operation, or nil if there's no operation.
+func copyProgress(op *operations.Operation, volName string) func(int64, int64) {
+	return migration.ProgressPercentHandler(op, "fs_progress", volName)
+}
+
+// CompactVolume punches holes in the zeroed ranges of the disk image of a block volume stored as a
+// file. Disks which are block devices are left alone, the discards of the guest already release the
+// space they were using.
+func (d *common) CompactVolume(vol Volume, op *operations.Operation) error {
+	if vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Only block volumes can be compacted")
+	}
+
+	return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		diskPath, _, err := vol.GetDiskPath()
+		if err != nil {
+			return err
+		}
+
+		if !shared.PathExists(diskPath) || shared.IsBlockdevPath(diskPath) {
+			return nil
+		}
+
+		_, err = shared.RunCommand("fallocate", "--dig-holes", diskPath)
+		return err
+	}, op)
+}
+
+// CheckVolume isn't supported by default, the drivers which can check their volumes override it.
+func (d *common) CheckVolume(vol Volume, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	return nil, Errorf(ErrNotSupported, "The volumes of storage pool %q can't be checked", d.name)
+}
+
+// growBlockFile grows the disk image of a block volume stored as a file to the given size, or to the
+// default volume size of the pool when none is given.
+func (d *common) growBlockFile(vol Volume, size string) error {
+	if size == "" || size == "0" {
+		size = d.config["volume.size"]
+	}
+
+	if size == "" || size == "0" {
+		return nil
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	diskPath, _, err := vol.GetDiskPath()
+	if err != nil {
+		return err
+	}
+
+	return growDiskImage(diskPath, sizeBytes)
+}
+
+// RefreshVolume brings an existing filesystem volume up to date with another volume, possibly of
+// another pool. The content of each of the given snapshots of the source volume is synced into the
+// volume and snapshotted, oldest first, before the content of the volume itself is synced. Drivers
+// able to transfer only the differences between snapshots override it.
+func (d *common) RefreshVolume(vol Volume, srcVol Volume, srcSnapshots []string, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS || srcVol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be refreshed")
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		for _, snapName := range revertSnaps {
+			vol.driver.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+	}()
+
+	err := vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		for _, snapName := range srcSnapshots {
+			srcSnapshot, err := srcVol.NewSnapshot(snapName)
+			if err != nil {
+				return err
+			}
+
+			err = srcSnapshot.MountTask(func(srcMountPath string, op *operations.Operation) error {
+				_, err := d.copyVolume(srcMountPath, mountPath, vol.contentType, copyProgress(op, srcSnapshot.name))
+				return err
+			}, op)
+			if err != nil {
+				return err
+			}
+
+			err = vol.driver.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+			if err != nil {
+				return err
+			}
+
+			revertSnaps = append(revertSnaps, snapName)
+		}
+
+		return srcVol.MountTask(func(srcMountPath string, op *operations.Operation) error {
+			_, err := d.copyVolume(srcMountPath, mountPath, vol.contentType, copyProgress(op, srcVol.name))
+			return err
+		}, op)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// BackupVolume writes the content of a filesystem volume and of the given snapshots to the
+// tarball. Drivers having a binary format of their own override it to write optimized backups.
+func (d *common) BackupVolume(vol Volume, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error {
+	if optimized {
+		return Errorf(ErrNotSupported, "Optimized backups not supported")
+	}
+
+	return genericBackupVolume(vol, tarWriter, snapshots, op)
+}
+
+// CreateVolumeFromBackup creates a filesystem volume and the given snapshots from a backup
+// written by BackupVolume.
+func (d *common) CreateVolumeFromBackup(vol Volume, snapshots []string, srcData io.ReadSeeker, optimized bool, op *operations.Operation) error {
+	if optimized {
+		return Errorf(ErrNotSupported, "Optimized backups not supported")
+	}
+
+	return genericCreateVolumeFromBackup(vol, snapshots, srcData, op)
+}
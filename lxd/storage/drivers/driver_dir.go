@@ -6,13 +6,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
-	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/storage/quota"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
@@ -36,6 +36,9 @@ func (d *dir) Info() Info {
 		VolumeTypes:        []VolumeType{VolumeTypeCustom, VolumeTypeImage, VolumeTypeContainer, VolumeTypeVM},
 		BlockBacking:       false,
 		RunningQuotaResize: true,
+		InstantClones:      false,
+		RunningCopyFreeze:  true,
+		OptimizedBackups:   false,
 	}
 }
 
@@ -128,16 +131,27 @@ func (d *dir) GetResources() (*api.ResourcesStoragePool, error) {
 	return vfsResources(GetPoolMountPath(d.name))
 }
 
-// GetVolumeUsage returns the disk space used by the volume.
-func (d *dir) GetVolumeUsage(volType VolumeType, volName string) (int64, error) {
-	volPath := GetVolumeMountPath(d.name, volType, volName)
+// GetVolumeUsage returns the disk space used by the volume, as accounted by its project quota or
+// counted by du when the backing filesystem doesn't support project quotas.
+func (d *dir) GetVolumeUsage(vol Volume) (int64, error) {
+	volPath := vol.MountPath()
 	ok, err := quota.Supported(volPath)
 	if err != nil || !ok {
-		return 0, nil
+		out, err := shared.RunCommand("du", "-s", "-x", "-B1", volPath)
+		if err != nil {
+			return -1, err
+		}
+
+		fields := strings.Fields(out)
+		if len(fields) == 0 {
+			return -1, fmt.Errorf("Unexpected output from du command")
+		}
+
+		return strconv.ParseInt(fields[0], 10, 64)
 	}
 
 	// Get the volume ID for the volume to access quota.
-	volID, err := d.getVolID(volType, volName)
+	volID, err := d.getVolID(vol.volType, vol.name)
 	if err != nil {
 		return -1, err
 	}
@@ -158,6 +172,21 @@ func (d *dir) ValidateVolume(vol Volume, removeUnknownKeys bool) error {
 	return d.validateVolume(vol, nil, removeUnknownKeys)
 }
 
+// IgnoredVolumeKeys returns the size of filesystem volumes when the backing filesystem of the pool
+// doesn't support project quotas, as setQuota then skips it.
+func (d *dir) IgnoredVolumeKeys(vol Volume) map[string]string {
+	if vol.contentType != ContentTypeFS || vol.config["size"] == "" || vol.config["size"] == "0" {
+		return nil
+	}
+
+	ok, err := quota.Supported(GetPoolMountPath(d.name))
+	if err == nil && ok {
+		return nil
+	}
+
+	return map[string]string{"size": "The backing filesystem doesn't support project quotas"}
+}
+
 // HasVolume indicates whether a specific volume exists on the storage pool.
 func (d *dir) HasVolume(volType VolumeType, volName string) bool {
 	if shared.PathExists(GetVolumeMountPath(d.name, volType, volName)) {
@@ -271,16 +300,14 @@ func (d *dir) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath stri
 
 // MigrateVolume sends a volume for migration.
 func (d *dir) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
-	if vol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	if volSrcArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
-		return fmt.Errorf("Migration type not supported")
+		return Errorf(ErrNotSupported, "Migration type not supported")
 	}
 
-	bwlimit := d.config["rsync.bwlimit"]
-
 	for _, snapName := range volSrcArgs.Snapshots {
 		snapshot, err := vol.NewSnapshot(snapName)
 		if err != nil {
@@ -294,8 +321,7 @@ func (d *dir) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migr
 				wrapper = migration.ProgressTracker(op, "fs_progress", snapshot.name)
 			}
 
-			path := shared.AddSlash(mountPath)
-			return rsync.Send(snapshot.name, path, conn, wrapper, volSrcArgs.MigrationType.Features, bwlimit, d.state.OS.ExecPath)
+			return d.sendVolume(snapshot, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, nil)
 		}, op)
 		if err != nil {
 			return err
@@ -309,19 +335,18 @@ func (d *dir) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migr
 			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
 		}
 
-		path := shared.AddSlash(mountPath)
-		return rsync.Send(vol.name, path, conn, wrapper, volSrcArgs.MigrationType.Features, bwlimit, d.state.OS.ExecPath)
+		return d.sendVolume(vol, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, volSrcArgs.Freeze)
 	}, op)
 }
 
 // CreateVolumeFromMigration creates a volume being sent via a migration.
 func (d *dir) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
-	if vol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	if volTargetArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
-		return fmt.Errorf("Migration type not supported")
+		return Errorf(ErrNotSupported, "Migration type not supported")
 	}
 
 	// Get the volume ID for the new volumes, which is used to set project quota.
@@ -354,8 +379,6 @@ func (d *dir) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, vol
 
 	// Ensure the volume is mounted.
 	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
-		path := shared.AddSlash(mountPath)
-
 		// Snapshots are sent first by the sender, so create these first.
 		for _, snapName := range volTargetArgs.Snapshots {
 			// Receive the snapshot
@@ -364,7 +387,7 @@ func (d *dir) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, vol
 				wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
 			}
 
-			err = rsync.Recv(path, conn, wrapper, volTargetArgs.MigrationType.Features)
+			err = d.recvVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
 			if err != nil {
 				return err
 			}
@@ -379,16 +402,19 @@ func (d *dir) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, vol
 			revertSnaps = append(revertSnaps, snapName)
 		}
 
-		// Initialise the volume's quota using the volume ID.
-		err = d.initQuota(volPath, volID)
-		if err != nil {
-			return err
-		}
+		// Block volumes don't use project quotas as their disk image has a fixed size.
+		if vol.contentType == ContentTypeFS {
+			// Initialise the volume's quota using the volume ID.
+			err = d.initQuota(volPath, volID)
+			if err != nil {
+				return err
+			}
 
-		// Set the quota if specified in volConfig or pool config.
-		err = d.setQuota(volPath, volID, vol.config["size"])
-		if err != nil {
-			return err
+			// Set the quota if specified in volConfig or pool config.
+			err = d.setQuota(volPath, volID, vol.config["size"])
+			if err != nil {
+				return err
+			}
 		}
 
 		// Receive the main volume from sender.
@@ -397,7 +423,7 @@ func (d *dir) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, vol
 			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
 		}
 
-		return rsync.Recv(path, conn, wrapper, volTargetArgs.MigrationType.Features)
+		return d.recvVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
 	}, op)
 	if err != nil {
 		return err
@@ -409,12 +435,10 @@ func (d *dir) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, vol
 
 // CreateVolumeFromCopy provides same-pool volume copying functionality.
 func (d *dir) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
-	if vol.contentType != ContentTypeFS || srcVol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+	if vol.contentType != srcVol.contentType || (vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock) {
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
-	bwlimit := d.config["rsync.bwlimit"]
-
 	// Get the volume ID for the new volumes, which is used to set project quota.
 	volID, err := d.getVolID(vol.volType, vol.name)
 	if err != nil {
@@ -459,7 +483,7 @@ func (d *dir) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool
 				// Mount the source snapshot.
 				err = srcSnapshot.MountTask(func(srcMountPath string, op *operations.Operation) error {
 					// Copy the snapshot.
-					_, err = rsync.LocalCopy(srcMountPath, mountPath, bwlimit, true)
+					_, err = d.copyVolume(srcMountPath, mountPath, vol.contentType, copyProgress(op, srcSnapshot.name))
 					return err
 				}, op)
 
@@ -474,21 +498,24 @@ func (d *dir) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool
 			}
 		}
 
-		// Initialise the volume's quota using the volume ID.
-		err = d.initQuota(volPath, volID)
-		if err != nil {
-			return err
-		}
+		// Block volumes don't use project quotas as their disk image has a fixed size.
+		if vol.contentType == ContentTypeFS {
+			// Initialise the volume's quota using the volume ID.
+			err = d.initQuota(volPath, volID)
+			if err != nil {
+				return err
+			}
 
-		// Set the quota if specified in volConfig or pool config.
-		err = d.setQuota(volPath, volID, vol.config["size"])
-		if err != nil {
-			return err
+			// Set the quota if specified in volConfig or pool config.
+			err = d.setQuota(volPath, volID, vol.config["size"])
+			if err != nil {
+				return err
+			}
 		}
 
 		// Copy source to destination (mounting each volume if needed).
 		return srcVol.MountTask(func(srcMountPath string, op *operations.Operation) error {
-			_, err := rsync.LocalCopy(srcMountPath, mountPath, bwlimit, true)
+			_, err := d.copyVolume(srcMountPath, mountPath, vol.contentType, copyProgress(op, srcVol.name))
 			return err
 		}, op)
 	}, op)
@@ -537,18 +564,13 @@ func (d *dir) VolumeSnapshots(volType VolumeType, volName string, op *operations
 
 // UpdateVolume applies config changes to the volume.
 func (d *dir) UpdateVolume(vol Volume, changedConfig map[string]string) error {
-	if vol.contentType != ContentTypeFS {
-		return fmt.Errorf("Content type not supported")
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
 	}
 
 	if _, changed := changedConfig["size"]; changed {
-		volID, err := d.getVolID(vol.volType, vol.name)
-		if err != nil {
-			return err
-		}
-
 		// Set the quota if specified in volConfig or pool config.
-		err = d.setQuota(vol.MountPath(), volID, changedConfig["size"])
+		err := d.SetVolumeQuota(vol.volType, vol.name, changedConfig["size"], nil)
 		if err != nil {
 			return err
 		}
@@ -640,19 +662,18 @@ func (d *dir) RenameVolume(volType VolumeType, volName string, newVolName string
 }
 
 // RestoreVolume restores a volume from a snapshot.
-func (d *dir) RestoreVolume(vol Volume, snapshotName string, op *operations.Operation) error {
+func (d *dir) RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error {
 	srcPath := GetVolumeMountPath(d.name, vol.volType, GetSnapshotVolumeName(vol.name, snapshotName))
 	if !shared.PathExists(srcPath) {
-		return fmt.Errorf("Snapshot not found")
+		return Errorf(ErrNotFound, "Snapshot not found")
 	}
 
 	volPath := vol.MountPath()
 
 	// Restore using rsync.
-	bwlimit := d.config["rsync.bwlimit"]
-	output, err := rsync.LocalCopy(srcPath, volPath, bwlimit, true)
+	output, err := d.copyVolume(srcPath, volPath, vol.contentType, copyProgress(op, vol.name))
 	if err != nil {
-		return fmt.Errorf("Failed to rsync volume: %s: %s", string(output), err)
+		return wrapInsufficientSpace(fmt.Errorf("Failed to rsync volume: %s: %s", string(output), err))
 	}
 
 	return nil
@@ -667,7 +688,7 @@ func (d *dir) DeleteVolume(volType VolumeType, volName string, op *operations.Op
 	}
 
 	if len(snapshots) > 0 {
-		return fmt.Errorf("Cannot remove a volume that has snapshots")
+		return Errorf(ErrInUse, "Cannot remove a volume that has snapshots")
 	}
 
 	volPath := GetVolumeMountPath(d.name, volType, volName)
@@ -729,7 +750,7 @@ func (d *dir) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName st
 	return forceUnmount(snapPath)
 }
 
-// SetVolumeQuota sets the quota on the volume.
+// SetVolumeQuota sets the quota on the volume, growing the disk image of block volumes first.
 func (d *dir) SetVolumeQuota(volType VolumeType, volName, size string, op *operations.Operation) error {
 	volPath := GetVolumeMountPath(d.name, volType, volName)
 	volID, err := d.getVolID(volType, volName)
@@ -737,6 +758,15 @@ func (d *dir) SetVolumeQuota(volType VolumeType, volName, size string, op *opera
 		return err
 	}
 
+	blockVol := NewVolume(d, d.name, volType, ContentTypeBlock, volName, nil)
+	diskPath, _, err := blockVol.GetDiskPath()
+	if err == nil && shared.PathExists(diskPath) {
+		err = d.growBlockFile(blockVol, size)
+		if err != nil {
+			return err
+		}
+	}
+
 	return d.setQuota(volPath, volID, size)
 }
 
@@ -790,6 +820,16 @@ func (d *dir) setQuota(path string, volID int64, size string) error {
 		return nil
 	}
 
+	usedBytes, err := quota.GetProjectUsage(path, d.quotaProjectID(volID))
+	if err != nil {
+		return err
+	}
+
+	err = checkQuotaAboveUsage(sizeBytes, usedBytes)
+	if err != nil {
+		return err
+	}
+
 	err = quota.SetProjectQuota(path, d.quotaProjectID(volID), sizeBytes)
 	if err != nil {
 		return err
@@ -827,6 +867,12 @@ func (d *dir) deleteQuota(path string, volID int64) error {
 func (d *dir) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapshotName string, op *operations.Operation) error {
 	srcPath := GetVolumeMountPath(d.name, volType, volName)
 	fullSnapName := GetSnapshotVolumeName(volName, newSnapshotName)
+
+	contentType := ContentTypeFS
+	if volType == VolumeTypeVM {
+		contentType = ContentTypeBlock
+	}
+
 	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, fullSnapName, nil)
 	snapPath := snapVol.MountPath()
 
@@ -843,10 +889,8 @@ func (d *dir) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapsh
 		}
 	}()
 
-	bwlimit := d.config["rsync.bwlimit"]
-
 	// Copy volume into snapshot directory.
-	_, err = rsync.LocalCopy(srcPath, snapPath, bwlimit, true)
+	_, err = d.copyVolume(srcPath, snapPath, contentType, copyProgress(op, fullSnapName))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,431 @@
+package drivers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/units"
+)
+
+var lvmVersion string
+var lvmLoaded bool
+
+// lvmDefaultThinPoolName is the name of the thin pool used when lvm.thinpool_name isn't set.
+const lvmDefaultThinPoolName = "LXDThinPool"
+
+// lvmDefaultVolumeSize is the size of volumes when none is configured.
+const lvmDefaultVolumeSize = "10GB"
+
+// lvmBlockVolSuffix is appended to the name of the logical volume holding the filesystem of a
+// block volume to get the name of the logical volume holding its disk image.
+const lvmBlockVolSuffix = ".block"
+
+// lvmBlockFSSize is the size of the filesystem holding the files of a block volume next to its
+// disk image.
+const lvmBlockFSSize = "100MB"
+
+type lvm struct {
+	common
+}
+
+// init sets up the driver, then loads it. The load() call in common.init() doesn't reach the
+// load() function of the LVM driver.
+func (d *lvm) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error {
+	err := d.common.init(state, name, config, logger, volIDFunc, commonRulesFunc)
+	if err != nil {
+		return err
+	}
+
+	return d.load()
+}
+
+func (d *lvm) load() error {
+	if lvmLoaded {
+		return nil
+	}
+
+	// Validate the required binaries.
+	_, err := exec.LookPath("lvm")
+	if err != nil {
+		return fmt.Errorf("Required tool 'lvm' is missing")
+	}
+
+	// Detect and record the version.
+	if lvmVersion == "" {
+		version, err := d.version()
+		if err != nil {
+			return err
+		}
+
+		lvmVersion = version
+	}
+
+	lvmLoaded = true
+	return nil
+}
+
+// version returns the versions of the LVM tools, library and driver, separated by slashes.
+func (d *lvm) version() (string, error) {
+	out, err := shared.RunCommand("lvm", "version")
+	if err != nil {
+		return "", fmt.Errorf("The 'lvm' tool isn't working properly")
+	}
+
+	versions := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) < 2 || !strings.Contains(fields[0], "version") {
+			continue
+		}
+
+		versions = append(versions, strings.TrimSpace(fields[1]))
+	}
+
+	if len(versions) == 0 {
+		return "", fmt.Errorf("Could not determine LVM version")
+	}
+
+	return strings.Join(versions, " / "), nil
+}
+
+// Info returns info about the driver and its environment.
+func (d *lvm) Info() Info {
+	return Info{
+		Name:               "lvm",
+		Version:            lvmVersion,
+		OptimizedImages:    d.useThinPool(),
+		PreservesInodes:    false,
+		Remote:             false,
+		VolumeTypes:        []VolumeType{VolumeTypeCustom, VolumeTypeImage, VolumeTypeContainer, VolumeTypeVM},
+		BlockBacking:       true,
+		RunningQuotaResize: false,
+		InstantClones:      d.useThinPool(),
+		RunningCopyFreeze:  !d.useThinPool(),
+		OptimizedBackups:   false,
+	}
+}
+
+// Create creates the volume group (on a loop file or a block device) or checks that the existing
+// one to be used is empty, then creates the thin pool if needed.
+func (d *lvm) Create() error {
+	// WARNING: The Create() function cannot rely on any of the struct attributes being set.
+
+	// Store the provided source as we are likely to be mangling it.
+	d.config["volatile.initial_source"] = d.config["source"]
+
+	// Undo the changes in reverse order on failure.
+	reverts := []func(){}
+	defer func() {
+		for i := len(reverts) - 1; i >= 0; i-- {
+			reverts[i]()
+		}
+	}()
+
+	pvName := ""
+	loopPath := d.loopFilePath()
+	if d.config["source"] == "" || d.config["source"] == loopPath {
+		// Create a loop based pool.
+		d.config["source"] = loopPath
+
+		if d.config["lvm.vg_name"] == "" {
+			d.config["lvm.vg_name"] = d.name
+		}
+
+		size, err := units.ParseByteSizeString(d.config["size"])
+		if err != nil {
+			return err
+		}
+
+		err = createSparseFile(loopPath, size)
+		if err != nil {
+			return err
+		}
+
+		reverts = append(reverts, func() { os.Remove(loopPath) })
+
+		pvName, err = d.attachLoopFile()
+		if err != nil {
+			return err
+		}
+
+		reverts = append(reverts, func() { d.detachLoopFile() })
+	} else if filepath.IsAbs(d.config["source"]) {
+		// Unset size property since it doesn't make sense.
+		d.config["size"] = ""
+
+		if !shared.IsBlockdevPath(d.config["source"]) {
+			return Errorf(ErrNotSupported, "Custom loop file locations are not supported")
+		}
+
+		if d.config["lvm.vg_name"] == "" {
+			d.config["lvm.vg_name"] = d.name
+		}
+
+		pvName = d.config["source"]
+
+		// The path of the block device may change, so only record the name of the volume group.
+		d.config["source"] = d.config["lvm.vg_name"]
+	} else {
+		// Unset size property since it doesn't make sense.
+		d.config["size"] = ""
+
+		if d.config["lvm.vg_name"] != "" && d.config["lvm.vg_name"] != d.config["source"] {
+			return fmt.Errorf("Invalid combination of \"source\" and \"lvm.vg_name\" property")
+		}
+
+		d.config["lvm.vg_name"] = d.config["source"]
+	}
+
+	vgName := d.vgName()
+
+	vgExists, err := d.volumeGroupExists(vgName)
+	if err != nil {
+		return err
+	}
+
+	if pvName == "" {
+		// Use the existing volume group, provided it's empty (aside from the thin pool).
+		if !vgExists {
+			return Errorf(ErrNotFound, "The requested volume group %q doesn't exist", vgName)
+		}
+
+		lvNames, err := d.logicalVolumes()
+		if err != nil {
+			return err
+		}
+
+		for _, lvName := range lvNames {
+			if d.useThinPool() && lvName == d.thinPoolName() {
+				continue
+			}
+
+			return fmt.Errorf("Volume group %q isn't empty", vgName)
+		}
+	} else {
+		if vgExists {
+			return fmt.Errorf("Volume group %q already exists", vgName)
+		}
+
+		pvExists, err := d.physicalVolumeExists(pvName)
+		if err != nil {
+			return err
+		}
+
+		if !pvExists {
+			_, err := shared.TryRunCommand("pvcreate", pvName)
+			if err != nil {
+				return fmt.Errorf("Failed to create LVM physical volume %q: %v", pvName, err)
+			}
+
+			reverts = append(reverts, func() { shared.TryRunCommand("pvremove", pvName) })
+		}
+
+		_, err = shared.TryRunCommand("vgcreate", vgName, pvName)
+		if err != nil {
+			return fmt.Errorf("Failed to create LVM volume group %q: %v", vgName, err)
+		}
+
+		reverts = append(reverts, func() { shared.TryRunCommand("vgremove", "-f", vgName) })
+	}
+
+	if d.useThinPool() {
+		err = d.ensureThinPool()
+		if err != nil {
+			return err
+		}
+	}
+
+	reverts = nil
+	return nil
+}
+
+// Delete removes the thin pool and, if nothing else is left in it, the volume group. The loop
+// file of loop based pools is removed too.
+func (d *lvm) Delete(op *operations.Operation) error {
+	vgName := d.vgName()
+
+	// Make sure the loop device (if any) is attached, so that the volume group can be removed.
+	_, err := d.Mount()
+	if err != nil {
+		return err
+	}
+
+	vgExists, err := d.volumeGroupExists(vgName)
+	if err != nil {
+		return err
+	}
+
+	if vgExists {
+		if d.useThinPool() {
+			thinPoolExists, err := d.thinPoolExists()
+			if err != nil {
+				return err
+			}
+
+			if thinPoolExists {
+				err = d.removeLogicalVolume(d.thinPoolName())
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Leave the volume group alone if something else still uses it.
+		lvNames, err := d.logicalVolumes()
+		if err != nil {
+			return err
+		}
+
+		if len(lvNames) == 0 {
+			_, err := shared.TryRunCommand("vgremove", "-f", vgName)
+			if err != nil {
+				return fmt.Errorf("Failed to delete LVM volume group %q: %v", vgName, err)
+			}
+		}
+	}
+
+	// Delete the loop file if any.
+	loopPath := d.loopFilePath()
+	if d.config["source"] == loopPath {
+		loopDevs, err := d.loopDevices()
+		if err != nil {
+			return err
+		}
+
+		for _, loopDev := range loopDevs {
+			shared.TryRunCommand("pvremove", "-f", loopDev)
+		}
+
+		err = d.detachLoopFile()
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(loopPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// On delete, wipe everything in the directory.
+	err = wipeDirectory(GetPoolMountPath(d.name))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Mount attaches the loop file of loop based pools and activates the volume group, returning true
+// if the loop file was attached.
+func (d *lvm) Mount() (bool, error) {
+	ourMount := false
+
+	if d.config["source"] == d.loopFilePath() {
+		loopDevs, err := d.loopDevices()
+		if err != nil {
+			return false, err
+		}
+
+		if len(loopDevs) == 0 {
+			_, err = d.attachLoopFile()
+			if err != nil {
+				return false, err
+			}
+
+			ourMount = true
+		}
+	}
+
+	vgName := d.vgName()
+
+	vgExists, err := d.volumeGroupExists(vgName)
+	if err != nil {
+		return false, err
+	}
+
+	if !vgExists {
+		// Nothing to activate yet while the pool is being deleted after a failed creation.
+		return ourMount, nil
+	}
+
+	_, err = shared.TryRunCommand("vgchange", "-ay", vgName)
+	if err != nil {
+		return false, fmt.Errorf("Failed to activate LVM volume group %q: %v", vgName, err)
+	}
+
+	return ourMount, nil
+}
+
+// Unmount leaves the volume group active and the loop file attached, as the volumes may still be
+// in use.
+func (d *lvm) Unmount() (bool, error) {
+	return false, nil
+}
+
+// GetResources returns the space used and available in the thin pool or volume group. Logical
+// volumes use the space of their whole size, so inodes aren't reported.
+func (d *lvm) GetResources() (*api.ResourcesStoragePool, error) {
+	res := api.ResourcesStoragePool{}
+
+	if d.useThinPool() {
+		out, err := shared.TryRunCommand("lvs", "--noheadings", "--units", "b", "--nosuffix", "--separator", ",", "-o", "lv_size,data_percent", fmt.Sprintf("%s/%s", d.vgName(), d.thinPoolName()))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get usage of LVM thin pool: %v", err)
+		}
+
+		fields := strings.Split(strings.TrimSpace(out), ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Unexpected output from lvs command")
+		}
+
+		size, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		percent, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Space.Total = size
+		res.Space.Used = uint64(float64(size) * percent / 100)
+
+		return &res, nil
+	}
+
+	out, err := shared.TryRunCommand("vgs", "--noheadings", "--units", "b", "--nosuffix", "--separator", ",", "-o", "vg_size,vg_free", d.vgName())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get usage of LVM volume group: %v", err)
+	}
+
+	fields := strings.Split(strings.TrimSpace(out), ",")
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("Unexpected output from vgs command")
+	}
+
+	size, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Space.Total = size
+	res.Space.Used = size - free
+
+	return &res, nil
+}
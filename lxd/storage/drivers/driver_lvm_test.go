@@ -0,0 +1,103 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the names of the volume group and thin pool, from the pool config.
+func TestLVMPoolNames(t *testing.T) {
+	d := &lvm{common{name: "default", config: map[string]string{}}}
+	assert.Equal(t, "default", d.vgName())
+	assert.Equal(t, lvmDefaultThinPoolName, d.thinPoolName())
+
+	// An existing volume group can be given as source, unlike a block device.
+	d.config["source"] = "/dev/sdb"
+	assert.Equal(t, "default", d.vgName())
+
+	d.config["source"] = "vg0"
+	assert.Equal(t, "vg0", d.vgName())
+
+	d.config["lvm.vg_name"] = "vg1"
+	d.config["lvm.thinpool_name"] = "pool0"
+	assert.Equal(t, "vg1", d.vgName())
+	assert.Equal(t, "pool0", d.thinPoolName())
+}
+
+// Test the names and device paths of the logical volumes of volumes.
+func TestLVMLVName(t *testing.T) {
+	d := &lvm{common{name: "default", config: map[string]string{"lvm.vg_name": "vg0"}}}
+
+	assert.Equal(t, "containers_c1", d.lvName(VolumeTypeContainer, "c1", false))
+	assert.Equal(t, "virtual-machines_v1.block", d.lvName(VolumeTypeVM, "v1", true))
+	assert.Equal(t, "/dev/vg0/containers_c1", d.lvDevPath(d.lvName(VolumeTypeContainer, "c1", false)))
+
+	// Hyphens are doubled, so a snapshot can't be mistaken for a volume.
+	assert.Equal(t, "custom_my--vol-snap0", d.lvName(VolumeTypeCustom, "my-vol/snap0", false))
+	assert.Equal(t, "custom_my-vol--snap0", d.lvName(VolumeTypeCustom, "my/vol-snap0", false))
+
+	// Block volumes have a logical volume for their disk image along with their filesystem.
+	vol := NewVolume(d, "default", VolumeTypeVM, ContentTypeFS, "v1", nil)
+	assert.Equal(t, []string{"virtual-machines_v1"}, d.volumeLVNames(vol))
+
+	vol = NewVolume(d, "default", VolumeTypeVM, ContentTypeBlock, "v1", nil)
+	assert.Equal(t, []string{"virtual-machines_v1", "virtual-machines_v1.block"}, d.volumeLVNames(vol))
+}
+
+// Test the validation of the LVM specific volume keys.
+func TestLVMValidateVolume(t *testing.T) {
+	d := &lvm{common{name: "default", config: map[string]string{}, getCommonRules: testCommonRules}}
+
+	config := map[string]string{"block.filesystem": "xfs", "block.mount_options": "noatime", "size": "10GB"}
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+
+	config = map[string]string{"block.filesystem": "zfs"}
+	assert.Error(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+
+	config = map[string]string{"zfs.atime": "off"}
+	assert.Error(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+}
+
+// Test the size, filesystem and mount options of volumes, from the volume or pool config.
+func TestLVMVolumeDefaults(t *testing.T) {
+	d := &lvm{common{name: "default", config: map[string]string{}}}
+
+	vol := NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", map[string]string{})
+	size, err := d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10000000000), size)
+	assert.Equal(t, "ext4", d.volumeFilesystem(vol))
+
+	d.config["volume.size"] = "5GB"
+	d.config["volume.block.filesystem"] = "xfs"
+	size, err = d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000000000), size)
+	assert.Equal(t, "xfs", d.volumeFilesystem(vol))
+
+	vol.config["size"] = "1GB"
+	vol.config["block.filesystem"] = "btrfs"
+	size, err = d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000000000), size)
+	assert.Equal(t, "btrfs", d.volumeFilesystem(vol))
+
+	// The filesystem of block volumes only holds their config, the disk image gets the size.
+	vol = NewVolume(d, "default", VolumeTypeVM, ContentTypeBlock, "v1", map[string]string{"size": "20GB"})
+	size, err = d.volumeSize(vol, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100000000), size)
+
+	size, err = d.volumeSize(vol, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20000000000), size)
+
+	// Snapshots of xfs filesystems share the UUID of their volume.
+	assert.Equal(t, "discard", d.mountOptions("ext4", true))
+	assert.Equal(t, "user_subvol_rm_allowed,discard", d.mountOptions("btrfs", false))
+	assert.Equal(t, "discard,nouuid", d.mountOptions("xfs", true))
+
+	d.config["volume.block.mount_options"] = "noatime,nouuid"
+	assert.Equal(t, "noatime,nouuid", d.mountOptions("xfs", true))
+}
@@ -0,0 +1,468 @@
+package drivers
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/units"
+	"github.com/lxc/lxd/shared/version"
+)
+
+// vgName returns the name of the volume group used by the pool.
+func (d *lvm) vgName() string {
+	if d.config["lvm.vg_name"] != "" {
+		return d.config["lvm.vg_name"]
+	}
+
+	if d.config["source"] != "" && !filepath.IsAbs(d.config["source"]) {
+		return d.config["source"]
+	}
+
+	return d.name
+}
+
+// useThinPool returns whether the volumes are thinly provisioned from a thin pool, which is the
+// default.
+func (d *lvm) useThinPool() bool {
+	return d.config["lvm.use_thinpool"] == "" || shared.IsTrue(d.config["lvm.use_thinpool"])
+}
+
+// thinPoolName returns the name of the thin pool used by the pool.
+func (d *lvm) thinPoolName() string {
+	if d.config["lvm.thinpool_name"] != "" {
+		return d.config["lvm.thinpool_name"]
+	}
+
+	return lvmDefaultThinPoolName
+}
+
+// loopFilePath returns the path of the loop file of loop based pools.
+func (d *lvm) loopFilePath() string {
+	return filepath.Join(shared.VarPath("disks"), fmt.Sprintf("%s.img", d.name))
+}
+
+// loopDevices returns the loop devices the pool's loop file is attached to.
+func (d *lvm) loopDevices() ([]string, error) {
+	out, err := shared.RunCommand("losetup", "--associated", d.loopFilePath(), "--noheadings", "--output", "NAME")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list loop devices of %q: %v", d.loopFilePath(), err)
+	}
+
+	return strings.Fields(out), nil
+}
+
+// attachLoopFile attaches the pool's loop file to a new loop device and returns its path.
+func (d *lvm) attachLoopFile() (string, error) {
+	out, err := shared.RunCommand("losetup", "--find", "--show", d.loopFilePath())
+	if err != nil {
+		return "", fmt.Errorf("Failed to set up loop device for %q: %v", d.loopFilePath(), err)
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// detachLoopFile detaches the pool's loop file from its loop devices.
+func (d *lvm) detachLoopFile() error {
+	loopDevs, err := d.loopDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, loopDev := range loopDevs {
+		_, err := shared.RunCommand("losetup", "--detach", loopDev)
+		if err != nil {
+			return fmt.Errorf("Failed to detach loop device %q: %v", loopDev, err)
+		}
+	}
+
+	return nil
+}
+
+// lvmNotFound returns whether a failed LVM command failed because the requested object doesn't
+// exist, which the LVM tools report with exit status 5.
+func lvmNotFound(err error) bool {
+	runErr, ok := err.(shared.RunError)
+	if !ok {
+		return false
+	}
+
+	exitErr, ok := runErr.Err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+
+	waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && waitStatus.ExitStatus() == 5
+}
+
+// physicalVolumeExists returns whether the given device is an LVM physical volume.
+func (d *lvm) physicalVolumeExists(pvName string) (bool, error) {
+	_, err := shared.RunCommand("pvs", "--noheadings", "-o", "pv_name", pvName)
+	if err != nil {
+		if lvmNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("Failed to check for LVM physical volume %q: %v", pvName, err)
+	}
+
+	return true, nil
+}
+
+// volumeGroupExists returns whether the given LVM volume group exists.
+func (d *lvm) volumeGroupExists(vgName string) (bool, error) {
+	_, err := shared.RunCommand("vgs", "--noheadings", "-o", "vg_name", vgName)
+	if err != nil {
+		if lvmNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("Failed to check for LVM volume group %q: %v", vgName, err)
+	}
+
+	return true, nil
+}
+
+// logicalVolumeExists returns whether the given logical volume exists in the pool's volume group.
+func (d *lvm) logicalVolumeExists(lvName string) (bool, error) {
+	_, err := shared.RunCommand("lvs", "--noheadings", "-o", "lv_name", fmt.Sprintf("%s/%s", d.vgName(), lvName))
+	if err != nil {
+		if lvmNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("Failed to check for LVM logical volume %q: %v", lvName, err)
+	}
+
+	return true, nil
+}
+
+// logicalVolumes returns the names of the logical volumes in the pool's volume group, oldest
+// first.
+func (d *lvm) logicalVolumes() ([]string, error) {
+	out, err := shared.RunCommand("lvs", "--noheadings", "-o", "lv_name", "-O", "lv_time", d.vgName())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list LVM logical volumes: %v", err)
+	}
+
+	return strings.Fields(out), nil
+}
+
+// thinPoolExists returns whether the pool's thin pool exists, failing if a logical volume of that
+// name exists but isn't a thin pool.
+func (d *lvm) thinPoolExists() (bool, error) {
+	out, err := shared.RunCommand("lvs", "--noheadings", "-o", "lv_attr", fmt.Sprintf("%s/%s", d.vgName(), d.thinPoolName()))
+	if err != nil {
+		if lvmNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("Failed to check for LVM thin pool %q: %v", d.thinPoolName(), err)
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(out), "t") {
+		return false, fmt.Errorf("LVM logical volume %q exists but isn't a thin pool", d.thinPoolName())
+	}
+
+	return true, nil
+}
+
+// ensureThinPool creates the pool's thin pool over all the free space of the volume group, unless
+// it exists already.
+func (d *lvm) ensureThinPool() error {
+	exists, err := d.thinPoolExists()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	thinPool := fmt.Sprintf("%s/%s", d.vgName(), d.thinPoolName())
+
+	// Older LVM tools can't allocate the free space of the volume group when creating the thin
+	// pool, so it's grown to it afterwards.
+	recent, err := d.versionIsAtLeast("2.02.99")
+	if err != nil {
+		return err
+	}
+
+	if recent {
+		_, err = shared.TryRunCommand("lvcreate", "-Wy", "--yes", "--poolmetadatasize", "1G", "-l", "100%FREE", "--thinpool", thinPool)
+	} else {
+		_, err = shared.TryRunCommand("lvcreate", "-Wy", "--yes", "--poolmetadatasize", "1G", "-L", "1G", "--thinpool", thinPool)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to create LVM thin pool %q: %v", thinPool, err)
+	}
+
+	if !recent {
+		_, err = shared.TryRunCommand("lvextend", "--alloc", "anywhere", "-l", "100%FREE", thinPool)
+		if err != nil {
+			return fmt.Errorf("Failed to grow LVM thin pool %q: %v", thinPool, err)
+		}
+	}
+
+	return nil
+}
+
+// versionIsAtLeast returns whether the LVM tools are at least of the given version.
+func (d *lvm) versionIsAtLeast(minVersion string) (bool, error) {
+	current, err := version.Parse(strings.Split(lvmVersion, "/")[0])
+	if err != nil {
+		return false, err
+	}
+
+	min, err := version.Parse(minVersion)
+	if err != nil {
+		return false, err
+	}
+
+	return current.Compare(min) >= 0, nil
+}
+
+// lvName returns the name of the logical volume of a volume (or volume snapshot). Hyphens are
+// doubled so that the one separating a volume and its snapshot names is unambiguous. The disk
+// image of block volumes lives in its own logical volume.
+func (d *lvm) lvName(volType VolumeType, volName string, block bool) string {
+	name := strings.Replace(volName, "-", "--", -1)
+	name = strings.Replace(name, shared.SnapshotDelimiter, "-", -1)
+
+	lvName := fmt.Sprintf("%s_%s", volType, name)
+	if block {
+		lvName += lvmBlockVolSuffix
+	}
+
+	return lvName
+}
+
+// lvDevPath returns the path of the device of the given logical volume.
+func (d *lvm) lvDevPath(lvName string) string {
+	return filepath.Join("/dev", d.vgName(), lvName)
+}
+
+// volumeLVNames returns the names of the logical volumes of a volume (or volume snapshot).
+func (d *lvm) volumeLVNames(vol Volume) []string {
+	lvNames := []string{d.lvName(vol.volType, vol.name, false)}
+	if vol.contentType == ContentTypeBlock {
+		lvNames = append(lvNames, d.lvName(vol.volType, vol.name, true))
+	}
+
+	return lvNames
+}
+
+// existingLVNames returns the names of the existing logical volumes of a volume (or volume
+// snapshot), which only has a disk image if it's a block volume.
+func (d *lvm) existingLVNames(volType VolumeType, volName string) ([]string, error) {
+	lvNames := []string{}
+
+	for _, block := range []bool{false, true} {
+		lvName := d.lvName(volType, volName, block)
+
+		exists, err := d.logicalVolumeExists(lvName)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			lvNames = append(lvNames, lvName)
+		}
+	}
+
+	return lvNames, nil
+}
+
+// volumeSize returns the size in bytes of the volume's logical volume holding its filesystem or
+// disk image, from the volume or pool config.
+func (d *lvm) volumeSize(vol Volume, block bool) (int64, error) {
+	size := lvmDefaultVolumeSize
+	if vol.contentType == ContentTypeBlock && !block {
+		size = lvmBlockFSSize
+	} else if vol.config["size"] != "" && vol.config["size"] != "0" {
+		size = vol.config["size"]
+	} else if d.config["volume.size"] != "" && d.config["volume.size"] != "0" {
+		size = d.config["volume.size"]
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return -1, err
+	}
+
+	return sizeBytes, nil
+}
+
+// volumeFilesystem returns the filesystem of a volume, from the volume or pool config.
+func (d *lvm) volumeFilesystem(vol Volume) string {
+	if vol.config["block.filesystem"] != "" {
+		return vol.config["block.filesystem"]
+	}
+
+	if d.config["volume.block.filesystem"] != "" {
+		return d.config["volume.block.filesystem"]
+	}
+
+	return "ext4"
+}
+
+// mountOptions returns the options volumes of the given filesystem are mounted with, from the
+// pool config. Snapshots of xfs filesystems share the UUID of their volume, which xfs must be
+// told to ignore.
+func (d *lvm) mountOptions(fsType string, snapshot bool) string {
+	options := d.config["volume.block.mount_options"]
+	if options == "" {
+		options = "discard"
+		if fsType == "btrfs" {
+			options = "user_subvol_rm_allowed,discard"
+		}
+	}
+
+	if snapshot && fsType == "xfs" && !shared.StringInSlice("nouuid", strings.Split(options, ",")) {
+		options += ",nouuid"
+	}
+
+	return options
+}
+
+// createLogicalVolume creates a logical volume of the given size, rounded down to 512 bytes. It
+// is thinly provisioned from the thin pool (which is created if missing) when the pool uses one.
+func (d *lvm) createLogicalVolume(lvName string, sizeBytes int64) error {
+	size := fmt.Sprintf("%db", sizeBytes/512*512)
+
+	var err error
+	if d.useThinPool() {
+		err = d.ensureThinPool()
+		if err != nil {
+			return err
+		}
+
+		_, err = shared.TryRunCommand("lvcreate", "-Wy", "--yes", "--thin", "-n", lvName, "--virtualsize", size, fmt.Sprintf("%s/%s", d.vgName(), d.thinPoolName()))
+	} else {
+		_, err = shared.TryRunCommand("lvcreate", "-Wy", "--yes", "-n", lvName, "--size", size, d.vgName())
+	}
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to create LVM logical volume %q: %v", lvName, err))
+	}
+
+	return nil
+}
+
+// snapshotLogicalVolume creates a snapshot of a logical volume. Snapshots of thin volumes are thin
+// volumes themselves, while others need the space for the changes of their origin, which is taken
+// as large as the origin.
+func (d *lvm) snapshotLogicalVolume(srcLVName string, lvName string, readonly bool) error {
+	args := []string{"-n", lvName, "-s", fmt.Sprintf("%s/%s", d.vgName(), srcLVName)}
+
+	// Thin snapshots are skipped on activation by default, which older LVM tools can't change.
+	recent, err := d.versionIsAtLeast("2.02.99")
+	if err != nil {
+		return err
+	}
+
+	if recent {
+		args = append(args, "-kn")
+	}
+
+	if !d.useThinPool() {
+		sizeBytes, err := d.logicalVolumeSize(srcLVName)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, "--size", fmt.Sprintf("%db", sizeBytes))
+	}
+
+	if readonly {
+		args = append(args, "-pr")
+	} else {
+		args = append(args, "-prw")
+	}
+
+	_, err = shared.TryRunCommand("lvcreate", args...)
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to snapshot LVM logical volume %q: %v", srcLVName, err))
+	}
+
+	// Thin snapshots aren't activated on creation, unlike regular snapshots which complain about
+	// doing so.
+	if d.useThinPool() {
+		_, err = shared.TryRunCommand("lvchange", "-ay", fmt.Sprintf("%s/%s", d.vgName(), lvName))
+		if err != nil {
+			return fmt.Errorf("Failed to activate LVM logical volume %q: %v", lvName, err)
+		}
+	}
+
+	return nil
+}
+
+// removeLogicalVolume removes a logical volume.
+func (d *lvm) removeLogicalVolume(lvName string) error {
+	_, err := shared.TryRunCommand("lvremove", "-f", fmt.Sprintf("%s/%s", d.vgName(), lvName))
+	if err != nil {
+		return fmt.Errorf("Failed to remove LVM logical volume %q: %v", lvName, err)
+	}
+
+	return nil
+}
+
+// renameLogicalVolume renames a logical volume.
+func (d *lvm) renameLogicalVolume(lvName string, newLVName string) error {
+	_, err := shared.TryRunCommand("lvrename", d.vgName(), lvName, newLVName)
+	if err != nil {
+		return fmt.Errorf("Failed to rename LVM logical volume %q to %q: %v", lvName, newLVName, err)
+	}
+
+	return nil
+}
+
+// logicalVolumeSize returns the size in bytes of a logical volume.
+func (d *lvm) logicalVolumeSize(lvName string) (int64, error) {
+	out, err := shared.TryRunCommand("lvs", "--noheadings", "--units", "b", "--nosuffix", "-o", "lv_size", fmt.Sprintf("%s/%s", d.vgName(), lvName))
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get size of LVM logical volume %q: %v", lvName, err)
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+}
+
+// resizeLogicalVolume sets the size of a logical volume, rounded down to 512 bytes.
+func (d *lvm) resizeLogicalVolume(lvName string, sizeBytes int64) error {
+	_, err := shared.TryRunCommand("lvresize", "-f", "-L", fmt.Sprintf("%db", sizeBytes/512*512), fmt.Sprintf("%s/%s", d.vgName(), lvName))
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to resize LVM logical volume %q: %v", lvName, err))
+	}
+
+	return nil
+}
+
+// setLogicalVolumeReadOnly sets whether a logical volume is read-only.
+func (d *lvm) setLogicalVolumeReadOnly(lvName string, readonly bool) error {
+	permission := "rw"
+	if readonly {
+		permission = "r"
+	}
+
+	_, err := shared.TryRunCommand("lvchange", "-p", permission, fmt.Sprintf("%s/%s", d.vgName(), lvName))
+	if err != nil {
+		return fmt.Errorf("Failed to change permissions of LVM logical volume %q: %v", lvName, err)
+	}
+
+	return nil
+}
+
+// isLogicalVolumeReadOnly returns whether a logical volume is read-only.
+func (d *lvm) isLogicalVolumeReadOnly(lvName string) (bool, error) {
+	out, err := shared.TryRunCommand("lvs", "--noheadings", "-o", "lv_attr", fmt.Sprintf("%s/%s", d.vgName(), lvName))
+	if err != nil {
+		return false, fmt.Errorf("Failed to get attributes of LVM logical volume %q: %v", lvName, err)
+	}
+
+	attrs := strings.TrimSpace(out)
+	return len(attrs) > 1 && attrs[1] == 'r', nil
+}
@@ -0,0 +1,1097 @@
+package drivers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/rsync"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/units"
+)
+
+// ValidateVolume validates the supplied volume config.
+func (d *lvm) ValidateVolume(vol Volume, removeUnknownKeys bool) error {
+	rules := map[string]func(value string) error{
+		"block.filesystem": func(value string) error {
+			return shared.IsOneOf(value, []string{"", "btrfs", "ext4", "xfs"})
+		},
+		"block.mount_options": shared.IsAny,
+	}
+
+	return d.validateVolume(vol, rules, removeUnknownKeys)
+}
+
+// HasVolume indicates whether a specific volume exists on the storage pool.
+func (d *lvm) HasVolume(volType VolumeType, volName string) bool {
+	exists, err := d.logicalVolumeExists(d.lvName(volType, volName, false))
+	return err == nil && exists
+}
+
+// GetVolumeDiskPath returns the location and format of the disk image of a block volume.
+func (d *lvm) GetVolumeDiskPath(volType VolumeType, volName string) (string, string, error) {
+	return d.lvDevPath(d.lvName(volType, volName, true)), "raw", nil
+}
+
+// GetVolumeUsage returns the disk space used by the volume. Only thin volumes report it, the
+// others use the space of their whole size.
+func (d *lvm) GetVolumeUsage(vol Volume) (int64, error) {
+	if !d.useThinPool() {
+		return -1, Errorf(ErrNotSupported, "Volume usage is only reported for thin volumes")
+	}
+
+	lvNames, err := d.existingLVNames(vol.volType, vol.name)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(lvNames) == 0 {
+		return -1, Errorf(ErrNotFound, "Volume doesn't exist")
+	}
+
+	usage := int64(0)
+	for _, lvName := range lvNames {
+		out, err := shared.TryRunCommand("lvs", "--noheadings", "--units", "b", "--nosuffix", "--separator", ",", "-o", "lv_size,data_percent", fmt.Sprintf("%s/%s", d.vgName(), lvName))
+		if err != nil {
+			return -1, fmt.Errorf("Failed to get usage of LVM logical volume %q: %v", lvName, err)
+		}
+
+		fields := strings.Split(strings.TrimSpace(out), ",")
+		if len(fields) != 2 {
+			return -1, fmt.Errorf("Unexpected output from lvs command")
+		}
+
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return -1, err
+		}
+
+		percent, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return -1, err
+		}
+
+		usage += int64(float64(size) * percent / 100)
+	}
+
+	return usage, nil
+}
+
+// CreateVolume creates an empty volume and can optionally fill it by executing the supplied
+// filler function. Block volumes get a small filesystem for their files next to the logical
+// volume holding their disk image.
+func (d *lvm) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath string) error, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Create slice of logical volumes created if revert needed later.
+	revertLVs := []string{}
+	defer func() {
+		if revertLVs == nil {
+			return
+		}
+
+		for _, lvName := range revertLVs {
+			d.removeLogicalVolume(lvName)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	for _, lvName := range d.volumeLVNames(vol) {
+		block := strings.HasSuffix(lvName, lvmBlockVolSuffix)
+
+		sizeBytes, err := d.volumeSize(vol, block)
+		if err != nil {
+			return err
+		}
+
+		err = d.createLogicalVolume(lvName, sizeBytes)
+		if err != nil {
+			return err
+		}
+
+		revertLVs = append(revertLVs, lvName)
+
+		if !block {
+			err = makeFSType(d.lvDevPath(lvName), d.volumeFilesystem(vol))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	// We expect the filler to copy the VM image into the logical volume's device.
+	rootBlockPath := ""
+	if vol.contentType == ContentTypeBlock {
+		rootBlockPath, _, err = d.GetVolumeDiskPath(vol.volType, vol.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Run the volume filler function if supplied.
+	if filler != nil {
+		err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return filler(mountPath, rootBlockPath)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertLVs = nil
+	return nil
+}
+
+// CreateVolumeFromCopy provides same-pool volume copying functionality. Thin volumes (and their
+// snapshots) are copied as thin snapshots, which share their data with the source until either
+// changes. Other volumes get their content copied.
+func (d *lvm) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
+	if vol.contentType != srcVol.contentType || (vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock) {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Snapshots can't be copied from a snapshot.
+	copySnapshots = copySnapshots && !srcVol.IsSnapshot()
+
+	if !d.useThinPool() {
+		return d.createVolumeFromCopyContent(vol, srcVol, copySnapshots, op)
+	}
+
+	// Create slice of logical volumes created if revert needed later.
+	revertLVs := []string{}
+	defer func() {
+		if revertLVs == nil {
+			return
+		}
+
+		for _, lvName := range revertLVs {
+			d.removeLogicalVolume(lvName)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	if copySnapshots {
+		srcSnapshots, err := srcVol.Snapshots(op)
+		if err != nil {
+			return err
+		}
+
+		for _, srcSnapshot := range srcSnapshots {
+			_, snapName, _ := shared.ContainerGetParentAndSnapshotName(srcSnapshot.name)
+
+			snapshot, err := vol.NewSnapshot(snapName)
+			if err != nil {
+				return err
+			}
+
+			err = d.snapshotVolume(srcSnapshot, snapshot, true)
+			if err != nil {
+				return err
+			}
+
+			revertLVs = append(revertLVs, d.volumeLVNames(snapshot)...)
+
+			err = snapshot.CreateMountPath()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := d.snapshotVolume(srcVol, vol, false)
+	if err != nil {
+		return err
+	}
+
+	revertLVs = append(revertLVs, d.volumeLVNames(vol)...)
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	if vol.config["size"] != "" {
+		err = d.SetVolumeQuota(vol.volType, vol.name, vol.config["size"], op)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertLVs = nil
+	return nil
+}
+
+// snapshotVolume creates the logical volumes of a volume as thin snapshots of those of the source
+// volume. The filesystem of writable copies gets a new UUID, so that both can be mounted at once.
+func (d *lvm) snapshotVolume(srcVol Volume, vol Volume, readonly bool) error {
+	// Create slice of logical volumes created if revert needed later.
+	revertLVs := []string{}
+	defer func() {
+		for _, lvName := range revertLVs {
+			d.removeLogicalVolume(lvName)
+		}
+	}()
+
+	srcLVNames := d.volumeLVNames(srcVol)
+	for i, lvName := range d.volumeLVNames(vol) {
+		err := d.snapshotLogicalVolume(srcLVNames[i], lvName, readonly)
+		if err != nil {
+			return err
+		}
+
+		revertLVs = append(revertLVs, lvName)
+	}
+
+	if !readonly {
+		devPath := d.lvDevPath(d.lvName(vol.volType, vol.name, false))
+
+		fsType, err := detectFSType(devPath)
+		if err != nil {
+			return err
+		}
+
+		err = regenerateFSUUID(devPath, fsType)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertLVs = nil
+	return nil
+}
+
+// createVolumeFromCopyContent creates a volume (and its snapshots) by copying the content of the
+// source volume (and of its snapshots).
+func (d *lvm) createVolumeFromCopyContent(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
+	err := d.CreateVolume(vol, nil, op)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		d.DeleteVolume(vol.volType, vol.name, op)
+	}()
+
+	// Ensure the volume is mounted.
+	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		if copySnapshots {
+			// Get the list of snapshots from the source.
+			srcSnapshots, err := srcVol.Snapshots(op)
+			if err != nil {
+				return err
+			}
+
+			for _, srcSnapshot := range srcSnapshots {
+				_, snapName, _ := shared.ContainerGetParentAndSnapshotName(srcSnapshot.name)
+
+				// Copy the source snapshot (mounting it if needed).
+				err = srcSnapshot.MountTask(func(srcMountPath string, op *operations.Operation) error {
+					return d.copyContent(srcSnapshot, vol, srcMountPath, mountPath, op)
+				}, op)
+				if err != nil {
+					return err
+				}
+
+				// Create the snapshot itself.
+				err = d.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+				if err != nil {
+					return err
+				}
+
+				// Setup the revert.
+				revertSnaps = append(revertSnaps, snapName)
+			}
+		}
+
+		// Copy source to destination (mounting each volume if needed).
+		return srcVol.MountTask(func(srcMountPath string, op *operations.Operation) error {
+			return d.copyContent(srcVol, vol, srcMountPath, mountPath, op)
+		}, op)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// copyContent copies the content of the mounted source volume to the mounted volume, including
+// the disk image of block volumes.
+func (d *lvm) copyContent(srcVol Volume, vol Volume, srcMountPath string, mountPath string, op *operations.Operation) error {
+	progress := copyProgress(op, srcVol.name)
+
+	_, err := d.copyVolume(srcMountPath, mountPath, ContentTypeFS, progress)
+	if err != nil {
+		return err
+	}
+
+	if vol.contentType != ContentTypeBlock {
+		return nil
+	}
+
+	srcDevPath := d.lvDevPath(d.lvName(srcVol.volType, srcVol.name, true))
+	devPath := d.lvDevPath(d.lvName(vol.volType, vol.name, true))
+
+	return wrapInsufficientSpace(copySparseFile(srcDevPath, devPath, progress))
+}
+
+// MigrateVolume sends a volume for migration. The disk image of block volumes is sent after the
+// files next to it, with its holes skipped.
+func (d *lvm) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volSrcArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	if vol.contentType == ContentTypeBlock && !shared.StringInSlice("sparse", volSrcArgs.MigrationType.Features) {
+		return Errorf(ErrNotSupported, "Migration of block volumes requires the \"sparse\" feature")
+	}
+
+	for _, snapName := range volSrcArgs.Snapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		// Send snapshot to recipient (ensure local snapshot volume is mounted if needed).
+		err = snapshot.MountTask(func(mountPath string, op *operations.Operation) error {
+			var wrapper *ioprogress.ProgressTracker
+			if volSrcArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapshot.name)
+			}
+
+			return d.sendLogicalVolume(snapshot, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, nil)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send volume to recipient (ensure local volume is mounted if needed).
+	return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.sendLogicalVolume(vol, mountPath, conn, wrapper, volSrcArgs.MigrationType.Features, volSrcArgs.Freeze)
+	}, op)
+}
+
+// sendLogicalVolume sends the files of a mounted volume using rsync, followed by the disk image
+// of block volumes.
+func (d *lvm) sendLogicalVolume(vol Volume, mountPath string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string, freeze func() error) error {
+	bwlimit := d.config["rsync.bwlimit"]
+
+	err := rsync.Send(vol.name, shared.AddSlash(mountPath), conn, tracker, features, bwlimit, d.state.OS.ExecPath)
+	if err != nil {
+		return err
+	}
+
+	if vol.contentType != ContentTypeBlock {
+		return nil
+	}
+
+	return sendDiskImage(conn, d.lvDevPath(d.lvName(vol.volType, vol.name, true)), tracker, features, freeze)
+}
+
+// recvLogicalVolume receives the files and disk image sent by sendLogicalVolume into a mounted
+// volume.
+func (d *lvm) recvLogicalVolume(vol Volume, mountPath string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string) error {
+	err := rsync.Recv(shared.AddSlash(mountPath), conn, tracker, features)
+	if err != nil {
+		return wrapInsufficientSpace(err)
+	}
+
+	if vol.contentType != ContentTypeBlock {
+		return nil
+	}
+
+	return wrapInsufficientSpace(recvSparseFile(conn, d.lvDevPath(d.lvName(vol.volType, vol.name, true)), tracker))
+}
+
+// CreateVolumeFromMigration creates a volume being sent via a migration.
+func (d *lvm) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volTargetArgs.MigrationType.FSType != migration.MigrationFSType_RSYNC {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	if vol.contentType == ContentTypeBlock && !shared.StringInSlice("sparse", volTargetArgs.MigrationType.Features) {
+		return Errorf(ErrNotSupported, "Migration of block volumes requires the \"sparse\" feature")
+	}
+
+	err := d.CreateVolume(vol, nil, op)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		d.DeleteVolume(vol.volType, vol.name, op)
+	}()
+
+	// Ensure the volume is mounted.
+	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		// Snapshots are sent first by the sender, so create these first.
+		for _, snapName := range volTargetArgs.Snapshots {
+			// Receive the snapshot
+			var wrapper *ioprogress.ProgressTracker
+			if volTargetArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+			}
+
+			err := d.recvLogicalVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
+			if err != nil {
+				return err
+			}
+
+			// Create the snapshot itself.
+			err = d.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+			if err != nil {
+				return err
+			}
+
+			// Setup the revert.
+			revertSnaps = append(revertSnaps, snapName)
+		}
+
+		// Receive the main volume from sender.
+		var wrapper *ioprogress.ProgressTracker
+		if volTargetArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return d.recvLogicalVolume(vol, mountPath, conn, wrapper, volTargetArgs.MigrationType.Features)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// VolumeSnapshots returns a list of snapshots for the volume, oldest first.
+func (d *lvm) VolumeSnapshots(volType VolumeType, volName string, op *operations.Operation) ([]string, error) {
+	snapshots := []string{}
+
+	lvNames, err := d.logicalVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("%s-", d.lvName(volType, volName, false))
+	for _, lvName := range lvNames {
+		if !strings.HasPrefix(lvName, prefix) || strings.HasSuffix(lvName, lvmBlockVolSuffix) {
+			continue
+		}
+
+		// Hyphens in names are doubled, so a single one means the logical volume belongs to
+		// another volume whose name starts with this one's.
+		snapName := strings.TrimPrefix(lvName, prefix)
+		if strings.HasPrefix(snapName, "-") || strings.Contains(strings.Replace(snapName, "--", "", -1), "-") {
+			continue
+		}
+
+		snapshots = append(snapshots, strings.Replace(snapName, "--", "-", -1))
+	}
+
+	return snapshots, nil
+}
+
+// UpdateVolume applies config changes to the volume.
+func (d *lvm) UpdateVolume(vol Volume, changedConfig map[string]string) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if _, changed := changedConfig["block.filesystem"]; changed {
+		return fmt.Errorf("The filesystem of a volume can't be changed")
+	}
+
+	if size, changed := changedConfig["size"]; changed {
+		return d.SetVolumeQuota(vol.volType, vol.name, size, nil)
+	}
+
+	return nil
+}
+
+// RenameVolume renames a volume and its snapshots.
+func (d *lvm) RenameVolume(volType VolumeType, volName string, newVolName string, op *operations.Operation) error {
+	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
+	newVol := NewVolume(d, d.name, volType, ContentTypeFS, newVolName, nil)
+
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the volume and its snapshots aren't mounted, as their mount paths change.
+	_, err = forceUnmount(vol.MountPath())
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range snapshots {
+		_, err = forceUnmount(GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapName)))
+		if err != nil {
+			return err
+		}
+	}
+
+	type lvRevert struct {
+		oldName string
+		newName string
+	}
+
+	// Create slice to record logical volumes renamed if revert needed later.
+	revertLVs := []lvRevert{}
+	defer func() {
+		// Rename back any logical volumes if we are reverting.
+		for _, lv := range revertLVs {
+			d.renameLogicalVolume(lv.newName, lv.oldName)
+		}
+	}()
+
+	renameLVs := func(name string, newName string) error {
+		lvNames, err := d.existingLVNames(volType, name)
+		if err != nil {
+			return err
+		}
+
+		for _, lvName := range lvNames {
+			newLVName := d.lvName(volType, newName, strings.HasSuffix(lvName, lvmBlockVolSuffix))
+
+			err := d.renameLogicalVolume(lvName, newLVName)
+			if err != nil {
+				return err
+			}
+
+			revertLVs = append(revertLVs, lvRevert{
+				oldName: lvName,
+				newName: newLVName,
+			})
+		}
+
+		return nil
+	}
+
+	err = renameLVs(volName, newVolName)
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range snapshots {
+		err = renameLVs(GetSnapshotVolumeName(volName, snapName), GetSnapshotVolumeName(newVolName, snapName))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Move the mount paths of the volume and of its snapshots.
+	err = newVol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(vol.MountPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	oldSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	newSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newVolName)
+	if err != nil {
+		return err
+	}
+
+	if shared.PathExists(oldSnapshotDir) {
+		err = os.Rename(oldSnapshotDir, newSnapshotDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertLVs = nil
+	return nil
+}
+
+// RestoreVolume restores a volume from a snapshot. Thin volumes are replaced by thin snapshots of
+// the snapshot. Regular snapshots can only be merged into their volume, which consumes them, so
+// their content is copied back instead.
+func (d *lvm) RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(vol.volType, vol.name, op)
+	if err != nil {
+		return err
+	}
+
+	if !shared.StringInSlice(snapshotName, snapshots) {
+		return Errorf(ErrNotFound, "Snapshot not found")
+	}
+
+	snapVol, err := vol.NewSnapshot(snapshotName)
+	if err != nil {
+		return err
+	}
+
+	if !d.useThinPool() {
+		return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return snapVol.MountTask(func(snapMountPath string, op *operations.Operation) error {
+				return d.copyContent(snapVol, vol, snapMountPath, mountPath, op)
+			}, op)
+		}, op)
+	}
+
+	_, err = forceUnmount(vol.MountPath())
+	if err != nil {
+		return err
+	}
+
+	// Move the current logical volumes out of the way, putting them back if the restore fails.
+	lvNames := d.volumeLVNames(vol)
+	movedLVs := []string{}
+	defer func() {
+		if movedLVs == nil {
+			return
+		}
+
+		for _, lvName := range movedLVs {
+			exists, _ := d.logicalVolumeExists(lvName)
+			if exists {
+				d.removeLogicalVolume(lvName)
+			}
+
+			d.renameLogicalVolume(fmt.Sprintf("%s.restore", lvName), lvName)
+		}
+	}()
+
+	for _, lvName := range lvNames {
+		err = d.renameLogicalVolume(lvName, fmt.Sprintf("%s.restore", lvName))
+		if err != nil {
+			return err
+		}
+
+		movedLVs = append(movedLVs, lvName)
+	}
+
+	err = d.snapshotVolume(snapVol, vol, false)
+	if err != nil {
+		return err
+	}
+
+	movedLVs = nil
+
+	for _, lvName := range lvNames {
+		err = d.removeLogicalVolume(fmt.Sprintf("%s.restore", lvName))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteVolume deletes a volume of the storage device. If any snapshots of the volume remain then
+// this function will return an error.
+func (d *lvm) DeleteVolume(volType VolumeType, volName string, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) > 0 {
+		return Errorf(ErrInUse, "Cannot remove a volume that has snapshots")
+	}
+
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	_, err = forceUnmount(volPath)
+	if err != nil {
+		return err
+	}
+
+	lvNames, err := d.existingLVNames(volType, volName)
+	if err != nil {
+		return err
+	}
+
+	for _, lvName := range lvNames {
+		err = d.removeLogicalVolume(lvName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the volume's mount path.
+	err = os.RemoveAll(volPath)
+	if err != nil {
+		return err
+	}
+
+	// Although the volume snapshot directory should already be removed, lets remove it here
+	// to just in case the top-level directory is left.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MountVolume mounts the filesystem of a volume, returns true if we caused a new mount. The mount
+// options come from the pool config, as the volume config isn't available here.
+func (d *lvm) MountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	// Check if already mounted.
+	if shared.IsMountPoint(volPath) {
+		return false, nil
+	}
+
+	devPath := d.lvDevPath(d.lvName(volType, volName, false))
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return false, err
+	}
+
+	mountFlags, mountData := resolveMountOptions(d.mountOptions(fsType, false))
+	err = tryMount(devPath, volPath, fsType, mountFlags, mountData)
+	if err != nil {
+		return false, fmt.Errorf("Failed to mount LVM logical volume %q onto %q: %v", devPath, volPath, err)
+	}
+
+	return true, nil
+}
+
+// MountVolumeSnapshot mounts the filesystem of a volume snapshot as read-only. The logical volume
+// is made writable while mounted, so that the filesystem's journal can be replayed.
+func (d *lvm) MountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, GetSnapshotVolumeName(volName, snapshotName), nil)
+	snapPath := snapVol.MountPath()
+
+	// Check if already mounted.
+	if shared.IsMountPoint(snapPath) {
+		return false, nil
+	}
+
+	err := snapVol.CreateMountPath()
+	if err != nil {
+		return false, err
+	}
+
+	lvName := d.lvName(volType, snapVol.name, false)
+	devPath := d.lvDevPath(lvName)
+
+	readonly, err := d.isLogicalVolumeReadOnly(lvName)
+	if err != nil {
+		return false, err
+	}
+
+	if readonly {
+		err = d.setLogicalVolumeReadOnly(lvName, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return false, err
+	}
+
+	mountFlags, mountData := resolveMountOptions(d.mountOptions(fsType, true))
+	err = tryMount(devPath, snapPath, fsType, mountFlags|unix.MS_RDONLY, mountData)
+	if err != nil {
+		return false, fmt.Errorf("Failed to mount LVM snapshot %q onto %q: %v", devPath, snapPath, err)
+	}
+
+	return true, nil
+}
+
+// UnmountVolume unmounts the filesystem of a volume, returns true if unmounted, false if was not
+// mounted.
+func (d *lvm) UnmountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	return forceUnmount(GetVolumeMountPath(d.name, volType, volName))
+}
+
+// UnmountVolumeSnapshot unmounts the filesystem of a volume snapshot and makes its logical volume
+// read-only again.
+func (d *lvm) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	snapVolName := GetSnapshotVolumeName(volName, snapshotName)
+
+	ourUnmount, err := forceUnmount(GetVolumeMountPath(d.name, volType, snapVolName))
+	if err != nil {
+		return false, err
+	}
+
+	if ourUnmount {
+		err = d.setLogicalVolumeReadOnly(d.lvName(volType, snapVolName, false), true)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return ourUnmount, nil
+}
+
+// SetVolumeQuota resizes the logical volume holding the filesystem of a volume (along with the
+// filesystem) or the disk image of a block volume, which can only grow.
+func (d *lvm) SetVolumeQuota(volType VolumeType, volName, size string, op *operations.Operation) error {
+	if size == "" || size == "0" {
+		size = d.config["volume.size"]
+	}
+
+	if size == "" || size == "0" {
+		size = lvmDefaultVolumeSize
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	sizeBytes = sizeBytes / 512 * 512
+
+	blockLVName := d.lvName(volType, volName, true)
+	block, err := d.logicalVolumeExists(blockLVName)
+	if err != nil {
+		return err
+	}
+
+	lvName := d.lvName(volType, volName, false)
+	if block {
+		lvName = blockLVName
+	}
+
+	currentBytes, err := d.logicalVolumeSize(lvName)
+	if err != nil {
+		return err
+	}
+
+	if sizeBytes == currentBytes {
+		return nil
+	}
+
+	if block {
+		if sizeBytes < currentBytes {
+			return Errorf(ErrNotSupported, "Block volumes can't be shrunk")
+		}
+
+		return d.resizeLogicalVolume(lvName, sizeBytes)
+	}
+
+	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
+	devPath := d.lvDevPath(lvName)
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return err
+	}
+
+	// Grow the logical volume before its filesystem, or shrink it after.
+	if sizeBytes > currentBytes {
+		err = d.resizeLogicalVolume(lvName, sizeBytes)
+		if err != nil {
+			return err
+		}
+
+		return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return growFileSystem(fsType, devPath, mountPath)
+		}, op)
+	}
+
+	if fsType == "ext4" {
+		err = unmountForShrink(vol.MountPath())
+		if err != nil {
+			return err
+		}
+
+		err = shrinkFileSystem(fsType, devPath, "", sizeBytes)
+	} else {
+		err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return shrinkFileSystem(fsType, devPath, mountPath, sizeBytes)
+		}, op)
+	}
+	if err != nil {
+		return err
+	}
+
+	return d.resizeLogicalVolume(lvName, sizeBytes)
+}
+
+// CheckVolume checks the filesystem of an unmounted filesystem volume without repairing it.
+func (d *lvm) CheckVolume(vol Volume, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	if vol.contentType != ContentTypeFS {
+		return nil, Errorf(ErrNotSupported, "Only filesystem volumes can be checked")
+	}
+
+	if shared.IsMountPoint(vol.MountPath()) {
+		return nil, Errorf(ErrInUse, "The volume must be unmounted to be checked")
+	}
+
+	devPath := d.lvDevPath(d.lvName(vol.volType, vol.name, false))
+
+	fsType, err := detectFSType(devPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkFileSystem(fsType, devPath)
+}
+
+// CreateVolumeSnapshot creates a read-only snapshot of a volume.
+func (d *lvm) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapshotName string, op *operations.Operation) error {
+	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, GetSnapshotVolumeName(volName, newSnapshotName), nil)
+
+	lvNames, err := d.existingLVNames(volType, volName)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of logical volumes created if revert needed later.
+	revertLVs := []string{}
+	defer func() {
+		for _, lvName := range revertLVs {
+			d.removeLogicalVolume(lvName)
+		}
+	}()
+
+	for _, lvName := range lvNames {
+		snapLVName := d.lvName(volType, snapVol.name, strings.HasSuffix(lvName, lvmBlockVolSuffix))
+
+		err := d.snapshotLogicalVolume(lvName, snapLVName, true)
+		if err != nil {
+			return err
+		}
+
+		revertLVs = append(revertLVs, snapLVName)
+	}
+
+	// Create snapshot mount path.
+	err = snapVol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	revertLVs = nil
+	return nil
+}
+
+// DeleteVolumeSnapshot removes a snapshot from the storage device. The volName and snapshotName
+// must be bare names and should not be in the format "volume/snapshot".
+func (d *lvm) DeleteVolumeSnapshot(volType VolumeType, volName string, snapshotName string, op *operations.Operation) error {
+	snapVolName := GetSnapshotVolumeName(volName, snapshotName)
+	snapPath := GetVolumeMountPath(d.name, volType, snapVolName)
+
+	_, err := forceUnmount(snapPath)
+	if err != nil {
+		return err
+	}
+
+	lvNames, err := d.existingLVNames(volType, snapVolName)
+	if err != nil {
+		return err
+	}
+
+	for _, lvName := range lvNames {
+		err = d.removeLogicalVolume(lvName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the snapshot mount path.
+	err = os.RemoveAll(snapPath)
+	if err != nil {
+		return err
+	}
+
+	// Remove the parent snapshot directory if this is the last snapshot being removed.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameVolumeSnapshot renames a volume snapshot.
+func (d *lvm) RenameVolumeSnapshot(volType VolumeType, volName string, snapshotName string, newSnapshotName string, op *operations.Operation) error {
+	snapVolName := GetSnapshotVolumeName(volName, snapshotName)
+	newSnapVolName := GetSnapshotVolumeName(volName, newSnapshotName)
+	oldPath := GetVolumeMountPath(d.name, volType, snapVolName)
+	newPath := GetVolumeMountPath(d.name, volType, newSnapVolName)
+
+	_, err := forceUnmount(oldPath)
+	if err != nil {
+		return err
+	}
+
+	lvNames, err := d.existingLVNames(volType, snapVolName)
+	if err != nil {
+		return err
+	}
+
+	for _, lvName := range lvNames {
+		err := d.renameLogicalVolume(lvName, d.lvName(volType, newSnapVolName, strings.HasSuffix(lvName, lvmBlockVolSuffix)))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,362 @@
+package drivers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/units"
+)
+
+var zfsVersion string
+var zfsLoaded bool
+
+// zfsDefaultBlockSize is the size of block volumes when none is configured.
+const zfsDefaultBlockSize = "10GB"
+
+// zfsBlockVolSuffix is appended to the name of the dataset of a volume to get the name of the zvol
+// holding its disk image.
+const zfsBlockVolSuffix = ".block"
+
+type zfs struct {
+	common
+}
+
+// init sets up the driver, then loads it. The load() call in common.init() doesn't reach the
+// load() function of the ZFS driver.
+func (d *zfs) init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error {
+	err := d.common.init(state, name, config, logger, volIDFunc, commonRulesFunc)
+	if err != nil {
+		return err
+	}
+
+	return d.load()
+}
+
+func (d *zfs) load() error {
+	if zfsLoaded {
+		return nil
+	}
+
+	// Load the kernel module.
+	util.LoadModule("zfs")
+
+	// Validate the required binaries.
+	for _, tool := range []string{"zpool", "zfs"} {
+		_, err := exec.LookPath(tool)
+		if err != nil {
+			return fmt.Errorf("Required tool '%s' is missing", tool)
+		}
+	}
+
+	// Detect and record the version.
+	if zfsVersion == "" {
+		version, err := d.version()
+		if err != nil {
+			return err
+		}
+
+		zfsVersion = version
+	}
+
+	zfsLoaded = true
+	return nil
+}
+
+// version returns the version of the ZFS kernel module.
+func (d *zfs) version() (string, error) {
+	out, err := ioutil.ReadFile("/sys/module/zfs/version")
+	if err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	version, err := shared.RunCommand("modinfo", "-F", "version", "zfs")
+	if err != nil {
+		return "", fmt.Errorf("Could not determine ZFS module version")
+	}
+
+	return strings.TrimSpace(version), nil
+}
+
+// Info returns info about the driver and its environment.
+func (d *zfs) Info() Info {
+	return Info{
+		Name:               "zfs",
+		Version:            zfsVersion,
+		OptimizedImages:    true,
+		PreservesInodes:    true,
+		Remote:             false,
+		VolumeTypes:        []VolumeType{VolumeTypeCustom, VolumeTypeImage, VolumeTypeContainer, VolumeTypeVM},
+		BlockBacking:       false,
+		RunningQuotaResize: true,
+		InstantClones:      true,
+		RunningCopyFreeze:  false,
+		OptimizedBackups:   true,
+	}
+}
+
+// Create creates the zpool (or uses an existing zpool or dataset) and the datasets holding the
+// volumes.
+func (d *zfs) Create() error {
+	// WARNING: The Create() function cannot rely on any of the struct attributes being set.
+
+	// Store the provided source as we are likely to be mangling it.
+	d.config["volatile.initial_source"] = d.config["source"]
+
+	revert := false
+	defer func() {
+		if revert {
+			d.Delete(nil)
+		}
+	}()
+
+	loopPath := filepath.Join(shared.VarPath("disks"), fmt.Sprintf("%s.img", d.name))
+	if d.config["source"] == "" || d.config["source"] == loopPath {
+		// Create a loop based pool.
+		d.config["source"] = loopPath
+
+		if d.config["zfs.pool_name"] == "" {
+			d.config["zfs.pool_name"] = d.name
+		}
+
+		size, err := units.ParseByteSizeString(d.config["size"])
+		if err != nil {
+			return err
+		}
+
+		err = createSparseFile(loopPath, size)
+		if err != nil {
+			return err
+		}
+
+		_, err = shared.RunCommand("zpool", "create", "-f", "-m", "none", "-O", "compression=on", d.config["zfs.pool_name"], loopPath)
+		if err != nil {
+			os.Remove(loopPath)
+			return fmt.Errorf("Failed to create the ZFS pool: %v", err)
+		}
+
+		revert = true
+	} else if filepath.IsAbs(d.config["source"]) {
+		// Unset size property since it doesn't make sense.
+		d.config["size"] = ""
+
+		if !shared.IsBlockdevPath(d.config["source"]) {
+			return Errorf(ErrNotSupported, "Custom loop file locations are not supported")
+		}
+
+		if d.config["zfs.pool_name"] == "" {
+			d.config["zfs.pool_name"] = d.name
+		}
+
+		_, err := shared.RunCommand("zpool", "create", "-f", "-m", "none", "-O", "compression=on", d.config["zfs.pool_name"], d.config["source"])
+		if err != nil {
+			return fmt.Errorf("Failed to create the ZFS pool: %v", err)
+		}
+
+		revert = true
+
+		// The path of the block device may change, so only record the name of the zpool.
+		d.config["source"] = d.config["zfs.pool_name"]
+	} else {
+		// Unset size property since it doesn't make sense.
+		d.config["size"] = ""
+
+		if d.config["zfs.pool_name"] != "" && d.config["zfs.pool_name"] != d.config["source"] {
+			return fmt.Errorf("Invalid combination of \"source\" and \"zfs.pool_name\" property")
+		}
+
+		d.config["zfs.pool_name"] = d.config["source"]
+
+		if strings.Contains(d.config["source"], "/") {
+			// Create the dataset if missing.
+			if !d.checkDataset(d.config["source"]) {
+				err := d.createDataset(d.config["source"], "mountpoint=none")
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			// Check that the zpool exists.
+			poolType, err := d.getDatasetProperty(d.config["source"], "type")
+			if err != nil {
+				return err
+			}
+
+			if poolType != "filesystem" {
+				return fmt.Errorf("Unsupported pool type: %s", poolType)
+			}
+		}
+
+		// Check that the existing zpool or dataset is empty.
+		datasets, err := d.getDatasets(d.config["source"])
+		if err != nil {
+			return err
+		}
+
+		if len(datasets) > 0 {
+			return fmt.Errorf("Provided ZFS pool (or dataset) isn't empty")
+		}
+	}
+
+	// Apply our default configuration.
+	err := d.setDatasetProperties(d.config["zfs.pool_name"], "mountpoint=none", "setuid=on", "exec=on", "devices=on", "acltype=posixacl", "xattr=sa")
+	if err != nil {
+		return err
+	}
+
+	// Create the initial datasets. The snapshots ones are only used by the legacy storage code.
+	for _, dataset := range []string{"containers", "custom", "custom-snapshots", "deleted", "images", "snapshots", "virtual-machines"} {
+		err := d.createDataset(filepath.Join(d.config["zfs.pool_name"], dataset), "mountpoint=none")
+		if err != nil {
+			return err
+		}
+	}
+
+	revert = false
+	return nil
+}
+
+// Delete removes the storage pool from the storage device.
+func (d *zfs) Delete(op *operations.Operation) error {
+	poolName := d.poolName()
+
+	if d.checkDataset(poolName) {
+		if strings.Contains(poolName, "/") {
+			// Delete the dataset.
+			_, err := shared.RunCommand("zfs", "destroy", "-r", poolName)
+			if err != nil {
+				return fmt.Errorf("Failed to delete the ZFS pool: %v", err)
+			}
+		} else {
+			// Delete the zpool.
+			_, err := shared.RunCommand("zpool", "destroy", "-f", poolName)
+			if err != nil {
+				return fmt.Errorf("Failed to delete the ZFS pool: %v", err)
+			}
+		}
+	}
+
+	// Delete the loop file if any.
+	loopPath := filepath.Join(shared.VarPath("disks"), fmt.Sprintf("%s.img", d.name))
+	err := os.Remove(loopPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// On delete, wipe everything in the directory.
+	err = wipeDirectory(GetPoolMountPath(d.name))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Mount imports the zpool if it isn't already, returning true if it was imported.
+func (d *zfs) Mount() (bool, error) {
+	poolName := d.poolName()
+
+	// Check if already imported.
+	if d.checkDataset(poolName) {
+		return false, nil
+	}
+
+	zpoolName := strings.Split(poolName, "/")[0]
+	if d.checkDataset(zpoolName) {
+		return false, fmt.Errorf("ZFS zpool exists but dataset is missing")
+	}
+
+	// Import the zpool, looking for the loop file if that's what the pool uses.
+	var err error
+	if filepath.IsAbs(d.config["source"]) {
+		_, err = shared.RunCommand("zpool", "import", "-d", shared.VarPath("disks"), zpoolName)
+	} else {
+		_, err = shared.RunCommand("zpool", "import", zpoolName)
+	}
+	if err != nil {
+		return false, fmt.Errorf("ZFS storage pool \"%s\" could not be imported: %v", zpoolName, err)
+	}
+
+	if !d.checkDataset(poolName) {
+		return false, fmt.Errorf("ZFS zpool was imported but dataset is missing")
+	}
+
+	return true, nil
+}
+
+// Unmount leaves the zpool imported, as its volumes may still be in use.
+func (d *zfs) Unmount() (bool, error) {
+	return false, nil
+}
+
+// GetResources returns the space used and available in the zpool or dataset.
+func (d *zfs) GetResources() (*api.ResourcesStoragePool, error) {
+	poolName := d.poolName()
+
+	available, err := d.getDatasetProperty(poolName, "available")
+	if err != nil {
+		return nil, err
+	}
+
+	availableBytes, err := strconv.ParseUint(available, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := d.getDatasetProperty(poolName, "used")
+	if err != nil {
+		return nil, err
+	}
+
+	usedBytes, err := strconv.ParseUint(used, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// ZFS allocates inodes dynamically, so they aren't reported.
+	res := api.ResourcesStoragePool{}
+	res.Space.Total = usedBytes + availableBytes
+	res.Space.Used = usedBytes
+
+	return &res, nil
+}
+
+// MigrationTypes returns the type of transfer methods to be used when doing migrations between
+// pools in preference order. ZFS streams are preferred, falling back to rsync for filesystem
+// volumes.
+func (d *zfs) MigrationTypes(contentType ContentType) []migration.Type {
+	if contentType != ContentTypeFS && contentType != ContentTypeBlock {
+		return nil
+	}
+
+	// Compressed streams aren't supported by ZFS 0.6.
+	features := []string{}
+	if !strings.HasPrefix(zfsVersion, "0.6") {
+		features = append(features, "compress")
+	}
+
+	types := []migration.Type{
+		{
+			FSType:   migration.MigrationFSType_ZFS,
+			Features: features,
+		},
+	}
+
+	// The disk image of block volumes lives in a zvol, which rsync can't transfer.
+	if contentType == ContentTypeBlock {
+		return types
+	}
+
+	return append(types, d.common.MigrationTypes(contentType)...)
+}
@@ -0,0 +1,105 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the names of the datasets and zvols of volumes.
+func TestZFSDataset(t *testing.T) {
+	d := &zfs{common{name: "default", config: map[string]string{}}}
+
+	assert.Equal(t, "default/containers/c1", d.dataset(VolumeTypeContainer, "c1", false))
+	assert.Equal(t, "default/containers/c1@snapshot-snap0", d.dataset(VolumeTypeContainer, "c1/snap0", false))
+	assert.Equal(t, "default/virtual-machines/v1.block", d.dataset(VolumeTypeVM, "v1", true))
+	assert.Equal(t, "default/virtual-machines/v1.block@snapshot-snap0", d.dataset(VolumeTypeVM, "v1/snap0", true))
+
+	// Block volumes have a zvol along with their filesystem dataset.
+	vol := NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", nil)
+	assert.Equal(t, []string{"default/custom/vol1"}, d.volumeDatasets(vol))
+
+	vol = NewVolume(d, "default", VolumeTypeCustom, ContentTypeBlock, "vol1", nil)
+	assert.Equal(t, []string{"default/custom/vol1", "default/custom/vol1.block"}, d.volumeDatasets(vol))
+
+	// The pool can be a dataset of a zpool named differently.
+	d.config["zfs.pool_name"] = "tank/lxd"
+	assert.Equal(t, "tank/lxd/images/abc", d.dataset(VolumeTypeImage, "abc", false))
+}
+
+// Test the validation of the ZFS specific volume keys.
+func TestZFSValidateVolume(t *testing.T) {
+	d := &zfs{common{name: "default", config: map[string]string{}, getCommonRules: testCommonRules}}
+
+	config := map[string]string{
+		"size":           "10GB",
+		"user.foo":       "bar",
+		"zfs.atime":      "off",
+		"zfs.logbias":    "throughput",
+		"zfs.recordsize": "128KiB",
+		"zfs.sync":       "always",
+	}
+
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), false))
+
+	invalid := []struct {
+		key   string
+		value string
+	}{
+		{"zfs.atime", "sometimes"},
+		{"zfs.logbias", "fast"},
+		{"zfs.recordsize", "100KiB"},
+		{"zfs.recordsize", "32MiB"},
+		{"zfs.recordsize", "256B"},
+		{"zfs.sync", "never"},
+		{"zfs.unknown", "foo"},
+	}
+
+	for _, tt := range invalid {
+		vol := NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", map[string]string{tt.key: tt.value})
+		assert.Error(t, d.ValidateVolume(vol, false), "%s=%s", tt.key, tt.value)
+	}
+
+	// Unknown keys can be dropped instead.
+	config = map[string]string{"zfs.unknown": "foo"}
+	assert.NoError(t, d.ValidateVolume(NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", config), true))
+	assert.Empty(t, config)
+}
+
+// Test whether the size of volumes is enforced with refquota, from the volume or pool config.
+func TestZFSUseRefquota(t *testing.T) {
+	d := &zfs{common{name: "default", config: map[string]string{}}}
+
+	vol := NewVolume(d, "default", VolumeTypeCustom, ContentTypeFS, "vol1", map[string]string{})
+	assert.False(t, d.useRefquota(vol))
+
+	d.config["volume.zfs.use_refquota"] = "true"
+	assert.True(t, d.useRefquota(vol))
+
+	vol.config["zfs.use_refquota"] = "false"
+	assert.False(t, d.useRefquota(vol))
+}
+
+// Test the choice of the clone promoted for a deleted dataset to be destroyed.
+func TestZFSPromotionTarget(t *testing.T) {
+	assert.Nil(t, zfsParseClones("-"))
+	assert.Nil(t, zfsParseClones(""))
+	assert.Equal(t, []string{"default/containers/c1", "default/containers/c2"}, zfsParseClones("default/containers/c1,default/containers/c2"))
+
+	snapshots := []string{"readonly", "copy-a", "copy-b"}
+
+	// Nothing to promote.
+	clone, moved := zfsPromotionTarget(snapshots, map[string][]string{})
+	assert.Equal(t, "", clone)
+	assert.Nil(t, moved)
+
+	// The clone of the most recent cloned snapshot takes it along with the older ones.
+	clones := map[string][]string{
+		"readonly": {"default/containers/c1"},
+		"copy-a":   {"default/containers/c2", "default/containers/c3"},
+	}
+
+	clone, moved = zfsPromotionTarget(snapshots, clones)
+	assert.Equal(t, "default/containers/c2", clone)
+	assert.Equal(t, []string{"readonly", "copy-a"}, moved)
+}
@@ -0,0 +1,795 @@
+package drivers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/units"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// zfsVolumeProperties maps the volume configuration keys which are passed through to the dataset
+// to the matching ZFS property.
+var zfsVolumeProperties = map[string]string{
+	"zfs.atime":      "atime",
+	"zfs.logbias":    "logbias",
+	"zfs.recordsize": "recordsize",
+	"zfs.sync":       "sync",
+}
+
+// poolName returns the name of the zpool or dataset holding the storage pool.
+func (d *zfs) poolName() string {
+	if d.config["zfs.pool_name"] != "" {
+		return d.config["zfs.pool_name"]
+	}
+
+	return d.name
+}
+
+// dataset returns the name of the dataset of a volume, or of the ZFS snapshot if the volume is a
+// snapshot. If block is true, the name of the zvol holding the disk image of the volume is
+// returned instead.
+func (d *zfs) dataset(volType VolumeType, volName string, block bool) string {
+	parentName, snapName, isSnap := shared.ContainerGetParentAndSnapshotName(volName)
+
+	dataset := filepath.Join(d.poolName(), string(volType), parentName)
+	if block {
+		dataset += zfsBlockVolSuffix
+	}
+
+	if isSnap {
+		dataset = fmt.Sprintf("%s@snapshot-%s", dataset, snapName)
+	}
+
+	return dataset
+}
+
+// volumeDatasets returns the datasets backing a volume: its filesystem dataset and, for block
+// volumes, the zvol holding its disk image.
+func (d *zfs) volumeDatasets(vol Volume) []string {
+	datasets := []string{d.dataset(vol.volType, vol.name, false)}
+	if vol.contentType == ContentTypeBlock {
+		datasets = append(datasets, d.dataset(vol.volType, vol.name, true))
+	}
+
+	return datasets
+}
+
+// existingDatasets returns the datasets backing a volume which exist on the storage device. This
+// is used where the content type of the volume isn't known.
+func (d *zfs) existingDatasets(volType VolumeType, volName string) []string {
+	datasets := []string{}
+	for _, block := range []bool{false, true} {
+		dataset := d.dataset(volType, volName, block)
+		if d.checkDataset(dataset) {
+			datasets = append(datasets, dataset)
+		}
+	}
+
+	return datasets
+}
+
+// checkDataset returns whether the given dataset (or ZFS snapshot) exists.
+func (d *zfs) checkDataset(dataset string) bool {
+	out, err := shared.RunCommand("zfs", "get", "-H", "-o", "name", "type", dataset)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(out) == dataset
+}
+
+// getDatasetProperty returns the value of a property of a dataset (or ZFS snapshot), with sizes
+// in bytes.
+func (d *zfs) getDatasetProperty(dataset string, key string) (string, error) {
+	out, err := shared.RunCommand("zfs", "get", "-H", "-p", "-o", "value", key, dataset)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get property %q of ZFS dataset %q: %v", key, dataset, err)
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// setDatasetProperties sets properties, in the form key=value, on a dataset.
+func (d *zfs) setDatasetProperties(dataset string, options ...string) error {
+	args := append([]string{"set"}, options...)
+	args = append(args, dataset)
+
+	_, err := shared.RunCommand("zfs", args...)
+	if err != nil {
+		return fmt.Errorf("Failed to set properties of ZFS dataset %q: %v", dataset, err)
+	}
+
+	return nil
+}
+
+// createDataset creates a filesystem dataset, along with its missing parents, with the given
+// properties.
+func (d *zfs) createDataset(dataset string, options ...string) error {
+	args := []string{"create", "-p"}
+	for _, option := range options {
+		args = append(args, "-o", option)
+	}
+
+	args = append(args, dataset)
+
+	_, err := shared.RunCommand("zfs", args...)
+	if err != nil {
+		return fmt.Errorf("Failed to create ZFS dataset %q: %v", dataset, err)
+	}
+
+	return nil
+}
+
+// createVolume creates a zvol of the given size, and waits for its device to show up.
+func (d *zfs) createVolume(dataset string, size int64, options ...string) error {
+	args := []string{"create", "-p", "-V", fmt.Sprintf("%d", size)}
+	for _, option := range options {
+		args = append(args, "-o", option)
+	}
+
+	args = append(args, dataset)
+
+	_, err := shared.RunCommand("zfs", args...)
+	if err != nil {
+		return fmt.Errorf("Failed to create ZFS zvol %q: %v", dataset, err)
+	}
+
+	return d.waitDevice(dataset)
+}
+
+// waitDevice waits for the device of a zvol to be created by udev.
+func (d *zfs) waitDevice(dataset string) error {
+	devPath := filepath.Join("/dev/zvol", dataset)
+
+	for i := 0; i < 50; i++ {
+		if shared.PathExists(devPath) {
+			return nil
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	return fmt.Errorf("Timed out waiting for device %q", devPath)
+}
+
+// cloneDataset creates a dataset (or zvol) from a ZFS snapshot. The properties are only applied
+// to the clone.
+func (d *zfs) cloneDataset(snapshot string, dataset string, options ...string) error {
+	args := []string{"clone", "-p"}
+	for _, option := range options {
+		args = append(args, "-o", option)
+	}
+
+	args = append(args, snapshot, dataset)
+
+	_, err := shared.RunCommand("zfs", args...)
+	if err != nil {
+		return fmt.Errorf("Failed to clone ZFS snapshot %q: %v", snapshot, err)
+	}
+
+	if strings.HasSuffix(dataset, zfsBlockVolSuffix) {
+		return d.waitDevice(dataset)
+	}
+
+	return nil
+}
+
+// deleteDataset destroys a dataset (or ZFS snapshot) and its snapshots.
+func (d *zfs) deleteDataset(dataset string) error {
+	// Due to open file descriptors or kernel references, this may fail for a bit.
+	_, err := shared.TryRunCommand("zfs", "destroy", "-r", dataset)
+	if err != nil {
+		return fmt.Errorf("Failed to destroy ZFS dataset %q: %v", dataset, err)
+	}
+
+	return nil
+}
+
+// renameDataset renames a dataset (or ZFS snapshot).
+func (d *zfs) renameDataset(dataset string, newDataset string) error {
+	args := []string{"rename"}
+	if !strings.Contains(dataset, "@") {
+		args = append(args, "-p")
+	}
+
+	args = append(args, dataset, newDataset)
+
+	_, err := shared.RunCommand("zfs", args...)
+	if err != nil {
+		return fmt.Errorf("Failed to rename ZFS dataset %q to %q: %v", dataset, newDataset, err)
+	}
+
+	return nil
+}
+
+// getDatasets returns the datasets below the given one, relative to it.
+func (d *zfs) getDatasets(dataset string) ([]string, error) {
+	out, err := shared.RunCommand("zfs", "list", "-H", "-r", "-o", "name", "-t", "filesystem,volume", dataset)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list ZFS datasets: %v", err)
+	}
+
+	children := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == dataset {
+			continue
+		}
+
+		children = append(children, strings.TrimPrefix(line, dataset+"/"))
+	}
+
+	return children, nil
+}
+
+// getSnapshots returns the names of the ZFS snapshots of a dataset, oldest first.
+func (d *zfs) getSnapshots(dataset string) ([]string, error) {
+	out, err := shared.RunCommand("zfs", "list", "-H", "-d", "1", "-s", "creation", "-o", "name", "-t", "snapshot", dataset)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list snapshots of ZFS dataset %q: %v", dataset, err)
+	}
+
+	snapshots := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, dataset+"@") {
+			continue
+		}
+
+		snapshots = append(snapshots, strings.TrimPrefix(line, dataset+"@"))
+	}
+
+	return snapshots, nil
+}
+
+// zfsParseClones returns the datasets listed in the "clones" property of a ZFS snapshot.
+func zfsParseClones(value string) []string {
+	if value == "" || value == "-" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// getClones returns the datasets cloned from the given ZFS snapshot.
+func (d *zfs) getClones(snapshot string) ([]string, error) {
+	clones, err := d.getDatasetProperty(snapshot, "clones")
+	if err != nil {
+		return nil, err
+	}
+
+	return zfsParseClones(clones), nil
+}
+
+// hasClones returns whether any dataset was cloned from the given ZFS snapshot.
+func (d *zfs) hasClones(snapshot string) (bool, error) {
+	clones, err := d.getClones(snapshot)
+	if err != nil {
+		return false, err
+	}
+
+	return len(clones) > 0, nil
+}
+
+// inUse returns whether any dataset was cloned from one of the ZFS snapshots of a dataset.
+func (d *zfs) inUse(dataset string) (bool, error) {
+	snapshots, err := d.getSnapshots(dataset)
+	if err != nil {
+		return false, err
+	}
+
+	for _, snapshot := range snapshots {
+		clones, err := d.hasClones(fmt.Sprintf("%s@%s", dataset, snapshot))
+		if err != nil {
+			return false, err
+		}
+
+		if clones {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// deleteOriginIfUnused destroys the dataset of the given origin snapshot if it was only kept
+// under "deleted/" for its clones and the last of them is gone, then does the same for its own
+// origin.
+func (d *zfs) deleteOriginIfUnused(origin string) error {
+	if !strings.HasPrefix(origin, filepath.Join(d.poolName(), "deleted")+"/") {
+		return nil
+	}
+
+	dataset := strings.SplitN(origin, "@", 2)[0]
+	if !d.checkDataset(dataset) {
+		return nil
+	}
+
+	used, err := d.inUse(dataset)
+	if err != nil {
+		return err
+	}
+
+	if used {
+		return nil
+	}
+
+	parentOrigin, err := d.getDatasetProperty(dataset, "origin")
+	if err != nil {
+		return err
+	}
+
+	err = d.deleteDataset(dataset)
+	if err != nil {
+		return err
+	}
+
+	return d.deleteOriginIfUnused(parentOrigin)
+}
+
+// zfsPromotionTarget returns the clone to promote for a dataset not to have dependents anymore:
+// the first clone of its most recent snapshot which has any. Promoting it moves that snapshot and
+// the older ones over to the clone, they are returned too. The clone is empty if none of the
+// snapshots were cloned.
+func zfsPromotionTarget(snapshots []string, clones map[string][]string) (string, []string) {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if len(clones[snapshots[i]]) > 0 {
+			return clones[snapshots[i]][0], snapshots[:i+1]
+		}
+	}
+
+	return "", nil
+}
+
+// promoteClones promotes a clone of a dataset kept under "deleted/", so that the dataset can be
+// destroyed. The snapshots moved over to the promoted clone are destroyed as well unless other
+// datasets were cloned from them.
+func (d *zfs) promoteClones(dataset string) error {
+	snapshots, err := d.getSnapshots(dataset)
+	if err != nil {
+		return err
+	}
+
+	clones := map[string][]string{}
+	for _, snapshot := range snapshots {
+		clones[snapshot], err = d.getClones(fmt.Sprintf("%s@%s", dataset, snapshot))
+		if err != nil {
+			return err
+		}
+	}
+
+	clone, moved := zfsPromotionTarget(snapshots, clones)
+	if clone == "" {
+		// Nothing depends on the dataset anymore.
+		origin, err := d.getDatasetProperty(dataset, "origin")
+		if err != nil {
+			return err
+		}
+
+		err = d.deleteDataset(dataset)
+		if err != nil {
+			return err
+		}
+
+		return d.deleteOriginIfUnused(origin)
+	}
+
+	_, err = shared.RunCommand("zfs", "promote", clone)
+	if err != nil {
+		return fmt.Errorf("Failed to promote ZFS dataset %q: %v", clone, err)
+	}
+
+	err = d.deleteDataset(dataset)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range moved {
+		snapshot = fmt.Sprintf("%s@%s", clone, snapshot)
+
+		used, err := d.hasClones(snapshot)
+		if err != nil {
+			return err
+		}
+
+		if used {
+			continue
+		}
+
+		err = d.deleteDataset(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var zfsPromoteLock sync.Mutex
+
+// promoteClonesBackground promotes in the background the clones of a dataset which was just moved
+// under "deleted/", if "zfs.promote_clones" is enabled on the pool.
+func (d *zfs) promoteClonesBackground(dataset string) {
+	if !shared.IsTrue(d.config["zfs.promote_clones"]) {
+		return
+	}
+
+	go func() {
+		zfsPromoteLock.Lock()
+		defer zfsPromoteLock.Unlock()
+
+		err := d.promoteClones(dataset)
+		if err != nil {
+			d.logger.Error("Failed to promote the clones of ZFS dataset", log.Ctx{"dataset": dataset, "err": err})
+			return
+		}
+
+		d.logger.Debug("Promoted the clones of ZFS dataset", log.Ctx{"dataset": dataset})
+	}()
+}
+
+// useRefquota returns whether the size of the volume is enforced with the "refquota" property,
+// which leaves its snapshots out, rather than with "quota".
+func (d *zfs) useRefquota(vol Volume) bool {
+	if vol.config["zfs.use_refquota"] != "" {
+		return shared.IsTrue(vol.config["zfs.use_refquota"])
+	}
+
+	return shared.IsTrue(d.config["volume.zfs.use_refquota"])
+}
+
+// setQuota sets the size of a volume: the quota of its dataset for filesystem volumes, or the
+// size of its zvol for block volumes (which can't be shrunk).
+func (d *zfs) setQuota(vol Volume, size string) error {
+	// If size not specified in volume config, then use pool's default volume.size setting.
+	if size == "" || size == "0" {
+		size = d.config["volume.size"]
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	if vol.contentType == ContentTypeBlock {
+		if sizeBytes <= 0 {
+			return nil
+		}
+
+		dataset := d.dataset(vol.volType, vol.name, true)
+
+		current, err := d.getDatasetProperty(dataset, "volsize")
+		if err != nil {
+			return err
+		}
+
+		currentBytes, err := strconv.ParseInt(current, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if sizeBytes < currentBytes {
+			return Errorf(ErrNotSupported, "Block volumes can't be shrunk")
+		}
+
+		// The size of a zvol must be a multiple of its block size.
+		blockSize, err := d.getDatasetProperty(dataset, "volblocksize")
+		if err != nil {
+			return err
+		}
+
+		blockSizeBytes, err := strconv.ParseInt(blockSize, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if sizeBytes%blockSizeBytes != 0 {
+			sizeBytes += blockSizeBytes - sizeBytes%blockSizeBytes
+		}
+
+		return d.setDatasetProperties(dataset, fmt.Sprintf("volsize=%d", sizeBytes))
+	}
+
+	value := "none"
+	if sizeBytes > 0 {
+		value = fmt.Sprintf("%d", sizeBytes)
+	}
+
+	// Only one of the quota properties is used, the other is reset.
+	property, otherProperty := "quota", "refquota"
+	if d.useRefquota(vol) {
+		property, otherProperty = otherProperty, property
+	}
+
+	dataset := d.dataset(vol.volType, vol.name, false)
+
+	// The quota accounts for snapshots, the refquota only for the dataset itself.
+	usedProperty := "used"
+	if property == "refquota" {
+		usedProperty = "referenced"
+	}
+
+	used, err := d.getDatasetProperty(dataset, usedProperty)
+	if err != nil {
+		return err
+	}
+
+	usedBytes, err := strconv.ParseInt(used, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	err = checkQuotaAboveUsage(sizeBytes, usedBytes)
+	if err != nil {
+		return err
+	}
+
+	return d.setDatasetProperties(dataset, fmt.Sprintf("%s=%s", property, value), fmt.Sprintf("%s=none", otherProperty))
+}
+
+// applyProperties sets the ZFS properties matching the given volume configuration keys (or all
+// those set in the configuration if nil) on a dataset. Unset keys have the property inherited
+// again from the parent dataset.
+func (d *zfs) applyProperties(dataset string, config map[string]string, keys []string) error {
+	if keys == nil {
+		for key := range config {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		property, ok := zfsVolumeProperties[key]
+		if !ok {
+			continue
+		}
+
+		value := config[key]
+		if value == "" {
+			_, err := shared.RunCommand("zfs", "inherit", property, dataset)
+			if err != nil {
+				return fmt.Errorf("Failed to reset ZFS property %q: %v", property, err)
+			}
+
+			continue
+		}
+
+		switch property {
+		case "atime":
+			// Boolean properties use on/off.
+			value = "off"
+			if shared.IsTrue(config[key]) {
+				value = "on"
+			}
+		case "recordsize":
+			sizeBytes, err := units.ParseByteSizeString(value)
+			if err != nil {
+				return err
+			}
+
+			value = fmt.Sprintf("%d", sizeBytes)
+		}
+
+		err := d.setDatasetProperties(dataset, fmt.Sprintf("%s=%s", property, value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyDataset copies a ZFS snapshot into a new dataset using a local send/receive. If recursive
+// is true, the older snapshots of the dataset are copied too. If a parent snapshot is given, only
+// the changes since it are sent and received on top of the existing dataset, rolled back to it.
+// The progress of the stream is reported as a percentage of its estimated size to the progress
+// function, if any.
+func (d *zfs) copyDataset(snapshot string, parent string, dataset string, recursive bool, progress func(int64, int64)) error {
+	sendArgs := []string{}
+	if recursive {
+		sendArgs = append(sendArgs, "-R")
+	}
+
+	if parent != "" {
+		sendArgs = append(sendArgs, "-i", parent)
+	}
+
+	sendArgs = append(sendArgs, snapshot)
+
+	sender := exec.Command("zfs", append([]string{"send"}, sendArgs...)...)
+	receiver := exec.Command("zfs", "receive", "-F", "-u", dataset)
+
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer pipeReader.Close()
+
+	sender.Stdout = pipeWriter
+	receiver.Stdin = pipeReader
+
+	if progress != nil {
+		size := d.sendSize(sendArgs)
+		if size > 0 {
+			receiver.Stdin = &ioprogress.ProgressReader{
+				ReadCloser: pipeReader,
+				Tracker: &ioprogress.ProgressTracker{
+					Length:  size,
+					Handler: progress,
+				},
+			}
+		}
+	}
+
+	var sendStderr, recvStderr bytes.Buffer
+	sender.Stderr = &sendStderr
+	receiver.Stderr = &recvStderr
+
+	err = receiver.Start()
+	if err != nil {
+		pipeWriter.Close()
+		return err
+	}
+
+	err = sender.Start()
+	pipeWriter.Close()
+	if err != nil {
+		receiver.Process.Kill()
+		receiver.Wait()
+		return err
+	}
+
+	// Closing the pipe once the receiver is done stops the sender if the receiver failed early.
+	recvErr := receiver.Wait()
+	pipeReader.Close()
+	sendErr := sender.Wait()
+
+	if sendErr != nil {
+		return fmt.Errorf("Failed to send ZFS snapshot %q: %s: %v", snapshot, strings.TrimSpace(sendStderr.String()), sendErr)
+	}
+
+	if recvErr != nil {
+		return fmt.Errorf("Failed to receive ZFS dataset %q: %s: %v", dataset, strings.TrimSpace(recvStderr.String()), recvErr)
+	}
+
+	if strings.HasSuffix(dataset, zfsBlockVolSuffix) {
+		return d.waitDevice(dataset)
+	}
+
+	return nil
+}
+
+// sendSize returns the size of the send stream with the given arguments, as estimated by a dry
+// run of zfs send, or 0 if it can't be estimated.
+func (d *zfs) sendSize(sendArgs []string) int64 {
+	output, err := shared.RunCommand("zfs", append([]string{"send", "-n", "-P"}, sendArgs...)...)
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "size" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+
+		return size
+	}
+
+	return 0
+}
+
+// sendDataset sends a ZFS snapshot over the connection, as an incremental stream from the parent
+// snapshot if one is given. The end of the stream is signalled by closing the connection.
+func (d *zfs) sendDataset(snapshot string, parent string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker, features []string) error {
+	args := []string{"send"}
+	if shared.StringInSlice("compress", features) {
+		args = append(args, "-c", "-L")
+	}
+
+	if parent != "" {
+		args = append(args, "-i", parent)
+	}
+
+	args = append(args, snapshot)
+
+	cmd := exec.Command("zfs", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// Setup progress tracker.
+	reader := io.ReadCloser(stdout)
+	if tracker != nil {
+		reader = &ioprogress.ProgressReader{
+			ReadCloser: stdout,
+			Tracker:    tracker,
+		}
+	}
+
+	_, err = io.Copy(conn, reader)
+	conn.Close() // Sends barrier message.
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("Failed to send ZFS snapshot %q: %s: %v", snapshot, strings.TrimSpace(stderr.String()), err)
+	}
+
+	return nil
+}
+
+// receiveDataset receives a stream sent by sendDataset into a dataset.
+func (d *zfs) receiveDataset(dataset string, conn io.ReadWriteCloser, tracker *ioprogress.ProgressTracker) error {
+	cmd := exec.Command("zfs", "receive", "-F", "-u", dataset)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// Setup progress tracker.
+	reader := io.ReadCloser(conn)
+	if tracker != nil {
+		reader = &ioprogress.ProgressReader{
+			ReadCloser: conn,
+			Tracker:    tracker,
+		}
+	}
+
+	_, err = io.Copy(stdin, reader)
+	stdin.Close()
+	waitErr := cmd.Wait()
+
+	if waitErr != nil {
+		return fmt.Errorf("Failed to receive ZFS dataset %q: %s: %v", dataset, strings.TrimSpace(stderr.String()), waitErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(dataset, zfsBlockVolSuffix) {
+		return d.waitDevice(dataset)
+	}
+
+	return nil
+}
@@ -0,0 +1,1419 @@
+package drivers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/lxd/rsync"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
+	"github.com/lxc/lxd/shared/ioprogress"
+	"github.com/lxc/lxd/shared/units"
+)
+
+// ValidateVolume validates the supplied volume config.
+func (d *zfs) ValidateVolume(vol Volume, removeUnknownKeys bool) error {
+	rules := map[string]func(value string) error{
+		"zfs.atime":            shared.IsBool,
+		"zfs.delegate":         shared.IsBool,
+		"zfs.remove_snapshots": shared.IsBool,
+		"zfs.use_refquota":     shared.IsBool,
+		"zfs.logbias": func(value string) error {
+			return shared.IsOneOf(value, []string{"", "latency", "throughput"})
+		},
+		"zfs.sync": func(value string) error {
+			return shared.IsOneOf(value, []string{"", "standard", "always", "disabled"})
+		},
+		"zfs.recordsize": func(value string) error {
+			if value == "" {
+				return nil
+			}
+
+			size, err := units.ParseByteSizeString(value)
+			if err != nil {
+				return err
+			}
+
+			// ZFS only accepts powers of two between 512 bytes and 16MiB.
+			if size < 512 || size > 16*1024*1024 || size&(size-1) != 0 {
+				return fmt.Errorf("Invalid record size %q, must be a power of two between 512B and 16MiB", value)
+			}
+
+			return nil
+		},
+	}
+
+	return d.validateVolume(vol, rules, removeUnknownKeys)
+}
+
+// HasVolume indicates whether a specific volume exists on the storage pool.
+func (d *zfs) HasVolume(volType VolumeType, volName string) bool {
+	return d.checkDataset(d.dataset(volType, volName, false))
+}
+
+// GetVolumeDiskPath returns the location and format of the disk image of a block volume.
+func (d *zfs) GetVolumeDiskPath(volType VolumeType, volName string) (string, string, error) {
+	return filepath.Join("/dev/zvol", d.dataset(volType, volName, true)), "raw", nil
+}
+
+// GetVolumeUsage returns the disk space used by the volume.
+func (d *zfs) GetVolumeUsage(vol Volume) (int64, error) {
+	dataset := d.dataset(vol.volType, vol.name, false)
+	if d.checkDataset(d.dataset(vol.volType, vol.name, true)) {
+		dataset = d.dataset(vol.volType, vol.name, true)
+	}
+
+	used, err := d.getDatasetProperty(dataset, "used")
+	if err != nil {
+		return -1, err
+	}
+
+	size, err := strconv.ParseInt(used, 10, 64)
+	if err != nil {
+		return -1, err
+	}
+
+	return size, nil
+}
+
+// CreateVolume creates an empty volume and can optionally fill it by executing the supplied
+// filler function. Image volumes get a read-only snapshot, which volumes are cloned from.
+func (d *zfs) CreateVolume(vol Volume, filler func(mountPath, rootBlockPath string) error, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Images deleted while volumes were still cloned from them are kept under "deleted/", and
+	// can be used again as-is.
+	if vol.volType == VolumeTypeImage {
+		restored, err := d.restoreDeletedImage(vol)
+		if err != nil {
+			return err
+		}
+
+		if restored {
+			return nil
+		}
+	}
+
+	// Create slice of datasets created if revert needed later.
+	revertDatasets := []string{}
+	defer func() {
+		if revertDatasets == nil {
+			return
+		}
+
+		for _, dataset := range revertDatasets {
+			d.deleteDataset(dataset)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	// Create the filesystem dataset. For block volumes, it holds the files next to the disk image.
+	dataset := d.dataset(vol.volType, vol.name, false)
+	err := d.createDataset(dataset, fmt.Sprintf("mountpoint=%s", vol.MountPath()), "canmount=noauto")
+	if err != nil {
+		return err
+	}
+
+	revertDatasets = append(revertDatasets, dataset)
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	err = d.applyProperties(dataset, vol.config, nil)
+	if err != nil {
+		return err
+	}
+
+	rootBlockPath := ""
+	if vol.contentType == ContentTypeBlock {
+		// Extract specified size from pool or volume config.
+		blockSize := d.config["volume.size"]
+		if vol.config["size"] != "" {
+			blockSize = vol.config["size"]
+		}
+
+		if blockSize == "" || blockSize == "0" {
+			blockSize = zfsDefaultBlockSize
+		}
+
+		blockSizeBytes, err := units.ParseByteSizeString(blockSize)
+		if err != nil {
+			return err
+		}
+
+		// We expect the filler to copy the VM image into the zvol's device.
+		blockDataset := d.dataset(vol.volType, vol.name, true)
+		err = d.createVolume(blockDataset, blockSizeBytes)
+		if err != nil {
+			return err
+		}
+
+		revertDatasets = append(revertDatasets, blockDataset)
+
+		rootBlockPath, _, err = d.GetVolumeDiskPath(vol.volType, vol.name)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = d.setQuota(vol, vol.config["size"])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Run the volume filler function if supplied.
+	if filler != nil {
+		err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+			return filler(mountPath, rootBlockPath)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Freeze image volumes and take the snapshot they are cloned from.
+	if vol.volType == VolumeTypeImage {
+		for _, dataset := range d.volumeDatasets(vol) {
+			err = d.setDatasetProperties(dataset, "readonly=on")
+			if err != nil {
+				return err
+			}
+
+			_, err = shared.RunCommand("zfs", "snapshot", fmt.Sprintf("%s@readonly", dataset))
+			if err != nil {
+				return fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+			}
+		}
+	}
+
+	revertDatasets = nil
+	return nil
+}
+
+// restoreDeletedImage moves an image volume kept under "deleted/" back in place, returning false
+// if there's no such volume.
+func (d *zfs) restoreDeletedImage(vol Volume) (bool, error) {
+	deletedDataset := filepath.Join(d.poolName(), "deleted", string(vol.volType), vol.name)
+	if !d.checkDataset(deletedDataset) {
+		return false, nil
+	}
+
+	for _, dataset := range d.volumeDatasets(vol) {
+		deletedDataset := filepath.Join(d.poolName(), "deleted", strings.TrimPrefix(dataset, d.poolName()+"/"))
+		err := d.renameDataset(deletedDataset, dataset)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err := d.setDatasetProperties(d.dataset(vol.volType, vol.name, false), fmt.Sprintf("mountpoint=%s", vol.MountPath()))
+	if err != nil {
+		return false, err
+	}
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CreateVolumeFromCopy provides same-pool volume copying functionality. Image volumes are always
+// cloned. Other volumes are cloned too unless their snapshots are copied or "zfs.clone_copy" is
+// disabled on the pool, in which case their datasets are copied in full with ZFS streams.
+func (d *zfs) CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error {
+	if vol.contentType != srcVol.contentType || (vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock) {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	// Snapshots can't be copied from a snapshot.
+	copySnapshots = copySnapshots && !srcVol.IsSnapshot()
+	cloneCopy := d.config["zfs.clone_copy"] == "" || shared.IsTrue(d.config["zfs.clone_copy"])
+	clone := srcVol.volType == VolumeTypeImage || (!copySnapshots && cloneCopy)
+
+	// Create slice of datasets created if revert needed later.
+	revertDatasets := []string{}
+	defer func() {
+		if revertDatasets == nil {
+			return
+		}
+
+		for _, dataset := range revertDatasets {
+			d.deleteDataset(dataset)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	// Volumes other than images and snapshots are copied from a new snapshot. It is kept for
+	// clones, which depend on it.
+	copySnapName := fmt.Sprintf("copy-%s", uuid.NewRandom().String())
+
+	srcDatasets := d.volumeDatasets(srcVol)
+	for i, dataset := range d.volumeDatasets(vol) {
+		srcSnapshot := srcDatasets[i]
+		if srcVol.volType == VolumeTypeImage {
+			srcSnapshot = fmt.Sprintf("%s@readonly", srcDatasets[i])
+		} else if !srcVol.IsSnapshot() {
+			srcSnapshot = fmt.Sprintf("%s@%s", srcDatasets[i], copySnapName)
+
+			_, err := shared.RunCommand("zfs", "snapshot", srcSnapshot)
+			if err != nil {
+				return fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+			}
+
+			if !clone {
+				defer d.deleteDataset(srcSnapshot)
+			}
+		}
+
+		options := []string{}
+		if i == 0 {
+			options = append(options, fmt.Sprintf("mountpoint=%s", vol.MountPath()), "canmount=noauto")
+		}
+
+		if clone {
+			err := d.cloneDataset(srcSnapshot, dataset, options...)
+			if err != nil {
+				return err
+			}
+
+			revertDatasets = append(revertDatasets, dataset)
+			continue
+		}
+
+		err := d.copyDataset(srcSnapshot, "", dataset, copySnapshots, copyProgress(op, srcVol.name))
+		if err != nil {
+			return err
+		}
+
+		revertDatasets = append(revertDatasets, dataset)
+
+		// Only keep the snapshots of the volume.
+		snapshots, err := d.getSnapshots(dataset)
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range snapshots {
+			if strings.HasPrefix(snapshot, "snapshot-") {
+				continue
+			}
+
+			err = d.deleteDataset(fmt.Sprintf("%s@%s", dataset, snapshot))
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(options) > 0 {
+			err = d.setDatasetProperties(dataset, options...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Volumes copied from images aren't read-only.
+	if srcVol.volType == VolumeTypeImage {
+		for _, dataset := range d.volumeDatasets(vol) {
+			_, err := shared.RunCommand("zfs", "inherit", "readonly", dataset)
+			if err != nil {
+				return fmt.Errorf("Failed to reset ZFS property \"readonly\": %v", err)
+			}
+		}
+	}
+
+	err := vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	// Create the mount paths of the copied snapshots.
+	if copySnapshots {
+		snapshots, err := vol.Snapshots(op)
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range snapshots {
+			err = snapshot.CreateMountPath()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = d.applyProperties(d.dataset(vol.volType, vol.name, false), vol.config, nil)
+	if err != nil {
+		return err
+	}
+
+	if vol.config["size"] != "" {
+		err = d.setQuota(vol, vol.config["size"])
+		if err != nil {
+			return err
+		}
+	}
+
+	revertDatasets = nil
+	return nil
+}
+
+// RefreshVolume brings an existing volume up to date with another volume. Within the pool, the
+// missing snapshots and then the current content of the source are received as incremental streams
+// on top of the most recent snapshot of the volume, as long as the source has it too. The content
+// of the volumes is synced otherwise.
+func (d *zfs) RefreshVolume(vol Volume, srcVol Volume, srcSnapshots []string, op *operations.Operation) error {
+	if vol.pool != srcVol.pool || vol.contentType != srcVol.contentType {
+		return d.common.RefreshVolume(vol, srcVol, srcSnapshots, op)
+	}
+
+	snapshots, err := d.VolumeSnapshots(vol.volType, vol.name, op)
+	if err != nil {
+		return err
+	}
+
+	srcAllSnapshots, err := d.VolumeSnapshots(srcVol.volType, srcVol.name, op)
+	if err != nil {
+		return err
+	}
+
+	parent := refreshBaseSnapshot(snapshots, srcAllSnapshots, srcSnapshots)
+	if parent == "" {
+		return d.common.RefreshVolume(vol, srcVol, srcSnapshots, op)
+	}
+
+	// Create slice of snapshots received if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+	}()
+
+	datasets := d.volumeDatasets(vol)
+	srcDatasets := d.volumeDatasets(srcVol)
+
+	for _, snapName := range srcSnapshots {
+		for i, dataset := range datasets {
+			srcSnapshot := fmt.Sprintf("%s@snapshot-%s", srcDatasets[i], snapName)
+			parentSnapshot := fmt.Sprintf("%s@snapshot-%s", srcDatasets[i], parent)
+
+			err = d.copyDataset(srcSnapshot, parentSnapshot, dataset, false, copyProgress(op, GetSnapshotVolumeName(srcVol.name, snapName)))
+			if err != nil {
+				return err
+			}
+		}
+
+		revertSnaps = append(revertSnaps, snapName)
+		parent = snapName
+
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		err = snapshot.CreateMountPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The current content of the source is sent from a temporary snapshot, received on both sides.
+	refreshSnapName := fmt.Sprintf("refresh-%s", uuid.NewRandom().String())
+
+	for i, dataset := range datasets {
+		srcSnapshot := fmt.Sprintf("%s@%s", srcDatasets[i], refreshSnapName)
+		parentSnapshot := fmt.Sprintf("%s@snapshot-%s", srcDatasets[i], parent)
+
+		_, err := shared.RunCommand("zfs", "snapshot", srcSnapshot)
+		if err != nil {
+			return fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+		}
+
+		err = d.copyDataset(srcSnapshot, parentSnapshot, dataset, false, copyProgress(op, srcVol.name))
+		d.deleteDataset(srcSnapshot)
+		if err != nil {
+			return err
+		}
+
+		err = d.deleteDataset(fmt.Sprintf("%s@%s", dataset, refreshSnapName))
+		if err != nil {
+			return err
+		}
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// MigrateVolume sends a volume for migration.
+func (d *zfs) MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volSrcArgs.MigrationType.FSType == migration.MigrationFSType_RSYNC && vol.contentType == ContentTypeFS {
+		return d.migrateVolumeRsync(vol, conn, volSrcArgs, op)
+	}
+
+	if volSrcArgs.MigrationType.FSType != migration.MigrationFSType_ZFS {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	features := volSrcArgs.MigrationType.Features
+
+	// Send a snapshot on its own.
+	if vol.IsSnapshot() {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		for _, snapshot := range d.volumeDatasets(vol) {
+			err := d.sendDataset(snapshot, "", conn, wrapper, features)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	datasets := d.volumeDatasets(vol)
+
+	// Send the snapshots from oldest to newest, each as an incremental stream from the previous
+	// one.
+	parentSnapName := ""
+	for _, snapName := range volSrcArgs.Snapshots {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+		}
+
+		for _, dataset := range datasets {
+			parent := ""
+			if parentSnapName != "" {
+				parent = fmt.Sprintf("%s@%s", dataset, parentSnapName)
+			}
+
+			err := d.sendDataset(fmt.Sprintf("%s@snapshot-%s", dataset, snapName), parent, conn, wrapper, features)
+			if err != nil {
+				return err
+			}
+		}
+
+		parentSnapName = fmt.Sprintf("snapshot-%s", snapName)
+	}
+
+	// Send the current state of the volume from a temporary snapshot.
+	migrationSnapName := fmt.Sprintf("migration-send-%s", uuid.NewRandom().String())
+	for _, dataset := range datasets {
+		snapshot := fmt.Sprintf("%s@%s", dataset, migrationSnapName)
+
+		_, err := shared.RunCommand("zfs", "snapshot", snapshot)
+		if err != nil {
+			return fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+		}
+
+		defer d.deleteDataset(snapshot)
+	}
+
+	var wrapper *ioprogress.ProgressTracker
+	if volSrcArgs.TrackProgress {
+		wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+	}
+
+	for _, dataset := range datasets {
+		parent := ""
+		if parentSnapName != "" {
+			parent = fmt.Sprintf("%s@%s", dataset, parentSnapName)
+		}
+
+		err := d.sendDataset(fmt.Sprintf("%s@%s", dataset, migrationSnapName), parent, conn, wrapper, features)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateVolumeRsync sends a filesystem volume and its snapshots using rsync.
+func (d *zfs) migrateVolumeRsync(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error {
+	bwlimit := d.config["rsync.bwlimit"]
+
+	for _, snapName := range volSrcArgs.Snapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		// Send snapshot to recipient (ensure local snapshot volume is mounted if needed).
+		err = snapshot.MountTask(func(mountPath string, op *operations.Operation) error {
+			var wrapper *ioprogress.ProgressTracker
+			if volSrcArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapshot.name)
+			}
+
+			path := shared.AddSlash(mountPath)
+			return rsync.Send(snapshot.name, path, conn, wrapper, volSrcArgs.MigrationType.Features, bwlimit, d.state.OS.ExecPath)
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send volume to recipient (ensure local volume is mounted if needed).
+	return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		var wrapper *ioprogress.ProgressTracker
+		if volSrcArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		path := shared.AddSlash(mountPath)
+		return rsync.Send(vol.name, path, conn, wrapper, volSrcArgs.MigrationType.Features, bwlimit, d.state.OS.ExecPath)
+	}, op)
+}
+
+// CreateVolumeFromMigration creates a volume being sent via a migration.
+func (d *zfs) CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	if volTargetArgs.MigrationType.FSType == migration.MigrationFSType_RSYNC && vol.contentType == ContentTypeFS {
+		return d.createVolumeFromMigrationRsync(vol, conn, volTargetArgs, op)
+	}
+
+	if volTargetArgs.MigrationType.FSType != migration.MigrationFSType_ZFS {
+		return Errorf(ErrNotSupported, "Migration type not supported")
+	}
+
+	datasets := d.volumeDatasets(vol)
+
+	// Create slice of datasets created if revert needed later.
+	revertDatasets := []string{}
+	defer func() {
+		if revertDatasets == nil {
+			return
+		}
+
+		for _, dataset := range revertDatasets {
+			d.deleteDataset(dataset)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	// Snapshots are sent first by the sender, so receive these first.
+	for i, snapName := range volTargetArgs.Snapshots {
+		var wrapper *ioprogress.ProgressTracker
+		if volTargetArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+		}
+
+		for _, dataset := range datasets {
+			err := d.receiveDataset(dataset, conn, wrapper)
+			if err != nil {
+				return err
+			}
+
+			if i == 0 {
+				revertDatasets = append(revertDatasets, dataset)
+			}
+		}
+	}
+
+	// Receive the main volume from sender.
+	var wrapper *ioprogress.ProgressTracker
+	if volTargetArgs.TrackProgress {
+		wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+	}
+
+	for _, dataset := range datasets {
+		err := d.receiveDataset(dataset, conn, wrapper)
+		if err != nil {
+			return err
+		}
+
+		if len(volTargetArgs.Snapshots) == 0 {
+			revertDatasets = append(revertDatasets, dataset)
+		}
+	}
+
+	err := d.setupReceivedVolume(vol, volTargetArgs.Snapshots)
+	if err != nil {
+		return err
+	}
+
+	revertDatasets = nil
+	return nil
+}
+
+// setupReceivedVolume sets up a volume whose datasets were received from send streams, removing
+// the temporary snapshots the streams came from and creating the mount paths of the volume and
+// of its snapshots.
+func (d *zfs) setupReceivedVolume(vol Volume, snapshots []string) error {
+	datasets := d.volumeDatasets(vol)
+
+	// Only keep the snapshots of the volume.
+	for _, dataset := range datasets {
+		datasetSnapshots, err := d.getSnapshots(dataset)
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range datasetSnapshots {
+			if strings.HasPrefix(snapshot, "snapshot-") {
+				continue
+			}
+
+			err = d.deleteDataset(fmt.Sprintf("%s@%s", dataset, snapshot))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Setup the mount paths.
+	err := d.setDatasetProperties(datasets[0], fmt.Sprintf("mountpoint=%s", vol.MountPath()), "canmount=noauto")
+	if err != nil {
+		return err
+	}
+
+	err = vol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	for _, snapName := range snapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		err = snapshot.CreateMountPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.applyProperties(datasets[0], vol.config, nil)
+	if err != nil {
+		return err
+	}
+
+	if vol.config["size"] != "" {
+		err = d.setQuota(vol, vol.config["size"])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createVolumeFromMigrationRsync creates a filesystem volume and its snapshots from rsync
+// transfers.
+func (d *zfs) createVolumeFromMigrationRsync(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error {
+	err := d.CreateVolume(vol, nil, op)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			d.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		d.DeleteVolume(vol.volType, vol.name, op)
+	}()
+
+	// Ensure the volume is mounted.
+	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		path := shared.AddSlash(mountPath)
+
+		// Snapshots are sent first by the sender, so create these first.
+		for _, snapName := range volTargetArgs.Snapshots {
+			// Receive the snapshot
+			var wrapper *ioprogress.ProgressTracker
+			if volTargetArgs.TrackProgress {
+				wrapper = migration.ProgressTracker(op, "fs_progress", snapName)
+			}
+
+			err := rsync.Recv(path, conn, wrapper, volTargetArgs.MigrationType.Features)
+			if err != nil {
+				return err
+			}
+
+			// Create the snapshot itself.
+			err = d.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+			if err != nil {
+				return err
+			}
+
+			// Setup the revert.
+			revertSnaps = append(revertSnaps, snapName)
+		}
+
+		// Receive the main volume from sender.
+		var wrapper *ioprogress.ProgressTracker
+		if volTargetArgs.TrackProgress {
+			wrapper = migration.ProgressTracker(op, "fs_progress", vol.name)
+		}
+
+		return rsync.Recv(path, conn, wrapper, volTargetArgs.MigrationType.Features)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// BackupVolume writes a backup of a volume and of the given snapshots to the tarball. Optimized
+// backups hold the ZFS send streams of the snapshots, each incremental from the previous one,
+// followed by the stream of the current state of the volume.
+func (d *zfs) BackupVolume(vol Volume, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error {
+	if !optimized {
+		return genericBackupVolume(vol, tarWriter, snapshots, op)
+	}
+
+	if vol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be backed up")
+	}
+
+	// The streams are staged on disk as the tarball needs their size ahead of their content.
+	tmpDir, err := ioutil.TempDir(shared.VarPath("backups"), "lxd_backup_zfs_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sendToTarball := func(snapshot string, parent string, name string, description string) error {
+		tmpPath := filepath.Join(tmpDir, filepath.Base(name))
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+
+		// The file is closed once the stream is sent.
+		err = d.sendDataset(snapshot, parent, f, backupProgress(op, description), nil)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Lstat(tmpPath)
+		if err != nil {
+			return err
+		}
+
+		err = tarWriter.WriteFileAs(name, tmpPath, fi)
+		if err != nil {
+			return err
+		}
+
+		return os.Remove(tmpPath)
+	}
+
+	dataset := d.dataset(vol.volType, vol.name, false)
+
+	parent := ""
+	for _, snapName := range snapshots {
+		snapshot := fmt.Sprintf("%s@snapshot-%s", dataset, snapName)
+
+		err := sendToTarball(snapshot, parent, fmt.Sprintf("backup/snapshots/%s.bin", snapName), snapName)
+		if err != nil {
+			return err
+		}
+
+		parent = snapshot
+	}
+
+	// Send the current state of the volume from a temporary snapshot.
+	backupSnapshot := fmt.Sprintf("%s@backup-%s", dataset, uuid.NewRandom().String())
+	_, err = shared.RunCommand("zfs", "snapshot", backupSnapshot)
+	if err != nil {
+		return fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+	}
+	defer d.deleteDataset(backupSnapshot)
+
+	return sendToTarball(backupSnapshot, parent, fmt.Sprintf("backup/%s.bin", backupVolumeName(vol)), vol.name)
+}
+
+// CreateVolumeFromBackup creates a volume and the given snapshots from a backup written by
+// BackupVolume.
+func (d *zfs) CreateVolumeFromBackup(vol Volume, snapshots []string, srcData io.ReadSeeker, optimized bool, op *operations.Operation) error {
+	if !optimized {
+		return genericCreateVolumeFromBackup(vol, snapshots, srcData, op)
+	}
+
+	if vol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be restored from a backup")
+	}
+
+	tmpDir, err := ioutil.TempDir(shared.VarPath("backups"), "lxd_restore_zfs_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = unpackBackup(srcData, "backup", 1, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	dataset := d.dataset(vol.volType, vol.name, false)
+
+	revert := true
+	defer func() {
+		if !revert {
+			return
+		}
+
+		if d.checkDataset(dataset) {
+			d.deleteDataset(dataset)
+		}
+
+		os.RemoveAll(vol.MountPath())
+	}()
+
+	receive := func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return d.receiveDataset(dataset, f, nil)
+	}
+
+	// Receive the snapshots from oldest to newest, then the volume itself.
+	for _, snapName := range snapshots {
+		err := receive(filepath.Join(tmpDir, "snapshots", fmt.Sprintf("%s.bin", snapName)))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = receive(filepath.Join(tmpDir, fmt.Sprintf("%s.bin", backupVolumeName(vol))))
+	if err != nil {
+		return err
+	}
+
+	err = d.setupReceivedVolume(vol, snapshots)
+	if err != nil {
+		return err
+	}
+
+	revert = false
+	return nil
+}
+
+// VolumeSnapshots returns a list of snapshots for the volume.
+func (d *zfs) VolumeSnapshots(volType VolumeType, volName string, op *operations.Operation) ([]string, error) {
+	snapshots := []string{}
+
+	dataset := d.dataset(volType, volName, false)
+	if !d.checkDataset(dataset) {
+		return snapshots, nil
+	}
+
+	zfsSnapshots, err := d.getSnapshots(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave out the snapshots which are only used internally.
+	for _, snapshot := range zfsSnapshots {
+		if !strings.HasPrefix(snapshot, "snapshot-") {
+			continue
+		}
+
+		snapshots = append(snapshots, strings.TrimPrefix(snapshot, "snapshot-"))
+	}
+
+	return snapshots, nil
+}
+
+// UpdateVolume applies config changes to the volume.
+func (d *zfs) UpdateVolume(vol Volume, changedConfig map[string]string) error {
+	if vol.contentType != ContentTypeFS && vol.contentType != ContentTypeBlock {
+		return Errorf(ErrNotSupported, "Content type not supported")
+	}
+
+	_, sizeChanged := changedConfig["size"]
+	_, refquotaChanged := changedConfig["zfs.use_refquota"]
+	if sizeChanged || refquotaChanged {
+		size := vol.config["size"]
+		if sizeChanged {
+			size = changedConfig["size"]
+		}
+
+		err := d.setQuota(vol, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := []string{}
+	for key := range changedConfig {
+		keys = append(keys, key)
+	}
+
+	return d.applyProperties(d.dataset(vol.volType, vol.name, false), changedConfig, keys)
+}
+
+// RenameVolume renames a volume and its snapshots.
+func (d *zfs) RenameVolume(volType VolumeType, volName string, newVolName string, op *operations.Operation) error {
+	vol := NewVolume(d, d.name, volType, ContentTypeFS, volName, nil)
+	newVol := NewVolume(d, d.name, volType, ContentTypeFS, newVolName, nil)
+
+	// Make sure the volume isn't mounted, as its mount path changes.
+	_, err := forceUnmount(vol.MountPath())
+	if err != nil {
+		return err
+	}
+
+	type datasetRevert struct {
+		oldName string
+		newName string
+	}
+
+	// Create slice to record datasets renamed if revert needed later.
+	revertDatasets := []datasetRevert{}
+	defer func() {
+		// Rename back any datasets if we are reverting.
+		for _, dataset := range revertDatasets {
+			d.renameDataset(dataset.newName, dataset.oldName)
+		}
+
+		if len(revertDatasets) > 0 {
+			d.setDatasetProperties(d.dataset(volType, volName, false), fmt.Sprintf("mountpoint=%s", vol.MountPath()))
+		}
+	}()
+
+	// Renaming the datasets renames their snapshots too.
+	for _, dataset := range d.existingDatasets(volType, volName) {
+		newDataset := d.dataset(volType, newVolName, strings.HasSuffix(dataset, zfsBlockVolSuffix))
+
+		err := d.renameDataset(dataset, newDataset)
+		if err != nil {
+			return err
+		}
+
+		revertDatasets = append(revertDatasets, datasetRevert{
+			oldName: dataset,
+			newName: newDataset,
+		})
+	}
+
+	err = d.setDatasetProperties(d.dataset(volType, newVolName, false), fmt.Sprintf("mountpoint=%s", newVol.MountPath()))
+	if err != nil {
+		return err
+	}
+
+	// Move the mount paths of the volume and of its snapshots.
+	err = newVol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(vol.MountPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	oldSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	newSnapshotDir, err := GetVolumeSnapshotDir(d.name, volType, newVolName)
+	if err != nil {
+		return err
+	}
+
+	if shared.PathExists(oldSnapshotDir) {
+		err = os.Rename(oldSnapshotDir, newSnapshotDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	revertDatasets = nil
+	return nil
+}
+
+// RestoreVolume restores a volume from a snapshot. ZFS can only roll back to the most recent
+// snapshot, so this fails if the volume has newer snapshots, unless force is true in which case
+// they are destroyed.
+func (d *zfs) RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(vol.volType, vol.name, op)
+	if err != nil {
+		return err
+	}
+
+	if !shared.StringInSlice(snapshotName, snapshots) {
+		return Errorf(ErrNotFound, "Snapshot not found")
+	}
+
+	if snapshots[len(snapshots)-1] != snapshotName && !force {
+		return Errorf(ErrInUse, "ZFS can only restore from the latest snapshot. Delete newer snapshots, set zfs.remove_snapshots or copy the snapshot into a new volume instead")
+	}
+
+	// The snapshots newer than the restored one, including those only used internally, are
+	// destroyed.
+	for _, dataset := range d.volumeDatasets(vol) {
+		_, err := shared.TryRunCommand("zfs", "rollback", "-r", fmt.Sprintf("%s@snapshot-%s", dataset, snapshotName))
+		if err != nil {
+			return fmt.Errorf("Failed to restore ZFS snapshot: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteVolume deletes a volume of the storage device. If any snapshots of the volume remain then
+// this function will return an error. Datasets which other volumes were cloned from are moved
+// under "deleted/" until those volumes are gone, or until their clones are promoted if
+// "zfs.promote_clones" is enabled.
+func (d *zfs) DeleteVolume(volType VolumeType, volName string, op *operations.Operation) error {
+	snapshots, err := d.VolumeSnapshots(volType, volName, op)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) > 0 {
+		return Errorf(ErrInUse, "Cannot remove a volume that has snapshots")
+	}
+
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	_, err = forceUnmount(volPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dataset := range d.existingDatasets(volType, volName) {
+		used, err := d.inUse(dataset)
+		if err != nil {
+			return err
+		}
+
+		if used {
+			// Images keep their name, so they can be restored if created again.
+			deletedName := uuid.NewRandom().String()
+			if volType == VolumeTypeImage {
+				deletedName = volName
+			}
+
+			if strings.HasSuffix(dataset, zfsBlockVolSuffix) {
+				deletedName += zfsBlockVolSuffix
+			} else {
+				err = d.setDatasetProperties(dataset, "mountpoint=none")
+				if err != nil {
+					return err
+				}
+			}
+
+			deletedDataset := filepath.Join(d.poolName(), "deleted", string(volType), deletedName)
+			err = d.renameDataset(dataset, deletedDataset)
+			if err != nil {
+				return err
+			}
+
+			d.promoteClonesBackground(deletedDataset)
+
+			continue
+		}
+
+		origin, err := d.getDatasetProperty(dataset, "origin")
+		if err != nil {
+			return err
+		}
+
+		err = d.deleteDataset(dataset)
+		if err != nil {
+			return err
+		}
+
+		// Remove the dataset this one was cloned from if it was only kept around for it.
+		err = d.deleteOriginIfUnused(origin)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the volume's mount path.
+	err = os.RemoveAll(volPath)
+	if err != nil {
+		return err
+	}
+
+	// Although the volume snapshot directory should already be removed, lets remove it here
+	// to just in case the top-level directory is left.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MountVolume mounts the filesystem dataset of a volume, returns true if we caused a new mount.
+func (d *zfs) MountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	volPath := GetVolumeMountPath(d.name, volType, volName)
+
+	// Check if already mounted.
+	if shared.IsMountPoint(volPath) {
+		return false, nil
+	}
+
+	dataset := d.dataset(volType, volName, false)
+	err := tryMount(dataset, volPath, "zfs", 0, fmt.Sprintf("rw,zfsutil,mntpoint=%s", volPath))
+	if err != nil {
+		return false, fmt.Errorf("Failed to mount ZFS dataset %q onto %q: %v", dataset, volPath, err)
+	}
+
+	return true, nil
+}
+
+// MountVolumeSnapshot mounts a ZFS snapshot, which is read-only.
+func (d *zfs) MountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, GetSnapshotVolumeName(volName, snapshotName), nil)
+	snapPath := snapVol.MountPath()
+
+	// Check if already mounted.
+	if shared.IsMountPoint(snapPath) {
+		return false, nil
+	}
+
+	err := snapVol.CreateMountPath()
+	if err != nil {
+		return false, err
+	}
+
+	snapshot := d.dataset(volType, snapVol.name, false)
+	err = tryMount(snapshot, snapPath, "zfs", unix.MS_RDONLY, "")
+	if err != nil {
+		return false, fmt.Errorf("Failed to mount ZFS snapshot %q onto %q: %v", snapshot, snapPath, err)
+	}
+
+	return true, nil
+}
+
+// UnmountVolume unmounts the filesystem dataset of a volume, returns true if unmounted, false if
+// was not mounted.
+func (d *zfs) UnmountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error) {
+	return forceUnmount(GetVolumeMountPath(d.name, volType, volName))
+}
+
+// UnmountVolumeSnapshot unmounts a ZFS snapshot.
+func (d *zfs) UnmountVolumeSnapshot(volType VolumeType, volName, snapshotName string, op *operations.Operation) (bool, error) {
+	return forceUnmount(GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName)))
+}
+
+// SetVolumeQuota sets the quota on the volume.
+func (d *zfs) SetVolumeQuota(volType VolumeType, volName, size string, op *operations.Operation) error {
+	contentType := ContentTypeFS
+	if d.checkDataset(d.dataset(volType, volName, true)) {
+		contentType = ContentTypeBlock
+	}
+
+	return d.setQuota(NewVolume(d, d.name, volType, contentType, volName, nil), size)
+}
+
+// CheckVolume reads the whole content of the datasets of a volume from temporary snapshots, which
+// verifies the checksums of all their blocks, and reports the files of the datasets in which the
+// pool found permanent errors.
+func (d *zfs) CheckVolume(vol Volume, op *operations.Operation) (*api.StorageVolumeCheck, error) {
+	result := &api.StorageVolumeCheck{
+		Tool:   "zfs send",
+		Clean:  true,
+		Errors: []string{},
+	}
+
+	datasets := d.volumeDatasets(vol)
+	for _, dataset := range datasets {
+		snapshot := fmt.Sprintf("%s@check-%s", dataset, uuid.NewRandom().String())
+		_, err := shared.RunCommand("zfs", "snapshot", snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+		}
+
+		cmd := exec.Command("zfs", "send", snapshot)
+		cmd.Stdout = ioutil.Discard
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		err = cmd.Run()
+		d.deleteDataset(snapshot)
+		if err != nil {
+			_, ok := err.(*exec.ExitError)
+			if !ok {
+				return nil, err
+			}
+
+			result.Clean = false
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", dataset, strings.TrimSpace(stderr.String())))
+		}
+	}
+
+	// The pool lists the files hit by the errors it couldn't repair, by path or by dataset.
+	zpoolName := strings.SplitN(d.poolName(), "/", 2)[0]
+	out, err := shared.RunCommand("zpool", "status", "-v", zpoolName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the status of ZFS pool %q: %v", zpoolName, err)
+	}
+
+	result.Output = strings.TrimSpace(out)
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+
+		for _, dataset := range datasets {
+			if strings.HasPrefix(line, dataset+":") || strings.HasPrefix(line, vol.MountPath()+"/") {
+				result.Clean = false
+				result.Errors = append(result.Errors, line)
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// CreateVolumeSnapshot creates a snapshot of a volume.
+func (d *zfs) CreateVolumeSnapshot(volType VolumeType, volName string, newSnapshotName string, op *operations.Operation) error {
+	snapVol := NewVolume(d, d.name, volType, ContentTypeFS, GetSnapshotVolumeName(volName, newSnapshotName), nil)
+
+	// Create slice of ZFS snapshots created if revert needed later.
+	revertSnapshots := []string{}
+	defer func() {
+		for _, snapshot := range revertSnapshots {
+			d.deleteDataset(snapshot)
+		}
+	}()
+
+	for _, dataset := range d.existingDatasets(volType, volName) {
+		snapshot := fmt.Sprintf("%s@snapshot-%s", dataset, newSnapshotName)
+
+		_, err := shared.RunCommand("zfs", "snapshot", snapshot)
+		if err != nil {
+			return fmt.Errorf("Failed to create ZFS snapshot: %v", err)
+		}
+
+		revertSnapshots = append(revertSnapshots, snapshot)
+	}
+
+	// Create snapshot mount path.
+	err := snapVol.CreateMountPath()
+	if err != nil {
+		return err
+	}
+
+	revertSnapshots = nil
+	return nil
+}
+
+// DeleteVolumeSnapshot removes a snapshot from the storage device. The volName and snapshotName
+// must be bare names and should not be in the format "volume/snapshot". ZFS snapshots which
+// other volumes were cloned from are renamed out of the way until those volumes are gone.
+func (d *zfs) DeleteVolumeSnapshot(volType VolumeType, volName string, snapshotName string, op *operations.Operation) error {
+	snapPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+
+	_, err := forceUnmount(snapPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dataset := range d.existingDatasets(volType, volName) {
+		snapshot := fmt.Sprintf("%s@snapshot-%s", dataset, snapshotName)
+		if !d.checkDataset(snapshot) {
+			continue
+		}
+
+		clones, err := d.hasClones(snapshot)
+		if err != nil {
+			return err
+		}
+
+		if clones {
+			err = d.renameDataset(snapshot, fmt.Sprintf("%s@copy-%s", dataset, uuid.NewRandom().String()))
+		} else {
+			err = d.deleteDataset(snapshot)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the snapshot mount path.
+	err = os.RemoveAll(snapPath)
+	if err != nil {
+		return err
+	}
+
+	// Remove the parent snapshot directory if this is the last snapshot being removed.
+	err = deleteParentSnapshotDirIfEmpty(d.name, volType, volName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameVolumeSnapshot renames a volume snapshot.
+func (d *zfs) RenameVolumeSnapshot(volType VolumeType, volName string, snapshotName string, newSnapshotName string, op *operations.Operation) error {
+	oldPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, snapshotName))
+	newPath := GetVolumeMountPath(d.name, volType, GetSnapshotVolumeName(volName, newSnapshotName))
+
+	_, err := forceUnmount(oldPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dataset := range d.existingDatasets(volType, volName) {
+		err := d.renameDataset(fmt.Sprintf("%s@snapshot-%s", dataset, snapshotName), fmt.Sprintf("%s@snapshot-%s", dataset, newSnapshotName))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,6 +2,12 @@ package drivers
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/shared/api"
 )
 
 // ErrNotImplemented is the "Not implemented" error
@@ -9,3 +15,56 @@ var ErrNotImplemented = fmt.Errorf("Not implemented")
 
 // ErrUnknownDriver is the "Unknown driver" error
 var ErrUnknownDriver = fmt.Errorf("Unknown driver")
+
+// ErrNotFound is the kind of the errors about missing volumes, snapshots or other resources.
+var ErrNotFound = api.StatusErrorf(http.StatusNotFound, "Not found")
+
+// ErrInUse is the kind of the errors about resources which can't be changed while in use.
+var ErrInUse = api.StatusErrorf(http.StatusConflict, "In use")
+
+// ErrNotSupported is the kind of the errors about operations the driver doesn't support.
+var ErrNotSupported = api.StatusErrorf(http.StatusNotImplemented, "Not supported")
+
+// ErrInsufficientSpace is the kind of the errors about the storage running out of space.
+var ErrInsufficientSpace = api.StatusErrorf(http.StatusInsufficientStorage, "Insufficient space")
+
+// Error is an error of one of the kinds above, with its own message. Its kind is returned by
+// errors.Cause(), so that it is reported with the HTTP status code of the kind.
+type Error struct {
+	kind error
+	msg  string
+}
+
+// Errorf returns a new error of the given kind, with a message formatted according to the format
+// specifier.
+func Errorf(kind error, format string, a ...interface{}) error {
+	return &Error{
+		kind: kind,
+		msg:  fmt.Sprintf(format, a...),
+	}
+}
+
+// Error returns the message of the error.
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Cause returns the kind of the error.
+func (e *Error) Cause() error {
+	return e.kind
+}
+
+// wrapInsufficientSpace returns an error of kind ErrInsufficientSpace when the given error was
+// caused by the storage running out of space, either directly or as reported by a failed command.
+// Other errors (including nil) are returned as is.
+func wrapInsufficientSpace(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if !strings.Contains(strings.ToLower(err.Error()), unix.ENOSPC.Error()) {
+		return err
+	}
+
+	return Errorf(ErrInsufficientSpace, "%s", err.Error())
+}
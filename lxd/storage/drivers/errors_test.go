@@ -0,0 +1,37 @@
+package drivers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// Test Errorf
+func TestErrorf(t *testing.T) {
+	err := Errorf(ErrInUse, "Volume %q has snapshots", "testvol")
+	assert.Equal(t, `Volume "testvol" has snapshots`, err.Error())
+	assert.Equal(t, ErrInUse, errors.Cause(err))
+
+	// The kind survives annotations.
+	err = errors.Wrap(err, "Failed to delete volume")
+	assert.Equal(t, ErrInUse, errors.Cause(err))
+	assert.True(t, api.StatusErrorCheck(err, http.StatusConflict))
+	assert.False(t, api.StatusErrorCheck(err, http.StatusNotFound))
+}
+
+// Test wrapInsufficientSpace
+func TestWrapInsufficientSpace(t *testing.T) {
+	assert.Nil(t, wrapInsufficientSpace(nil))
+
+	err := fmt.Errorf("Permission denied")
+	assert.Equal(t, err, wrapInsufficientSpace(err))
+
+	err = wrapInsufficientSpace(fmt.Errorf("rsync: write failed: No space left on device (28)"))
+	assert.Equal(t, "rsync: write failed: No space left on device (28)", err.Error())
+	assert.Equal(t, ErrInsufficientSpace, errors.Cause(err))
+}
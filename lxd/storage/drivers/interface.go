@@ -7,6 +7,7 @@ import (
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
 	"github.com/lxc/lxd/shared/logger"
 )
 
@@ -14,7 +15,7 @@ import (
 type driver interface {
 	Driver
 
-	init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func() map[string]func(string) error) error
+	init(state *state.State, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) error
 	load() error
 }
 
@@ -22,6 +23,7 @@ type driver interface {
 type Driver interface {
 	// Internal.
 	Info() Info
+	Config() map[string]string
 	HasVolume(volType VolumeType, volName string) bool
 
 	// Pool.
@@ -33,15 +35,28 @@ type Driver interface {
 
 	// Volumes.
 	ValidateVolume(vol Volume, removeUnknownKeys bool) error
+
+	// IgnoredVolumeKeys returns the keys of a valid volume config which the driver won't apply,
+	// along with the reason why.
+	IgnoredVolumeKeys(vol Volume) map[string]string
+
 	CreateVolume(vol Volume, filler func(mountPath, rootBlockPath string) error, op *operations.Operation) error
 	CreateVolumeFromCopy(vol Volume, srcVol Volume, copySnapshots bool, op *operations.Operation) error
+	RefreshVolume(vol Volume, srcVol Volume, srcSnapshots []string, op *operations.Operation) error
 	DeleteVolume(volType VolumeType, volName string, op *operations.Operation) error
 	RenameVolume(volType VolumeType, volName string, newName string, op *operations.Operation) error
 	UpdateVolume(vol Volume, changedConfig map[string]string) error
-	GetVolumeUsage(volType VolumeType, volName string) (int64, error)
+	GetVolumeUsage(vol Volume) (int64, error)
 	SetVolumeQuota(volType VolumeType, volName, size string, op *operations.Operation) error
 	GetVolumeDiskPath(volType VolumeType, volName string) (string, string, error)
 
+	// CompactVolume releases the space of the blocks of an unused block volume which only hold
+	// zeroes or were discarded by the guest.
+	CompactVolume(vol Volume, op *operations.Operation) error
+
+	// CheckVolume checks the consistency of an unmounted volume without repairing it.
+	CheckVolume(vol Volume, op *operations.Operation) (*api.StorageVolumeCheck, error)
+
 	// MountVolume mounts a storage volume, returns true if we caused a new mount, false if
 	// already mounted.
 	MountVolume(volType VolumeType, volName string, op *operations.Operation) (bool, error)
@@ -62,10 +77,17 @@ type Driver interface {
 	DeleteVolumeSnapshot(volType VolumeType, volName string, snapshotName string, op *operations.Operation) error
 	RenameVolumeSnapshot(volType VolumeType, volName string, snapshotName string, newSnapshotName string, op *operations.Operation) error
 	VolumeSnapshots(volType VolumeType, volName string, op *operations.Operation) ([]string, error)
-	RestoreVolume(vol Volume, snapshotName string, op *operations.Operation) error
+
+	// RestoreVolume rolls a volume back to one of its snapshots. Drivers which can only do so
+	// by destroying the snapshots taken after it refuse to unless force is true.
+	RestoreVolume(vol Volume, snapshotName string, force bool, op *operations.Operation) error
 
 	// Migration.
 	MigrationTypes(contentType ContentType) []migration.Type
 	MigrateVolume(vol Volume, conn io.ReadWriteCloser, volSrcArgs migration.VolumeSourceArgs, op *operations.Operation) error
 	CreateVolumeFromMigration(vol Volume, conn io.ReadWriteCloser, volTargetArgs migration.VolumeTargetArgs, op *operations.Operation) error
+
+	// Backup.
+	BackupVolume(vol Volume, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error
+	CreateVolumeFromBackup(vol Volume, snapshots []string, srcData io.ReadSeeker, optimized bool, op *operations.Operation) error
 }
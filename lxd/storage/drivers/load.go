@@ -6,12 +6,16 @@ import (
 )
 
 var drivers = map[string]func() driver{
+	"btrfs":  func() driver { return &btrfs{} },
 	"dir":    func() driver { return &dir{} },
+	"zfs":    func() driver { return &zfs{} },
 	"cephfs": func() driver { return &cephfs{} },
+	"lvm":    func() driver { return &lvm{} },
+	"ceph":   func() driver { return &ceph{} },
 }
 
 // Load returns a Driver for an existing low-level storage pool.
-func Load(state *state.State, driverName string, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func() map[string]func(string) error) (Driver, error) {
+func Load(state *state.State, driverName string, name string, config map[string]string, logger logger.Logger, volIDFunc func(volType VolumeType, volName string) (int64, error), commonRulesFunc func(vol Volume) map[string]func(string) error) (Driver, error) {
 	// Locate the driver loader.
 	driverFunc, ok := drivers[driverName]
 	if !ok {
@@ -27,16 +31,44 @@ func Load(state *state.State, driverName string, name string, config map[string]
 	return d, nil
 }
 
-// Info represents information about a storage driver.
+// Info represents information about a storage driver and its capabilities, which the pool backend
+// and the migration code check rather than the name of the driver.
 type Info struct {
-	Name               string
-	Version            string
-	Remote             bool
-	OptimizedImages    bool
-	PreservesInodes    bool
-	VolumeTypes        []VolumeType
-	BlockBacking       bool
+	Name    string
+	Version string
+
+	// Remote is true when the volumes live outside of the node, so that all the nodes of a
+	// cluster share them.
+	Remote bool
+
+	// OptimizedImages is true when images are unpacked once into an image volume, and the
+	// instances created from them are copies of that volume.
+	OptimizedImages bool
+
+	// PreservesInodes is true when copies and migrations of volumes keep their inode numbers.
+	PreservesInodes bool
+
+	// VolumeTypes lists the types of volumes the driver can hold.
+	VolumeTypes []VolumeType
+
+	// BlockBacking is true when filesystem volumes are backed by block devices.
+	BlockBacking bool
+
+	// RunningQuotaResize is true when the quota of the volume of a running instance can be
+	// changed.
 	RunningQuotaResize bool
+
+	// InstantClones is true when volumes are copied within the pool as copy-on-write clones,
+	// taking the same time whatever their size.
+	InstantClones bool
+
+	// RunningCopyFreeze is true when running instances must be frozen while their volume is
+	// copied or snapshotted, for the copy to be consistent.
+	RunningCopyFreeze bool
+
+	// OptimizedBackups is true when volumes can be backed up in a binary format of the driver,
+	// which can only be restored on a pool using the same driver.
+	OptimizedBackups bool
 }
 
 // SupportedDrivers returns a list of supported storage drivers.
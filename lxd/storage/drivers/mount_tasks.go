@@ -0,0 +1,106 @@
+package drivers
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// mountTask is a volume mounted by MountTask, along with the number of running tasks using it.
+type mountTask struct {
+	// refs is the number of running tasks using the volume, the last one unmounts it.
+	refs int
+
+	// unmount unmounts the volume.
+	unmount func()
+}
+
+// mountTasks holds the volumes that were mounted by MountTask and have not been unmounted yet,
+// keyed on the volume's mount lock ID.
+var mountTasks = map[string]*mountTask{}
+
+// mountTasksLock is used to access mountTasks.
+var mountTasksLock sync.Mutex
+
+// refMountTask records that a running task uses a volume, and returns whether it was recorded. A
+// volume mounted by the task itself is recorded along with the function unmounting it, a volume
+// which was already mounted only if another task mounted it, as otherwise its mount isn't ours
+// to undo. It must be called while holding the mount lock of the volume.
+func refMountTask(mountLockID string, ourMount bool, unmount func()) bool {
+	mountTasksLock.Lock()
+	defer mountTasksLock.Unlock()
+
+	task, ok := mountTasks[mountLockID]
+	if !ok {
+		if !ourMount {
+			return false
+		}
+
+		task = &mountTask{}
+		mountTasks[mountLockID] = task
+	}
+
+	// The volume was unmounted behind the back of the tasks using it, the new mount is the one to
+	// undo.
+	if ourMount {
+		task.unmount = unmount
+	}
+
+	task.refs++
+	return true
+}
+
+// unrefMountTask records that a running task no longer uses a volume, and unmounts it if that
+// was the last task using it, unless it has already been unmounted by UnmountTaskVolumes. It must
+// be called while holding the mount lock of the volume, so that no other task starts using the
+// volume while it is being unmounted.
+func unrefMountTask(mountLockID string) {
+	mountTasksLock.Lock()
+	task, ok := mountTasks[mountLockID]
+	if !ok {
+		mountTasksLock.Unlock()
+		return
+	}
+
+	task.refs--
+	if task.refs > 0 {
+		mountTasksLock.Unlock()
+		return
+	}
+
+	delete(mountTasks, mountLockID)
+	mountTasksLock.Unlock()
+
+	task.unmount()
+}
+
+// UnmountTaskVolumes unmounts all volumes that are currently mounted on behalf of a running
+// MountTask. This is used during daemon shutdown to avoid leaving volumes mounted by tasks that
+// didn't complete in time.
+func UnmountTaskVolumes() {
+	mountTasksLock.Lock()
+	tasks := mountTasks
+	mountTasks = map[string]*mountTask{}
+	mountTasksLock.Unlock()
+
+	for mountLockID, task := range tasks {
+		logger.Debugf("Unmounting volume left mounted by %d task(s): %s", task.refs, mountLockID)
+		task.unmount()
+	}
+}
+
+// MountTasks returns the mount lock IDs of the volumes currently mounted on behalf of a running
+// MountTask.
+func MountTasks() []string {
+	mountTasksLock.Lock()
+	defer mountTasksLock.Unlock()
+
+	mountLockIDs := make([]string, 0, len(mountTasks))
+	for mountLockID := range mountTasks {
+		mountLockIDs = append(mountLockIDs, mountLockID)
+	}
+
+	sort.Strings(mountLockIDs)
+	return mountLockIDs
+}
@@ -0,0 +1,38 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test refMountTask and unrefMountTask
+func TestMountTaskRefs(t *testing.T) {
+	unmounts := 0
+	unmount := func() { unmounts++ }
+
+	// A volume already mounted by something else isn't ours to unmount.
+	assert.False(t, refMountTask("mount/testpool/custom/testvol", false, unmount))
+	assert.Len(t, MountTasks(), 0)
+
+	// The first task mounts the volume, the second one shares its mount.
+	assert.True(t, refMountTask("mount/testpool/custom/testvol", true, unmount))
+	assert.True(t, refMountTask("mount/testpool/custom/testvol", false, unmount))
+	assert.Equal(t, []string{"mount/testpool/custom/testvol"}, MountTasks())
+
+	// Only the last task to finish unmounts the volume.
+	unrefMountTask("mount/testpool/custom/testvol")
+	assert.Equal(t, 0, unmounts)
+
+	unrefMountTask("mount/testpool/custom/testvol")
+	assert.Equal(t, 1, unmounts)
+	assert.Len(t, MountTasks(), 0)
+
+	// Volumes unmounted on shutdown aren't unmounted again by their tasks.
+	assert.True(t, refMountTask("mount/testpool/custom/testvol", true, unmount))
+	UnmountTaskVolumes()
+	assert.Equal(t, 2, unmounts)
+
+	unrefMountTask("mount/testpool/custom/testvol")
+	assert.Equal(t, 2, unmounts)
+}
@@ -1,10 +1,15 @@
 package drivers
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -12,6 +17,7 @@ import (
 	"github.com/lxc/lxd/lxd/project"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/units"
 )
 
 func wipeDirectory(path string) error {
@@ -142,6 +148,69 @@ func tryMount(src string, dst string, fs string, flags uintptr, options string)
 	return nil
 }
 
+// mountOption describes how a mount option is turned into a mount flag. The flag is set when
+// capture is true, cleared otherwise.
+type mountOption struct {
+	capture bool
+	flag    uintptr
+}
+
+// mountOptions lists the mount options which are passed to the kernel as mount flags.
+var mountOptions = map[string]mountOption{
+	"async":         {false, unix.MS_SYNCHRONOUS},
+	"atime":         {false, unix.MS_NOATIME},
+	"bind":          {true, unix.MS_BIND},
+	"defaults":      {true, 0},
+	"dev":           {false, unix.MS_NODEV},
+	"diratime":      {false, unix.MS_NODIRATIME},
+	"dirsync":       {true, unix.MS_DIRSYNC},
+	"exec":          {false, unix.MS_NOEXEC},
+	"lazytime":      {true, unix.MS_LAZYTIME},
+	"mand":          {true, unix.MS_MANDLOCK},
+	"noatime":       {true, unix.MS_NOATIME},
+	"nodev":         {true, unix.MS_NODEV},
+	"nodiratime":    {true, unix.MS_NODIRATIME},
+	"noexec":        {true, unix.MS_NOEXEC},
+	"nomand":        {false, unix.MS_MANDLOCK},
+	"norelatime":    {false, unix.MS_RELATIME},
+	"nostrictatime": {false, unix.MS_STRICTATIME},
+	"nosuid":        {true, unix.MS_NOSUID},
+	"rbind":         {true, unix.MS_BIND | unix.MS_REC},
+	"relatime":      {true, unix.MS_RELATIME},
+	"remount":       {true, unix.MS_REMOUNT},
+	"ro":            {true, unix.MS_RDONLY},
+	"rw":            {false, unix.MS_RDONLY},
+	"strictatime":   {true, unix.MS_STRICTATIME},
+	"suid":          {false, unix.MS_NOSUID},
+	"sync":          {true, unix.MS_SYNCHRONOUS},
+}
+
+// resolveMountOptions splits a comma separated list of mount options into the mount flags and
+// the remaining filesystem specific options.
+func resolveMountOptions(options string) (uintptr, string) {
+	mountFlags := uintptr(0)
+	fsOptions := []string{}
+
+	for _, opt := range strings.Split(options, ",") {
+		do, ok := mountOptions[opt]
+		if !ok {
+			if opt != "" {
+				fsOptions = append(fsOptions, opt)
+			}
+
+			continue
+		}
+
+		if do.capture {
+			mountFlags |= do.flag
+		} else {
+			mountFlags &= ^do.flag
+		}
+	}
+
+	return mountFlags, strings.Join(fsOptions, ",")
+}
+
 func vfsResources(path string) (*api.ResourcesStoragePool, error) {
 	// Get the VFS information
 	st, err := shared.Statvfs(path)
@@ -192,6 +261,30 @@ func GetSnapshotVolumeName(parentName, snapshotName string) string {
 	return fmt.Sprintf("%s%s%s", parentName, shared.SnapshotDelimiter, snapshotName)
 }
 
+// refreshBaseSnapshot returns the snapshot on top of which the missing snapshots of a source volume
+// can be sent as incremental streams to a volume having the given snapshots. That's the most recent
+// snapshot of the volume, provided its snapshots are the oldest ones of the source and the missing
+// ones all come after them. An empty name is returned when the volume can't be refreshed that way.
+func refreshBaseSnapshot(snapshots []string, srcAllSnapshots []string, srcSnapshots []string) string {
+	if len(snapshots) == 0 || len(snapshots)+len(srcSnapshots) != len(srcAllSnapshots) {
+		return ""
+	}
+
+	for i, snapName := range snapshots {
+		if srcAllSnapshots[i] != snapName {
+			return ""
+		}
+	}
+
+	for i, snapName := range srcSnapshots {
+		if srcAllSnapshots[len(snapshots)+i] != snapName {
+			return ""
+		}
+	}
+
+	return snapshots[len(snapshots)-1]
+}
+
 // deleteParentSnapshotDirIfEmpty removes the parent snapshot directory if it is empty.
 // It accepts the pool name, volume type and parent volume name.
 func deleteParentSnapshotDirIfEmpty(poolName string, volType VolumeType, volName string) error {
@@ -238,3 +331,335 @@ func createSparseFile(filePath string, sizeBytes int64) error {
 
 	return nil
 }
+
+// growDiskImage grows the disk image of a block volume stored as a file to the given size, rounded
+// up to whole sectors. Disk images can't be shrunk, the end of the guest's data would be lost.
+func growDiskImage(path string, sizeBytes int64) error {
+	// Read the current size without taking a lock, in case a running virtual machine uses it.
+	out, err := shared.RunCommand("qemu-img", "info", "--force-share", "--output=json", path)
+	if err != nil {
+		return fmt.Errorf("Failed reading disk image %s: %v", path, err)
+	}
+
+	var info struct {
+		VirtualSize int64 `json:"virtual-size"`
+	}
+
+	err = json.Unmarshal([]byte(out), &info)
+	if err != nil {
+		return fmt.Errorf("Failed parsing info of disk image %s: %v", path, err)
+	}
+
+	if sizeBytes%512 != 0 {
+		sizeBytes += 512 - sizeBytes%512
+	}
+
+	if sizeBytes == info.VirtualSize {
+		return nil
+	}
+
+	if sizeBytes < info.VirtualSize {
+		return Errorf(ErrNotSupported, "Block volumes can't be shrunk")
+	}
+
+	_, err = shared.RunCommand("qemu-img", "resize", path, fmt.Sprintf("%d", sizeBytes))
+	if err != nil {
+		// A running virtual machine holds a lock on its disk images and grows them itself.
+		if strings.Contains(err.Error(), "lock") {
+			return nil
+		}
+
+		return fmt.Errorf("Failed resizing disk image %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// makeFSType creates a filesystem of the given type on the block device at the given path.
+func makeFSType(devPath string, fsType string) error {
+	args := []string{}
+	switch fsType {
+	case "ext4":
+		args = append(args, "-F", "-E", "nodiscard,lazy_itable_init=0,lazy_journal_init=0")
+	case "btrfs", "xfs":
+		args = append(args, "-f")
+	}
+
+	_, err := shared.TryRunCommand(fmt.Sprintf("mkfs.%s", fsType), append(args, devPath)...)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s filesystem on %q: %v", fsType, devPath, err)
+	}
+
+	return nil
+}
+
+// detectFSType returns the type of the filesystem on the block device at the given path.
+func detectFSType(devPath string) (string, error) {
+	out, err := shared.RunCommand("blkid", "-s", "TYPE", "-o", "value", devPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to detect filesystem type of %q: %v", devPath, err)
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// regenerateFSUUID gives a new UUID to the filesystem on the block device at the given path.
+// Filesystems which refuse to mount alongside another one with the same UUID (btrfs and xfs) need
+// this after their block device was snapshotted, others are left alone.
+func regenerateFSUUID(devPath string, fsType string) error {
+	var err error
+
+	switch fsType {
+	case "btrfs":
+		_, err = shared.RunCommand("btrfstune", "-f", "-u", devPath)
+	case "xfs":
+		// Replay the log first, xfs_admin refuses to change the UUID of a dirty filesystem.
+		shared.RunCommand("xfs_repair", "-L", devPath)
+		_, err = shared.RunCommand("xfs_admin", "-U", "generate", devPath)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to regenerate UUID of %s filesystem on %q: %v", fsType, devPath, err)
+	}
+
+	return nil
+}
+
+// growFileSystem grows the filesystem on the block device at the given path to the size of the
+// device. Btrfs and xfs filesystems must be mounted at mountPath.
+func growFileSystem(fsType string, devPath string, mountPath string) error {
+	var err error
+
+	switch fsType {
+	case "ext4":
+		_, err = shared.TryRunCommand("resize2fs", devPath)
+	case "xfs":
+		_, err = shared.TryRunCommand("xfs_growfs", mountPath)
+	case "btrfs":
+		_, err = shared.TryRunCommand("btrfs", "filesystem", "resize", "max", mountPath)
+	default:
+		return Errorf(ErrNotSupported, "Growing not supported for filesystem type %q", fsType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to grow %s filesystem on %q: %v", fsType, devPath, err)
+	}
+
+	return nil
+}
+
+// shrinkFileSystem shrinks the filesystem on the block device at the given path to the given
+// size, after checking that the data it holds fits in that size. Ext4 filesystems must be unmounted
+// and not in use by anything else, btrfs ones mounted at mountPath. Xfs filesystems can't be shrunk.
+func shrinkFileSystem(fsType string, devPath string, mountPath string, sizeBytes int64) error {
+	size := fmt.Sprintf("%dK", sizeBytes/1024)
+
+	switch fsType {
+	case "ext4":
+		err := checkBlockDeviceUnused(devPath)
+		if err != nil {
+			return err
+		}
+
+		_, err = shared.TryRunCommand("e2fsck", "-f", "-y", devPath)
+		if err != nil {
+			return fmt.Errorf("Failed to check ext4 filesystem on %q: %v", devPath, err)
+		}
+
+		minBytes, err := ext4MinimumSize(devPath)
+		if err != nil {
+			return err
+		}
+
+		if sizeBytes < minBytes {
+			return fmt.Errorf("The filesystem holds too much data to be shrunk below %s", units.GetByteSizeString(minBytes, 0))
+		}
+
+		_, err = shared.TryRunCommand("resize2fs", devPath, size)
+		if err != nil {
+			return fmt.Errorf("Failed to shrink ext4 filesystem on %q: %v", devPath, err)
+		}
+	case "btrfs":
+		var stat unix.Statfs_t
+		err := unix.Statfs(mountPath, &stat)
+		if err != nil {
+			return err
+		}
+
+		usedBytes := int64(stat.Blocks-stat.Bfree) * int64(stat.Bsize)
+		if sizeBytes <= usedBytes {
+			return fmt.Errorf("The filesystem holds too much data to be shrunk below %s", units.GetByteSizeString(usedBytes, 0))
+		}
+
+		_, err = shared.TryRunCommand("btrfs", "filesystem", "resize", size, mountPath)
+		if err != nil {
+			return fmt.Errorf("Failed to shrink btrfs filesystem on %q: %v", devPath, err)
+		}
+	default:
+		return Errorf(ErrNotSupported, "Shrinking not supported for filesystem type %q", fsType)
+	}
+
+	return nil
+}
+
+// checkQuotaAboveUsage fails when a quota would be set below the space a volume already uses, which
+// would leave whatever uses the volume unable to write to it.
+func checkQuotaAboveUsage(sizeBytes int64, usedBytes int64) error {
+	if sizeBytes > 0 && usedBytes > sizeBytes {
+		return fmt.Errorf("The volume already uses %s, more than the new quota of %s", units.GetByteSizeString(usedBytes, 2), units.GetByteSizeString(sizeBytes, 2))
+	}
+
+	return nil
+}
+
+// unmountForShrink unmounts the filesystem at the given path ahead of shrinking it. Unlike
+// forceUnmount it never detaches the filesystem lazily, so that a filesystem still in use is left
+// alone.
+func unmountForShrink(path string) error {
+	for shared.IsMountPoint(path) {
+		err := unix.Unmount(path, 0)
+		if err == unix.EBUSY {
+			return Errorf(ErrInUse, "The volume must not be in use to be shrunk")
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBlockDeviceUnused fails when the block device at the given path is held by anything else,
+// such as a mount of its filesystem within the mount namespace of an instance.
+func checkBlockDeviceUnused(devPath string) error {
+	fd, err := unix.Open(devPath, unix.O_RDONLY|unix.O_EXCL, 0)
+	if err == unix.EBUSY {
+		return Errorf(ErrInUse, "The volume must not be in use")
+	} else if err != nil {
+		return err
+	}
+
+	return unix.Close(fd)
+}
+
+// checkFileSystem checks the filesystem on the block device at the given path without repairing
+// anything. The filesystem must be unmounted and not in use by anything else.
+func checkFileSystem(fsType string, devPath string) (*api.StorageVolumeCheck, error) {
+	var args []string
+
+	// Exit status of the tools when they found problems, others than 0 are failures to check.
+	problemStatus := 1
+
+	switch fsType {
+	case "ext4":
+		args = []string{"e2fsck", "-f", "-n", devPath}
+		problemStatus = 4
+	case "xfs":
+		args = []string{"xfs_repair", "-n", devPath}
+	case "btrfs":
+		args = []string{"btrfs", "check", "--readonly", devPath}
+	default:
+		return nil, Errorf(ErrNotSupported, "Checking not supported for filesystem type %q", fsType)
+	}
+
+	err := checkBlockDeviceUnused(devPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := shared.RunCommandSplit(nil, args[0], args[1:]...)
+
+	result := &api.StorageVolumeCheck{
+		Tool:   args[0],
+		Clean:  true,
+		Errors: []string{},
+		Output: strings.TrimSpace(stdout + stderr),
+	}
+
+	if err != nil {
+		runErr, ok := err.(shared.RunError)
+		if !ok {
+			return nil, err
+		}
+
+		exitErr, ok := runErr.Err.(*exec.ExitError)
+		if !ok || exitErr.Sys().(syscall.WaitStatus).ExitStatus() != problemStatus {
+			return nil, fmt.Errorf("Failed to check %s filesystem on %q: %v", fsType, devPath, err)
+		}
+
+		result.Clean = false
+		result.Errors = checkOutputErrors(result.Output)
+	}
+
+	return result, nil
+}
+
+// checkOutputErrors returns the lines of the output of a check reporting problems, or all of them
+// if none could be told apart.
+func checkOutputErrors(output string) []string {
+	keywords := []string{"error", "corrupt", "bad ", "invalid", "wrong", "mismatch", "missing", "? no", "would "}
+
+	lines := []string{}
+	errors := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		lines = append(lines, line)
+
+		for _, keyword := range keywords {
+			if strings.Contains(strings.ToLower(line), keyword) {
+				errors = append(errors, line)
+				break
+			}
+		}
+	}
+
+	if len(errors) == 0 {
+		return lines
+	}
+
+	return errors
+}
+
+// ext4MinimumSize returns the size below which the ext4 filesystem on the block device at the
+// given path can't be shrunk, as estimated by resize2fs.
+func ext4MinimumSize(devPath string) (int64, error) {
+	out, err := shared.TryRunCommand("dumpe2fs", "-h", devPath)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to read ext4 filesystem on %q: %v", devPath, err)
+	}
+
+	blockSize, err := parseColonValue(out, "Block size")
+	if err != nil {
+		return -1, err
+	}
+
+	out, err = shared.TryRunCommand("resize2fs", "-P", devPath)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to estimate minimum size of ext4 filesystem on %q: %v", devPath, err)
+	}
+
+	minBlocks, err := parseColonValue(out, "Estimated minimum size of the filesystem")
+	if err != nil {
+		return -1, err
+	}
+
+	return minBlocks * blockSize, nil
+}
+
+// parseColonValue returns the integer value of the first "key: value" line of the given output
+// with the given key.
+func parseColonValue(output string, key string) (int64, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) != key {
+			continue
+		}
+
+		return strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+	}
+
+	return -1, fmt.Errorf("Couldn't find %q in output", key)
+}
@@ -0,0 +1,155 @@
+package drivers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/migration"
+	"github.com/lxc/lxd/lxd/operations"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/containerwriter"
+	"github.com/lxc/lxd/shared/ioprogress"
+)
+
+// backupVolumeName returns the name under which the content of a volume is stored in a backup
+// tarball, "container" for instances and "volume" for custom volumes.
+func backupVolumeName(vol Volume) string {
+	if vol.volType == VolumeTypeCustom {
+		return "volume"
+	}
+
+	return "container"
+}
+
+// backupProgress returns the tracker reporting the bytes of the named part of a backup written so
+// far to the operation, or nil if there's no operation.
+func backupProgress(op *operations.Operation, description string) *ioprogress.ProgressTracker {
+	if op == nil {
+		return nil
+	}
+
+	return migration.ProgressTracker(op, "create_backup_progress", description)
+}
+
+// genericBackupVolume writes the content of a filesystem volume to the tarball under
+// backup/<name> (see backupVolumeName), after the content of each of the given snapshots under backup/snapshots/<name>.
+func genericBackupVolume(vol Volume, tarWriter *containerwriter.ContainerTarWriter, snapshots []string, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be backed up")
+	}
+
+	backupDir := func(mountPath string, prefix string) error {
+		tarWriter.ResetHardLinkMap()
+
+		return filepath.Walk(mountPath, func(srcPath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name := filepath.Join(prefix, strings.TrimPrefix(srcPath, mountPath))
+			return tarWriter.WriteFileAs(name, srcPath, fi)
+		})
+	}
+
+	for _, snapName := range snapshots {
+		snapshot, err := vol.NewSnapshot(snapName)
+		if err != nil {
+			return err
+		}
+
+		err = snapshot.MountTask(func(mountPath string, op *operations.Operation) error {
+			return backupDir(mountPath, filepath.Join("backup", "snapshots", snapName))
+		}, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		return backupDir(mountPath, filepath.Join("backup", backupVolumeName(vol)))
+	}, op)
+}
+
+// genericCreateVolumeFromBackup creates a filesystem volume from a backup written by
+// genericBackupVolume. The content of each snapshot is unpacked into the volume, from oldest to
+// newest, and snapshotted before the content of the volume itself is unpacked.
+func genericCreateVolumeFromBackup(vol Volume, snapshots []string, srcData io.ReadSeeker, op *operations.Operation) error {
+	if vol.contentType != ContentTypeFS {
+		return Errorf(ErrNotSupported, "Only filesystem volumes can be restored from a backup")
+	}
+
+	err := vol.driver.CreateVolume(vol, nil, op)
+	if err != nil {
+		return err
+	}
+
+	// Create slice of snapshots created if revert needed later.
+	revertSnaps := []string{}
+	defer func() {
+		if revertSnaps == nil {
+			return
+		}
+
+		for _, snapName := range revertSnaps {
+			vol.driver.DeleteVolumeSnapshot(vol.volType, vol.name, snapName, op)
+		}
+
+		vol.driver.DeleteVolume(vol.volType, vol.name, op)
+	}()
+
+	err = vol.MountTask(func(mountPath string, op *operations.Operation) error {
+		for _, snapName := range snapshots {
+			err := wipeDirectory(mountPath)
+			if err != nil {
+				return err
+			}
+
+			err = unpackBackup(srcData, fmt.Sprintf("backup/snapshots/%s", snapName), 3, mountPath)
+			if err != nil {
+				return err
+			}
+
+			err = vol.driver.CreateVolumeSnapshot(vol.volType, vol.name, snapName, op)
+			if err != nil {
+				return err
+			}
+
+			revertSnaps = append(revertSnaps, snapName)
+		}
+
+		err := wipeDirectory(mountPath)
+		if err != nil {
+			return err
+		}
+
+		return unpackBackup(srcData, fmt.Sprintf("backup/%s", backupVolumeName(vol)), 2, mountPath)
+	}, op)
+	if err != nil {
+		return err
+	}
+
+	revertSnaps = nil
+	return nil
+}
+
+// unpackBackup extracts the given path of a backup tarball into the target directory, stripping
+// the given number of leading components from the names of its entries.
+func unpackBackup(srcData io.ReadSeeker, srcPath string, stripComponents int, targetPath string) error {
+	srcData.Seek(0, 0)
+	tarArgs, _, _, err := shared.DetectCompressionFile(srcData)
+	if err != nil {
+		return err
+	}
+
+	srcData.Seek(0, 0)
+	args := append(tarArgs, "-", fmt.Sprintf("--strip-components=%d", stripComponents), "--numeric-owner", "--xattrs-include=*", "-C", targetPath, srcPath)
+	err = shared.RunCommandWithFds(srcData, nil, "tar", args...)
+	if err != nil {
+		return wrapInsufficientSpace(fmt.Errorf("Failed to unpack %q from backup: %v", srcPath, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,597 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/ioprogress"
+)
+
+// Size of the chunks the data of a sparse file is read, checked for zeroes and sent in.
+const sparseChunkSize = 4 * 1024 * 1024
+
+// Magic bytes starting a sparse file stream.
+var sparseStreamMagic = []byte("LXDSPRS1")
+
+// Magic bytes starting the first stream of a file sent while in use, which is followed by a stream
+// of the chunks changed while it was being sent.
+var sparseLiveMagic = []byte("LXDSPRL1")
+
+// Magic bytes starting a stream of the chunks changed since the previous stream.
+var sparseDeltaMagic = []byte("LXDSPRD1")
+
+// Buffer of zeroes used to detect and write all-zero chunks.
+var sparseZeroes = make([]byte, sparseChunkSize)
+
+// sparseFileSize returns the size of a regular file or block device.
+func sparseFileSize(f *os.File) (int64, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return -1, err
+	}
+
+	return size, nil
+}
+
+// sparseWalk calls fn for each chunk of the file which holds data. Holes are found using
+// SEEK_DATA/SEEK_HOLE when the filesystem supports it, and chunks which only contain zeroes are
+// skipped too so that block devices and fully allocated files also benefit from it. Chunks are
+// aligned on multiples of sparseChunkSize.
+func sparseWalk(f *os.File, size int64, fn func(offset int64, data []byte) error) error {
+	fd := int(f.Fd())
+	buf := make([]byte, sparseChunkSize)
+	holes := true
+
+	offset := int64(0)
+	for offset < size {
+		start := offset
+		end := size
+
+		if holes {
+			next, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+			if err == unix.ENXIO {
+				// Only a hole is left.
+				return nil
+			} else if err != nil {
+				// Hole detection isn't supported, only skip zeroed chunks.
+				holes = false
+			} else {
+				start = next - next%sparseChunkSize
+
+				end, err = unix.Seek(fd, next, unix.SEEK_HOLE)
+				if err != nil {
+					return err
+				}
+
+				if end%sparseChunkSize != 0 {
+					end += sparseChunkSize - end%sparseChunkSize
+				}
+
+				if end > size {
+					end = size
+				}
+			}
+		}
+
+		for start < end {
+			n := end - start
+			if n > sparseChunkSize {
+				n = sparseChunkSize
+			}
+
+			_, err := f.ReadAt(buf[:n], start)
+			if err != nil {
+				return err
+			}
+
+			if !bytes.Equal(buf[:n], sparseZeroes[:n]) {
+				err = fn(start, buf[:n])
+				if err != nil {
+					return err
+				}
+			}
+
+			start += n
+		}
+
+		offset = end
+	}
+
+	return nil
+}
+
+// sparseDeltaWalk calls fn for each chunk of the file whose content changed since sparseWalk went
+// through it, given the digests of the chunks it passed to its callback. The chunks which now only
+// contain zeroes but didn't before are included.
+func sparseDeltaWalk(f *os.File, size int64, sums map[int64][sha256.Size]byte, fn func(offset int64, data []byte) error) error {
+	buf := make([]byte, sparseChunkSize)
+
+	for offset := int64(0); offset < size; offset += sparseChunkSize {
+		n := size - offset
+		if n > sparseChunkSize {
+			n = sparseChunkSize
+		}
+
+		_, err := f.ReadAt(buf[:n], offset)
+		if err != nil {
+			return err
+		}
+
+		sum, sent := sums[offset]
+		if bytes.Equal(buf[:n], sparseZeroes[:n]) {
+			if !sent {
+				continue
+			}
+		} else if sent && sha256.Sum256(buf[:n]) == sum {
+			continue
+		}
+
+		err = fn(offset, buf[:n])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sparseWriter writes the data chunks of a sparse file to a regular file or block device.
+// Regular files are truncated so that the skipped ranges become holes, while the skipped ranges
+// of block devices are explicitly zeroed. When writing a delta, the existing content is kept and
+// only the chunks written change.
+type sparseWriter struct {
+	f      *os.File
+	size   int64
+	pos    int64
+	device bool
+	delta  bool
+}
+
+func newSparseWriter(path string, size int64, mode os.FileMode, delta bool) (*sparseWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w := &sparseWriter{f: f, size: size, delta: delta}
+
+	if fi.Mode()&os.ModeDevice != 0 {
+		w.device = true
+
+		devSize, err := sparseFileSize(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if devSize < size {
+			f.Close()
+			return nil, fmt.Errorf("Device %q is smaller than the %d bytes being written to it", path, size)
+		}
+
+		return w, nil
+	}
+
+	if delta {
+		// Disk images stored as files may have grown in the meantime.
+		if fi.Size() < size {
+			err = f.Truncate(size)
+		}
+	} else {
+		// Drop any existing content so that it doesn't show through the holes.
+		err = f.Truncate(0)
+		if err == nil {
+			err = f.Truncate(size)
+		}
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// zero clears the given range, falling back to writing zeroes when discarding
+// it isn't supported.
+func (w *sparseWriter) zero(offset int64, length int64) error {
+	err := unix.Fallocate(int(w.f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, length)
+	if err == nil {
+		return nil
+	}
+
+	for length > 0 {
+		n := length
+		if n > sparseChunkSize {
+			n = sparseChunkSize
+		}
+
+		_, err := w.f.WriteAt(sparseZeroes[:n], offset)
+		if err != nil {
+			return err
+		}
+
+		offset += n
+		length -= n
+	}
+
+	return nil
+}
+
+// writeChunk writes a data chunk. Chunks must be written in order.
+func (w *sparseWriter) writeChunk(offset int64, data []byte) error {
+	if offset < w.pos || offset+int64(len(data)) > w.size {
+		return fmt.Errorf("Invalid sparse chunk at offset %d", offset)
+	}
+
+	if w.device && !w.delta && offset > w.pos {
+		err := w.zero(w.pos, offset-w.pos)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.pos = offset + int64(len(data))
+
+	// Chunks of a delta which were emptied are released.
+	if w.delta && bytes.Equal(data, sparseZeroes[:len(data)]) {
+		return w.zero(offset, int64(len(data)))
+	}
+
+	_, err := w.f.WriteAt(data, offset)
+	return err
+}
+
+// Close zeroes whatever follows the last chunk on block devices and closes the target.
+func (w *sparseWriter) Close() error {
+	if w.device && !w.delta && w.size > w.pos {
+		err := w.zero(w.pos, w.size-w.pos)
+		if err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+
+	return w.f.Close()
+}
+
+// copySparseFile copies a regular file or block device to another one, skipping its holes both
+// when reading and writing. The progress of the copy is reported as the percentage of the file
+// up to the offset of the last chunk copied, along with the speed of the copy, to the progress
+// function if any.
+func copySparseFile(srcPath string, dstPath string, progress func(int64, int64)) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	size, err := sparseFileSize(src)
+	if err != nil {
+		return err
+	}
+
+	w, err := newSparseWriter(dstPath, size, fi.Mode().Perm(), false)
+	if err != nil {
+		return err
+	}
+
+	writeChunk := w.writeChunk
+	if progress != nil && size > 0 {
+		start := time.Now()
+		copied := int64(0)
+		lastPercent := int64(-1)
+
+		writeChunk = func(offset int64, data []byte) error {
+			err := w.writeChunk(offset, data)
+			if err != nil {
+				return err
+			}
+
+			copied += int64(len(data))
+			percent := (offset + int64(len(data))) * 100 / size
+			if percent == lastPercent {
+				return nil
+			}
+
+			lastPercent = percent
+
+			speed := int64(0)
+			duration := time.Since(start).Seconds()
+			if duration > 0 {
+				speed = int64(float64(copied) / duration)
+			}
+
+			progress(percent, speed)
+			return nil
+		}
+	}
+
+	err = sparseWalk(src, size, writeChunk)
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// sendSparseFile sends a regular file or block device over the migration connection, only
+// transferring the chunks holding data. The stream starts with a header holding the total size,
+// followed by the chunks (offset, length and data), an empty chunk and the SHA-256 digest of all
+// the chunks, which the receiver verifies. Like rsync.Send it then closes the connection to signal
+// the end of the stream and waits for the receiver to do the same.
+func sendSparseFile(conn io.ReadWriteCloser, path string, tracker *ioprogress.ProgressTracker) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, err := sparseFileSize(f)
+	if err != nil {
+		return err
+	}
+
+	return sendSparseStream(conn, sparseStreamMagic, size, tracker, func(fn func(offset int64, data []byte) error) error {
+		return sparseWalk(f, size, fn)
+	})
+}
+
+// sendSparseFileLive sends a regular file or block device which is still being written to, like
+// sendSparseFile. It then calls freeze to stop the writes and sends the chunks changed in the
+// meantime in a second stream, which recvSparseFile receives along with the first one.
+func sendSparseFileLive(conn io.ReadWriteCloser, path string, tracker *ioprogress.ProgressTracker, freeze func() error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, err := sparseFileSize(f)
+	if err != nil {
+		return err
+	}
+
+	// Keep the digests of the chunks sent, the others only held zeroes.
+	sums := map[int64][sha256.Size]byte{}
+	err = sendSparseStream(conn, sparseLiveMagic, size, tracker, func(fn func(offset int64, data []byte) error) error {
+		return sparseWalk(f, size, func(offset int64, data []byte) error {
+			sums[offset] = sha256.Sum256(data)
+			return fn(offset, data)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = freeze()
+	if err != nil {
+		return err
+	}
+
+	// Disk images stored as files grow as they're written to.
+	size, err = sparseFileSize(f)
+	if err != nil {
+		return err
+	}
+
+	return sendSparseStream(conn, sparseDeltaMagic, size, tracker, func(fn func(offset int64, data []byte) error) error {
+		return sparseDeltaWalk(f, size, sums, fn)
+	})
+}
+
+// sendDiskImage sends the disk image of a block volume with sendSparseFileLive when the
+// "live_block" migration feature was negotiated and a freeze function is given, or with
+// sendSparseFile otherwise.
+func sendDiskImage(conn io.ReadWriteCloser, path string, tracker *ioprogress.ProgressTracker, features []string, freeze func() error) error {
+	if freeze != nil && shared.StringInSlice("live_block", features) {
+		return sendSparseFileLive(conn, path, tracker, freeze)
+	}
+
+	return sendSparseFile(conn, path, tracker)
+}
+
+// sendSparseStream sends the chunks that walk passes to its callback, in the format described by
+// sendSparseFile.
+func sendSparseStream(conn io.ReadWriteCloser, magic []byte, size int64, tracker *ioprogress.ProgressTracker, walk func(fn func(offset int64, data []byte) error) error) error {
+	var writer io.Writer = conn
+	if tracker != nil {
+		writer = &ioprogress.ProgressWriter{
+			WriteCloser: conn,
+			Tracker:     tracker,
+		}
+	}
+
+	// Buffer the writes so that each websocket message carries a full chunk.
+	out := bufio.NewWriterSize(writer, sparseChunkSize+16)
+
+	header := make([]byte, 16)
+	copy(header, magic)
+	binary.BigEndian.PutUint64(header[8:], uint64(size))
+
+	_, err := out.Write(header)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.New()
+	chunks := io.MultiWriter(out, digest)
+
+	err = walk(func(offset int64, data []byte) error {
+		binary.BigEndian.PutUint64(header, uint64(offset))
+		binary.BigEndian.PutUint64(header[8:], uint64(len(data)))
+
+		_, err := chunks.Write(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = chunks.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write the end of stream marker followed by the digest.
+	binary.BigEndian.PutUint64(header, uint64(size))
+	binary.BigEndian.PutUint64(header[8:], 0)
+
+	_, err = out.Write(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(digest.Sum(nil))
+	if err != nil {
+		return err
+	}
+
+	err = out.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = conn.Close() // sends barrier message.
+	if err != nil {
+		return err
+	}
+
+	// Wait for the receiver to be done.
+	_, err = io.Copy(ioutil.Discard, conn)
+	return err
+}
+
+// recvSparseFile receives a file sent by sendSparseFile or sendSparseFileLive into the regular
+// file or block device at path.
+func recvSparseFile(conn io.ReadWriteCloser, path string, tracker *ioprogress.ProgressTracker) error {
+	live, err := recvSparseStream(conn, path, tracker, false)
+	if err != nil || !live {
+		return err
+	}
+
+	_, err = recvSparseStream(conn, path, tracker, true)
+	return err
+}
+
+// recvSparseStream receives a stream sent by sendSparseStream into the regular file or block
+// device at path, returning whether it's followed by a delta stream.
+func recvSparseStream(conn io.ReadWriteCloser, path string, tracker *ioprogress.ProgressTracker, delta bool) (bool, error) {
+	var reader io.Reader = conn
+	if tracker != nil {
+		reader = &ioprogress.ProgressReader{
+			ReadCloser: conn,
+			Tracker:    tracker,
+		}
+	}
+
+	header := make([]byte, 16)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return false, err
+	}
+
+	live := false
+	if delta {
+		if !bytes.Equal(header[:8], sparseDeltaMagic) {
+			return false, fmt.Errorf("Invalid sparse delta stream header")
+		}
+	} else if bytes.Equal(header[:8], sparseLiveMagic) {
+		live = true
+	} else if !bytes.Equal(header[:8], sparseStreamMagic) {
+		return false, fmt.Errorf("Invalid sparse stream header")
+	}
+
+	w, err := newSparseWriter(path, int64(binary.BigEndian.Uint64(header[8:])), 0600, delta)
+	if err != nil {
+		return false, err
+	}
+
+	digest := sha256.New()
+	chunks := io.TeeReader(reader, digest)
+
+	buf := make([]byte, sparseChunkSize)
+	for {
+		_, err = io.ReadFull(reader, header)
+		if err != nil {
+			w.Close()
+			return false, err
+		}
+
+		offset := int64(binary.BigEndian.Uint64(header))
+		length := binary.BigEndian.Uint64(header[8:])
+		if length == 0 {
+			break
+		}
+
+		digest.Write(header)
+
+		if length > sparseChunkSize {
+			w.Close()
+			return false, fmt.Errorf("Invalid sparse chunk length %d", length)
+		}
+
+		_, err = io.ReadFull(chunks, buf[:length])
+		if err != nil {
+			w.Close()
+			return false, err
+		}
+
+		err = w.writeChunk(offset, buf[:length])
+		if err != nil {
+			w.Close()
+			return false, err
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return false, err
+	}
+
+	sum := make([]byte, sha256.Size)
+	_, err = io.ReadFull(reader, sum)
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(sum, digest.Sum(nil)) {
+		return false, fmt.Errorf("Checksum mismatch for the received data of %q", path)
+	}
+
+	// Consume the sender's barrier message and send ours.
+	_, err = io.Copy(ioutil.Discard, conn)
+	if err != nil {
+		return false, err
+	}
+
+	return live, conn.Close()
+}
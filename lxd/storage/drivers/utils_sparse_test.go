@@ -0,0 +1,83 @@
+package drivers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test copySparseFile
+func TestCopySparseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxd-sparse-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+	dstPath := filepath.Join(dir, "dst")
+
+	// A mostly empty file with a small chunk of data and an allocated range of zeroes.
+	src, err := os.Create(srcPath)
+	require.NoError(t, err)
+	require.NoError(t, src.Truncate(64*1024*1024))
+	_, err = src.WriteAt([]byte("data"), 12345)
+	require.NoError(t, err)
+	_, err = src.WriteAt(make([]byte, sparseChunkSize), 32*1024*1024)
+	require.NoError(t, err)
+	require.NoError(t, src.Close())
+
+	// Existing content of the target must not show through the holes.
+	require.NoError(t, ioutil.WriteFile(dstPath, bytes.Repeat([]byte{1}, 1024*1024), 0600))
+
+	require.NoError(t, copySparseFile(srcPath, dstPath, nil))
+
+	srcData, err := ioutil.ReadFile(srcPath)
+	require.NoError(t, err)
+	dstData, err := ioutil.ReadFile(dstPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(srcData, dstData))
+}
+
+// Test sparseDeltaWalk
+func TestSparseDeltaWalk(t *testing.T) {
+	f, err := ioutil.TempFile("", "lxd-sparse-")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size := int64(8 * sparseChunkSize)
+	require.NoError(t, f.Truncate(size))
+	_, err = f.WriteAt([]byte("data"), 1)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 3*sparseChunkSize+5)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 5*sparseChunkSize)
+	require.NoError(t, err)
+
+	sums := map[int64][sha256.Size]byte{}
+	require.NoError(t, sparseWalk(f, size, func(offset int64, data []byte) error {
+		sums[offset] = sha256.Sum256(data)
+		return nil
+	}))
+	assert.Len(t, sums, 3)
+
+	// Change a chunk, empty another one and write to a hole.
+	_, err = f.WriteAt([]byte("more"), 3*sparseChunkSize)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, 4), 5*sparseChunkSize)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 7*sparseChunkSize)
+	require.NoError(t, err)
+
+	changed := []int64{}
+	require.NoError(t, sparseDeltaWalk(f, size, sums, func(offset int64, data []byte) error {
+		changed = append(changed, offset/sparseChunkSize)
+		return nil
+	}))
+	assert.Equal(t, []int64{3, 5, 7}, changed)
+}
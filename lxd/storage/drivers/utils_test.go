@@ -4,8 +4,19 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/shared"
 )
 
+// testCommonRules stands in for the volume rules common to all drivers, which are provided by the
+// storage package.
+func testCommonRules(vol Volume) map[string]func(string) error {
+	return map[string]func(string) error{
+		"size": shared.IsAny,
+	}
+}
+
 // Test GetVolumeMountPath
 func TestGetVolumeMountPath(t *testing.T) {
 	poolName := "testpool"
@@ -35,3 +46,76 @@ func TestGetVolumeMountPath(t *testing.T) {
 	expected = GetPoolMountPath(poolName) + "/virtual-machines/testvol"
 	assert.Equal(t, expected, path)
 }
+
+// Test refreshBaseSnapshot
+func TestRefreshBaseSnapshot(t *testing.T) {
+	src := []string{"snap0", "snap1", "snap2"}
+
+	// Missing snapshots following the shared ones.
+	assert.Equal(t, "snap0", refreshBaseSnapshot([]string{"snap0"}, src, []string{"snap1", "snap2"}))
+
+	// Up to date snapshots.
+	assert.Equal(t, "snap2", refreshBaseSnapshot(src, src, []string{}))
+
+	// No shared snapshot.
+	assert.Equal(t, "", refreshBaseSnapshot([]string{}, src, src))
+
+	// Missing snapshot older than a shared one.
+	assert.Equal(t, "", refreshBaseSnapshot([]string{"snap1"}, src, []string{"snap0", "snap2"}))
+}
+
+// Test parseColonValue
+func TestParseColonValue(t *testing.T) {
+	out := `Filesystem volume name:   <none>
+Block count:              262144
+Block size:               4096
+`
+
+	value, err := parseColonValue(out, "Block size")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4096), value)
+
+	value, err = parseColonValue("resize2fs 1.45.5 (07-Jan-2020)\nEstimated minimum size of the filesystem: 9321\n", "Estimated minimum size of the filesystem")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9321), value)
+
+	_, err = parseColonValue(out, "Inode size")
+	assert.Error(t, err)
+}
+
+// Test checkOutputErrors
+func TestCheckOutputErrors(t *testing.T) {
+	out := `Pass 1: Checking inodes, blocks, and sizes
+Inode 12 has illegal block(s).  Clear? no
+
+Pass 2: Checking directory structure
+Entry 'foo' in / (2) has deleted/unused inode 13.  Fix? no
+
+/dev/vg/lv: ********** WARNING: Filesystem still has errors **********
+`
+
+	assert.Equal(t, []string{
+		"Inode 12 has illegal block(s).  Clear? no",
+		"Entry 'foo' in / (2) has deleted/unused inode 13.  Fix? no",
+		"/dev/vg/lv: ********** WARNING: Filesystem still has errors **********",
+	}, checkOutputErrors(out))
+
+	// Output without any recognizable problem.
+	assert.Equal(t, []string{"Phase 1 - find and verify superblock..."}, checkOutputErrors("Phase 1 - find and verify superblock...\n"))
+}
+
+// Test resolveMountOptions
+func TestResolveMountOptions(t *testing.T) {
+	flags, data := resolveMountOptions(btrfsDefaultMountOptions)
+	assert.Equal(t, uintptr(0), flags)
+	assert.Equal(t, "user_subvol_rm_allowed", data)
+
+	flags, data = resolveMountOptions("noatime,user_subvol_rm_allowed,ro,compress=zstd")
+	assert.Equal(t, uintptr(unix.MS_NOATIME|unix.MS_RDONLY), flags)
+	assert.Equal(t, "user_subvol_rm_allowed,compress=zstd", data)
+
+	// Later options override earlier ones.
+	flags, data = resolveMountOptions("ro,rw")
+	assert.Equal(t, uintptr(0), flags)
+	assert.Equal(t, "", data)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/lxc/lxd/lxd/locking"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/shared"
 )
@@ -65,11 +66,35 @@ func (v Volume) NewSnapshot(snapshotName string) (Volume, error) {
 	return NewVolume(v.driver, v.pool, v.volType, v.contentType, fullSnapName, v.config), nil
 }
 
+// Name returns the name of the volume, including the snapshot name for snapshots.
+func (v Volume) Name() string {
+	return v.name
+}
+
 // IsSnapshot indicates if volume is a snapshot.
 func (v Volume) IsSnapshot() bool {
 	return shared.IsSnapshot(v.name)
 }
 
+// Type returns the volume type.
+func (v Volume) Type() VolumeType {
+	return v.volType
+}
+
+// ContentType returns the content type of the volume.
+func (v Volume) ContentType() ContentType {
+	return v.contentType
+}
+
+// GetDiskPath returns the location and format of the disk image of a block volume.
+func (v Volume) GetDiskPath() (string, string, error) {
+	if v.contentType != ContentTypeBlock {
+		return "", "", Errorf(ErrNotSupported, "Volume %q isn't a block volume", v.name)
+	}
+
+	return v.driver.GetVolumeDiskPath(v.volType, v.name)
+}
+
 // MountPath returns the path where the volume will be mounted.
 func (v Volume) MountPath() string {
 	return GetVolumeMountPath(v.pool, v.volType, v.name)
@@ -98,7 +123,7 @@ func (v Volume) CreateMountPath() error {
 }
 
 // MountTask runs the supplied task after mounting the volume if needed. If the volume was mounted
-// for this then it is unmounted when the task finishes.
+// for this then it is unmounted when the last task using it finishes.
 func (v Volume) MountTask(task func(mountPath string, op *operations.Operation) error, op *operations.Operation) error {
 	parentName, snapName, isSnap := shared.ContainerGetParentAndSnapshotName(v.name)
 
@@ -107,42 +132,49 @@ func (v Volume) MountTask(task func(mountPath string, op *operations.Operation)
 
 	// If the volume is a snapshot then call the snapshot specific mount/unmount functions as
 	// these will mount the snapshot read only.
+	var mount func() (bool, error)
+	var unmount func()
 	if isSnap {
-		unlock := lock(mountLockID)
-
-		ourMount, err := v.driver.MountVolumeSnapshot(v.volType, parentName, snapName, op)
-		if err != nil {
-			unlock()
-			return err
+		mount = func() (bool, error) {
+			return v.driver.MountVolumeSnapshot(v.volType, parentName, snapName, op)
 		}
 
-		unlock()
-
-		if ourMount {
-			defer func() {
-				unlock := lock(umountLockID)
-				v.driver.UnmountVolumeSnapshot(v.volType, parentName, snapName, op)
-				unlock()
-			}()
+		unmount = func() {
+			unlock := locking.Lock(umountLockID)
+			v.driver.UnmountVolumeSnapshot(v.volType, parentName, snapName, op)
+			unlock()
 		}
 	} else {
-		unlock := lock(mountLockID)
+		mount = func() (bool, error) {
+			return v.driver.MountVolume(v.volType, v.name, op)
+		}
 
-		ourMount, err := v.driver.MountVolume(v.volType, v.name, op)
-		if err != nil {
+		unmount = func() {
+			unlock := locking.Lock(umountLockID)
+			v.driver.UnmountVolume(v.volType, v.name, op)
 			unlock()
-			return err
 		}
+	}
 
+	// Tasks running at the same time share the mount of the volume, the last one to finish
+	// unmounts it.
+	unlock := locking.Lock(mountLockID)
+
+	ourMount, err := mount()
+	if err != nil {
 		unlock()
+		return err
+	}
 
-		if ourMount {
-			defer func() {
-				unlock := lock(umountLockID)
-				v.driver.UnmountVolume(v.volType, v.name, op)
-				unlock()
-			}()
-		}
+	tracked := refMountTask(mountLockID, ourMount, unmount)
+	unlock()
+
+	if tracked {
+		defer func() {
+			unlock := locking.Lock(mountLockID)
+			unrefMountTask(mountLockID)
+			unlock()
+		}()
 	}
 
 	return task(v.MountPath(), op)
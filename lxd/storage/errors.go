@@ -2,6 +2,8 @@ package storage
 
 import (
 	"fmt"
+
+	"github.com/lxc/lxd/lxd/storage/drivers"
 )
 
 // ErrNilValue is the "Nil value provided" error
@@ -11,4 +13,4 @@ var ErrNilValue = fmt.Errorf("Nil value provided")
 var ErrNotImplemented = fmt.Errorf("Not implemented")
 
 // ErrRunningQuotaResizeNotSupported is the "Running quota resize not supported" error.
-var ErrRunningQuotaResizeNotSupported = fmt.Errorf("Running quota resize not supported")
+var ErrRunningQuotaResizeNotSupported = drivers.Errorf(drivers.ErrNotSupported, "Running quota resize not supported")
@@ -3,12 +3,14 @@ package storage
 import (
 	"io"
 
+	"github.com/lxc/lxd/lxd/backup"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/migration"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/lxd/storage/drivers"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/containerwriter"
 )
 
 // Instance represents the storage relevant subset of a LXD instance.
@@ -40,19 +42,22 @@ type Pool interface {
 
 	// Instances.
 	CreateInstance(i Instance, op *operations.Operation) error
-	CreateInstanceFromBackup(i Instance, sourcePath string, op *operations.Operation) error
+	CreateInstanceFromBackup(srcBackup backup.Info, srcData io.ReadSeeker, op *operations.Operation) (func(), error)
 	CreateInstanceFromCopy(i Instance, src Instance, snapshots bool, op *operations.Operation) error
 	CreateInstanceFromImage(i Instance, fingerprint string, op *operations.Operation) error
-	CreateInstanceFromMigration(i Instance, conn io.ReadWriteCloser, args migration.SinkArgs, op *operations.Operation) error
+	CreateInstanceFromMigration(i Instance, conn io.ReadWriteCloser, args migration.VolumeTargetArgs, op *operations.Operation) error
 	RenameInstance(i Instance, newName string, op *operations.Operation) error
 	DeleteInstance(i Instance, op *operations.Operation) error
 
-	MigrateInstance(i Instance, snapshots bool, args migration.SourceArgs) (migration.StorageSourceDriver, error)
+	MigrateInstance(i Instance, conn io.ReadWriteCloser, args migration.VolumeSourceArgs, op *operations.Operation) error
 	RefreshInstance(i Instance, src Instance, snapshots bool, op *operations.Operation) error
-	BackupInstance(i Instance, targetPath string, optimized bool, snapshots bool, op *operations.Operation) error
+	BackupInstance(i Instance, tarWriter *containerwriter.ContainerTarWriter, optimized bool, snapshots []string, op *operations.Operation) error
 
 	GetInstanceUsage(i Instance) (int64, error)
+	GetInstanceDirectoryUsage(i Instance) (map[string]int64, error)
 	SetInstanceQuota(i Instance, size string, op *operations.Operation) error
+	CompactInstance(i Instance, op *operations.Operation) error
+	CheckInstance(i Instance, op *operations.Operation) (*api.StorageVolumeCheck, error)
 
 	MountInstance(i Instance, op *operations.Operation) (bool, error)
 	UnmountInstance(i Instance, op *operations.Operation) (bool, error)
@@ -62,32 +67,45 @@ type Pool interface {
 	CreateInstanceSnapshot(i Instance, name string, op *operations.Operation) error
 	RenameInstanceSnapshot(i Instance, newName string, op *operations.Operation) error
 	DeleteInstanceSnapshot(i Instance, op *operations.Operation) error
-	RestoreInstanceSnapshot(i Instance, op *operations.Operation) error
+	RestoreInstanceSnapshot(inst Instance, src Instance, op *operations.Operation) error
 	MountInstanceSnapshot(i Instance, op *operations.Operation) (bool, error)
 	UnmountInstanceSnapshot(i Instance, op *operations.Operation) (bool, error)
 
 	// Images.
 	EnsureImage(fingerprint string, op *operations.Operation) error
 	DeleteImage(fingerprint string, op *operations.Operation) error
+	PruneImages(op *operations.Operation) error
 
 	// Custom volumes.
-	CreateCustomVolume(volName, desc string, config map[string]string, op *operations.Operation) error
+	CustomVolumeWarnings(volName string, config map[string]string, contentType drivers.ContentType) []api.StorageVolumeWarning
+	CreateCustomVolume(volName, desc string, config map[string]string, contentType drivers.ContentType, op *operations.Operation) error
 	CreateCustomVolumeFromCopy(volName, desc string, config map[string]string, srcPoolName, srcVolName string, srcVolOnly bool, op *operations.Operation) error
+	RefreshCustomVolume(volName, srcPoolName, srcVolName string, srcVolOnly bool, op *operations.Operation) error
+	CreateCustomVolumeFromTarball(volName, desc string, config map[string]string, tarballPath string, op *operations.Operation) error
+	CreateCustomVolumeFromRsync(volName, desc string, config map[string]string, source string, op *operations.Operation) error
 	UpdateCustomVolume(volName, newDesc string, newConfig map[string]string, op *operations.Operation) error
 	RenameCustomVolume(volName string, newVolName string, op *operations.Operation) error
 	DeleteCustomVolume(volName string, op *operations.Operation) error
 	GetCustomVolumeUsage(volName string) (int64, error)
+	CheckCustomVolume(volName string, op *operations.Operation) (*api.StorageVolumeCheck, error)
 	MountCustomVolume(volName string, op *operations.Operation) (bool, error)
 	UnmountCustomVolume(volName string, op *operations.Operation) (bool, error)
+	GetCustomVolumeDisk(volName string) (string, string, error)
+	MountCustomVolumeShare(volName string, op *operations.Operation) (string, error)
+	ExportCustomVolumeDisk(volName string, targetPath string, op *operations.Operation) error
 
 	// Custom volume snapshots.
 	CreateCustomVolumeSnapshot(volName string, newSnapshotName string, op *operations.Operation) error
 	RenameCustomVolumeSnapshot(volName string, newSnapshotName string, op *operations.Operation) error
 	DeleteCustomVolumeSnapshot(volName string, op *operations.Operation) error
-	RestoreCustomVolume(volName string, snapshotName string, op *operations.Operation) error
+	RestoreCustomVolume(volName string, snapshotName string, force bool, op *operations.Operation) error
 
 	// Custom volume migration.
 	MigrationTypes(contentType drivers.ContentType) []migration.Type
 	CreateCustomVolumeFromMigration(conn io.ReadWriteCloser, args migration.VolumeTargetArgs, op *operations.Operation) error
 	MigrateCustomVolume(conn io.ReadWriteCloser, args migration.VolumeSourceArgs, op *operations.Operation) error
+
+	// Custom volume backups.
+	BackupCustomVolume(volName string, writer io.Writer, optimized bool, volumeOnly bool, op *operations.Operation) error
+	CreateCustomVolumeFromBackup(srcBackup backup.Info, srcData io.ReadSeeker, op *operations.Operation) error
 }
@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/lxc/lxd/lxd/db"
@@ -49,7 +48,7 @@ func volIDFuncMake(state *state.State, poolID int64) func(volType drivers.Volume
 		volID, _, err := state.Cluster.StoragePoolNodeVolumeGetTypeByProject(project, volName, volTypeID, poolID)
 		if err != nil {
 			if err == db.ErrNoSuchObject {
-				return -1, fmt.Errorf("Failed to get volume ID for project '%s', volume '%s', type '%s': Volume doesn't exist", project, volName, volType)
+				return -1, drivers.Errorf(drivers.ErrNotFound, "Failed to get volume ID for project '%s', volume '%s', type '%s': Volume doesn't exist", project, volName, volType)
 			}
 
 			return -1, err
@@ -77,11 +76,11 @@ func CreatePool(state *state.State, poolID int64, dbPool *api.StoragePoolsPost,
 		pool := mockBackend{}
 		pool.name = dbPool.Name
 		pool.state = state
-		pool.logger = logging.AddContext(logger.Log, log.Ctx{"driver": "mock", "pool": pool.name})
+		pool.logger = logging.AddContext(logger.Log, log.Ctx{"subsystem": "storage", "driver": "mock", "pool": pool.name})
 		return &pool, nil
 	}
 
-	logger := logging.AddContext(logger.Log, log.Ctx{"driver": dbPool.Driver, "pool": dbPool.Name})
+	logger := logging.AddContext(logger.Log, log.Ctx{"subsystem": "storage", "driver": dbPool.Driver, "pool": dbPool.Name})
 
 	// Load the storage driver.
 	driver, err := drivers.Load(state, dbPool.Driver, dbPool.Name, dbPool.Config, logger, volIDFuncMake(state, poolID), validateVolumeCommonRules)
@@ -114,7 +113,7 @@ func GetPoolByName(state *state.State, name string) (Pool, error) {
 		pool := mockBackend{}
 		pool.name = name
 		pool.state = state
-		pool.logger = logging.AddContext(logger.Log, log.Ctx{"driver": "mock", "pool": pool.name})
+		pool.logger = logging.AddContext(logger.Log, log.Ctx{"subsystem": "storage", "driver": "mock", "pool": pool.name})
 		return &pool, nil
 	}
 
@@ -129,7 +128,7 @@ func GetPoolByName(state *state.State, name string) (Pool, error) {
 		dbPool.Config = map[string]string{}
 	}
 
-	logger := logging.AddContext(logger.Log, log.Ctx{"driver": dbPool.Driver, "pool": dbPool.Name})
+	logger := logging.AddContext(logger.Log, log.Ctx{"subsystem": "storage", "driver": dbPool.Driver, "pool": dbPool.Name})
 
 	// Load the storage driver.
 	driver, err := drivers.Load(state, dbPool.Driver, dbPool.Name, dbPool.Config, logger, volIDFuncMake(state, poolID), validateVolumeCommonRules)
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lxc/lxd/shared/logger"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// How long the usage of a directory is served before being computed again.
+const directoryUsageTTL = 5 * time.Minute
+
+// How long the usage of the directories of a volume is kept after it was last requested.
+const directoryUsageMaxAge = time.Hour
+
+// Cache of the usage of the top-level directories of volumes, as walking them is expensive.
+var directoryUsages = directoryUsageCache{entries: map[string]*directoryUsageEntry{}}
+
+type directoryUsageCache struct {
+	mu      sync.Mutex
+	entries map[string]*directoryUsageEntry
+}
+
+type directoryUsageEntry struct {
+	dirs        map[string]directoryUsage
+	requestedAt time.Time
+	refreshedAt time.Time
+	refreshing  bool
+}
+
+type directoryUsage struct {
+	size       int64
+	computedAt time.Time
+}
+
+// DirectoryUsage returns the disk usage in bytes of each top-level directory of the given path, as
+// last computed. The usage is computed again in the background, one directory at a time, for the
+// directories whose usage is more than a few minutes old, so the result may be partial (or empty)
+// until that's done.
+//
+// The key identifies the volume holding the path. The mount function is called before walking the
+// path, and must return a function to call once done.
+func DirectoryUsage(key string, path string, mount func() (func(), error)) map[string]int64 {
+	directoryUsages.mu.Lock()
+	defer directoryUsages.mu.Unlock()
+
+	entry, ok := directoryUsages.entries[key]
+	if !ok {
+		entry = &directoryUsageEntry{dirs: map[string]directoryUsage{}}
+		directoryUsages.entries[key] = entry
+	}
+
+	entry.requestedAt = time.Now()
+
+	usage := map[string]int64{}
+	for dir, dirUsage := range entry.dirs {
+		usage[dir] = dirUsage.size
+	}
+
+	if time.Since(entry.refreshedAt) >= directoryUsageTTL && !entry.refreshing {
+		entry.refreshing = true
+		go directoryUsages.refresh(key, path, mount)
+	}
+
+	// Drop the usage of the volumes which aren't looked at anymore (e.g. deleted ones).
+	for k, entry := range directoryUsages.entries {
+		if time.Since(entry.requestedAt) >= directoryUsageMaxAge && !entry.refreshing {
+			delete(directoryUsages.entries, k)
+		}
+	}
+
+	return usage
+}
+
+// Compute again the usage of the top-level directories of the path whose usage is stale or
+// unknown, saving each of them as soon as it's known.
+func (c *directoryUsageCache) refresh(key string, path string, mount func() (func(), error)) {
+	defer func() {
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		if ok {
+			entry.refreshedAt = time.Now()
+			entry.refreshing = false
+		}
+		c.mu.Unlock()
+	}()
+
+	unmount, err := mount()
+	if err != nil {
+		logger.Warn("Failed to mount volume to compute its usage", log.Ctx{"path": path, "err": err})
+		return
+	}
+	defer unmount()
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		logger.Warn("Failed to list volume to compute its usage", log.Ctx{"path": path, "err": err})
+		return
+	}
+
+	dirs := map[string]bool{}
+	for _, file := range files {
+		if file.IsDir() {
+			dirs[file.Name()] = true
+		}
+	}
+
+	// Forget the directories which don't exist anymore.
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		for dir := range entry.dirs {
+			if !dirs[dir] {
+				delete(entry.dirs, dir)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for dir := range dirs {
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		if !ok {
+			c.mu.Unlock()
+			return
+		}
+
+		dirUsage, ok := entry.dirs[dir]
+		c.mu.Unlock()
+
+		if ok && time.Since(dirUsage.computedAt) < directoryUsageTTL {
+			continue
+		}
+
+		size, err := directorySize(filepath.Join(path, dir))
+		if err != nil {
+			logger.Warn("Failed to compute directory usage", log.Ctx{"path": filepath.Join(path, dir), "err": err})
+			continue
+		}
+
+		c.mu.Lock()
+		entry, ok = c.entries[key]
+		if ok {
+			entry.dirs[dir] = directoryUsage{size: size, computedAt: time.Now()}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Return the disk usage in bytes of the files under the given path, counting hard links once and
+// not crossing mount points.
+func directorySize(path string) (int64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return -1, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, fmt.Errorf("Failed to get file information of %q", path)
+	}
+
+	dev := stat.Dev
+	inodes := map[uint64]bool{}
+	var size int64
+
+	err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may go away while walking.
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+
+		if stat.Dev != dev {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if stat.Nlink > 1 && !info.IsDir() {
+			if inodes[stat.Ino] {
+				return nil
+			}
+
+			inodes[stat.Ino] = true
+		}
+
+		size += stat.Blocks * 512
+
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return size, nil
+}
@@ -7,12 +7,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pborman/uuid"
 	"golang.org/x/sys/unix"
 
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/instance/instancetype"
 	"github.com/lxc/lxd/lxd/state"
 	"github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/ioprogress"
@@ -409,6 +411,47 @@ func VolumeTypeToDBType(volType drivers.VolumeType) (int, error) {
 	return -1, fmt.Errorf("Invalid storage volume type")
 }
 
+// VolumeDBTypeToType converts internal volume type code to volume type.
+func VolumeDBTypeToType(volDBType int) (drivers.VolumeType, error) {
+	switch volDBType {
+	case db.StoragePoolVolumeTypeContainer:
+		return drivers.VolumeTypeContainer, nil
+	case db.StoragePoolVolumeTypeVM:
+		return drivers.VolumeTypeVM, nil
+	case db.StoragePoolVolumeTypeImage:
+		return drivers.VolumeTypeImage, nil
+	case db.StoragePoolVolumeTypeCustom:
+		return drivers.VolumeTypeCustom, nil
+	}
+
+	return "", fmt.Errorf("Invalid storage volume type")
+}
+
+// VolumeContentTypeToDBContentType converts volume content type to internal code.
+func VolumeContentTypeToDBContentType(contentType drivers.ContentType) (int, error) {
+	switch contentType {
+	case drivers.ContentTypeFS:
+		return db.StoragePoolVolumeContentTypeFS, nil
+	case drivers.ContentTypeBlock:
+		return db.StoragePoolVolumeContentTypeBlock, nil
+	}
+
+	return -1, fmt.Errorf("Invalid storage volume content type")
+}
+
+// VolumeContentTypeNameToContentType converts the content type name used by the API (and stored
+// on storage volumes) to the volume content type.
+func VolumeContentTypeNameToContentType(contentTypeName string) (drivers.ContentType, error) {
+	switch contentTypeName {
+	case db.StoragePoolVolumeContentTypeNameFS:
+		return drivers.ContentTypeFS, nil
+	case db.StoragePoolVolumeContentTypeNameBlock:
+		return drivers.ContentTypeBlock, nil
+	}
+
+	return "", fmt.Errorf("Invalid storage volume content type %q", contentTypeName)
+}
+
 // InstanceTypeToVolumeType converts instance type to volume type.
 func InstanceTypeToVolumeType(instType instancetype.Type) (drivers.VolumeType, error) {
 	switch instType {
@@ -422,13 +465,18 @@ func InstanceTypeToVolumeType(instType instancetype.Type) (drivers.VolumeType, e
 }
 
 // VolumeDBCreate creates a volume in the database.
-func VolumeDBCreate(s *state.State, poolName string, volumeName, volumeDescription string, volumeTypeName string, snapshot bool, volumeConfig map[string]string) error {
+func VolumeDBCreate(s *state.State, poolName string, volumeName, volumeDescription string, volumeTypeName string, snapshot bool, volumeConfig map[string]string, contentType drivers.ContentType) error {
 	// Convert the volume type name to our internal integer representation.
 	volumeType, err := VolumeTypeNameToType(volumeTypeName)
 	if err != nil {
 		return err
 	}
 
+	volumeContentType, err := VolumeContentTypeToDBContentType(contentType)
+	if err != nil {
+		return err
+	}
+
 	// Load storage pool the volume will be attached to.
 	poolID, poolStruct, err := s.Cluster.StoragePoolGet(poolName)
 	if err != nil {
@@ -442,9 +490,24 @@ func VolumeDBCreate(s *state.State, poolName string, volumeName, volumeDescripti
 		return fmt.Errorf("A storage volume of type %s already exists", volumeTypeName)
 	}
 
-	// Make sure that we don't pass a nil to the next function.
-	if volumeConfig == nil {
-		volumeConfig = map[string]string{}
+	// Work on a copy of the config, as it may come from the source volume of a copy or snapshot.
+	config := map[string]string{}
+	for k, v := range volumeConfig {
+		config[k] = v
+	}
+	volumeConfig = config
+
+	// Keep the UUID the volume comes with only if no other volume uses it, e.g. when importing it
+	// from a backup. Copies and snapshots get a new one.
+	if volumeConfig["volatile.uuid"] != "" {
+		exists, err := s.Cluster.StorageVolumeUUIDExists(volumeConfig["volatile.uuid"])
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			delete(volumeConfig, "volatile.uuid")
+		}
 	}
 
 	// Validate the requested storage volume configuration.
@@ -459,7 +522,7 @@ func VolumeDBCreate(s *state.State, poolName string, volumeName, volumeDescripti
 	}
 
 	// Create the database entry for the storage volume.
-	_, err = s.Cluster.StoragePoolVolumeCreate("default", volumeName, volumeDescription, volumeType, snapshot, poolID, volumeConfig)
+	_, err = s.Cluster.StoragePoolVolumeCreate("default", volumeName, volumeDescription, volumeType, snapshot, poolID, volumeConfig, volumeContentType)
 	if err != nil {
 		return fmt.Errorf("Error inserting %s of type %s into database: %s", poolName, volumeTypeName, err)
 	}
@@ -485,12 +548,33 @@ var StorageVolumeConfigKeys = map[string]func(value string) ([]string, error){
 	"block.mount_options": func(value string) ([]string, error) {
 		return []string{"ceph", "lvm"}, shared.IsAny(value)
 	},
+	"security.certificates": func(value string) ([]string, error) {
+		return SupportedPoolTypes, validateVolumeCertificates(value)
+	},
+	"security.projects": func(value string) ([]string, error) {
+		return SupportedPoolTypes, validateVolumeProjects(value)
+	},
 	"security.shifted": func(value string) ([]string, error) {
 		return SupportedPoolTypes, shared.IsBool(value)
 	},
 	"security.unmapped": func(value string) ([]string, error) {
 		return SupportedPoolTypes, shared.IsBool(value)
 	},
+	"snapshots.expiry": func(value string) ([]string, error) {
+		return SupportedPoolTypes, validateSnapshotExpiry(value)
+	},
+	"snapshots.schedule": func(value string) ([]string, error) {
+		return SupportedPoolTypes, shared.IsCronSchedule(value)
+	},
+	"snapshots.pattern": func(value string) ([]string, error) {
+		return SupportedPoolTypes, shared.IsAny(value)
+	},
+	"webhooks.url": func(value string) ([]string, error) {
+		return SupportedPoolTypes, webhook.ValidateURL(value)
+	},
+	"webhooks.events": func(value string) ([]string, error) {
+		return SupportedPoolTypes, shared.IsAny(value)
+	},
 	"size": func(value string) ([]string, error) {
 		if value == "" {
 			return SupportedPoolTypes, nil
@@ -509,6 +593,50 @@ var StorageVolumeConfigKeys = map[string]func(value string) ([]string, error){
 	"volatile.idmap.next": func(value string) ([]string, error) {
 		return SupportedPoolTypes, shared.IsAny(value)
 	},
+	"volatile.uuid": func(value string) ([]string, error) {
+		return SupportedPoolTypes, validateUUID(value)
+	},
+	"zfs.atime": func(value string) ([]string, error) {
+		err := shared.IsBool(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"zfs"}, nil
+	},
+	"zfs.delegate": func(value string) ([]string, error) {
+		err := shared.IsBool(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"zfs"}, nil
+	},
+	"zfs.logbias": func(value string) ([]string, error) {
+		err := shared.IsOneOf(value, []string{"", "latency", "throughput"})
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"zfs"}, nil
+	},
+	"zfs.recordsize": func(value string) ([]string, error) {
+		if value == "" {
+			return []string{"zfs"}, nil
+		}
+
+		size, err := units.ParseByteSizeString(value)
+		if err != nil {
+			return nil, err
+		}
+
+		// ZFS only accepts powers of two between 512 bytes and 16MiB.
+		if size < 512 || size > 16*1024*1024 || size&(size-1) != 0 {
+			return nil, fmt.Errorf("Invalid record size %q, must be a power of two between 512B and 16MiB", value)
+		}
+
+		return []string{"zfs"}, nil
+	},
 	"zfs.remove_snapshots": func(value string) ([]string, error) {
 		err := shared.IsBool(value)
 		if err != nil {
@@ -517,6 +645,14 @@ var StorageVolumeConfigKeys = map[string]func(value string) ([]string, error){
 
 		return []string{"zfs"}, nil
 	},
+	"zfs.sync": func(value string) ([]string, error) {
+		err := shared.IsOneOf(value, []string{"", "standard", "always", "disabled"})
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"zfs"}, nil
+	},
 	"zfs.use_refquota": func(value string) ([]string, error) {
 		err := shared.IsBool(value)
 		if err != nil {
@@ -532,6 +668,10 @@ func VolumeValidateConfig(name string, config map[string]string, parentPool *api
 	// Validate volume config using the new driver interface if supported.
 	driver, err := drivers.Load(nil, parentPool.Driver, parentPool.Name, parentPool.Config, nil, nil, validateVolumeCommonRules)
 	if err != drivers.ErrUnknownDriver {
+		if err != nil {
+			return err
+		}
+
 		// Note: This legacy validation function doesn't have the concept of validating
 		// different volumes types, so the types are hard coded as Custom and FS.
 		return driver.ValidateVolume(drivers.NewVolume(driver, parentPool.Name, drivers.VolumeTypeCustom, drivers.ContentTypeFS, name, config), false)
@@ -563,6 +703,16 @@ func VolumeValidateConfig(name string, config map[string]string, parentPool *api
 			if config["zfs.remove_snapshots"] != "" {
 				return fmt.Errorf("the key volume.zfs.remove_snapshots cannot be used with non zfs storage volumes")
 			}
+
+			if config["zfs.delegate"] != "" {
+				return fmt.Errorf("the key volume.zfs.delegate cannot be used with non zfs storage volumes")
+			}
+
+			for _, key := range []string{"zfs.atime", "zfs.logbias", "zfs.recordsize", "zfs.sync"} {
+				if config[key] != "" {
+					return fmt.Errorf("the key %s cannot be used with non zfs storage volumes", key)
+				}
+			}
 		}
 
 		if parentPool.Driver == "dir" {
@@ -581,6 +731,10 @@ func VolumeValidateConfig(name string, config map[string]string, parentPool *api
 
 // VolumeFillDefault fills default settings into a volume config.
 func VolumeFillDefault(name string, config map[string]string, parentPool *api.StoragePool) error {
+	if config["volatile.uuid"] == "" {
+		config["volatile.uuid"] = uuid.NewRandom().String()
+	}
+
 	if parentPool.Driver == "lvm" || parentPool.Driver == "ceph" {
 		if config["block.filesystem"] == "" {
 			config["block.filesystem"] = parentPool.Config["volume.block.filesystem"]
@@ -666,13 +820,36 @@ func VolumePropertiesTranslate(targetConfig map[string]string, targetParentPoolD
 	return newConfig, nil
 }
 
+// validateUUID checks that the value is empty or a valid UUID.
+func validateUUID(value string) error {
+	if value == "" || uuid.Parse(value) != nil {
+		return nil
+	}
+
+	return fmt.Errorf("Invalid UUID %q", value)
+}
+
+// validateSnapshotExpiry checks that the value is empty or a valid snapshot expiry expression.
+func validateSnapshotExpiry(value string) error {
+	_, err := shared.GetSnapshotExpiry(time.Time{}, value)
+	return err
+}
+
 // validateVolumeCommonRules returns a map of volume config rules common to all drivers.
-func validateVolumeCommonRules() map[string]func(string) error {
-	return map[string]func(string) error{
-		"security.shifted":    shared.IsBool,
-		"security.unmapped":   shared.IsBool,
-		"volatile.idmap.last": shared.IsAny,
-		"volatile.idmap.next": shared.IsAny,
+func validateVolumeCommonRules(vol drivers.Volume) map[string]func(string) error {
+	rules := map[string]func(string) error{
+		"security.certificates": validateVolumeCertificates,
+		"security.projects":     validateVolumeProjects,
+		"security.shifted":      shared.IsBool,
+		"security.unmapped":     shared.IsBool,
+		"snapshots.expiry":      validateSnapshotExpiry,
+		"snapshots.schedule":    shared.IsCronSchedule,
+		"snapshots.pattern":     shared.IsAny,
+		"volatile.idmap.last":   shared.IsAny,
+		"volatile.idmap.next":   shared.IsAny,
+		"volatile.uuid":         validateUUID,
+		"webhooks.url":          webhook.ValidateURL,
+		"webhooks.events":       shared.IsAny,
 		"size": func(value string) error {
 			if value == "" {
 				return nil
@@ -686,18 +863,28 @@ func validateVolumeCommonRules() map[string]func(string) error {
 			return nil
 		},
 	}
+
+	// Custom block volumes have no filesystem that could be shifted or unmapped for containers.
+	if vol.Type() == drivers.VolumeTypeCustom && vol.ContentType() == drivers.ContentTypeBlock {
+		delete(rules, "security.shifted")
+		delete(rules, "security.unmapped")
+	}
+
+	return rules
 }
 
 // ImageUnpack unpacks a filesystem image into the destination path.
 // There are several formats that images can come in:
 // Container Format A: Separate metadata tarball and root squashfs file.
-// 	- Unpack metadata tarball into mountPath.
-//	- Unpack root squashfs file into mountPath/rootfs.
+//   - Unpack metadata tarball into mountPath.
+//   - Unpack root squashfs file into mountPath/rootfs.
+//
 // Container Format B: Combined tarball containing metadata files and root squashfs.
-//	- Unpack combined tarball into mountPath.
+//   - Unpack combined tarball into mountPath.
+//
 // VM Format A: Separate metadata tarball and root qcow2 file.
-// 	- Unpack metadata tarball into mountPath (if file exists, convert to raw, if not just copy).
-//	- Check rootBlockPath is a file and convert qcow2 file into raw format in rootBlockPath.
+//   - Unpack metadata tarball into mountPath (if file exists, convert to raw, if not just copy).
+//   - Check rootBlockPath is a file and convert qcow2 file into raw format in rootBlockPath.
 func ImageUnpack(imageFile, destPath, destBlockFile string, blockBackend, runningInUserns bool, tracker *ioprogress.ProgressTracker) error {
 	// For all formats, first unpack the metadata (or combined) tarball into destPath.
 	err := shared.Unpack(imageFile, destPath, blockBackend, runningInUserns, tracker)
@@ -1191,6 +1191,16 @@ func (s *storageBtrfs) ContainerCopy(target Instance, source Instance, container
 	return nil
 }
 
+// ContainerClone creates the target container as a btrfs snapshot of the source.
+func (s *storageBtrfs) ContainerClone(target Instance, source Instance) error {
+	return s.ContainerCopy(target, source, true)
+}
+
+// ContainerFlatten is a no-op as btrfs snapshots don't depend on their source.
+func (s *storageBtrfs) ContainerFlatten(c Instance) error {
+	return nil
+}
+
 func (s *storageBtrfs) ContainerRefresh(target Instance, source Instance, snapshots []Instance) error {
 	logger.Debugf("Refreshing BTRFS container storage for %s from %s", target.Name(), source.Name())
 
@@ -1618,6 +1628,136 @@ func (s *storageBtrfs) doBtrfsBackup(cur string, prev string, target string) err
 	return err
 }
 
+// doBtrfsBackupSubvolumes dumps the subvolume at cur to target along with any subvolume
+// nested into it. The nested subvolumes are listed in a ".subvolumes" file next to target
+// and each dumped to its own ".subvolume-<index>.bin" file.
+func (s *storageBtrfs) doBtrfsBackupSubvolumes(cur string, prev string, target string) error {
+	subvols, err := btrfsSubVolumesGet(cur)
+	if err != nil {
+		return err
+	}
+
+	if len(subvols) == 0 {
+		// Incremental sends need a read-only parent, which subvolumes with nested ones aren't.
+		if prev != "" && !btrfsSubVolumeIsRo(prev) {
+			prev = ""
+		}
+
+		return s.doBtrfsBackup(cur, prev, target)
+	}
+	sort.Strings(subvols)
+
+	tmpPath, err := ioutil.TempDir(filepath.Dir(cur), ".backup-subvolumes")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	err = os.Chmod(tmpPath, 0100)
+	if err != nil {
+		return err
+	}
+
+	// Dump read-only copies, keeping the name of the main subvolume as restoring relies on it.
+	rootPath := filepath.Join(tmpPath, filepath.Base(cur))
+	err = s.btrfsPoolVolumeSnapshot(cur, rootPath, true)
+	if err != nil {
+		return err
+	}
+	defer btrfsSubVolumeDelete(rootPath)
+
+	err = s.doBtrfsBackup(rootPath, "", target)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(target, ".bin")
+	for i, subvol := range subvols {
+		subvolPath := filepath.Join(tmpPath, fmt.Sprintf("%d", i))
+		err = s.btrfsPoolVolumeSnapshot(filepath.Join(cur, subvol), subvolPath, true)
+		if err != nil {
+			return err
+		}
+		defer btrfsSubVolumeDelete(subvolPath)
+
+		err = s.doBtrfsBackup(subvolPath, "", fmt.Sprintf("%s.subvolume-%d.bin", base, i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(fmt.Sprintf("%s.subvolumes", base), []byte(strings.Join(subvols, "\n")+"\n"), 0600)
+}
+
+// doBtrfsRestoreSubvolumes receives the nested subvolumes dumped alongside backupFile (if
+// any) and puts them back in place inside targetPath.
+func (s *storageBtrfs) doBtrfsRestoreSubvolumes(backupFile string, tmpPath string, targetPath string) error {
+	base := strings.TrimSuffix(backupFile, ".bin")
+	content, err := ioutil.ReadFile(fmt.Sprintf("%s.subvolumes", base))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	subvols := strings.Fields(string(content))
+	if len(subvols) == 0 {
+		return nil
+	}
+
+	// A subvolume with nested subvolumes can never be read-only.
+	if btrfsSubVolumeIsRo(targetPath) {
+		err = btrfsSubVolumeMakeRw(targetPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, subvol := range subvols {
+		if filepath.IsAbs(subvol) || strings.HasPrefix(filepath.Clean(subvol), "..") {
+			return fmt.Errorf("Invalid nested subvolume path %q", subvol)
+		}
+
+		recvPath := filepath.Join(tmpPath, fmt.Sprintf(".subvolume-%d", i))
+		err := os.Mkdir(recvPath, 0100)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(recvPath)
+
+		feeder, err := os.Open(fmt.Sprintf("%s.subvolume-%d.bin", base, i))
+		if err != nil {
+			return err
+		}
+
+		btrfsRecvCmd := exec.Command("btrfs", "receive", "-e", recvPath)
+		btrfsRecvCmd.Stdin = feeder
+		msg, err := btrfsRecvCmd.CombinedOutput()
+		feeder.Close()
+		if err != nil {
+			logger.Errorf("Failed to receive nested subvolume \"%s\" of btrfs backup \"%s\": %s", subvol, backupFile, string(msg))
+			return err
+		}
+
+		receivedPath := filepath.Join(recvPath, fmt.Sprintf("%d", i))
+		defer btrfsSubVolumeDelete(receivedPath)
+
+		err = os.Remove(filepath.Join(targetPath, subvol))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		err = s.btrfsPoolVolumeSnapshot(receivedPath, filepath.Join(targetPath, subvol), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *storageBtrfs) doContainerBackupCreateOptimized(tmpPath string, backup backup.Backup, source Instance) error {
 	// Handle snapshots
 	finalParent := ""
@@ -1651,7 +1791,7 @@ func (s *storageBtrfs) doContainerBackupCreateOptimized(tmpPath string, backup b
 
 			// Make a binary btrfs backup
 			target := fmt.Sprintf("%s/%s.bin", snapshotsPath, snapName)
-			err := s.doBtrfsBackup(cur, prev, target)
+			err := s.doBtrfsBackupSubvolumes(cur, prev, target)
 			if err != nil {
 				return err
 			}
@@ -1683,7 +1823,7 @@ func (s *storageBtrfs) doContainerBackupCreateOptimized(tmpPath string, backup b
 
 	// Dump the container to a file
 	fsDump := fmt.Sprintf("%s/container.bin", tmpPath)
-	err = s.doBtrfsBackup(targetVolume, finalParent, fsDump)
+	err = s.doBtrfsBackupSubvolumes(targetVolume, finalParent, fsDump)
 	if err != nil {
 		return err
 	}
@@ -1855,6 +1995,11 @@ func (s *storageBtrfs) doContainerBackupLoadOptimized(info backup.Info, data io.
 			logger.Errorf("Failed to receive contents of btrfs backup \"%s\": %s", snapshotBackup, string(msg))
 			return err
 		}
+
+		err = s.doBtrfsRestoreSubvolumes(snapshotBackup, unpackDir, fmt.Sprintf("%s/%s", snapshotMntPoint, snapshotOnlyName))
+		if err != nil {
+			return err
+		}
 	}
 
 	containerBackupFile := fmt.Sprintf("%s/container.bin", unpackPath)
@@ -1882,6 +2027,11 @@ func (s *storageBtrfs) doContainerBackupLoadOptimized(info backup.Info, data io.
 		return err
 	}
 
+	err = s.doBtrfsRestoreSubvolumes(containerBackupFile, unpackDir, containerMntPoint)
+	if err != nil {
+		return err
+	}
+
 	// Create mountpoints
 	err = driver.CreateContainerMountpoint(containerMntPoint, shared.VarPath("containers", project.Prefix(info.Project, info.Name)), info.Privileged)
 	if err != nil {
@@ -2441,7 +2591,7 @@ func (s *storageBtrfs) MigrationSource(args MigrationSourceArgs) (MigrationStora
 	var err error
 	var snapshots = []Instance{}
 	if !args.InstanceOnly {
-		snapshots, err = args.Instance.Snapshots()
+		snapshots, err = migrationSourceSnapshots(args)
 		if err != nil {
 			return nil, err
 		}
@@ -2452,6 +2602,8 @@ func (s *storageBtrfs) MigrationSource(args MigrationSourceArgs) (MigrationStora
 		snapshots:          snapshots,
 		btrfsSnapshotNames: []string{},
 		btrfs:              s,
+		subvolumes:         shared.StringInSlice("subvolumes", args.BtrfsFeatures),
+		checksum:           args.Checksum,
 	}
 
 	if !args.InstanceOnly {
@@ -2469,17 +2621,13 @@ func (s *storageBtrfs) MigrationSink(conn *websocket.Conn, op *operations.Operat
 		return rsyncMigrationSink(conn, op, args)
 	}
 
-	btrfsRecv := func(snapName string, btrfsPath string, targetPath string, isSnapshot bool, writeWrapper func(io.WriteCloser) io.WriteCloser) error {
+	subvolumes := shared.StringInSlice("subvolumes", args.BtrfsFeatures)
+	checksum := args.Checksum
+
+	btrfsRecvStream := func(btrfsPath string, writeWrapper func(io.WriteCloser) io.WriteCloser) error {
 		args := []string{"receive", "-e", btrfsPath}
 		cmd := exec.Command("btrfs", args...)
 
-		// Remove the existing pre-created subvolume
-		err := btrfsSubVolumesDelete(targetPath)
-		if err != nil {
-			logger.Errorf("Failed to delete pre-created BTRFS subvolume: %s: %v", btrfsPath, err)
-			return err
-		}
-
 		stdin, err := cmd.StdinPipe()
 		if err != nil {
 			return err
@@ -2500,7 +2648,7 @@ func (s *storageBtrfs) MigrationSink(conn *websocket.Conn, op *operations.Operat
 			writePipe = writeWrapper(stdin)
 		}
 
-		<-shared.WebsocketRecvStream(writePipe, conn)
+		<-shared.WebsocketRecvStream(checksum.Writer(writePipe), conn)
 
 		output, err := ioutil.ReadAll(stderr)
 		if err != nil {
@@ -2513,14 +2661,65 @@ func (s *storageBtrfs) MigrationSink(conn *websocket.Conn, op *operations.Operat
 			return err
 		}
 
+		return nil
+	}
+
+	btrfsRecv := func(snapName string, btrfsPath string, targetPath string, isSnapshot bool, writeWrapper func(io.WriteCloser) io.WriteCloser) error {
+		// Get the list of nested subvolumes which follow the main one.
+		subvols := []string{}
+		if subvolumes {
+			err := conn.ReadJSON(&subvols)
+			if err != nil {
+				return err
+			}
+
+			for _, subvol := range subvols {
+				if filepath.IsAbs(subvol) || strings.HasPrefix(filepath.Clean(subvol), "..") {
+					return fmt.Errorf("Invalid nested subvolume path %q", subvol)
+				}
+			}
+		}
+
+		// Remove the existing pre-created subvolume
+		err := btrfsSubVolumesDelete(targetPath)
+		if err != nil {
+			logger.Errorf("Failed to delete pre-created BTRFS subvolume: %s: %v", btrfsPath, err)
+			return err
+		}
+
+		err = btrfsRecvStream(btrfsPath, writeWrapper)
+		if err != nil {
+			return err
+		}
+
+		receivedSubvols := []string{}
+		for i := range subvols {
+			subvolPath := filepath.Join(btrfsPath, fmt.Sprintf(".subvolume-%d", i))
+			err := os.Mkdir(subvolPath, 0100)
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(subvolPath)
+
+			err = btrfsRecvStream(subvolPath, writeWrapper)
+			if err != nil {
+				return err
+			}
+
+			receivedSubvol := filepath.Join(subvolPath, fmt.Sprintf("%d", i))
+			defer btrfsSubVolumeDelete(receivedSubvol)
+			receivedSubvols = append(receivedSubvols, receivedSubvol)
+		}
+
 		receivedSnapshot := fmt.Sprintf("%s/.migration-send", btrfsPath)
 		// handle older lxd versions
 		if !shared.PathExists(receivedSnapshot) {
 			receivedSnapshot = fmt.Sprintf("%s/.root", btrfsPath)
 		}
+		// A subvolume with nested subvolumes can never be read-only.
 		if isSnapshot {
 			receivedSnapshot = fmt.Sprintf("%s/%s", btrfsPath, snapName)
-			err = s.btrfsPoolVolumesSnapshot(receivedSnapshot, targetPath, true, true)
+			err = s.btrfsPoolVolumesSnapshot(receivedSnapshot, targetPath, len(subvols) == 0, true)
 		} else {
 			err = s.btrfsPoolVolumesSnapshot(receivedSnapshot, targetPath, false, true)
 		}
@@ -2529,6 +2728,20 @@ func (s *storageBtrfs) MigrationSink(conn *websocket.Conn, op *operations.Operat
 			return err
 		}
 
+		// Put the nested subvolumes back in place of the empty directories they left.
+		for i, subvol := range subvols {
+			err = os.Remove(filepath.Join(targetPath, subvol))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			err = s.btrfsPoolVolumeSnapshot(receivedSubvols[i], filepath.Join(targetPath, subvol), false)
+			if err != nil {
+				logger.Errorf("Problem with btrfs snapshot: %s", err)
+				return err
+			}
+		}
+
 		err = btrfsSubVolumesDelete(receivedSnapshot)
 		if err != nil {
 			logger.Errorf("Failed to delete BTRFS subvolume \"%s\": %s", btrfsPath, err)
@@ -455,6 +455,10 @@ func (s *storageCeph) StoragePoolVolumeDelete() error {
 			logger.Errorf(msg)
 			return fmt.Errorf(msg)
 		}
+
+		if ret == 1 {
+			s.flattenZombiesBackground()
+		}
 		logger.Debugf(`Deleted RBD storage volume "%s" on storage pool "%s"`, s.volume.Name, s.pool.Name)
 	}
 
@@ -762,6 +766,7 @@ func (s *storageCeph) StoragePoolUpdate(writable *api.StoragePoolPut, changedCon
 	// "volume.block.filesystem" requires no on-disk modifications.
 	// "volume.block.mount_options" requires no on-disk modifications.
 	// "volume.size" requires no on-disk modifications.
+	// "ceph.rbd.flatten_clones" requires no on-disk modifications.
 
 	logger.Infof(`Updated CEPH storage pool "%s"`, s.pool.Name)
 	return nil
@@ -982,6 +987,10 @@ func (s *storageCeph) ContainerDelete(container Instance) error {
 			logger.Errorf(msg)
 			return fmt.Errorf(msg)
 		}
+
+		if ret == 1 {
+			s.flattenZombiesBackground()
+		}
 	}
 
 	err := deleteContainerMountpoint(containerMntPoint, containerPath,
@@ -1330,6 +1339,46 @@ func (s *storageCeph) ContainerCopy(target Instance, source Instance, containerO
 	return nil
 }
 
+// ContainerClone creates the target container as an RBD clone of the current state of the source.
+func (s *storageCeph) ContainerClone(target Instance, source Instance) error {
+	logger.Debugf(`Cloning RBD container storage %s to %s`, source.Name(), target.Name())
+
+	return s.copyWithoutSnapshotsSparse(target, source)
+}
+
+// ContainerFlatten makes a cloned container independent of the snapshot it was cloned from.
+func (s *storageCeph) ContainerFlatten(c Instance) error {
+	volumeName := project.Prefix(c.Project(), c.Name())
+
+	parent, err := cephRBDVolumeGetParent(s.ClusterName, s.OSDPoolName, volumeName, storagePoolVolumeTypeNameContainer, s.UserName)
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return nil
+		}
+
+		return err
+	}
+
+	logger.Debugf(`Flattening RBD container storage %s`, c.Name())
+
+	err = cephRBDVolumeFlatten(s.ClusterName, s.OSDPoolName, volumeName, storagePoolVolumeTypeNameContainer, s.UserName)
+	if err != nil {
+		return err
+	}
+
+	// Remove the temporary snapshot the clone was created from if nothing else depends on it anymore.
+	parentPool, parentType, parentName, parentSnapshot, err := parseParent(parent)
+	if err == nil && strings.HasPrefix(parentSnapshot, "zombie_snapshot_") {
+		ret := cephContainerSnapshotDelete(s.ClusterName, parentPool, parentName, parentType, parentSnapshot, s.UserName)
+		if ret < 0 {
+			logger.Warnf(`Failed to delete RBD snapshot "%s", manual cleanup needed`, parent)
+		}
+	}
+
+	logger.Debugf(`Flattened RBD container storage %s`, c.Name())
+	return nil
+}
+
 func (s *storageCeph) ContainerRefresh(target Instance, source Instance, snapshots []Instance) error {
 	logger.Debugf(`Refreshing RBD container storage for %s from %s`, target.Name(), source.Name())
 
@@ -2289,6 +2338,8 @@ func (s *storageCeph) ImageDelete(fingerprint string) error {
 			return err
 		}
 		logger.Debugf(`Marked RBD storage volume for image "%s" on storage pool "%s" as zombie`, fingerprint, s.pool.Name)
+
+		s.flattenZombiesBackground()
 	}
 
 	err = s.deleteImageDbPoolVolume(fingerprint)
@@ -2809,6 +2860,7 @@ func (s *storageCeph) MigrationSource(args MigrationSourceArgs) (MigrationStorag
 		return &rbdMigrationSourceDriver{
 			container: args.Instance,
 			ceph:      s,
+			checksum:  args.Checksum,
 		}, nil
 	}
 
@@ -2817,6 +2869,7 @@ func (s *storageCeph) MigrationSource(args MigrationSourceArgs) (MigrationStorag
 		snapshots:        []Instance{},
 		rbdSnapshotNames: []string{},
 		ceph:             s,
+		checksum:         args.Checksum,
 	}
 
 	instanceName := args.Instance.Name()
@@ -2848,6 +2901,10 @@ func (s *storageCeph) MigrationSource(args MigrationSourceArgs) (MigrationStorag
 			continue
 		}
 
+		if !migrationSnapshotSelected(args.Snapshots, snap[len("snapshot_"):]) {
+			continue
+		}
+
 		lxdName := fmt.Sprintf("%s%s%s", instanceName, shared.SnapshotDelimiter, snap[len("snapshot_"):])
 		snapshot, err := instanceLoadByProjectAndName(s.s, args.Instance.Project(), lxdName)
 		if err != nil {
@@ -2931,7 +2988,7 @@ func (s *storageCeph) MigrationSink(conn *websocket.Conn, op *operations.Operati
 		logger.Debugf(`Created empty RBD storage volume for container "%s" on storage pool "%s`, instanceName, s.OSDPoolName)
 
 		wrapper := migration.ProgressWriter(op, "fs_progress", curSnapName)
-		err = s.rbdRecv(conn, recvName, wrapper)
+		err = s.rbdRecv(conn, recvName, wrapper, args.Checksum)
 		if err != nil {
 			logger.Errorf(`Failed to receive RBD storage volume "%s": %s`, curSnapName, err)
 			return err
@@ -2966,7 +3023,7 @@ func (s *storageCeph) MigrationSink(conn *websocket.Conn, op *operations.Operati
 
 	// receive the container itself
 	wrapper := migration.ProgressWriter(op, "fs_progress", instanceName)
-	err := s.rbdRecv(conn, recvName, wrapper)
+	err := s.rbdRecv(conn, recvName, wrapper, args.Checksum)
 	if err != nil {
 		logger.Errorf(`Failed to receive RBD storage volume "%s": %s`, recvName, err)
 		return err
@@ -2974,7 +3031,7 @@ func (s *storageCeph) MigrationSink(conn *websocket.Conn, op *operations.Operati
 	logger.Debugf(`Received RBD storage volume "%s"`, recvName)
 
 	if args.Live {
-		err := s.rbdRecv(conn, recvName, wrapper)
+		err := s.rbdRecv(conn, recvName, wrapper, args.Checksum)
 		if err != nil {
 			logger.Errorf(`Failed to receive RBD storage volume "%s": %s`, recvName, err)
 			return err
@@ -3003,7 +3060,8 @@ func (s *storageCeph) MigrationSink(conn *websocket.Conn, op *operations.Operati
 }
 func (s *storageCeph) rbdRecv(conn *websocket.Conn,
 	volumeName string,
-	writeWrapper func(io.WriteCloser) io.WriteCloser) error {
+	writeWrapper func(io.WriteCloser) io.WriteCloser,
+	checksum *migration.Checksum) error {
 	args := []string{
 		"import-diff",
 		"--cluster", s.ClusterName,
@@ -3033,7 +3091,7 @@ func (s *storageCeph) rbdRecv(conn *websocket.Conn,
 		writePipe = writeWrapper(stdin)
 	}
 
-	<-shared.WebsocketRecvStream(writePipe, conn)
+	<-shared.WebsocketRecvStream(checksum.Writer(writePipe), conn)
 
 	output, err := ioutil.ReadAll(stderr)
 	if err != nil {
@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -579,6 +580,81 @@ func cephRBDVolumeGetParent(clusterName string, poolName string,
 	return msg, nil
 }
 
+// cephRBDVolumeFlatten copies all the blocks an RBD storage volume shares with
+// its parent snapshot into the volume, making it independent of its parent.
+func cephRBDVolumeFlatten(clusterName string, poolName string,
+	volumeName string, volumeType string, userName string) error {
+	_, err := shared.RunCommand(
+		"rbd",
+		"--id", userName,
+		"--cluster", clusterName,
+		"--pool", poolName,
+		"flatten",
+		fmt.Sprintf("%s_%s", volumeType, volumeName))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cephRBDVolumesList lists the RBD storage volumes of a given OSD pool
+func cephRBDVolumesList(clusterName string, poolName string, userName string) ([]string, error) {
+	msg, err := shared.RunCommand(
+		"rbd",
+		"--id", userName,
+		"--cluster", clusterName,
+		"--pool", poolName,
+		"ls")
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(msg), nil
+}
+
+// cephRBDVolumeFlattenClones flattens all the clones of the snapshots of a
+// given RBD storage volume, so that none of them depends on it anymore.
+func cephRBDVolumeFlattenClones(clusterName string, poolName string,
+	volumeName string, volumeType string, userName string) error {
+	snaps, err := cephRBDVolumeListSnapshots(clusterName, poolName,
+		volumeName, volumeType, userName)
+	if err != nil {
+		if err == db.ErrNoSuchObject {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, snap := range snaps {
+		clones, err := cephRBDSnapshotListClones(clusterName, poolName,
+			volumeName, volumeType, snap, userName)
+		if err != nil {
+			if err == db.ErrNoSuchObject {
+				continue
+			}
+
+			return err
+		}
+
+		for _, clone := range clones {
+			clonePool, cloneType, cloneName, err := parseClone(clone)
+			if err != nil {
+				return err
+			}
+
+			err = cephRBDVolumeFlatten(clusterName, clonePool, cloneName,
+				cloneType, userName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // cephRBDSnapshotDelete deletes an RBD snapshot
 // This requires that the snapshot does not have any clones and is unmapped and
 // unprotected.
@@ -2084,3 +2160,55 @@ func (s *storageCeph) cephRBDGenerateUUID(volumeName string, volumeType string)
 
 	return nil
 }
+
+var cephFlattenLock sync.Mutex
+
+// flattenZombiesBackground flattens the clones still depending on the RBD
+// storage volumes kept around as zombies and then deletes those volumes, if
+// "ceph.rbd.flatten_clones" is enabled on the pool. As flattening copies all
+// the data the clones share with their parent, this runs in the background.
+func (s *storageCeph) flattenZombiesBackground() {
+	if !shared.IsTrue(s.pool.Config["ceph.rbd.flatten_clones"]) {
+		return
+	}
+
+	clusterName := s.ClusterName
+	poolName := s.OSDPoolName
+	userName := s.UserName
+
+	go func() {
+		cephFlattenLock.Lock()
+		defer cephFlattenLock.Unlock()
+
+		volumes, err := cephRBDVolumesList(clusterName, poolName, userName)
+		if err != nil {
+			logger.Errorf(`Failed to list RBD storage volumes of OSD pool "%s": %s`, poolName, err)
+			return
+		}
+
+		for _, volume := range volumes {
+			if !strings.HasPrefix(volume, "zombie_") {
+				continue
+			}
+
+			_, volumeType, volumeName, err := parseClone(fmt.Sprintf("%s/%s", poolName, volume))
+			if err != nil {
+				continue
+			}
+
+			err = cephRBDVolumeFlattenClones(clusterName, poolName, volumeName, volumeType, userName)
+			if err != nil {
+				logger.Errorf(`Failed to flatten the clones of RBD storage volume "%s": %s`, volume, err)
+				continue
+			}
+
+			ret := cephContainerDelete(clusterName, poolName, volumeName, volumeType, userName)
+			if ret < 0 {
+				logger.Errorf(`Failed to delete RBD storage volume "%s"`, volume)
+				continue
+			}
+
+			logger.Debugf(`Flattened the clones of RBD storage volume "%s"`, volume)
+		}
+	}()
+}
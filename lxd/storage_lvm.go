@@ -711,6 +711,7 @@ func (s *storageLvm) StoragePoolUpdate(writable *api.StoragePoolPut, changedConf
 	// "volume.block.filesystem" requires no on-disk modifications.
 	// "volume.size" requires no on-disk modifications.
 	// "rsync.bwlimit" requires no on-disk modifications.
+	// "lvm.thinpool_autogrow*" requires no on-disk modifications.
 
 	revert := true
 
@@ -1136,6 +1137,20 @@ func (s *storageLvm) ContainerCopy(target Instance, source Instance, containerOn
 	return nil
 }
 
+// ContainerClone creates the target container as a thin snapshot of the source.
+func (s *storageLvm) ContainerClone(target Instance, source Instance) error {
+	if !s.useThinpool {
+		return fmt.Errorf("Clones require the LVM storage pool to use a thin pool")
+	}
+
+	return s.ContainerCopy(target, source, true)
+}
+
+// ContainerFlatten is a no-op as thin snapshots don't depend on their source.
+func (s *storageLvm) ContainerFlatten(c Instance) error {
+	return nil
+}
+
 func (s *storageLvm) doContainerCopy(target Instance, source Instance, containerOnly bool, refresh bool, refreshSnapshots []Instance) error {
 	ourStart, err := source.StorageStart()
 	if err != nil {
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/units"
+	"github.com/lxc/lxd/shared/version"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// Size and usage (in percent) of the data and metadata of an LVM thin pool.
+type lvmThinPoolStats struct {
+	dataSize        uint64
+	dataPercent     float64
+	metadataSize    uint64
+	metadataPercent float64
+}
+
+// Parts of each thin pool currently above their threshold, so that warnings are only sent when
+// that changes.
+var lvmThinPoolWarnings = map[string]string{}
+var lvmThinPoolWarningsMu sync.Mutex
+
+func lvmThinPoolGetStats(vgName string, thinPoolName string) (*lvmThinPoolStats, error) {
+	out, err := shared.TryRunCommand("lvs", fmt.Sprintf("%s/%s", vgName, thinPoolName), "--noheadings",
+		"--units", "b", "--nosuffix", "--separator", ",", "-o", "lv_size,data_percent,lv_metadata_size,metadata_percent")
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(strings.TrimSpace(out), ",")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("Unexpected output from lvs command")
+	}
+
+	stats := lvmThinPoolStats{}
+
+	stats.dataSize, err = strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.dataPercent, err = strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.metadataSize, err = strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.metadataPercent, err = strconv.ParseFloat(parts[3], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func lvmGetVGFree(vgName string) (uint64, error) {
+	out, err := shared.TryRunCommand("vgs", vgName, "--noheadings", "--units", "b", "--nosuffix", "-o", "vg_free")
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+// Returns the usage threshold and growth step (both in percent) of the pool's thin pool.
+func (s *storageLvm) getLvmThinpoolAutogrowPolicy() (float64, float64) {
+	threshold, err := strconv.Atoi(s.pool.Config["lvm.thinpool_autogrow.threshold"])
+	if err != nil {
+		threshold = 80
+	}
+
+	step, err := strconv.Atoi(s.pool.Config["lvm.thinpool_autogrow.step"])
+	if err != nil {
+		step = 20
+	}
+
+	return float64(threshold), float64(step)
+}
+
+// thinPoolCheck grows the data or metadata of the pool's thin pool when their usage reaches the
+// configured threshold and "lvm.thinpool_autogrow" is enabled. It returns the parts ("data" and/or
+// "metadata") which are above the threshold and couldn't be grown.
+func (s *storageLvm) thinPoolCheck() ([]string, error) {
+	vgName := s.getOnDiskPoolName()
+	thinPool := fmt.Sprintf("%s/%s", vgName, s.thinPoolName)
+
+	stats, err := lvmThinPoolGetStats(vgName, s.thinPoolName)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := lvmGetVGFree(vgName)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, step := s.getLvmThinpoolAutogrowPolicy()
+	autogrow := shared.IsTrue(s.pool.Config["lvm.thinpool_autogrow"])
+	exhausted := []string{}
+
+	// Try to grow the given part of the thin pool by the configured step.
+	grow := func(part string, size uint64, args ...string) {
+		extra := uint64(float64(size) * step / 100)
+		if !autogrow || extra == 0 || extra > free {
+			exhausted = append(exhausted, part)
+			return
+		}
+
+		args = append(args, fmt.Sprintf("+%db", extra), thinPool)
+		_, err := shared.TryRunCommand("lvextend", args...)
+		if err != nil {
+			logger.Error("Failed to grow LVM thin pool", log.Ctx{"pool": s.pool.Name, "part": part, "err": err})
+			exhausted = append(exhausted, part)
+			return
+		}
+
+		free -= extra
+		logger.Info("Grew LVM thin pool", log.Ctx{"pool": s.pool.Name, "part": part, "size": units.GetByteSizeString(int64(size+extra), 2)})
+	}
+
+	if stats.dataPercent >= threshold {
+		grow("data", stats.dataSize, "-L")
+	}
+
+	if stats.metadataPercent >= threshold {
+		grow("metadata", stats.metadataSize, "--poolmetadatasize")
+	}
+
+	return exhausted, nil
+}
+
+// Checks the thin pools of the local LVM storage pools, growing them or warning about their usage
+// as needed.
+func lvmThinPoolsCheck(s *state.State) {
+	pools, err := s.Cluster.StoragePoolsNotPending()
+	if err != nil {
+		logger.Error("Failed to load storage pools for LVM thin pool check", log.Ctx{"err": err})
+		return
+	}
+
+	for _, poolName := range pools {
+		_, pool, err := s.Cluster.StoragePoolGet(poolName)
+		if err != nil || pool.Driver != "lvm" {
+			continue
+		}
+
+		st, err := storagePoolInit(s, poolName)
+		if err != nil {
+			continue
+		}
+
+		lvm, ok := st.(*storageLvm)
+		if !ok || !lvm.useThinpool {
+			continue
+		}
+
+		exhausted, err := lvm.thinPoolCheck()
+		if err != nil {
+			logger.Debug("Failed to check LVM thin pool", log.Ctx{"pool": poolName, "err": err})
+			continue
+		}
+
+		parts := strings.Join(exhausted, ",")
+
+		lvmThinPoolWarningsMu.Lock()
+		previous := lvmThinPoolWarnings[poolName]
+		lvmThinPoolWarnings[poolName] = parts
+		lvmThinPoolWarningsMu.Unlock()
+
+		if parts == "" || parts == previous {
+			continue
+		}
+
+		logger.Warn("LVM thin pool is running out of space and can't be grown", log.Ctx{"pool": poolName, "parts": parts})
+
+		source := fmt.Sprintf("/%s/storage-pools/%s", version.APIVersion, poolName)
+		s.Events.SendLifecycle("", "storage-pool-thinpool-warning", source, map[string]interface{}{"parts": exhausted})
+	}
+}
+
+func lvmThinPoolsTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		lvmThinPoolsCheck(d.State())
+	}
+
+	return f, task.Every(time.Minute)
+}
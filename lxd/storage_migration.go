@@ -171,7 +171,7 @@ func rsyncMigrationSource(args MigrationSourceArgs) (MigrationStorageSourceDrive
 	var err error
 	var snapshots = []Instance{}
 	if !args.InstanceOnly {
-		snapshots, err = args.Instance.Snapshots()
+		snapshots, err = migrationSourceSnapshots(args)
 		if err != nil {
 			return nil, err
 		}
@@ -180,6 +180,27 @@ func rsyncMigrationSource(args MigrationSourceArgs) (MigrationStorageSourceDrive
 	return rsyncStorageSourceDriver{args.Instance, snapshots, args.RsyncFeatures}, nil
 }
 
+// migrationSourceSnapshots returns the snapshots of the instance being migrated which are part of
+// the selection to transfer.
+func migrationSourceSnapshots(args MigrationSourceArgs) ([]Instance, error) {
+	allSnapshots, err := args.Instance.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Instance{}
+	for _, snap := range allSnapshots {
+		_, snapName, _ := shared.ContainerGetParentAndSnapshotName(snap.Name())
+		if !migrationSnapshotSelected(args.Snapshots, snapName) {
+			continue
+		}
+
+		snapshots = append(snapshots, snap)
+	}
+
+	return snapshots, nil
+}
+
 func snapshotProtobufToInstanceArgs(project string, containerName string, snap *migration.Snapshot) db.InstanceArgs {
 	config := map[string]string{}
 
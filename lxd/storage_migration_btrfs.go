@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 
 	"github.com/gorilla/websocket"
 
@@ -23,6 +25,12 @@ type btrfsMigrationSourceDriver struct {
 	btrfs              *storageBtrfs
 	runningSnapName    string
 	stoppedSnapName    string
+
+	// Whether the sink supports receiving nested subvolumes.
+	subvolumes bool
+
+	// Digest of the sent streams, when requested by the sink.
+	checksum *migration.Checksum
 }
 
 func (s *btrfsMigrationSourceDriver) send(conn *websocket.Conn, btrfsPath string, btrfsParent string, readWrapper func(io.ReadCloser) io.ReadCloser) error {
@@ -54,7 +62,7 @@ func (s *btrfsMigrationSourceDriver) send(conn *websocket.Conn, btrfsPath string
 		return err
 	}
 
-	<-shared.WebsocketSendStream(conn, readPipe, 4*1024*1024)
+	<-shared.WebsocketSendStream(conn, s.checksum.Reader(readPipe), 4*1024*1024)
 
 	output, err := ioutil.ReadAll(stderr)
 	if err != nil {
@@ -69,6 +77,78 @@ func (s *btrfsMigrationSourceDriver) send(conn *websocket.Conn, btrfsPath string
 	return err
 }
 
+// sendSubvolumes sends the subvolume at btrfsPath along with any subvolume nested into it.
+// When supported by the sink, the list of nested subvolumes is sent first, followed by a
+// read-only copy of the subvolume itself and then one stream per nested subvolume.
+func (s *btrfsMigrationSourceDriver) sendSubvolumes(conn *websocket.Conn, btrfsPath string, btrfsParent string, readWrapper func(io.ReadCloser) io.ReadCloser) error {
+	if !s.subvolumes {
+		return s.send(conn, btrfsPath, btrfsParent, readWrapper)
+	}
+
+	subvols, err := btrfsSubVolumesGet(btrfsPath)
+	if err != nil {
+		return err
+	}
+	sort.Strings(subvols)
+
+	err = conn.WriteJSON(subvols)
+	if err != nil {
+		return err
+	}
+
+	// Incremental sends need a read-only parent, which subvolumes with nested ones aren't.
+	if btrfsParent != "" && !btrfsSubVolumeIsRo(btrfsParent) {
+		btrfsParent = ""
+	}
+
+	if len(subvols) == 0 {
+		return s.send(conn, btrfsPath, btrfsParent, readWrapper)
+	}
+
+	tmpPath, err := ioutil.TempDir(filepath.Dir(btrfsPath), ".migration-subvolumes")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	err = os.Chmod(tmpPath, 0100)
+	if err != nil {
+		return err
+	}
+
+	// A subvolume with nested subvolumes can't be made read-only, so send read-only
+	// copies of each of them instead. The copy of the subvolume itself keeps its name
+	// as the sink relies on it.
+	rootPath := filepath.Join(tmpPath, filepath.Base(btrfsPath))
+	err = s.btrfs.btrfsPoolVolumeSnapshot(btrfsPath, rootPath, true)
+	if err != nil {
+		return err
+	}
+	defer btrfsSubVolumeDelete(rootPath)
+
+	// The parent won't match the copy, so send it in full.
+	err = s.send(conn, rootPath, "", readWrapper)
+	if err != nil {
+		return err
+	}
+
+	for i, subvol := range subvols {
+		subvolPath := filepath.Join(tmpPath, fmt.Sprintf("%d", i))
+		err = s.btrfs.btrfsPoolVolumeSnapshot(filepath.Join(btrfsPath, subvol), subvolPath, true)
+		if err != nil {
+			return err
+		}
+		defer btrfsSubVolumeDelete(subvolPath)
+
+		err = s.send(conn, subvolPath, "", readWrapper)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *btrfsMigrationSourceDriver) SendWhileRunning(conn *websocket.Conn, op *operations.Operation, bwlimit string, containerOnly bool) error {
 	_, containerPool, _ := s.container.Storage().GetContainerPoolInfo()
 	containerName := s.container.Name()
@@ -100,7 +180,7 @@ func (s *btrfsMigrationSourceDriver) SendWhileRunning(conn *websocket.Conn, op *
 		defer btrfsSubVolumesDelete(migrationSendSnapshot)
 
 		wrapper := migration.ProgressReader(op, "fs_progress", containerName)
-		return s.send(conn, migrationSendSnapshot, "", wrapper)
+		return s.sendSubvolumes(conn, migrationSendSnapshot, "", wrapper)
 	}
 
 	if !containerOnly {
@@ -112,7 +192,7 @@ func (s *btrfsMigrationSourceDriver) SendWhileRunning(conn *websocket.Conn, op *
 
 			snapMntPoint := driver.GetSnapshotMountPoint(snap.Project(), containerPool, snap.Name())
 			wrapper := migration.ProgressReader(op, "fs_progress", snap.Name())
-			if err := s.send(conn, snapMntPoint, prev, wrapper); err != nil {
+			if err := s.sendSubvolumes(conn, snapMntPoint, prev, wrapper); err != nil {
 				return err
 			}
 		}
@@ -143,7 +223,7 @@ func (s *btrfsMigrationSourceDriver) SendWhileRunning(conn *websocket.Conn, op *
 	}
 
 	wrapper := migration.ProgressReader(op, "fs_progress", containerName)
-	return s.send(conn, migrationSendSnapshot, btrfsParent, wrapper)
+	return s.sendSubvolumes(conn, migrationSendSnapshot, btrfsParent, wrapper)
 }
 
 func (s *btrfsMigrationSourceDriver) SendAfterCheckpoint(conn *websocket.Conn, bwlimit string) error {
@@ -167,7 +247,7 @@ func (s *btrfsMigrationSourceDriver) SendAfterCheckpoint(conn *websocket.Conn, b
 		return err
 	}
 
-	return s.send(conn, s.stoppedSnapName, s.runningSnapName, nil)
+	return s.sendSubvolumes(conn, s.stoppedSnapName, s.runningSnapName, nil)
 }
 
 func (s *btrfsMigrationSourceDriver) Cleanup() {
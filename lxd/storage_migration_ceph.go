@@ -23,6 +23,7 @@ type rbdMigrationSourceDriver struct {
 	ceph             *storageCeph
 	runningSnapName  string
 	stoppedSnapName  string
+	checksum         *migration.Checksum
 }
 
 func (s *rbdMigrationSourceDriver) Snapshots() []Instance {
@@ -211,7 +212,7 @@ func (s *rbdMigrationSourceDriver) rbdSend(conn *websocket.Conn,
 		return err
 	}
 
-	<-shared.WebsocketSendStream(conn, readPipe, 4*1024*1024)
+	<-shared.WebsocketSendStream(conn, s.checksum.Reader(readPipe), 4*1024*1024)
 
 	output, err := ioutil.ReadAll(stderr)
 	if err != nil {
@@ -24,6 +24,7 @@ type zfsMigrationSourceDriver struct {
 	runningSnapName  string
 	stoppedSnapName  string
 	zfsFeatures      []string
+	checksum         *migration.Checksum
 }
 
 func (s *zfsMigrationSourceDriver) send(conn *websocket.Conn, zfsName string, zfsParent string, readWrapper func(io.ReadCloser) io.ReadCloser) error {
@@ -65,7 +66,7 @@ func (s *zfsMigrationSourceDriver) send(conn *websocket.Conn, zfsName string, zf
 		return err
 	}
 
-	<-shared.WebsocketSendStream(conn, readPipe, 4*1024*1024)
+	<-shared.WebsocketSendStream(conn, s.checksum.Reader(readPipe), 4*1024*1024)
 
 	output, err := ioutil.ReadAll(stderr)
 	if err != nil {
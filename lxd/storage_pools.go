@@ -46,6 +46,11 @@ var storagePoolCmd = APIEndpoint{
 func storagePoolsGet(d *Daemon, r *http.Request) response.Response {
 	recursion := util.IsRecursionRequest(r)
 
+	clustered, err := cluster.Enabled(d.db)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
 	pools, err := d.cluster.StoragePools()
 	if err != nil && err != db.ErrNoSuchObject {
 		return response.SmartError(err)
@@ -69,6 +74,11 @@ func storagePoolsGet(d *Daemon, r *http.Request) response.Response {
 			}
 			pl.UsedBy = poolUsedBy
 
+			pl.ETag, err = util.EtagHash(storagePoolEtag(pl, clustered))
+			if err != nil {
+				return response.SmartError(err)
+			}
+
 			resultMap = append(resultMap, *pl)
 		}
 	}
@@ -83,9 +93,6 @@ func storagePoolsGet(d *Daemon, r *http.Request) response.Response {
 // /1.0/storage-pools
 // Create a storage pool.
 func storagePoolsPost(d *Daemon, r *http.Request) response.Response {
-	storagePoolCreateLock.Lock()
-	defer storagePoolCreateLock.Unlock()
-
 	req := api.StoragePoolsPost{}
 
 	// Parse the request.
@@ -94,6 +101,15 @@ func storagePoolsPost(d *Daemon, r *http.Request) response.Response {
 		return response.BadRequest(err)
 	}
 
+	return doStoragePoolsPost(d, req, queryParam(r, "target"), isClusterNotification(r))
+}
+
+// Create a storage pool, or only define it on the given target node. A cluster notification
+// triggers the actual creation of a pool previously defined on all nodes.
+func doStoragePoolsPost(d *Daemon, req api.StoragePoolsPost, targetNode string, notification bool) response.Response {
+	storagePoolCreateLock.Lock()
+	defer storagePoolCreateLock.Unlock()
+
 	// Sanity checks.
 	if req.Name == "" {
 		return response.BadRequest(fmt.Errorf("No name provided"))
@@ -110,11 +126,11 @@ func storagePoolsPost(d *Daemon, r *http.Request) response.Response {
 	url := fmt.Sprintf("/%s/storage-pools/%s", version.APIVersion, req.Name)
 	resp := response.SyncResponseLocation(true, nil, url)
 
-	if isClusterNotification(r) {
+	if notification {
 		// This is an internal request which triggers the actual
 		// creation of the pool across all nodes, after they have been
 		// previously defined.
-		err = storagePoolValidate(req.Name, req.Driver, req.Config)
+		err := storagePoolValidate(req.Name, req.Driver, req.Config)
 		if err != nil {
 			return response.BadRequest(err)
 		}
@@ -132,7 +148,6 @@ func storagePoolsPost(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
-	targetNode := queryParam(r, "target")
 	if targetNode == "" {
 		count, err := cluster.Count(d.State())
 		if err != nil {
@@ -165,7 +180,7 @@ func storagePoolsPost(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
-	err = storagePoolValidate(req.Name, req.Driver, req.Config)
+	err := storagePoolValidate(req.Name, req.Driver, req.Config)
 	if err != nil {
 		return response.BadRequest(err)
 	}
@@ -245,23 +260,25 @@ func storagePoolsPostCluster(d *Daemon, req api.StoragePoolsPost) error {
 	}
 
 	// Notify all other nodes to create the pool.
-	notifier, err := cluster.NewNotifier(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAll)
-	if err != nil {
-		return err
-	}
-	notifyErr := notifier(func(client lxd.InstanceServer) error {
-		server, _, err := client.GetServer()
-		if err != nil {
-			return err
-		}
+	changes := []cluster.NotifyChange{{
+		Description: fmt.Sprintf("create storage pool %s", req.Name),
+		Apply: func(client lxd.InstanceServer) error {
+			server, _, err := client.GetServer()
+			if err != nil {
+				return err
+			}
 
-		nodeReq := req
-		for key, value := range configs[server.Environment.ServerName] {
-			nodeReq.Config[key] = value
-		}
+			nodeReq := req
+			nodeReq.Config = util.CopyConfig(req.Config)
+			for key, value := range configs[server.Environment.ServerName] {
+				nodeReq.Config[key] = value
+			}
 
-		return client.CreateStoragePool(nodeReq)
-	})
+			return client.CreateStoragePool(nodeReq)
+		},
+	}}
+
+	_, notifyErr := cluster.NotifyBatch(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAll, changes)
 
 	errored := notifyErr != nil
 
@@ -318,7 +335,7 @@ func storagePoolGet(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
-	etag := []interface{}{pool.Name, pool.Driver, pool.Config}
+	etag := storagePoolEtag(pool, false)
 
 	return response.SyncResponseETag(true, &pool, etag)
 }
@@ -328,6 +345,10 @@ func storagePoolGet(d *Daemon, r *http.Request) response.Response {
 func storagePoolPut(d *Daemon, r *http.Request) response.Response {
 	poolName := mux.Vars(r)["name"]
 
+	// Serialize with other updates of the same pool until done.
+	unlock := etagLock("storage-pool", "", poolName)
+	defer unlock()
+
 	// Get the existing storage pool.
 	_, dbInfo, err := d.cluster.StoragePoolGet(poolName)
 	if err != nil {
@@ -344,58 +365,22 @@ func storagePoolPut(d *Daemon, r *http.Request) response.Response {
 		return response.SmartError(err)
 	}
 
-	config := dbInfo.Config
 	if clustered {
 		err := storagePoolValidateClusterConfig(req.Config)
 		if err != nil {
 			return response.BadRequest(err)
 		}
-		config = storagePoolClusterConfigForEtag(config)
 	}
 
 	// Validate the ETag
-	etag := []interface{}{dbInfo.Name, dbInfo.Driver, config}
+	etag := storagePoolEtag(dbInfo, clustered)
 
 	err = util.EtagCheck(r, etag)
 	if err != nil {
 		return response.PreconditionFailed(err)
 	}
 
-	// Validate the configuration
-	err = storagePoolValidateConfig(poolName, dbInfo.Driver, req.Config, dbInfo.Config)
-	if err != nil {
-		return response.BadRequest(err)
-	}
-
-	config = req.Config
-	if clustered {
-		// For clustered requests, we need to complement the request's config
-		// with our node-specific values.
-		config = storagePoolClusterFillWithNodeConfig(dbInfo.Config, config)
-	}
-
-	// Notify the other nodes, unless this is itself a notification.
-	if clustered && !isClusterNotification(r) {
-		cert := d.endpoints.NetworkCert()
-		notifier, err := cluster.NewNotifier(d.State(), cert, cluster.NotifyAll)
-		if err != nil {
-			return response.SmartError(err)
-		}
-		err = notifier(func(client lxd.InstanceServer) error {
-			return client.UpdateStoragePool(poolName, req, r.Header.Get("If-Match"))
-		})
-		if err != nil {
-			return response.SmartError(err)
-		}
-	}
-
-	withDB := !isClusterNotification(r)
-	err = storagePoolUpdate(d.State(), poolName, req.Description, config, withDB)
-	if err != nil {
-		return response.InternalError(err)
-	}
-
-	return response.EmptySyncResponse
+	return doStoragePoolUpdate(d, poolName, dbInfo, req, clustered, r.Header.Get("If-Match"), isClusterNotification(r))
 }
 
 // /1.0/storage-pools/{name}
@@ -403,7 +388,11 @@ func storagePoolPut(d *Daemon, r *http.Request) response.Response {
 func storagePoolPatch(d *Daemon, r *http.Request) response.Response {
 	poolName := mux.Vars(r)["name"]
 
-	// Get the existing network
+	// Serialize with other updates of the same pool until done.
+	unlock := etagLock("storage-pool", "", poolName)
+	defer unlock()
+
+	// Get the existing storage pool.
 	_, dbInfo, err := d.cluster.StoragePoolGet(poolName)
 	if err != nil {
 		return response.SmartError(err)
@@ -419,17 +408,15 @@ func storagePoolPatch(d *Daemon, r *http.Request) response.Response {
 		return response.SmartError(err)
 	}
 
-	config := dbInfo.Config
 	if clustered {
 		err := storagePoolValidateClusterConfig(req.Config)
 		if err != nil {
 			return response.BadRequest(err)
 		}
-		config = storagePoolClusterConfigForEtag(config)
 	}
 
 	// Validate the ETag
-	etag := []interface{}{dbInfo.Name, dbInfo.Driver, config}
+	etag := storagePoolEtag(dbInfo, clustered)
 
 	err = util.EtagCheck(r, etag)
 	if err != nil {
@@ -448,13 +435,19 @@ func storagePoolPatch(d *Daemon, r *http.Request) response.Response {
 		}
 	}
 
+	return doStoragePoolUpdate(d, poolName, dbInfo, req, clustered, r.Header.Get("If-Match"), isClusterNotification(r))
+}
+
+// Update a storage pool with the given configuration, notifying the other nodes unless this is
+// itself a notification.
+func doStoragePoolUpdate(d *Daemon, poolName string, dbInfo *api.StoragePool, req api.StoragePoolPut, clustered bool, etag string, notification bool) response.Response {
 	// Validate the configuration
-	err = storagePoolValidateConfig(poolName, dbInfo.Driver, req.Config, dbInfo.Config)
+	err := storagePoolValidateConfig(poolName, dbInfo.Driver, req.Config, dbInfo.Config)
 	if err != nil {
 		return response.BadRequest(err)
 	}
 
-	config = req.Config
+	config := req.Config
 	if clustered {
 		// For clustered requests, we need to complement the request's config
 		// with our node-specific values.
@@ -462,22 +455,14 @@ func storagePoolPatch(d *Daemon, r *http.Request) response.Response {
 	}
 
 	// Notify the other nodes, unless this is itself a notification.
-	if clustered && !isClusterNotification(r) {
-		cert := d.endpoints.NetworkCert()
-		notifier, err := cluster.NewNotifier(d.State(), cert, cluster.NotifyAll)
-		if err != nil {
-			return response.SmartError(err)
-		}
-		err = notifier(func(client lxd.InstanceServer) error {
-			return client.UpdateStoragePool(poolName, req, r.Header.Get("If-Match"))
-		})
+	if clustered && !notification {
+		err = storagePoolUpdateNotify(d, poolName, dbInfo, req, etag)
 		if err != nil {
 			return response.SmartError(err)
 		}
 	}
 
-	withDB := !isClusterNotification(r)
-	err = storagePoolUpdate(d.State(), poolName, req.Description, config, withDB)
+	err = storagePoolUpdate(d.State(), poolName, req.Description, config, !notification)
 	if err != nil {
 		return response.InternalError(err)
 	}
@@ -485,6 +470,39 @@ func storagePoolPatch(d *Daemon, r *http.Request) response.Response {
 	return response.EmptySyncResponse
 }
 
+// Propagate an update of a storage pool to the other nodes. Each node which is
+// up either gets the update or is reverted to the current configuration of the
+// pool.
+func storagePoolUpdateNotify(d *Daemon, poolName string, dbInfo *api.StoragePool, req api.StoragePoolPut, etag string) error {
+	update := api.StoragePoolPut{
+		Description: req.Description,
+		Config:      storagePoolClusterConfigForEtag(req.Config),
+	}
+
+	current := api.StoragePoolPut{
+		Description: dbInfo.Description,
+		Config:      storagePoolClusterConfigForEtag(dbInfo.Config),
+	}
+
+	changes := []cluster.NotifyChange{{
+		Description: fmt.Sprintf("update storage pool %s", poolName),
+		Apply: func(client lxd.InstanceServer) error {
+			return client.UpdateStoragePool(poolName, update, etag)
+		},
+		Revert: func(client lxd.InstanceServer) error {
+			return client.UpdateStoragePool(poolName, current, "")
+		},
+	}}
+
+	statuses, err := cluster.NotifyBatch(d.State(), d.endpoints.NetworkCert(), cluster.NotifyAlive, changes)
+	if err != nil {
+		return err
+	}
+
+	// Nodes which are down apply the update once they're back.
+	return clusterChangeQueue(d, statuses, clusterChangeStoragePool, "", poolName, current)
+}
+
 // This helper makes sure that, when clustered, we're not changing
 // node-specific values.
 //
@@ -525,6 +543,12 @@ func storagePoolClusterFillWithNodeConfig(dbConfig, reqConfig map[string]string)
 func storagePoolDelete(d *Daemon, r *http.Request) response.Response {
 	poolName := mux.Vars(r)["name"]
 
+	return doStoragePoolDelete(d, poolName, isClusterNotification(r))
+}
+
+// Delete a storage pool, notifying the other nodes unless this is itself a notification, in which
+// case only the local side of the pool is deleted.
+func doStoragePoolDelete(d *Daemon, poolName string, notification bool) response.Response {
 	poolID, err := d.cluster.StoragePoolGetID(poolName)
 	if err != nil {
 		return response.NotFound(err)
@@ -532,7 +556,7 @@ func storagePoolDelete(d *Daemon, r *http.Request) response.Response {
 
 	// If this is not an internal cluster request, check if the storage
 	// pool has any volumes associated with it, if so error out.
-	if !isClusterNotification(r) {
+	if !notification {
 		response := storagePoolDeleteCheckPreconditions(d.cluster, poolName, poolID)
 		if response != nil {
 			return response
@@ -566,7 +590,7 @@ func storagePoolDelete(d *Daemon, r *http.Request) response.Response {
 		}
 
 		// Only delete images if locally stored or running on initial member.
-		if !isClusterNotification(r) || !pool.Driver().Info().Remote {
+		if !notification || !pool.Driver().Info().Remote {
 			for _, volume := range volumeNames {
 				_, imgInfo, err := d.cluster.ImageGet("default", volume, false, false)
 				if err != nil {
@@ -580,7 +604,7 @@ func storagePoolDelete(d *Daemon, r *http.Request) response.Response {
 			}
 		}
 
-		err = pool.Delete(isClusterNotification(r), nil)
+		err = pool.Delete(notification, nil)
 		if err != nil {
 			return response.InternalError(err)
 		}
@@ -593,7 +617,7 @@ func storagePoolDelete(d *Daemon, r *http.Request) response.Response {
 		// If this is a notification for a ceph pool deletion, we don't want to
 		// actually delete the pool, since that will be done by the node that
 		// notified us. We just need to delete the local mountpoint.
-		if s, ok := s.(*storageCeph); ok && isClusterNotification(r) {
+		if s, ok := s.(*storageCeph); ok && notification {
 			// Delete the mountpoint for the storage pool.
 			poolMntPoint := storagePools.GetStoragePoolMountPoint(s.pool.Name)
 			if shared.PathExists(poolMntPoint) {
@@ -626,7 +650,7 @@ func storagePoolDelete(d *Daemon, r *http.Request) response.Response {
 
 	// If this is a cluster notification, we're done, any database work
 	// will be done by the node that is originally serving the request.
-	if isClusterNotification(r) {
+	if notification {
 		return response.EmptySyncResponse
 	}
 
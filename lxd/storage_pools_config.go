@@ -22,6 +22,7 @@ var changeableStoragePoolProperties = map[string][]string{
 		"btrfs.mount_options"},
 
 	"ceph": {
+		"ceph.rbd.flatten_clones",
 		"volume.block.filesystem",
 		"volume.block.mount_options",
 		"volume.size"},
@@ -33,6 +34,9 @@ var changeableStoragePoolProperties = map[string][]string{
 		"rsync.bwlimit"},
 
 	"lvm": {
+		"lvm.thinpool_autogrow",
+		"lvm.thinpool_autogrow.step",
+		"lvm.thinpool_autogrow.threshold",
 		"lvm.thinpool_name",
 		"lvm.vg_name",
 		"volume.block.filesystem",
@@ -41,9 +45,11 @@ var changeableStoragePoolProperties = map[string][]string{
 
 	"zfs": {
 		"rsync_bwlimit",
+		"volume.zfs.delegate",
 		"volume.zfs.remove_snapshots",
 		"volume.zfs.use_refquota",
-		"zfs.clone_copy"},
+		"zfs.clone_copy",
+		"zfs.promote_clones"},
 }
 
 var storagePoolConfigKeys = map[string]func(value string) error{
@@ -67,8 +73,13 @@ var storagePoolConfigKeys = map[string]func(value string) error{
 		_, err := units.ParseByteSizeString(value)
 		return err
 	},
-	"ceph.rbd.clone_copy": shared.IsBool,
-	"ceph.user.name":      shared.IsAny,
+	"ceph.rbd.clone_copy":     shared.IsBool,
+	"ceph.rbd.flatten_clones": shared.IsBool,
+	"ceph.rbd.namespaces":     shared.IsBool,
+	"ceph.user.name":          shared.IsAny,
+
+	// valid drivers: all
+	"concurrency.volumes": storagePoolWorkersValidate,
 
 	// valid drivers: cephfs
 	"cephfs.cluster_name": shared.IsAny,
@@ -76,9 +87,23 @@ var storagePoolConfigKeys = map[string]func(value string) error{
 	"cephfs.user.name":    shared.IsAny,
 
 	// valid drivers: lvm
-	"lvm.thinpool_name": shared.IsAny,
-	"lvm.use_thinpool":  shared.IsBool,
-	"lvm.vg_name":       shared.IsAny,
+	"lvm.thinpool_autogrow": shared.IsBool,
+	"lvm.thinpool_autogrow.step": func(value string) error {
+		if value == "" {
+			return nil
+		}
+
+		step, err := strconv.Atoi(value)
+		if err != nil || step < 1 {
+			return fmt.Errorf("Invalid value for an integer: %s", value)
+		}
+
+		return nil
+	},
+	"lvm.thinpool_autogrow.threshold": storagePoolWatermarkValidate,
+	"lvm.thinpool_name":               shared.IsAny,
+	"lvm.use_thinpool":                shared.IsBool,
+	"lvm.vg_name":                     shared.IsAny,
 
 	// valid drivers: btrfs, lvm, zfs
 	"size": func(value string) error {
@@ -118,13 +143,20 @@ var storagePoolConfigKeys = map[string]func(value string) error{
 	},
 
 	// valid drivers: zfs
+	"volume.zfs.delegate":         shared.IsBool,
 	"volume.zfs.remove_snapshots": shared.IsBool,
 	"volume.zfs.use_refquota":     shared.IsBool,
 
+	// valid drivers: all
+	"watermark.act":     storagePoolWatermarkValidate,
+	"watermark.actions": storagePoolWatermarkActionsValidate,
+	"watermark.warn":    storagePoolWatermarkValidate,
+
 	// valid drivers: zfs
-	"zfs.clone_copy": shared.IsBool,
-	"zfs.pool_name":  shared.IsAny,
-	"rsync.bwlimit":  shared.IsAny,
+	"zfs.clone_copy":     shared.IsBool,
+	"zfs.pool_name":      shared.IsAny,
+	"zfs.promote_clones": shared.IsBool,
+	"rsync.bwlimit":      shared.IsAny,
 }
 
 func storagePoolValidateConfig(name string, driver string, config map[string]string, oldConfig map[string]string) error {
@@ -150,6 +182,11 @@ func storagePoolValidateConfig(name string, driver string, config map[string]str
 		}
 	}
 
+	warn, act := storagePoolWatermarks(config)
+	if warn > act {
+		return fmt.Errorf("The key \"watermark.warn\" cannot be higher than \"watermark.act\"")
+	}
+
 	// Check whether the config properties for the driver container sane
 	// values.
 	for key, val := range config {
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/version"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// Drivers of the storage pools backed by a network filesystem mounted on each node, whose mount
+// can go stale when the connection to the remote server is lost.
+var storagePoolRemoteDrivers = []string{"cephfs"}
+
+// Delays between the attempts to remount a stale storage pool, doubled after each failure.
+const (
+	storagePoolRemountDelayMin = time.Minute
+	storagePoolRemountDelayMax = 30 * time.Minute
+)
+
+// A local storage pool whose mount went stale.
+type storagePoolStaleMount struct {
+	since    time.Time
+	attempts int
+	retryAt  time.Time
+}
+
+// Local storage pools currently stale, indexed by name.
+var storagePoolStaleMounts = map[string]*storagePoolStaleMount{}
+var storagePoolStaleMountsMu sync.Mutex
+
+// Returns whether the mount of the given storage pool is currently stale on this node.
+func storagePoolIsStale(poolName string) bool {
+	storagePoolStaleMountsMu.Lock()
+	defer storagePoolStaleMountsMu.Unlock()
+
+	_, ok := storagePoolStaleMounts[poolName]
+	return ok
+}
+
+// Checks whether the filesystem mounted at the given path is still reachable, returning the error
+// hit otherwise.
+func storagePoolProbeMount(path string) error {
+	var st unix.Statfs_t
+	return unix.Statfs(path, &st)
+}
+
+// Returns whether an error hit accessing a mounted filesystem means that the mount is stale.
+func storagePoolStaleMountError(err error) bool {
+	return err == unix.ESTALE || err == unix.ENOTCONN
+}
+
+// Replaces the stale mount of a storage pool by a fresh one.
+func storagePoolRemount(s *state.State, poolName string) error {
+	pool, err := storagePools.GetPoolByName(s, poolName)
+	if err != nil {
+		return err
+	}
+
+	// A stale mount can't be unmounted cleanly, detach it so a new one can take its place.
+	err = unix.Unmount(storageDrivers.GetPoolMountPath(poolName), unix.MNT_DETACH)
+	if err != nil && err != unix.EINVAL {
+		return err
+	}
+
+	_, err = pool.Mount()
+	return err
+}
+
+// Probes the mount of a storage pool and remounts it if it went stale, backing off after each
+// failed attempt. Lifecycle events are sent when the mount goes stale and once it's recovered.
+func storagePoolStaleMountCheck(s *state.State, poolName string) {
+	path := storageDrivers.GetPoolMountPath(poolName)
+	source := fmt.Sprintf("/%s/storage-pools/%s", version.APIVersion, poolName)
+
+	storagePoolStaleMountsMu.Lock()
+	stale := storagePoolStaleMounts[poolName]
+	storagePoolStaleMountsMu.Unlock()
+
+	recovered := func() {
+		storagePoolStaleMountsMu.Lock()
+		delete(storagePoolStaleMounts, poolName)
+		storagePoolStaleMountsMu.Unlock()
+
+		logger.Info("Storage pool mount recovered", log.Ctx{"pool": poolName, "stale_since": stale.since})
+		s.Events.SendLifecycle("", "storage-pool-mount-recovered", source, nil)
+	}
+
+	err := storagePoolProbeMount(path)
+	if err == nil {
+		if stale != nil {
+			recovered()
+		}
+
+		return
+	}
+
+	if !storagePoolStaleMountError(err) {
+		logger.Debug("Failed to probe storage pool mount", log.Ctx{"pool": poolName, "err": err})
+		return
+	}
+
+	now := time.Now()
+	if stale == nil {
+		stale = &storagePoolStaleMount{since: now, retryAt: now}
+
+		storagePoolStaleMountsMu.Lock()
+		storagePoolStaleMounts[poolName] = stale
+		storagePoolStaleMountsMu.Unlock()
+
+		logger.Error("Storage pool mount is stale", log.Ctx{"pool": poolName, "err": err})
+		s.Events.SendLifecycle("", "storage-pool-mount-stale", source, map[string]interface{}{"error": err.Error()})
+	}
+
+	if now.Before(stale.retryAt) {
+		return
+	}
+
+	err = storagePoolRemount(s, poolName)
+	if err == nil {
+		err = storagePoolProbeMount(path)
+	}
+
+	if err != nil {
+		delay := storagePoolRemountDelayMin << uint(stale.attempts)
+		if delay > storagePoolRemountDelayMax || delay <= 0 {
+			delay = storagePoolRemountDelayMax
+		}
+
+		stale.attempts++
+		stale.retryAt = now.Add(delay)
+		logger.Warn("Failed to remount stale storage pool", log.Ctx{"pool": poolName, "attempts": stale.attempts, "retry": delay, "err": err})
+		return
+	}
+
+	recovered()
+}
+
+func storagePoolStaleMountsTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		s := d.State()
+
+		pools, err := s.Cluster.StoragePoolsNotPending()
+		if err != nil {
+			logger.Error("Failed to load storage pools for mount check", log.Ctx{"err": err})
+			return
+		}
+
+		for _, poolName := range pools {
+			_, pool, err := s.Cluster.StoragePoolGet(poolName)
+			if err != nil {
+				logger.Error("Failed to load storage pool for mount check", log.Ctx{"pool": poolName, "err": err})
+				continue
+			}
+
+			if !shared.StringInSlice(pool.Driver, storagePoolRemoteDrivers) {
+				continue
+			}
+
+			storagePoolStaleMountCheck(s, poolName)
+		}
+
+		// Forget about the pools deleted while stale.
+		storagePoolStaleMountsMu.Lock()
+		for poolName := range storagePoolStaleMounts {
+			if !shared.StringInSlice(poolName, pools) {
+				delete(storagePoolStaleMounts, poolName)
+			}
+		}
+		storagePoolStaleMountsMu.Unlock()
+	}
+
+	return f, task.Every(time.Minute)
+}
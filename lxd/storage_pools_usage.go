@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/project"
+	"github.com/lxc/lxd/lxd/response"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// storagePoolUsageBiggestVolumes is the number of volumes listed as the biggest ones of a pool.
+const storagePoolUsageBiggestVolumes = 10
+
+var storagePoolUsageCmd = APIEndpoint{
+	Path: "storage-pools/{name}/usage",
+
+	Get: APIEndpointAction{Handler: storagePoolUsageGet, AccessHandler: AllowAuthenticated},
+}
+
+// /1.0/storage-pools/{name}/usage
+// Get the usage of a storage pool on this node, aggregated over its volumes.
+func storagePoolUsageGet(d *Daemon, r *http.Request) response.Response {
+	// If a target was specified, forward the request to the relevant node.
+	resp := ForwardedResponseIfTargetIsRemote(d, r)
+	if resp != nil {
+		return resp
+	}
+
+	poolName := mux.Vars(r)["name"]
+
+	poolID, err := d.cluster.StoragePoolGetID(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	var volumes []db.StorageVolumeSummary
+	var imagesSize int64
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		volumes, err = tx.StoragePoolNodeVolumesSummary(poolID)
+		if err != nil {
+			return err
+		}
+
+		imagesSize, err = tx.StoragePoolNodeImagesSize(poolID)
+		return err
+	})
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	usage := api.StoragePoolUsage{
+		Volumes:        map[string]int{},
+		Snapshots:      map[string]int{},
+		BiggestVolumes: []api.StoragePoolUsageVolume{},
+		ImagesSize:     uint64(imagesSize),
+	}
+
+	// Volume usage is only reported by the drivers of the new storage layer.
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err != nil && err != storageDrivers.ErrUnknownDriver {
+		return response.SmartError(err)
+	}
+
+	// The space of a stale pool can't be read until it's remounted.
+	usage.Stale = storagePoolIsStale(poolName)
+
+	if usage.Stale {
+		logger.Warn("Storage pool mount is stale, not reporting its space", log.Ctx{"pool": poolName})
+	} else if pool != nil {
+		res, err := pool.GetResources()
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		usage.Space = res.Space
+	} else {
+		s, err := storagePoolInit(d.State(), poolName)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		res, err := s.StoragePoolResources()
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		usage.Space = res.Space
+	}
+
+	// Count the snapshots of each volume.
+	type volumeKey struct {
+		project string
+		volType int
+		name    string
+	}
+
+	snapshots := map[volumeKey]int{}
+	for _, vol := range volumes {
+		if !vol.Snapshot {
+			continue
+		}
+
+		parentName, _, _ := shared.ContainerGetParentAndSnapshotName(vol.Name)
+		snapshots[volumeKey{vol.Project, vol.Type, parentName}]++
+	}
+
+	biggest := []api.StoragePoolUsageVolume{}
+	for _, vol := range volumes {
+		typeName, err := db.StoragePoolVolumeTypeToName(vol.Type)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		if vol.Snapshot {
+			usage.Snapshots[typeName]++
+			continue
+		}
+
+		usage.Volumes[typeName]++
+
+		if pool == nil {
+			continue
+		}
+
+		volType, err := storagePools.VolumeDBTypeToType(vol.Type)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		// Instance volumes are stored under a name prefixed with their project.
+		volStorageName := vol.Name
+		if vol.Type == db.StoragePoolVolumeTypeContainer || vol.Type == db.StoragePoolVolumeTypeVM {
+			volStorageName = project.Prefix(vol.Project, vol.Name)
+		}
+
+		contentType := storageDrivers.ContentTypeFS
+		if vol.Type == db.StoragePoolVolumeTypeVM {
+			contentType = storageDrivers.ContentTypeBlock
+		}
+
+		used, err := pool.Driver().GetVolumeUsage(storageDrivers.NewVolume(pool.Driver(), poolName, volType, contentType, volStorageName, nil))
+		if err != nil {
+			logger.Debug("Skipping volume whose usage can't be retrieved", log.Ctx{"pool": poolName, "project": vol.Project, "volume": vol.Name, "type": typeName, "err": err})
+			continue
+		}
+
+		biggest = append(biggest, api.StoragePoolUsageVolume{
+			Name:      vol.Name,
+			Type:      typeName,
+			Project:   vol.Project,
+			Used:      uint64(used),
+			Snapshots: snapshots[volumeKey{vol.Project, vol.Type, vol.Name}],
+		})
+	}
+
+	sort.Slice(biggest, func(i, j int) bool {
+		if biggest[i].Used != biggest[j].Used {
+			return biggest[i].Used > biggest[j].Used
+		}
+
+		return biggest[i].Name < biggest[j].Name
+	})
+
+	if len(biggest) > storagePoolUsageBiggestVolumes {
+		biggest = biggest[:storagePoolUsageBiggestVolumes]
+	}
+
+	usage.BiggestVolumes = biggest
+
+	return response.SyncResponse(true, &usage)
+}
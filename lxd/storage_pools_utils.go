@@ -9,8 +9,10 @@ import (
 	"github.com/lxc/lxd/lxd/state"
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/units"
 	"github.com/lxc/lxd/shared/version"
 )
 
@@ -20,13 +22,45 @@ func storagePoolUpdate(state *state.State, name, newDescription string, newConfi
 		return err
 	}
 
+	return doStoragePoolUpdate(state, s, name, newDescription, newConfig, withDB)
+}
+
+// Like storagePoolUpdate but does not update the database, since it was already
+// updated by the node where the change was made. The pool is updated from the
+// given previous global configuration to the current one.
+func storagePoolUpdateCluster(state *state.State, name string, old api.StoragePoolPut) error {
+	s, err := storagePoolInit(state, name)
+	if err != nil {
+		return err
+	}
+
+	current := s.GetStoragePoolWritable()
+
+	// Complement the previous configuration with our node-specific values,
+	// which don't change.
+	previous := current
+	previous.Description = old.Description
+	previous.Config = util.CopyConfig(old.Config)
+	for _, key := range db.StoragePoolNodeConfigKeys {
+		value, ok := current.Config[key]
+		if ok {
+			previous.Config[key] = value
+		}
+	}
+
+	s.SetStoragePoolWritable(&previous)
+
+	return doStoragePoolUpdate(state, s, name, current.Description, current.Config, false)
+}
+
+func doStoragePoolUpdate(state *state.State, s storage, name, newDescription string, newConfig map[string]string, withDB bool) error {
 	oldWritable := s.GetStoragePoolWritable()
 	newWritable := oldWritable
 
 	// Backup the current state
 	oldDescription := oldWritable.Description
 	oldConfig := map[string]string{}
-	err = shared.DeepCopy(&oldWritable.Config, &oldConfig)
+	err := shared.DeepCopy(&oldWritable.Config, &oldConfig)
 	if err != nil {
 		return err
 	}
@@ -48,13 +82,22 @@ func storagePoolUpdate(state *state.State, name, newDescription string, newConfi
 		newWritable.Description = newDescription
 		newWritable.Config = newConfig
 
+		// The watermark and concurrency keys are handled by LXD itself
+		// and are of no concern to the storage driver.
+		driverConfig := []string{}
+		for _, key := range changedConfig {
+			if !strings.HasPrefix(key, "watermark.") && !strings.HasPrefix(key, "concurrency.") {
+				driverConfig = append(driverConfig, key)
+			}
+		}
+
 		// Update the storage pool
-		if !userOnly {
-			if shared.StringInSlice("driver", changedConfig) {
+		if !userOnly && len(driverConfig) != 0 {
+			if shared.StringInSlice("driver", driverConfig) {
 				return fmt.Errorf("the \"driver\" property of a storage pool cannot be changed")
 			}
 
-			err = s.StoragePoolUpdate(&newWritable, changedConfig)
+			err = s.StoragePoolUpdate(&newWritable, driverConfig)
 			if err != nil {
 				return err
 			}
@@ -349,3 +392,67 @@ func dbStoragePoolDeleteAndUpdateCache(db *db.Cluster, poolName string) error {
 
 	return err
 }
+
+// storagePoolCheckCapacity checks that the storage pool has enough free space left to create a new
+// volume of the supplied size. If no size is supplied, the pool's volume.size is used instead and
+// if neither is set the check is skipped.
+func storagePoolCheckCapacity(state *state.State, poolName string, size string) error {
+	_, pool, err := state.Cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return err
+	}
+
+	if size == "" || size == "0" {
+		size = pool.Config["volume.size"]
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	if sizeBytes <= 0 {
+		return nil
+	}
+
+	res, err := storagePoolUsage(state, poolName)
+	if err != nil {
+		return err
+	}
+
+	// Some drivers can't report their capacity.
+	if res.Space.Total == 0 {
+		return nil
+	}
+
+	free := int64(res.Space.Total - res.Space.Used)
+	if sizeBytes > free {
+		return fmt.Errorf("Not enough free space in storage pool %q (%s requested, %s available)", poolName, units.GetByteSizeString(sizeBytes, 2), units.GetByteSizeString(free, 2))
+	}
+
+	return nil
+}
+
+// storagePoolUsage returns the space and inode usage of a local storage pool.
+func storagePoolUsage(state *state.State, poolName string) (*api.ResourcesStoragePool, error) {
+	pool, err := storagePools.GetPoolByName(state, poolName)
+	if err != storageDrivers.ErrUnknownDriver {
+		if err != nil {
+			return nil, err
+		}
+
+		return pool.GetResources()
+	}
+
+	s, err := storagePoolInit(state, poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.StoragePoolCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.StoragePoolResources()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxd/lxd/state"
+	"github.com/lxc/lxd/lxd/task"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/version"
+
+	log "github.com/lxc/lxd/shared/log15"
+)
+
+// Usage levels of a storage pool, as compared to its watermarks.
+const (
+	storagePoolWatermarkNone = iota
+	storagePoolWatermarkWarn
+	storagePoolWatermarkAct
+)
+
+// Actions that can be taken when a storage pool reaches its "watermark.act" usage.
+var storagePoolWatermarkActions = []string{"snapshots", "volumes"}
+
+// Last usage level seen for each local storage pool, so that events are only sent when it changes.
+var storagePoolWatermarkLevels = map[string]int{}
+var storagePoolWatermarkLevelsMu sync.Mutex
+
+// Validates a "watermark.warn" or "watermark.act" value (a percentage of the pool size).
+func storagePoolWatermarkValidate(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	percent, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("Invalid watermark %q: must be a percentage", value)
+	}
+
+	if percent < 1 || percent > 100 {
+		return fmt.Errorf("Invalid watermark %q: must be between 1 and 100", value)
+	}
+
+	return nil
+}
+
+// Validates a "watermark.actions" value.
+func storagePoolWatermarkActionsValidate(value string) error {
+	for _, action := range strings.Split(value, ",") {
+		action = strings.TrimSpace(action)
+		if action == "" {
+			continue
+		}
+
+		if !shared.StringInSlice(action, storagePoolWatermarkActions) {
+			return fmt.Errorf("Invalid watermark action %q", action)
+		}
+	}
+
+	return nil
+}
+
+// Returns the "watermark.warn" and "watermark.act" percentages of a storage pool config.
+func storagePoolWatermarks(config map[string]string) (int, int) {
+	warn, err := strconv.Atoi(config["watermark.warn"])
+	if err != nil {
+		warn = 80
+	}
+
+	act, err := strconv.Atoi(config["watermark.act"])
+	if err != nil {
+		act = 95
+	}
+
+	return warn, act
+}
+
+// Returns whether the given action is enabled in the "watermark.actions" of a storage pool config.
+func storagePoolWatermarkActionEnabled(config map[string]string, action string) bool {
+	for _, entry := range strings.Split(config["watermark.actions"], ",") {
+		if strings.TrimSpace(entry) == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Computes the current usage level of a storage pool, along with its usage in percent. Pools whose
+// driver can't report their capacity are always below their watermarks.
+func storagePoolWatermarkLevel(s *state.State, poolName string, config map[string]string) (int, float64, error) {
+	res, err := storagePoolUsage(s, poolName)
+	if err != nil {
+		return storagePoolWatermarkNone, 0, err
+	}
+
+	if res.Space.Total == 0 {
+		return storagePoolWatermarkNone, 0, nil
+	}
+
+	percent := float64(res.Space.Used) * 100 / float64(res.Space.Total)
+	warn, act := storagePoolWatermarks(config)
+
+	if percent >= float64(act) {
+		return storagePoolWatermarkAct, percent, nil
+	}
+
+	if percent >= float64(warn) {
+		return storagePoolWatermarkWarn, percent, nil
+	}
+
+	return storagePoolWatermarkNone, percent, nil
+}
+
+// storagePoolWatermarkCheck returns an error if the given action is enabled on the storage pool
+// and the pool's usage is at or above its "watermark.act" level.
+func storagePoolWatermarkCheck(s *state.State, poolName string, action string) error {
+	_, pool, err := s.Cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return err
+	}
+
+	if !storagePoolWatermarkActionEnabled(pool.Config, action) {
+		return nil
+	}
+
+	level, percent, err := storagePoolWatermarkLevel(s, poolName, pool.Config)
+	if err != nil {
+		return err
+	}
+
+	if level == storagePoolWatermarkAct {
+		return fmt.Errorf("Storage pool %q is %.1f%% full, above its watermark", poolName, percent)
+	}
+
+	return nil
+}
+
+func storagePoolWatermarksTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		s := d.State()
+
+		pools, err := s.Cluster.StoragePoolsNotPending()
+		if err != nil {
+			logger.Error("Failed to load storage pools for usage check", log.Ctx{"err": err})
+			return
+		}
+
+		for _, poolName := range pools {
+			_, pool, err := s.Cluster.StoragePoolGet(poolName)
+			if err != nil {
+				logger.Error("Failed to load storage pool for usage check", log.Ctx{"pool": poolName, "err": err})
+				continue
+			}
+
+			level, percent, err := storagePoolWatermarkLevel(s, poolName, pool.Config)
+			if err != nil {
+				logger.Debug("Failed to get storage pool usage", log.Ctx{"pool": poolName, "err": err})
+				continue
+			}
+
+			storagePoolWatermarkLevelsMu.Lock()
+			previous := storagePoolWatermarkLevels[poolName]
+			storagePoolWatermarkLevels[poolName] = level
+			storagePoolWatermarkLevelsMu.Unlock()
+
+			if level == previous {
+				continue
+			}
+
+			logCtx := log.Ctx{"pool": poolName, "usage": fmt.Sprintf("%.1f%%", percent)}
+			action := ""
+			switch level {
+			case storagePoolWatermarkAct:
+				logger.Error("Storage pool usage is above its action watermark", logCtx)
+				action = "storage-pool-usage-critical"
+			case storagePoolWatermarkWarn:
+				logger.Warn("Storage pool usage is above its warning watermark", logCtx)
+				action = "storage-pool-usage-warning"
+			default:
+				logger.Info("Storage pool usage is back below its watermarks", logCtx)
+				action = "storage-pool-usage-normal"
+			}
+
+			source := fmt.Sprintf("/%s/storage-pools/%s", version.APIVersion, poolName)
+			s.Events.SendLifecycle("", action, source, map[string]interface{}{"usage": percent})
+		}
+	}
+
+	return f, task.Every(time.Minute)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/lxc/lxd/lxd/state"
+)
+
+// A unit of work of a multi-volume operation, along with the storage pool of the volume it
+// works on.
+type storageVolumeTask struct {
+	pool string
+	run  func() error
+}
+
+// Validates a "concurrency.volumes" value.
+func storagePoolWorkersValidate(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	workers, err := strconv.Atoi(value)
+	if err != nil || workers < 1 {
+		return fmt.Errorf("Invalid number of workers %q: must be a positive integer", value)
+	}
+
+	return nil
+}
+
+// storagePoolWorkers returns the number of volumes of the storage pool which multi-volume
+// operations work on at the same time, as set through its "concurrency.volumes" key.
+func storagePoolWorkers(s *state.State, poolName string) int {
+	_, pool, err := s.Cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return 1
+	}
+
+	workers, err := strconv.Atoi(pool.Config["concurrency.volumes"])
+	if err != nil || workers < 1 {
+		return 1
+	}
+
+	return workers
+}
+
+// storageVolumeTasksRun runs the given tasks, working on at most the configured number of volumes
+// of each storage pool at once. No new task is started once the context is cancelled. It returns
+// the errors of the failed tasks, once all started tasks are done.
+func storageVolumeTasksRun(ctx context.Context, s *state.State, tasks []storageVolumeTask) []error {
+	// One semaphore per storage pool, sized to its number of workers.
+	slots := map[string]chan struct{}{}
+	for _, task := range tasks {
+		_, ok := slots[task.pool]
+		if !ok {
+			slots[task.pool] = make(chan struct{}, storagePoolWorkers(s, task.pool))
+		}
+	}
+
+	errs := []error{}
+	errsMu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	// Each task waits for a free slot of its pool before running.
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task storageVolumeTask) {
+			defer wg.Done()
+
+			select {
+			case slots[task.pool] <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots[task.pool] }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			err := task.run()
+			if err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
+			}
+		}(task)
+	}
+
+	wg.Wait()
+	return errs
+}
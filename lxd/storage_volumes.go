@@ -6,14 +6,20 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/lxc/lxd/lxd/backup"
+	"github.com/lxc/lxd/lxd/cluster"
 	"github.com/lxc/lxd/lxd/db"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/rsync"
 	"github.com/lxc/lxd/lxd/state"
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
@@ -155,6 +161,11 @@ func storagePoolVolumesGet(d *Daemon, r *http.Request) response.Response {
 				return response.InternalError(err)
 			}
 			volume.UsedBy = volumeUsedBy
+
+			volume.ETag, err = util.EtagHash(storagePoolVolumeEtag(volume))
+			if err != nil {
+				return response.InternalError(err)
+			}
 		}
 	}
 
@@ -233,6 +244,11 @@ func storagePoolVolumesTypeGet(d *Daemon, r *http.Request) response.Response {
 			}
 			vol.UsedBy = volumeUsedBy
 
+			vol.ETag, err = util.EtagHash(storagePoolVolumeEtag(vol))
+			if err != nil {
+				return response.SmartError(err)
+			}
+
 			resultMap = append(resultMap, vol)
 		}
 	}
@@ -252,10 +268,21 @@ func storagePoolVolumesTypePost(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
+	// New volumes can't be created on a member in maintenance.
+	err := cluster.CheckPlacementTarget(d.cluster, "")
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	// Create the volume from an uploaded tarball.
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		return doVolumeCreateFromTarball(d, r)
+	}
+
 	req := api.StorageVolumesPost{}
 
 	// Parse the request.
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		return response.BadRequest(err)
 	}
@@ -279,6 +306,12 @@ func storagePoolVolumesTypePost(d *Daemon, r *http.Request) response.Response {
 			`storage volumes of type %s`, req.Type))
 	}
 
+	contentType, err := storagePoolVolumeContentType(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	project := projectParam(r)
 	poolName := mux.Vars(r)["name"]
 	poolID, err := d.cluster.StoragePoolGetID(poolName)
 	if err != nil {
@@ -292,24 +325,37 @@ func storagePoolVolumesTypePost(d *Daemon, r *http.Request) response.Response {
 			return response.SmartError(err)
 		}
 
+		if req.Source.Refresh {
+			return doVolumeRefresh(d, poolName, &req)
+		}
+
 		return response.Conflict(fmt.Errorf("Volume by that name already exists"))
 	}
 
+	if shared.IsTrue(queryParam(r, "dry-run")) {
+		return doVolumeCreateDryRun(d, poolName, &req)
+	}
+
 	switch req.Source.Type {
 	case "":
-		return doVolumeCreateOrCopy(d, poolName, &req)
+		return doVolumeCreateOrCopy(d, project, poolName, &req, contentType)
 	case "copy":
-		return doVolumeCreateOrCopy(d, poolName, &req)
+		return doVolumeCreateOrCopy(d, project, poolName, &req, contentType)
 	case "migration":
 		return doVolumeMigration(d, poolName, &req)
+	case "rsync":
+		return doVolumeCreateFromRsync(d, project, poolName, &req)
 	default:
 		return response.BadRequest(fmt.Errorf("unknown source type %s", req.Source.Type))
 	}
 }
 
-func doVolumeCreateOrCopy(d *Daemon, poolName string, req *api.StorageVolumesPost) response.Response {
+func doVolumeCreateOrCopy(d *Daemon, project string, poolName string, req *api.StorageVolumesPost, contentType storageDrivers.ContentType) response.Response {
 	var run func(op *operations.Operation) error
 
+	// The keys of the config which the pool won't apply are returned along with the new volume.
+	warnings := []api.StorageVolumeWarning{}
+
 	// Check if we can load new storage layer for both target and source pool driver types.
 	pool, err := storagePools.GetPoolByName(d.State(), poolName)
 	_, srcPoolErr := storagePools.GetPoolByName(d.State(), req.Source.Pool)
@@ -318,19 +364,38 @@ func doVolumeCreateOrCopy(d *Daemon, poolName string, req *api.StorageVolumesPos
 			return response.SmartError(err)
 		}
 
+		warnings = storagePoolVolumeWarnings(d, pool, req, contentType)
+
 		run = func(op *operations.Operation) error {
 			if req.Source.Name == "" {
-				return pool.CreateCustomVolume(req.Name, req.Description, req.Config, op)
+				return pool.CreateCustomVolume(req.Name, req.Description, req.Config, contentType, op)
 			}
 
 			return pool.CreateCustomVolumeFromCopy(req.Name, req.Description, req.Config, req.Source.Pool, req.Source.Name, req.Source.VolumeOnly, op)
 		}
 	} else {
+		if contentType != storageDrivers.ContentTypeFS {
+			return response.BadRequest(fmt.Errorf("Storage pool %q doesn't support custom block volumes", poolName))
+		}
+
 		run = func(op *operations.Operation) error {
 			return storagePoolVolumeCreateInternal(d.State(), poolName, req)
 		}
 	}
 
+	// Notify of the new volume once it's been created.
+	create := run
+	run = func(op *operations.Operation) error {
+		err := create(op)
+		if err != nil {
+			return err
+		}
+
+		storagePoolVolumeLifecycle(d.State(), project, "storage-volume-created", poolName, req.Name, req.Config)
+
+		return nil
+	}
+
 	// If no source name supplied then this a volume create operation.
 	if req.Source.Name == "" {
 		err := run(nil)
@@ -338,10 +403,39 @@ func doVolumeCreateOrCopy(d *Daemon, poolName string, req *api.StorageVolumesPos
 			return response.SmartError(err)
 		}
 
-		return response.EmptySyncResponse
+		return response.SyncResponse(true, map[string]interface{}{"warnings": warnings})
 	}
 
 	// Volume copy operations potentially take a long time, so run as an async operation.
+	metadata := map[string]interface{}{"warnings": warnings}
+	op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationVolumeCopy, nil, metadata, run, nil, nil)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
+
+// doVolumeRefresh brings an existing custom volume up to date with the local volume it was copied
+// from, transferring only what changed.
+func doVolumeRefresh(d *Daemon, poolName string, req *api.StorageVolumesPost) response.Response {
+	if req.Source.Type != "copy" {
+		return response.BadRequest(fmt.Errorf("Only copies of local volumes can be refreshed"))
+	}
+
+	if shared.IsSnapshot(req.Source.Name) {
+		return response.BadRequest(fmt.Errorf("Volumes can't be refreshed from a snapshot"))
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	run := func(op *operations.Operation) error {
+		return pool.RefreshCustomVolume(req.Name, req.Source.Pool, req.Source.Name, req.Source.VolumeOnly, op)
+	}
+
 	op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationVolumeCopy, nil, nil, run, nil, nil)
 	if err != nil {
 		return response.InternalError(err)
@@ -358,10 +452,16 @@ func storagePoolVolumesPost(d *Daemon, r *http.Request) response.Response {
 		return resp
 	}
 
+	// New volumes can't be created on a member in maintenance.
+	err := cluster.CheckPlacementTarget(d.cluster, "")
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
 	req := api.StorageVolumesPost{}
 
 	// Parse the request.
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		return response.BadRequest(err)
 	}
@@ -389,6 +489,12 @@ func storagePoolVolumesPost(d *Daemon, r *http.Request) response.Response {
 			`storage volumes of type %s`, req.Type))
 	}
 
+	contentType, err := storagePoolVolumeContentType(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	project := projectParam(r)
 	poolName := mux.Vars(r)["name"]
 	poolID, err := d.cluster.StoragePoolGetID(poolName)
 	if err != nil {
@@ -402,21 +508,261 @@ func storagePoolVolumesPost(d *Daemon, r *http.Request) response.Response {
 			return response.SmartError(err)
 		}
 
+		if req.Source.Refresh {
+			return doVolumeRefresh(d, poolName, &req)
+		}
+
 		return response.Conflict(fmt.Errorf("Volume by that name already exists"))
 	}
 
+	if shared.IsTrue(queryParam(r, "dry-run")) {
+		return doVolumeCreateDryRun(d, poolName, &req)
+	}
+
 	switch req.Source.Type {
 	case "":
-		return doVolumeCreateOrCopy(d, poolName, &req)
+		return doVolumeCreateOrCopy(d, project, poolName, &req, contentType)
 	case "copy":
-		return doVolumeCreateOrCopy(d, poolName, &req)
+		return doVolumeCreateOrCopy(d, project, poolName, &req, contentType)
 	case "migration":
 		return doVolumeMigration(d, poolName, &req)
+	case "rsync":
+		return doVolumeCreateFromRsync(d, project, poolName, &req)
 	default:
 		return response.BadRequest(fmt.Errorf("unknown source type %s", req.Source.Type))
 	}
 }
 
+// doVolumeCreateDryRun validates a custom volume creation request, including the free space on
+// the storage pool, and returns the resulting volume without creating anything.
+func doVolumeCreateDryRun(d *Daemon, poolName string, req *api.StorageVolumesPost) response.Response {
+	_, pool, err := d.cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	config := map[string]string{}
+	for k, v := range req.Config {
+		config[k] = v
+	}
+
+	// Check the source volume exists and translate its properties to the target pool's driver.
+	if req.Source.Type == "copy" {
+		srcPoolID, err := d.cluster.StoragePoolGetID(req.Source.Pool)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		_, srcVol, err := d.cluster.StoragePoolNodeVolumeGetTypeByProject("default", req.Source.Name, db.StoragePoolVolumeTypeCustom, srcPoolID)
+		if err != nil {
+			if err == db.ErrNoSuchObject {
+				return response.BadRequest(fmt.Errorf("Source volume doesn't exist"))
+			}
+
+			return response.SmartError(err)
+		}
+
+		req.ContentType = srcVol.ContentType
+
+		config, err = storagePools.VolumePropertiesTranslate(config, pool.Driver)
+		if err != nil {
+			return response.BadRequest(err)
+		}
+	}
+
+	err = storagePools.VolumeValidateConfig(req.Name, config, pool)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = storagePools.VolumeFillDefault(req.Name, config, pool)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = storagePoolCheckCapacity(d.State(), poolName, config["size"])
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	err = storagePoolWatermarkCheck(d.State(), poolName, "volumes")
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	vol := api.StorageVolume{
+		StorageVolumePut: api.StorageVolumePut{
+			Config:      config,
+			Description: req.Description,
+		},
+		Name:        req.Name,
+		Type:        req.Type,
+		UsedBy:      []string{},
+		ContentType: req.ContentType,
+	}
+
+	return response.SyncResponse(true, vol)
+}
+
+// Creates a custom volume from a tarball, which is either a backup of a custom volume as
+// written by its export or a plain tarball of the content of the volume.
+func doVolumeCreateFromTarball(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	poolName := mux.Vars(r)["name"]
+	volName := r.Header.Get("X-LXD-name")
+	desc := r.Header.Get("X-LXD-description")
+
+	if mux.Vars(r)["type"] != storagePoolVolumeTypeNameCustom {
+		return response.BadRequest(fmt.Errorf("Only custom storage volumes can be imported"))
+	}
+
+	poolID, err := d.cluster.StoragePoolGetID(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err == storageDrivers.ErrUnknownDriver {
+		return response.BadRequest(fmt.Errorf("Storage pool %q doesn't support importing volumes", poolName))
+	} else if err != nil {
+		return response.SmartError(err)
+	}
+
+	// Write the data to a temp file, staged with the backups as it can be as large as the
+	// volume.
+	f, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_volume_")
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	_, err = io.Copy(f, r.Body)
+	if err != nil {
+		cleanup()
+		return response.InternalError(err)
+	}
+
+	// Backups carry the name, description and config of the volume, the name given with the
+	// request taking precedence.
+	info, err := backup.GetInfo(f)
+	if err != nil || info.Volume == nil {
+		info = nil
+	}
+
+	if info != nil {
+		if volName == "" {
+			volName = info.Name
+		}
+
+		info.Name = volName
+		if desc != "" {
+			info.Volume.Description = desc
+		}
+	}
+
+	// Sanity checks.
+	if volName == "" {
+		cleanup()
+		return response.BadRequest(fmt.Errorf("No name provided"))
+	}
+
+	if strings.Contains(volName, "/") {
+		cleanup()
+		return response.BadRequest(fmt.Errorf("Storage volume names may not contain slashes"))
+	}
+
+	// Check if destination volume exists.
+	_, _, err = d.cluster.StoragePoolNodeVolumeGetTypeByProject("default", volName, db.StoragePoolVolumeTypeCustom, poolID)
+	if err != db.ErrNoSuchObject {
+		cleanup()
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return response.Conflict(fmt.Errorf("Volume by that name already exists"))
+	}
+
+	run := func(op *operations.Operation) error {
+		defer cleanup()
+
+		// Imported content must pass the scanner before the volume is created.
+		err := contentScan(d, "volume", volName, []string{f.Name()})
+		if err != nil {
+			return err
+		}
+
+		if info != nil {
+			err := pool.CreateCustomVolumeFromBackup(*info, f, op)
+			if err != nil {
+				return err
+			}
+
+			storagePoolVolumeLifecycle(d.State(), project, "storage-volume-created", poolName, volName, info.Volume.Config)
+
+			return nil
+		}
+
+		config := map[string]string{}
+		err = pool.CreateCustomVolumeFromTarball(volName, desc, config, f.Name(), op)
+		if err != nil {
+			return err
+		}
+
+		storagePoolVolumeLifecycle(d.State(), project, "storage-volume-created", poolName, volName, config)
+
+		return nil
+	}
+
+	resources := map[string][]string{}
+	resources["storage_volumes"] = []string{volName}
+
+	op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationVolumeCreate, resources, nil, run, nil, nil)
+	if err != nil {
+		cleanup()
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
+
+func doVolumeCreateFromRsync(d *Daemon, project string, poolName string, req *api.StorageVolumesPost) response.Response {
+	if !strings.HasPrefix(req.Source.URL, "rsync://") {
+		return response.BadRequest(fmt.Errorf("The rsync source must be an rsync:// URL"))
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err == storageDrivers.ErrUnknownDriver {
+		return response.BadRequest(fmt.Errorf("Storage pool %q doesn't support importing volumes", poolName))
+	} else if err != nil {
+		return response.SmartError(err)
+	}
+
+	run := func(op *operations.Operation) error {
+		err := pool.CreateCustomVolumeFromRsync(req.Name, req.Description, req.Config, req.Source.URL, op)
+		if err != nil {
+			return err
+		}
+
+		storagePoolVolumeLifecycle(d.State(), project, "storage-volume-created", poolName, req.Name, req.Config)
+
+		return nil
+	}
+
+	resources := map[string][]string{}
+	resources["storage_volumes"] = []string{req.Name}
+
+	op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationVolumeCreate, resources, nil, run, nil, nil)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	return operations.OperationResponse(op)
+}
+
 func doVolumeMigration(d *Daemon, poolName string, req *api.StorageVolumesPost) response.Response {
 	// Validate migration mode
 	if req.Source.Mode != "pull" && req.Source.Mode != "push" {
@@ -438,7 +784,7 @@ func doVolumeMigration(d *Daemon, poolName string, req *api.StorageVolumesPost)
 		}
 	}
 
-	config, err := shared.GetTLSConfig("", "", "", cert)
+	config, err := migrationSinkTLSConfig(d, cert)
 	if err != nil {
 		return response.InternalError(err)
 	}
@@ -572,7 +918,12 @@ func storagePoolVolumeTypePost(d *Daemon, r *http.Request, volumeTypeName string
 
 	// This is a migration request so send back requested secrets.
 	if req.Migration {
-		return storagePoolVolumeTypePostMigration(d.State(), poolName, volumeName, req)
+		clusterCert, err := migrationSourceClusterCert(d, r)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return storagePoolVolumeTypePostMigration(d.State(), poolName, volumeName, req, clusterCert)
 	}
 
 	// Check that the name isn't already in use.
@@ -615,12 +966,19 @@ func storagePoolVolumeTypePost(d *Daemon, r *http.Request, volumeTypeName string
 }
 
 // storagePoolVolumeTypePostMigration handles volume migration type POST requests.
-func storagePoolVolumeTypePostMigration(state *state.State, poolName string, volumeName string, req api.StorageVolumePost) response.Response {
-	ws, err := NewStorageMigrationSource(req.VolumeOnly)
+func storagePoolVolumeTypePostMigration(state *state.State, poolName string, volumeName string, req api.StorageVolumePost, clusterCert func() *shared.CertInfo) response.Response {
+	_, err := rsync.ParseBandwidthLimit(req.BandwidthLimit)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	ws, err := NewStorageMigrationSource(req.VolumeOnly, req.BandwidthLimit)
 	if err != nil {
 		return response.InternalError(err)
 	}
 
+	ws.clusterCert = clusterCert
+
 	resources := map[string][]string{}
 	resources["storage_volumes"] = []string{fmt.Sprintf("%s/volumes/custom/%s", poolName, volumeName)}
 
@@ -883,7 +1241,7 @@ func storagePoolVolumeTypeGet(d *Daemon, r *http.Request, volumeTypeName string)
 	}
 	volume.UsedBy = volumeUsedBy
 
-	etag := []interface{}{volumeName, volume.Type, volume.Config}
+	etag := storagePoolVolumeEtag(volume)
 
 	return response.SyncResponseETag(true, volume, etag)
 }
@@ -944,6 +1302,10 @@ func storagePoolVolumeTypePut(d *Daemon, r *http.Request, volumeTypeName string)
 		return resp
 	}
 
+	// Serialize with other updates of the same volume until done.
+	unlock := etagLock("storage-volume", "", fmt.Sprintf("%s/%d/%s", poolName, volumeType, volumeName))
+	defer unlock()
+
 	// Get the existing storage volume.
 	_, vol, err := d.cluster.StoragePoolNodeVolumeGetType(volumeName, volumeType, poolID)
 	if err != nil {
@@ -951,7 +1313,7 @@ func storagePoolVolumeTypePut(d *Daemon, r *http.Request, volumeTypeName string)
 	}
 
 	// Validate the ETag
-	etag := []interface{}{volumeName, vol.Type, vol.Config}
+	etag := storagePoolVolumeEtag(vol)
 
 	err = util.EtagCheck(r, etag)
 	if err != nil {
@@ -963,6 +1325,15 @@ func storagePoolVolumeTypePut(d *Daemon, r *http.Request, volumeTypeName string)
 		return response.BadRequest(err)
 	}
 
+	// The UUID of custom volumes is read-only, keep it across updates.
+	if volumeType == db.StoragePoolVolumeTypeCustom && vol.Config["volatile.uuid"] != "" {
+		if req.Config == nil {
+			req.Config = map[string]string{}
+		}
+
+		req.Config["volatile.uuid"] = vol.Config["volatile.uuid"]
+	}
+
 	// Check if we can load new storage layer for pool driver type.
 	pool, err := storagePools.GetPoolByName(d.State(), poolName)
 	if err != storageDrivers.ErrUnknownDriver {
@@ -975,7 +1346,8 @@ func storagePoolVolumeTypePut(d *Daemon, r *http.Request, volumeTypeName string)
 			// before applying config changes so that changes are applied to the
 			// restored volume.
 			if req.Restore != "" {
-				err = pool.RestoreCustomVolume(vol.Name, req.Restore, nil)
+				force := storagePoolVolumeRestoreForced(poolRow.Config, vol.Config)
+				err = pool.RestoreCustomVolume(vol.Name, req.Restore, force, nil)
 				if err != nil {
 					return response.SmartError(err)
 				}
@@ -986,6 +1358,13 @@ func storagePoolVolumeTypePut(d *Daemon, r *http.Request, volumeTypeName string)
 			if err != nil {
 				return response.SmartError(err)
 			}
+
+			if req.Config["size"] != vol.Config["size"] {
+				err = storagePoolVolumeGrowVMDisks(d.State(), pool, vol, req.Config["size"])
+				if err != nil {
+					return response.SmartError(err)
+				}
+			}
 		} else {
 			// You are only allowed to modify the description for non-custom volumes.
 			// This is a special case because the rootfs devices do not provide a way
@@ -1095,6 +1474,10 @@ func storagePoolVolumeTypePatch(d *Daemon, r *http.Request, volumeTypeName strin
 		return resp
 	}
 
+	// Serialize with other updates of the same volume until done.
+	unlock := etagLock("storage-volume", "", fmt.Sprintf("%s/%d/%s", poolName, volumeType, volumeName))
+	defer unlock()
+
 	// Get the existing storage volume.
 	_, vol, err := d.cluster.StoragePoolNodeVolumeGetType(volumeName, volumeType, poolID)
 	if err != nil {
@@ -1102,7 +1485,7 @@ func storagePoolVolumeTypePatch(d *Daemon, r *http.Request, volumeTypeName strin
 	}
 
 	// Validate the ETag.
-	etag := []interface{}{volumeName, vol.Type, vol.Config}
+	etag := storagePoolVolumeEtag(vol)
 
 	err = util.EtagCheck(r, etag)
 	if err != nil {
@@ -1137,6 +1520,13 @@ func storagePoolVolumeTypePatch(d *Daemon, r *http.Request, volumeTypeName strin
 		if err != nil {
 			return response.SmartError(err)
 		}
+
+		if req.Config["size"] != vol.Config["size"] {
+			err = storagePoolVolumeGrowVMDisks(d.State(), pool, vol, req.Config["size"])
+			if err != nil {
+				return response.SmartError(err)
+			}
+		}
 	} else {
 		// Validate the configuration.
 		err = storagePools.VolumeValidateConfig(volumeName, req.Config, poolRow)
@@ -1234,6 +1624,12 @@ func storagePoolVolumeTypeDelete(d *Daemon, r *http.Request, volumeTypeName stri
 		}
 	}
 
+	// Keep the volume's configuration around to notify its webhook once deleted.
+	_, vol, err := d.cluster.StoragePoolNodeVolumeGetType(volumeName, volumeType, poolID)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
 	// Check if we can load new storage layer for pool driver type.
 	pool, err := storagePools.GetPoolByName(d.State(), poolName)
 	if err != storageDrivers.ErrUnknownDriver {
@@ -1291,6 +1687,10 @@ func storagePoolVolumeTypeDelete(d *Daemon, r *http.Request, volumeTypeName stri
 		}
 	}
 
+	if volumeType == storagePoolVolumeTypeCustom {
+		storagePoolVolumeLifecycle(d.State(), project, "storage-volume-deleted", poolName, volumeName, vol.Config)
+	}
+
 	return response.EmptySyncResponse
 }
 
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/response"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared"
+)
+
+var storagePoolVolumeTypeCustomExportCmd = APIEndpoint{
+	Path: "storage-pools/{pool}/volumes/custom/{name}/export",
+
+	Get: APIEndpointAction{Handler: storagePoolVolumeTypeCustomExportGet},
+}
+
+// /1.0/storage-pools/{pool}/volumes/custom/{name}/export
+// Export a custom volume as a backup tarball, which can be imported back by creating a volume from
+// it.
+func storagePoolVolumeTypeCustomExportGet(d *Daemon, r *http.Request) response.Response {
+	poolName := mux.Vars(r)["pool"]
+	volName := mux.Vars(r)["name"]
+	optimized := shared.IsTrue(r.FormValue("optimized"))
+	volumeOnly := shared.IsTrue(r.FormValue("volume-only"))
+	compress := r.FormValue("compression")
+
+	resp := ForwardedResponseIfTargetIsRemote(d, r)
+	if resp != nil {
+		return resp
+	}
+
+	poolID, err := d.cluster.StoragePoolGetID(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	resp = ForwardedResponseIfVolumeIsRemote(d, r, poolID, volName, storagePoolVolumeTypeCustom)
+	if resp != nil {
+		return resp
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err == storageDrivers.ErrUnknownDriver {
+		return response.BadRequest(fmt.Errorf("Storage pool %q doesn't support exporting volumes", poolName))
+	} else if err != nil {
+		return response.SmartError(err)
+	}
+
+	if compress == "" {
+		compress, err = cluster.ConfigGetString(d.cluster, "backups.compression_algorithm")
+		if err != nil {
+			return response.SmartError(err)
+		}
+	}
+
+	f, err := ioutil.TempFile(shared.VarPath("backups"), "lxd_volume_export_")
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	err = pool.BackupCustomVolume(volName, f, optimized, volumeOnly, nil)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return response.SmartError(err)
+	}
+
+	if compress != "none" {
+		err = compressFileInPlace(f.Name(), compress)
+		if err != nil {
+			os.Remove(f.Name())
+			return response.SmartError(err)
+		}
+	}
+
+	ent := response.FileResponseEntry{
+		Path:     f.Name(),
+		Filename: fmt.Sprintf("%s.backup", volName),
+	}
+
+	return response.FileResponse(r, []response.FileResponseEntry{ent}, nil, true)
+}
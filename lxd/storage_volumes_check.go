@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/response"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared/api"
+)
+
+var storagePoolVolumeTypeCheckCmd = APIEndpoint{
+	Path: "storage-pools/{pool}/volumes/{type}/{name}/check",
+
+	Post: APIEndpointAction{Handler: storagePoolVolumeTypeCheckPost},
+}
+
+// /1.0/storage-pools/{pool}/volumes/{type}/{name}/check
+// Check the consistency of an unused custom volume or of the volume of a stopped instance, without
+// repairing anything.
+func storagePoolVolumeTypeCheckPost(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	poolName := mux.Vars(r)["pool"]
+	volumeTypeName := mux.Vars(r)["type"]
+	volumeName := mux.Vars(r)["name"]
+
+	volumeType, err := storagePools.VolumeTypeNameToType(volumeTypeName)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	if volumeType != db.StoragePoolVolumeTypeCustom && volumeType != db.StoragePoolVolumeTypeContainer && volumeType != db.StoragePoolVolumeTypeVM {
+		return response.BadRequest(fmt.Errorf("Invalid storage volume type %s", volumeTypeName))
+	}
+
+	poolID, err := d.cluster.StoragePoolGetID(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	resp := ForwardedResponseIfTargetIsRemote(d, r)
+	if resp != nil {
+		return resp
+	}
+
+	resp = ForwardedResponseIfVolumeIsRemote(d, r, poolID, volumeName, volumeType)
+	if resp != nil {
+		return resp
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err == storageDrivers.ErrUnknownDriver {
+		return response.BadRequest(fmt.Errorf("Storage pool %q doesn't support checking volumes", poolName))
+	} else if err != nil {
+		return response.SmartError(err)
+	}
+
+	var result *api.StorageVolumeCheck
+	if volumeType == db.StoragePoolVolumeTypeCustom {
+		result, err = pool.CheckCustomVolume(volumeName, nil)
+	} else {
+		var inst Instance
+		inst, err = instanceLoadByProjectAndName(d.State(), project, volumeName)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		result, err = pool.CheckInstance(inst, nil)
+	}
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, result)
+}
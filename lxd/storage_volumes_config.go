@@ -50,7 +50,12 @@ var changeableStoragePoolVolumeProperties = map[string][]string{
 		"security.shifted",
 		"security.unmapped",
 		"size",
+		"zfs.atime",
+		"zfs.delegate",
+		"zfs.logbias",
+		"zfs.recordsize",
 		"zfs.remove_snapshots",
+		"zfs.sync",
 		"zfs.use_refquota",
 	},
 }
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sys/unix"
+
+	lxd "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/lxd/cluster"
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/response"
+	"github.com/lxc/lxd/lxd/state"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	"github.com/lxc/lxd/shared"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// The custom volumes of the local storage pools of a cluster member can be attached to the
+// containers of the other members. The member holding the volume mounts it and exports it over
+// NFS to the members using it, which mount the export and bind-mount it into their containers.
+
+var internalStorageVolumeExportCmd = APIEndpoint{
+	Path: "storage-pools/{pool}/volumes/custom/{name}/export",
+
+	Post:   APIEndpointAction{Handler: internalStorageVolumeExportPost},
+	Delete: APIEndpointAction{Handler: internalStorageVolumeExportDelete},
+}
+
+type internalStorageVolumeExportResponse struct {
+	Path string `json:"path" yaml:"path"`
+}
+
+// storageVolumeExport is a custom volume exported over NFS to other cluster members.
+type storageVolumeExport struct {
+	// clients are the addresses of the members the volume is exported to.
+	clients map[string]bool
+
+	// unmount is whether the volume was mounted for the export, and is unmounted along with it.
+	unmount bool
+}
+
+// storageVolumeExports holds the custom volumes exported to other cluster members, keyed on their
+// pool and volume names.
+var storageVolumeExports = map[string]*storageVolumeExport{}
+
+// storageVolumeExportsLock is used to access storageVolumeExports.
+var storageVolumeExportsLock sync.Mutex
+
+// storageVolumeRemoteMounts holds the number of devices using each custom volume of another
+// cluster member mounted on this member, keyed on its mount path.
+var storageVolumeRemoteMounts = map[string]int{}
+
+// storageVolumeRemoteMountsLock is used to access storageVolumeRemoteMounts.
+var storageVolumeRemoteMountsLock sync.Mutex
+
+// Mount a custom volume of this member and export it to the member making the request.
+func internalStorageVolumeExportPost(d *Daemon, r *http.Request) response.Response {
+	poolName := mux.Vars(r)["pool"]
+	volumeName := mux.Vars(r)["name"]
+
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if pool.Driver().Info().Remote {
+		return response.BadRequest(fmt.Errorf("The volumes of remote storage pools are available on all cluster members"))
+	}
+
+	storageVolumeExportsLock.Lock()
+	defer storageVolumeExportsLock.Unlock()
+
+	key := fmt.Sprintf("%s/%s", poolName, volumeName)
+	export, ok := storageVolumeExports[key]
+	if !ok {
+		mountPath := shared.VarPath("storage-pools", poolName, db.StoragePoolVolumeTypeNameCustom, volumeName)
+		export = &storageVolumeExport{
+			clients: map[string]bool{},
+			unmount: !shared.IsMountPoint(mountPath),
+		}
+	}
+
+	path, err := pool.MountCustomVolumeShare(volumeName, nil)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	if !export.clients[client] {
+		options := fmt.Sprintf("rw,sync,no_subtree_check,no_root_squash,fsid=%s", storageVolumeExportFSID(key))
+
+		_, err = shared.RunCommand("exportfs", "-o", options, storageVolumeExportTarget(client, path))
+		if err != nil {
+			if len(export.clients) == 0 && export.unmount {
+				pool.UnmountCustomVolume(volumeName, nil)
+			}
+
+			return response.SmartError(fmt.Errorf("Failed to export volume %q: %v", volumeName, err))
+		}
+
+		logger.Info("Exported custom volume to cluster member", log.Ctx{"pool": poolName, "volume": volumeName, "client": client})
+		export.clients[client] = true
+	}
+
+	storageVolumeExports[key] = export
+
+	return response.SyncResponse(true, internalStorageVolumeExportResponse{Path: path})
+}
+
+// Stop exporting a custom volume of this member to the member making the request, and unmount it
+// once it isn't exported anymore.
+func internalStorageVolumeExportDelete(d *Daemon, r *http.Request) response.Response {
+	poolName := mux.Vars(r)["pool"]
+	volumeName := mux.Vars(r)["name"]
+
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	storageVolumeExportsLock.Lock()
+	defer storageVolumeExportsLock.Unlock()
+
+	key := fmt.Sprintf("%s/%s", poolName, volumeName)
+	export, ok := storageVolumeExports[key]
+	if !ok || !export.clients[client] {
+		return response.EmptySyncResponse
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	path := shared.VarPath("storage-pools", poolName, db.StoragePoolVolumeTypeNameCustom, volumeName)
+	_, err = shared.RunCommand("exportfs", "-u", storageVolumeExportTarget(client, path))
+	if err != nil {
+		return response.SmartError(fmt.Errorf("Failed to unexport volume %q: %v", volumeName, err))
+	}
+
+	logger.Info("Unexported custom volume from cluster member", log.Ctx{"pool": poolName, "volume": volumeName, "client": client})
+	delete(export.clients, client)
+
+	if len(export.clients) > 0 {
+		return response.EmptySyncResponse
+	}
+
+	delete(storageVolumeExports, key)
+
+	if export.unmount {
+		_, err = pool.UnmountCustomVolume(volumeName, nil)
+		if err != nil {
+			return response.SmartError(err)
+		}
+	}
+
+	return response.EmptySyncResponse
+}
+
+// storageVolumeExportFSID returns the NFS filesystem ID of the export of a custom volume, as the
+// filesystems of the volumes of some drivers can't be told apart otherwise.
+func storageVolumeExportFSID(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:32]
+}
+
+// storageVolumeExportTarget returns the argument of exportfs exporting the path to the client.
+func storageVolumeExportTarget(client string, path string) string {
+	if strings.Contains(client, ":") {
+		client = fmt.Sprintf("[%s]", client)
+	}
+
+	return fmt.Sprintf("%s:%s", client, path)
+}
+
+// storageVolumeExportURL returns the path of the internal endpoint exporting a custom volume.
+func storageVolumeExportURL(poolName string, volumeName string) string {
+	return fmt.Sprintf("/internal/storage-pools/%s/volumes/custom/%s/export", url.PathEscape(poolName), url.PathEscape(volumeName))
+}
+
+// storageVolumeRemoteMountPath returns the path a custom volume of another cluster member is
+// mounted on.
+func storageVolumeRemoteMountPath(location string, poolName string, volumeName string) string {
+	return shared.VarPath("storage-remote", location, poolName, volumeName)
+}
+
+// storageVolumeRemoteConnect returns the address of a cluster member along with a client to it.
+func storageVolumeRemoteConnect(s *state.State, location string) (string, lxd.InstanceServer, error) {
+	var address string
+	err := s.Cluster.Transaction(func(tx *db.ClusterTx) error {
+		node, err := tx.NodeByName(location)
+		if err != nil {
+			return err
+		}
+
+		address = node.Address
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	client, err := cluster.Connect(address, s.Endpoints.NetworkCert(), false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return address, client, nil
+}
+
+// storageVolumeRemoteMount asks the cluster member holding a custom volume to export it, and
+// mounts the export on this member unless another device already did. It returns the path the
+// volume is mounted on.
+func storageVolumeRemoteMount(s *state.State, location string, poolName string, volumeName string) (string, error) {
+	mountPath := storageVolumeRemoteMountPath(location, poolName, volumeName)
+
+	storageVolumeRemoteMountsLock.Lock()
+	defer storageVolumeRemoteMountsLock.Unlock()
+
+	if storageVolumeRemoteMounts[mountPath] > 0 && shared.IsMountPoint(mountPath) {
+		storageVolumeRemoteMounts[mountPath]++
+		return mountPath, nil
+	}
+
+	address, client, err := storageVolumeRemoteConnect(s, location)
+	if err != nil {
+		return "", err
+	}
+
+	resp, _, err := client.RawQuery("POST", storageVolumeExportURL(poolName, volumeName), nil, "")
+	if err != nil {
+		return "", err
+	}
+
+	export := internalStorageVolumeExportResponse{}
+	err = resp.MetadataAsStruct(&export)
+	if err != nil {
+		return "", err
+	}
+
+	if !shared.IsMountPoint(mountPath) {
+		err = os.MkdirAll(mountPath, 0711)
+		if err != nil {
+			return "", err
+		}
+
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = shared.RunCommand("mount", "-t", "nfs", "-o", "vers=4,hard", storageVolumeExportTarget(host, export.Path), mountPath)
+		if err != nil {
+			client.RawQuery("DELETE", storageVolumeExportURL(poolName, volumeName), nil, "")
+			return "", fmt.Errorf("Failed to mount volume %q of cluster member %q: %v", volumeName, location, err)
+		}
+	}
+
+	storageVolumeRemoteMounts[mountPath]++
+
+	return mountPath, nil
+}
+
+// storageVolumeRemoteUmount unmounts a custom volume of another cluster member once no device
+// uses it anymore, and asks the member holding it to stop exporting it.
+func storageVolumeRemoteUmount(s *state.State, location string, poolName string, volumeName string) error {
+	mountPath := storageVolumeRemoteMountPath(location, poolName, volumeName)
+
+	storageVolumeRemoteMountsLock.Lock()
+	defer storageVolumeRemoteMountsLock.Unlock()
+
+	if storageVolumeRemoteMounts[mountPath] > 1 {
+		storageVolumeRemoteMounts[mountPath]--
+		return nil
+	}
+
+	delete(storageVolumeRemoteMounts, mountPath)
+
+	if shared.IsMountPoint(mountPath) {
+		err := unix.Unmount(mountPath, unix.MNT_DETACH)
+		if err != nil {
+			return fmt.Errorf("Failed to unmount volume %q of cluster member %q: %v", volumeName, location, err)
+		}
+	}
+
+	os.Remove(mountPath)
+
+	_, client, err := storageVolumeRemoteConnect(s, location)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = client.RawQuery("DELETE", storageVolumeExportURL(poolName, volumeName), nil, "")
+	return err
+}
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/flosch/pongo2"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 
 	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/node"
 	"github.com/lxc/lxd/lxd/operations"
 	"github.com/lxc/lxd/lxd/response"
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/lxd/task"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
+	log "github.com/lxc/lxd/shared/log15"
+	"github.com/lxc/lxd/shared/logger"
 	"github.com/lxc/lxd/shared/version"
 )
 
@@ -35,6 +46,12 @@ var storagePoolVolumeSnapshotTypeCmd = APIEndpoint{
 	Put:    APIEndpointAction{Handler: storagePoolVolumeSnapshotTypePut},
 }
 
+var storagePoolVolumeSnapshotTypeFileCmd = APIEndpoint{
+	Path: "storage-pools/{pool}/volumes/{type}/{name}/snapshots/{snapshotName}/files",
+
+	Get: APIEndpointAction{Handler: storagePoolVolumeSnapshotTypeFileGet},
+}
+
 func storagePoolVolumeSnapshotsTypePost(d *Daemon, r *http.Request) response.Response {
 	// Get the name of the pool.
 	poolName := mux.Vars(r)["pool"]
@@ -65,7 +82,7 @@ func storagePoolVolumeSnapshotsTypePost(d *Daemon, r *http.Request) response.Res
 
 	// Get a snapshot name.
 	if req.Name == "" {
-		i := d.cluster.StorageVolumeNextSnapshot(volumeName, volumeType)
+		i := d.cluster.StorageVolumeNextSnapshot(volumeName, volumeType, "snap%d")
 		req.Name = fmt.Sprintf("snap%d", i)
 	}
 
@@ -108,6 +125,23 @@ func storagePoolVolumeSnapshotsTypePost(d *Daemon, r *http.Request) response.Res
 		return response.SmartError(err)
 	}
 
+	// Snapshots expire as set by the volume's snapshots.expiry key, unless requested otherwise.
+	if req.ExpiresAt == nil {
+		_, volume, err := d.cluster.StoragePoolNodeVolumeGetType(volumeName, volumeType, poolID)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		expiry, err := shared.GetSnapshotExpiry(time.Now(), volume.Config["snapshots.expiry"])
+		if err != nil {
+			return response.BadRequest(err)
+		}
+
+		if !expiry.IsZero() {
+			req.ExpiresAt = &expiry
+		}
+	}
+
 	// Ensure that the snapshot doesn't already exist
 	_, _, err = d.cluster.StoragePoolNodeVolumeGetType(fmt.Sprintf("%s/%s", volumeName, req.Name), volumeType, poolID)
 	if err != db.ErrNoSuchObject {
@@ -118,6 +152,8 @@ func storagePoolVolumeSnapshotsTypePost(d *Daemon, r *http.Request) response.Res
 		return response.Conflict(fmt.Errorf("Snapshot '%s' already in use", req.Name))
 	}
 
+	fullSnapName := fmt.Sprintf("%s%s%s", volumeName, shared.SnapshotDelimiter, req.Name)
+
 	snapshot := func(op *operations.Operation) error {
 		// Check if we can load new storage layer for pool driver type.
 		pool, err := storagePools.GetPoolByName(d.State(), poolName)
@@ -141,7 +177,6 @@ func storagePoolVolumeSnapshotsTypePost(d *Daemon, r *http.Request) response.Res
 			}
 
 			volWritable := storage.GetStoragePoolVolumeWritable()
-			fullSnapName := fmt.Sprintf("%s%s%s", volumeName, shared.SnapshotDelimiter, req.Name)
 			req.Name = fullSnapName
 			dbArgs := &db.StorageVolumeArgs{
 				Name:        fullSnapName,
@@ -163,6 +198,13 @@ func storagePoolVolumeSnapshotsTypePost(d *Daemon, r *http.Request) response.Res
 			}
 		}
 
+		if req.ExpiresAt != nil {
+			err = d.cluster.StoragePoolVolumeSnapshotExpiryUpdate(fullSnapName, volumeType, poolID, *req.ExpiresAt)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	}
 
@@ -207,6 +249,17 @@ func storagePoolVolumeSnapshotsTypeGet(d *Daemon, r *http.Request) response.Resp
 		return response.SmartError(err)
 	}
 
+	// Snapshots are listed from the node hosting the volume.
+	resp := ForwardedResponseIfTargetIsRemote(d, r)
+	if resp != nil {
+		return resp
+	}
+
+	resp = ForwardedResponseIfVolumeIsRemote(d, r, poolID, volumeName, volumeType)
+	if resp != nil {
+		return resp
+	}
+
 	// Get the names of all storage volume snapshots of a given volume
 	volumes, err := d.cluster.StoragePoolVolumeSnapshotsGetType(volumeName, volumeType, poolID)
 	if err != nil {
@@ -240,6 +293,8 @@ func storagePoolVolumeSnapshotsTypeGet(d *Daemon, r *http.Request) response.Resp
 			tmp.Config = vol.Config
 			tmp.Description = vol.Description
 			tmp.Name = vol.Name
+			tmp.CreatedAt = volume.CreationDate
+			tmp.ExpiresAt = volume.ExpiryDate
 
 			resultMap = append(resultMap, tmp)
 		}
@@ -383,7 +438,12 @@ func storagePoolVolumeSnapshotTypeGet(d *Daemon, r *http.Request) response.Respo
 		return resp
 	}
 
-	_, volume, err := d.cluster.StoragePoolNodeVolumeGetType(fullSnapshotName, volumeType, poolID)
+	volumeID, volume, err := d.cluster.StoragePoolNodeVolumeGetType(fullSnapshotName, volumeType, poolID)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	creationDate, expiryDate, err := d.cluster.StorageVolumeDatesGet(volumeID)
 	if err != nil {
 		return response.SmartError(err)
 	}
@@ -392,13 +452,101 @@ func storagePoolVolumeSnapshotTypeGet(d *Daemon, r *http.Request) response.Respo
 	snapshot.Config = volume.Config
 	snapshot.Description = volume.Description
 	snapshot.Name = snapshotName
+	snapshot.CreatedAt = creationDate
+	snapshot.ExpiresAt = expiryDate
 
-	etag := []interface{}{snapshot.Name, snapshot.Description, snapshot.Config}
+	etag := []interface{}{snapshot.Name, snapshot.Description, snapshot.Config, snapshot.ExpiresAt}
 
 	return response.SyncResponseETag(true, &snapshot, etag)
 }
 
-// storagePoolVolumeSnapshotTypePut allows a snapshot's description to be changed.
+// storagePoolVolumeSnapshotTypeFileGet returns a file, or the entries of a
+// directory, from a custom volume snapshot. The snapshot is read through its
+// mount path, with the volume mounted for the duration of the request.
+func storagePoolVolumeSnapshotTypeFileGet(d *Daemon, r *http.Request) response.Response {
+	// Get the name of the storage pool the volume is supposed to be
+	// attached to.
+	poolName := mux.Vars(r)["pool"]
+
+	// Get the name of the volume type.
+	volumeTypeName := mux.Vars(r)["type"]
+
+	// Get the name of the storage volume.
+	volumeName := mux.Vars(r)["name"]
+
+	// Get the name of the storage volume.
+	snapshotName := mux.Vars(r)["snapshotName"]
+
+	// Convert the volume type name to our internal integer representation.
+	volumeType, err := storagePools.VolumeTypeNameToType(volumeTypeName)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	// Check that the storage volume type is valid.
+	if volumeType != storagePoolVolumeTypeCustom {
+		return response.BadRequest(fmt.Errorf("invalid storage volume type %s", volumeTypeName))
+	}
+
+	path := r.FormValue("path")
+	if path == "" {
+		return response.BadRequest(fmt.Errorf("missing path argument"))
+	}
+
+	resp := ForwardedResponseIfTargetIsRemote(d, r)
+	if resp != nil {
+		return resp
+	}
+
+	poolID, _, err := d.cluster.StoragePoolGet(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	fullSnapshotName := fmt.Sprintf("%s/%s", volumeName, snapshotName)
+	resp = ForwardedResponseIfVolumeIsRemote(d, r, poolID, fullSnapshotName, volumeType)
+	if resp != nil {
+		return resp
+	}
+
+	// Make sure the snapshot exists.
+	_, _, err = d.cluster.StoragePoolNodeVolumeGetType(fullSnapshotName, volumeType, poolID)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	s, err := storagePoolVolumeInit(d.State(), "default", poolName, volumeName, volumeType)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	ourMount, err := s.StoragePoolVolumeMount()
+	if err != nil {
+		return response.SmartError(err)
+	}
+	if ourMount {
+		defer s.StoragePoolVolumeUmount()
+	}
+
+	temp, err := ioutil.TempFile("", "lxd_forkgetfile_")
+	if err != nil {
+		return response.InternalError(err)
+	}
+	defer temp.Close()
+
+	// Pull the file from within the snapshot, so that symlinks can't point
+	// outside of it.
+	rootfs := storagePools.GetStoragePoolVolumeSnapshotMountPoint(poolName, fullSnapshotName)
+	uid, gid, mode, type_, dirEnts, err := forkfilePull(d.os.ExecPath, rootfs, -1, path, temp.Name())
+	if err != nil {
+		os.Remove(temp.Name())
+		return response.SmartError(err)
+	}
+
+	return fileGetResponse(r, path, temp.Name(), uid, gid, mode, type_, dirEnts)
+}
+
+// storagePoolVolumeSnapshotTypePut allows a snapshot's description and expiry date to be changed.
 func storagePoolVolumeSnapshotTypePut(d *Daemon, r *http.Request) response.Response {
 	// Get the name of the storage pool the volume is supposed to be
 	// attached to.
@@ -440,13 +588,18 @@ func storagePoolVolumeSnapshotTypePut(d *Daemon, r *http.Request) response.Respo
 		return resp
 	}
 
-	_, vol, err := d.cluster.StoragePoolNodeVolumeGetType(fullSnapshotName, volumeType, poolID)
+	volumeID, vol, err := d.cluster.StoragePoolNodeVolumeGetType(fullSnapshotName, volumeType, poolID)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	_, expiryDate, err := d.cluster.StorageVolumeDatesGet(volumeID)
 	if err != nil {
 		return response.SmartError(err)
 	}
 
 	// Validate the ETag
-	etag := []interface{}{snapshotName, vol.Description, vol.Config}
+	etag := []interface{}{snapshotName, vol.Description, vol.Config, expiryDate}
 	err = util.EtagCheck(r, etag)
 	if err != nil {
 		return response.PreconditionFailed(err)
@@ -467,6 +620,14 @@ func storagePoolVolumeSnapshotTypePut(d *Daemon, r *http.Request) response.Respo
 			}
 		}
 
+		// Update the database if the expiry date changed.
+		if !req.ExpiresAt.Equal(expiryDate) {
+			err = d.cluster.StoragePoolVolumeSnapshotExpiryUpdate(vol.Name, volumeType, poolID, req.ExpiresAt)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	}
 
@@ -553,3 +714,369 @@ func storagePoolVolumeSnapshotTypeDelete(d *Daemon, r *http.Request) response.Re
 
 	return operations.OperationResponse(op)
 }
+
+func autoCreateCustomVolumeSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		pools, err := d.cluster.StoragePools()
+		if err != nil {
+			if err != db.ErrNoSuchObject {
+				logger.Error("Failed to load storage pools for scheduled volume snapshots", log.Ctx{"err": err})
+			}
+
+			return
+		}
+
+		// The volumes of ceph pools are shared by all the nodes of a cluster, only the leader
+		// snapshots them.
+		isLeader, err := storageVolumesIsLeader(d)
+		if err != nil {
+			logger.Error("Failed to check if this node is the leader", log.Ctx{"err": err})
+			return
+		}
+
+		// Figure out which custom volumes need snapshotting (if any)
+		tasks := []storageVolumeTask{}
+		for _, poolName := range pools {
+			poolID, poolInfo, err := d.cluster.StoragePoolGet(poolName)
+			if err != nil {
+				logger.Error("Failed to load storage pool for scheduled volume snapshots", log.Ctx{"pool": poolName, "err": err})
+				continue
+			}
+
+			if poolInfo.Driver == "ceph" && !isLeader {
+				continue
+			}
+
+			volumes, err := d.cluster.StoragePoolNodeVolumesGet(poolID, []int{db.StoragePoolVolumeTypeCustom})
+			if err != nil {
+				if err != db.ErrNoSuchObject {
+					logger.Error("Failed to load volumes for scheduled volume snapshots", log.Ctx{"pool": poolName, "err": err})
+				}
+
+				continue
+			}
+
+			for _, volume := range volumes {
+				if shared.IsSnapshot(volume.Name) {
+					continue
+				}
+
+				if !snapshotIsScheduledNow(volume.Config["snapshots.schedule"]) {
+					continue
+				}
+
+				// Check if snapshots are paused on the volume's storage pool
+				err = storagePoolWatermarkCheck(d.State(), poolName, "snapshots")
+				if err != nil {
+					logger.Warn("Skipping scheduled volume snapshot", log.Ctx{"pool": poolName, "volume": volume.Name, "err": err})
+					continue
+				}
+
+				poolName := poolName
+				volume := volume
+				tasks = append(tasks, storageVolumeTask{pool: poolName, run: func() error {
+					return autoCreateCustomVolumeSnapshot(d, poolName, poolID, volume)
+				}})
+			}
+		}
+
+		if len(tasks) == 0 {
+			return
+		}
+
+		opRun := func(op *operations.Operation) error {
+			storageVolumeTasksRun(ctx, d.State(), tasks)
+			return nil
+		}
+
+		op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationVolumeSnapshotCreate, nil, nil, opRun, nil, nil)
+		if err != nil {
+			logger.Error("Failed to start create volume snapshot operation", log.Ctx{"err": err})
+			return
+		}
+
+		logger.Info("Creating scheduled volume snapshots")
+
+		_, err = op.Run()
+		if err != nil {
+			logger.Error("Failed to create scheduled volume snapshots", log.Ctx{"err": err})
+		}
+
+		logger.Info("Done creating scheduled volume snapshots")
+	}
+
+	first := true
+	schedule := func() (time.Duration, error) {
+		interval := time.Minute
+
+		if first {
+			first = false
+			return interval, task.ErrSkip
+		}
+
+		return interval, nil
+	}
+
+	return f, schedule
+}
+
+// storageVolumesIsLeader returns whether this node is the cluster leader, which handles the
+// scheduled work on the volumes of the storage pools shared by all nodes. A node which isn't
+// clustered is its own leader.
+func storageVolumesIsLeader(d *Daemon) (bool, error) {
+	localAddress, err := node.ClusterAddress(d.db)
+	if err != nil {
+		return false, err
+	}
+
+	if localAddress == "" {
+		return true, nil
+	}
+
+	leader, err := d.gateway.LeaderAddress()
+	if err != nil {
+		return false, err
+	}
+
+	return localAddress == leader, nil
+}
+
+// autoCreateCustomVolumeSnapshot takes a scheduled snapshot of a custom volume, through the new
+// storage layer. Failures are logged rather than returned, so that they don't affect the
+// snapshots of the other volumes.
+func autoCreateCustomVolumeSnapshot(d *Daemon, poolName string, poolID int64, volume *api.StorageVolume) error {
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err != nil {
+		if err == storageDrivers.ErrUnknownDriver {
+			logger.Warn("Skipping scheduled volume snapshot, the storage pool doesn't support it", log.Ctx{"pool": poolName, "volume": volume.Name})
+			return nil
+		}
+
+		logger.Error("Error loading storage pool", log.Ctx{"err": err, "pool": poolName, "volume": volume.Name})
+		return nil
+	}
+
+	snapshotName, err := volumeDetermineNextSnapshotName(d, poolID, volume, "snap%d")
+	if err != nil {
+		logger.Error("Error retrieving next snapshot name", log.Ctx{"err": err, "pool": poolName, "volume": volume.Name})
+		return nil
+	}
+
+	expiry, err := shared.GetSnapshotExpiry(time.Now(), volume.Config["snapshots.expiry"])
+	if err != nil {
+		logger.Error("Error getting expiry date", log.Ctx{"err": err, "pool": poolName, "volume": volume.Name})
+		return nil
+	}
+
+	err = pool.CreateCustomVolumeSnapshot(volume.Name, snapshotName, nil)
+	if err != nil {
+		logger.Error("Error creating volume snapshot", log.Ctx{"err": err, "pool": poolName, "volume": volume.Name})
+		return nil
+	}
+
+	if !expiry.IsZero() {
+		fullSnapName := fmt.Sprintf("%s%s%s", volume.Name, shared.SnapshotDelimiter, snapshotName)
+		err = d.cluster.StoragePoolVolumeSnapshotExpiryUpdate(fullSnapName, db.StoragePoolVolumeTypeCustom, poolID, expiry)
+		if err != nil {
+			logger.Error("Error setting volume snapshot expiry date", log.Ctx{"err": err, "pool": poolName, "volume": volume.Name, "snapshot": snapshotName})
+		}
+	}
+
+	return nil
+}
+
+// volumeDetermineNextSnapshotName returns the name of the next snapshot of a custom volume, as
+// set by its snapshots.pattern key.
+func volumeDetermineNextSnapshotName(d *Daemon, poolID int64, volume *api.StorageVolume, defaultPattern string) (string, error) {
+	var err error
+
+	pattern := volume.Config["snapshots.pattern"]
+	if pattern == "" {
+		pattern = defaultPattern
+	}
+
+	pattern, err = shared.RenderTemplate(pattern, pongo2.Context{
+		"creation_date": time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	count := strings.Count(pattern, "%d")
+	if count > 1 {
+		return "", fmt.Errorf("Snapshot pattern may contain '%%d' only once")
+	} else if count == 1 {
+		i := d.cluster.StorageVolumeNextSnapshot(volume.Name, db.StoragePoolVolumeTypeCustom, pattern)
+		return strings.Replace(pattern, "%d", strconv.Itoa(i), 1), nil
+	}
+
+	snapshots, err := d.cluster.StoragePoolVolumeSnapshotsGetType(volume.Name, db.StoragePoolVolumeTypeCustom, poolID)
+	if err != nil {
+		return "", err
+	}
+
+	snapshotExists := false
+	for _, snap := range snapshots {
+		_, snapOnlyName, _ := shared.ContainerGetParentAndSnapshotName(snap.Name)
+		if snapOnlyName == pattern {
+			snapshotExists = true
+			break
+		}
+	}
+
+	// Append '-0', '-1', etc. if the actual pattern/snapshot name already exists
+	if snapshotExists {
+		pattern = fmt.Sprintf("%s-%%d", pattern)
+		i := d.cluster.StorageVolumeNextSnapshot(volume.Name, db.StoragePoolVolumeTypeCustom, pattern)
+		return strings.Replace(pattern, "%d", strconv.Itoa(i), 1), nil
+	}
+
+	return pattern, nil
+}
+
+func pruneExpiredCustomVolumeSnapshotsTask(d *Daemon) (task.Func, task.Schedule) {
+	f := func(ctx context.Context) {
+		pools, err := d.cluster.StoragePools()
+		if err != nil {
+			if err != db.ErrNoSuchObject {
+				logger.Error("Failed to load storage pools for volume snapshot expiry", log.Ctx{"err": err})
+			}
+
+			return
+		}
+
+		// The volumes of ceph pools are shared by all the nodes of a cluster, only the leader
+		// prunes their snapshots.
+		isLeader, err := storageVolumesIsLeader(d)
+		if err != nil {
+			logger.Error("Failed to check if this node is the leader", log.Ctx{"err": err})
+			return
+		}
+
+		// Figure out which volume snapshots have expired (if any), the snapshots of a given
+		// volume being deleted in order.
+		tasks := []storageVolumeTask{}
+		for _, poolName := range pools {
+			poolID, poolInfo, err := d.cluster.StoragePoolGet(poolName)
+			if err != nil {
+				logger.Error("Failed to load storage pool for volume snapshot expiry", log.Ctx{"pool": poolName, "err": err})
+				continue
+			}
+
+			if poolInfo.Driver == "ceph" && !isLeader {
+				continue
+			}
+
+			volumes, err := d.cluster.StoragePoolNodeVolumesGet(poolID, []int{db.StoragePoolVolumeTypeCustom})
+			if err != nil {
+				if err != db.ErrNoSuchObject {
+					logger.Error("Failed to load volumes for volume snapshot expiry", log.Ctx{"pool": poolName, "err": err})
+				}
+
+				continue
+			}
+
+			for _, volume := range volumes {
+				if shared.IsSnapshot(volume.Name) {
+					continue
+				}
+
+				snapshots, err := d.cluster.StoragePoolVolumeSnapshotsGetType(volume.Name, db.StoragePoolVolumeTypeCustom, poolID)
+				if err != nil {
+					logger.Error("Failed to list volume snapshots", log.Ctx{"pool": poolName, "volume": volume.Name, "err": err})
+					continue
+				}
+
+				expiredSnapshots := []string{}
+				for _, snapshot := range snapshots {
+					if snapshot.ExpiryDate.IsZero() {
+						// Snapshot doesn't expire
+						continue
+					}
+
+					if time.Now().Unix()-snapshot.ExpiryDate.Unix() >= 0 {
+						expiredSnapshots = append(expiredSnapshots, snapshot.Name)
+					}
+				}
+
+				if len(expiredSnapshots) == 0 {
+					continue
+				}
+
+				poolName := poolName
+				tasks = append(tasks, storageVolumeTask{pool: poolName, run: func() error {
+					return pruneExpiredCustomVolumeSnapshots(d, poolName, expiredSnapshots)
+				}})
+			}
+		}
+
+		if len(tasks) == 0 {
+			return
+		}
+
+		opRun := func(op *operations.Operation) error {
+			errs := storageVolumeTasksRun(ctx, d.State(), tasks)
+			if len(errs) > 0 {
+				return errs[0]
+			}
+
+			return nil
+		}
+
+		op, err := operations.OperationCreate(d.State(), "", operations.OperationClassTask, db.OperationSnapshotsExpire, nil, nil, opRun, nil, nil)
+		if err != nil {
+			logger.Error("Failed to start expired volume snapshots operation", log.Ctx{"err": err})
+			return
+		}
+
+		logger.Info("Pruning expired volume snapshots")
+
+		_, err = op.Run()
+		if err != nil {
+			logger.Error("Failed to remove expired volume snapshots", log.Ctx{"err": err})
+		}
+
+		logger.Info("Done pruning expired volume snapshots")
+	}
+
+	first := true
+	schedule := func() (time.Duration, error) {
+		interval := time.Minute
+
+		if first {
+			first = false
+			return interval, task.ErrSkip
+		}
+
+		return interval, nil
+	}
+
+	return f, schedule
+}
+
+// pruneExpiredCustomVolumeSnapshots deletes the given snapshots of a custom volume, oldest first.
+func pruneExpiredCustomVolumeSnapshots(d *Daemon, poolName string, snapshots []string) error {
+	// Check if we can load new storage layer for pool driver type.
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err != nil && err != storageDrivers.ErrUnknownDriver {
+		return err
+	}
+
+	for _, snapshotName := range snapshots {
+		if pool != nil {
+			err = pool.DeleteCustomVolumeSnapshot(snapshotName, nil)
+		} else {
+			var s storage
+			s, err = storagePoolVolumeInit(d.State(), "default", poolName, snapshotName, db.StoragePoolVolumeTypeCustom)
+			if err == nil {
+				err = s.StoragePoolVolumeSnapshotDelete()
+			}
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "Failed to delete expired volume snapshot '%s' on pool '%s'", snapshotName, poolName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/lxc/lxd/lxd/db"
+	"github.com/lxc/lxd/lxd/response"
+	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/shared/api"
+)
+
+var storagePoolVolumeTypeStateCmd = APIEndpoint{
+	Path: "storage-pools/{pool}/volumes/{type}/{name}/state",
+
+	Get: APIEndpointAction{Handler: storagePoolVolumeTypeStateGet, AccessHandler: AllowAuthenticated},
+}
+
+// /1.0/storage-pools/{pool}/volumes/{type}/{name}/state
+// Get the state of a custom or instance volume, which is the disk space it uses.
+func storagePoolVolumeTypeStateGet(d *Daemon, r *http.Request) response.Response {
+	project := projectParam(r)
+	poolName := mux.Vars(r)["pool"]
+	volumeTypeName := mux.Vars(r)["type"]
+	volumeName := mux.Vars(r)["name"]
+
+	volumeType, err := storagePools.VolumeTypeNameToType(volumeTypeName)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	if volumeType != db.StoragePoolVolumeTypeCustom && volumeType != db.StoragePoolVolumeTypeContainer && volumeType != db.StoragePoolVolumeTypeVM {
+		return response.BadRequest(fmt.Errorf("Invalid storage volume type %s", volumeTypeName))
+	}
+
+	poolID, err := d.cluster.StoragePoolGetID(poolName)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	resp := ForwardedResponseIfTargetIsRemote(d, r)
+	if resp != nil {
+		return resp
+	}
+
+	resp = ForwardedResponseIfVolumeIsRemote(d, r, poolID, volumeName, volumeType)
+	if resp != nil {
+		return resp
+	}
+
+	pool, err := storagePools.GetPoolByName(d.State(), poolName)
+	if err == storageDrivers.ErrUnknownDriver {
+		return response.BadRequest(fmt.Errorf("Storage pool %q doesn't report the state of volumes", poolName))
+	} else if err != nil {
+		return response.SmartError(err)
+	}
+
+	var used int64
+	if volumeType == db.StoragePoolVolumeTypeCustom {
+		used, err = pool.GetCustomVolumeUsage(volumeName)
+	} else {
+		var inst Instance
+		inst, err = instanceLoadByProjectAndName(d.State(), project, volumeName)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		used, err = pool.GetInstanceUsage(inst)
+	}
+
+	state := api.StorageVolumeState{}
+
+	// Drivers which can't tell the usage of the volume leave it out.
+	if err == nil {
+		state.Usage = &api.StorageVolumeStateUsage{Used: uint64(used)}
+	} else if !api.StatusErrorCheck(err, http.StatusNotImplemented) {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, state)
+}
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"path/filepath"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/lxc/lxd/lxd/db"
+	deviceConfig "github.com/lxc/lxd/lxd/device/config"
+	"github.com/lxc/lxd/lxd/instance/instancetype"
+	"github.com/lxc/lxd/lxd/response"
 	"github.com/lxc/lxd/lxd/state"
 	storagePools "github.com/lxc/lxd/lxd/storage"
+	storageDrivers "github.com/lxc/lxd/lxd/storage/drivers"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/version"
@@ -76,6 +87,25 @@ func storagePoolVolumeTypeToAPIEndpoint(volumeType int) (string, error) {
 	return "", fmt.Errorf("invalid storage volume type")
 }
 
+// storagePoolVolumeLifecycle sends a lifecycle event for a custom storage volume, also notifying
+// the webhook configured on the volume if any.
+func storagePoolVolumeLifecycle(s *state.State, project string, action string, poolName string, volumeName string, config map[string]string) {
+	source := fmt.Sprintf("/%s/storage-pools/%s/volumes/%s/%s", version.APIVersion, poolName, storagePoolVolumeAPIEndpointCustom, volumeName)
+
+	webhook.SendLifecycle(config, project, action, source, nil)
+	s.Events.SendLifecycle(project, action, source, nil)
+}
+
+// storagePoolVolumeRestoreForced returns whether restoring the volume may destroy the snapshots
+// taken after the restored one, as set by zfs.remove_snapshots on the volume or on the pool.
+func storagePoolVolumeRestoreForced(poolConfig map[string]string, volConfig map[string]string) bool {
+	if volConfig["zfs.remove_snapshots"] != "" {
+		return shared.IsTrue(volConfig["zfs.remove_snapshots"])
+	}
+
+	return shared.IsTrue(poolConfig["volume.zfs.remove_snapshots"])
+}
+
 func storagePoolVolumeRestore(state *state.State, poolName string, volumeName string, volumeType int, snapshotName string) error {
 	s, err := storagePoolVolumeInit(state, "default", poolName,
 		fmt.Sprintf("%s/%s", volumeName, snapshotName), volumeType)
@@ -127,12 +157,12 @@ func storagePoolVolumeUpdate(state *state.State, poolName string, volumeName str
 		}
 	}()
 
-	// Diff the configurations
+	// Diff the configurations (user and webhook keys are of no concern to the storage driver)
 	changedConfig := []string{}
 	userOnly := true
 	for key := range oldConfig {
 		if oldConfig[key] != newConfig[key] {
-			if !strings.HasPrefix(key, "user.") {
+			if !strings.HasPrefix(key, "user.") && !strings.HasPrefix(key, "webhooks.") {
 				userOnly = false
 			}
 
@@ -144,7 +174,7 @@ func storagePoolVolumeUpdate(state *state.State, poolName string, volumeName str
 
 	for key := range newConfig {
 		if oldConfig[key] != newConfig[key] {
-			if !strings.HasPrefix(key, "user.") {
+			if !strings.HasPrefix(key, "user.") && !strings.HasPrefix(key, "webhooks.") {
 				userOnly = false
 			}
 
@@ -214,6 +244,8 @@ func storagePoolVolumeUpdate(state *state.State, poolName string, volumeName str
 	return nil
 }
 
+// storagePoolVolumeUsedByContainersGet returns the names of the instances using the custom volume,
+// whether the disk is declared on the instance itself or comes from one of its profiles.
 func storagePoolVolumeUsedByContainersGet(s *state.State, project, poolName string, volumeName string) ([]string, error) {
 	insts, err := instanceLoadByProject(s, project)
 	if err != nil {
@@ -222,12 +254,12 @@ func storagePoolVolumeUsedByContainersGet(s *state.State, project, poolName stri
 
 	ctsUsingVolume := []string{}
 	for _, inst := range insts {
-		for _, dev := range inst.LocalDevices() {
-			if dev["type"] != "disk" {
+		for _, dev := range inst.ExpandedDevices() {
+			if dev["type"] != "disk" || dev["path"] == "/" {
 				continue
 			}
 
-			if dev["pool"] == poolName && dev["source"] == volumeName {
+			if dev["pool"] == poolName && filepath.Clean(dev["source"]) == volumeName {
 				ctsUsingVolume = append(ctsUsingVolume, inst.Name())
 				break
 			}
@@ -237,6 +269,45 @@ func storagePoolVolumeUsedByContainersGet(s *state.State, project, poolName stri
 	return ctsUsingVolume, nil
 }
 
+// storagePoolVolumeGrowVMDisks lets the running virtual machines using a custom block volume see its
+// new size without a restart.
+func storagePoolVolumeGrowVMDisks(s *state.State, pool storagePools.Pool, vol *api.StorageVolume, size string) error {
+	if vol.ContentType != db.StoragePoolVolumeContentTypeNameBlock {
+		return nil
+	}
+
+	insts, err := instanceLoadAll(s)
+	if err != nil {
+		return err
+	}
+
+	for _, inst := range insts {
+		if inst.Type() != instancetype.VM || !inst.IsRunning() {
+			continue
+		}
+
+		for _, dev := range inst.ExpandedDevices() {
+			if dev["type"] != "disk" || dev["pool"] != pool.Name() || dev["source"] != vol.Name {
+				continue
+			}
+
+			diskPath, _, err := pool.GetCustomVolumeDisk(vol.Name)
+			if err != nil {
+				return err
+			}
+
+			err = inst.(*vmQemu).growDisk(diskPath, size)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to grow disk of virtual machine %q", inst.Name())
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
 func storagePoolVolumeUpdateUsers(d *Daemon, oldPoolName string,
 	oldVolumeName string, newPoolName string, newVolumeName string) error {
 
@@ -447,7 +518,7 @@ func storagePoolVolumeUsedByGet(s *state.State, project, poolName string, volume
 			fmt.Sprintf("/%s/containers/%s", version.APIVersion, ct))
 	}
 
-	profiles, err := profilesUsingPoolVolumeGetNames(s.Cluster, volumeName, volumeTypeName)
+	profiles, err := profilesUsingPoolVolumeGetNames(s.Cluster, poolName, volumeName, volumeTypeName)
 	if err != nil {
 		return []string{}, err
 	}
@@ -463,7 +534,7 @@ func storagePoolVolumeUsedByGet(s *state.State, project, poolName string, volume
 	return volumeUsedBy, nil
 }
 
-func profilesUsingPoolVolumeGetNames(db *db.Cluster, volumeName string, volumeType string) ([]string, error) {
+func profilesUsingPoolVolumeGetNames(db *db.Cluster, poolName string, volumeName string, volumeType string) ([]string, error) {
 	usedBy := []string{}
 
 	profiles, err := db.Profiles("default")
@@ -479,7 +550,7 @@ func profilesUsingPoolVolumeGetNames(db *db.Cluster, volumeName string, volumeTy
 
 		volumeNameWithType := fmt.Sprintf("%s/%s", volumeType, volumeName)
 		for _, v := range profile.Devices {
-			if v["type"] != "disk" {
+			if v["type"] != "disk" || v["pool"] != poolName {
 				continue
 			}
 
@@ -501,6 +572,56 @@ func profilesUsingPoolVolumeGetNames(db *db.Cluster, volumeName string, volumeTy
 	return usedBy, nil
 }
 
+// storagePoolVolumeContentType checks the content type requested for a new custom volume and
+// returns it, filling in the default of a filesystem volume. Only empty volumes can be requested
+// as block volumes, copies getting the content type of their source.
+func storagePoolVolumeContentType(req *api.StorageVolumesPost) (storageDrivers.ContentType, error) {
+	if req.ContentType == "" {
+		req.ContentType = db.StoragePoolVolumeContentTypeNameFS
+	}
+
+	contentType, err := storagePools.VolumeContentTypeNameToContentType(req.ContentType)
+	if err != nil {
+		return "", err
+	}
+
+	if contentType != storageDrivers.ContentTypeFS && req.Source.Type != "" {
+		return "", fmt.Errorf("Only empty custom volumes can be created as block volumes")
+	}
+
+	return contentType, nil
+}
+
+// storagePoolVolumeWarnings returns the keys of the config of a new custom volume which the pool
+// accepts but won't apply. Copies get the config of their source volume unless one is supplied.
+func storagePoolVolumeWarnings(d *Daemon, pool storagePools.Pool, req *api.StorageVolumesPost, contentType storageDrivers.ContentType) []api.StorageVolumeWarning {
+	config := req.Config
+
+	if req.Source.Name != "" {
+		srcPoolID, err := d.cluster.StoragePoolGetID(req.Source.Pool)
+		if err != nil {
+			// Missing source volumes are reported by the copy itself.
+			return []api.StorageVolumeWarning{}
+		}
+
+		_, srcVol, err := d.cluster.StoragePoolNodeVolumeGetTypeByProject("default", req.Source.Name, db.StoragePoolVolumeTypeCustom, srcPoolID)
+		if err != nil {
+			return []api.StorageVolumeWarning{}
+		}
+
+		if config == nil {
+			config = srcVol.Config
+		}
+
+		contentType, err = storagePools.VolumeContentTypeNameToContentType(srcVol.ContentType)
+		if err != nil {
+			return []api.StorageVolumeWarning{}
+		}
+	}
+
+	return pool.CustomVolumeWarnings(req.Name, config, contentType)
+}
+
 func storagePoolVolumeDBCreateInternal(state *state.State, poolName string, vol *api.StorageVolumesPost) (storage, error) {
 	volumeName := vol.Name
 	volumeDescription := vol.Description
@@ -526,7 +647,7 @@ func storagePoolVolumeDBCreateInternal(state *state.State, poolName string, vol
 	}
 
 	// Create database entry for new storage volume.
-	err := storagePools.VolumeDBCreate(state, poolName, volumeName, volumeDescription, volumeTypeName, false, volumeConfig)
+	err := storagePools.VolumeDBCreate(state, poolName, volumeName, volumeDescription, volumeTypeName, false, volumeConfig, storageDrivers.ContentTypeFS)
 	if err != nil {
 		return nil, err
 	}
@@ -635,7 +756,7 @@ func storagePoolVolumeSnapshotCopyInternal(state *state.State, poolName string,
 
 func storagePoolVolumeSnapshotDBCreateInternal(state *state.State, dbArgs *db.StorageVolumeArgs) (storage, error) {
 	// Create database entry for new storage volume.
-	err := storagePools.VolumeDBCreate(state, dbArgs.PoolName, dbArgs.Name, dbArgs.Description, dbArgs.TypeName, true, dbArgs.Config)
+	err := storagePools.VolumeDBCreate(state, dbArgs.PoolName, dbArgs.Name, dbArgs.Description, dbArgs.TypeName, true, dbArgs.Config, storageDrivers.ContentTypeFS)
 	if err != nil {
 		return nil, err
 	}
@@ -661,3 +782,178 @@ func storagePoolVolumeSnapshotDBCreateInternal(state *state.State, dbArgs *db.St
 
 	return s, nil
 }
+
+// profileDiskVolumesCheck checks the additional disks of a profile which are new or point to a
+// different volume than in oldDevices. Their custom volume must exist on the pool, on any cluster
+// member since the profile may be used anywhere, and be allowed for instances of the project.
+func profileDiskVolumesCheck(s *state.State, project string, oldDevices map[string]map[string]string, newDevices map[string]map[string]string) error {
+	for name, dev := range newDevices {
+		if dev["type"] != "disk" || dev["pool"] == "" || dev["source"] == "" || dev["path"] == "/" {
+			continue
+		}
+
+		oldDev, ok := oldDevices[name]
+		if ok && oldDev["type"] == "disk" && oldDev["pool"] == dev["pool"] && oldDev["source"] == dev["source"] {
+			continue
+		}
+
+		// Missing pools are reported when validating the devices.
+		poolID, err := s.Cluster.StoragePoolGetID(dev["pool"])
+		if err == db.ErrNoSuchObject {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		vols, err := s.Cluster.StoragePoolVolumesGet("default", poolID, []int{storagePoolVolumeTypeCustom})
+		if err != nil && err != db.ErrNoSuchObject {
+			return err
+		}
+
+		var vol *api.StorageVolume
+		for _, v := range vols {
+			if v.Name == filepath.Clean(dev["source"]) {
+				vol = v
+				break
+			}
+		}
+
+		if vol == nil {
+			return fmt.Errorf("Storage volume %q doesn't exist on storage pool %q", dev["source"], dev["pool"])
+		}
+
+		if !storagePools.VolumeProjectAllowed(vol.Config, project) {
+			return fmt.Errorf("Storage volume %q can't be attached to instances of project %q", dev["source"], project)
+		}
+	}
+
+	return nil
+}
+
+// instanceDiskVolumesCheck checks the additional disks of an instance about to be created on this
+// node from a copy, a migration or a backup, whether they are declared on the instance or come
+// from its profiles. Their custom volume must exist on this node and be allowed for instances of
+// the project, so that the creation fails right away rather than when the instance first starts.
+func instanceDiskVolumesCheck(s *state.State, project string, profileNames []string, devices deviceConfig.Devices) error {
+	profiles, err := s.Cluster.ProfilesGet(project, profileNames)
+	if err != nil {
+		return err
+	}
+
+	for _, dev := range db.ProfilesExpandDevices(devices, profiles) {
+		if dev["type"] != "disk" || dev["pool"] == "" || dev["source"] == "" || dev["path"] == "/" {
+			continue
+		}
+
+		poolID, err := s.Cluster.StoragePoolGetID(dev["pool"])
+		if err == db.ErrNoSuchObject {
+			return fmt.Errorf("The %q storage pool doesn't exist", dev["pool"])
+		} else if err != nil {
+			return err
+		}
+
+		_, vol, err := s.Cluster.StoragePoolNodeVolumeGetType(filepath.Clean(dev["source"]), storagePoolVolumeTypeCustom, poolID)
+		if err == db.ErrNoSuchObject {
+			return fmt.Errorf("Storage volume %q doesn't exist on storage pool %q on this node", dev["source"], dev["pool"])
+		} else if err != nil {
+			return err
+		}
+
+		if !storagePools.VolumeProjectAllowed(vol.Config, project) {
+			return fmt.Errorf("Storage volume %q can't be attached to instances of project %q", dev["source"], project)
+		}
+	}
+
+	return nil
+}
+
+// storagePoolVolumeAttachCheck checks that the client making the request may attach the custom
+// storage volumes used by the disk devices which are new or point to a different volume than in
+// oldDevices, returning a response if it may not.
+func storagePoolVolumeAttachCheck(d *Daemon, r *http.Request, oldDevices map[string]map[string]string, newDevices map[string]map[string]string) response.Response {
+	_, username, protocol, err := d.Authenticate(r)
+	if err != nil {
+		return response.Forbidden(err)
+	}
+
+	// Local clients and other cluster members (forwarding requests they checked) aren't
+	// restricted.
+	if shared.StringInSlice(protocol, []string{"unix", "cluster"}) {
+		return nil
+	}
+
+	// Only TLS clients are identified by the fingerprint of their certificate.
+	fingerprint := ""
+	if protocol == "tls" {
+		fingerprint = username
+	}
+
+	for name, dev := range newDevices {
+		if dev["type"] != "disk" || dev["pool"] == "" || dev["source"] == "" || dev["path"] == "/" {
+			continue
+		}
+
+		oldDev, ok := oldDevices[name]
+		if ok && oldDev["type"] == "disk" && oldDev["pool"] == dev["pool"] && oldDev["source"] == dev["source"] {
+			continue
+		}
+
+		// Missing pools and volumes are reported when validating the devices.
+		poolID, err := d.cluster.StoragePoolGetID(dev["pool"])
+		if err == db.ErrNoSuchObject {
+			continue
+		} else if err != nil {
+			return response.SmartError(err)
+		}
+
+		_, vol, err := d.cluster.StoragePoolNodeVolumeGetType(dev["source"], storagePoolVolumeTypeCustom, poolID)
+		if err == db.ErrNoSuchObject {
+			continue
+		} else if err != nil {
+			return response.SmartError(err)
+		}
+
+		if !storagePools.VolumeCertificateAllowed(vol.Config, fingerprint) {
+			return response.Forbidden(fmt.Errorf("Not allowed to attach storage volume %q", dev["source"]))
+		}
+	}
+
+	return nil
+}
+
+// instanceUpdateAttachCheck checks that the client may attach the custom storage volumes used by
+// the devices of an instance update request (PUT or PATCH). The request body is left in place, so
+// that the request can still be handled or forwarded to the node hosting the instance.
+func instanceUpdateAttachCheck(d *Daemon, r *http.Request, project string, name string) response.Response {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// Malformed requests are rejected when handled.
+	req := api.InstancePut{}
+	err = json.Unmarshal(body, &req)
+	if err != nil || req.Devices == nil {
+		return nil
+	}
+
+	var oldDevices map[string]map[string]string
+	err = d.cluster.Transaction(func(tx *db.ClusterTx) error {
+		inst, err := tx.InstanceGet(project, name)
+		if err != nil {
+			return err
+		}
+
+		oldDevices = inst.Devices
+		return nil
+	})
+	if err == db.ErrNoSuchObject {
+		return nil
+	} else if err != nil {
+		return response.SmartError(err)
+	}
+
+	return storagePoolVolumeAttachCheck(d, r, oldDevices, req.Devices)
+}
@@ -437,6 +437,11 @@ func (s *storageZfs) StoragePoolVolumeCreate() error {
 		return err
 	}
 
+	err = zfsPoolVolumeApplyProperties(poolName, fs, s.volume.Config, nil)
+	if err != nil {
+		return err
+	}
+
 	if !shared.IsMountPoint(customPoolVolumeMntPoint) {
 		err := zfsMount(poolName, fs)
 		if err != nil {
@@ -513,10 +518,13 @@ func (s *storageZfs) StoragePoolVolumeDelete() error {
 				return err
 			}
 
-			err = zfsPoolVolumeRename(poolName, fs, fmt.Sprintf("deleted/custom/%s", uuid.NewRandom().String()), true)
+			deletedFs := fmt.Sprintf("deleted/custom/%s", uuid.NewRandom().String())
+			err = zfsPoolVolumeRename(poolName, fs, deletedFs, true)
 			if err != nil {
 				return err
 			}
+
+			s.promoteDependentsBackground(deletedFs)
 		}
 	}
 
@@ -648,6 +656,7 @@ func (s *storageZfs) StoragePoolUpdate(writable *api.StoragePoolPut, changedConf
 	// "rsync.bwlimit" requires no on-disk modifications.
 	// "volume.zfs.remove_snapshots" requires no on-disk modifications.
 	// "volume.zfs.use_refquota" requires no on-disk modifications.
+	// "zfs.promote_clones" requires no on-disk modifications.
 
 	logger.Infof(`Updated ZFS storage pool "%s"`, s.pool.Name)
 	return nil
@@ -703,6 +712,16 @@ func (s *storageZfs) StoragePoolVolumeUpdate(writable *api.StorageVolumePut, cha
 		return updateStoragePoolVolumeError(unchangeable, "zfs")
 	}
 
+	fs := fmt.Sprintf("custom/%s", s.volume.Name)
+	if s.volume.Type == storagePoolVolumeTypeNameContainer {
+		fs = fmt.Sprintf("containers/%s", s.volume.Name)
+	}
+
+	err := zfsPoolVolumeApplyProperties(s.getOnDiskPoolName(), fs, writable.Config, changedConfig)
+	if err != nil {
+		return err
+	}
+
 	if shared.StringInSlice("size", changedConfig) {
 		if s.volume.Type != storagePoolVolumeTypeNameCustom {
 			return updateStoragePoolVolumeError([]string{"size"}, "zfs")
@@ -812,6 +831,56 @@ func (s *storageZfs) ContainerUmount(c Instance, path string) (bool, error) {
 	return ourUmount, nil
 }
 
+// ContainerDelegate hands a child dataset of the container's dataset over to its user namespace
+// when "zfs.delegate" is enabled, so that it can create and manage its own datasets under it. The
+// dataset of the container itself stays under the control of LXD.
+func (s *storageZfs) ContainerDelegate(c Instance) error {
+	delegate := s.pool.Config["volume.zfs.delegate"]
+	if s.volume.Config["zfs.delegate"] != "" {
+		delegate = s.volume.Config["zfs.delegate"]
+	}
+
+	if !shared.IsTrue(delegate) {
+		return nil
+	}
+
+	if c.IsPrivileged() {
+		return fmt.Errorf("ZFS delegation requires an unprivileged container")
+	}
+
+	err := zfsDelegateSupported()
+	if err != nil {
+		return err
+	}
+
+	poolName := s.getOnDiskPoolName()
+	fs := zfsDelegatedDataset(c.Project(), c.Name())
+
+	// The delegated dataset is only ever mounted by the container, never on the host.
+	if !zfsFilesystemEntityExists(poolName, fs) {
+		_, err = zfsPoolVolumeCreate(fmt.Sprintf("%s/%s", poolName, fs), "mountpoint=none", "zoned=on")
+		if err != nil {
+			return err
+		}
+	}
+
+	return zfsPoolVolumeZone(poolName, fs, fmt.Sprintf("/proc/%d/ns/user", c.InitPID()))
+}
+
+// ContainerUndelegate takes the delegated dataset of the container back from its user namespace
+// as the container stops, so that it can be delegated to the next one. The user namespace is given
+// as the path of one of its file descriptors, as the container's init process is gone by then.
+func (s *storageZfs) ContainerUndelegate(c Instance, userns string) error {
+	poolName := s.getOnDiskPoolName()
+	fs := zfsDelegatedDataset(c.Project(), c.Name())
+
+	if userns == "" || !zfsFilesystemEntityExists(poolName, fs) {
+		return nil
+	}
+
+	return zfsPoolVolumeUnzone(poolName, fs, userns)
+}
+
 // Things we do have to care about
 func (s *storageZfs) ContainerStorageReady(container Instance) bool {
 	volumeName := project.Prefix(container.Project(), container.Name())
@@ -895,6 +964,11 @@ func (s *storageZfs) ContainerCreateFromImage(container Instance, fingerprint st
 		s.ContainerDelete(container)
 	}()
 
+	err = zfsPoolVolumeApplyProperties(poolName, fs, s.volume.Config, nil)
+	if err != nil {
+		return err
+	}
+
 	ourMount, err := s.ContainerMount(container)
 	if err != nil {
 		return err
@@ -1384,6 +1458,127 @@ func (s *storageZfs) ContainerCopy(target Instance, source Instance, containerOn
 	return nil
 }
 
+// ContainerClone creates the target container as a ZFS clone of the current state of the source.
+func (s *storageZfs) ContainerClone(target Instance, source Instance) error {
+	logger.Debugf("Cloning ZFS container storage %s to %s", source.Name(), target.Name())
+
+	ourStart, err := source.StorageStart()
+	if err != nil {
+		return err
+	}
+	if ourStart {
+		defer source.StorageStop()
+	}
+
+	return s.copyWithoutSnapshotsSparse(target, source)
+}
+
+// ContainerFlatten replaces the dataset of a cloned container with a full copy of itself (along
+// with its snapshots), so that it no longer depends on its origin. The container must be stopped.
+func (s *storageZfs) ContainerFlatten(c Instance) error {
+	poolName := s.getOnDiskPoolName()
+	fs := fmt.Sprintf("containers/%s", project.Prefix(c.Project(), c.Name()))
+
+	origin, err := zfsFilesystemEntityPropertyGet(poolName, fs, "origin")
+	if err != nil {
+		return err
+	}
+
+	if origin == "-" {
+		return nil
+	}
+	origin = strings.TrimPrefix(origin, fmt.Sprintf("%s/", poolName))
+
+	if c.IsRunning() {
+		return fmt.Errorf("The container must be stopped to be flattened")
+	}
+
+	logger.Debugf("Flattening ZFS container storage %s", c.Name())
+
+	mountpoint, err := zfsFilesystemEntityPropertyGet(poolName, fs, "mountpoint")
+	if err != nil {
+		return err
+	}
+
+	snapshotName := fmt.Sprintf("flatten-%s", uuid.NewRandom().String())
+	err = zfsPoolVolumeSnapshotCreate(poolName, fs, snapshotName)
+	if err != nil {
+		return err
+	}
+
+	tmpFs := fmt.Sprintf("%s.flatten", fs)
+	revert := true
+	defer func() {
+		if !revert {
+			return
+		}
+
+		zfsPoolVolumeSnapshotDestroy(poolName, fs, snapshotName)
+		if zfsFilesystemEntityExists(poolName, tmpFs) {
+			zfsPoolVolumeDestroy(poolName, tmpFs)
+		}
+	}()
+
+	zfsSendCmd := exec.Command("zfs", "send", "-R", fmt.Sprintf("%s/%s@%s", poolName, fs, snapshotName))
+	zfsRecvCmd := exec.Command("zfs", "receive", "-u", fmt.Sprintf("%s/%s", poolName, tmpFs))
+
+	zfsRecvCmd.Stdin, _ = zfsSendCmd.StdoutPipe()
+	zfsRecvCmd.Stdout = os.Stdout
+	zfsRecvCmd.Stderr = os.Stderr
+
+	err = zfsRecvCmd.Start()
+	if err != nil {
+		return err
+	}
+
+	err = zfsSendCmd.Run()
+	if err != nil {
+		return err
+	}
+
+	err = zfsRecvCmd.Wait()
+	if err != nil {
+		return err
+	}
+
+	// The container may have been started while the copy was running.
+	if c.IsRunning() {
+		return fmt.Errorf("The container must be stopped to be flattened")
+	}
+
+	err = zfsPoolVolumeDestroy(poolName, fs)
+	if err != nil {
+		return err
+	}
+
+	// From this point on the clone is gone, so there's nothing left to revert to.
+	revert = false
+
+	err = zfsPoolVolumeRename(poolName, tmpFs, fs, false)
+	if err != nil {
+		return err
+	}
+
+	err = zfsPoolVolumeSet(poolName, fs, "mountpoint", mountpoint)
+	if err != nil {
+		return err
+	}
+
+	err = zfsPoolVolumeSnapshotDestroy(poolName, fs, snapshotName)
+	if err != nil {
+		logger.Warnf("Failed to delete temporary ZFS snapshot \"%s@%s\", manual cleanup needed", fs, snapshotName)
+	}
+
+	// Remove the snapshot the clone was created from if nothing else depends on it anymore.
+	err = zfsPoolVolumeCleanup(poolName, origin)
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("Flattened ZFS container storage %s", c.Name())
+	return nil
+}
+
 func (s *storageZfs) ContainerRefresh(target Instance, source Instance, snapshots []Instance) error {
 	logger.Debugf("Refreshing ZFS container storage for %s from %s", target.Name(), source.Name())
 
@@ -2467,6 +2662,8 @@ func (s *storageZfs) ImageDelete(fingerprint string) error {
 			if err := zfsPoolVolumeRename(poolName, fs, fmt.Sprintf("deleted/%s", fs), true); err != nil {
 				return err
 			}
+
+			s.promoteDependentsBackground(fmt.Sprintf("deleted/%s", fs))
 		}
 	}
 
@@ -2515,7 +2712,7 @@ func (s *storageZfs) MigrationSource(args MigrationSourceArgs) (MigrationStorage
 	* to send anything else, because that's all the user asked for.
 	 */
 	if args.Instance.IsSnapshot() {
-		return &zfsMigrationSourceDriver{instance: args.Instance, zfs: s, zfsFeatures: args.ZfsFeatures}, nil
+		return &zfsMigrationSourceDriver{instance: args.Instance, zfs: s, zfsFeatures: args.ZfsFeatures, checksum: args.Checksum}, nil
 	}
 
 	driver := zfsMigrationSourceDriver{
@@ -2524,6 +2721,7 @@ func (s *storageZfs) MigrationSource(args MigrationSourceArgs) (MigrationStorage
 		zfsSnapshotNames: []string{},
 		zfs:              s,
 		zfsFeatures:      args.ZfsFeatures,
+		checksum:         args.Checksum,
 	}
 
 	if args.InstanceOnly {
@@ -2549,6 +2747,10 @@ func (s *storageZfs) MigrationSource(args MigrationSourceArgs) (MigrationStorage
 			continue
 		}
 
+		if !migrationSnapshotSelected(args.Snapshots, snap[len("snapshot-"):]) {
+			continue
+		}
+
 		lxdName := fmt.Sprintf("%s%s%s", args.Instance.Name(), shared.SnapshotDelimiter, snap[len("snapshot-"):])
 		snapshot, err := instanceLoadByProjectAndName(s.s, args.Instance.Project(), lxdName)
 		if err != nil {
@@ -2565,6 +2767,7 @@ func (s *storageZfs) MigrationSource(args MigrationSourceArgs) (MigrationStorage
 func (s *storageZfs) MigrationSink(conn *websocket.Conn, op *operations.Operation, args MigrationSinkArgs) error {
 	poolName := s.getOnDiskPoolName()
 	zfsName := fmt.Sprintf("containers/%s", project.Prefix(args.Instance.Project(), args.Instance.Name()))
+	checksum := args.Checksum
 	zfsRecv := func(zfsName string, writeWrapper func(io.WriteCloser) io.WriteCloser) error {
 		zfsFsName := fmt.Sprintf("%s/%s", poolName, zfsName)
 		args := []string{"receive", "-F", "-o", "canmount=noauto", "-o", "mountpoint=none", "-u", zfsFsName}
@@ -2589,7 +2792,7 @@ func (s *storageZfs) MigrationSink(conn *websocket.Conn, op *operations.Operatio
 			writePipe = writeWrapper(stdin)
 		}
 
-		<-shared.WebsocketRecvStream(writePipe, conn)
+		<-shared.WebsocketRecvStream(checksum.Writer(writePipe), conn)
 
 		output, err := ioutil.ReadAll(stderr)
 		if err != nil {
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pborman/uuid"
@@ -17,6 +18,7 @@ import (
 	driver "github.com/lxc/lxd/lxd/storage"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/version"
 )
 
 // zfsIsEnabled returns whether zfs backend is supported.
@@ -503,6 +505,105 @@ func zfsPoolVolumeSnapshotRename(pool string, path string, oldName string, newNa
 	return nil
 }
 
+// zfsVolumeProperties maps the volume configuration keys which are passed through to the
+// dataset to the matching ZFS property.
+var zfsVolumeProperties = map[string]string{
+	"zfs.atime":      "atime",
+	"zfs.logbias":    "logbias",
+	"zfs.recordsize": "recordsize",
+	"zfs.sync":       "sync",
+}
+
+// zfsPoolVolumeApplyProperties sets the ZFS properties matching the given configuration keys
+// (or all those set in the configuration if nil) on the dataset. Unset keys have the property
+// inherited again from the parent dataset.
+func zfsPoolVolumeApplyProperties(pool string, path string, config map[string]string, keys []string) error {
+	if keys == nil {
+		for key := range config {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		property, ok := zfsVolumeProperties[key]
+		if !ok {
+			continue
+		}
+
+		value := config[key]
+		if value == "" {
+			_, err := shared.RunCommand("zfs", "inherit", property, fmt.Sprintf("%s/%s", pool, path))
+			if err != nil {
+				return errors.Wrapf(err, "Failed to reset ZFS property %q", property)
+			}
+
+			continue
+		}
+
+		// Boolean properties use on/off.
+		if property == "atime" {
+			value = "off"
+			if shared.IsTrue(config[key]) {
+				value = "on"
+			}
+		}
+
+		err := zfsPoolVolumeSet(pool, path, property, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// zfsDelegateSupported checks that the ZFS kernel module supports delegating datasets to
+// user namespaces (added in 2.2).
+func zfsDelegateSupported() error {
+	out, err := zfsModuleVersionGet()
+	if err != nil {
+		return err
+	}
+
+	current, err := version.Parse(out)
+	if err != nil {
+		return err
+	}
+
+	minimum, _ := version.NewDottedVersion("2.2")
+	if current.Compare(minimum) < 0 {
+		return fmt.Errorf("ZFS delegation requires ZFS 2.2 or later, found %s", current)
+	}
+
+	return nil
+}
+
+// zfsDelegatedDataset returns the path of the dataset delegated to a container, relative to the
+// pool.
+func zfsDelegatedDataset(projectName string, containerName string) string {
+	return fmt.Sprintf("containers/%s/delegated", project.Prefix(projectName, containerName))
+}
+
+// zfsPoolVolumeZone attaches the dataset to the given user namespace.
+func zfsPoolVolumeZone(pool string, path string, userns string) error {
+	_, err := shared.RunCommand("zfs", "zone", userns, fmt.Sprintf("%s/%s", pool, path))
+	if err != nil {
+		return errors.Wrap(err, "Failed to delegate ZFS dataset")
+	}
+
+	return nil
+}
+
+// zfsPoolVolumeUnzone detaches the dataset from the given user namespace.
+func zfsPoolVolumeUnzone(pool string, path string, userns string) error {
+	_, err := shared.RunCommand("zfs", "unzone", userns, fmt.Sprintf("%s/%s", pool, path))
+	if err != nil {
+		return errors.Wrap(err, "Failed to take back delegated ZFS dataset")
+	}
+
+	return nil
+}
+
 func zfsMount(poolName string, path string) error {
 	_, err := shared.TryRunCommand(
 		"zfs",
@@ -618,6 +719,82 @@ func zfsPoolVolumeSnapshotRemovable(pool string, path string, name string) (bool
 	return false, nil
 }
 
+// zfsPoolVolumePromoteDependents promotes the clone of the most recent snapshot of a deleted
+// dataset which still has clones. This moves the snapshots the clones depend on over to the
+// promoted clone, so that the deleted dataset can be destroyed. The moved snapshots are then
+// destroyed too if nothing depends on them anymore.
+func zfsPoolVolumePromoteDependents(pool string, path string) error {
+	snaps, err := zfsPoolListSnapshots(pool, path)
+	if err != nil {
+		return err
+	}
+
+	for i := len(snaps) - 1; i >= 0; i-- {
+		clones, err := zfsFilesystemEntityPropertyGet(pool, fmt.Sprintf("%s@%s", path, snaps[i]), "clones")
+		if err != nil {
+			return err
+		}
+
+		if clones == "-" || clones == "" {
+			continue
+		}
+
+		clone := strings.Split(clones, ",")[0]
+		_, err = shared.RunCommand("zfs", "promote", clone)
+		if err != nil {
+			return errors.Wrap(err, "Failed to promote ZFS clone")
+		}
+
+		err = zfsPoolVolumeDestroy(pool, path)
+		if err != nil {
+			return err
+		}
+
+		clonePath := strings.TrimPrefix(clone, fmt.Sprintf("%s/", pool))
+		for _, snap := range snaps[:i+1] {
+			removable, err := zfsPoolVolumeSnapshotRemovable(pool, clonePath, snap)
+			if err != nil || !removable {
+				continue
+			}
+
+			err = zfsPoolVolumeSnapshotDestroy(pool, clonePath, snap)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// Nothing depends on the dataset anymore.
+	return zfsPoolVolumeCleanup(pool, path)
+}
+
+var zfsPromoteLock sync.Mutex
+
+// promoteDependentsBackground promotes in the background the clones depending on a dataset
+// which was just moved under "deleted/", if "zfs.promote_clones" is enabled on the pool.
+func (s *storageZfs) promoteDependentsBackground(path string) {
+	if !shared.IsTrue(s.pool.Config["zfs.promote_clones"]) {
+		return
+	}
+
+	poolName := s.getOnDiskPoolName()
+
+	go func() {
+		zfsPromoteLock.Lock()
+		defer zfsPromoteLock.Unlock()
+
+		err := zfsPoolVolumePromoteDependents(poolName, path)
+		if err != nil {
+			logger.Errorf("Failed to promote the clones of ZFS dataset \"%s/%s\": %v", poolName, path, err)
+			return
+		}
+
+		logger.Debugf("Promoted the clones of ZFS dataset \"%s/%s\"", poolName, path)
+	}()
+}
+
 func zfsFilesystemEntityExists(pool string, path string) bool {
 	vdev := pool
 	if path != "" {
@@ -713,6 +890,16 @@ func (s *storageZfs) doContainerDelete(projectName, name string) error {
 	containerPoolVolumeMntPoint := driver.GetContainerMountPoint(projectName, s.pool.Name, containerName)
 
 	if zfsFilesystemEntityExists(poolName, fs) {
+		// The dataset delegated to the container holds the container's data, so it goes
+		// along with it. It's destroyed directly as its mountpoint is one of the container.
+		delegated := zfsDelegatedDataset(projectName, containerName)
+		if zfsFilesystemEntityExists(poolName, delegated) {
+			_, err := shared.TryRunCommand("zfs", "destroy", "-r", fmt.Sprintf("%s/%s", poolName, delegated))
+			if err != nil {
+				return errors.Wrap(err, "Failed to destroy delegated ZFS dataset")
+			}
+		}
+
 		removable := true
 		snaps, err := zfsPoolListSnapshots(poolName, fs)
 		if err != nil {
@@ -754,10 +941,13 @@ func (s *storageZfs) doContainerDelete(projectName, name string) error {
 				return err
 			}
 
-			err = zfsPoolVolumeRename(poolName, fs, fmt.Sprintf("deleted/containers/%s", uuid.NewRandom().String()), true)
+			deletedFs := fmt.Sprintf("deleted/containers/%s", uuid.NewRandom().String())
+			err = zfsPoolVolumeRename(poolName, fs, deletedFs, true)
 			if err != nil {
 				return err
 			}
+
+			s.promoteDependentsBackground(deletedFs)
 		}
 	}
 
@@ -815,6 +1005,11 @@ func (s *storageZfs) doContainerCreate(projectName, name string, privileged bool
 		return err
 	}
 
+	err = zfsPoolVolumeApplyProperties(poolName, fs, s.volume.Config, nil)
+	if err != nil {
+		return err
+	}
+
 	err = driver.CreateContainerMountpoint(containerPoolVolumeMntPoint, containerPath, privileged)
 	if err != nil {
 		return err
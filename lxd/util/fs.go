@@ -1,8 +1,12 @@
 package util
 
 import (
+	"os"
+	"path/filepath"
+
 	"golang.org/x/sys/unix"
 
+	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/logger"
 )
 
@@ -42,3 +46,134 @@ func FilesystemDetect(path string) (string, error) {
 		return string(fs.Type), nil
 	}
 }
+
+// DiffTrees compares two directory trees, typically two snapshots of the same
+// filesystem, and returns the paths relative to their roots which were added
+// or changed in the new tree, and the ones which were removed from the old
+// one. Files are compared by type, mode, ownership, size, modification time
+// and symlink target, without reading their content.
+//
+// The content of removed directories isn't listed. A path whose type changed
+// is listed in both.
+func DiffTrees(oldPath string, newPath string) ([]string, []string, error) {
+	changed := []string{}
+	removed := []string{}
+
+	err := filepath.Walk(newPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(newPath, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		oldFi, err := os.Lstat(filepath.Join(oldPath, relPath))
+		if err != nil {
+			if os.IsNotExist(err) {
+				changed = append(changed, relPath)
+				return nil
+			}
+
+			return err
+		}
+
+		if oldFi.Mode()&os.ModeType != fi.Mode()&os.ModeType {
+			removed = append(removed, relPath)
+			changed = append(changed, relPath)
+			return nil
+		}
+
+		same, err := sameFile(filepath.Join(oldPath, relPath), oldFi, path, fi)
+		if err != nil {
+			return err
+		}
+
+		if !same {
+			changed = append(changed, relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = filepath.Walk(oldPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(oldPath, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		_, err = os.Lstat(filepath.Join(newPath, relPath))
+		if err == nil || !os.IsNotExist(err) {
+			return err
+		}
+
+		removed = append(removed, relPath)
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return changed, removed, nil
+}
+
+// Checks whether two files of the same type have the same metadata.
+func sameFile(oldPath string, oldFi os.FileInfo, newPath string, newFi os.FileInfo) (bool, error) {
+	if oldFi.Mode() != newFi.Mode() || !oldFi.ModTime().Equal(newFi.ModTime()) {
+		return false, nil
+	}
+
+	if newFi.Mode().IsRegular() && oldFi.Size() != newFi.Size() {
+		return false, nil
+	}
+
+	oldUID, oldGID, oldMajor, oldMinor, _, _, err := shared.GetFileStat(oldPath)
+	if err != nil {
+		return false, err
+	}
+
+	newUID, newGID, newMajor, newMinor, _, _, err := shared.GetFileStat(newPath)
+	if err != nil {
+		return false, err
+	}
+
+	if oldUID != newUID || oldGID != newGID || oldMajor != newMajor || oldMinor != newMinor {
+		return false, nil
+	}
+
+	if newFi.Mode()&os.ModeSymlink == os.ModeSymlink {
+		oldTarget, err := os.Readlink(oldPath)
+		if err != nil {
+			return false, err
+		}
+
+		newTarget, err := os.Readlink(newPath)
+		if err != nil {
+			return false, err
+		}
+
+		return oldTarget == newTarget, nil
+	}
+
+	return true, nil
+}
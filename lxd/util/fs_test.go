@@ -0,0 +1,66 @@
+package util_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxd/lxd/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Added, changed and removed files are detected, unchanged ones are skipped.
+func TestDiffTrees(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxd-util-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldPath := filepath.Join(dir, "old")
+	newPath := filepath.Join(dir, "new")
+	now := time.Now()
+
+	files := func(root string, content map[string]string) {
+		for name, data := range content {
+			path := filepath.Join(root, name)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			if data == "/" {
+				require.NoError(t, os.MkdirAll(path, 0755))
+			} else {
+				require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+			}
+		}
+
+		// Give all the files the same modification time, so that only the
+		// other changes are detected.
+		require.NoError(t, filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			require.NoError(t, err)
+			return os.Chtimes(path, now, now)
+		}))
+	}
+
+	files(oldPath, map[string]string{
+		"same":       "same",
+		"dir/change": "old",
+		"gone/file":  "gone",
+		"type":       "file",
+	})
+
+	files(newPath, map[string]string{
+		"same":       "same",
+		"dir/change": "new!",
+		"dir/add":    "add",
+		"type":       "/",
+	})
+
+	changed, removed, err := util.DiffTrees(oldPath, newPath)
+	require.NoError(t, err)
+
+	sort.Strings(changed)
+	sort.Strings(removed)
+	assert.Equal(t, []string{"dir/add", "dir/change", "type"}, changed)
+	assert.Equal(t, []string{"gone", "type"}, removed)
+}
@@ -34,16 +34,25 @@ import (
 	storagePools "github.com/lxc/lxd/lxd/storage"
 	"github.com/lxc/lxd/lxd/util"
 	"github.com/lxc/lxd/lxd/vsock"
+	"github.com/lxc/lxd/lxd/webhook"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	log "github.com/lxc/lxd/shared/log15"
-	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/logging"
 	"github.com/lxc/lxd/shared/osarch"
 	"github.com/lxc/lxd/shared/units"
 )
 
 var vmVsockTimeout time.Duration = time.Second
 
+// vmPCISlots is the number of PCIe slots given to the custom volumes of virtual machines, which
+// are all set up when qemu starts so that disks can be hotplugged in the free ones.
+const vmPCISlots = 8
+
+// qemuLogger tags the messages about virtual machines, so that their log level can be set with the
+// core.log_level.qemu config key.
+var qemuLogger = logging.Subsystem("qemu")
+
 func vmQemuLoad(s *state.State, args db.InstanceArgs, profiles []api.Profile) (Instance, error) {
 	// Create the container struct.
 	vm := vmQemuInstantiate(s, args)
@@ -147,7 +156,7 @@ func vmQemuCreate(s *state.State, args db.InstanceArgs) (Instance, error) {
 		"ephemeral": vm.ephemeral,
 	}
 
-	logger.Info("Creating instance", ctxMap)
+	qemuLogger.Info("Creating instance", ctxMap)
 
 	revert := true
 	defer func() {
@@ -161,20 +170,20 @@ func vmQemuCreate(s *state.State, args db.InstanceArgs) (Instance, error) {
 	// Load the config.
 	err := vm.init()
 	if err != nil {
-		logger.Error("Failed creating instance", ctxMap)
+		qemuLogger.Error("Failed creating instance", ctxMap)
 		return nil, err
 	}
 
 	// Validate expanded config
 	err = containerValidConfig(s.OS, vm.expandedConfig, false, true)
 	if err != nil {
-		logger.Error("Failed creating instance", ctxMap)
+		qemuLogger.Error("Failed creating instance", ctxMap)
 		return nil, err
 	}
 
 	err = containerValidDevices(s, s.Cluster, vm.Name(), vm.expandedDevices, true)
 	if err != nil {
-		logger.Error("Failed creating instance", ctxMap)
+		qemuLogger.Error("Failed creating instance", ctxMap)
 		return nil, errors.Wrap(err, "Invalid devices")
 	}
 
@@ -204,7 +213,7 @@ func vmQemuCreate(s *state.State, args db.InstanceArgs) (Instance, error) {
 	}
 
 	// Create a new database entry for the instance's storage volume.
-	_, err = s.Cluster.StoragePoolVolumeCreate(args.Project, args.Name, "", db.StoragePoolVolumeTypeVM, false, poolID, volumeConfig)
+	_, err = s.Cluster.StoragePoolVolumeCreate(args.Project, args.Name, "", db.StoragePoolVolumeTypeVM, false, poolID, volumeConfig, db.StoragePoolVolumeContentTypeBlock)
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +222,7 @@ func vmQemuCreate(s *state.State, args db.InstanceArgs) (Instance, error) {
 		// Update MAAS.
 		err = vm.maasUpdate(nil)
 		if err != nil {
-			logger.Error("Failed creating instance", ctxMap)
+			qemuLogger.Error("Failed creating instance", ctxMap)
 			return nil, err
 		}
 
@@ -226,8 +235,8 @@ func vmQemuCreate(s *state.State, args db.InstanceArgs) (Instance, error) {
 		}
 	}
 
-	logger.Info("Created instance", ctxMap)
-	vm.state.Events.SendLifecycle(vm.project, "virtual-machine-created",
+	qemuLogger.Info("Created instance", ctxMap)
+	vm.lifecycle("virtual-machine-created",
 		fmt.Sprintf("/1.0/virtual-machines/%s", vm.name), nil)
 
 	revert = false
@@ -327,7 +336,240 @@ func (vm *vmQemu) generateAgentCert() (string, string, string, string, error) {
 	return string(agentCert), string(agentKey), string(clientCert), string(clientKey), nil
 }
 
+// Freeze pauses the execution of the VM.
 func (vm *vmQemu) Freeze() error {
+	return vm.runMonitorCommand("stop")
+}
+
+// runMonitorCommand runs a QMP command without arguments, discarding its result.
+func (vm *vmQemu) runMonitorCommand(command string) error {
+	// Connect to the monitor.
+	monitor, err := qmp.NewSocketMonitor("unix", vm.getMonitorPath(), vmVsockTimeout)
+	if err != nil {
+		return err
+	}
+
+	err = monitor.Connect()
+	if err != nil {
+		return err
+	}
+	defer monitor.Disconnect()
+
+	_, err = monitor.Run([]byte(fmt.Sprintf("{'execute': '%s'}", command)))
+	return err
+}
+
+// runMonitorCommandArgs runs a QMP command with the given arguments, returning its result.
+func (vm *vmQemu) runMonitorCommandArgs(command string, args map[string]interface{}) ([]byte, error) {
+	req, err := json.Marshal(map[string]interface{}{"execute": command, "arguments": args})
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to the monitor.
+	monitor, err := qmp.NewSocketMonitor("unix", vm.getMonitorPath(), vmVsockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = monitor.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer monitor.Disconnect()
+
+	return monitor.Run(req)
+}
+
+// runHumanMonitorCommand runs a command of the human monitor, for the operations QMP lacks. Its
+// output is only made of error messages for the commands used here.
+func (vm *vmQemu) runHumanMonitorCommand(command string) error {
+	respRaw, err := vm.runMonitorCommandArgs("human-monitor-command", map[string]interface{}{"command-line": command})
+	if err != nil {
+		return err
+	}
+
+	var respDecoded struct {
+		Return string `json:"return"`
+	}
+
+	err = json.Unmarshal(respRaw, &respDecoded)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(respDecoded.Return) != "" {
+		return fmt.Errorf("%s", strings.TrimSpace(respDecoded.Return))
+	}
+
+	return nil
+}
+
+// hotplugDrive plugs the disk of a custom block volume into a free PCIe slot of the running
+// virtual machine. The shares of custom filesystem volumes can't be hotplugged by qemu.
+func (vm *vmQemu) hotplugDrive(drive device.MountEntryItem) error {
+	if drive.FSType == "9p" {
+		return fmt.Errorf("Custom filesystem volumes can only be attached to virtual machines while they're stopped")
+	}
+
+	slot, err := vm.pciSlot(drive.DevName)
+	if err != nil {
+		return err
+	}
+
+	// Commas are escaped by doubling them in qemu options.
+	diskPath := strings.Replace(drive.DevPath, ",", ",,", -1)
+	err = vm.runHumanMonitorCommand(fmt.Sprintf("drive_add 0 file=%s,if=none,id=lxd_drive%d,format=%s,cache=none,aio=native,discard=unmap", diskPath, slot, drive.FSType))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to add the disk of device %q", drive.DevName)
+	}
+
+	_, err = vm.runMonitorCommandArgs("device_add", map[string]interface{}{
+		"driver": "virtio-blk-pci",
+		"id":     fmt.Sprintf("dev-lxd_drive%d", slot),
+		"drive":  fmt.Sprintf("lxd_drive%d", slot),
+		"bus":    fmt.Sprintf("qemu_pcie_slot%d", slot),
+		"addr":   "0x0",
+	})
+	if err != nil {
+		vm.runHumanMonitorCommand(fmt.Sprintf("drive_del lxd_drive%d", slot))
+		return errors.Wrapf(err, "Failed to plug the disk of device %q", drive.DevName)
+	}
+
+	return nil
+}
+
+// hotunplugDrive unplugs the disk of a custom block volume from the running virtual machine and
+// waits for the guest to release it, which frees its PCIe slot and drive.
+func (vm *vmQemu) hotunplugDrive(drive device.MountEntryItem) error {
+	if drive.FSType == "9p" {
+		return fmt.Errorf("Custom filesystem volumes can only be detached from virtual machines while they're stopped")
+	}
+
+	key := fmt.Sprintf("volatile.%s.pci_slot", drive.DevName)
+	slot, err := strconv.Atoi(vm.localConfig[key])
+	if err != nil {
+		return fmt.Errorf("Failed to find the PCIe slot of device %q", drive.DevName)
+	}
+
+	_, err = vm.runMonitorCommandArgs("device_del", map[string]interface{}{"id": fmt.Sprintf("dev-lxd_drive%d", slot)})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to unplug the disk of device %q", drive.DevName)
+	}
+
+	// The drive is deleted along with its device, once the guest released it.
+	for i := 0; i < 20; i++ {
+		respRaw, err := vm.runMonitorCommandArgs("query-block", map[string]interface{}{})
+		if err != nil {
+			return err
+		}
+
+		var respDecoded struct {
+			Return []struct {
+				Device string `json:"device"`
+			} `json:"return"`
+		}
+
+		err = json.Unmarshal(respRaw, &respDecoded)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, block := range respDecoded.Return {
+			if block.Device == fmt.Sprintf("lxd_drive%d", slot) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return vm.VolatileSet(map[string]string{key: ""})
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("The virtual machine didn't release the disk of device %q", drive.DevName)
+}
+
+// growDisk lets the running virtual machine see the new size of one of its disks, given by the path
+// of the disk on the host. The storage has already grown disks which are raw block devices, while
+// the disk images QEMU holds a lock on are grown by QEMU itself.
+func (vm *vmQemu) growDisk(diskPath string, size string) error {
+	if size == "" || size == "0" {
+		return nil
+	}
+
+	sizeBytes, err := units.ParseByteSizeString(size)
+	if err != nil {
+		return err
+	}
+
+	// Connect to the monitor.
+	monitor, err := qmp.NewSocketMonitor("unix", vm.getMonitorPath(), vmVsockTimeout)
+	if err != nil {
+		return err
+	}
+
+	err = monitor.Connect()
+	if err != nil {
+		return err
+	}
+	defer monitor.Disconnect()
+
+	respRaw, err := monitor.Run([]byte("{'execute': 'query-block'}"))
+	if err != nil {
+		return err
+	}
+
+	var respDecoded struct {
+		Return []struct {
+			Device   string `json:"device"`
+			Inserted struct {
+				File  string `json:"file"`
+				Drv   string `json:"drv"`
+				Image struct {
+					VirtualSize int64 `json:"virtual-size"`
+				} `json:"image"`
+			} `json:"inserted"`
+		} `json:"return"`
+	}
+
+	err = json.Unmarshal(respRaw, &respDecoded)
+	if err != nil {
+		return err
+	}
+
+	for _, drive := range respDecoded.Return {
+		if drive.Inserted.File != diskPath {
+			continue
+		}
+
+		// Raw disks take the size the storage gave them, which may have been rounded up.
+		if drive.Inserted.Drv == "raw" {
+			f, err := os.Open(diskPath)
+			if err != nil {
+				return err
+			}
+
+			sizeBytes, err = f.Seek(0, io.SeekEnd)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		} else if sizeBytes%512 != 0 {
+			sizeBytes += 512 - sizeBytes%512
+		}
+
+		if sizeBytes <= drive.Inserted.Image.VirtualSize {
+			return nil
+		}
+
+		_, err = monitor.Run([]byte(fmt.Sprintf("{'execute': 'block_resize', 'arguments': {'device': '%s', 'size': %d}}", drive.Device, sizeBytes)))
+		return err
+	}
+
 	return nil
 }
 
@@ -385,6 +627,7 @@ func (vm *vmQemu) Shutdown(timeout time.Duration) error {
 	vm.cleanupDevices()
 	os.Remove(vm.pidFilePath())
 	os.Remove(vm.getMonitorPath())
+	vm.runPostStopHook()
 
 	return nil
 }
@@ -400,12 +643,14 @@ func (vm *vmQemu) Start(stateful bool) error {
 		return fmt.Errorf("The instance is already running")
 	}
 
-	pidFile := vm.DevicesPath() + "/qemu.pid"
-	configISOPath, err := vm.generateConfigDrive()
+	// Run the pre-start hook of the host, which may veto the start.
+	err = instanceHostHook(vm.state, vm, instanceHookPreStart, nil)
 	if err != nil {
 		return err
 	}
 
+	pidFile := vm.DevicesPath() + "/qemu.pid"
+
 	err = os.MkdirAll(vm.LogPath(), 0700)
 	if err != nil {
 		return err
@@ -440,6 +685,8 @@ func (vm *vmQemu) Start(stateful bool) error {
 	nvramFile.Close()
 
 	tapDev := map[string]string{}
+	drives := []device.MountEntryItem{}
+	shares := []device.MountEntryItem{}
 
 	// Setup devices in sorted order, this ensures that device mounts are added in path order.
 	for _, dev := range vm.expandedDevices.Sorted() {
@@ -462,9 +709,23 @@ func (vm *vmQemu) Start(stateful bool) error {
 			}
 
 		}
+
+		// Disks of custom block volumes and shares of custom filesystem volumes.
+		for _, mount := range runConf.Mounts {
+			if mount.FSType == "9p" {
+				shares = append(shares, mount)
+			} else {
+				drives = append(drives, mount)
+			}
+		}
 	}
 
-	confFile, err := vm.generateQemuConfigFile(configISOPath, tapDev)
+	configISOPath, err := vm.generateConfigDrive(shares)
+	if err != nil {
+		return err
+	}
+
+	confFile, err := vm.generateQemuConfigFile(configISOPath, tapDev, drives, shares)
 	if err != nil {
 		return err
 	}
@@ -551,6 +812,21 @@ func (vm *vmQemu) deviceStart(deviceName string, rawConfig deviceConfig.Device,
 		return nil, err
 	}
 
+	// Plug the disks of custom block volumes into the running virtual machine.
+	if isRunning && runConf != nil {
+		for _, mount := range runConf.Mounts {
+			err = vm.hotplugDrive(mount)
+			if err != nil {
+				stopConf, _ := d.Stop()
+				if stopConf != nil {
+					vm.runHooks(stopConf.PostHooks)
+				}
+
+				return nil, err
+			}
+		}
+	}
+
 	return runConf, nil
 }
 
@@ -573,7 +849,7 @@ func (vm *vmQemu) deviceStop(deviceName string, rawConfig deviceConfig.Device) e
 
 		}
 
-		logger.Errorf("Device stop validation failed for '%s': %v", deviceName, err)
+		qemuLogger.Errorf("Device stop validation failed for '%s': %v", deviceName, err)
 	}
 
 	canHotPlug, _ := d.CanHotPlug()
@@ -588,6 +864,16 @@ func (vm *vmQemu) deviceStop(deviceName string, rawConfig deviceConfig.Device) e
 		return err
 	}
 
+	// Unplug the disks of custom block volumes from the running virtual machine.
+	if runConf != nil && vm.IsRunning() {
+		for _, mount := range runConf.Mounts {
+			err = vm.hotunplugDrive(mount)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if runConf != nil {
 		// Run post stop hooks irrespective of run state of instance.
 		err = vm.runHooks(runConf.PostHooks)
@@ -622,7 +908,7 @@ func (vm *vmQemu) getNvramPath() string {
 	return vm.DevicesPath() + "/qemu.nvram"
 }
 
-func (vm *vmQemu) generateConfigDrive() (string, error) {
+func (vm *vmQemu) generateConfigDrive(shares []device.MountEntryItem) (string, error) {
 	configDrivePath := vm.Path() + "/config"
 
 	// Create config drive dir.
@@ -641,7 +927,7 @@ runcmd:
 
 	path, err := exec.LookPath("lxd-agent")
 	if err != nil {
-		logger.Warnf("lxd-agent not found, skipping its inclusion in the VM config drive: %v", err)
+		qemuLogger.Warnf("lxd-agent not found, skipping its inclusion in the VM config drive: %v", err)
 	} else {
 		// Install agent into config drive dir if found.
 		_, err = shared.RunCommand("cp", path, configDrivePath+"/lxd-agent")
@@ -720,6 +1006,32 @@ WantedBy=multi-user.target
 		return "", err
 	}
 
+	// The agent mounts the shares of custom filesystem volumes when it starts.
+	agentMounts := []instancetype.VMAgentMount{}
+	for _, share := range shares {
+		slot, err := vm.pciSlot(share.DevName)
+		if err != nil {
+			return "", err
+		}
+
+		agentMounts = append(agentMounts, instancetype.VMAgentMount{
+			Source:  fmt.Sprintf("lxd_share%d", slot),
+			Target:  share.TargetPath,
+			FSType:  share.FSType,
+			Options: append([]string{"trans=virtio"}, share.Opts...),
+		})
+	}
+
+	agentMountsJSON, err := json.Marshal(agentMounts)
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(configDrivePath+"/agent-mounts.json", agentMountsJSON, 0400)
+	if err != nil {
+		return "", err
+	}
+
 	// Get the certificates.
 	agentCert, agentKey, clientCert, _, err := vm.generateAgentCert()
 	if err != nil {
@@ -755,7 +1067,7 @@ WantedBy=multi-user.target
 }
 
 // generateQemuConfigFile writes the qemu config file and returns its location.
-func (vm *vmQemu) generateQemuConfigFile(configISOPath string, tapDev map[string]string) (string, error) {
+func (vm *vmQemu) generateQemuConfigFile(configISOPath string, tapDev map[string]string, drives []device.MountEntryItem, shares []device.MountEntryItem) (string, error) {
 	var sb *strings.Builder = &strings.Builder{}
 
 	// Base config. This is common for all VMs and has no variables in it.
@@ -831,6 +1143,11 @@ backend = "pty"
 		return "", err
 	}
 
+	err = vm.addDriveConfig(sb, drives, shares)
+	if err != nil {
+		return "", err
+	}
+
 	err = vm.addCPUConfig(sb)
 	if err != nil {
 		return "", err
@@ -973,6 +1290,7 @@ format = "%s"
 if = "none"
 cache = "none"
 aio = "native"
+discard = "unmap"
 [device "dev-lxd_root"]
 driver = "scsi-hd"
 bus = "qemu_scsi.0"
@@ -986,6 +1304,120 @@ bootindex = "1"
 	return nil
 }
 
+// addDriveConfig adds the PCIe slots of custom volumes, with the disks of custom block volumes and
+// the 9p shares of custom filesystem volumes plugged in. The remaining slots are kept for the
+// disks hotplugged later on.
+func (vm *vmQemu) addDriveConfig(sb *strings.Builder, drives []device.MountEntryItem, shares []device.MountEntryItem) error {
+	sb.WriteString(`
+# PCIe slots of custom volumes`)
+
+	for i := 0; i < vmPCISlots; i++ {
+		multifunction := ""
+		if i == 0 {
+			multifunction = "\nmultifunction = \"on\""
+		}
+
+		sb.WriteString(fmt.Sprintf(`
+[device "qemu_pcie_slot%d"]
+driver = "pcie-root-port"
+port = "0x%x"
+chassis = "%d"
+bus = "pcie.0"
+addr = "0x3.0x%d"%s`, i, 0x20+i, 6+i, i, multifunction))
+	}
+
+	sb.WriteString("\n")
+
+	for _, drive := range drives {
+		slot, err := vm.pciSlot(drive.DevName)
+		if err != nil {
+			return err
+		}
+
+		sb.WriteString(fmt.Sprintf(`
+# Drive ("%s" device)
+[drive "lxd_drive%d"]
+file = "%s"
+format = "%s"
+if = "none"
+cache = "none"
+aio = "native"
+discard = "unmap"
+[device "dev-lxd_drive%d"]
+driver = "virtio-blk-pci"
+drive = "lxd_drive%d"
+bus = "qemu_pcie_slot%d"
+addr = "0x0"
+`, drive.DevName, slot, drive.DevPath, drive.FSType, slot, slot, slot))
+	}
+
+	for _, share := range shares {
+		slot, err := vm.pciSlot(share.DevName)
+		if err != nil {
+			return err
+		}
+
+		readonly := "off"
+		if shared.StringInSlice("ro", share.Opts) {
+			readonly = "on"
+		}
+
+		sb.WriteString(fmt.Sprintf(`
+# Share ("%s" device)
+[fsdev "lxd_share%d"]
+fsdriver = "local"
+security_model = "passthrough"
+path = "%s"
+readonly = "%s"
+[device "dev-lxd_share%d"]
+driver = "virtio-9p-pci"
+fsdev = "lxd_share%d"
+mount_tag = "lxd_share%d"
+bus = "qemu_pcie_slot%d"
+addr = "0x0"
+`, share.DevName, slot, share.DevPath, readonly, slot, slot, slot, slot))
+	}
+
+	return nil
+}
+
+// pciSlot returns the PCIe slot of the disk or share of the given device, recorded in its
+// volatile pci_slot key. A device without one gets the first slot no other device uses.
+func (vm *vmQemu) pciSlot(devName string) (int, error) {
+	used := map[int]bool{}
+	for name := range vm.expandedDevices {
+		if name == devName {
+			continue
+		}
+
+		slot, err := strconv.Atoi(vm.localConfig[fmt.Sprintf("volatile.%s.pci_slot", name)])
+		if err == nil {
+			used[slot] = true
+		}
+	}
+
+	key := fmt.Sprintf("volatile.%s.pci_slot", devName)
+	slot, err := strconv.Atoi(vm.localConfig[key])
+	if err == nil && slot >= 0 && slot < vmPCISlots && !used[slot] {
+		return slot, nil
+	}
+
+	for slot := 0; slot < vmPCISlots; slot++ {
+		if used[slot] {
+			continue
+		}
+
+		err := vm.VolatileSet(map[string]string{key: strconv.Itoa(slot)})
+		if err != nil {
+			return -1, err
+		}
+
+		return slot, nil
+	}
+
+	return -1, fmt.Errorf("No PCIe slot left for device %q, at most %d custom volumes can be attached", devName, vmPCISlots)
+}
+
 func (vm *vmQemu) addConfDriveConfig(sb *strings.Builder, configISOPath string) {
 	sb.WriteString(fmt.Sprintf(`
 # Config drive (set to last lun)
@@ -1108,12 +1540,22 @@ func (vm *vmQemu) Stop(stateful bool) error {
 	vm.cleanupDevices()
 	os.Remove(vm.pidFilePath())
 	os.Remove(vm.getMonitorPath())
+	vm.runPostStopHook()
 
 	return nil
 }
 
+// runPostStopHook runs the post-stop hook of the host, whose failure doesn't fail the stop.
+func (vm *vmQemu) runPostStopHook() {
+	err := instanceHostHook(vm.state, vm, instanceHookPostStop, nil)
+	if err != nil {
+		qemuLogger.Error("Failed to run post-stop hook", log.Ctx{"instance": vm.Name(), "err": err})
+	}
+}
+
+// Unfreeze resumes the execution of a paused VM.
 func (vm *vmQemu) Unfreeze() error {
-	return fmt.Errorf("Unfreeze Not implemented")
+	return vm.runMonitorCommand("cont")
 }
 
 func (vm *vmQemu) IsPrivileged() bool {
@@ -1137,10 +1579,6 @@ func (vm *vmQemu) Rename(newName string) error {
 }
 
 func (vm *vmQemu) Update(args db.InstanceArgs, userRequested bool) error {
-	if vm.IsRunning() {
-		return fmt.Errorf("Update whilst running not supported")
-	}
-
 	// Set sane defaults for unset keys.
 	if args.Project == "" {
 		args.Project = "default"
@@ -1346,6 +1784,21 @@ func (vm *vmQemu) Update(args db.InstanceArgs, userRequested bool) error {
 		return updateFields
 	})
 
+	// Running virtual machines only get custom volumes attached or detached.
+	if vm.IsRunning() {
+		if len(changedConfig) > 0 || len(updateDevices) > 0 {
+			return fmt.Errorf("Update whilst running not supported")
+		}
+
+		for _, devices := range []deviceConfig.Devices{removeDevices, addDevices} {
+			for _, dev := range devices {
+				if dev["type"] != "disk" || dev["pool"] == "" || dev["path"] == "/" {
+					return fmt.Errorf("Update whilst running not supported")
+				}
+			}
+		}
+	}
+
 	// Do some validation of the config diff.
 	err = containerValidConfig(vm.state.OS, vm.expandedConfig, false, true)
 	if err != nil {
@@ -1358,6 +1811,21 @@ func (vm *vmQemu) Update(args db.InstanceArgs, userRequested bool) error {
 		return errors.Wrap(err, "Invalid expanded devices")
 	}
 
+	// Check that the static addresses of the instance aren't used by others.
+	var allocations []db.NetworkAllocation
+	if !vm.IsSnapshot() {
+		allocations, err = networkAllocations(vm, vm.expandedDevices)
+		if err == nil {
+			err = vm.state.Cluster.Transaction(func(tx *db.ClusterTx) error {
+				return tx.NetworkAllocationsCheck(vm.id, allocations)
+			})
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "Invalid static addresses")
+		}
+	}
+
 	// Use the device interface to apply update changes.
 	err = vm.updateDevices(removeDevices, addDevices, updateDevices, oldExpandedDevices)
 	if err != nil {
@@ -1419,6 +1887,12 @@ func (vm *vmQemu) Update(args db.InstanceArgs, userRequested bool) error {
 				return errors.Wrap(err, "Device add")
 			}
 
+			err = db.NetworkAllocationsSet(tx, vm.id, allocations)
+			if err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "Network allocations")
+			}
+
 			err = db.ContainerUpdate(tx, vm.id, vm.description, vm.architecture, vm.ephemeral, vm.expiryDate)
 			if err != nil {
 				tx.Rollback()
@@ -1453,7 +1927,7 @@ func (vm *vmQemu) Update(args db.InstanceArgs, userRequested bool) error {
 		endpoint = fmt.Sprintf("/1.0/virtual-machines/%s", vm.name)
 	}
 
-	vm.state.Events.SendLifecycle(vm.project, "virtual-machine-updated", endpoint, nil)
+	vm.lifecycle("virtual-machine-updated", endpoint, nil)
 	return nil
 }
 
@@ -1588,7 +2062,7 @@ func (vm *vmQemu) removeUnixDevices() error {
 		devicePath := filepath.Join(vm.DevicesPath(), f.Name())
 		err := os.Remove(devicePath)
 		if err != nil {
-			logger.Error("Failed removing unix device", log.Ctx{"err": err, "path": devicePath})
+			qemuLogger.Error("Failed removing unix device", log.Ctx{"err": err, "path": devicePath})
 		}
 	}
 
@@ -1621,7 +2095,7 @@ func (vm *vmQemu) removeDiskDevices() error {
 		diskPath := filepath.Join(vm.DevicesPath(), f.Name())
 		err := os.Remove(diskPath)
 		if err != nil {
-			logger.Error("Failed to remove disk device path", log.Ctx{"err": err, "path": diskPath})
+			qemuLogger.Error("Failed to remove disk device path", log.Ctx{"err": err, "path": diskPath})
 		}
 	}
 
@@ -1648,7 +2122,7 @@ func (vm *vmQemu) cleanupDevices() {
 		if err == device.ErrUnsupportedDevType {
 			continue
 		} else if err != nil {
-			logger.Errorf("Failed to stop device '%s': %v", dev.Name, err)
+			qemuLogger.Errorf("Failed to stop device '%s': %v", dev.Name, err)
 		}
 	}
 }
@@ -1676,7 +2150,7 @@ func (vm *vmQemu) Delete() error {
 		"ephemeral": vm.ephemeral,
 		"used":      vm.lastUsedDate}
 
-	logger.Info("Deleting instance", ctxMap)
+	qemuLogger.Info("Deleting instance", ctxMap)
 
 	// Check if instance is delete protected.
 	if shared.IsTrue(vm.expandedConfig["security.protection.delete"]) && !vm.IsSnapshot() {
@@ -1691,13 +2165,13 @@ func (vm *vmQemu) Delete() error {
 	if !vm.IsSnapshot() {
 		backups, err := vm.Backups()
 		if err != nil {
-			logger.Error("Failed to load backups", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+			qemuLogger.Error("Failed to load backups", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 		}
 
 		for _, backup := range backups {
 			err = backup.Delete()
 			if err != nil {
-				logger.Error("Failed to delete backup", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "backup": backup.Name, "err": err})
+				qemuLogger.Error("Failed to delete backup", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "backup": backup.Name, "err": err})
 			}
 		}
 	}
@@ -1705,7 +2179,7 @@ func (vm *vmQemu) Delete() error {
 	// Attempt to initialize storage interface for the instance.
 	pool, err := storagePools.GetPoolByInstance(vm.state, vm)
 	if err != nil {
-		logger.Error("Failed to init storage pool", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+		qemuLogger.Error("Failed to init storage pool", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 	}
 
 	if pool != nil {
@@ -1714,7 +2188,7 @@ func (vm *vmQemu) Delete() error {
 				// Remove snapshot volume and database record.
 				err = pool.DeleteInstanceSnapshot(vm, nil)
 				if err != nil {
-					logger.Error("Failed to delete instance snapshot volume", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+					qemuLogger.Error("Failed to delete instance snapshot volume", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 				}
 			}
 		} else {
@@ -1722,14 +2196,14 @@ func (vm *vmQemu) Delete() error {
 			// calling its Delete function.
 			err := instanceDeleteSnapshots(vm.state, vm.Project(), vm.Name())
 			if err != nil {
-				logger.Error("Failed to delete instance snapshot volumes", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+				qemuLogger.Error("Failed to delete instance snapshot volumes", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 			}
 
 			if !isImport {
 				// Remove the storage volume, snapshot volumes and database records.
 				err = pool.DeleteInstance(vm, nil)
 				if err != nil {
-					logger.Error("Failed to delete instance volume", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+					qemuLogger.Error("Failed to delete instance volume", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 				}
 			}
 		}
@@ -1743,33 +2217,33 @@ func (vm *vmQemu) Delete() error {
 		// Delete the MAAS entry.
 		err = vm.maasDelete()
 		if err != nil {
-			logger.Error("Failed deleting instance MAAS record", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+			qemuLogger.Error("Failed deleting instance MAAS record", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 		}
 
 		// Run device removal function for each device.
 		for k, m := range vm.expandedDevices {
 			err = vm.deviceRemove(k, m)
 			if err != nil && err != device.ErrUnsupportedDevType {
-				logger.Error("Failed to remove device", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "device": k, "err": err})
+				qemuLogger.Error("Failed to remove device", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "device": k, "err": err})
 			}
 		}
 	}
 
 	// Remove the database record of the instance or snapshot instance.
 	if err := vm.state.Cluster.InstanceRemove(vm.Project(), vm.Name()); err != nil {
-		logger.Error("Failed deleting instance entry", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+		qemuLogger.Error("Failed deleting instance entry", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 		return err // This is the only step we should return prematurely at.
 	}
 
-	logger.Info("Deleted instance", ctxMap)
+	qemuLogger.Info("Deleted instance", ctxMap)
 
 	if vm.IsSnapshot() {
-		vm.state.Events.SendLifecycle(vm.project, "virtual-machine-snapshot-deleted",
+		vm.lifecycle("virtual-machine-snapshot-deleted",
 			fmt.Sprintf("/1.0/virtual-machines/%s", vm.name), map[string]interface{}{
 				"snapshot_name": vm.name,
 			})
 	} else {
-		vm.state.Events.SendLifecycle(vm.project, "virtual-machine-deleted",
+		vm.lifecycle("virtual-machine-deleted",
 			fmt.Sprintf("/1.0/virtual-machines/%s", vm.name), nil)
 	}
 
@@ -2040,7 +2514,7 @@ func (vm *vmQemu) RenderFull() (*api.InstanceFull, interface{}, error) {
 	vmState := api.InstanceFull{Instance: *base.(*api.Instance)}
 
 	// Add the InstanceState.
-	vmState.State, err = vm.RenderState()
+	vmState.State, err = instanceStateCached(vm, vmState.StatusCode)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -2089,7 +2563,7 @@ func (vm *vmQemu) RenderState() (*api.InstanceState, error) {
 
 	status, err := vm.agentGetState()
 	if err != nil {
-		logger.Warn("Could not get VM state from agent", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
+		qemuLogger.Warn("Could not get VM state from agent", log.Ctx{"project": vm.Project(), "instance": vm.Name(), "err": err})
 	} else {
 		status.Pid = int64(pid)
 		status.Status = statusCode.String()
@@ -2129,6 +2603,24 @@ func (vm *vmQemu) agentGetState() (*api.InstanceState, error) {
 	return status, nil
 }
 
+// agentTrim asks the agent inside of the VM to discard the unused blocks of its filesystems, so
+// that the space they use is released on the host.
+func (vm *vmQemu) agentTrim() error {
+	// Ensure the correct vhost_vsock kernel module is loaded before establishing the vsock.
+	err := util.LoadModule("vhost_vsock")
+	if err != nil {
+		return err
+	}
+
+	agent, err := lxdClient.ConnectLXDHTTP(nil, vm.agentClient)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = agent.RawQuery("POST", "/1.0/trim", nil, "")
+	return err
+}
+
 func (vm *vmQemu) IsRunning() bool {
 	state := vm.State()
 	return state != "BROKEN" && state != "STOPPED"
@@ -2284,6 +2776,10 @@ func (vm *vmQemu) statusCode() api.StatusCode {
 		return api.Running
 	}
 
+	if respDecoded.Return.Status == "paused" {
+		return api.Frozen
+	}
+
 	return api.Stopped
 }
 
@@ -2368,6 +2864,13 @@ func (vm *vmQemu) Storage() storage {
 	return nil
 }
 
+// lifecycle sends a lifecycle event for the instance, also notifying its webhook if configured.
+func (vm *vmQemu) lifecycle(action string, source string, context map[string]interface{}) error {
+	webhook.SendLifecycle(vm.expandedConfig, vm.project, action, source, context)
+
+	return vm.state.Events.SendLifecycle(vm.project, action, source, context)
+}
+
 func (vm *vmQemu) DeferTemplateApply(trigger string) error {
 	return nil
 }
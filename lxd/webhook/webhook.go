@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// Number of delivery attempts before giving up on an event.
+var deliveryAttempts = 5
+
+// Delay before the first retry, doubled on every following one.
+var deliveryBackoff = 2 * time.Second
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Server-wide settings, kept in sync with the cluster configuration by Configure.
+var settingsLock sync.RWMutex
+var allowedURLs []string
+var signingSecret string
+
+// Configure sets the URL prefixes the webhooks of instances and volumes may post to, and the
+// secret signing their payloads.
+func Configure(allowed []string, secret string) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+
+	allowedURLs = allowed
+	signingSecret = secret
+}
+
+// Allowed returns whether the given URL matches one of the prefixes set by Configure. The scheme
+// and host must be identical, the path must start with the one of the prefix.
+func Allowed(address string) bool {
+	u, err := url.Parse(address)
+	if err != nil {
+		return false
+	}
+
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	for _, prefix := range allowedURLs {
+		p, err := url.Parse(prefix)
+		if err != nil {
+			continue
+		}
+
+		if u.Scheme != p.Scheme || u.Host != p.Host {
+			continue
+		}
+
+		if strings.HasPrefix(u.Path, p.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Target represents the webhook configured on an instance or a custom volume.
+type Target struct {
+	URL    string
+	Secret string
+	Events []string
+}
+
+// NewTarget returns the webhook posting to the given URL, or nil if it's empty. The events are a
+// comma separated list of the lifecycle actions to send, all of them if empty.
+func NewTarget(address string, events string) *Target {
+	if address == "" {
+		return nil
+	}
+
+	target := &Target{URL: address}
+
+	for _, action := range strings.Split(events, ",") {
+		action = strings.TrimSpace(action)
+		if action != "" {
+			target.Events = append(target.Events, action)
+		}
+	}
+
+	return target
+}
+
+// TargetFromConfig returns the webhook set by the webhooks.* keys of the given instance or volume
+// configuration, or nil if there's none.
+func TargetFromConfig(config map[string]string) *Target {
+	return NewTarget(config["webhooks.url"], config["webhooks.events"])
+}
+
+// Wants returns whether the target should be notified of the given lifecycle action.
+func (t *Target) Wants(action string) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+
+	return shared.StringInSlice(action, t.Events)
+}
+
+// ValidateURL checks that the value is an absolute http or https URL.
+func ValidateURL(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Webhook URL must use http or https")
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("Webhook URL must include a host")
+	}
+
+	return nil
+}
+
+// Signature returns the hex-encoded HMAC-SHA256 of the body using the given secret.
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendLifecycle notifies the webhook set in the given instance or volume configuration (if any)
+// of a lifecycle event. Delivery happens in the background and failed attempts are retried with an
+// exponential backoff.
+func SendLifecycle(config map[string]string, project string, action string, source string, context map[string]interface{}) {
+	target := TargetFromConfig(config)
+	if target == nil || !target.Wants(action) {
+		return
+	}
+
+	if !Allowed(target.URL) {
+		logger.Warnf("Not delivering webhook event %q to %s, which isn't listed in core.webhooks_allowed", action, target.URL)
+		return
+	}
+
+	settingsLock.RLock()
+	target.Secret = signingSecret
+	settingsLock.RUnlock()
+
+	metadata, err := json.Marshal(api.EventLifecycle{
+		Action:  action,
+		Source:  source,
+		Context: context,
+	})
+	if err != nil {
+		logger.Warnf("Failed to encode webhook event %q: %v", action, err)
+		return
+	}
+
+	body, err := json.Marshal(api.Event{
+		Type:      "lifecycle",
+		Timestamp: time.Now(),
+		Metadata:  metadata,
+	})
+	if err != nil {
+		logger.Warnf("Failed to encode webhook event %q: %v", action, err)
+		return
+	}
+
+	go target.deliver(uuid.NewRandom().String(), project, action, body)
+}
+
+func (t *Target) deliver(id string, project string, action string, body []byte) {
+	backoff := deliveryBackoff
+
+	for attempt := 1; attempt <= deliveryAttempts; attempt++ {
+		retry, err := t.post(id, project, action, body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt == deliveryAttempts {
+			logger.Warnf("Failed to deliver webhook event %q to %s: %v", action, t.URL, err)
+			return
+		}
+
+		logger.Debugf("Failed to deliver webhook event %q to %s (attempt %d): %v", action, t.URL, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Sends a single delivery attempt, returning whether it's worth retrying on failure.
+func (t *Target) post(id string, project string, action string, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LXD")
+	req.Header.Set("X-LXD-Delivery", id)
+	req.Header.Set("X-LXD-Event", action)
+
+	if project != "" {
+		req.Header.Set("X-LXD-Project", project)
+	}
+
+	if t.Secret != "" {
+		req.Header.Set("X-LXD-Signature", fmt.Sprintf("sha256=%s", Signature(t.Secret, body)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	// Client errors other than rate limiting won't get any better by retrying.
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+
+	return retry, fmt.Errorf("Unexpected status code %d", resp.StatusCode)
+}
@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestNewTarget(t *testing.T) {
+	assert.Nil(t, NewTarget("", "container-created"))
+
+	target := NewTarget("https://example.com/hook", "container-created, storage-volume-deleted")
+	require.NotNil(t, target)
+	assert.True(t, target.Wants("container-created"))
+	assert.True(t, target.Wants("storage-volume-deleted"))
+	assert.False(t, target.Wants("container-started"))
+
+	target = TargetFromConfig(map[string]string{"webhooks.url": "https://example.com/hook"})
+	require.NotNil(t, target)
+	assert.True(t, target.Wants("container-started"))
+}
+
+func TestAllowed(t *testing.T) {
+	Configure([]string{"https://cmdb.example.com/lxd", "http://10.0.0.1:8080"}, "")
+	defer Configure(nil, "")
+
+	assert.True(t, Allowed("https://cmdb.example.com/lxd/events"))
+	assert.True(t, Allowed("http://10.0.0.1:8080/hook"))
+	assert.False(t, Allowed("http://cmdb.example.com/lxd/events"))
+	assert.False(t, Allowed("https://cmdb.example.com/other"))
+	assert.False(t, Allowed("http://10.0.0.1:8081/hook"))
+	assert.False(t, Allowed("http://169.254.169.254/latest"))
+
+	Configure(nil, "")
+	assert.False(t, Allowed("https://cmdb.example.com/lxd/events"))
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL(""))
+	assert.NoError(t, ValidateURL("http://10.0.0.1:8080/hook"))
+	assert.Error(t, ValidateURL("ftp://example.com"))
+	assert.Error(t, ValidateURL("/hook"))
+}
+
+// The event is delivered signed, and retried after a server error.
+func TestSendLifecycle(t *testing.T) {
+	deliveryBackoff = 10 * time.Millisecond
+
+	attempts := 0
+	delivered := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		delivered <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	Configure([]string{server.URL}, "s3cret")
+	defer Configure(nil, "")
+
+	SendLifecycle(map[string]string{"webhooks.url": server.URL + "/hook"}, "default", "container-created", "/1.0/containers/c1", nil)
+
+	select {
+	case r := <-delivered:
+		body := <-bodies
+		assert.Equal(t, "container-created", r.Header.Get("X-LXD-Event"))
+		assert.Equal(t, "default", r.Header.Get("X-LXD-Project"))
+		assert.Equal(t, "sha256="+Signature("s3cret", body), r.Header.Get("X-LXD-Signature"))
+
+		event := api.Event{}
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, "lifecycle", event.Type)
+
+		lifecycle := api.EventLifecycle{}
+		require.NoError(t, json.Unmarshal(event.Metadata, &lifecycle))
+		assert.Equal(t, "/1.0/containers/c1", lifecycle.Source)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook wasn't delivered")
+	}
+
+	assert.Equal(t, 2, attempts)
+}
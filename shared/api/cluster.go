@@ -1,5 +1,9 @@
 package api
 
+import (
+	"time"
+)
+
 // Cluster represents high-level information about a LXD cluster.
 //
 // API extension: clustering
@@ -48,10 +52,20 @@ type ClusterMemberPost struct {
 	ServerName string `json:"server_name" yaml:"server_name"`
 }
 
+// ClusterMemberPut represents the modifiable fields of a LXD node in the
+// cluster.
+//
+// API extension: clustering_maintenance
+type ClusterMemberPut struct {
+	Maintenance bool `json:"maintenance" yaml:"maintenance"`
+}
+
 // ClusterMember represents the a LXD node in the cluster.
 //
 // API extension: clustering
 type ClusterMember struct {
+	ClusterMemberPut `yaml:",inline"`
+
 	ServerName string `json:"server_name" yaml:"server_name"`
 	URL        string `json:"url" yaml:"url"`
 	Database   bool   `json:"database" yaml:"database"`
@@ -60,4 +74,69 @@ type ClusterMember struct {
 
 	// API extension: clustering_roles
 	Roles []string `json:"roles" yaml:"roles"`
+
+	// API extension: clustering_pending_changes
+	PendingChanges []ClusterMemberPendingChange `json:"pending_changes" yaml:"pending_changes"`
+}
+
+// ClusterMemberPendingChange represents a change to a storage pool, network or
+// profile which was made while the member was offline, and which it hasn't
+// applied yet.
+//
+// API extension: clustering_pending_changes
+type ClusterMemberPendingChange struct {
+	Entity    string    `json:"entity" yaml:"entity"`
+	Project   string    `json:"project" yaml:"project"`
+	Name      string    `json:"name" yaml:"name"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	Error     string    `json:"error" yaml:"error"`
+}
+
+// ClusterCertificatePut represents the certificate and key pair which all the
+// members of the cluster should switch to.
+//
+// API extension: clustering_update_cert
+type ClusterCertificatePut struct {
+	// If both are empty, a new certificate is generated.
+	ClusterCertificate    string `json:"cluster_certificate" yaml:"cluster_certificate"`
+	ClusterCertificateKey string `json:"cluster_certificate_key" yaml:"cluster_certificate_key"`
+}
+
+// ClusterRebalance represents the load of the members of a cluster, along
+// with the instance moves suggested to even it out.
+//
+// API extension: clustering_rebalance
+type ClusterRebalance struct {
+	Members []ClusterRebalanceMember `json:"members" yaml:"members"`
+	Moves   []ClusterRebalanceMove   `json:"moves" yaml:"moves"`
+}
+
+// ClusterRebalanceMember represents the load of a cluster member, with each
+// resource allocated as a fraction of its capacity.
+//
+// API extension: clustering_rebalance
+type ClusterRebalanceMember struct {
+	ServerName string  `json:"server_name" yaml:"server_name"`
+	CPU        float64 `json:"cpu" yaml:"cpu"`
+	Memory     float64 `json:"memory" yaml:"memory"`
+	Storage    float64 `json:"storage" yaml:"storage"`
+}
+
+// ClusterRebalanceMove represents the move of an instance to another member.
+//
+// API extension: clustering_rebalance
+type ClusterRebalanceMove struct {
+	Project  string `json:"project" yaml:"project"`
+	Instance string `json:"instance" yaml:"instance"`
+	Source   string `json:"source" yaml:"source"`
+	Target   string `json:"target" yaml:"target"`
+}
+
+// ClusterRebalancePost represents the instance moves to perform to rebalance
+// a cluster.
+//
+// API extension: clustering_rebalance
+type ClusterRebalancePost struct {
+	// If empty, the currently suggested moves are performed.
+	Moves []ClusterRebalanceMove `json:"moves" yaml:"moves"`
 }
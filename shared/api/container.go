@@ -73,6 +73,9 @@ type Container struct {
 
 	// API extension: clustering
 	Location string `json:"location" yaml:"location"`
+
+	// API extension: object_etags
+	ETag string `json:"etag,omitempty" yaml:"etag,omitempty"`
 }
 
 // ContainerFull is a combination of Container, ContainerState and CotnainerSnapshot
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+)
+
+// StatusError is an error carrying the HTTP status code it is reported with by the API
+//
+// API extension: storage_error_codes
+type StatusError struct {
+	status int
+	msg    string
+}
+
+// StatusErrorf returns a new StatusError with the given status code and a message formatted
+// according to the format specifier.
+func StatusErrorf(status int, format string, a ...interface{}) StatusError {
+	return StatusError{
+		status: status,
+		msg:    fmt.Sprintf(format, a...),
+	}
+}
+
+// Error returns the message of the error.
+func (e StatusError) Error() string {
+	return e.msg
+}
+
+// Status returns the HTTP status code of the error.
+func (e StatusError) Status() int {
+	return e.status
+}
+
+// StatusErrorCheck returns whether the given error is (or was caused by) a StatusError with one of
+// the given HTTP status codes, or with any status code if none is given.
+func StatusErrorCheck(err error, status ...int) bool {
+	type causer interface {
+		Cause() error
+	}
+
+	// Unwrap errors annotated with github.com/pkg/errors, without depending on it.
+	for err != nil {
+		cause, ok := err.(causer)
+		if !ok {
+			break
+		}
+
+		err = cause.Cause()
+	}
+
+	statusErr, ok := err.(StatusError)
+	if !ok {
+		return false
+	}
+
+	if len(status) == 0 {
+		return true
+	}
+
+	for _, code := range status {
+		if statusErr.status == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -16,6 +16,19 @@ type ImagesPost struct {
 
 	// API extension: image_create_aliases
 	Aliases []ImageAlias `json:"aliases" yaml:"aliases"`
+
+	// API extension: image_preseed
+	Preseed *ImagePreseed `json:"preseed" yaml:"preseed"`
+}
+
+// ImagePreseed represents where to create the cached volume of a new image ahead of its first use
+//
+// API extension: image_preseed
+type ImagePreseed struct {
+	Pool string `json:"pool" yaml:"pool"`
+
+	// All the cluster members if empty
+	Members []string `json:"members" yaml:"members"`
 }
 
 // ImagesPostSource represents the source of a new LXD image
@@ -28,12 +41,16 @@ type ImagesPostSource struct {
 	// For protocol "direct"
 	URL string `json:"url" yaml:"url"`
 
-	// For type "container"
+	// For type "container" and "volume"
 	Name string `json:"name" yaml:"name"`
 
 	// For type "image"
 	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
 	Secret      string `json:"secret" yaml:"secret"`
+
+	// For type "volume"
+	// API extension: images_from_custom_block_volumes
+	Pool string `json:"pool" yaml:"pool"`
 }
 
 // ImagePut represents the modifiable fields of a LXD image
@@ -38,6 +38,9 @@ type InstancePost struct {
 	InstanceOnly  bool                `json:"instance_only" yaml:"instance_only"`
 	ContainerOnly bool                `json:"container_only" yaml:"container_only"` // Deprecated, use InstanceOnly.
 	Target        *InstancePostTarget `json:"target" yaml:"target"`
+
+	// API extension: instance_snapshots_selection
+	Snapshots string `json:"snapshots,omitempty" yaml:"snapshots,omitempty"`
 }
 
 // InstancePostTarget represents the migration target host and operation.
@@ -78,6 +81,9 @@ type Instance struct {
 	LastUsedAt      time.Time                    `json:"last_used_at" yaml:"last_used_at"`
 	Location        string                       `json:"location" yaml:"location"`
 	Type            string                       `json:"type" yaml:"type"`
+
+	// API extension: object_etags
+	ETag string `json:"etag,omitempty" yaml:"etag,omitempty"`
 }
 
 // InstanceFull is a combination of Instance, InstanceBackup, InstanceState and InstanceSnapshot.
@@ -91,6 +97,18 @@ type InstanceFull struct {
 	Snapshots []InstanceSnapshot `json:"snapshots" yaml:"snapshots"`
 }
 
+// InstanceExpanded is an Instance along with where each of its expanded config keys and devices
+// comes from. Sources are either "local" for the instance's own config and devices, or
+// "profile:<name>" for the profile it's inherited from.
+//
+// API extension: instance_expanded_sources
+type InstanceExpanded struct {
+	Instance `yaml:",inline"`
+
+	ExpandedConfigSources  map[string]string `json:"expanded_config_sources" yaml:"expanded_config_sources"`
+	ExpandedDevicesSources map[string]string `json:"expanded_devices_sources" yaml:"expanded_devices_sources"`
+}
+
 // Writable converts a full Instance struct into a InstancePut struct (filters read-only fields).
 //
 // API extension: instances
@@ -134,4 +152,11 @@ type InstanceSource struct {
 	ContainerOnly bool              `json:"container_only,omitempty" yaml:"container_only,omitempty"` // Deprecated, use InstanceOnly.
 	Refresh       bool              `json:"refresh,omitempty" yaml:"refresh,omitempty"`
 	Project       string            `json:"project,omitempty" yaml:"project,omitempty"`
+
+	// API extension: instance_clone
+	Clone       bool `json:"clone,omitempty" yaml:"clone,omitempty"`
+	Independent bool `json:"independent,omitempty" yaml:"independent,omitempty"`
+
+	// API extension: instance_snapshots_selection
+	Snapshots string `json:"snapshots,omitempty" yaml:"snapshots,omitempty"`
 }
@@ -34,3 +34,30 @@ type InstanceBackup struct {
 type InstanceBackupPost struct {
 	Name string `json:"name" yaml:"name"`
 }
+
+// InstanceBackupEntry represents a file, directory or link stored in an
+// instance backup.
+//
+// API extension: backup_file_restore
+type InstanceBackupEntry struct {
+	Path       string    `json:"path" yaml:"path"`
+	Type       string    `json:"type" yaml:"type"`
+	Size       int64     `json:"size" yaml:"size"`
+	Mode       int64     `json:"mode" yaml:"mode"`
+	ModifiedAt time.Time `json:"modified_at" yaml:"modified_at"`
+	Target     string    `json:"target,omitempty" yaml:"target,omitempty"`
+}
+
+// InstanceBackupRestorePost represents the fields available to restore
+// specific paths from an instance backup.
+//
+// API extension: backup_file_restore
+type InstanceBackupRestorePost struct {
+	Paths []string `json:"paths" yaml:"paths"`
+
+	// Instance to restore into, defaults to the instance of the backup.
+	Instance string `json:"instance" yaml:"instance"`
+
+	// Directory to restore into, defaults to the root of the instance.
+	Destination string `json:"destination" yaml:"destination"`
+}
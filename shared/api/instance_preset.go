@@ -0,0 +1,57 @@
+package api
+
+// InstancePresetsPost represents the fields of a new LXD instance preset
+//
+// API extension: instance_presets
+type InstancePresetsPost struct {
+	InstancePresetPut `yaml:",inline"`
+
+	Name string `json:"name" yaml:"name"`
+}
+
+// InstancePresetPost represents the fields required to rename a LXD instance preset
+//
+// API extension: instance_presets
+type InstancePresetPost struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// InstancePresetPut represents the modifiable fields of a LXD instance preset
+//
+// API extension: instance_presets
+type InstancePresetPut struct {
+	Description string `json:"description" yaml:"description"`
+
+	// Image the instances are created from
+	Source InstanceSource `json:"source" yaml:"source"`
+	Type   InstanceType   `json:"type" yaml:"type"`
+
+	Profiles []string                     `json:"profiles" yaml:"profiles"`
+	Config   map[string]string            `json:"config" yaml:"config"`
+	Devices  map[string]map[string]string `json:"devices" yaml:"devices"`
+}
+
+// InstancePreset represents a LXD instance preset, the definition of instances which can be
+// created in one call
+//
+// API extension: instance_presets
+type InstancePreset struct {
+	InstancePresetPut `yaml:",inline"`
+
+	Name string `json:"name" yaml:"name"`
+}
+
+// Writable converts a full InstancePreset struct into a InstancePresetPut struct (filters read-only fields)
+func (preset *InstancePreset) Writable() InstancePresetPut {
+	return preset.InstancePresetPut
+}
+
+// InstancePresetInstancesPost represents the fields of a new instance created from a preset, the
+// config and devices being applied on top of the ones of the preset
+//
+// API extension: instance_presets
+type InstancePresetInstancesPost struct {
+	Name    string                       `json:"name" yaml:"name"`
+	Config  map[string]string            `json:"config" yaml:"config"`
+	Devices map[string]map[string]string `json:"devices" yaml:"devices"`
+}
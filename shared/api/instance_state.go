@@ -1,5 +1,9 @@
 package api
 
+import (
+	"time"
+)
+
 // InstanceStatePut represents the modifiable fields of a LXD instance's state.
 //
 // API extension: instances
@@ -22,6 +26,9 @@ type InstanceState struct {
 	Pid        int64                           `json:"pid" yaml:"pid"`
 	Processes  int64                           `json:"processes" yaml:"processes"`
 	CPU        InstanceStateCPU                `json:"cpu" yaml:"cpu"`
+
+	// API extension: instances_state_cache
+	CachedAt *time.Time `json:"cached_at,omitempty" yaml:"cached_at,omitempty"`
 }
 
 // InstanceStateDisk represents the disk information section of a LXD instance's state.
@@ -29,6 +36,13 @@ type InstanceState struct {
 // API extension: instances
 type InstanceStateDisk struct {
 	Usage int64 `json:"usage" yaml:"usage"`
+
+	// API extension: instance_disk_usage_directories
+	Directories map[string]int64 `json:"directories,omitempty" yaml:"directories,omitempty"`
+
+	// Whether the mount of the disk's storage pool went stale
+	// API extension: storage_stale_mounts
+	Stale bool `json:"stale,omitempty" yaml:"stale,omitempty"`
 }
 
 // InstanceStateCPU represents the cpu information section of a LXD instance's state.
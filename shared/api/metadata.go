@@ -0,0 +1,26 @@
+package api
+
+// MetadataConfiguration represents the configuration keys of the various LXD objects
+//
+// API extension: metadata_configuration
+type MetadataConfiguration struct {
+	Instance      map[string]ConfigKeySchema `json:"instance" yaml:"instance"`
+	StoragePool   map[string]ConfigKeySchema `json:"storage_pool" yaml:"storage_pool"`
+	StorageVolume map[string]ConfigKeySchema `json:"storage_volume" yaml:"storage_volume"`
+	Network       map[string]ConfigKeySchema `json:"network" yaml:"network"`
+	Project       map[string]ConfigKeySchema `json:"project" yaml:"project"`
+}
+
+// ConfigKeySchema represents a configuration key. Keys containing a "*" match any key with the
+// same prefix. LiveUpdate (instances only) is "yes", "no" or "n/a" and Drivers (storage only) lists
+// the drivers supporting the key, all of them if empty.
+//
+// API extension: metadata_configuration
+type ConfigKeySchema struct {
+	Type        string   `json:"type" yaml:"type"`
+	Default     string   `json:"default" yaml:"default"`
+	LiveUpdate  string   `json:"live_update,omitempty" yaml:"live_update,omitempty"`
+	Condition   string   `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Drivers     []string `json:"drivers,omitempty" yaml:"drivers,omitempty"`
+	Description string   `json:"description" yaml:"description"`
+}
@@ -42,6 +42,9 @@ type Network struct {
 	// API extension: clustering
 	Status    string   `json:"status" yaml:"status"`
 	Locations []string `json:"locations" yaml:"locations"`
+
+	// API extension: object_etags
+	ETag string `json:"etag,omitempty" yaml:"etag,omitempty"`
 }
 
 // Writable converts a full Network struct into a NetworkPut struct (filters read-only fields)
@@ -49,6 +52,16 @@ func (network *Network) Writable() NetworkPut {
 	return network.NetworkPut
 }
 
+// NetworkAllocation represents a static address assigned to an instance NIC
+//
+// API extension: network_allocations
+type NetworkAllocation struct {
+	Address  string `json:"address" yaml:"address"`
+	Project  string `json:"project" yaml:"project"`
+	Instance string `json:"instance" yaml:"instance"`
+	Device   string `json:"device" yaml:"device"`
+}
+
 // NetworkLease represents a DHCP lease
 //
 // API extension: network_leases
@@ -20,4 +20,7 @@ type Operation struct {
 
 	// API extension: operation_location
 	Location string `json:"location" yaml:"location"`
+
+	// API extension: storage_error_codes
+	ErrCode int `json:"err_code" yaml:"err_code"`
 }
@@ -0,0 +1,58 @@
+package api
+
+// Preseed represents the desired state of a LXD server
+//
+// API extension: preseed_apply
+type Preseed struct {
+	ServerPut `yaml:",inline"`
+
+	Networks     []PreseedNetwork   `json:"networks" yaml:"networks"`
+	StoragePools []StoragePoolsPost `json:"storage_pools" yaml:"storage_pools"`
+	Profiles     []PreseedProfile   `json:"profiles" yaml:"profiles"`
+	Projects     []ProjectsPost     `json:"projects" yaml:"projects"`
+}
+
+// PreseedNetwork represents the desired state of a network
+//
+// API extension: preseed_apply
+type PreseedNetwork struct {
+	NetworksPost `yaml:",inline"`
+
+	// Project the network is applied to, the default project if empty. Networks are shared by
+	// all projects, so the project only has to exist.
+	Project string `json:"project" yaml:"project"`
+}
+
+// PreseedProfile represents the desired state of a profile
+//
+// API extension: preseed_apply
+type PreseedProfile struct {
+	ProfilesPost `yaml:",inline"`
+
+	// Project the profile is applied to, the default project if empty or if the project
+	// doesn't have its own profiles
+	Project string `json:"project" yaml:"project"`
+}
+
+// PreseedChange represents a single change made (or to be made) while applying a preseed
+//
+// API extension: preseed_apply
+type PreseedChange struct {
+	// One of "server", "network", "storage_pool", "profile" or "project"
+	Entity string `json:"entity" yaml:"entity"`
+	Name   string `json:"name" yaml:"name"`
+
+	// One of "create" or "update"
+	Action string `json:"action" yaml:"action"`
+
+	// Configuration keys (and devices) which were added or modified
+	Keys []string `json:"keys" yaml:"keys"`
+}
+
+// PreseedResult represents the outcome of applying a preseed
+//
+// API extension: preseed_apply
+type PreseedResult struct {
+	DryRun  bool            `json:"dry_run" yaml:"dry_run"`
+	Changes []PreseedChange `json:"changes" yaml:"changes"`
+}
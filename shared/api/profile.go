@@ -33,3 +33,24 @@ type Profile struct {
 func (profile *Profile) Writable() ProfilePut {
 	return profile.ProfilePut
 }
+
+// ProfileInstanceDiff represents a running instance which doesn't use the current definition of
+// some of its profiles, for example because applying a profile change to it failed.
+//
+// API extension: profiles_apply
+type ProfileInstanceDiff struct {
+	Name     string   `json:"name" yaml:"name"`
+	Project  string   `json:"project" yaml:"project"`
+	Location string   `json:"location" yaml:"location"`
+	Profiles []string `json:"profiles" yaml:"profiles"`
+}
+
+// ProfileApplyResult represents the result of re-applying a profile to one of its instances.
+//
+// API extension: profiles_apply
+type ProfileApplyResult struct {
+	Name     string `json:"name" yaml:"name"`
+	Project  string `json:"project" yaml:"project"`
+	Location string `json:"location" yaml:"location"`
+	Error    string `json:"error" yaml:"error"`
+}
@@ -23,6 +23,9 @@ type StoragePool struct {
 	// API extension: clustering
 	Status    string   `json:"status" yaml:"status"`
 	Locations []string `json:"locations" yaml:"locations"`
+
+	// API extension: object_etags
+	ETag string `json:"etag,omitempty" yaml:"etag,omitempty"`
 }
 
 // StoragePoolPut represents the modifiable fields of a LXD storage pool.
@@ -40,3 +43,37 @@ type StoragePoolPut struct {
 func (storagePool *StoragePool) Writable() StoragePoolPut {
 	return storagePool.StoragePoolPut
 }
+
+// StoragePoolUsage represents the usage of a LXD storage pool, aggregated
+// over its volumes.
+//
+// API extension: storage_pool_usage
+type StoragePoolUsage struct {
+	Space ResourcesStoragePoolSpace `json:"space" yaml:"space"`
+
+	// Number of volumes and snapshots, indexed by volume type
+	Volumes   map[string]int `json:"volumes" yaml:"volumes"`
+	Snapshots map[string]int `json:"snapshots" yaml:"snapshots"`
+
+	// Volumes using the most space, biggest first
+	BiggestVolumes []StoragePoolUsageVolume `json:"biggest_volumes" yaml:"biggest_volumes"`
+
+	// Total size of the images cached on the pool
+	ImagesSize uint64 `json:"images_size" yaml:"images_size"`
+
+	// Whether the mount of the pool went stale, making its volumes unusable until remounted
+	// API extension: storage_stale_mounts
+	Stale bool `json:"stale" yaml:"stale"`
+}
+
+// StoragePoolUsageVolume represents the usage of a volume of a LXD storage
+// pool.
+//
+// API extension: storage_pool_usage
+type StoragePoolUsageVolume struct {
+	Name      string `json:"name" yaml:"name"`
+	Type      string `json:"type" yaml:"type"`
+	Project   string `json:"project" yaml:"project"`
+	Used      uint64 `json:"used" yaml:"used"`
+	Snapshots int    `json:"snapshots" yaml:"snapshots"`
+}
@@ -11,6 +11,9 @@ type StorageVolumesPost struct {
 
 	// API extension: storage_api_local_volume_handling
 	Source StorageVolumeSource `json:"source" yaml:"source"`
+
+	// API extension: custom_block_volumes
+	ContentType string `json:"content_type" yaml:"content_type"`
 }
 
 // StorageVolumePost represents the fields required to rename a LXD storage pool volume
@@ -30,6 +33,9 @@ type StorageVolumePost struct {
 
 	// API extension: storage_api_remote_volume_snapshots
 	VolumeOnly bool `json:"volume_only" yaml:"volume_only"`
+
+	// API extension: storage_transfer_bwlimit
+	BandwidthLimit string `json:"bandwidth_limit,omitempty" yaml:"bandwidth_limit,omitempty"`
 }
 
 // StorageVolumePostTarget represents the migration target host and operation
@@ -52,6 +58,12 @@ type StorageVolume struct {
 
 	// API extension: clustering
 	Location string `json:"location" yaml:"location"`
+
+	// API extension: object_etags
+	ETag string `json:"etag,omitempty" yaml:"etag,omitempty"`
+
+	// API extension: custom_block_volumes
+	ContentType string `json:"content_type" yaml:"content_type"`
 }
 
 // StorageVolumePut represents the modifiable fields of a LXD storage volume.
@@ -83,6 +95,46 @@ type StorageVolumeSource struct {
 
 	// API extension: storage_api_volume_snapshots
 	VolumeOnly bool `json:"volume_only" yaml:"volume_only"`
+
+	// API extension: storage_volume_import
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// API extension: custom_volume_refresh
+	Refresh bool `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+}
+
+// StorageVolumeState represents the live state of a LXD storage volume
+//
+// API extension: storage_volume_state
+type StorageVolumeState struct {
+	Usage *StorageVolumeStateUsage `json:"usage" yaml:"usage"`
+}
+
+// StorageVolumeStateUsage represents the disk usage of a LXD storage volume
+//
+// API extension: storage_volume_state
+type StorageVolumeStateUsage struct {
+	Used uint64 `json:"used,omitempty" yaml:"used,omitempty"`
+}
+
+// StorageVolumeCheck represents the result of the consistency check of a LXD storage volume, as
+// reported by the tool which ran it (such as e2fsck or zfs send)
+//
+// API extension: storage_volume_check
+type StorageVolumeCheck struct {
+	Tool   string   `json:"tool" yaml:"tool"`
+	Clean  bool     `json:"clean" yaml:"clean"`
+	Errors []string `json:"errors" yaml:"errors"`
+	Output string   `json:"output" yaml:"output"`
+}
+
+// StorageVolumeWarning represents a key of a new storage volume's config which the driver of the
+// storage pool accepts but doesn't apply
+//
+// API extension: storage_volume_warnings
+type StorageVolumeWarning struct {
+	Key     string `json:"key" yaml:"key"`
+	Message string `json:"message" yaml:"message"`
 }
 
 // Writable converts a full StorageVolume struct into a StorageVolumePut struct
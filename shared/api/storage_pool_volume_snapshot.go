@@ -1,10 +1,17 @@
 package api
 
+import (
+	"time"
+)
+
 // StorageVolumeSnapshotsPost represents the fields available for a new LXD storage volume snapshot
 //
 // API extension: storage_api_volume_snapshots
 type StorageVolumeSnapshotsPost struct {
 	Name string `json:"name" yaml:"name"`
+
+	// API extension: storage_volume_snapshot_dates
+	ExpiresAt *time.Time `json:"expires_at" yaml:"expires_at"`
 }
 
 // StorageVolumeSnapshotPost represents the fields required to rename/move a LXD storage volume snapshot
@@ -21,6 +28,10 @@ type StorageVolumeSnapshot struct {
 	Name        string            `json:"name" yaml:"name"`
 	Config      map[string]string `json:"config" yaml:"config"`
 	Description string            `json:"description" yaml:"description"`
+
+	// API extension: storage_volume_snapshot_dates
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
 }
 
 // StorageVolumeSnapshotPut represents the modifiable fields of a LXD storage volume
@@ -28,4 +39,7 @@ type StorageVolumeSnapshot struct {
 // API extension: storage_api_volume_snapshots
 type StorageVolumeSnapshotPut struct {
 	Description string `json:"description" yaml:"description"`
+
+	// API extension: storage_volume_snapshot_dates
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
 }
@@ -115,6 +115,25 @@ func IsNotEmpty(value string) error {
 	return nil
 }
 
+// IsCronSchedule validates a snapshot schedule, as a cron expression of the form
+// "<minute> <hour> <day-of-month> <month> <day-of-week>".
+func IsCronSchedule(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	if len(strings.Split(value, " ")) != 5 {
+		return fmt.Errorf("Schedule must be of the form: <minute> <hour> <day-of-month> <month> <day-of-week>")
+	}
+
+	_, err := cron.Parse(fmt.Sprintf("* %s", value))
+	if err != nil {
+		return errors.Wrap(err, "Error parsing schedule")
+	}
+
+	return nil
+}
+
 // IsDeviceID validates string is four lowercase hex characters suitable as Vendor or Device ID.
 func IsDeviceID(value string) error {
 	if value == "" {
@@ -298,28 +317,17 @@ var KnownContainerConfigKeys = map[string]func(value string) error{
 	"security.syscalls.blacklist_compat":        IsBool,
 	"security.syscalls.blacklist":               IsAny,
 	"security.syscalls.intercept.mknod":         IsBool,
+	"security.syscalls.intercept.mknod.devices": IsAny,
 	"security.syscalls.intercept.mount":         IsBool,
 	"security.syscalls.intercept.mount.allowed": IsAny,
+	"security.syscalls.intercept.mount.fuse":    IsAny,
 	"security.syscalls.intercept.mount.shift":   IsBool,
 	"security.syscalls.intercept.setxattr":      IsBool,
 	"security.syscalls.whitelist":               IsAny,
 
-	"snapshots.schedule": func(value string) error {
-		if value == "" {
-			return nil
-		}
-
-		if len(strings.Split(value, " ")) != 5 {
-			return fmt.Errorf("Schedule must be of the form: <minute> <hour> <day-of-month> <month> <day-of-week>")
-		}
+	"compaction.schedule": IsCronSchedule,
 
-		_, err := cron.Parse(fmt.Sprintf("* %s", value))
-		if err != nil {
-			return errors.Wrap(err, "Error parsing schedule")
-		}
-
-		return nil
-	},
+	"snapshots.schedule":         IsCronSchedule,
 	"snapshots.schedule.stopped": IsBool,
 	"snapshots.pattern":          IsAny,
 	"snapshots.expiry": func(value string) error {
@@ -327,6 +335,12 @@ var KnownContainerConfigKeys = map[string]func(value string) error{
 		_, err := GetSnapshotExpiry(time.Time{}, value)
 		return err
 	},
+	"snapshots.safety": IsBool,
+	"snapshots.safety.expiry": func(value string) error {
+		// Validate expression
+		_, err := GetSnapshotExpiry(time.Time{}, value)
+		return err
+	},
 
 	// Caller is responsible for full validation of any raw.* value
 	"raw.apparmor": IsAny,
@@ -334,14 +348,25 @@ var KnownContainerConfigKeys = map[string]func(value string) error{
 	"raw.seccomp":  IsAny,
 	"raw.idmap":    IsAny,
 
-	"volatile.apply_template":   IsAny,
-	"volatile.base_image":       IsAny,
-	"volatile.last_state.idmap": IsAny,
-	"volatile.last_state.power": IsAny,
-	"volatile.idmap.base":       IsAny,
-	"volatile.idmap.current":    IsAny,
-	"volatile.idmap.next":       IsAny,
-	"volatile.apply_quota":      IsAny,
+	// Lifecycle webhook, URL checked against core.webhooks_allowed
+	"webhooks.url":    IsAny,
+	"webhooks.events": IsAny,
+
+	// Host commands run at lifecycle points, checked against core.hooks_allowed
+	"hooks.pre_start":     IsAny,
+	"hooks.post_stop":     IsAny,
+	"hooks.post_snapshot": IsAny,
+
+	"volatile.apply_template":      IsAny,
+	"volatile.base_image":          IsAny,
+	"volatile.last_state.idmap":    IsAny,
+	"volatile.last_state.power":    IsAny,
+	"volatile.last_state.profiles": IsAny,
+	"volatile.idmap.base":          IsAny,
+	"volatile.idmap.current":       IsAny,
+	"volatile.idmap.next":          IsAny,
+	"volatile.apply_quota":         IsAny,
+	"volatile.uuid":                IsAny,
 }
 
 // ConfigKeyChecker returns a function that will check whether or not
@@ -356,6 +381,10 @@ func ConfigKeyChecker(key string) (func(value string) error, error) {
 	}
 
 	if strings.HasPrefix(key, "volatile.") {
+		if strings.HasPrefix(key, "volatile.apply_template.") {
+			return IsAny, nil
+		}
+
 		if strings.HasSuffix(key, ".hwaddr") {
 			return IsAny, nil
 		}
@@ -392,6 +421,14 @@ func ConfigKeyChecker(key string) (func(value string) error, error) {
 			return IsAny, nil
 		}
 
+		if strings.HasSuffix(key, ".pci_slot") {
+			return IsAny, nil
+		}
+
+		if strings.HasSuffix(key, ".seeded") {
+			return IsAny, nil
+		}
+
 		if strings.HasSuffix(key, "vm.uuid") {
 			return IsAny, nil
 		}
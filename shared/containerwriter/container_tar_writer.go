@@ -26,6 +26,11 @@ func NewContainerTarWriter(writer io.Writer, idmapSet *idmap.IdmapSet) *Containe
 }
 
 func (ctw *ContainerTarWriter) WriteFile(offset int, path string, fi os.FileInfo) error {
+	return ctw.WriteFileAs(path[offset:], path, fi)
+}
+
+// WriteFileAs adds the file at path to the tarball under the given name.
+func (ctw *ContainerTarWriter) WriteFileAs(name string, path string, fi os.FileInfo) error {
 	var err error
 	var major, minor uint32
 	var nlink int
@@ -49,7 +54,7 @@ func (ctw *ContainerTarWriter) WriteFile(offset int, path string, fi os.FileInfo
 		return fmt.Errorf("failed to create tar info header: %s", err)
 	}
 
-	hdr.Name = path[offset:]
+	hdr.Name = name
 	if fi.IsDir() || fi.Mode()&os.ModeSymlink == os.ModeSymlink {
 		hdr.Size = 0
 	} else {
@@ -114,6 +119,13 @@ func (ctw *ContainerTarWriter) WriteFile(offset int, path string, fi os.FileInfo
 	return nil
 }
 
+// ResetHardLinkMap forgets the files written so far when detecting hard links. It must be called
+// between separate trees, such as the snapshots of a volume, whose files may share inode numbers
+// without being hard links of each other.
+func (ctw *ContainerTarWriter) ResetHardLinkMap() {
+	ctw.linkMap = map[uint64]string{}
+}
+
 func (ctw *ContainerTarWriter) Close() error {
 	err := ctw.tarWriter.Close()
 	if err != nil {
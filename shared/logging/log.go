@@ -12,15 +12,21 @@ import (
 	"github.com/lxc/lxd/shared/logger"
 )
 
-// GetLogger returns a logger suitable for using as logger.Log.
-func GetLogger(syslog string, logfile string, verbose bool, debug bool, customHandler log.Handler) (logger.Logger, error) {
+// GetLogger returns a logger suitable for using as logger.Log. With jsonFormat, the messages are
+// written to the log file, syslog and stderr as JSON objects rather than in logfmt.
+func GetLogger(syslog string, logfile string, verbose bool, debug bool, jsonFormat bool, customHandler log.Handler) (logger.Logger, error) {
 	Log := log.New()
 
 	var handlers []log.Handler
 	var syshandler log.Handler
 
+	format := LogfmtFormat()
+	if jsonFormat {
+		format = log.JsonFormat()
+	}
+
 	// System specific handler
-	syshandler = getSystemHandler(syslog, debug, LogfmtFormat())
+	syshandler = getSystemHandler(syslog, debug, format)
 	if syshandler != nil {
 		handlers = append(handlers, syshandler)
 	}
@@ -31,47 +37,40 @@ func GetLogger(syslog string, logfile string, verbose bool, debug bool, customHa
 			return nil, fmt.Errorf("Log file path doesn't exist: %s", filepath.Dir(logfile))
 		}
 
-		if !debug {
-			handlers = append(
-				handlers,
-				log.LvlFilterHandler(
-					log.LvlInfo,
-					log.Must.FileHandler(logfile, LogfmtFormat()),
-				),
-			)
-		} else {
-			handlers = append(handlers, log.Must.FileHandler(logfile, LogfmtFormat()))
+		lvl := log.LvlInfo
+		if debug {
+			lvl = log.LvlDebug
 		}
+
+		handlers = append(
+			handlers,
+			SubsystemFilterHandler(
+				lvl,
+				log.Must.FileHandler(logfile, format),
+			),
+		)
 	}
 
 	// StderrHandler
-	format := LogfmtFormat()
-	if term.IsTty(os.Stderr.Fd()) {
+	if !jsonFormat && term.IsTty(os.Stderr.Fd()) {
 		format = TerminalFormat()
 	}
 
-	if verbose || debug {
-		if !debug {
-			handlers = append(
-				handlers,
-				log.LvlFilterHandler(
-					log.LvlInfo,
-					log.StreamHandler(os.Stderr, format),
-				),
-			)
-		} else {
-			handlers = append(handlers, log.StreamHandler(os.Stderr, format))
-		}
-	} else {
-		handlers = append(
-			handlers,
-			log.LvlFilterHandler(
-				log.LvlWarn,
-				log.StreamHandler(os.Stderr, format),
-			),
-		)
+	lvl := log.LvlWarn
+	if debug {
+		lvl = log.LvlDebug
+	} else if verbose {
+		lvl = log.LvlInfo
 	}
 
+	handlers = append(
+		handlers,
+		SubsystemFilterHandler(
+			lvl,
+			log.StreamHandler(os.Stderr, format),
+		),
+	)
+
 	if customHandler != nil {
 		handlers = append(handlers, customHandler)
 	}
@@ -10,14 +10,15 @@ import (
 func getSystemHandler(syslog string, debug bool, format log.Format) log.Handler {
 	// SyslogHandler
 	if syslog != "" {
-		if !debug {
-			return log.LvlFilterHandler(
-				log.LvlInfo,
-				log.Must.SyslogHandler(syslog, format),
-			)
+		lvl := log.LvlInfo
+		if debug {
+			lvl = log.LvlDebug
 		}
 
-		return log.Must.SyslogHandler(syslog, format)
+		return SubsystemFilterHandler(
+			lvl,
+			log.Must.SyslogHandler(syslog, format),
+		)
 	}
 
 	return nil
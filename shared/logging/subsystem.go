@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/lxc/lxd/shared/log15"
+
+	"github.com/lxc/lxd/shared/logger"
+)
+
+// Subsystems lists the subsystems whose log level can be set on its own.
+var Subsystems = []string{"storage", "network", "cluster", "qemu"}
+
+// subsystemLevels holds the log levels set for subsystems, overriding the one of the handlers.
+var subsystemLevels = map[string]log.Lvl{}
+var subsystemLevelsLock sync.RWMutex
+
+// SetSubsystemLevel sets the log level of the messages of a subsystem (debug, info, warn, error
+// or crit). An empty level makes the subsystem use the level of each handler again.
+func SetSubsystemLevel(subsystem string, level string) error {
+	subsystemLevelsLock.Lock()
+	defer subsystemLevelsLock.Unlock()
+
+	if level == "" {
+		delete(subsystemLevels, subsystem)
+		return nil
+	}
+
+	lvl, err := log.LvlFromString(level)
+	if err != nil {
+		return err
+	}
+
+	subsystemLevels[subsystem] = lvl
+	return nil
+}
+
+// SubsystemFilterHandler returns a handler only passing the records of a level up to the one of
+// the subsystem they come from (as tagged by a Subsystem logger), or to the given level if no
+// level is set for their subsystem.
+func SubsystemFilterHandler(maxLvl log.Lvl, h log.Handler) log.Handler {
+	return log.FilterHandler(func(r *log.Record) bool {
+		subsystemLevelsLock.RLock()
+		defer subsystemLevelsLock.RUnlock()
+
+		if len(subsystemLevels) == 0 {
+			return r.Lvl <= maxLvl
+		}
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] != "subsystem" {
+				continue
+			}
+
+			subsystem, ok := r.Ctx[i+1].(string)
+			if !ok {
+				break
+			}
+
+			lvl, ok := subsystemLevels[subsystem]
+			if ok {
+				return r.Lvl <= lvl
+			}
+
+			break
+		}
+
+		return r.Lvl <= maxLvl
+	}, h)
+}
+
+// SubsystemLogger logs messages tagged with the subsystem they come from, so that their level can
+// be set on their own. The messages go to the global logger in place at the time they're logged.
+type SubsystemLogger struct {
+	subsystem string
+}
+
+// Subsystem returns a logger tagging its messages with the given subsystem.
+func Subsystem(subsystem string) *SubsystemLogger {
+	return &SubsystemLogger{subsystem: subsystem}
+}
+
+// logger returns the global logger, with the subsystem added to its context.
+func (l *SubsystemLogger) logger() logger.Logger {
+	log15logger, ok := logger.Log.(log.Logger)
+	if !ok {
+		return logger.Log
+	}
+
+	return log15logger.New(log.Ctx{"subsystem": l.subsystem})
+}
+
+// Debug logs a message (with optional context) at the DEBUG log level
+func (l *SubsystemLogger) Debug(msg string, ctx ...interface{}) {
+	l.logger().Debug(msg, ctx...)
+}
+
+// Info logs a message (with optional context) at the INFO log level
+func (l *SubsystemLogger) Info(msg string, ctx ...interface{}) {
+	l.logger().Info(msg, ctx...)
+}
+
+// Warn logs a message (with optional context) at the WARNING log level
+func (l *SubsystemLogger) Warn(msg string, ctx ...interface{}) {
+	l.logger().Warn(msg, ctx...)
+}
+
+// Error logs a message (with optional context) at the ERROR log level
+func (l *SubsystemLogger) Error(msg string, ctx ...interface{}) {
+	l.logger().Error(msg, ctx...)
+}
+
+// Crit logs a message (with optional context) at the CRITICAL log level
+func (l *SubsystemLogger) Crit(msg string, ctx ...interface{}) {
+	l.logger().Crit(msg, ctx...)
+}
+
+// Debugf logs at the DEBUG log level using a standard printf format string
+func (l *SubsystemLogger) Debugf(format string, args ...interface{}) {
+	l.logger().Debug(fmt.Sprintf(format, args...))
+}
+
+// Infof logs at the INFO log level using a standard printf format string
+func (l *SubsystemLogger) Infof(format string, args ...interface{}) {
+	l.logger().Info(fmt.Sprintf(format, args...))
+}
+
+// Warnf logs at the WARNING log level using a standard printf format string
+func (l *SubsystemLogger) Warnf(format string, args ...interface{}) {
+	l.logger().Warn(fmt.Sprintf(format, args...))
+}
+
+// Errorf logs at the ERROR log level using a standard printf format string
+func (l *SubsystemLogger) Errorf(format string, args ...interface{}) {
+	l.logger().Error(fmt.Sprintf(format, args...))
+}
+
+// Critf logs at the CRITICAL log level using a standard printf format string
+func (l *SubsystemLogger) Critf(format string, args ...interface{}) {
+	l.logger().Crit(fmt.Sprintf(format, args...))
+}
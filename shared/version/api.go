@@ -175,6 +175,86 @@ var APIExtensions = []string{
 	"container_syscall_intercept_mount",
 	"compression_squashfs",
 	"container_raw_mount",
+	"shutdown_drain",
+	"create_dry_run",
+	"preseed_apply",
+	"object_etags",
+	"template_triggers_restore_attach",
+	"lifecycle_webhooks",
+	"storage_volume_import",
+	"disk_seed",
+	"zfs_delegate",
+	"zfs_volume_properties",
+	"storage_pool_watermarks",
+	"storage_lvm_thinpool_autogrow",
+	"instance_clone",
+	"storage_flatten_clones",
+	"storage_sparse_block_transfer",
+	"migration_checksum",
+	"storage_pool_concurrency",
+	"projects_default_resources",
+	"projects_export",
+	"instance_volume_uuids",
+	"instance_expanded_sources",
+	"profiles_apply",
+	"metadata_configuration",
+	"instances_state_cache",
+	"database_tracing",
+	"clustering_notify_batch",
+	"clustering_pending_changes",
+	"clustering_auto_forward",
+	"clustering_update_cert",
+	"clustering_migration_mutual_tls",
+	"network_allocations",
+	"network_dns_records",
+	"firewall_driver",
+	"proxy_multiple_addresses",
+	"clustering_maintenance",
+	"clustering_rebalance",
+	"autostart_concurrency",
+	"clustering_storage_placement",
+	"snapshot_files",
+	"backup_file_restore",
+	"secrets_backend",
+	"apparmor_helpers",
+	"syscall_intercept_policy",
+	"syscall_intercept_mount_fuse",
+	"instance_disk_usage_directories",
+	"snapshot_safety",
+	"storage_volume_acls",
+	"storage_volume_snapshot_dates",
+	"storage_error_codes",
+	"logging_subsystems",
+	"custom_block_volumes",
+	"storage_pool_usage",
+	"images_from_custom_block_volumes",
+	"custom_volume_snapshot_schedule",
+	"instance_presets",
+	"custom_volume_snapshot_expiry",
+	"custom_volume_backup",
+	"image_preseed",
+	"snapshot_diff_export",
+	"backup_optimized_negotiation",
+	"storage_stale_mounts",
+	"storage_volume_copy_across_pools",
+	"custom_volume_refresh",
+	"storage_ceph_rbd_namespaces",
+	"instance_snapshots_selection",
+	"instances_compaction",
+	"vm_live_block_migration",
+	"storage_volume_warnings",
+	"vm_disk_online_grow",
+	"storage_volume_state",
+	"content_scanning",
+	"instance_host_hooks",
+	"projects_limits_disk_snapshots",
+	"vm_custom_volumes",
+	"storage_volume_check",
+	"clustering_images_pool",
+	"instance_export_oci",
+	"storage_copy_progress",
+	"storage_transfer_bwlimit",
+	"storage_remote_volume_attach",
 }
 
 // APIExtensionsCount returns the number of available API extensions.